@@ -1,182 +1,259 @@
 package client
 
 import (
+	"context"
+	"sync/atomic"
+
 	"github.com/Osirium/gokrb5/v8/crypto"
-	"github.com/Osirium/gokrb5/v8/crypto/etype"
 	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
 	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
 	"github.com/Osirium/gokrb5/v8/iana/patype"
 	"github.com/Osirium/gokrb5/v8/krberror"
 	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/trace"
 	"github.com/Osirium/gokrb5/v8/types"
 )
 
 // ASExchange performs an AS exchange for the client to retrieve a TGT.
 func (cl *Client) ASExchange(realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
+	return cl.ASExchangeContext(context.Background(), realm, ASReq, referral)
+}
+
+// ASExchangeContext performs an AS exchange for the client to retrieve a TGT.
+// The context provided can be used to cancel the exchange or set a deadline for it.
+//
+// The AS_REQ is pre-authenticated with the registered pre-authentication mechanisms the client can use, in the order
+// of the PreAuthTypes setting. When the KDC requests pre-authentication the most preferred mechanism it lists in its
+// METHOD-DATA is used and the request retried. Exchanges are armored with FAST if a FAST armor client is configured,
+// except when pre-authenticating with PKINIT.
+func (cl *Client) ASExchangeContext(ctx context.Context, realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
+	ctx, span := cl.StartSpan(ctx, trace.SpanASExchange, trace.Attr(trace.AttrRealm, realm), trace.Attr(trace.AttrClient, ASReq.ReqBody.CName.PrincipalNameString()))
+	ASRep, err := cl.asExchange(ctx, realm, ASReq, referral)
+	if err == nil {
+		span.SetAttributes(trace.Attr(trace.AttrEType, ASRep.DecryptedEncPart.Key.KeyType))
+	}
+	trace.EndSpan(span, err)
+	return ASRep, err
+}
+
+func (cl *Client) asExchange(ctx context.Context, realm string, ASReq messages.ASReq, referral int) (messages.ASRep, error) {
 	if ok, err := cl.IsConfigured(); !ok {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.ConfigError, "AS Exchange cannot be performed")
 	}
-
-	// Set PAData if required
-	err := setPAData(cl, nil, &ASReq)
-	if err != nil {
-		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: issue with setting PAData on AS_REQ")
+	ex := &PreAuthExchange{
+		Client: cl,
+		Realm:  realm,
+		ASReq:  &ASReq,
 	}
-
-	b, err := ASReq.Marshal()
+	if cl.fastEnabled() && !cl.pkinitEnabled() {
+		f, err := cl.newASFAST(ctx, realm)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: could not armor AS_REQ with FAST")
+		}
+		ex.fast = f
+	}
+	n := preAuthNegotiation{
+		available: ex.preAuthenticators(),
+		responded: make(map[int32]bool),
+	}
+	basePAData := ASReq.PAData
+	pas, err := n.preemptive(ex)
 	if err != nil {
-		return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ")
+		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: issue with setting PAData on AS_REQ")
 	}
-	var ASRep messages.ASRep
 
-	rb, err := cl.sendToKDC(b, realm)
-	if err != nil {
-		if e, ok := err.(messages.KRBError); ok {
-			switch e.ErrorCode {
-			case errorcode.KDC_ERR_PREAUTH_REQUIRED, errorcode.KDC_ERR_PREAUTH_FAILED:
-				// From now on assume this client will need to do this pre-auth and set the PAData
-				cl.settings.assumePreAuthentication = true
-				err = setPAData(cl, &e, &ASReq)
-				if err != nil {
-					return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed setting AS_REQ PAData for pre-authentication required")
-				}
-				b, err := ASReq.Marshal()
-				if err != nil {
-					return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ with PAData")
-				}
-				rb, err = cl.sendToKDC(b, realm)
+	var rb []byte
+	for attempt := 1; ; attempt++ {
+		err = ex.setPAData(basePAData, pas)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: could not armor AS_REQ with FAST")
+		}
+		b, err := ASReq.Marshal()
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed marshaling AS_REQ")
+		}
+		rb, err = cl.sendToKDC(ctx, b, realm)
+		if err == nil {
+			break
+		}
+		e, ok := err.(messages.KRBError)
+		if !ok {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.NetworkingError, "AS Exchange Error: failed sending AS_REQ to KDC")
+		}
+		var hints messages.PreAuthHints
+		if ex.fast != nil {
+			e, hints, err = ex.fast.krbError(e, ASReq.ReqBody.Nonce)
+			if err != nil {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: invalid FAST error from KDC")
+			}
+		}
+		switch e.ErrorCode {
+		case errorcode.KDC_ERR_PREAUTH_REQUIRED, errorcode.KDC_ERR_PREAUTH_FAILED, errorcode.KDC_ERR_MORE_PREAUTH_DATA_REQUIRED:
+			if attempt >= maxPreAuthAttempts {
+				return messages.ASRep{}, krberror.Errorf(e, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
+			}
+			// From now on assume this client will need to do this pre-auth and set the PAData
+			atomic.StoreInt32(&cl.preAuthRequired, 1)
+			if ex.fast == nil {
+				hints, err = e.PreAuthHints()
 				if err != nil {
-					if _, ok := err.(messages.KRBError); ok {
-						return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
-					}
-					return messages.ASRep{}, krberror.Errorf(err, krberror.NetworkingError, "AS Exchange Error: failed sending AS_REQ to KDC")
+					return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: invalid pre-authentication hints from KDC")
 				}
-			case errorcode.KDC_ERR_WRONG_REALM:
-				// Client referral https://tools.ietf.org/html/rfc6806.html#section-7
-				if referral > 5 {
-					return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "maximum number of client referrals exceeded")
-				}
-				referral++
-				return cl.ASExchange(e.CRealm, ASReq, referral)
-			default:
-				return messages.ASRep{}, krberror.Errorf(err, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
 			}
-		} else {
-			return messages.ASRep{}, krberror.Errorf(err, krberror.NetworkingError, "AS Exchange Error: failed sending AS_REQ to KDC")
+			cl.trace(trace.Event{Type: trace.PreAuthRequired, Realm: realm, Client: ASReq.ReqBody.CName.PrincipalNameString(), ErrorCode: e.ErrorCode, PATypes: paTypes(hints.MethodData)})
+			var ok bool
+			pas, ok, err = n.respond(ex, e, &hints)
+			if err != nil {
+				return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: failed setting AS_REQ PAData for pre-authentication required")
+			}
+			if !ok {
+				return messages.ASRep{}, krberror.Errorf(e, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
+			}
+		case errorcode.KDC_ERR_WRONG_REALM:
+			// Client referral https://tools.ietf.org/html/rfc6806.html#section-7
+			if referral > 5 {
+				return messages.ASRep{}, krberror.Errorf(e, krberror.KRBMsgError, "maximum number of client referrals exceeded")
+			}
+			if e.CRealm == "" || e.CRealm == realm {
+				return messages.ASRep{}, krberror.Errorf(e, krberror.KDCError, "AS Exchange Error: KDC did not refer the client to another realm")
+			}
+			referral++
+			cl.trace(trace.Event{Type: trace.Referral, Realm: realm, MessageType: msgtype.KRB_AS_REQ, Client: ASReq.ReqBody.CName.PrincipalNameString(), ReferredRealm: e.CRealm})
+			// The request is made to the realm referred to and the pre-authentication recreated for it
+			ASReq.ReqBody.Realm = e.CRealm
+			if len(ASReq.ReqBody.SName.NameString) == 2 && ASReq.ReqBody.SName.NameString[0] == "krbtgt" {
+				ASReq.ReqBody.SName.NameString = []string{"krbtgt", e.CRealm}
+			}
+			ASReq.PAData = basePAData
+			return cl.ASExchangeContext(ctx, e.CRealm, ASReq, referral)
+		default:
+			return messages.ASRep{}, krberror.Errorf(e, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
 		}
 	}
+	var ASRep messages.ASRep
 	err = ASRep.Unmarshal(rb)
 	if err != nil {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.EncodingError, "AS Exchange Error: failed to process the AS_REP")
 	}
-	if ok, err := ASRep.Verify(cl.Config, cl.Credentials, ASReq); !ok {
+	replyPAData := ASRep.PAData
+	var r messages.KrbFastResponse
+	if ex.fast != nil {
+		r, err = ex.fast.reply(ASRep.PAData, ASReq.ReqBody.Nonce)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: invalid FAST response in AS_REP")
+		}
+		replyPAData = r.PAData
+		if r.HasFinished() {
+			// The client name in the FAST response is protected by the armor key, unlike that of the outer reply
+			ASRep.CName = r.Finished.CName
+			ASRep.CRealm = r.Finished.CRealm
+		}
+	}
+	key, err := n.replyKey(ex, ASRep, replyPAData)
+	if err != nil {
+		return messages.ASRep{}, krberror.Errorf(err, krberror.DecryptingError, "AS Exchange Error: could not get the AS_REP reply key")
+	}
+	if ex.fast != nil {
+		key, err = ex.fast.replyKey(r, ASRep.Ticket, key)
+		if err != nil {
+			return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: invalid FAST response in AS_REP")
+		}
+	}
+	if ok, err := ASRep.VerifyWithKey(cl.config(), key, ASReq); !ok {
 		return messages.ASRep{}, krberror.Errorf(err, krberror.KRBMsgError, "AS Exchange Error: AS_REP is not valid or client password/keytab incorrect")
 	}
+	if p := cl.etypePolicy(); !p.Permits(ASRep.EncPart.EType) || !p.PermitsTkt(ASRep.DecryptedEncPart.Key.KeyType) {
+		return messages.ASRep{}, krberror.NewErrorf(krberror.KRBMsgError, "AS Exchange Error: AS_REP encryption type %d or TGT session key encryption type %d not permitted by the configuration", ASRep.EncPart.EType, ASRep.DecryptedEncPart.Key.KeyType)
+	}
+	if cl.settings.anonymous && !types.IsFlagSet(&ASRep.DecryptedEncPart.Flags, flags.Anonymous) {
+		return messages.ASRep{}, krberror.NewErrorf(krberror.KRBMsgError, "AS Exchange Error: KDC did not issue an anonymous ticket")
+	}
+	cl.trace(trace.Event{Type: trace.ETypeNegotiated, Realm: realm, MessageType: msgtype.KRB_AS_REP, Client: ASRep.CName.PrincipalNameString(), Service: ASRep.Ticket.SName.PrincipalNameString(), EType: ASRep.DecryptedEncPart.Key.KeyType})
 	return ASRep, nil
 }
 
-// setPAData adds pre-authentication data to the AS_REQ.
-func setPAData(cl *Client, krberr *messages.KRBError, ASReq *messages.ASReq) error {
-	if !cl.settings.DisablePAFXFAST() {
-		pa := types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP}
-		ASReq.PAData = append(ASReq.PAData, pa)
-	}
-	if cl.settings.AssumePreAuthentication() {
-		// Identify the etype to use to encrypt the PA Data
-		var et etype.EType
-		var err error
-		var key types.EncryptionKey
-		var kvno int
-		if krberr == nil {
-			// This is not in response to an error from the KDC. It is preemptive or renewal
-			// There is no KRB Error that tells us the etype to use
-			etn := cl.settings.preAuthEType // Use the etype that may have previously been negotiated
-			if etn == 0 {
-				etn = int32(cl.Config.LibDefaults.PreferredPreauthTypes[0]) // Resort to config
-			}
-			et, err = crypto.GetEtype(etn)
-			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
-			}
-			key, kvno, err = cl.Key(et, 0, nil)
-			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
-			}
-		} else {
-			// Get the etype to use from the PA data in the KRBError e-data
-			et, err = preAuthEType(krberr)
-			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
-			}
-			cl.settings.preAuthEType = et.GetETypeID() // Set the etype that has been defined for potential future use
-			key, kvno, err = cl.Key(et, 0, krberr)
-			if err != nil {
-				return krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
-			}
-		}
-		// Generate the PA data
-		paTSb, err := types.GetPAEncTSEncAsnMarshalled()
-		if err != nil {
-			return krberror.Errorf(err, krberror.KRBMsgError, "error creating PAEncTSEnc for Pre-Authentication")
-		}
-		paEncTS, err := crypto.GetEncryptedData(paTSb, key, keyusage.AS_REQ_PA_ENC_TIMESTAMP, kvno)
-		if err != nil {
-			return krberror.Errorf(err, krberror.EncryptingError, "error encrypting pre-authentication timestamp")
-		}
-		pb, err := paEncTS.Marshal()
+// paTypes returns the types of the pre-authentication data.
+func paTypes(pas types.PADataSequence) []int32 {
+	t := make([]int32, len(pas))
+	for i, pa := range pas {
+		t[i] = pa.PADataType
+	}
+	return t
+}
+
+// setPAData sets the pre-authentication data of the AS_REQ to that provided to the exchange and that of the
+// pre-authentication mechanism. In an exchange armored with FAST the mechanism's data is carried within the armored
+// request.
+func (ex *PreAuthExchange) setPAData(base, pas types.PADataSequence) error {
+	p := make(types.PADataSequence, len(base), len(base)+len(pas)+1)
+	copy(p, base)
+	if ex.fast != nil {
+		pa, err := ex.fast.wrap(ex.ASReq.ReqBody, pas)
 		if err != nil {
-			return krberror.Errorf(err, krberror.EncodingError, "error marshaling the PAEncTSEnc encrypted data")
+			return err
 		}
-		pa := types.PAData{
-			PADataType:  patype.PA_ENC_TIMESTAMP,
-			PADataValue: pb,
-		}
-		// Look for and delete any exiting patype.PA_ENC_TIMESTAMP
-		for i, pa := range ASReq.PAData {
-			if pa.PADataType == patype.PA_ENC_TIMESTAMP {
-				ASReq.PAData[i] = ASReq.PAData[len(ASReq.PAData)-1]
-				ASReq.PAData = ASReq.PAData[:len(ASReq.PAData)-1]
-			}
-		}
-		ASReq.PAData = append(ASReq.PAData, pa)
+		ex.ASReq.PAData = append(p, pa)
+		return nil
 	}
+	if !ex.Client.settings.DisablePAFXFAST() {
+		p = append(p, types.PAData{PADataType: patype.PA_REQ_ENC_PA_REP})
+	}
+	ex.ASReq.PAData = append(p, pas...)
 	return nil
 }
 
-// preAuthEType establishes what encryption type to use for pre-authentication from the KRBError returned from the KDC.
-func preAuthEType(krberr *messages.KRBError) (etype etype.EType, err error) {
-	//RFC 4120 5.2.7.5 covers the preference order of ETYPE-INFO2 and ETYPE-INFO.
-	var etypeID int32
-	var pas types.PADataSequence
-	e := pas.Unmarshal(krberr.EData)
-	if e != nil {
-		err = krberror.Errorf(e, krberror.EncodingError, "error unmashalling KRBError data")
-		return
-	}
-Loop:
-	for _, pa := range pas {
-		switch pa.PADataType {
-		case patype.PA_ETYPE_INFO2:
-			info, e := pa.GetETypeInfo2()
-			if e != nil {
-				err = krberror.Errorf(e, krberror.EncodingError, "error unmashalling ETYPE-INFO2 data")
-				return
-			}
-			etypeID = info[0].EType
-			break Loop
-		case patype.PA_ETYPE_INFO:
-			info, e := pa.GetETypeInfo()
-			if e != nil {
-				err = krberror.Errorf(e, krberror.EncodingError, "error unmashalling ETYPE-INFO data")
-				return
-			}
-			etypeID = info[0].EType
-		}
+// encTimestampPreAuth pre-authenticates with a timestamp encrypted with the client's long-term key (PA-ENC-TIMESTAMP).
+// It is not used in exchanges armored with FAST, where the encrypted challenge replaces it.
+type encTimestampPreAuth struct{}
+
+func newEncTimestampPreAuth(ex *PreAuthExchange) (PreAuthenticator, bool) {
+	if ex.Armored() || !ex.Client.hasLongTermKey() {
+		return nil, false
+	}
+	return encTimestampPreAuth{}, true
+}
+
+// PAData returns the PA-ENC-TIMESTAMP pre-authentication data.
+func (encTimestampPreAuth) PAData(ex *PreAuthExchange, hints *messages.PreAuthHints) (types.PADataSequence, error) {
+	cl := ex.Client
+	if hints == nil && !cl.assumePreAuthentication() {
+		return nil, nil
 	}
-	etype, e = crypto.GetEtype(etypeID)
-	if e != nil {
-		err = krberror.Errorf(e, krberror.EncryptingError, "error creating etype")
-		return
+	et, err := cl.preAuthEType(hints)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
 	}
-	return etype, nil
+	var key types.EncryptionKey
+	var kvno int
+	if cl.Creds().HasKeytab() {
+		key, kvno, err = cl.Key(et, 0, nil)
+	} else {
+		key, err = cl.longTermKey(et, preAuthPAData(hints))
+	}
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
+	}
+	paTSb, err := types.GetPAEncTSEncAsnMarshalledOffset(cl.Creds().KDCOffset())
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "error creating PAEncTSEnc for Pre-Authentication")
+	}
+	paEncTS, err := crypto.GetEncryptedData(paTSb, key, keyusage.AS_REQ_PA_ENC_TIMESTAMP, kvno)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error encrypting pre-authentication timestamp")
+	}
+	pb, err := paEncTS.Marshal()
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling the PAEncTSEnc encrypted data")
+	}
+	return types.PADataSequence{{
+		PADataType:  patype.PA_ENC_TIMESTAMP,
+		PADataValue: pb,
+	}}, nil
+}
+
+// ReplyKey returns the client's long-term key.
+func (encTimestampPreAuth) ReplyKey(ex *PreAuthExchange, asRep messages.ASRep, pas types.PADataSequence) (types.EncryptionKey, error) {
+	return ex.Client.asRepKey(asRep, pas)
 }
@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana"
+	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	canonTestHomeRealm  = "TEST.GOKRB5"
+	canonTestUsersRealm = "USERS.GOKRB5"
+)
+
+// canonKDC is the KDC of a realm that refers enterprise names of another realm's users to that realm, or that issues
+// TGTs to its own users under their canonical names.
+type canonKDC struct {
+	realm string
+	kt    *keytab.Keytab
+	// unprotected replies without the encrypted pre-authentication data that protects the canonical names
+	unprotected bool
+	mux         sync.Mutex
+	asReqs      []messages.ASReq
+}
+
+func (k *canonKDC) serve(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b, err := readTCPMessage(c)
+		if err == nil {
+			var asReq messages.ASReq
+			var rb []byte
+			if err = asReq.Unmarshal(b); err == nil {
+				rb, err = k.as(asReq, b)
+			}
+			if err == nil {
+				c.Write(tcpFrame(rb))
+			}
+		}
+		c.Close()
+	}
+}
+
+func (k *canonKDC) as(asReq messages.ASReq, b []byte) ([]byte, error) {
+	k.mux.Lock()
+	k.asReqs = append(k.asReqs, asReq)
+	k.mux.Unlock()
+	if asReq.ReqBody.CName.NameType != nametype.KRB_NT_ENTERPRISE || !types.IsFlagSet(&asReq.ReqBody.KDCOptions, flags.Canonicalize) {
+		return nil, errors.New("request is not for a canonicalized enterprise name")
+	}
+	if k.realm == canonTestHomeRealm {
+		e := messages.NewKRBError(asReq.ReqBody.SName, k.realm, errorcode.KDC_ERR_WRONG_REALM, "")
+		e.CRealm = canonTestUsersRealm
+		return e.Marshal()
+	}
+	if asReq.ReqBody.Realm != k.realm || asReq.ReqBody.SName.PrincipalNameString() != "krbtgt/"+k.realm {
+		return nil, fmt.Errorf("request is not for the TGT of realm %s", k.realm)
+	}
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "user")
+	userKey, _, err := crypto.GetKeyFromPassword("passwd", cname, k.realm, etypeID.AES256_CTS_HMAC_SHA1_96, types.PADataSequence{})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+k.realm)
+	tkt, skey, err := messages.NewTicket(cname, k.realm, sname, k.realm, types.NewKrbFlags(), k.kt, etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	dep := messages.EncKDCRepPart{
+		Key:       skey,
+		LastReqs:  []messages.LastReq{},
+		Nonce:     asReq.ReqBody.Nonce,
+		Flags:     types.NewKrbFlags(),
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(time.Hour),
+		SRealm:    k.realm,
+		SName:     sname,
+	}
+	if !k.unprotected && asReq.PAData.Contains(patype.PA_REQ_ENC_PA_REP) {
+		// Protect the canonical names with a checksum of the request in the encrypted part (RFC 6806 section 11)
+		et, err := crypto.GetEtype(userKey.KeyType)
+		if err != nil {
+			return nil, err
+		}
+		cksum, err := et.GetChecksumHash(userKey.KeyValue, b, keyusage.KEY_USAGE_AS_REQ)
+		if err != nil {
+			return nil, err
+		}
+		pb, err := asn1.Marshal(types.PAReqEncPARep{ChksumType: et.GetHashID(), Chksum: cksum})
+		if err != nil {
+			return nil, err
+		}
+		types.SetFlag(&dep.Flags, flags.EncPARep)
+		dep.EncPAData = types.PADataSequence{
+			{PADataType: patype.PA_REQ_ENC_PA_REP, PADataValue: pb},
+			{PADataType: patype.PA_FX_FAST},
+		}
+	}
+	db, err := dep.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	ed, err := crypto.GetEncryptedData(db, userKey, keyusage.AS_REP_ENCPART, 0)
+	if err != nil {
+		return nil, err
+	}
+	r := messages.ASRep{KDCRepFields: messages.KDCRepFields{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_AS_REP,
+		CRealm:  k.realm,
+		CName:   cname,
+		Ticket:  tkt,
+		EncPart: ed,
+	}}
+	return r.Marshal()
+}
+
+func (k *canonKDC) requests() int {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	return len(k.asReqs)
+}
+
+// canonTestClient returns a client for an enterprise name, configured for the KDCs of the home and users' realms.
+func canonTestClient(t *testing.T, unprotected bool) (*Client, map[string]*canonKDC) {
+	kt := keytab.New()
+	if err := kt.AddEntry("krbtgt/"+canonTestUsersRealm, canonTestUsersRealm, "secret", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("error adding keytab entry: %v", err)
+	}
+	kdcs := make(map[string]*canonKDC)
+	cfg := fmt.Sprintf("[libdefaults]\n default_realm = %s\n udp_preference_limit = 1\n[realms]\n", canonTestHomeRealm)
+	for _, r := range []string{canonTestHomeRealm, canonTestUsersRealm} {
+		kdc := &canonKDC{realm: r, kt: kt, unprotected: unprotected}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("error listening on TCP: %v", err)
+		}
+		t.Cleanup(func() { l.Close() })
+		go kdc.serve(l)
+		kdcs[r] = kdc
+		cfg += fmt.Sprintf(" %s = {\n  kdc = %s\n }\n", r, l.Addr().String())
+	}
+	c, err := config.NewFromString(cfg)
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+	return NewWithPassword("user@users.gokrb5", canonTestHomeRealm, "passwd", c), kdcs
+}
+
+func TestClient_LoginCanonicalize(t *testing.T) {
+	t.Parallel()
+	cl, kdcs := canonTestClient(t, false)
+	assert.Equal(t, nametype.KRB_NT_ENTERPRISE, cl.Credentials.CName().NameType, "client name should be an enterprise name")
+	err := cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in: %v", err)
+	}
+	assert.Equal(t, 1, kdcs[canonTestHomeRealm].requests(), "requests to the home realm's KDC not as expected")
+	assert.Equal(t, 1, kdcs[canonTestUsersRealm].requests(), "requests to the users' realm's KDC not as expected")
+
+	// The client takes the canonical name and realm it was referred to
+	assert.Equal(t, types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "user"), cl.Credentials.CName(), "client name not canonicalized")
+	assert.Equal(t, canonTestUsersRealm, cl.Credentials.Domain(), "client realm not that referred to")
+	_, _, err = cl.sessionTGT(context.Background(), canonTestUsersRealm)
+	assert.NoError(t, err, "TGT session for the users' realm not found")
+}
+
+func TestClient_LoginCanonicalizeUnprotected(t *testing.T) {
+	t.Parallel()
+	cl, _ := canonTestClient(t, true)
+	err := cl.Login()
+	if assert.Error(t, err, "names canonicalized in an unprotected reply should not be accepted") {
+		assert.Contains(t, err.Error(), "unprotected", "error not as expected")
+	}
+	assert.Equal(t, "user@users.gokrb5", cl.Credentials.CName().PrincipalNameString(), "client name should not be changed")
+}
@@ -1,34 +1,75 @@
 package client
 
 import (
+	"context"
 	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
 	"github.com/Osirium/gokrb5/v8/iana/nametype"
 	"github.com/Osirium/gokrb5/v8/krberror"
 	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/trace"
 	"github.com/Osirium/gokrb5/v8/types"
 )
 
 // TGSREQGenerateAndExchange generates the TGS_REQ and performs a TGS exchange to retrieve a ticket to the specified SPN.
 func (cl *Client) TGSREQGenerateAndExchange(spn types.PrincipalName, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, renewal bool) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
-	tgsReq, err = messages.NewTGSReq(cl.Credentials.CName(), kdcRealm, cl.Config, tgt, sessionKey, spn, renewal)
+	return cl.TGSREQGenerateAndExchangeContext(context.Background(), spn, kdcRealm, tgt, sessionKey, renewal)
+}
+
+// TGSREQGenerateAndExchangeContext generates the TGS_REQ and performs a TGS exchange to retrieve a ticket to the
+// specified SPN. The context provided can be used to cancel the exchange or set a deadline for it.
+func (cl *Client) TGSREQGenerateAndExchangeContext(ctx context.Context, spn types.PrincipalName, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, renewal bool) (tgsReq messages.TGSReq, tgsRep messages.TGSRep, err error) {
+	tgsReq, err = messages.NewTGSReq(cl.Creds().CName(), kdcRealm, cl.config(), tgt, sessionKey, spn, renewal)
+	if err == nil {
+		err = cl.applyKDCOffset(&tgsReq, tgt, sessionKey)
+	}
 	if err != nil {
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new TGS_REQ")
 	}
-	return cl.TGSExchange(tgsReq, kdcRealm, tgsRep.Ticket, sessionKey, 0)
+	return cl.TGSExchangeContext(ctx, tgsReq, kdcRealm, tgt, sessionKey, 0)
 }
 
 // TGSExchange exchanges the provided TGS_REQ with the KDC to retrieve a TGS_REP.
 // Referrals are automatically handled.
 // The client's cache is updated with the ticket received.
 func (cl *Client) TGSExchange(tgsReq messages.TGSReq, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, referral int) (messages.TGSReq, messages.TGSRep, error) {
+	return cl.TGSExchangeContext(context.Background(), tgsReq, kdcRealm, tgt, sessionKey, referral)
+}
+
+// TGSExchangeContext exchanges the provided TGS_REQ with the KDC to retrieve a TGS_REP.
+// The context provided can be used to cancel the exchange or set a deadline for it, including any referrals followed.
+func (cl *Client) TGSExchangeContext(ctx context.Context, tgsReq messages.TGSReq, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, referral int) (messages.TGSReq, messages.TGSRep, error) {
+	ctx, span := cl.StartSpan(ctx, trace.SpanTGSExchange, trace.Attr(trace.AttrRealm, kdcRealm), trace.Attr(trace.AttrService, tgsReq.ReqBody.SName.PrincipalNameString()))
+	tgsReq, tgsRep, err := cl.tgsExchange(ctx, tgsReq, kdcRealm, tgt, sessionKey, referral)
+	if err == nil {
+		span.SetAttributes(trace.Attr(trace.AttrEType, tgsRep.DecryptedEncPart.Key.KeyType))
+	}
+	trace.EndSpan(span, err)
+	return tgsReq, tgsRep, err
+}
+
+func (cl *Client) tgsExchange(ctx context.Context, tgsReq messages.TGSReq, kdcRealm string, tgt messages.Ticket, sessionKey types.EncryptionKey, referral int) (messages.TGSReq, messages.TGSRep, error) {
 	var tgsRep messages.TGSRep
+	var f *fastExchange
+	if cl.fastEnabled() {
+		var err error
+		f, err = cl.armorTGSReq(&tgsReq, tgt, sessionKey)
+		if err != nil {
+			return tgsReq, tgsRep, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: could not armor TGS_REQ with FAST")
+		}
+	}
 	b, err := tgsReq.Marshal()
 	if err != nil {
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to marshal TGS_REQ")
 	}
-	r, err := cl.sendToKDC(b, kdcRealm)
+	r, err := cl.sendToKDC(ctx, b, kdcRealm)
 	if err != nil {
-		if _, ok := err.(messages.KRBError); ok {
+		if e, ok := err.(messages.KRBError); ok {
+			if f != nil {
+				if ie, _, ferr := f.krbError(e, tgsReq.ReqBody.Nonce); ferr == nil {
+					err = ie
+				}
+			}
 			return tgsReq, tgsRep, krberror.Errorf(err, krberror.KDCError, "TGS Exchange Error: kerberos error response from KDC when requesting for %s", tgsReq.ReqBody.SName.PrincipalNameString())
 		}
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.NetworkingError, "TGS Exchange Error: issue sending TGS_REQ to KDC")
@@ -37,13 +78,21 @@ func (cl *Client) TGSExchange(tgsReq messages.TGSReq, kdcRealm string, tgt messa
 	if err != nil {
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
 	}
-	err = tgsRep.DecryptEncPart(sessionKey)
+	if f != nil {
+		err = decryptFASTTGSRep(f, &tgsRep, tgsReq)
+	} else {
+		err = tgsRep.DecryptEncPart(sessionKey)
+	}
 	if err != nil {
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: failed to process the TGS_REP")
 	}
-	if ok, err := tgsRep.Verify(cl.Config, tgsReq); !ok {
+	if ok, err := tgsRep.Verify(cl.config(), tgsReq); !ok {
 		return tgsReq, tgsRep, krberror.Errorf(err, krberror.EncodingError, "TGS Exchange Error: TGS_REP is not valid")
 	}
+	if !cl.etypePolicy().PermitsTGS(tgsRep.DecryptedEncPart.Key.KeyType) {
+		return tgsReq, tgsRep, krberror.NewErrorf(krberror.KRBMsgError, "TGS Exchange Error: session key encryption type %d not permitted by the configuration", tgsRep.DecryptedEncPart.Key.KeyType)
+	}
+	cl.trace(trace.Event{Type: trace.ETypeNegotiated, Realm: kdcRealm, MessageType: msgtype.KRB_TGS_REP, Client: tgsRep.CName.PrincipalNameString(), Service: tgsRep.Ticket.SName.PrincipalNameString(), EType: tgsRep.DecryptedEncPart.Key.KeyType})
 
 	if tgsRep.Ticket.SName.NameString[0] == "krbtgt" && !tgsRep.Ticket.SName.Equal(tgsReq.ReqBody.SName) {
 		if referral > 5 {
@@ -54,50 +103,259 @@ func (cl *Client) TGSExchange(tgsReq messages.TGSReq, kdcRealm string, tgt messa
 		cl.addSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
 		realm := tgsRep.Ticket.SName.NameString[len(tgsRep.Ticket.SName.NameString)-1]
 		referral++
+		cl.trace(trace.Event{Type: trace.Referral, Realm: kdcRealm, MessageType: msgtype.KRB_TGS_REQ, Client: tgsRep.CName.PrincipalNameString(), Service: tgsReq.ReqBody.SName.PrincipalNameString(), ReferredRealm: realm})
 		if types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.EncTktInSkey) && len(tgsReq.ReqBody.AdditionalTickets) > 0 {
-			tgsReq, err = messages.NewUser2UserTGSReq(cl.Credentials.CName(), kdcRealm, cl.Config, tgt, sessionKey, tgsReq.ReqBody.SName, tgsReq.Renewal, tgsReq.ReqBody.AdditionalTickets[0])
-			if err != nil {
-				return tgsReq, tgsRep, err
-			}
+			tgsReq, err = messages.NewUser2UserTGSReq(cl.Creds().CName(), realm, cl.config(), tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, tgsReq.ReqBody.SName, tgsReq.Renewal, tgsReq.ReqBody.AdditionalTickets[0])
+		} else if types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.CNameInAddlTkt) && len(tgsReq.ReqBody.AdditionalTickets) > 0 {
+			tgsReq, err = messages.NewS4U2ProxyTGSReq(cl.Creds().CName(), realm, cl.config(), tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, tgsReq.ReqBody.SName, tgsReq.ReqBody.AdditionalTickets[0])
+		} else if pfu, ok, _ := tgsReq.ForUser(); ok {
+			tgsReq, err = messages.NewS4U2SelfTGSReq(cl.Creds().CName(), realm, cl.config(), tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, tgsReq.ReqBody.SName, pfu.UserName, pfu.UserRealm)
+		} else {
+			tgsReq, err = messages.NewTGSReq(cl.Creds().CName(), realm, cl.config(), tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, tgsReq.ReqBody.SName, tgsReq.Renewal)
+		}
+		if err == nil {
+			err = cl.applyKDCOffset(&tgsReq, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key)
 		}
-		tgsReq, err = messages.NewTGSReq(cl.Credentials.CName(), realm, cl.Config, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, tgsReq.ReqBody.SName, tgsReq.Renewal)
 		if err != nil {
 			return tgsReq, tgsRep, err
 		}
-		return cl.TGSExchange(tgsReq, realm, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, referral)
+		return cl.TGSExchangeContext(ctx, tgsReq, realm, tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, referral)
+	}
+	if onBehalfOfUser(tgsReq) {
+		// Tickets obtained on behalf of another user are not cached as the client's own
+		return tgsReq, tgsRep, err
+	}
+	if types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.Forwarded) {
+		// Forwarded TGTs are for delegation to services so do not replace the client's own TGT
+		return tgsReq, tgsRep, err
 	}
-	cl.cache.addEntry(
+	if types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.EncTktInSkey) {
+		// User-to-user tickets are encrypted for the session key of a particular TGT of the peer so are not reused
+		return tgsReq, tgsRep, err
+	}
+	e := cl.cache.addEntry(
 		tgsRep.Ticket,
 		tgsRep.DecryptedEncPart.AuthTime,
 		tgsRep.DecryptedEncPart.StartTime,
 		tgsRep.DecryptedEncPart.EndTime,
 		tgsRep.DecryptedEncPart.RenewTill,
 		tgsRep.DecryptedEncPart.Key,
+		tgsRep.DecryptedEncPart.Flags,
 	)
+	if spn := tgsReq.ReqBody.SName.PrincipalNameString(); spn != e.SPN {
+		// A ticket issued under the service's canonical name is also found by the name it was requested with
+		cl.cache.addAlias(spn, e)
+	}
+	cl.storeCCache(tgsRep.Ticket, tgsRep.DecryptedEncPart)
 	cl.Log("ticket added to cache for %s (EndTime: %v)", tgsRep.Ticket.SName.PrincipalNameString(), tgsRep.DecryptedEncPart.EndTime)
 	return tgsReq, tgsRep, err
 }
 
 // GetServiceTicket makes a request to get a service ticket for the SPN specified
 // SPN format: <SERVICE>/<FQDN> Eg. HTTP/www.example.com
-// The ticket will be added to the client's ticket cache
+// The ticket will be added to the client's ticket cache and a cached ticket is returned while it remains valid.
+// Concurrent calls for the same SPN result in a single request to the KDC.
 func (cl *Client) GetServiceTicket(spn string) (messages.Ticket, types.EncryptionKey, error) {
-	var tkt messages.Ticket
-	var skey types.EncryptionKey
-	if tkt, skey, ok := cl.GetCachedTicket(spn); ok {
+	return cl.GetServiceTicketContext(context.Background(), spn)
+}
+
+// GetServiceTicketContext makes a request to get a service ticket for the SPN specified, as GetServiceTicket does.
+// The context provided can be used to cancel the request or set a deadline for it, including any exchange with the
+// KDC needed to obtain or renew the TGT.
+func (cl *Client) GetServiceTicketContext(ctx context.Context, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	e, ok := cl.cachedTicket(spn)
+	cl.settings.Metrics().TicketCache(ok)
+	if ok {
 		// Already a valid ticket in the cache
-		return tkt, skey, nil
+		cl.Log("ticket received from cache for %s", spn)
+		return e.Ticket, e.SessionKey, nil
 	}
+	// Concurrent requests for the same SPN share a single exchange with the KDC
+	return cl.ticketFlights.do(ctx, spn, func() (messages.Ticket, types.EncryptionKey, error) {
+		var tkt messages.Ticket
+		var skey types.EncryptionKey
+		if tkt, skey, ok := cl.getCachedTicket(ctx, spn); ok {
+			return tkt, skey, nil
+		}
+		princ := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
+		realm := cl.config().ResolveRealm(princ.NameString[len(princ.NameString)-1])
+
+		tgt, skey, err := cl.sessionTGT(ctx, realm)
+		if err != nil {
+			return tkt, skey, err
+		}
+		_, tgsRep, err := cl.TGSREQGenerateAndExchangeContext(ctx, princ, realm, tgt, skey, false)
+		if err != nil {
+			return tkt, skey, err
+		}
+		return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+	})
+}
+
+// GetServiceTicketForUser obtains a ticket to the client's own service on behalf of the user specified, who has
+// authenticated to the service by other means, using S4U2Self protocol transition (MS-SFU). The client must be the
+// service the SPN names, for example a client created with the service's keytab.
+// User format: <NAME>@<REALM> Eg. jsmith@EXAMPLE.COM; the realm defaults to the client's realm if not included.
+// The ticket is issued to the user and is not added to the client's ticket cache.
+func (cl *Client) GetServiceTicketForUser(user, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.GetServiceTicketForUserContext(context.Background(), user, spn)
+}
+
+// GetServiceTicketForUserContext obtains a ticket on behalf of the user specified, as GetServiceTicketForUser does.
+// The context provided can be used to cancel the request or set a deadline for it.
+func (cl *Client) GetServiceTicketForUserContext(ctx context.Context, user, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	c := cl.Creds()
+	upn, urealm := types.ParseSPNString(user)
+	if urealm == "" {
+		urealm = c.Domain()
+	}
+	realm := c.Domain()
+	tgt, skey, err := cl.sessionTGT(ctx, realm)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	tgsReq, err := messages.NewS4U2SelfTGSReq(c.CName(), realm, cl.config(), tgt, skey,
+		types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn), upn, urealm)
+	if err == nil {
+		err = cl.applyKDCOffset(&tgsReq, tgt, skey)
+	}
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new S4U2Self TGS_REQ")
+	}
+	_, tgsRep, err := cl.TGSExchangeContext(ctx, tgsReq, realm, tgt, skey, 0)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
+
+// GetServiceTicketForProxy obtains a ticket to the SPN specified on behalf of the user the evidence ticket was issued
+// to, using S4U2Proxy constrained delegation (MS-SFU). The evidence ticket is the user's forwardable ticket to the
+// client's own service, either received from the user or obtained with GetServiceTicketForUser. The KDC must permit
+// the client's service to delegate to the SPN, with classic or resource-based constrained delegation.
+// The ticket is issued to the user and is not added to the client's ticket cache.
+func (cl *Client) GetServiceTicketForProxy(evidence messages.Ticket, spn string) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.GetServiceTicketForProxyContext(context.Background(), evidence, spn)
+}
+
+// GetServiceTicketForProxyContext obtains a ticket on behalf of the user the evidence ticket was issued to, as
+// GetServiceTicketForProxy does. The context provided can be used to cancel the request or set a deadline for it.
+func (cl *Client) GetServiceTicketForProxyContext(ctx context.Context, evidence messages.Ticket, spn string) (messages.Ticket, types.EncryptionKey, error) {
 	princ := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
-	realm := cl.Config.ResolveRealm(princ.NameString[len(princ.NameString)-1])
+	c := cl.Creds()
+	realm := c.Domain()
+	tgt, skey, err := cl.sessionTGT(ctx, realm)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	tgsReq, err := messages.NewS4U2ProxyTGSReq(c.CName(), realm, cl.config(), tgt, skey, princ, evidence)
+	if err == nil {
+		err = cl.applyKDCOffset(&tgsReq, tgt, skey)
+	}
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new S4U2Proxy TGS_REQ")
+	}
+	_, tgsRep, err := cl.TGSExchangeContext(ctx, tgsReq, realm, tgt, skey, 0)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
+}
 
-	tgt, skey, err := cl.sessionTGT(realm)
+// GetForwardedTGT obtains a forwarded TGT for the client's realm that can be delegated to a service, for example in
+// the credentials delegated within a GSS-API security context. The client's TGT must be forwardable.
+// The forwarded TGT is not added to the client's sessions or ticket cache.
+func (cl *Client) GetForwardedTGT() (messages.Ticket, messages.EncKDCRepPart, error) {
+	return cl.GetForwardedTGTContext(context.Background())
+}
+
+// GetForwardedTGTContext obtains a forwarded TGT, as GetForwardedTGT does. The context provided can be used to cancel
+// the request or set a deadline for it.
+func (cl *Client) GetForwardedTGTContext(ctx context.Context) (messages.Ticket, messages.EncKDCRepPart, error) {
+	c := cl.Creds()
+	realm := c.Domain()
+	tgt, skey, err := cl.sessionTGT(ctx, realm)
+	if err != nil {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, err
+	}
+	tgsReq, err := messages.NewForwardedTGTReq(c.CName(), realm, cl.config(), tgt, skey)
+	if err == nil {
+		err = cl.applyKDCOffset(&tgsReq, tgt, skey)
+	}
 	if err != nil {
-		return tkt, skey, err
+		return messages.Ticket{}, messages.EncKDCRepPart{}, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new TGS_REQ for a forwarded TGT")
 	}
-	_, tgsRep, err := cl.TGSREQGenerateAndExchange(princ, realm, tgt, skey, false)
+	_, tgsRep, err := cl.TGSExchangeContext(ctx, tgsReq, realm, tgt, skey, 0)
 	if err != nil {
-		return tkt, skey, err
+		return messages.Ticket{}, messages.EncKDCRepPart{}, err
+	}
+	if !types.IsFlagSet(&tgsRep.DecryptedEncPart.Flags, flags.Forwarded) {
+		return messages.Ticket{}, messages.EncKDCRepPart{}, krberror.NewErrorf(krberror.KRBMsgError, "TGS Exchange Error: KDC did not issue a forwarded TGT")
+	}
+	return tgsRep.Ticket, tgsRep.DecryptedEncPart, nil
+}
+
+// GetTGT returns the client's TGT for its realm and the TGT's session key, logging in or renewing the TGT as needed.
+// A peer of the client uses the TGT to obtain a user-to-user ticket to the client, which the client decrypts with the
+// session key. The session key must not be disclosed.
+func (cl *Client) GetTGT() (messages.Ticket, types.EncryptionKey, error) {
+	return cl.GetTGTContext(context.Background())
+}
+
+// GetTGTContext returns the client's TGT for its realm and the TGT's session key, as GetTGT does. The context provided
+// can be used to cancel any exchange with the KDC or set a deadline for it.
+func (cl *Client) GetTGTContext(ctx context.Context) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.sessionTGT(ctx, cl.Creds().Domain())
+}
+
+// GetUser2UserTicket obtains a user-to-user ticket to the peer specified, which is encrypted with the session key of
+// the peer's TGT rather than a long-term key of the peer (https://tools.ietf.org/html/rfc4120#section-3.7). The peer,
+// for example an application without a keytab, provides its TGT to the client, such as from its GetTGT method.
+// Peer format: <NAME> or <SERVICE>/<FQDN>; the peer must be in the realm of its TGT.
+// The ticket is not added to the client's ticket cache. AP_REQs with the ticket need the use-session-key AP option set.
+func (cl *Client) GetUser2UserTicket(peer string, peerTGT messages.Ticket) (messages.Ticket, types.EncryptionKey, error) {
+	return cl.GetUser2UserTicketContext(context.Background(), peer, peerTGT)
+}
+
+// GetUser2UserTicketContext obtains a user-to-user ticket to the peer specified, as GetUser2UserTicket does.
+// The context provided can be used to cancel the request or set a deadline for it.
+func (cl *Client) GetUser2UserTicketContext(ctx context.Context, peer string, peerTGT messages.Ticket) (messages.Ticket, types.EncryptionKey, error) {
+	if len(peerTGT.SName.NameString) < 2 || peerTGT.SName.NameString[0] != "krbtgt" {
+		return messages.Ticket{}, types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "TGS Exchange Error: ticket provided for the peer is not a TGT")
+	}
+	realm := peerTGT.SName.NameString[len(peerTGT.SName.NameString)-1]
+	tgt, skey, err := cl.sessionTGT(ctx, realm)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
+	}
+	tgsReq, err := messages.NewUser2UserTGSReq(cl.Creds().CName(), realm, cl.config(), tgt, skey,
+		types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, peer), false, peerTGT)
+	if err == nil {
+		err = cl.applyKDCOffset(&tgsReq, tgt, skey)
+	}
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "TGS Exchange Error: failed to generate a new user-to-user TGS_REQ")
+	}
+	_, tgsRep, err := cl.TGSExchangeContext(ctx, tgsReq, realm, tgt, skey, 0)
+	if err != nil {
+		return messages.Ticket{}, types.EncryptionKey{}, err
 	}
 	return tgsRep.Ticket, tgsRep.DecryptedEncPart.Key, nil
 }
+
+// onBehalfOfUser indicates if the TGS_REQ is for a ticket on behalf of another user, with S4U2Self or S4U2Proxy.
+func onBehalfOfUser(tgsReq messages.TGSReq) bool {
+	if _, ok, _ := tgsReq.ForUser(); ok {
+		return true
+	}
+	return types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.CNameInAddlTkt)
+}
+
+// applyKDCOffset adjusts the TGS_REQ by the offset of the KDC's clock recorded for the client's credentials.
+func (cl *Client) applyKDCOffset(tgsReq *messages.TGSReq, tgt messages.Ticket, sessionKey types.EncryptionKey) error {
+	d := cl.Creds().KDCOffset()
+	if d == 0 {
+		return nil
+	}
+	return tgsReq.ApplyKDCOffset(d, tgt, sessionKey)
+}
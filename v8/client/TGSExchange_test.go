@@ -0,0 +1,516 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+)
+
+// tgsKDC is a KDC that issues service tickets and forwarded TGTs, including tickets on behalf of users with S4U2Self
+// and S4U2Proxy and user-to-user tickets.
+type tgsKDC struct {
+	kt *keytab.Keytab
+}
+
+func (k *tgsKDC) serve(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b, err := readTCPMessage(c)
+		if err == nil {
+			var tgsReq messages.TGSReq
+			var rb []byte
+			if err = tgsReq.Unmarshal(b); err == nil {
+				rb, err = k.tgs(tgsReq)
+			}
+			if err == nil {
+				c.Write(tcpFrame(rb))
+			}
+		}
+		c.Close()
+	}
+}
+
+func (k *tgsKDC) tgs(tgsReq messages.TGSReq) ([]byte, error) {
+	var apReq messages.APReq
+	for _, pa := range tgsReq.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			if err := apReq.Unmarshal(pa.PADataValue); err != nil {
+				return nil, err
+			}
+		}
+	}
+	krbtgtKey, _, err := k.kt.GetEncryptionKey(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+fastTestRealm), fastTestRealm, 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		return nil, err
+	}
+	if err := apReq.Ticket.Decrypt(krbtgtKey); err != nil {
+		return nil, err
+	}
+	sessionKey := apReq.Ticket.DecryptedEncPart.Key
+	kt := k.kt
+	var cname types.PrincipalName
+	var crealm string
+	tktFlags := types.NewKrbFlags()
+	pfu, forUser, err := tgsReq.ForUser()
+	if err != nil {
+		return nil, err
+	}
+	if types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.Forwarded) {
+		cname, crealm = apReq.Ticket.DecryptedEncPart.CName, apReq.Ticket.DecryptedEncPart.CRealm
+		types.SetFlag(&tktFlags, flags.Forwarded)
+	} else if types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.CNameInAddlTkt) {
+		if !tgsReq.PAData.Contains(patype.PA_PAC_OPTIONS) || len(tgsReq.ReqBody.AdditionalTickets) != 1 {
+			return nil, errors.New("S4U2Proxy request is not valid")
+		}
+		evidence := tgsReq.ReqBody.AdditionalTickets[0]
+		svc := apReq.Ticket.DecryptedEncPart.CName
+		if err := evidence.DecryptEncPart(k.kt, &svc); err != nil {
+			return nil, err
+		}
+		cname, crealm = evidence.DecryptedEncPart.CName, evidence.DecryptedEncPart.CRealm
+	} else if types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.EncTktInSkey) {
+		if len(tgsReq.ReqBody.AdditionalTickets) != 1 {
+			return nil, errors.New("user-to-user request is not valid")
+		}
+		// The ticket is encrypted with the session key of the peer's TGT
+		peerTGT := tgsReq.ReqBody.AdditionalTickets[0]
+		if err := peerTGT.Decrypt(krbtgtKey); err != nil {
+			return nil, err
+		}
+		kt = keytab.New()
+		if err := kt.AddKey(tgsReq.ReqBody.SName.PrincipalNameString(), fastTestRealm, peerTGT.DecryptedEncPart.Key, time.Now(), 1); err != nil {
+			return nil, err
+		}
+		cname, crealm = apReq.Ticket.DecryptedEncPart.CName, apReq.Ticket.DecryptedEncPart.CRealm
+	} else if forUser {
+		if !pfu.Verify(sessionKey) {
+			return nil, errors.New("request does not have a valid PA-FOR-USER")
+		}
+		if !tgsReq.ReqBody.SName.Equal(apReq.Ticket.DecryptedEncPart.CName) {
+			return nil, errors.New("S4U2Self request is not for the requesting service")
+		}
+		cname, crealm = pfu.UserName, pfu.UserRealm
+	} else {
+		cname, crealm = apReq.Ticket.DecryptedEncPart.CName, apReq.Ticket.DecryptedEncPart.CRealm
+	}
+	return testTGSRep(tgsReq, kt, fastTestRealm, cname, crealm, tktFlags, sessionKey)
+}
+
+// testTGSRep returns a TGS_REP with a ticket to the service requested, issued by the realm's KDC to the client
+// specified. The keytab holds the key of the service.
+func testTGSRep(tgsReq messages.TGSReq, kt *keytab.Keytab, realm string, cname types.PrincipalName, crealm string, tktFlags asn1.BitString, sessionKey types.EncryptionKey) ([]byte, error) {
+	now := time.Now().UTC()
+	tkt, skey, err := messages.NewTicket(cname, crealm, tgsReq.ReqBody.SName, realm, tktFlags, kt, etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	dep := messages.EncKDCRepPart{
+		Key:       skey,
+		LastReqs:  []messages.LastReq{},
+		Nonce:     tgsReq.ReqBody.Nonce,
+		Flags:     tktFlags,
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(time.Hour),
+		SRealm:    realm,
+		SName:     tgsReq.ReqBody.SName,
+	}
+	db, err := dep.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	ed, err := crypto.GetEncryptedData(db, sessionKey, keyusage.TGS_REP_ENCPART_SESSION_KEY, 0)
+	if err != nil {
+		return nil, err
+	}
+	r := messages.TGSRep{KDCRepFields: messages.KDCRepFields{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_TGS_REP,
+		CRealm:  crealm,
+		CName:   cname,
+		Ticket:  tkt,
+		EncPart: ed,
+	}}
+	return r.Marshal()
+}
+
+// crossRealmKDC is the KDC of a realm that issues cross-realm TGTs and service tickets to clients of other realms.
+// The keytab holds the keys shared between all the realms.
+type crossRealmKDC struct {
+	realm  string
+	kt     *keytab.Keytab
+	mux    sync.Mutex
+	snames []string
+}
+
+func (k *crossRealmKDC) serve(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b, err := readTCPMessage(c)
+		if err == nil {
+			var tgsReq messages.TGSReq
+			var rb []byte
+			if err = tgsReq.Unmarshal(b); err == nil {
+				rb, err = k.tgs(tgsReq)
+			}
+			if err == nil {
+				c.Write(tcpFrame(rb))
+			}
+		}
+		c.Close()
+	}
+}
+
+func (k *crossRealmKDC) tgs(tgsReq messages.TGSReq) ([]byte, error) {
+	var apReq messages.APReq
+	for _, pa := range tgsReq.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			if err := apReq.Unmarshal(pa.PADataValue); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if apReq.Ticket.SName.PrincipalNameString() != "krbtgt/"+k.realm {
+		return nil, fmt.Errorf("TGT for %s is not for this realm", apReq.Ticket.SName.PrincipalNameString())
+	}
+	// The TGT is encrypted with the key the realm shares with the realm that issued it
+	key, _, err := k.kt.GetEncryptionKey(apReq.Ticket.SName, apReq.Ticket.Realm, 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		return nil, err
+	}
+	if err := apReq.Ticket.Decrypt(key); err != nil {
+		return nil, err
+	}
+	k.mux.Lock()
+	k.snames = append(k.snames, tgsReq.ReqBody.SName.PrincipalNameString())
+	k.mux.Unlock()
+	e := apReq.Ticket.DecryptedEncPart
+	return testTGSRep(tgsReq, k.kt, k.realm, e.CName, e.CRealm, types.NewKrbFlags(), e.Key)
+}
+
+func (k *crossRealmKDC) requests() []string {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	return append([]string{}, k.snames...)
+}
+
+func newTGSTestClient(t *testing.T, spn string) (*Client, *keytab.Keytab) {
+	kt := keytab.New()
+	for _, p := range []string{"krbtgt/" + fastTestRealm, spn, "HTTP/backend.test.gokrb5"} {
+		if err := kt.AddEntry(p, fastTestRealm, "secret-"+p, time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+			t.Fatalf("error adding keytab entry: %v", err)
+		}
+	}
+	kdc := &tgsKDC{kt: kt}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go kdc.serve(l)
+
+	cl := NewWithKeytab(spn, fastTestRealm, kt, testKDCConfig(t, l.Addr().String()))
+	now := time.Now().UTC()
+	tgt, skey, err := messages.NewTicket(cl.Credentials.CName(), fastTestRealm,
+		types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+fastTestRealm), fastTestRealm,
+		types.NewKrbFlags(), kt, etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating service TGT: %v", err)
+	}
+	cl.addSession(tgt, messages.EncKDCRepPart{
+		Key:       skey,
+		Flags:     types.NewKrbFlags(),
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(time.Hour),
+	})
+	return cl, kt
+}
+
+func TestClient_GetServiceTicketForUser(t *testing.T) {
+	t.Parallel()
+	spn := "HTTP/host.test.gokrb5"
+	cl, kt := newTGSTestClient(t, spn)
+	tkt, _, err := cl.GetServiceTicketForUser("jsmith@"+fastTestRealm, spn)
+	if err != nil {
+		t.Fatalf("error getting ticket for user: %v", err)
+	}
+	assert.Equal(t, spn, tkt.SName.PrincipalNameString(), "ticket service not as expected")
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
+	if err := tkt.DecryptEncPart(kt, &sname); err != nil {
+		t.Fatalf("error decrypting ticket: %v", err)
+	}
+	assert.Equal(t, "jsmith", tkt.DecryptedEncPart.CName.PrincipalNameString(), "ticket client not as expected")
+	assert.Equal(t, fastTestRealm, tkt.DecryptedEncPart.CRealm, "ticket client realm not as expected")
+
+	// The ticket is issued to the user so is not cached as the service's own
+	_, _, ok := cl.GetCachedTicket(spn)
+	assert.False(t, ok, "ticket for user should not be cached")
+}
+
+func TestClient_GetServiceTicketForProxy(t *testing.T) {
+	t.Parallel()
+	spn := "HTTP/host.test.gokrb5"
+	cl, kt := newTGSTestClient(t, spn)
+	evidence, _, err := cl.GetServiceTicketForUser("jsmith", spn)
+	if err != nil {
+		t.Fatalf("error getting evidence ticket: %v", err)
+	}
+	backend := "HTTP/backend.test.gokrb5"
+	tkt, _, err := cl.GetServiceTicketForProxy(evidence, backend)
+	if err != nil {
+		t.Fatalf("error getting ticket for proxy: %v", err)
+	}
+	assert.Equal(t, backend, tkt.SName.PrincipalNameString(), "ticket service not as expected")
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, backend)
+	if err := tkt.DecryptEncPart(kt, &sname); err != nil {
+		t.Fatalf("error decrypting ticket: %v", err)
+	}
+	assert.Equal(t, "jsmith", tkt.DecryptedEncPart.CName.PrincipalNameString(), "ticket client not as expected")
+	_, _, ok := cl.GetCachedTicket(backend)
+	assert.False(t, ok, "ticket for user should not be cached")
+}
+
+func TestClient_GetForwardedTGT(t *testing.T) {
+	t.Parallel()
+	spn := "HTTP/host.test.gokrb5"
+	cl, kt := newTGSTestClient(t, spn)
+	tgt, _, _ := cl.sessionTGT(context.Background(), fastTestRealm)
+	tkt, dep, err := cl.GetForwardedTGT()
+	if err != nil {
+		t.Fatalf("error getting forwarded TGT: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&dep.Flags, flags.Forwarded), "forwarded flag not set")
+	assert.Equal(t, "krbtgt/"+fastTestRealm, tkt.SName.PrincipalNameString(), "ticket service not as expected")
+	if err := tkt.DecryptEncPart(kt, nil); err != nil {
+		t.Fatalf("error decrypting ticket: %v", err)
+	}
+	assert.Equal(t, spn, tkt.DecryptedEncPart.CName.PrincipalNameString(), "ticket client not as expected")
+
+	// The client's own TGT is not replaced by the forwarded TGT
+	sessTGT, _, _ := cl.sessionTGT(context.Background(), fastTestRealm)
+	assert.Equal(t, tgt, sessTGT, "session TGT should not be replaced")
+}
+
+func TestClient_GetUser2UserTicket(t *testing.T) {
+	t.Parallel()
+	spn := "HTTP/host.test.gokrb5"
+	cl, _ := newTGSTestClient(t, spn)
+	peerName := "peer/app.test.gokrb5"
+	peer, _ := newTGSTestClient(t, peerName)
+	peerTGT, peerKey, err := peer.GetTGT()
+	if err != nil {
+		t.Fatalf("error getting peer's TGT: %v", err)
+	}
+	tkt, skey, err := cl.GetUser2UserTicket(peerName, peerTGT)
+	if err != nil {
+		t.Fatalf("error getting user-to-user ticket: %v", err)
+	}
+	assert.Equal(t, peerName, tkt.SName.PrincipalNameString(), "ticket service not as expected")
+
+	// The peer decrypts the ticket with the session key of its TGT
+	if err := tkt.Decrypt(peerKey); err != nil {
+		t.Fatalf("error decrypting user-to-user ticket with the TGT session key: %v", err)
+	}
+	assert.Equal(t, spn, tkt.DecryptedEncPart.CName.PrincipalNameString(), "ticket client not as expected")
+	assert.Equal(t, skey, tkt.DecryptedEncPart.Key, "ticket session key not as expected")
+	_, _, ok := cl.GetCachedTicket(peerName)
+	assert.False(t, ok, "user-to-user ticket should not be cached")
+
+	_, _, err = cl.GetUser2UserTicket(peerName, tkt)
+	assert.Error(t, err, "ticket that is not a TGT should not be accepted as the peer's TGT")
+}
+
+func TestNewFromKRBCred(t *testing.T) {
+	t.Parallel()
+	spn := "HTTP/host.test.gokrb5"
+	cl, kt := newTGSTestClient(t, spn)
+	tgt, dep, err := cl.GetForwardedTGT()
+	if err != nil {
+		t.Fatalf("error getting forwarded TGT: %v", err)
+	}
+	cred := messages.KRBCred{
+		Tickets: []messages.Ticket{tgt},
+		DecryptedEncPart: messages.EncKrbCredPart{
+			TicketInfo: []messages.KrbCredInfo{messages.NewKrbCredInfo(fastTestRealm, cl.Credentials.CName(), dep)},
+		},
+	}
+	dcl, err := NewFromKRBCred(cred, cl.Config)
+	if err != nil {
+		t.Fatalf("error creating client from KRB_CRED: %v", err)
+	}
+	defer dcl.Destroy()
+	ok, err := dcl.IsConfigured()
+	assert.True(t, ok, "client from KRB_CRED should be configured: %v", err)
+	assert.Equal(t, spn, dcl.Credentials.CName().PrincipalNameString(), "client principal not as expected")
+
+	backend := "HTTP/backend.test.gokrb5"
+	tkt, _, err := dcl.GetServiceTicket(backend)
+	if err != nil {
+		t.Fatalf("error getting service ticket with delegated TGT: %v", err)
+	}
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, backend)
+	if err := tkt.DecryptEncPart(kt, &sname); err != nil {
+		t.Fatalf("error decrypting ticket: %v", err)
+	}
+	assert.Equal(t, spn, tkt.DecryptedEncPart.CName.PrincipalNameString(), "ticket client not as expected")
+
+	_, err = NewFromKRBCred(messages.KRBCred{}, cl.Config)
+	assert.Error(t, err, "KRB_CRED without tickets should be rejected")
+}
+
+func TestClient_GetServiceTicketCrossRealm(t *testing.T) {
+	t.Parallel()
+	const (
+		clientRealm = "ENG.TEST.GOKRB5"
+		parentRealm = "TEST.GOKRB5"
+		salesRealm  = "SALES.TEST.GOKRB5"
+		otherRealm  = "OTHER.GOKRB5"
+	)
+	kt := keytab.New()
+	for _, e := range [][2]string{
+		{"krbtgt/" + clientRealm, clientRealm},
+		{"krbtgt/" + parentRealm, clientRealm},
+		{"krbtgt/" + salesRealm, parentRealm},
+		{"krbtgt/" + otherRealm, parentRealm},
+		{"HTTP/host.sales.test.gokrb5", salesRealm},
+		{"HTTP/host.other.gokrb5", otherRealm},
+	} {
+		if err := kt.AddEntry(e[0], e[1], "secret-"+e[0]+"@"+e[1], time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+			t.Fatalf("error adding keytab entry: %v", err)
+		}
+	}
+	kdcs := make(map[string]*crossRealmKDC)
+	var realms strings.Builder
+	for _, r := range []string{clientRealm, parentRealm, salesRealm, otherRealm} {
+		kdc := &crossRealmKDC{realm: r, kt: kt}
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("error listening on TCP: %v", err)
+		}
+		defer l.Close()
+		go kdc.serve(l)
+		kdcs[r] = kdc
+		fmt.Fprintf(&realms, " %s = {\n  kdc = %s\n }\n", r, l.Addr().String())
+	}
+	// The path to the sales realm follows the realm hierarchy while that to the other realm is configured
+	c, err := config.NewFromString(fmt.Sprintf(`[libdefaults]
+ default_realm = %s
+ udp_preference_limit = 1
+[realms]
+%s[domain_realm]
+ .sales.test.gokrb5 = %s
+ .other.gokrb5 = %s
+[capaths]
+ %s = {
+  %s = %s
+ }
+`, clientRealm, realms.String(), salesRealm, otherRealm, clientRealm, otherRealm, parentRealm))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+
+	cl := NewWithKeytab("user", clientRealm, kt, c)
+	now := time.Now().UTC()
+	tgt, skey, err := messages.NewTicket(cl.Credentials.CName(), clientRealm,
+		types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+clientRealm), clientRealm,
+		types.NewKrbFlags(), kt, etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating TGT: %v", err)
+	}
+	cl.addSession(tgt, messages.EncKDCRepPart{
+		Key:       skey,
+		Flags:     types.NewKrbFlags(),
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(time.Hour),
+	})
+
+	tkt, _, err := cl.GetServiceTicket("HTTP/host.sales.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting cross-realm service ticket: %v", err)
+	}
+	assert.Equal(t, salesRealm, tkt.Realm, "service ticket realm not as expected")
+	assert.Equal(t, []string{"krbtgt/" + parentRealm}, kdcs[clientRealm].requests(), "requests to the client realm's KDC not as expected")
+	assert.Equal(t, []string{"krbtgt/" + salesRealm}, kdcs[parentRealm].requests(), "requests to the parent realm's KDC not as expected")
+	assert.Equal(t, []string{"HTTP/host.sales.test.gokrb5"}, kdcs[salesRealm].requests(), "requests to the service realm's KDC not as expected")
+
+	// The cross-realm TGT for the parent realm is reused on the configured path
+	tkt, _, err = cl.GetServiceTicket("HTTP/host.other.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting cross-realm service ticket: %v", err)
+	}
+	assert.Equal(t, otherRealm, tkt.Realm, "service ticket realm not as expected")
+	assert.Len(t, kdcs[clientRealm].requests(), 1, "client realm's KDC should not be requested again")
+	assert.Equal(t, []string{"krbtgt/" + salesRealm, "krbtgt/" + otherRealm}, kdcs[parentRealm].requests(), "requests to the parent realm's KDC not as expected")
+	assert.Equal(t, []string{"HTTP/host.other.gokrb5"}, kdcs[otherRealm].requests(), "requests to the other realm's KDC not as expected")
+}
+
+func TestClient_GetServiceTicketForUser_KDCOffset(t *testing.T) {
+	t.Parallel()
+	spn := "HTTP/host.test.gokrb5"
+	cl, kt := newTGSTestClient(t, spn)
+	// The PA-FOR-USER must be kept when the authenticator is regenerated for the KDC's clock
+	cl.updateCreds(func(c *credentials.Credentials) { c.SetKDCOffset(90 * time.Second) })
+	tkt, _, err := cl.GetServiceTicketForUser("jsmith", spn)
+	if err != nil {
+		t.Fatalf("error getting ticket for user: %v", err)
+	}
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, spn)
+	if err := tkt.DecryptEncPart(kt, &sname); err != nil {
+		t.Fatalf("error decrypting ticket: %v", err)
+	}
+	assert.Equal(t, "jsmith", tkt.DecryptedEncPart.CName.PrincipalNameString(), "ticket client not as expected")
+}
+
+func TestClient_GetServiceTicketForProxy_KDCOffset(t *testing.T) {
+	t.Parallel()
+	spn := "HTTP/host.test.gokrb5"
+	cl, kt := newTGSTestClient(t, spn)
+	evidence, _, err := cl.GetServiceTicketForUser("jsmith", spn)
+	if err != nil {
+		t.Fatalf("error getting evidence ticket: %v", err)
+	}
+	// The PA-PAC-OPTIONS must be kept when the authenticator is regenerated for the KDC's clock
+	cl.updateCreds(func(c *credentials.Credentials) { c.SetKDCOffset(-90 * time.Second) })
+	backend := "HTTP/backend.test.gokrb5"
+	tkt, _, err := cl.GetServiceTicketForProxy(evidence, backend)
+	if err != nil {
+		t.Fatalf("error getting ticket for proxy: %v", err)
+	}
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, backend)
+	if err := tkt.DecryptEncPart(kt, &sname); err != nil {
+		t.Fatalf("error decrypting ticket: %v", err)
+	}
+	assert.Equal(t, "jsmith", tkt.DecryptedEncPart.CName.PrincipalNameString(), "ticket client not as expected")
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"sort"
@@ -9,8 +10,13 @@ import (
 
 	"github.com/Osirium/gokrb5/v8/messages"
 	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
 )
 
+// cacheExpiryMargin is the time before a cached ticket expires after which it is no longer used, so that a ticket does
+// not expire between being taken from the cache and being used.
+const cacheExpiryMargin = time.Minute
+
 // Cache for service tickets held by the client.
 type Cache struct {
 	Entries map[string]CacheEntry
@@ -26,6 +32,7 @@ type CacheEntry struct {
 	EndTime    time.Time
 	RenewTill  time.Time
 	SessionKey types.EncryptionKey `json:"-"`
+	Flags      asn1.BitString      `json:"-"`
 }
 
 // NewCache creates a new client ticket cache instance.
@@ -64,7 +71,7 @@ func (c *Cache) JSON() (string, error) {
 }
 
 // addEntry adds a ticket to the cache.
-func (c *Cache) addEntry(tkt messages.Ticket, authTime, startTime, endTime, renewTill time.Time, sessionKey types.EncryptionKey) CacheEntry {
+func (c *Cache) addEntry(tkt messages.Ticket, authTime, startTime, endTime, renewTill time.Time, sessionKey types.EncryptionKey, flags asn1.BitString) CacheEntry {
 	spn := tkt.SName.PrincipalNameString()
 	c.mux.Lock()
 	defer c.mux.Unlock()
@@ -76,15 +83,24 @@ func (c *Cache) addEntry(tkt messages.Ticket, authTime, startTime, endTime, rene
 		EndTime:    endTime,
 		RenewTill:  renewTill,
 		SessionKey: sessionKey,
+		Flags:      flags,
 	}
 	return c.Entries[spn]
 }
 
+// addAlias adds a cache entry for a ticket under another name of its service.
+func (c *Cache) addAlias(spn string, e CacheEntry) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	(*c).Entries[spn] = e
+}
+
 // clear deletes all the cache entries
 func (c *Cache) clear() {
 	c.mux.Lock()
 	defer c.mux.Unlock()
-	for k := range c.Entries {
+	for k, e := range c.Entries {
+		e.SessionKey.Wipe()
 		delete(c.Entries, k)
 	}
 }
@@ -97,31 +113,90 @@ func (c *Cache) RemoveEntry(spn string) {
 }
 
 // GetCachedTicket returns a ticket from the cache for the SPN.
-// Only a ticket that is currently valid will be returned.
+// Only a ticket that is currently valid, will not expire within a minute and has a session key of an encryption type
+// permitted by the client's configuration will be returned. An expired ticket is renewed if it is renewable.
 func (cl *Client) GetCachedTicket(spn string) (messages.Ticket, types.EncryptionKey, bool) {
-	if e, ok := cl.cache.getEntry(spn); ok {
-		//If within time window of ticket return it
-		if time.Now().UTC().After(e.StartTime) && time.Now().UTC().Before(e.EndTime) {
-			cl.Log("ticket received from cache for %s", spn)
-			return e.Ticket, e.SessionKey, true
-		} else if time.Now().UTC().Before(e.RenewTill) {
-			e, err := cl.renewTicket(e)
-			if err != nil {
-				return e.Ticket, e.SessionKey, false
-			}
-			return e.Ticket, e.SessionKey, true
+	return cl.getCachedTicket(context.Background(), spn)
+}
+
+// getCachedTicket returns a ticket from the cache for the SPN, renewing it if required.
+func (cl *Client) getCachedTicket(ctx context.Context, spn string) (messages.Ticket, types.EncryptionKey, bool) {
+	if e, ok := cl.cachedTicket(spn); ok {
+		cl.Log("ticket received from cache for %s", spn)
+		return e.Ticket, e.SessionKey, true
+	}
+	if e, ok := cl.cache.getEntry(spn); ok && cl.etypePolicy().PermitsTGS(e.SessionKey.KeyType) && time.Now().UTC().Before(e.RenewTill) {
+		e, err := cl.renewTicket(ctx, e)
+		if err != nil {
+			return e.Ticket, e.SessionKey, false
 		}
+		return e.Ticket, e.SessionKey, true
 	}
 	var tkt messages.Ticket
 	var key types.EncryptionKey
 	return tkt, key, false
 }
 
+// cachedTicket returns the cache entry for the SPN if it can be used without contacting the KDC.
+func (cl *Client) cachedTicket(spn string) (CacheEntry, bool) {
+	e, ok := cl.cache.getEntry(spn)
+	if !ok || !cl.etypePolicy().PermitsTGS(e.SessionKey.KeyType) {
+		return e, false
+	}
+	now := time.Now().UTC()
+	return e, now.After(e.StartTime) && now.Add(cacheExpiryMargin).Before(e.EndTime)
+}
+
+// ticketFlights deduplicates concurrent requests to the KDC for a service ticket for the same SPN.
+type ticketFlights struct {
+	calls map[string]*ticketFlight
+	mux   sync.Mutex
+}
+
+// ticketFlight is a request for a service ticket that is in progress.
+type ticketFlight struct {
+	done chan struct{}
+	tkt  messages.Ticket
+	key  types.EncryptionKey
+	err  error
+}
+
+// do calls the function provided to obtain the ticket for the SPN unless a call for the SPN is already in progress,
+// in which case it waits for that call to complete and returns its result. A call that is waiting returns early with
+// the context's error if the context is done.
+func (f *ticketFlights) do(ctx context.Context, spn string, get func() (messages.Ticket, types.EncryptionKey, error)) (messages.Ticket, types.EncryptionKey, error) {
+	f.mux.Lock()
+	if f.calls == nil {
+		f.calls = make(map[string]*ticketFlight)
+	}
+	if c, ok := f.calls[spn]; ok {
+		f.mux.Unlock()
+		select {
+		case <-c.done:
+			return c.tkt, c.key, c.err
+		case <-ctx.Done():
+			return messages.Ticket{}, types.EncryptionKey{}, ctx.Err()
+		}
+	}
+	c := &ticketFlight{done: make(chan struct{})}
+	f.calls[spn] = c
+	f.mux.Unlock()
+
+	c.tkt, c.key, c.err = get()
+
+	f.mux.Lock()
+	delete(f.calls, spn)
+	f.mux.Unlock()
+	close(c.done)
+	return c.tkt, c.key, c.err
+}
+
 // renewTicket renews a cache entry ticket.
 // To renew from outside the client package use GetCachedTicket
-func (cl *Client) renewTicket(e CacheEntry) (CacheEntry, error) {
+func (cl *Client) renewTicket(ctx context.Context, e CacheEntry) (CacheEntry, error) {
 	spn := e.Ticket.SName
-	_, _, err := cl.TGSREQGenerateAndExchange(spn, e.Ticket.Realm, e.Ticket, e.SessionKey, true)
+	_, _, err := cl.TGSREQGenerateAndExchangeContext(ctx, spn, e.Ticket.Realm, e.Ticket, e.SessionKey, true)
+	cl.settings.Metrics().Renewal(e.Ticket.Realm, spn.PrincipalNameString(), err)
 	if err != nil {
 		return e, err
 	}
@@ -1,13 +1,21 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
 	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
 	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -29,7 +37,7 @@ func TestCache_addEntry_getEntry_remove_clear(t *testing.T) {
 			KeyValue: []byte{byte(i)},
 		}
 		go func(i int) {
-			e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), key)
+			e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), key, asn1.BitString{})
 			assert.Equal(t, fmt.Sprintf("%d/test.cache", i), e.SPN, "SPN cache key not as expected")
 			wg.Done()
 		}(i)
@@ -112,7 +120,7 @@ func TestCache_JSON(t *testing.T) {
 			KeyType:  1,
 			KeyValue: []byte{byte(i)},
 		}
-		e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), key)
+		e := c.addEntry(tkt, time.Unix(int64(0+i), 0).UTC(), time.Unix(int64(10+i), 0).UTC(), time.Unix(int64(20+i), 0).UTC(), time.Unix(int64(30+i), 0).UTC(), key, asn1.BitString{})
 		assert.Equal(t, fmt.Sprintf("%d/test.cache", i), e.SPN, "SPN cache key not as expected")
 	}
 	expected := `[
@@ -144,3 +152,117 @@ func TestCache_JSON(t *testing.T) {
 	}
 	assert.Equal(t, expected, j, "json output not as expected")
 }
+
+func TestClient_cachedTicket(t *testing.T) {
+	t.Parallel()
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c)
+	now := time.Now().UTC()
+	for i, d := range []time.Duration{time.Hour, 30 * time.Second} {
+		tkt := messages.Ticket{
+			SName: types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, fmt.Sprintf("HTTP/host%d.test.gokrb5", i)),
+		}
+		key := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte{byte(i)}}
+		cl.cache.addEntry(tkt, now, now.Add(-time.Second), now.Add(d), now.Add(d), key, asn1.BitString{})
+	}
+	rc4 := messages.Ticket{
+		SName: types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/rc4.test.gokrb5"),
+	}
+	cl.cache.addEntry(rc4, now, now.Add(-time.Second), now.Add(time.Hour), now.Add(time.Hour), types.EncryptionKey{KeyType: etypeID.RC4_HMAC, KeyValue: []byte{1}}, asn1.BitString{})
+
+	_, ok := cl.cachedTicket("HTTP/host0.test.gokrb5")
+	assert.True(t, ok, "valid ticket not returned from cache")
+	_, ok = cl.cachedTicket("HTTP/host1.test.gokrb5")
+	assert.False(t, ok, "ticket about to expire returned from cache")
+	_, ok = cl.cachedTicket("HTTP/rc4.test.gokrb5")
+	assert.False(t, ok, "ticket with a session key etype that is not permitted returned from cache")
+	_, ok = cl.cachedTicket("HTTP/other.test.gokrb5")
+	assert.False(t, ok, "ticket returned for SPN not in cache")
+}
+
+func TestClient_TicketCacheMetrics(t *testing.T) {
+	t.Parallel()
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	r := new(testRecorder)
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c, Metrics(r))
+	now := time.Now().UTC()
+	tkt := messages.Ticket{
+		SName: types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5"),
+	}
+	key := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: []byte{1}}
+	cl.cache.addEntry(tkt, now, now.Add(-time.Second), now.Add(time.Hour), now.Add(time.Hour), key, asn1.BitString{})
+
+	_, _, err := cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	assert.NoError(t, err, "ticket should be returned from cache")
+	// The context is cancelled so that the KDC is not contacted for the ticket not in the cache
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = cl.GetServiceTicketContext(ctx, "HTTP/other.test.gokrb5")
+	assert.Error(t, err, "ticket not in cache should not be returned with the context cancelled")
+	assert.Equal(t, []bool{true, false}, r.cacheHits, "ticket cache lookups recorded not as expected")
+
+	tkt.Realm = "TEST.GOKRB5"
+	_, err = cl.renewTicket(ctx, CacheEntry{Ticket: tkt, SessionKey: key})
+	assert.Error(t, err, "ticket should not be renewed with the context cancelled")
+	assert.Equal(t, []string{"TEST.GOKRB5 HTTP/host.test.gokrb5 false"}, r.renewals, "renewals recorded not as expected")
+}
+
+func TestTicketFlights_do(t *testing.T) {
+	t.Parallel()
+	var f ticketFlights
+	var calls int32
+	release := make(chan bool)
+	get := func() (messages.Ticket, types.EncryptionKey, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return messages.Ticket{Realm: "TEST.GOKRB5"}, types.EncryptionKey{KeyType: 18}, nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tkt, key, err := f.do(context.Background(), "HTTP/host.test.gokrb5", get)
+			assert.NoError(t, err, "error from deduplicated call")
+			assert.Equal(t, "TEST.GOKRB5", tkt.Realm, "ticket from deduplicated call not as expected")
+			assert.Equal(t, int32(18), key.KeyType, "key from deduplicated call not as expected")
+		}()
+	}
+	// Wait for the first call to start and the others to queue behind it
+	for atomic.LoadInt32(&calls) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls), "concurrent calls for the same SPN not deduplicated")
+
+	// Once complete a new call is made
+	_, _, err := f.do(context.Background(), "HTTP/host.test.gokrb5", func() (messages.Ticket, types.EncryptionKey, error) {
+		atomic.AddInt32(&calls, 1)
+		return messages.Ticket{}, types.EncryptionKey{}, errors.New("KDC error")
+	})
+	assert.Error(t, err, "error not returned")
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls), "call not made after previous call completed")
+}
+
+func TestTicketFlights_do_ContextCancelled(t *testing.T) {
+	t.Parallel()
+	var f ticketFlights
+	release := make(chan bool)
+	started := make(chan bool)
+	go f.do(context.Background(), "HTTP/host.test.gokrb5", func() (messages.Ticket, types.EncryptionKey, error) {
+		close(started)
+		<-release
+		return messages.Ticket{}, types.EncryptionKey{}, nil
+	})
+	<-started
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, _, err := f.do(ctx, "HTTP/host.test.gokrb5", func() (messages.Ticket, types.EncryptionKey, error) {
+		t.Error("second call made while first in progress")
+		return messages.Ticket{}, types.EncryptionKey{}, nil
+	})
+	assert.Equal(t, context.DeadlineExceeded, err, "waiting call did not return when its context was done")
+	close(release)
+}
@@ -0,0 +1,267 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// NewClientFromCCache creates a client that uses and maintains the credential cache provided.
+//
+// The TGT held in the cache is used for TGS exchanges and is renewed automatically before it expires if it is
+// renewable. If a keytab or password is provided with the WithKeytab or WithPassword settings the client will perform
+// a new AS exchange when the TGT cannot be renewed, and the cache need not hold a TGT when the client is created.
+// TGTs and service tickets obtained by the client are written back to the cache.
+func NewClientFromCCache(cc credentials.CredentialCache, krb5conf *config.Config, settings ...func(*Settings)) (*Client, error) {
+	c, err := cc.Load()
+	if err != nil {
+		return nil, fmt.Errorf("could not load credential cache %s: %v", cc.Name(), err)
+	}
+	cl := newFromCCache(c, krb5conf, settings...)
+	cl.ccache = cc
+	if cl.settings.keytab != nil {
+		cl.Credentials.WithKeytab(cl.settings.keytab)
+	} else if cl.settings.password != "" {
+		cl.Credentials.WithPassword(cl.settings.password)
+	}
+	s, err := cl.loadCCacheTGT(c)
+	if err != nil {
+		if !cl.hasLoginCredentials() {
+			return cl, err
+		}
+		cl.Log("%v: a new TGT will be obtained when required", err)
+	} else {
+		cl.enableAutoSessionRenewal(s)
+	}
+	return cl, cl.loadCCacheTickets(c)
+}
+
+// NewClientFromDefaultCCache creates a client as NewClientFromCCache does, for the credential cache and with the
+// configuration that MIT Kerberos tools use by default: the credential cache named by KRB5CCNAME and the configuration
+// files listed in KRB5_CONFIG, falling back to the default file cache for the current user and /etc/krb5.conf.
+func NewClientFromDefaultCCache(settings ...func(*Settings)) (*Client, error) {
+	cfg, err := config.LoadDefault()
+	if err != nil {
+		if _, ok := err.(config.UnsupportedDirective); !ok {
+			return nil, fmt.Errorf("could not load configuration: %v", err)
+		}
+	}
+	cc, err := credentials.ResolveDefaultCCache()
+	if err != nil {
+		return nil, err
+	}
+	return NewClientFromCCache(cc, cfg, settings...)
+}
+
+// newFromCCache returns a client for the default principal of the credential cache.
+func newFromCCache(c *credentials.CCache, krb5conf *config.Config, settings ...func(*Settings)) *Client {
+	return &Client{
+		Credentials: c.GetClientCredentials(),
+		Config:      krb5conf,
+		settings:    NewSettings(settings...),
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		cache: NewCache(),
+	}
+}
+
+// loadCCacheTGT establishes a session for the client's realm from the TGT held in the credential cache.
+func (cl *Client) loadCCacheTGT(c *credentials.CCache) (*session, error) {
+	spn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"krbtgt", c.DefaultPrincipal.Realm},
+	}
+	cred, ok := c.GetEntry(spn)
+	if !ok {
+		return nil, errors.New("TGT not found in CCache")
+	}
+	tgt, err := messages.CCacheTicket(cred)
+	if err != nil {
+		return nil, fmt.Errorf("TGT bytes in cache are not valid: %v", err)
+	}
+	s := &session{
+		realm:      c.DefaultPrincipal.Realm,
+		authTime:   cred.AuthTime,
+		startTime:  cred.StartTime,
+		endTime:    cred.EndTime,
+		renewTill:  cred.RenewTill,
+		flags:      cred.TicketFlags,
+		tgt:        tgt,
+		sessionKey: cred.Key,
+	}
+	cl.sessions.Entries[c.DefaultPrincipal.Realm] = s
+	return s, nil
+}
+
+// loadCCacheTickets adds the tickets held in the credential cache to the client's ticket cache.
+func (cl *Client) loadCCacheTickets(c *credentials.CCache) error {
+	for _, cred := range c.GetEntries() {
+		tkt, err := messages.CCacheTicket(cred)
+		if err != nil {
+			return err
+		}
+		cl.cache.addEntry(
+			tkt,
+			cred.AuthTime,
+			cred.StartTime,
+			cred.EndTime,
+			cred.RenewTill,
+			cred.Key,
+			cred.TicketFlags,
+		)
+	}
+	return nil
+}
+
+// storeCCache writes a ticket obtained by the client back to the credential cache the client was created from.
+// Failure to write to the cache is logged rather than failing the exchange that obtained the ticket.
+func (cl *Client) storeCCache(tkt messages.Ticket, dep messages.EncKDCRepPart) {
+	if cl.ccache == nil {
+		return
+	}
+	cred, err := ccacheCredential(cl.Creds(), tkt, dep)
+	if err == nil {
+		err = cl.ccache.Store(cred)
+	}
+	if err != nil {
+		cl.Log("error storing ticket for %s in credential cache %s: %v", tkt.SName.PrincipalNameString(), cl.ccache.Name(), err)
+	}
+}
+
+// ccacheCredential returns the credential cache entry for a ticket issued to the client credentials provided and the
+// encrypted part of the reply it was issued in.
+func ccacheCredential(creds *credentials.Credentials, tkt messages.Ticket, dep messages.EncKDCRepPart) (*credentials.Credential, error) {
+	b, err := tkt.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	return &credentials.Credential{
+		Client:      credentials.NewPrincipal(creds.CName(), creds.Domain()),
+		Server:      credentials.NewPrincipal(tkt.SName, tkt.Realm),
+		Key:         dep.Key,
+		AuthTime:    dep.AuthTime,
+		StartTime:   dep.StartTime,
+		EndTime:     dep.EndTime,
+		RenewTill:   dep.RenewTill,
+		TicketFlags: dep.Flags,
+		Addresses:   dep.CAddr,
+		Ticket:      b,
+	}, nil
+}
+
+// CCache returns the TGTs and service tickets held by the client as a credential cache for the client's principal.
+// Tickets that have expired are not included.
+func (cl *Client) CCache() (*credentials.CCache, error) {
+	creds := cl.Creds()
+	c := &credentials.CCache{
+		Version:          4,
+		DefaultPrincipal: credentials.NewPrincipal(creds.CName(), creds.Domain()),
+	}
+	if d := creds.KDCOffset(); d != 0 {
+		c.SetKDCOffset(d)
+	}
+	// The TGT for the client's own realm is written first, followed by cross realm TGTs
+	cl.sessions.mux.RLock()
+	realms := make([]string, 0, len(cl.sessions.Entries))
+	for r := range cl.sessions.Entries {
+		realms = append(realms, r)
+	}
+	sort.Slice(realms, func(i, j int) bool {
+		if (realms[i] == creds.Domain()) != (realms[j] == creds.Domain()) {
+			return realms[i] == creds.Domain()
+		}
+		return realms[i] < realms[j]
+	})
+	sessions := make([]*session, 0, len(realms))
+	for _, r := range realms {
+		sessions = append(sessions, cl.sessions.Entries[r])
+	}
+	cl.sessions.mux.RUnlock()
+	for _, s := range sessions {
+		if !s.valid() {
+			continue
+		}
+		s.mux.RLock()
+		tgt := s.tgt
+		dep := messages.EncKDCRepPart{
+			Key:       s.sessionKey,
+			Flags:     s.flags,
+			AuthTime:  s.authTime,
+			StartTime: s.startTime,
+			EndTime:   s.endTime,
+			RenewTill: s.renewTill,
+		}
+		s.mux.RUnlock()
+		cred, err := ccacheCredential(creds, tgt, dep)
+		if err != nil {
+			return nil, fmt.Errorf("error encoding TGT for %s: %v", s.realm, err)
+		}
+		c.AddCredential(cred)
+	}
+	cl.cache.mux.RLock()
+	spns := make([]string, 0, len(cl.cache.Entries))
+	for spn := range cl.cache.Entries {
+		spns = append(spns, spn)
+	}
+	sort.Strings(spns)
+	entries := make([]CacheEntry, 0, len(spns))
+	for _, spn := range spns {
+		entries = append(entries, cl.cache.Entries[spn])
+	}
+	cl.cache.mux.RUnlock()
+	now := time.Now().UTC()
+	for _, e := range entries {
+		if !now.Before(e.EndTime) || c.Contains(e.Ticket.SName) {
+			// Renewed TGTs are also held in the ticket cache so may already have been added
+			continue
+		}
+		cred, err := ccacheCredential(creds, e.Ticket, messages.EncKDCRepPart{
+			Key:       e.SessionKey,
+			Flags:     e.Flags,
+			AuthTime:  e.AuthTime,
+			StartTime: e.StartTime,
+			EndTime:   e.EndTime,
+			RenewTill: e.RenewTill,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error encoding ticket for %s: %v", e.SPN, err)
+		}
+		c.AddCredential(cred)
+	}
+	return c, nil
+}
+
+// ExportCCache writes the TGTs and service tickets held by the client to a credential cache file so that they can
+// be used by other Kerberos implementations, such as curl --negotiate or psql.
+// The file is created with mode 0600 if it does not exist.
+func (cl *Client) ExportCCache(cpath string) error {
+	c, err := cl.CCache()
+	if err != nil {
+		return err
+	}
+	return c.Export(cpath)
+}
+
+// WriteCCache writes the TGTs and service tickets held by the client to the writer provided in the credential cache
+// file format. This can then be read by MIT or Heimdal Kerberos.
+func (cl *Client) WriteCCache(w io.Writer) error {
+	c, err := cl.CCache()
+	if err != nil {
+		return err
+	}
+	b, err := c.Marshal()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
@@ -0,0 +1,152 @@
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewClientFromCCache(t *testing.T) {
+	t.Parallel()
+	cfg, _ := config.NewFromString(testdata.KRB5_CONF)
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	dir, err := ioutil.TempDir("", "ccache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "krb5cc")
+	if err := ioutil.WriteFile(p, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	cc := credentials.NewFileCache(p)
+
+	cl, err := NewClientFromCCache(cc, cfg)
+	if err != nil {
+		t.Fatalf("Error creating client from cache: %v", err)
+	}
+	assert.Equal(t, "testuser1", cl.Credentials.UserName(), "Client username not taken from cache")
+	_, ok := cl.sessions.get("TEST.GOKRB5")
+	assert.True(t, ok, "Session not created from cached TGT")
+	_, ok = cl.cache.getEntry("HTTP/host.test.gokrb5")
+	assert.True(t, ok, "Service ticket not loaded from cache")
+
+	// Tickets obtained by the client are written back to the cache
+	c, err := cc.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cred := c.Credentials[2]
+	tkt, err := messages.CCacheTicket(cred)
+	if err != nil {
+		t.Fatal(err)
+	}
+	endTime := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+	cl.storeCCache(tkt, messages.EncKDCRepPart{
+		Key:       cred.Key,
+		Flags:     cred.TicketFlags,
+		AuthTime:  cred.AuthTime,
+		StartTime: cred.StartTime,
+		EndTime:   endTime,
+		RenewTill: cred.RenewTill,
+	})
+	c, err = cc.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, len(c.Credentials), "Stored ticket should replace the existing entry")
+	stored, ok := c.GetEntry(cred.Server.PrincipalName)
+	assert.True(t, ok, "Stored ticket not found in cache")
+	assert.True(t, endTime.Equal(stored.EndTime), "Stored ticket end time not as expected")
+	assert.Equal(t, cred.Ticket, stored.Ticket, "Stored ticket bytes not as expected")
+
+	// Without a TGT the client can only be created with other credentials
+	if err := cc.Remove(c.Credentials[0].Server.PrincipalName); err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewClientFromCCache(cc, cfg)
+	assert.Error(t, err, "Client should not be created without a TGT or other credentials")
+	kb, _ := hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
+	kt := keytab.New()
+	if err := kt.Unmarshal(kb); err != nil {
+		t.Fatal(err)
+	}
+	cl, err = NewClientFromCCache(cc, cfg, WithKeytab(kt))
+	if err != nil {
+		t.Fatalf("Error creating client with keytab: %v", err)
+	}
+	assert.True(t, cl.Credentials.HasKeytab(), "Keytab not set on client credentials")
+}
+
+func TestClient_ExportCCache(t *testing.T) {
+	t.Parallel()
+	cfg, _ := config.NewFromString(testdata.KRB5_CONF)
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(credentials.CCache)
+	if err := c.Unmarshal(b); err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	// Move the tickets' validity to the present as expired tickets are not exported
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, cred := range c.GetEntries() {
+		cred.AuthTime = now.Add(-time.Hour)
+		cred.StartTime = now.Add(-time.Hour)
+		cred.EndTime = now.Add(time.Hour)
+	}
+	cl, err := NewFromCCache(c, cfg)
+	if err != nil {
+		t.Fatalf("Error creating client from cache: %v", err)
+	}
+	dir, err := ioutil.TempDir("", "ccache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "krb5cc")
+	if err := cl.ExportCCache(p); err != nil {
+		t.Fatalf("Error exporting cache: %v", err)
+	}
+	e, err := credentials.LoadCCache(p)
+	if err != nil {
+		t.Fatalf("Error loading exported cache: %v", err)
+	}
+	assert.True(t, c.DefaultPrincipal.Equal(e.DefaultPrincipal), "Default principal not as expected")
+	d, ok := e.GetKDCOffset()
+	assert.True(t, ok, "KDC offset not exported")
+	assert.Equal(t, 6*time.Second, d, "KDC offset not as expected")
+	assert.Equal(t, 2, len(e.Credentials), "Number of exported credentials not as expected")
+	for i, cred := range c.GetEntries() {
+		assert.True(t, cred.Server.Equal(e.Credentials[i].Server), "Server principal not as expected")
+		assert.Equal(t, cred.Key, e.Credentials[i].Key, "Session key not as expected")
+		assert.Equal(t, cred.Ticket, e.Credentials[i].Ticket, "Ticket not as expected")
+		assert.Equal(t, cred.TicketFlags.Bytes, e.Credentials[i].TicketFlags.Bytes, "Ticket flags not as expected")
+		assert.True(t, cred.EndTime.Equal(e.Credentials[i].EndTime), "End time not as expected")
+	}
+
+	var buf bytes.Buffer
+	if err := cl.WriteCCache(&buf); err != nil {
+		t.Fatalf("Error writing cache: %v", err)
+	}
+	fb, err := ioutil.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, fb, buf.Bytes(), "Written cache not the same as exported cache")
+}
@@ -2,13 +2,14 @@
 package client
 
 import (
-	"encoding/binary"
+	"context"
 	"encoding/json"
-
 	"errors"
 	"fmt"
 	"io"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/Osirium/gokrb5/v8/config"
@@ -21,16 +22,29 @@ import (
 	"github.com/Osirium/gokrb5/v8/krberror"
 	"github.com/Osirium/gokrb5/v8/messages"
 	"github.com/Osirium/gokrb5/v8/types"
-	"github.com/jcmturner/gofork/encoding/asn1"
 )
 
 // Client side configuration and state.
+//
+// A Client is safe for concurrent use by multiple goroutines, such as HTTP handlers sharing one client to get service
+// tickets and set SPNEGO headers. Its sessions and ticket cache are locked internally, and its credentials are
+// replaced rather than modified when the KDC canonicalizes its name or its password or keytab changes, so once the
+// client is in use they should be read with the Creds method rather than from the Credentials field.
 type Client struct {
-	Credentials *credentials.Credentials
-	Config      *config.Config
-	settings    *Settings
-	sessions    *sessions
-	cache       *Cache
+	Credentials     *credentials.Credentials
+	Config          *config.Config
+	credsMux        sync.RWMutex
+	loginMux        sync.Mutex
+	settings        *Settings
+	sessions        *sessions
+	cache           *Cache
+	ccache          credentials.CredentialCache
+	ticketFlights   ticketFlights
+	kdcHealth       kdcHealth
+	autoRenew       int32
+	preAuthRequired int32
+	preAuthETypeID  int32
+	logins          uint32
 }
 
 // NewWithPassword creates a new client from a password credential.
@@ -65,9 +79,26 @@ func NewWithKeytab(username, realm string, kt *keytab.Keytab, krb5conf *config.C
 // NewFromCCache create a client from a populated client cache.
 //
 // WARNING: A client created from CCache does not automatically renew TGTs and a failure will occur after the TGT expires.
+// Use NewClientFromCCache for a client that renews the TGT and keeps the credential cache up to date.
 func NewFromCCache(c *credentials.CCache, krb5conf *config.Config, settings ...func(*Settings)) (*Client, error) {
+	cl := newFromCCache(c, krb5conf, settings...)
+	if _, err := cl.loadCCacheTGT(c); err != nil {
+		return cl, err
+	}
+	return cl, cl.loadCCacheTickets(c)
+}
+
+// NewFromKRBCred creates a client from the credentials transferred in a decrypted KRB_CRED, such as the credentials
+// delegated to a service by its clients. The client acts as the principal the credentials were issued to. A TGT
+// transferred is used for TGS exchanges and renewed automatically if it is renewable, while other tickets are added to
+// the client's ticket cache.
+func NewFromKRBCred(cred messages.KRBCred, krb5conf *config.Config, settings ...func(*Settings)) (*Client, error) {
+	infos := cred.DecryptedEncPart.TicketInfo
+	if len(cred.Tickets) < 1 || len(infos) != len(cred.Tickets) {
+		return nil, errors.New("KRB_CRED does not contain decrypted details of its tickets")
+	}
 	cl := &Client{
-		Credentials: c.GetClientCredentials(),
+		Credentials: credentials.NewFromPrincipalName(infos[0].PName, infos[0].PRealm),
 		Config:      krb5conf,
 		settings:    NewSettings(settings...),
 		sessions: &sessions{
@@ -75,41 +106,22 @@ func NewFromCCache(c *credentials.CCache, krb5conf *config.Config, settings ...f
 		},
 		cache: NewCache(),
 	}
-	spn := types.PrincipalName{
-		NameType:   nametype.KRB_NT_SRV_INST,
-		NameString: []string{"krbtgt", c.DefaultPrincipal.Realm},
-	}
-	cred, ok := c.GetEntry(spn)
-	if !ok {
-		return cl, errors.New("TGT not found in CCache")
-	}
-	var tgt messages.Ticket
-	err := tgt.Unmarshal(cred.Ticket)
-	if err != nil {
-		return cl, fmt.Errorf("TGT bytes in cache are not valid: %v", err)
-	}
-	cl.sessions.Entries[c.DefaultPrincipal.Realm] = &session{
-		realm:      c.DefaultPrincipal.Realm,
-		authTime:   cred.AuthTime,
-		endTime:    cred.EndTime,
-		renewTill:  cred.RenewTill,
-		tgt:        tgt,
-		sessionKey: cred.Key,
-	}
-	for _, cred := range c.GetEntries() {
-		var tkt messages.Ticket
-		err = tkt.Unmarshal(cred.Ticket)
-		if err != nil {
-			return cl, fmt.Errorf("cache entry ticket bytes are not valid: %v", err)
+	for i, tkt := range cred.Tickets {
+		info := infos[i]
+		if len(tkt.SName.NameString) > 0 && strings.ToLower(tkt.SName.NameString[0]) == "krbtgt" {
+			cl.addSession(tkt, messages.EncKDCRepPart{
+				Key:       info.Key,
+				Flags:     info.Flags,
+				AuthTime:  info.AuthTime,
+				StartTime: info.StartTime,
+				EndTime:   info.EndTime,
+				RenewTill: info.RenewTill,
+				SRealm:    info.SRealm,
+				SName:     info.SName,
+			})
+			continue
 		}
-		cl.cache.addEntry(
-			tkt,
-			cred.AuthTime,
-			cred.StartTime,
-			cred.EndTime,
-			cred.RenewTill,
-			cred.Key,
-		)
+		cl.cache.addEntry(tkt, info.AuthTime, info.StartTime, info.EndTime, info.RenewTill, info.Key, info.Flags)
 	}
 	return cl, nil
 }
@@ -120,42 +132,50 @@ func NewFromCCache(c *credentials.CCache, krb5conf *config.Config, settings ...f
 // A KRBError can be passed in the event the KDC returns one of type KDC_ERR_PREAUTH_REQUIRED and is required to derive
 // the key for pre-authentication from the client's password. If a KRBError is not available, pass nil to this argument.
 func (cl *Client) Key(etype etype.EType, kvno int, krberr *messages.KRBError) (types.EncryptionKey, int, error) {
-	if cl.Credentials.HasKeytab() && etype != nil {
-		return cl.Credentials.Keytab().GetEncryptionKey(cl.Credentials.CName(), cl.Credentials.Domain(), kvno, etype.GetETypeID())
-	} else if cl.Credentials.HasPassword() {
+	c := cl.Creds()
+	if c.HasKeytab() && etype != nil {
+		return c.Keytab().GetEncryptionKey(c.CName(), c.Domain(), kvno, etype.GetETypeID())
+	} else if c.HasPassword() {
 		if krberr != nil && krberr.ErrorCode == errorcode.KDC_ERR_PREAUTH_REQUIRED {
-			var pas types.PADataSequence
-			err := pas.Unmarshal(krberr.EData)
+			h, err := krberr.PreAuthHints()
 			if err != nil {
 				return types.EncryptionKey{}, 0, fmt.Errorf("could not get PAData from KRBError to generate key from password: %v", err)
 			}
-			key, _, err := crypto.GetKeyFromPassword(cl.Credentials.Password(), krberr.CName, krberr.CRealm, etype.GetETypeID(), pas)
+			key, _, err := crypto.GetKeyFromPassword(c.Password(), krberr.CName, krberr.CRealm, etype.GetETypeID(), h.MethodData)
 			return key, 0, err
 		}
-		key, _, err := crypto.GetKeyFromPassword(cl.Credentials.Password(), cl.Credentials.CName(), cl.Credentials.Domain(), etype.GetETypeID(), types.PADataSequence{})
+		key, _, err := crypto.GetKeyFromPassword(c.Password(), c.CName(), c.Domain(), etype.GetETypeID(), types.PADataSequence{})
 		return key, 0, err
 	}
 	return types.EncryptionKey{}, 0, errors.New("credential has neither keytab or password to generate key")
 }
 
+// hasLoginCredentials indicates if the client has credentials to obtain a TGT with: a password, keytab, certificate or
+// one-time password prompter.
+func (cl *Client) hasLoginCredentials() bool {
+	c := cl.Creds()
+	return c.HasPassword() || c.HasKeytab() || cl.pkinitEnabled() || cl.otpEnabled()
+}
+
 // IsConfigured indicates if the client has the values required set.
 func (cl *Client) IsConfigured() (bool, error) {
-	if cl.Credentials.UserName() == "" {
+	creds := cl.Creds()
+	if creds.UserName() == "" {
 		return false, errors.New("client does not have a username")
 	}
-	if cl.Credentials.Domain() == "" {
+	if creds.Domain() == "" {
 		return false, errors.New("client does not have a define realm")
 	}
-	// Client needs to have either a password, keytab or a session already (later when loading from CCache)
-	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeytab() {
-		authTime, _, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
+	// Client needs to have either a password, keytab, certificate, OTP prompter or a session already (later when loading from CCache)
+	if !cl.hasLoginCredentials() {
+		authTime, _, _, _, err := cl.sessionTimes(creds.Domain())
 		if err != nil || authTime.IsZero() {
 			return false, errors.New("client has neither a keytab nor a password set and no session")
 		}
 	}
-	if !cl.Config.LibDefaults.DNSLookupKDC {
-		for _, r := range cl.Config.Realms {
-			if r.Realm == cl.Credentials.Domain() {
+	if c := cl.config(); !c.LibDefaults.DNSLookupKDC {
+		for _, r := range c.Realms {
+			if r.Realm == creds.Domain() {
 				if len(r.KDC) > 0 {
 					return true, nil
 				}
@@ -168,11 +188,18 @@ func (cl *Client) IsConfigured() (bool, error) {
 
 // Login the client with the KDC via an AS exchange.
 func (cl *Client) Login() error {
+	return cl.LoginContext(context.Background())
+}
+
+// LoginContext obtains a TGT for the client, as Login does.
+// The context provided can be used to cancel the login or set a deadline for it.
+func (cl *Client) LoginContext(ctx context.Context) error {
 	if ok, err := cl.IsConfigured(); !ok {
 		return err
 	}
-	if !cl.Credentials.HasPassword() && !cl.Credentials.HasKeytab() {
-		_, endTime, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
+	c := cl.Creds()
+	if !cl.hasLoginCredentials() {
+		_, endTime, _, _, err := cl.sessionTimes(c.Domain())
 		if err != nil {
 			return krberror.Errorf(err, krberror.KRBMsgError, "no user credentials available and error getting any existing session")
 		}
@@ -182,21 +209,45 @@ func (cl *Client) Login() error {
 		// no credentials but there is a session with tgt already
 		return nil
 	}
-	ASReq, err := messages.NewASReqForTGT(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
+	ASReq, err := messages.NewASReqForTGT(c.Domain(), cl.config(), c.CName())
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "error generating new AS_REQ")
 	}
-	ASRep, err := cl.ASExchange(cl.Credentials.Domain(), ASReq, 0)
+	ASRep, err := cl.ASExchangeContext(ctx, c.Domain(), ASReq, 0)
 	if err != nil {
 		return err
 	}
+	if !cl.settings.anonymous && (!ASRep.CName.Equal(c.CName()) || ASRep.CRealm != c.Domain()) {
+		// The KDC has canonicalized the client's name or referred the client to its realm
+		cl.Log("client principal canonicalized from %s@%s to %s@%s", c.CName().PrincipalNameString(), c.Domain(), ASRep.CName.PrincipalNameString(), ASRep.CRealm)
+		cl.updateCreds(func(c *credentials.Credentials) {
+			c.SetCName(ASRep.CName)
+			c.SetDomain(ASRep.CRealm)
+		})
+	}
 	cl.addSession(ASRep.Ticket, ASRep.DecryptedEncPart)
+	atomic.AddUint32(&cl.logins, 1)
 	return nil
 }
 
+// login obtains a TGT for the client, as LoginContext does, serialized with other logins of the client. If another
+// login succeeds while waiting for it to complete its TGT is used rather than performing another AS exchange.
+func (cl *Client) login(ctx context.Context) error {
+	n := atomic.LoadUint32(&cl.logins)
+	cl.loginMux.Lock()
+	defer cl.loginMux.Unlock()
+	if atomic.LoadUint32(&cl.logins) != n {
+		return nil
+	}
+	return cl.LoginContext(ctx)
+}
+
 // AffirmLogin will only perform an AS exchange with the KDC if the client does not already have a TGT.
+// Concurrent calls wait for the first to log in rather than each performing an AS exchange.
 func (cl *Client) AffirmLogin() error {
-	_, endTime, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
+	cl.loginMux.Lock()
+	defer cl.loginMux.Unlock()
+	_, endTime, _, _, err := cl.sessionTimes(cl.Creds().Domain())
 	if err != nil || time.Now().UTC().After(endTime) {
 		err := cl.Login()
 		if err != nil {
@@ -207,57 +258,180 @@ func (cl *Client) AffirmLogin() error {
 }
 
 // realmLogin obtains or renews a TGT and establishes a session for the realm specified.
-func (cl *Client) realmLogin(realm string) error {
-	if realm == cl.Credentials.Domain() {
-		return cl.Login()
-	}
-	_, endTime, _, _, err := cl.sessionTimes(cl.Credentials.Domain())
+// For a realm other than the client's the cross-realm TGTs for each realm on the path to it, from the [capaths]
+// configuration or the realm hierarchy, are obtained in turn. Valid TGTs already held for intermediate realms are used
+// and those obtained are kept as sessions for use in later traversals.
+func (cl *Client) realmLogin(ctx context.Context, realm string) error {
+	crealm := cl.Creds().Domain()
+	if realm == crealm {
+		return cl.login(ctx)
+	}
+	_, endTime, _, _, err := cl.sessionTimes(crealm)
 	if err != nil || time.Now().UTC().After(endTime) {
-		err := cl.Login()
+		err := cl.login(ctx)
 		if err != nil {
 			return fmt.Errorf("could not get valid TGT for client's realm: %v", err)
 		}
 	}
-	tgt, skey, err := cl.sessionTGT(cl.Credentials.Domain())
+	// The login may have canonicalized the client's realm
+	kdcRealm := cl.Creds().Domain()
+	tgt, skey, err := cl.sessionTGT(ctx, kdcRealm)
 	if err != nil {
 		return err
 	}
 
-	spn := types.PrincipalName{
-		NameType:   nametype.KRB_NT_SRV_INST,
-		NameString: []string{"krbtgt", realm},
+	for _, r := range cl.config().RealmPath(kdcRealm, realm) {
+		if s, ok := cl.sessions.get(r); ok && r != realm && s.valid() {
+			_, tgt, skey = s.tgtDetails()
+			kdcRealm = r
+			continue
+		}
+		spn := types.PrincipalName{
+			NameType:   nametype.KRB_NT_SRV_INST,
+			NameString: []string{"krbtgt", r},
+		}
+		_, tgsRep, err := cl.TGSREQGenerateAndExchangeContext(ctx, spn, kdcRealm, tgt, skey, false)
+		if err != nil {
+			return krberror.Errorf(err, krberror.KRBMsgError, "could not get cross-realm TGT for %s from %s", r, kdcRealm)
+		}
+		cl.addSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
+		tgt, skey = tgsRep.Ticket, tgsRep.DecryptedEncPart.Key
+		kdcRealm = r
 	}
+	return nil
+}
 
-	_, tgsRep, err := cl.TGSREQGenerateAndExchange(spn, cl.Credentials.Domain(), tgt, skey, false)
-	if err != nil {
-		return err
+// Clone returns a client for the same principal as the client, sharing its configuration, settings and keytab but
+// with none of its sessions, cached tickets or credential cache, so that it logs in and obtains tickets independently.
+// It is cheaper than creating a client as no configuration or keytab is loaded. The settings provided are applied to
+// a copy of the client's settings, and the WithKeytab and WithPassword settings replace the keytab or password of the
+// clone's credentials. A clone of a client created from a credential cache needs a keytab or password to log in.
+func (cl *Client) Clone(settings ...func(*Settings)) *Client {
+	return cl.clone(cl.Creds().Copy(), settings)
+}
+
+// CloneAs returns a clone of the client, as Clone does, for another principal. The clone uses the client's keytab or
+// password unless the WithKeytab or WithPassword settings are provided, so a template client with a keytab holding
+// the keys of many principals can be cloned for each of them.
+// Set the realm to empty string to use the client's realm.
+func (cl *Client) CloneAs(username, realm string, settings ...func(*Settings)) *Client {
+	c := cl.Creds()
+	if realm == "" {
+		realm = c.Domain()
+	}
+	creds := credentials.New(username, realm)
+	creds.SetKDCOffset(c.KDCOffset())
+	if c.HasKeytab() {
+		creds.WithKeytab(c.Keytab())
+	} else if c.HasPassword() {
+		creds.WithPassword(c.Password())
 	}
-	cl.addSession(tgsRep.Ticket, tgsRep.DecryptedEncPart)
+	return cl.clone(creds, settings)
+}
 
-	return nil
+// clone returns a client with the credentials provided and a copy of the client's settings modified by those provided.
+func (cl *Client) clone(creds *credentials.Credentials, settings []func(*Settings)) *Client {
+	s := *cl.settings
+	for _, set := range settings {
+		set(&s)
+	}
+	if s.keytab != cl.settings.keytab {
+		creds.WithKeytab(s.keytab)
+	} else if s.password != cl.settings.password {
+		creds.WithPassword(s.password)
+	}
+	return &Client{
+		Credentials: creds,
+		Config:      cl.Config,
+		settings:    &s,
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		cache: NewCache(),
+	}
 }
 
-// Destroy stops the auto-renewal of all sessions and removes the sessions and cache entries from the client.
+// Destroy stops the auto-renewal of all sessions and removes the sessions and cache entries from the client, first
+// overwriting their session keys, including those of the service tickets it has returned. The client's keytab is not
+// overwritten as it may be shared with other clients or services; call its Zeroize method once it is no longer used.
+// As the session keys are overwritten, the client should only be destroyed once no other goroutine is using it.
 func (cl *Client) Destroy() {
 	creds := credentials.New("", "")
 	cl.sessions.destroy()
 	cl.cache.clear()
+	cl.credsMux.Lock()
 	cl.Credentials = creds
+	cl.credsMux.Unlock()
 	cl.Log("client destroyed")
 }
 
+// Creds returns the client's credentials. The credentials returned must not be modified as they may be in use by
+// other goroutines; the client replaces them with a modified copy when its name is canonicalized or its password or
+// keytab changes.
+func (cl *Client) Creds() *credentials.Credentials {
+	cl.credsMux.RLock()
+	defer cl.credsMux.RUnlock()
+	return cl.Credentials
+}
+
+// assumePreAuthentication indicates if the client pre-authenticates its first AS_REQ, as it is configured to or as a
+// KDC has required it to before.
+func (cl *Client) assumePreAuthentication() bool {
+	return cl.settings.AssumePreAuthentication() || atomic.LoadInt32(&cl.preAuthRequired) == 1
+}
+
+// updateCreds replaces the client's credentials with a copy modified by the function provided.
+func (cl *Client) updateCreds(f func(c *credentials.Credentials)) {
+	cl.credsMux.Lock()
+	defer cl.credsMux.Unlock()
+	c := cl.Credentials.Copy()
+	f(c)
+	cl.Credentials = c
+}
+
+// DelegateCredentials indicates if the client is configured to delegate its credentials to the services it
+// authenticates to with GSS-API.
+func (cl *Client) DelegateCredentials() bool {
+	return cl.settings.DelegateCredentials()
+}
+
+// MutualAuthentication indicates if the client is configured to require mutual authentication by the services it
+// authenticates to with SPNEGO.
+func (cl *Client) MutualAuthentication() bool {
+	return cl.settings.MutualAuthentication()
+}
+
+// config returns the client's configuration, from its configuration provider if it has one.
+func (cl *Client) config() *config.Config {
+	if p := cl.settings.ConfigProvider(); p != nil {
+		return p.Config()
+	}
+	return cl.Config
+}
+
+// etypePolicy returns the encryption type policy of the client's configuration, or the default policy if the client
+// has no configuration.
+func (cl *Client) etypePolicy() config.ETypePolicy {
+	c := cl.config()
+	if c == nil {
+		return config.DefaultETypePolicy()
+	}
+	return c.LibDefaults.ETypePolicy()
+}
+
 // Diagnostics runs a set of checks that the client is properly configured and writes details to the io.Writer provided.
 func (cl *Client) Diagnostics(w io.Writer) error {
 	cl.Print(w)
 	var errs []string
-	if cl.Credentials.HasKeytab() {
+	creds := cl.Creds()
+	if creds.HasKeytab() {
 		var loginRealmEncTypes []int32
-		for _, e := range cl.Credentials.Keytab().Entries {
-			if e.Principal.Realm == cl.Credentials.Realm() {
+		for _, e := range creds.Keytab().Entries {
+			if e.Principal.Realm == creds.Realm() {
 				loginRealmEncTypes = append(loginRealmEncTypes, e.Key.KeyType)
 			}
 		}
-		for _, et := range cl.Config.LibDefaults.DefaultTktEnctypeIDs {
+		for _, et := range cl.config().LibDefaults.DefaultTktEnctypeIDs {
 			var etInKt bool
 			for _, val := range loginRealmEncTypes {
 				if val == et {
@@ -269,7 +443,7 @@ func (cl *Client) Diagnostics(w io.Writer) error {
 				errs = append(errs, fmt.Sprintf("default_tkt_enctypes specifies %d but this enctype is not available in the client's keytab", et))
 			}
 		}
-		for _, et := range cl.Config.LibDefaults.PreferredPreauthTypes {
+		for _, et := range cl.config().LibDefaults.PreferredPreauthTypes {
 			var etInKt bool
 			for _, val := range loginRealmEncTypes {
 				if int(val) == et {
@@ -282,7 +456,7 @@ func (cl *Client) Diagnostics(w io.Writer) error {
 			}
 		}
 	}
-	udpCnt, udpKDC, err := cl.Config.GetKDCs(cl.Credentials.Realm(), false)
+	udpCnt, udpKDC, err := cl.config().GetKDCs(creds.Realm(), false)
 	if err != nil {
 		errs = append(errs, fmt.Sprintf("error when resolving KDCs for UDP communication: %v", err))
 	}
@@ -292,7 +466,7 @@ func (cl *Client) Diagnostics(w io.Writer) error {
 		b, _ := json.MarshalIndent(&udpKDC, "", "  ")
 		fmt.Fprintf(w, "UDP KDCs: %s\n", string(b))
 	}
-	tcpCnt, tcpKDC, err := cl.Config.GetKDCs(cl.Credentials.Realm(), false)
+	tcpCnt, tcpKDC, err := cl.config().GetKDCs(creds.Realm(), false)
 	if err != nil {
 		errs = append(errs, fmt.Sprintf("error when resolving KDCs for TCP communication: %v", err))
 	}
@@ -312,7 +486,8 @@ func (cl *Client) Diagnostics(w io.Writer) error {
 
 // Print writes the details of the client to the io.Writer provided.
 func (cl *Client) Print(w io.Writer) {
-	c, _ := cl.Credentials.JSON()
+	creds := cl.Creds()
+	c, _ := creds.JSON()
 	fmt.Fprintf(w, "Credentials:\n%s\n", c)
 
 	s, _ := cl.sessions.JSON()
@@ -324,94 +499,9 @@ func (cl *Client) Print(w io.Writer) {
 	s, _ = cl.settings.JSON()
 	fmt.Fprintf(w, "Settings:\n%s\n", s)
 
-	j, _ := cl.Config.JSON()
+	j, _ := cl.config().JSON()
 	fmt.Fprintf(w, "Krb5 config:\n%s\n", j)
 
-	k, _ := cl.Credentials.Keytab().JSON()
+	k, _ := creds.Keytab().JSON()
 	fmt.Fprintf(w, "Keytab:\n%s\n", k)
 }
-
-func appendU16(d []byte, v uint16) []byte {
-	return append(d, byte(v>>8), byte(v))
-}
-
-func appendU32(d []byte, v uint32) []byte {
-	return append(d, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
-}
-
-// appendPrincipal append a principal and realm to d in the credential cache
-// format. Keytab uses a different format with 2 byte lengths.
-func appendPrincipal(d []byte, princ types.PrincipalName, realm string) []byte {
-	d = appendU32(d, uint32(princ.NameType))
-	d = appendU32(d, uint32(len(princ.NameString)))
-	d = appendU32(d, uint32(len(realm)))
-	d = append(d, realm...)
-	for _, p := range princ.NameString {
-		d = appendU32(d, uint32(len(p)))
-		d = append(d, p...)
-	}
-	return d
-}
-
-func bitStringToFlags(s asn1.BitString) int {
-	y := [4]byte{}
-	for i, b := range s.Bytes {
-		y[i] = b
-	}
-	return int(binary.BigEndian.Uint32(y[:]))
-}
-
-// WriteCCache writes the credential and cached tickets out to a file as a
-// credential cache. This can then be read in by MIT or heimdal kerberos.
-func (cl *Client) WriteCCache(file io.Writer) error {
-	d := make([]byte, 0)
-
-	d = appendU16(d, 0x504) // This should set the credential cache to use kerberos v5 and credential cache version 4
-	d = appendU16(d, 0)     // headerlen
-	d = appendPrincipal(d, cl.Credentials.CName(), cl.Credentials.Realm())
-
-	if _, err := file.Write(d); err != nil {
-		return err
-	}
-
-	for _, session := range cl.sessions.Entries {
-		if !session.valid() {
-			continue
-		}
-
-		realm, tgt, sessionKey := session.tgtDetails()
-		d = d[:0]
-
-		d = appendPrincipal(d, cl.Credentials.CName(), cl.Credentials.Realm())
-		d = appendPrincipal(d, tgt.SName, realm)
-
-		// According to this: https://web.mit.edu/kerberos/krb5-latest/doc/formats/ccache_file_format.html#credential-format
-		// The keyblock section should just be the EncType and key data.
-		d = appendU16(d, uint16(tgt.EncPart.EType))
-		d = appendU32(d, uint32(len(sessionKey.KeyValue)))
-		d = append(d, sessionKey.KeyValue...)
-
-		d = appendU32(d, uint32(session.authTime.Unix()))
-		d = appendU32(d, uint32(session.startTime.Unix()))
-		d = appendU32(d, uint32(session.endTime.Unix()))
-		d = appendU32(d, uint32(session.renewTill.Unix()))
-
-		ticketBytes, err := session.tgt.Marshal()
-		if err != nil {
-			return err
-		}
-		d = append(d, 0) // is_skey
-		d = appendU32(d, uint32(bitStringToFlags(session.flags)))
-		d = appendU32(d, 0) // num_address
-		d = appendU32(d, 0) // num_authdata
-		d = appendU32(d, uint32(len(ticketBytes)))
-		d = append(d, ticketBytes...)
-		d = appendU32(d, 0) // second ticket
-
-		if _, err := file.Write(d); err != nil {
-			return err
-		}
-	}
-
-	return nil
-}
@@ -124,6 +124,8 @@ func TestClient_ASExchange_TGSExchange_EncTypes_Keytab(t *testing.T) {
 		c.LibDefaults.DefaultTktEnctypeIDs = []int32{etypeID.ETypesByName[tst]}
 		c.LibDefaults.DefaultTGSEnctypes = []string{tst}
 		c.LibDefaults.DefaultTGSEnctypeIDs = []int32{etypeID.ETypesByName[tst]}
+		c.LibDefaults.PermittedEnctypeIDs = []int32{etypeID.ETypesByName[tst]}
+		c.LibDefaults.AllowWeakCrypto = tst == "rc4-hmac"
 		cl := client.NewWithKeytab("testuser1", "TEST.GOKRB5", kt, c)
 
 		err := cl.Login()
@@ -161,6 +163,8 @@ func TestClient_ASExchange_TGSExchange_EncTypes_Password(t *testing.T) {
 		c.LibDefaults.DefaultTktEnctypeIDs = []int32{etypeID.ETypesByName[tst]}
 		c.LibDefaults.DefaultTGSEnctypes = []string{tst}
 		c.LibDefaults.DefaultTGSEnctypeIDs = []int32{etypeID.ETypesByName[tst]}
+		c.LibDefaults.PermittedEnctypeIDs = []int32{etypeID.ETypesByName[tst]}
+		c.LibDefaults.AllowWeakCrypto = tst == "rc4-hmac"
 		cl := client.NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", c)
 
 		err := cl.Login()
@@ -737,6 +741,40 @@ func TestClient_ChangePasswd(t *testing.T) {
 	}
 }
 
+func TestClient_ChangePassword(t *testing.T) {
+	test.Integration(t)
+
+	b, _ := hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	addr := os.Getenv("TEST_KDC_ADDR")
+	if addr == "" {
+		addr = testdata.KDC_IP_TEST_GOKRB5
+	}
+	c.Realms[0].KDC = []string{addr + ":" + testdata.KDC_PORT_TEST_GOKRB5}
+	c.Realms[0].KPasswdServer = []string{addr + ":464"}
+	cl := client.NewWithKeytab("testuser1", "TEST.GOKRB5", kt, c)
+
+	err := cl.ChangePassword(testdata.TESTUSER_PASSWORD, "newpassword")
+	if err != nil {
+		t.Fatalf("error changing password: %v", err)
+	}
+	err = cl.ChangePassword("wrongpassword", testdata.TESTUSER_PASSWORD)
+	assert.Error(t, err, "error expected changing password with the wrong old password")
+
+	err = cl.ChangePassword("newpassword", testdata.TESTUSER_PASSWORD)
+	if err != nil {
+		t.Fatalf("error changing password back: %v", err)
+	}
+
+	cl = client.NewWithPassword("testuser1", "TEST.GOKRB5", testdata.TESTUSER_PASSWORD, c)
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("Could not log back in after reverting password: %v", err)
+	}
+}
+
 func TestClient_Destroy(t *testing.T) {
 	test.Integration(t)
 
@@ -1,10 +1,25 @@
 package client
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
 	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestAssumePreauthentication(t *testing.T) {
@@ -18,3 +33,193 @@ func TestAssumePreauthentication(t *testing.T) {
 		t.Fatal("AssumePreAuthentication() should be true")
 	}
 }
+
+func TestConfigProvider(t *testing.T) {
+	t.Parallel()
+	c, _ := config.NewFromString("[libdefaults]\n default_realm = TEST.GOKRB5\n[realms]\n TEST.GOKRB5 = {\n }\n")
+	store := config.NewStore(c)
+	cl := NewWithPassword("username", "TEST.GOKRB5", "password", config.New(), ConfigProvider(store))
+	ok, _ := cl.IsConfigured()
+	assert.False(t, ok, "client should not be configured without KDCs")
+
+	c, _ = config.NewFromString("[libdefaults]\n default_realm = TEST.GOKRB5\n[realms]\n TEST.GOKRB5 = {\n  kdc = 127.0.0.1:88\n }\n")
+	store.Set(c)
+	ok, err := cl.IsConfigured()
+	assert.True(t, ok, "client should be configured with the KDCs of the provided config: %v", err)
+	assert.Equal(t, store, cl.settings.ConfigProvider(), "config provider not as expected")
+}
+
+func TestNewTraceLogger(t *testing.T) {
+	t.Parallel()
+	assert.Nil(t, newTraceLogger(""), "no logger should be returned without a trace file")
+	f, err := ioutil.TempFile("", "krb5trace")
+	if err != nil {
+		t.Fatalf("error creating trace file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.Close()
+	l := newTraceLogger(f.Name())
+	if l == nil {
+		t.Fatal("logger for the trace file not returned")
+	}
+	cl := NewWithPassword("username", "REALM", "password", &config.Config{}, Logger(l))
+	cl.Log("trace %s", "message")
+	b, _ := ioutil.ReadFile(f.Name())
+	assert.True(t, bytes.Contains(b, []byte("trace message")), "trace file content not as expected: %s", b)
+}
+
+func TestClient_DestroyWipesKeys(t *testing.T) {
+	t.Parallel()
+	cl := NewWithPassword("username", "TEST.GOKRB5", "password", config.New())
+	sessionKey := []byte{1, 2, 3, 4}
+	cl.sessions.update(&session{realm: "TEST.GOKRB5", sessionKey: types.EncryptionKey{KeyType: 18, KeyValue: sessionKey}, cancel: make(chan bool, 1)})
+	cl.cache.addEntry(messages.Ticket{}, time.Now(), time.Now(), time.Now().Add(time.Hour), time.Now().Add(time.Hour), types.EncryptionKey{KeyType: 18, KeyValue: []byte{5, 6, 7, 8}}, asn1.BitString{})
+	_, cachedKey, ok := cl.GetCachedTicket("")
+	if !ok {
+		t.Fatal("cache entry not found")
+	}
+	cl.Destroy()
+	assert.Equal(t, []byte{0, 0, 0, 0}, sessionKey, "session key should be overwritten")
+	assert.Equal(t, []byte{0, 0, 0, 0}, cachedKey.KeyValue, "session key of the service ticket returned should be overwritten")
+	assert.Empty(t, cl.sessions.Entries, "sessions should be removed")
+	assert.Empty(t, cl.cache.Entries, "cache entries should be removed")
+}
+
+// TestClient_Concurrent uses a client from many goroutines as HTTP handlers sharing one would. Run with the race
+// detector to check the client's state is locked.
+func TestClient_Concurrent(t *testing.T) {
+	t.Parallel()
+	kdc := newFASTKDC(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	defer l.Close()
+	go kdc.serve(l)
+
+	cl := fastTestClients(t, kdc, l.Addr().String(), "passwd")
+	spn := "HTTP/host.test.gokrb5"
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := cl.AffirmLogin(); err != nil {
+				t.Errorf("error logging in: %v", err)
+				return
+			}
+			if _, _, err := cl.GetServiceTicket(spn); err != nil {
+				t.Errorf("error getting service ticket: %v", err)
+			}
+			cl.GetCachedTicket(spn)
+			cl.sessionTimes(fastTestRealm)
+			if i%5 == 0 {
+				// As a keytab rotation or password change would
+				cl.updateCreds(func(c *credentials.Credentials) {
+					c.WithPassword("passwd")
+				})
+			}
+			assert.Equal(t, "user", cl.Creds().CName().PrincipalNameString(), "client name not as expected")
+		}(i)
+	}
+	wg.Wait()
+	asReqs, tgsReqs := kdc.requests()
+	assert.Equal(t, 2, asReqs, "the client should log in once, with an AS_REQ without and then with pre-authentication")
+	assert.Equal(t, 1, tgsReqs, "the client should get the service ticket once")
+}
+
+// TestClient_ConcurrentLogin gets tickets for different services from many goroutines without logging in first, so
+// that each needs a TGT. Run with the race detector to check the logins are serialized.
+func TestClient_ConcurrentLogin(t *testing.T) {
+	t.Parallel()
+	kdc := newFASTKDC(t)
+	var spns []string
+	for i := 0; i < 10; i++ {
+		spn := fmt.Sprintf("HTTP/host%d.test.gokrb5", i)
+		if err := kdc.kt.AddEntry(spn, fastTestRealm, "secret-"+spn, time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+			t.Fatalf("error adding keytab entry: %v", err)
+		}
+		spns = append(spns, spn)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	defer l.Close()
+	go kdc.serve(l)
+
+	cl := fastTestClients(t, kdc, l.Addr().String(), "passwd")
+	var wg sync.WaitGroup
+	for _, spn := range spns {
+		wg.Add(1)
+		go func(spn string) {
+			defer wg.Done()
+			tkt, _, err := cl.GetServiceTicket(spn)
+			if err != nil {
+				t.Errorf("error getting service ticket for %s: %v", spn, err)
+				return
+			}
+			assert.Equal(t, spn, tkt.SName.PrincipalNameString(), "service ticket not as expected")
+		}(spn)
+	}
+	wg.Wait()
+	asReqs, tgsReqs := kdc.requests()
+	assert.Equal(t, 2, asReqs, "the client should log in once, with an AS_REQ without and then with pre-authentication")
+	assert.Equal(t, len(spns), tgsReqs, "the client should get each service ticket once")
+	assert.Equal(t, int32(etypeID.AES256_CTS_HMAC_SHA1_96), atomic.LoadInt32(&cl.preAuthETypeID), "negotiated pre-authentication etype not as expected")
+}
+
+func TestClient_Clone(t *testing.T) {
+	t.Parallel()
+	kdc := newFASTKDC(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	defer l.Close()
+	go kdc.serve(l)
+
+	cl := fastTestClients(t, kdc, l.Addr().String(), "passwd")
+	spn := "HTTP/host.test.gokrb5"
+	if _, _, err := cl.GetServiceTicket(spn); err != nil {
+		t.Fatalf("error getting service ticket: %v", err)
+	}
+
+	var b bytes.Buffer
+	clone := cl.Clone(Logger(log.New(&b, "", 0)))
+	assert.Equal(t, cl.Config, clone.Config, "configuration should be shared")
+	assert.Equal(t, cl.Creds().CName(), clone.Creds().CName(), "principal should be that of the client")
+	assert.Equal(t, "passwd", clone.Creds().Password(), "password should be that of the client")
+	assert.Equal(t, cl.settings.FASTArmor(), clone.settings.FASTArmor(), "settings should be those of the client")
+	assert.NotEqual(t, cl.settings.Logger(), clone.settings.Logger(), "settings provided should apply to the clone")
+	assert.Empty(t, clone.sessions.Entries, "sessions should not be cloned")
+	_, _, ok := clone.GetCachedTicket(spn)
+	assert.False(t, ok, "cached tickets should not be cloned")
+
+	// The clone logs in and gets tickets independently of the client
+	if _, _, err := clone.GetServiceTicket(spn); err != nil {
+		t.Fatalf("error getting service ticket with the clone: %v", err)
+	}
+	asReqs, tgsReqs := kdc.requests()
+	assert.Equal(t, 4, asReqs, "the clone should log in itself")
+	assert.Equal(t, 2, tgsReqs, "the clone should get the service ticket itself")
+	clone.Destroy()
+	_, _, ok = cl.GetCachedTicket(spn)
+	assert.True(t, ok, "destroying the clone should not affect the client")
+	assert.NotEmpty(t, b.String(), "clone should log with its own logger")
+
+	other := cl.CloneAs("other", "", WithPassword("other-passwd"))
+	assert.Equal(t, "other", other.Creds().CName().PrincipalNameString(), "principal of the clone not as expected")
+	assert.Equal(t, fastTestRealm, other.Creds().Domain(), "realm should be that of the client")
+	assert.Equal(t, "other-passwd", other.Creds().Password(), "password provided should be used")
+	assert.Equal(t, "user", cl.Creds().CName().PrincipalNameString(), "client principal should not be changed")
+	assert.Equal(t, "passwd", cl.Creds().Password(), "client password should not be changed")
+
+	kt := keytab.New()
+	if err := kt.AddEntry("svc", fastTestRealm, "svc-passwd", time.Now(), 1, 18); err != nil {
+		t.Fatalf("error adding keytab entry: %v", err)
+	}
+	svc := NewWithKeytab("svc", fastTestRealm, kt, cl.Config).CloneAs("svc2", "OTHER.GOKRB5")
+	assert.Equal(t, kt, svc.Creds().Keytab(), "keytab should be shared")
+	assert.Equal(t, "OTHER.GOKRB5", svc.Creds().Domain(), "realm of the clone not as expected")
+}
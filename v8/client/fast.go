@@ -0,0 +1,294 @@
+package client
+
+import (
+	"context"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/crypto/etype"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// fastExchange holds the state of an exchange with a KDC armored with FAST (RFC 6113).
+type fastExchange struct {
+	// armor is nil for a TGS exchange, where the TGT in the PA-TGS-REQ provides the armor
+	armor    *messages.KrbFastArmor
+	armorKey types.EncryptionKey
+	cookie   []byte
+}
+
+// fastEnabled indicates if the client's exchanges with the KDC are armored with FAST.
+func (cl *Client) fastEnabled() bool {
+	return cl.settings.FASTArmor() != nil
+}
+
+// newASFAST returns the FAST state for an AS exchange with the realm, armored with the TGT of the FAST armor client.
+func (cl *Client) newASFAST(ctx context.Context, realm string) (*fastExchange, error) {
+	a := cl.settings.FASTArmor()
+	tgt, skey, err := a.sessionTGT(ctx, realm)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "could not get FAST armor TGT for %s", realm)
+	}
+	crealm := a.Credentials.Domain()
+	if a.settings.anonymous {
+		// The realm of an anonymous TGT's client is not disclosed
+		crealm = types.AnonymousRealm
+	}
+	armor, armorKey, err := messages.NewKrbFastArmor(tgt, skey, a.Credentials.CName(), crealm)
+	if err != nil {
+		return nil, err
+	}
+	return &fastExchange{
+		armor:    &armor,
+		armorKey: armorKey,
+	}, nil
+}
+
+// armorTGSReq armors the TGS_REQ with FAST. The TGS_REQ's authenticator is given a sub-session key from which, with
+// the TGT's session key, the armor key is derived. Pre-authentication data other than the PA-TGS-REQ is moved into
+// the armored request.
+func (cl *Client) armorTGSReq(tgsReq *messages.TGSReq, tgt messages.Ticket, sessionKey types.EncryptionKey) (*fastExchange, error) {
+	subKey, err := tgsReq.SetSubKey(tgt, sessionKey, cl.Creds().KDCOffset())
+	if err != nil {
+		return nil, err
+	}
+	var outer, inner types.PADataSequence
+	for _, pa := range tgsReq.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			outer = append(outer, pa)
+		} else {
+			inner = append(inner, pa)
+		}
+	}
+	tgsReq.PAData = outer
+	armorKey, err := messages.FASTArmorKey(subKey, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	f := &fastExchange{armorKey: armorKey}
+	pa, err := f.wrap(tgsReq.ReqBody, inner)
+	if err != nil {
+		return nil, err
+	}
+	tgsReq.PAData = append(tgsReq.PAData, pa)
+	return f, nil
+}
+
+// wrap returns the PA-FX-FAST pre-authentication data carrying the request body and the pre-authentication data
+// provided, encrypted with the armor key. The cookie from the KDC's last reply is included.
+func (f *fastExchange) wrap(body messages.KDCReqBody, pas types.PADataSequence) (types.PAData, error) {
+	inner := make(types.PADataSequence, 0, len(pas)+1)
+	inner = append(inner, pas...)
+	if len(f.cookie) > 0 {
+		inner = append(inner, types.PAData{PADataType: patype.PA_FX_COOKIE, PADataValue: f.cookie})
+	}
+	a, err := messages.NewKrbFastArmoredReq(f.armor, f.armorKey, body, messages.KrbFastReq{
+		PAData:  inner,
+		ReqBody: body,
+	})
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return a.PAData()
+}
+
+// reply decrypts the FAST response in the pre-authentication data of a KDC reply and records the cookie within it.
+func (f *fastExchange) reply(pas types.PADataSequence, nonce int) (messages.KrbFastResponse, error) {
+	r, err := messages.FASTReply(pas, f.armorKey, nonce)
+	if err != nil {
+		return r, err
+	}
+	for _, pa := range r.PAData {
+		if pa.PADataType == patype.PA_FX_COOKIE {
+			f.cookie = pa.PADataValue
+		}
+	}
+	return r, nil
+}
+
+// krbError returns the error a FAST armored request failed with and the pre-authentication hints the KDC provided
+// with it. The KDC returns the error within the FAST response carried in the e-data of the outer KRBError. Errors
+// returned outside of FAST, such as by a KDC that does not support it, are returned as they are.
+func (f *fastExchange) krbError(e messages.KRBError, nonce int) (messages.KRBError, messages.PreAuthHints, error) {
+	var pas types.PADataSequence
+	if len(e.EData) < 1 || pas.Unmarshal(e.EData) != nil {
+		return e, messages.PreAuthHints{}, nil
+	}
+	var armored bool
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_FX_FAST && len(pa.PADataValue) > 0 {
+			armored = true
+		}
+	}
+	if !armored {
+		h, err := messages.NewPreAuthHints(pas)
+		return e, h, err
+	}
+	r, err := f.reply(pas, nonce)
+	if err != nil {
+		return e, messages.PreAuthHints{}, err
+	}
+	ie, ok, err := r.Error()
+	if err != nil {
+		return e, messages.PreAuthHints{}, err
+	}
+	if !ok {
+		ie = e
+	}
+	h, err := messages.NewPreAuthHints(r.PAData)
+	return ie, h, err
+}
+
+// replyKey verifies the FAST response to a request that issued the ticket provided and returns the key the reply is
+// encrypted with: the reply key of the exchange, strengthened if the KDC provided a strengthen key.
+func (f *fastExchange) replyKey(r messages.KrbFastResponse, tkt messages.Ticket, key types.EncryptionKey) (types.EncryptionKey, error) {
+	if !r.HasFinished() {
+		return key, krberror.NewErrorf(krberror.KRBMsgError, "FAST response does not include the finished field")
+	}
+	if err := r.Finished.Verify(f.armorKey, tkt); err != nil {
+		return key, err
+	}
+	if len(r.StrengthenKey.KeyValue) > 0 {
+		return messages.FASTStrengthenReplyKey(r.StrengthenKey, key)
+	}
+	return key, nil
+}
+
+// fastChallenge holds the keys used for FAST encrypted challenge pre-authentication.
+type fastChallenge struct {
+	longTermKey types.EncryptionKey
+	kdcKey      types.EncryptionKey
+}
+
+// encryptedChallenge returns PA-ENCRYPTED-CHALLENGE pre-authentication data for the client's long-term key, using the
+// etype and salt from the KDC's hints if provided (RFC 6113 section 5.4.6).
+func (cl *Client) encryptedChallenge(f *fastExchange, hints *messages.PreAuthHints) (types.PAData, fastChallenge, error) {
+	var c fastChallenge
+	et, err := cl.preAuthEType(hints)
+	if err != nil {
+		return types.PAData{}, c, err
+	}
+	c.longTermKey, err = cl.longTermKey(et, preAuthPAData(hints))
+	if err != nil {
+		return types.PAData{}, c, krberror.Errorf(err, krberror.EncryptingError, "error getting key from credentials")
+	}
+	var clientKey types.EncryptionKey
+	clientKey, c.kdcKey, err = messages.FASTChallengeKeys(f.armorKey, c.longTermKey)
+	if err != nil {
+		return types.PAData{}, c, err
+	}
+	tsb, err := types.GetPAEncTSEncAsnMarshalledOffset(cl.Creds().KDCOffset())
+	if err != nil {
+		return types.PAData{}, c, krberror.Errorf(err, krberror.KRBMsgError, "error creating PAEncTSEnc for encrypted challenge")
+	}
+	ed, err := crypto.GetEncryptedData(tsb, clientKey, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT, 0)
+	if err != nil {
+		return types.PAData{}, c, krberror.Errorf(err, krberror.EncryptingError, "error encrypting challenge")
+	}
+	b, err := ed.Marshal()
+	if err != nil {
+		return types.PAData{}, c, krberror.Errorf(err, krberror.EncodingError, "error marshaling encrypted challenge")
+	}
+	return types.PAData{PADataType: patype.PA_ENCRYPTED_CHALLENGE, PADataValue: b}, c, nil
+}
+
+// verifyKDCChallenge checks the KDC's encrypted challenge in the FAST response, which proves that the KDC knows the
+// client's long-term key.
+func (cl *Client) verifyKDCChallenge(pas types.PADataSequence, c fastChallenge) error {
+	for _, pa := range pas {
+		if pa.PADataType != patype.PA_ENCRYPTED_CHALLENGE {
+			continue
+		}
+		var ed types.EncryptedData
+		if err := ed.Unmarshal(pa.PADataValue); err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC encrypted challenge")
+		}
+		b, err := crypto.DecryptEncPart(ed, c.kdcKey, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC)
+		if err != nil {
+			return krberror.Errorf(err, krberror.DecryptingError, "error decrypting KDC encrypted challenge")
+		}
+		var ts types.PAEncTSEnc
+		if err := ts.Unmarshal(b); err != nil {
+			return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC encrypted challenge")
+		}
+		d := time.Now().UTC().Sub(ts.PATimestamp)
+		if d < 0 {
+			d = -d
+		}
+		if d > cl.config().LibDefaults.Clockskew {
+			return krberror.NewErrorf(krberror.KRBMsgError, "KDC encrypted challenge time differs by more than the clock skew")
+		}
+		return nil
+	}
+	return krberror.NewErrorf(krberror.KRBMsgError, "KDC did not return an encrypted challenge")
+}
+
+// longTermKey returns the client's long-term key for the etype. If the key is derived from the client's password the
+// salt in the pre-authentication data provided is used, if any.
+func (cl *Client) longTermKey(et etype.EType, pas types.PADataSequence) (types.EncryptionKey, error) {
+	if c := cl.Creds(); !c.HasKeytab() && c.HasPassword() {
+		key, _, err := crypto.GetKeyFromPassword(c.Password(), c.CName(), c.Domain(), et.GetETypeID(), pas)
+		return key, err
+	}
+	key, _, err := cl.Key(et, 0, nil)
+	return key, err
+}
+
+// encChallengePreAuth pre-authenticates an exchange armored with FAST with an encrypted challenge (RFC 6113 section
+// 5.4.6), which also authenticates the KDC to the client.
+type encChallengePreAuth struct {
+	challenge *fastChallenge
+}
+
+func newEncChallengePreAuth(ex *PreAuthExchange) (PreAuthenticator, bool) {
+	if !ex.Armored() || !ex.Client.hasLongTermKey() {
+		return nil, false
+	}
+	return &encChallengePreAuth{}, true
+}
+
+// PAData returns the PA-ENCRYPTED-CHALLENGE pre-authentication data.
+func (p *encChallengePreAuth) PAData(ex *PreAuthExchange, hints *messages.PreAuthHints) (types.PADataSequence, error) {
+	if hints == nil && !ex.Client.assumePreAuthentication() {
+		return nil, nil
+	}
+	pa, c, err := ex.Client.encryptedChallenge(ex.fast, hints)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "failed setting encrypted challenge")
+	}
+	p.challenge = &c
+	return types.PADataSequence{pa}, nil
+}
+
+// ReplyKey verifies the KDC's encrypted challenge and returns the client's long-term key.
+func (p *encChallengePreAuth) ReplyKey(ex *PreAuthExchange, asRep messages.ASRep, pas types.PADataSequence) (types.EncryptionKey, error) {
+	if p.challenge != nil && p.challenge.longTermKey.KeyType == asRep.EncPart.EType {
+		if err := ex.Client.verifyKDCChallenge(pas, *p.challenge); err != nil {
+			return types.EncryptionKey{}, krberror.Errorf(err, krberror.KRBMsgError, "could not verify KDC")
+		}
+		return p.challenge.longTermKey, nil
+	}
+	return ex.Client.asRepKey(asRep, append(pas, asRep.PAData...))
+}
+
+// decryptFASTTGSRep verifies the FAST response in a TGS_REP and decrypts the reply with the TGS_REQ's sub-session
+// key, strengthened if the KDC provided a strengthen key.
+func decryptFASTTGSRep(f *fastExchange, tgsRep *messages.TGSRep, tgsReq messages.TGSReq) error {
+	r, err := f.reply(tgsRep.PAData, tgsReq.ReqBody.Nonce)
+	if err != nil {
+		return err
+	}
+	subKey, _ := tgsReq.SubKey()
+	key, err := f.replyKey(r, tgsRep.Ticket, subKey)
+	if err != nil {
+		return err
+	}
+	// The client name in the FAST response is protected by the armor key, unlike that of the outer reply
+	tgsRep.CName = r.Finished.CName
+	tgsRep.CRealm = r.Finished.CRealm
+	return tgsRep.DecryptEncPartWithSubKey(key)
+}
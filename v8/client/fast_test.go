@@ -0,0 +1,501 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana"
+	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+)
+
+const fastTestRealm = "TEST.GOKRB5"
+
+// fastKDC is a KDC that requires FAST armoring and encrypted challenge pre-authentication.
+type fastKDC struct {
+	kt       *keytab.Keytab
+	userKey  types.EncryptionKey
+	otp      string
+	cookie   []byte
+	asReqs   int
+	tgsReqs  int
+	sessions map[string]types.EncryptionKey
+	mux      sync.Mutex
+}
+
+func newFASTKDC(t *testing.T) *fastKDC {
+	kt := keytab.New()
+	for _, p := range []string{"krbtgt/" + fastTestRealm, "HTTP/host.test.gokrb5"} {
+		if err := kt.AddEntry(p, fastTestRealm, "secret-"+p, time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+			t.Fatalf("error adding keytab entry: %v", err)
+		}
+	}
+	userKey, _, err := crypto.GetKeyFromPassword("passwd", types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "user"), fastTestRealm, etypeID.AES256_CTS_HMAC_SHA1_96, types.PADataSequence{})
+	if err != nil {
+		t.Fatalf("error deriving user key: %v", err)
+	}
+	return &fastKDC{
+		kt:       kt,
+		userKey:  userKey,
+		cookie:   []byte("fast-cookie"),
+		sessions: make(map[string]types.EncryptionKey),
+	}
+}
+
+func (k *fastKDC) serve(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b, err := readTCPMessage(c)
+		if err == nil {
+			var rb []byte
+			var asReq messages.ASReq
+			if asReq.Unmarshal(b) == nil {
+				rb, err = k.as(asReq)
+			} else {
+				var tgsReq messages.TGSReq
+				if err = tgsReq.Unmarshal(b); err == nil {
+					rb, err = k.tgs(tgsReq)
+				}
+			}
+			if err == nil {
+				c.Write(tcpFrame(rb))
+			}
+		}
+		c.Close()
+	}
+}
+
+func tcpFrame(b []byte) []byte {
+	hb := make([]byte, 4, 4+len(b))
+	hb[0], hb[1], hb[2], hb[3] = byte(len(b)>>24), byte(len(b)>>16), byte(len(b)>>8), byte(len(b))
+	return append(hb, b...)
+}
+
+func (k *fastKDC) requests() (as, tgs int) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	return k.asReqs, k.tgsReqs
+}
+
+func (k *fastKDC) session(spn string) types.EncryptionKey {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	return k.sessions[spn]
+}
+
+func (k *fastKDC) krbtgtKey() types.EncryptionKey {
+	key, _, _ := k.kt.GetEncryptionKey(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+fastTestRealm), fastTestRealm, 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	return key
+}
+
+func (k *fastKDC) fastRequest(pas types.PADataSequence, armorKey types.EncryptionKey, body messages.KDCReqBody) (messages.KrbFastArmoredReq, messages.KrbFastReq, error) {
+	var a messages.KrbFastArmoredReq
+	for _, pa := range pas {
+		if pa.PADataType == patype.PA_FX_FAST {
+			if err := a.Unmarshal(pa.PADataValue); err != nil {
+				return a, messages.KrbFastReq{}, err
+			}
+			if len(armorKey.KeyValue) == 0 {
+				return a, messages.KrbFastReq{}, nil
+			}
+			r, err := a.Decrypt(armorKey, body)
+			return a, r, err
+		}
+	}
+	return a, messages.KrbFastReq{}, errors.New("request is not armored")
+}
+
+func (k *fastKDC) fastError(armorKey types.EncryptionKey, code int32, nonce int, pas ...types.PAData) ([]byte, error) {
+	inner := messages.NewKRBError(types.PrincipalName{}, fastTestRealm, code, "")
+	ib, err := inner.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	rep, err := messages.NewKrbFastArmoredRep(armorKey, messages.KrbFastResponse{
+		PAData: append(types.PADataSequence{{PADataType: patype.PA_FX_ERROR, PADataValue: ib}}, pas...),
+		Nonce:  nonce,
+	})
+	if err != nil {
+		return nil, err
+	}
+	pa, err := rep.PAData()
+	if err != nil {
+		return nil, err
+	}
+	outer := messages.NewKRBError(types.PrincipalName{}, fastTestRealm, code, "")
+	outer.EData, err = asn1.Marshal(types.PADataSequence{pa})
+	if err != nil {
+		return nil, err
+	}
+	return outer.Marshal()
+}
+
+func (k *fastKDC) as(asReq messages.ASReq) ([]byte, error) {
+	k.mux.Lock()
+	k.asReqs++
+	k.mux.Unlock()
+	a, _, err := k.fastRequest(asReq.PAData, types.EncryptionKey{}, asReq.ReqBody)
+	if err != nil {
+		return nil, err
+	}
+	var apReq messages.APReq
+	if err := apReq.Unmarshal(a.Armor.ArmorValue); err != nil {
+		return nil, err
+	}
+	if err := apReq.Ticket.Decrypt(k.krbtgtKey()); err != nil {
+		return nil, err
+	}
+	sessionKey := apReq.Ticket.DecryptedEncPart.Key
+	ab, err := crypto.DecryptEncPart(apReq.EncryptedAuthenticator, sessionKey, keyusage.AP_REQ_AUTHENTICATOR)
+	if err != nil {
+		return nil, err
+	}
+	var auth types.Authenticator
+	if err := auth.Unmarshal(ab); err != nil {
+		return nil, err
+	}
+	armorKey, err := messages.FASTArmorKey(auth.SubKey, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	fr, err := a.Decrypt(armorKey, asReq.ReqBody)
+	if err != nil {
+		return nil, err
+	}
+	nonce := asReq.ReqBody.Nonce
+	if k.otp != "" {
+		return k.asOTP(asReq, fr, armorKey)
+	}
+	clientKey, kdcKey, err := messages.FASTChallengeKeys(armorKey, k.userKey)
+	if err != nil {
+		return nil, err
+	}
+	var challenge []byte
+	for _, pa := range fr.PAData {
+		if pa.PADataType == patype.PA_ENCRYPTED_CHALLENGE {
+			challenge = pa.PADataValue
+		}
+	}
+	if challenge == nil {
+		info, err := asn1.Marshal(types.ETypeInfo2{{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Salt: fastTestRealm + "user"}})
+		if err != nil {
+			return nil, err
+		}
+		return k.fastError(armorKey, errorcode.KDC_ERR_PREAUTH_REQUIRED, nonce,
+			types.PAData{PADataType: patype.PA_ETYPE_INFO2, PADataValue: info},
+			types.PAData{PADataType: patype.PA_FX_COOKIE, PADataValue: k.cookie},
+		)
+	}
+	if !fr.PAData.Contains(patype.PA_FX_COOKIE) {
+		return nil, errors.New("cookie not returned")
+	}
+	var ed types.EncryptedData
+	if err := ed.Unmarshal(challenge); err != nil {
+		return nil, err
+	}
+	if _, err := crypto.DecryptEncPart(ed, clientKey, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT); err != nil {
+		return k.fastError(armorKey, errorcode.KDC_ERR_PREAUTH_FAILED, nonce)
+	}
+	tsb, err := types.GetPAEncTSEncAsnMarshalled()
+	if err != nil {
+		return nil, err
+	}
+	ked, err := crypto.GetEncryptedData(tsb, kdcKey, keyusage.KEY_USAGE_ENC_CHALLENGE_KDC, 0)
+	if err != nil {
+		return nil, err
+	}
+	kb, err := ked.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	asRep, err := k.reply(msgtype.KRB_AS_REP, asReq.ReqBody, armorKey, k.userKey, keyusage.AS_REP_ENCPART,
+		types.PAData{PADataType: patype.PA_ENCRYPTED_CHALLENGE, PADataValue: kb})
+	if err != nil {
+		return nil, err
+	}
+	r := messages.ASRep{KDCRepFields: asRep}
+	return r.Marshal()
+}
+
+// asOTP requires OTP pre-authentication (RFC 6560) of the AS_REQ, replying with the armor key as the reply key.
+func (k *fastKDC) asOTP(asReq messages.ASReq, fr messages.KrbFastReq, armorKey types.EncryptionKey) ([]byte, error) {
+	nonce := asReq.ReqBody.Nonce
+	var otp []byte
+	for _, pa := range fr.PAData {
+		if pa.PADataType == patype.PA_OTP_REQUEST {
+			otp = pa.PADataValue
+		}
+	}
+	if otp == nil {
+		c := messages.PAOTPChallenge{
+			Nonce:     []byte("otp-nonce"),
+			Service:   "Test token",
+			TokenInfo: []messages.OTPTokenInfo{{Flags: types.NewKrbFlags(), TokenID: []byte("token-1")}},
+		}
+		pa, err := c.PAData()
+		if err != nil {
+			return nil, err
+		}
+		return k.fastError(armorKey, errorcode.KDC_ERR_PREAUTH_REQUIRED, nonce, pa,
+			types.PAData{PADataType: patype.PA_FX_COOKIE, PADataValue: k.cookie})
+	}
+	var r messages.PAOTPRequest
+	if err := r.Unmarshal(otp); err != nil {
+		return nil, err
+	}
+	n, err := r.DecryptNonce(armorKey)
+	if err != nil || string(n) != "otp-nonce" || string(r.OTPValue) != k.otp || string(r.TokenID) != "token-1" {
+		return k.fastError(armorKey, errorcode.KDC_ERR_PREAUTH_FAILED, nonce)
+	}
+	asRep, err := k.reply(msgtype.KRB_AS_REP, asReq.ReqBody, armorKey, armorKey, keyusage.AS_REP_ENCPART)
+	if err != nil {
+		return nil, err
+	}
+	rep := messages.ASRep{KDCRepFields: asRep}
+	return rep.Marshal()
+}
+
+func (k *fastKDC) tgs(tgsReq messages.TGSReq) ([]byte, error) {
+	k.mux.Lock()
+	k.tgsReqs++
+	k.mux.Unlock()
+	var apReq messages.APReq
+	for _, pa := range tgsReq.PAData {
+		if pa.PADataType == patype.PA_TGS_REQ {
+			if err := apReq.Unmarshal(pa.PADataValue); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := apReq.Ticket.Decrypt(k.krbtgtKey()); err != nil {
+		return nil, err
+	}
+	sessionKey := apReq.Ticket.DecryptedEncPart.Key
+	if err := apReq.DecryptAuthenticator(sessionKey); err != nil {
+		return nil, err
+	}
+	armorKey, err := messages.FASTArmorKey(apReq.Authenticator.SubKey, sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	a, _, err := k.fastRequest(tgsReq.PAData, armorKey, tgsReq.ReqBody)
+	if err != nil {
+		return nil, err
+	}
+	if a.Armor.ArmorType != 0 {
+		return nil, errors.New("TGS_REQ should use implicit armor")
+	}
+	tgsRep, err := k.reply(msgtype.KRB_TGS_REP, tgsReq.ReqBody, armorKey, apReq.Authenticator.SubKey, keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY)
+	if err != nil {
+		return nil, err
+	}
+	r := messages.TGSRep{KDCRepFields: tgsRep}
+	return r.Marshal()
+}
+
+// reply issues a ticket for the request, encrypting the reply with the reply key strengthened by a new strengthen key.
+func (k *fastKDC) reply(msgType int, body messages.KDCReqBody, armorKey, replyKey types.EncryptionKey, usage uint32, pas ...types.PAData) (messages.KDCRepFields, error) {
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "user")
+	now := time.Now().UTC()
+	tkt, skey, err := messages.NewTicket(cname, fastTestRealm, body.SName, fastTestRealm, types.NewKrbFlags(), k.kt, etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		return messages.KDCRepFields{}, err
+	}
+	k.mux.Lock()
+	k.sessions[body.SName.PrincipalNameString()] = skey
+	k.mux.Unlock()
+	et, err := crypto.GetEtype(replyKey.KeyType)
+	if err != nil {
+		return messages.KDCRepFields{}, err
+	}
+	strengthenKey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		return messages.KDCRepFields{}, err
+	}
+	key, err := messages.FASTStrengthenReplyKey(strengthenKey, replyKey)
+	if err != nil {
+		return messages.KDCRepFields{}, err
+	}
+	dep := messages.EncKDCRepPart{
+		Key:       skey,
+		LastReqs:  []messages.LastReq{},
+		Nonce:     body.Nonce,
+		Flags:     types.NewKrbFlags(),
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(time.Hour),
+		SRealm:    fastTestRealm,
+		SName:     body.SName,
+	}
+	db, err := dep.Marshal()
+	if err != nil {
+		return messages.KDCRepFields{}, err
+	}
+	ed, err := crypto.GetEncryptedData(db, key, usage, 0)
+	if err != nil {
+		return messages.KDCRepFields{}, err
+	}
+	finished, err := messages.NewKrbFastFinished(armorKey, fastTestRealm, cname, tkt)
+	if err != nil {
+		return messages.KDCRepFields{}, err
+	}
+	rep, err := messages.NewKrbFastArmoredRep(armorKey, messages.KrbFastResponse{
+		PAData:        pas,
+		StrengthenKey: strengthenKey,
+		Finished:      finished,
+		Nonce:         body.Nonce,
+	})
+	if err != nil {
+		return messages.KDCRepFields{}, err
+	}
+	pa, err := rep.PAData()
+	if err != nil {
+		return messages.KDCRepFields{}, err
+	}
+	return messages.KDCRepFields{
+		PVNO:    iana.PVNO,
+		MsgType: msgType,
+		PAData:  types.PADataSequence{pa},
+		CRealm:  fastTestRealm,
+		// The outer client name is not protected so the client should use that in the FAST response
+		CName:   types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "someone-else"),
+		Ticket:  tkt,
+		EncPart: ed,
+	}, nil
+}
+
+// fastTestArmor returns the configuration for the KDC and a FAST armor client with a TGT issued by it.
+func fastTestArmor(t *testing.T, kdc *fastKDC, addr string) (*config.Config, *Client) {
+	c, err := config.NewFromString(fmt.Sprintf("[libdefaults]\n default_realm = %s\n udp_preference_limit = 1\n[realms]\n %s = {\n  kdc = %s\n }\n", fastTestRealm, fastTestRealm, addr))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+	armor := NewWithPassword("armor", fastTestRealm, "armor-passwd", c)
+	now := time.Now().UTC()
+	tgt, skey, err := messages.NewTicket(armor.Credentials.CName(), fastTestRealm,
+		types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+fastTestRealm), fastTestRealm,
+		types.NewKrbFlags(), kdc.kt, etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating armor TGT: %v", err)
+	}
+	armor.addSession(tgt, messages.EncKDCRepPart{
+		Key:       skey,
+		Flags:     types.NewKrbFlags(),
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(time.Hour),
+	})
+	return c, armor
+}
+
+func fastTestClients(t *testing.T, kdc *fastKDC, addr, password string) *Client {
+	c, armor := fastTestArmor(t, kdc, addr)
+	return NewWithPassword("user", fastTestRealm, password, c, FASTArmor(armor))
+}
+
+func TestClient_FAST(t *testing.T) {
+	t.Parallel()
+	kdc := newFASTKDC(t)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	defer l.Close()
+	go kdc.serve(l)
+
+	cl := fastTestClients(t, kdc, l.Addr().String(), "passwd")
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in with FAST: %v", err)
+	}
+	asReqs, _ := kdc.requests()
+	assert.Equal(t, 2, asReqs, "expected an AS_REQ without and then with pre-authentication")
+	_, skey, err := cl.sessionTGT(context.Background(), fastTestRealm)
+	if err != nil {
+		t.Fatalf("error getting TGT: %v", err)
+	}
+	assert.Equal(t, kdc.session("krbtgt/"+fastTestRealm), skey, "TGT session key not as issued by the KDC")
+
+	tkt, skey, err := cl.GetServiceTicket("HTTP/host.test.gokrb5")
+	if err != nil {
+		t.Fatalf("error getting service ticket with FAST: %v", err)
+	}
+	_, tgsReqs := kdc.requests()
+	assert.Equal(t, 1, tgsReqs, "expected a single TGS_REQ")
+	assert.Equal(t, "HTTP/host.test.gokrb5", tkt.SName.PrincipalNameString(), "service ticket not as expected")
+	assert.Equal(t, kdc.session("HTTP/host.test.gokrb5"), skey, "service ticket session key not as issued by the KDC")
+
+	// The wrong password fails the encrypted challenge
+	cl = fastTestClients(t, kdc, l.Addr().String(), "wrong")
+	err = cl.Login()
+	if assert.Error(t, err, "login with the wrong password should fail") {
+		assert.Contains(t, err.Error(), "KDC_ERR_PREAUTH_FAILED", "error not as expected")
+		assert.True(t, errors.Is(err, krberror.ErrPreauthFailed), "error does not match the sentinel error")
+	}
+}
+
+func TestClient_OTP(t *testing.T) {
+	t.Parallel()
+	kdc := newFASTKDC(t)
+	kdc.otp = "123456"
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	defer l.Close()
+	go kdc.serve(l)
+
+	c, armor := fastTestArmor(t, kdc, l.Addr().String())
+	var challenge OTPChallenge
+	otp := "123456"
+	prompt := OTPPromptFunc(func(ch OTPChallenge) (OTPResponse, error) {
+		challenge = ch
+		return OTPResponse{Value: otp}, nil
+	})
+	cl := NewWithOTP("user", fastTestRealm, prompt, c, FASTArmor(armor))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in with OTP: %v", err)
+	}
+	assert.Equal(t, "Test token", challenge.Service, "OTP challenge service not as expected")
+	if assert.Len(t, challenge.Tokens, 1, "OTP challenge tokens not as expected") {
+		assert.Equal(t, []byte("token-1"), challenge.Tokens[0].TokenID, "OTP challenge token not as expected")
+	}
+	asReqs, _ := kdc.requests()
+	assert.Equal(t, 2, asReqs, "expected an AS_REQ without and then with the one-time password")
+	_, skey, err := cl.sessionTGT(context.Background(), fastTestRealm)
+	if err != nil {
+		t.Fatalf("error getting TGT: %v", err)
+	}
+	assert.Equal(t, kdc.session("krbtgt/"+fastTestRealm), skey, "TGT session key not as issued by the KDC")
+
+	// The wrong one-time password fails pre-authentication
+	otp = "654321"
+	cl = NewWithOTP("user", fastTestRealm, prompt, c, FASTArmor(armor))
+	err = cl.Login()
+	if assert.Error(t, err, "login with the wrong one-time password should fail") {
+		assert.Contains(t, err.Error(), "KDC_ERR_PREAUTH_FAILED", "error not as expected")
+	}
+}
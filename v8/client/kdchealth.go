@@ -0,0 +1,216 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/trace"
+)
+
+const (
+	// defaultKDCTimeout is the time allowed for the exchange with each KDC if not configured.
+	defaultKDCTimeout = 5 * time.Second
+	// defaultKDCQuarantine is how long a KDC that fails is tried after the others if not configured.
+	defaultKDCQuarantine = 30 * time.Second
+	// defaultKDCRetryBackoff is the wait before the KDCs are tried again if not configured.
+	defaultKDCRetryBackoff = time.Second
+	// defaultKDCRetryJitter is the fraction of the wait before the KDCs are tried again that is random if not configured.
+	defaultKDCRetryJitter = 0.5
+)
+
+// kdcHealth records which KDC of each realm last worked and which KDCs have recently failed.
+// KDCs are keyed by the network used to reach them as a KDC may be reachable over TCP and not UDP.
+type kdcHealth struct {
+	preferred   map[string]string
+	quarantined map[string]time.Time
+	mux         sync.Mutex
+}
+
+// order returns the KDC addresses in the order they should be tried: the KDC that last worked first followed by the
+// others in their configured order, with the KDCs in quarantine last.
+func (h *kdcHealth) order(network, realm string, kdcs map[int]string) []string {
+	addrs := make([]string, 0, len(kdcs))
+	for i := 1; i <= len(kdcs); i++ {
+		addrs = append(addrs, kdcs[i])
+	}
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	now := time.Now()
+	rank := func(addr string) int {
+		if h.preferred[network+"/"+realm] == addr {
+			return 0
+		}
+		if t, ok := h.quarantined[network+"/"+addr]; ok {
+			if now.Before(t) {
+				return 2
+			}
+			delete(h.quarantined, network+"/"+addr)
+		}
+		return 1
+	}
+	ranks := make(map[string]int, len(addrs))
+	for _, addr := range addrs {
+		ranks[addr] = rank(addr)
+	}
+	sort.SliceStable(addrs, func(i, j int) bool {
+		return ranks[addrs[i]] < ranks[addrs[j]]
+	})
+	return addrs
+}
+
+// succeeded records that the KDC worked so that it is tried first for the realm.
+func (h *kdcHealth) succeeded(network, realm, addr string) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if h.preferred == nil {
+		h.preferred = make(map[string]string)
+	}
+	h.preferred[network+"/"+realm] = addr
+	delete(h.quarantined, network+"/"+addr)
+}
+
+// failed records that the KDC failed so that it is tried after the other KDCs until the quarantine period ends.
+func (h *kdcHealth) failed(network, realm, addr string, d time.Duration) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if h.preferred[network+"/"+realm] == addr {
+		delete(h.preferred, network+"/"+realm)
+	}
+	if d <= 0 {
+		return
+	}
+	if h.quarantined == nil {
+		h.quarantined = make(map[string]time.Time)
+	}
+	h.quarantined[network+"/"+addr] = time.Now().Add(d)
+}
+
+// kdcTimeout returns the time allowed for an exchange with a KDC over the transport: udp, tcp or https. The client's
+// settings take precedence over its configuration, and for each the timeout of the transport over the general timeout.
+func (cl *Client) kdcTimeout(transport string) time.Duration {
+	var l config.LibDefaults
+	if c := cl.config(); c != nil {
+		l = c.LibDefaults
+	}
+	udp, tcp, https := cl.settings.KDCTransportTimeouts()
+	var set, configured time.Duration
+	switch transport {
+	case "udp":
+		set, configured = udp, l.KDCTimeoutUDP
+	case "tcp":
+		set, configured = tcp, l.KDCTimeoutTCP
+	case "https":
+		set, configured = https, l.KDCTimeoutHTTPS
+	}
+	for _, d := range []time.Duration{set, cl.settings.kdcTimeout, configured, l.KDCTimeout} {
+		if d > 0 {
+			return d
+		}
+	}
+	return defaultKDCTimeout
+}
+
+// kdcRetryPolicy returns the number of times the client tries each of a realm's KDCs, from its settings or otherwise
+// the max_retries of its configuration, and the initial wait between attempts.
+func (cl *Client) kdcRetryPolicy() (int, time.Duration) {
+	n, b := cl.settings.KDCRetryPolicy()
+	if cl.settings.kdcMaxAttempts < 1 {
+		if c := cl.config(); c != nil && c.LibDefaults.MaxRetries > 0 {
+			n = c.LibDefaults.MaxRetries
+		}
+	}
+	return n, b
+}
+
+// jitter returns the duration less a random part of the fraction of it provided.
+func jitter(d time.Duration, fraction float64) time.Duration {
+	if fraction <= 0 || d <= 0 {
+		return d
+	}
+	return d - time.Duration(rand.Float64()*fraction*float64(d))
+}
+
+// ctxErr returns the error of the context, or context.DeadlineExceeded if its deadline has passed before it is done,
+// as I/O with a deadline taken from the context can time out before the context's own timer fires.
+func ctxErr(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+		return context.DeadlineExceeded
+	}
+	return nil
+}
+
+// dialSend sends the message b to the realm's KDCs in turn using the send function provided until one replies.
+// Each KDC is allowed the client's KDC timeout for the transport used to reach it. If none of the KDCs reply they are
+// tried again, up to the maximum number of attempts configured, waiting for the backoff period between attempts. The
+// backoff doubles after each attempt and part of it is random, as configured with the KDCRetryJitter setting.
+func (cl *Client) dialSend(ctx context.Context, network, realm string, kdcs map[int]string, b []byte, send func(ctx context.Context, addr string) ([]byte, error)) ([]byte, error) {
+	var errs []string
+	attempts, backoff := cl.kdcRetryPolicy()
+	for attempt := 1; ; attempt++ {
+		for _, addr := range cl.kdcHealth.order(network, realm, kdcs) {
+			if err := ctxErr(ctx); err != nil {
+				return nil, err
+			}
+			transport := network
+			if isKDCProxyURL(addr) {
+				transport = "https"
+			}
+			e := trace.Event{Type: trace.KDCRequest, Realm: realm, KDC: addr, Transport: transport, MessageType: trace.MessageType(b), Message: b}
+			cl.trace(e)
+			start := time.Now()
+			actx, cancel := context.WithTimeout(ctx, cl.kdcTimeout(transport))
+			actx, span := cl.StartSpan(actx, trace.SpanKDCRequest, trace.Attr(trace.AttrRealm, realm), trace.Attr(trace.AttrKDC, addr), trace.Attr(trace.AttrTransport, transport))
+			rb, err := send(actx, addr)
+			trace.EndSpan(span, err)
+			cancel()
+			e.Duration, e.Message = time.Since(start), rb
+			cl.settings.Metrics().KDCExchange(realm, addr, transport, e.Duration, err)
+			if err == nil {
+				cl.kdcHealth.succeeded(network, realm, addr)
+				e.Type, e.MessageType = trace.KDCReply, trace.MessageType(rb)
+				if e.MessageType == msgtype.KRB_ERROR {
+					var krberr messages.KRBError
+					if krberr.Unmarshal(rb) == nil {
+						e.ErrorCode = krberr.ErrorCode
+						cl.settings.Metrics().KDCError(realm, krberr.ErrorCode)
+					}
+				}
+				cl.trace(e)
+				return rb, nil
+			}
+			e.Type, e.MessageType, e.Err = trace.KDCUnreachable, 0, err
+			cl.trace(e)
+			if err := ctxErr(ctx); err != nil {
+				return nil, err
+			}
+			cl.kdcHealth.failed(network, realm, addr, cl.settings.KDCQuarantine())
+			errs = append(errs, err.Error())
+		}
+		if attempt >= attempts || len(kdcs) < 1 {
+			break
+		}
+		t := time.NewTimer(jitter(backoff, cl.settings.KDCRetryJitter()))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, ctx.Err()
+		case <-t.C:
+		}
+		backoff *= 2
+	}
+	if len(errs) < 1 {
+		return nil, fmt.Errorf("no KDCs to send to for realm %s", realm)
+	}
+	return nil, fmt.Errorf("error sending to a KDC: %s", strings.Join(errs, "; "))
+}
@@ -0,0 +1,321 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/metrics"
+	"github.com/Osirium/gokrb5/v8/trace"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKDCHealth_order(t *testing.T) {
+	t.Parallel()
+	var h kdcHealth
+	kdcs := map[int]string{1: "kdc1:88", 2: "kdc2:88", 3: "kdc3:88"}
+	assert.Equal(t, []string{"kdc1:88", "kdc2:88", "kdc3:88"}, h.order("tcp", "TEST.GOKRB5", kdcs), "initial order not as configured")
+
+	h.failed("tcp", "TEST.GOKRB5", "kdc1:88", time.Minute)
+	assert.Equal(t, []string{"kdc2:88", "kdc3:88", "kdc1:88"}, h.order("tcp", "TEST.GOKRB5", kdcs), "quarantined KDC not tried last")
+	assert.Equal(t, []string{"kdc1:88", "kdc2:88", "kdc3:88"}, h.order("udp", "TEST.GOKRB5", kdcs), "quarantine should only apply to the network used")
+
+	h.succeeded("tcp", "TEST.GOKRB5", "kdc3:88")
+	assert.Equal(t, []string{"kdc3:88", "kdc2:88", "kdc1:88"}, h.order("tcp", "TEST.GOKRB5", kdcs), "KDC that last worked not tried first")
+	assert.Equal(t, []string{"kdc2:88", "kdc3:88", "kdc1:88"}, h.order("tcp", "OTHER.GOKRB5", kdcs), "affinity should only apply to the realm")
+
+	h.failed("tcp", "TEST.GOKRB5", "kdc3:88", 0)
+	assert.Equal(t, []string{"kdc2:88", "kdc3:88", "kdc1:88"}, h.order("tcp", "TEST.GOKRB5", kdcs), "failed KDC should lose affinity")
+
+	h.failed("tcp", "TEST.GOKRB5", "kdc2:88", time.Nanosecond)
+	time.Sleep(time.Millisecond)
+	assert.Equal(t, []string{"kdc2:88", "kdc3:88", "kdc1:88"}, h.order("tcp", "TEST.GOKRB5", kdcs), "KDC should leave quarantine after the period")
+}
+
+func TestClient_dialSend(t *testing.T) {
+	t.Parallel()
+	cl := &Client{settings: NewSettings(KDCRetryPolicy(3, time.Millisecond), KDCTimeout(time.Second))}
+	kdcs := map[int]string{1: "kdc1:88", 2: "kdc2:88"}
+
+	var tried []string
+	// kdc1 never replies and kdc2 fails to reply to the first attempt
+	kdc2Fails := 1
+	send := func(ctx context.Context, addr string) ([]byte, error) {
+		tried = append(tried, addr)
+		if _, ok := ctx.Deadline(); !ok {
+			t.Error("exchange with KDC has no deadline")
+		}
+		if addr == "kdc1:88" {
+			return nil, errors.New("no reply")
+		}
+		if kdc2Fails > 0 {
+			kdc2Fails--
+			return nil, errors.New("no reply")
+		}
+		return []byte{1}, nil
+	}
+	rb, err := cl.dialSend(context.Background(), "tcp", "TEST.GOKRB5", kdcs, nil, send)
+	if err != nil {
+		t.Fatalf("error sending: %v", err)
+	}
+	assert.Equal(t, []byte{1}, rb, "reply not as expected")
+	assert.Equal(t, []string{"kdc1:88", "kdc2:88", "kdc1:88", "kdc2:88"}, tried, "KDCs not tried in the order expected")
+
+	// The KDC that worked is tried first
+	tried = nil
+	_, err = cl.dialSend(context.Background(), "tcp", "TEST.GOKRB5", kdcs, nil, send)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"kdc2:88"}, tried, "KDC that last worked not tried first")
+
+	// All attempts fail
+	tried = nil
+	_, err = cl.dialSend(context.Background(), "tcp", "TEST.GOKRB5", kdcs, nil, func(ctx context.Context, addr string) ([]byte, error) {
+		tried = append(tried, addr)
+		return nil, errors.New("no reply")
+	})
+	assert.Error(t, err, "error expected when no KDC replies")
+	assert.Len(t, tried, 6, "each KDC should be tried once per attempt")
+}
+
+func TestClient_dialSendConfiguredOrder(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewFromString("[realms]\n TEST.GOKRB5 = {\n  kdc = kdc1:88\n  kdc = kdc2:88\n  kdc = kdc3:88\n  kdc = kdc4:88\n }\n")
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+	var cl *Client
+	var tried []string
+	// Only kdc3 replies
+	send := func(ctx context.Context, addr string) ([]byte, error) {
+		tried = append(tried, addr)
+		if addr != "kdc3:88" {
+			return nil, errors.New("no reply")
+		}
+		return []byte{1}, nil
+	}
+	for i := 0; i < 10; i++ {
+		cl = &Client{Config: c, settings: NewSettings(KDCTimeout(time.Second))}
+		tried = nil
+		_, kdcs, err := cl.config().GetKDCs("TEST.GOKRB5", true)
+		if err != nil {
+			t.Fatalf("error getting KDCs: %v", err)
+		}
+		if _, err := cl.dialSend(context.Background(), "tcp", "TEST.GOKRB5", kdcs, nil, send); err != nil {
+			t.Fatalf("error sending: %v", err)
+		}
+		assert.Equal(t, []string{"kdc1:88", "kdc2:88", "kdc3:88"}, tried, "KDCs should be tried in the order configured")
+	}
+
+	// The KDC that worked is tried first, then the others in the order configured with those that failed last
+	tried = nil
+	_, kdcs, _ := cl.config().GetKDCs("TEST.GOKRB5", true)
+	send = func(ctx context.Context, addr string) ([]byte, error) {
+		tried = append(tried, addr)
+		if addr != "kdc2:88" {
+			return nil, errors.New("no reply")
+		}
+		return []byte{1}, nil
+	}
+	if _, err := cl.dialSend(context.Background(), "tcp", "TEST.GOKRB5", kdcs, nil, send); err != nil {
+		t.Fatalf("error sending: %v", err)
+	}
+	assert.Equal(t, []string{"kdc3:88", "kdc4:88", "kdc1:88", "kdc2:88"}, tried, "KDC that last worked should be tried first and the failed KDCs last")
+}
+
+func TestClient_kdcTimeout(t *testing.T) {
+	t.Parallel()
+	c, _ := config.NewFromString("[libdefaults]\n kdc_timeout = 3s\n kdc_timeout_udp = 1s\n max_retries = 4\n")
+	cl := &Client{Config: c, settings: NewSettings()}
+	assert.Equal(t, time.Second, cl.kdcTimeout("udp"), "configured transport timeout should be used")
+	assert.Equal(t, 3*time.Second, cl.kdcTimeout("tcp"), "configured timeout should be used without a transport timeout")
+	attempts, _ := cl.kdcRetryPolicy()
+	assert.Equal(t, 4, attempts, "configured max_retries should be used")
+
+	cl.settings = NewSettings(KDCTimeout(2*time.Second), KDCTransportTimeouts(0, 0, 10*time.Second), KDCRetryPolicy(2, time.Second))
+	assert.Equal(t, 2*time.Second, cl.kdcTimeout("udp"), "timeout setting should take precedence over the configuration")
+	assert.Equal(t, 10*time.Second, cl.kdcTimeout("https"), "transport timeout setting should take precedence")
+	attempts, _ = cl.kdcRetryPolicy()
+	assert.Equal(t, 2, attempts, "retry policy setting should take precedence over the configuration")
+
+	cl = &Client{settings: NewSettings()}
+	assert.Equal(t, defaultKDCTimeout, cl.kdcTimeout("tcp"), "default timeout should be used without a configuration")
+	attempts, _ = cl.kdcRetryPolicy()
+	assert.Equal(t, 1, attempts, "a single attempt should be made by default")
+}
+
+func TestJitter(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, time.Second, jitter(time.Second, 0), "no jitter expected")
+	for i := 0; i < 100; i++ {
+		d := jitter(time.Second, 0.5)
+		if d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("jittered duration %v outside of the expected range", d)
+		}
+	}
+	assert.Equal(t, 0.5, NewSettings().KDCRetryJitter(), "default jitter not as expected")
+	assert.Equal(t, 0.0, NewSettings(KDCRetryJitter(-1)).KDCRetryJitter(), "negative jitter should disable it")
+}
+
+func TestClient_dialSendTrace(t *testing.T) {
+	t.Parallel()
+	var events []trace.Event
+	tracer := trace.Func(func(e trace.Event) {
+		events = append(events, e)
+	})
+	cl := &Client{settings: NewSettings(Tracer(tracer), KDCQuarantine(-1))}
+	kdcs := map[int]string{1: "kdc1:88", 2: "kdc2:88"}
+	// An AS-REQ and AS-REP, identified by their application tags
+	req, rep := []byte{0x6a, 0x00}, []byte{0x6b, 0x00}
+	send := func(ctx context.Context, addr string) ([]byte, error) {
+		if addr == "kdc1:88" {
+			return nil, errors.New("no reply")
+		}
+		return rep, nil
+	}
+	_, err := cl.dialSend(context.Background(), "tcp", "TEST.GOKRB5", kdcs, req, send)
+	if err != nil {
+		t.Fatalf("error sending: %v", err)
+	}
+	var got []trace.EventType
+	for _, e := range events {
+		got = append(got, e.Type)
+		assert.Equal(t, "TEST.GOKRB5", e.Realm, "realm in trace event not as expected")
+		assert.Equal(t, "tcp", e.Transport, "transport in trace event not as expected")
+		assert.Nil(t, e.Message, "messages should be redacted from trace events by default")
+	}
+	assert.Equal(t, []trace.EventType{trace.KDCRequest, trace.KDCUnreachable, trace.KDCRequest, trace.KDCReply}, got, "trace events not as expected")
+	assert.Equal(t, int32(msgtype.KRB_AS_REQ), events[0].MessageType, "message type of request not as expected")
+	assert.Equal(t, "kdc2:88", events[3].KDC, "KDC of reply not as expected")
+	assert.Equal(t, int32(msgtype.KRB_AS_REP), events[3].MessageType, "message type of reply not as expected")
+
+	events = nil
+	cl.settings = NewSettings(Tracer(tracer), TraceMessages(true))
+	cl.dialSend(context.Background(), "tcp", "TEST.GOKRB5", kdcs, req, send)
+	assert.Equal(t, req, events[0].Message, "request should be included in trace event")
+	assert.Equal(t, rep, events[len(events)-1].Message, "reply should be included in trace event")
+}
+
+// testRecorder is a metrics.Recorder that keeps the measurements recorded.
+type testRecorder struct {
+	metrics.Nop
+	exchanges []string
+	errors    []int32
+	cacheHits []bool
+	renewals  []string
+	mux       sync.Mutex
+}
+
+func (r *testRecorder) KDCExchange(realm, kdc, transport string, d time.Duration, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.exchanges = append(r.exchanges, fmt.Sprintf("%s %s %s %v", realm, kdc, transport, err == nil))
+}
+
+func (r *testRecorder) KDCError(realm string, code int32) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.errors = append(r.errors, code)
+}
+
+func (r *testRecorder) TicketCache(hit bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.cacheHits = append(r.cacheHits, hit)
+}
+
+func (r *testRecorder) Renewal(realm, service string, err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.renewals = append(r.renewals, fmt.Sprintf("%s %s %v", realm, service, err == nil))
+}
+
+func TestClient_dialSendMetrics(t *testing.T) {
+	t.Parallel()
+	r := new(testRecorder)
+	cl := &Client{settings: NewSettings(Metrics(r), KDCQuarantine(-1))}
+	kdcs := map[int]string{1: "kdc1:88", 2: "https://kdc2/KdcProxy"}
+	krberr := messages.NewKRBError(types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5", errorcode.KDC_ERR_PREAUTH_REQUIRED, "pre-authentication required")
+	rb, err := krberr.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRB_ERROR: %v", err)
+	}
+	_, err = cl.dialSend(context.Background(), "tcp", "TEST.GOKRB5", kdcs, nil, func(ctx context.Context, addr string) ([]byte, error) {
+		if addr == "kdc1:88" {
+			return nil, errors.New("no reply")
+		}
+		return rb, nil
+	})
+	if err != nil {
+		t.Fatalf("error sending: %v", err)
+	}
+	assert.Equal(t, []string{"TEST.GOKRB5 kdc1:88 tcp false", "TEST.GOKRB5 https://kdc2/KdcProxy https true"}, r.exchanges, "KDC exchanges recorded not as expected")
+	assert.Equal(t, []int32{errorcode.KDC_ERR_PREAUTH_REQUIRED}, r.errors, "KDC errors recorded not as expected")
+}
+
+type testSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+}
+
+func (s *testSpan) SetAttributes(attrs ...trace.Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *testSpan) RecordError(err error) {
+	s.err = err
+}
+
+func (s *testSpan) End() {}
+
+type testSpanStarter struct {
+	spans []*testSpan
+	mux   sync.Mutex
+}
+
+func (st *testSpanStarter) Start(ctx context.Context, name string, attrs ...trace.Attribute) (context.Context, trace.Span) {
+	s := &testSpan{name: name, attrs: make(map[string]interface{})}
+	s.SetAttributes(attrs...)
+	st.mux.Lock()
+	defer st.mux.Unlock()
+	st.spans = append(st.spans, s)
+	return ctx, s
+}
+
+func TestClient_dialSendSpans(t *testing.T) {
+	t.Parallel()
+	st := new(testSpanStarter)
+	cl := &Client{settings: NewSettings(Spans(st), KDCQuarantine(-1))}
+	kdcs := map[int]string{1: "kdc1:88", 2: "kdc2:88"}
+	_, err := cl.dialSend(context.Background(), "udp", "TEST.GOKRB5", kdcs, nil, func(ctx context.Context, addr string) ([]byte, error) {
+		if addr == "kdc1:88" {
+			return nil, errors.New("no reply")
+		}
+		return []byte{}, nil
+	})
+	if err != nil {
+		t.Fatalf("error sending: %v", err)
+	}
+	if !assert.Len(t, st.spans, 2, "a span should be started for each KDC") {
+		return
+	}
+	for i, kdc := range []string{"kdc1:88", "kdc2:88"} {
+		assert.Equal(t, trace.SpanKDCRequest, st.spans[i].name, "span name not as expected")
+		assert.Equal(t, "TEST.GOKRB5", st.spans[i].attrs[trace.AttrRealm], "realm attribute not as expected")
+		assert.Equal(t, kdc, st.spans[i].attrs[trace.AttrKDC], "KDC attribute not as expected")
+		assert.Equal(t, "udp", st.spans[i].attrs[trace.AttrTransport], "transport attribute not as expected")
+	}
+	assert.Error(t, st.spans[0].err, "error of the KDC that did not reply should be recorded")
+	assert.NoError(t, st.spans[1].err, "no error should be recorded for the KDC that replied")
+}
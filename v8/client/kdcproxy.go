@@ -0,0 +1,69 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/Osirium/gokrb5/v8/messages"
+)
+
+// kdcProxyMaxResponse is the largest KDC proxy response body that will be read.
+const kdcProxyMaxResponse = 1 << 20
+
+// isKDCProxyURL indicates if a KDC address from the configuration is the URL of an MS-KKDCP KDC proxy,
+// as configured with a realm's kdc or kpasswd_server value such as https://proxy.example.com/KdcProxy
+func isKDCProxyURL(addr string) bool {
+	return strings.HasPrefix(strings.ToLower(addr), "https://")
+}
+
+// hasKDCProxyURL indicates if any of the addresses are the URL of a KDC proxy.
+func hasKDCProxyURL(addrs map[int]string) bool {
+	for _, a := range addrs {
+		if isKDCProxyURL(a) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendKDCProxy sends the message to the KDC for the realm through the MS-KKDCP KDC proxy at the URL provided and
+// returns the KDC's reply.
+func (cl *Client) sendKDCProxy(ctx context.Context, url, realm string, b []byte) ([]byte, error) {
+	m := messages.NewKDCProxyMessage(b, realm)
+	mb, err := m.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(mb))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request to KDC proxy %s: %v", url, err)
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/kerberos")
+	req.Header.Set("Cache-Control", "no-cache")
+	resp, err := cl.settings.KDCProxyHTTPClient().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending to KDC proxy %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("KDC proxy %s returned HTTP status %s", url, resp.Status)
+	}
+	rb, err := ioutil.ReadAll(io.LimitReader(resp.Body, kdcProxyMaxResponse+1))
+	if err != nil {
+		return nil, fmt.Errorf("error reading response from KDC proxy %s: %v", url, err)
+	}
+	if len(rb) > kdcProxyMaxResponse {
+		return nil, fmt.Errorf("response from KDC proxy %s is too large", url)
+	}
+	var r messages.KDCProxyMessage
+	if err := r.Unmarshal(rb); err != nil {
+		return nil, fmt.Errorf("invalid response from KDC proxy %s: %v", url, err)
+	}
+	return r.Message()
+}
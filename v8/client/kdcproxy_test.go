@@ -0,0 +1,71 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_dialSendTCP_KDCProxy(t *testing.T) {
+	t.Parallel()
+	var req messages.KDCProxyMessage
+	// A KDC proxy that replies with the message it was sent reversed
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/KdcProxy" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/kerberos" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := req.Unmarshal(b); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m, _ := req.Message()
+		rev := make([]byte, len(m))
+		for i := range m {
+			rev[len(m)-1-i] = m[i]
+		}
+		rm := messages.NewKDCProxyMessage(rev, "")
+		rb, _ := rm.Marshal()
+		w.Write(rb)
+	}))
+	defer s.Close()
+
+	cl := &Client{settings: NewSettings(KDCProxyHTTPClient(s.Client()))}
+	kdcs := map[int]string{1: s.URL + "/KdcProxy"}
+	rb, err := cl.dialSendTCP(context.Background(), "TEST.GOKRB5", kdcs, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatalf("error sending to KDC proxy: %v", err)
+	}
+	assert.Equal(t, []byte{3, 2, 1}, rb, "reply from KDC proxy not as expected")
+	assert.Equal(t, "TEST.GOKRB5", req.TargetDomain, "target domain sent to KDC proxy not as expected")
+
+	// A proxy that fails is passed over for the next KDC
+	kdcs = map[int]string{1: s.URL + "/missing", 2: s.URL + "/KdcProxy"}
+	rb, err = cl.dialSendTCP(context.Background(), "TEST.GOKRB5", kdcs, []byte{1, 2, 3})
+	if err != nil {
+		t.Fatalf("error sending to KDC proxy: %v", err)
+	}
+	assert.Equal(t, []byte{3, 2, 1}, rb, "reply from second KDC proxy not as expected")
+
+	// Proxies are not used over UDP
+	_, err = cl.dialSendUDP(context.Background(), "TEST.GOKRB5", kdcs, []byte{1, 2, 3})
+	assert.Error(t, err, "KDC proxy should not be used over UDP")
+}
+
+func TestIsKDCProxyURL(t *testing.T) {
+	t.Parallel()
+	assert.True(t, isKDCProxyURL("https://proxy.example.com/KdcProxy"))
+	assert.True(t, isKDCProxyURL("HTTPS://proxy.example.com/KdcProxy"))
+	assert.False(t, isKDCProxyURL("kdc.example.com:88"))
+	assert.False(t, isKDCProxyURL("http://proxy.example.com/KdcProxy"))
+}
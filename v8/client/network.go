@@ -1,24 +1,35 @@
 package client
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"net"
-	"strings"
 	"time"
 
 	"github.com/Osirium/gokrb5/v8/iana/errorcode"
 	"github.com/Osirium/gokrb5/v8/messages"
 )
 
+const (
+	// maxUDPResponseSize is the largest UDP datagram payload so that a reply is never truncated.
+	maxUDPResponseSize = 65507
+	// maxTCPResponseSize is the largest reply that will be read from a TCP connection.
+	maxTCPResponseSize = 1 << 24
+)
+
 // SendToKDC performs network actions to send data to the KDC.
-func (cl *Client) sendToKDC(b []byte, realm string) ([]byte, error) {
-	var rb []byte
-	if cl.Config.LibDefaults.UDPPreferenceLimit == 1 {
+// The context provided is used to cancel the exchange and its deadline limits the time spent on each connection.
+//
+// Messages no larger than the udp_preference_limit are sent over UDP first, and are sent again over TCP if that fails
+// or the KDC replies with KRB_ERR_RESPONSE_TOO_BIG, as it will when a reply including a PAC does not fit in a
+// datagram. Larger messages are sent over TCP first. A udp_preference_limit of 1 means only TCP is used.
+func (cl *Client) sendToKDC(ctx context.Context, b []byte, realm string) ([]byte, error) {
+	if cl.config().LibDefaults.UDPPreferenceLimit == 1 {
 		//1 means we should always use TCP
-		rb, errtcp := cl.sendKDCTCP(realm, b)
+		rb, errtcp := cl.sendKDCTCP(ctx, realm, b)
 		if errtcp != nil {
 			if e, ok := errtcp.(messages.KRBError); ok {
 				return rb, e
@@ -27,89 +38,116 @@ func (cl *Client) sendToKDC(b []byte, realm string) ([]byte, error) {
 		}
 		return rb, nil
 	}
-	if len(b) <= cl.Config.LibDefaults.UDPPreferenceLimit {
+	if len(b) <= cl.config().LibDefaults.UDPPreferenceLimit {
 		//Try UDP first, TCP second
-		rb, errudp := cl.sendKDCUDP(realm, b)
-		if errudp != nil {
-			if e, ok := errudp.(messages.KRBError); ok && e.ErrorCode != errorcode.KRB_ERR_RESPONSE_TOO_BIG {
-				// Got a KRBError from KDC
-				// If this is not a KRB_ERR_RESPONSE_TOO_BIG we will return immediately otherwise will try TCP.
+		rb, errudp := cl.sendKDCUDP(ctx, realm, b)
+		if errudp == nil {
+			return rb, nil
+		}
+		if e, ok := errudp.(messages.KRBError); ok && e.ErrorCode != errorcode.KRB_ERR_RESPONSE_TOO_BIG {
+			// Got a KRBError from KDC
+			// If this is not a KRB_ERR_RESPONSE_TOO_BIG we will return immediately otherwise will try TCP.
+			return rb, e
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		// Try TCP
+		rb, errtcp := cl.sendKDCTCP(ctx, realm, b)
+		if errtcp != nil {
+			if e, ok := errtcp.(messages.KRBError); ok {
+				// Got a KRBError
 				return rb, e
 			}
-			// Try TCP
-			r, errtcp := cl.sendKDCTCP(realm, b)
-			if errtcp != nil {
-				if e, ok := errtcp.(messages.KRBError); ok {
-					// Got a KRBError
-					return r, e
-				}
-				return r, fmt.Errorf("failed to communicate with KDC. Attempts made with UDP (%v) and then TCP (%v)", errudp, errtcp)
-			}
-			rb = r
+			return rb, fmt.Errorf("failed to communicate with KDC. Attempts made with UDP (%v) and then TCP (%v)", errudp, errtcp)
 		}
 		return rb, nil
 	}
 	//Try TCP first, UDP second
-	rb, errtcp := cl.sendKDCTCP(realm, b)
-	if errtcp != nil {
-		if e, ok := errtcp.(messages.KRBError); ok {
-			// Got a KRBError from KDC so returning and not trying UDP.
+	rb, errtcp := cl.sendKDCTCP(ctx, realm, b)
+	if errtcp == nil {
+		return rb, nil
+	}
+	if e, ok := errtcp.(messages.KRBError); ok {
+		// Got a KRBError from KDC so returning and not trying UDP.
+		return rb, e
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	rb, errudp := cl.sendKDCUDP(ctx, realm, b)
+	if errudp != nil {
+		if e, ok := errudp.(messages.KRBError); ok {
+			// Got a KRBError
 			return rb, e
 		}
-		rb, errudp := cl.sendKDCUDP(realm, b)
-		if errudp != nil {
-			if e, ok := errudp.(messages.KRBError); ok {
-				// Got a KRBError
-				return rb, e
-			}
-			return rb, fmt.Errorf("failed to communicate with KDC. Attempts made with TCP (%v) and then UDP (%v)", errtcp, errudp)
-		}
+		return rb, fmt.Errorf("failed to communicate with KDC. Attempts made with TCP (%v) and then UDP (%v)", errtcp, errudp)
 	}
 	return rb, nil
 }
 
 // sendKDCUDP sends bytes to the KDC via UDP.
-func (cl *Client) sendKDCUDP(realm string, b []byte) ([]byte, error) {
+func (cl *Client) sendKDCUDP(ctx context.Context, realm string, b []byte) ([]byte, error) {
 	var r []byte
-	_, kdcs, err := cl.Config.GetKDCs(realm, false)
+	_, kdcs, err := cl.config().GetKDCs(realm, false)
 	if err != nil {
 		return r, err
 	}
-	r, err = dialSendUDP(kdcs, b)
+	r, err = cl.dialSendUDP(ctx, realm, kdcs, b)
 	if err != nil {
 		return r, err
 	}
 	return checkForKRBError(r)
 }
 
-// dialSendUDP establishes a UDP connection to a KDC.
-func dialSendUDP(kdcs map[int]string, b []byte) ([]byte, error) {
-	var errs []string
-	for i := 1; i <= len(kdcs); i++ {
-		udpAddr, err := net.ResolveUDPAddr("udp", kdcs[i])
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("error resolving KDC address: %v", err))
-			continue
+// dialSendUDP sends bytes to one of the KDCs via UDP.
+// KDC addresses that are the URL of a KDC proxy are skipped as a KDC proxy can only be used in place of TCP.
+func (cl *Client) dialSendUDP(ctx context.Context, realm string, kdcs map[int]string, b []byte) ([]byte, error) {
+	return cl.dialSend(ctx, "udp", realm, kdcs, b, func(ctx context.Context, addr string) ([]byte, error) {
+		if isKDCProxyURL(addr) {
+			return nil, fmt.Errorf("KDC proxy %s cannot be used over UDP", addr)
 		}
-
-		conn, err := net.DialTimeout("udp", udpAddr.String(), 5*time.Second)
+		conn, release, err := dialKDC(ctx, "udp", addr)
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("error setting dial timeout on connection to %s: %v", kdcs[i], err))
-			continue
-		}
-		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
-			errs = append(errs, fmt.Sprintf("error setting deadline on connection to %s: %v", kdcs[i], err))
-			continue
+			return nil, err
 		}
+		defer release()
 		// conn is guaranteed to be a UDPConn
 		rb, err := sendUDP(conn.(*net.UDPConn), b)
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("error sending to %s: %v", kdcs[i], err))
-			continue
+			return nil, fmt.Errorf("error sending to %s: %v", addr, err)
 		}
 		return rb, nil
+	})
+}
+
+// dialKDC connects to the KDC address. The connection's deadline is the deadline of the context, or five seconds from
+// now if it has none. If the context is done before the function returned is called the connection's deadline is
+// brought forward so that the exchange in progress ends. The function returned must be called once the exchange
+// completes.
+func dialKDC(ctx context.Context, network, addr string) (net.Conn, func(), error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error dialing %s: %v", addr, err)
 	}
-	return nil, fmt.Errorf("error sending to a KDC: %s", strings.Join(errs, "; "))
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultKDCTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("error setting deadline on connection to %s: %v", addr, err)
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return conn, func() { close(done) }, nil
 }
 
 // sendUDP sends bytes to connection over UDP.
@@ -120,7 +158,7 @@ func sendUDP(conn *net.UDPConn, b []byte) ([]byte, error) {
 	if err != nil {
 		return r, fmt.Errorf("error sending to (%s): %v", conn.RemoteAddr().String(), err)
 	}
-	udpbuf := make([]byte, 4096)
+	udpbuf := make([]byte, maxUDPResponseSize)
 	n, _, err := conn.ReadFrom(udpbuf)
 	r = udpbuf[:n]
 	if err != nil {
@@ -133,47 +171,38 @@ func sendUDP(conn *net.UDPConn, b []byte) ([]byte, error) {
 }
 
 // sendKDCTCP sends bytes to the KDC via TCP.
-func (cl *Client) sendKDCTCP(realm string, b []byte) ([]byte, error) {
+func (cl *Client) sendKDCTCP(ctx context.Context, realm string, b []byte) ([]byte, error) {
 	var r []byte
-	_, kdcs, err := cl.Config.GetKDCs(realm, true)
+	_, kdcs, err := cl.config().GetKDCs(realm, true)
 	if err != nil {
 		return r, err
 	}
-	r, err = dialSendTCP(kdcs, b)
+	r, err = cl.dialSendTCP(ctx, realm, kdcs, b)
 	if err != nil {
 		return r, err
 	}
 	return checkForKRBError(r)
 }
 
-// dialKDCTCP establishes a TCP connection to a KDC.
-func dialSendTCP(kdcs map[int]string, b []byte) ([]byte, error) {
-	var errs []string
-	for i := 1; i <= len(kdcs); i++ {
-		tcpAddr, err := net.ResolveTCPAddr("tcp", kdcs[i])
-		if err != nil {
-			errs = append(errs, fmt.Sprintf("error resolving KDC address: %v", err))
-			continue
+// dialSendTCP sends bytes to one of the KDCs via TCP.
+// KDC addresses that are the URL of a KDC proxy are sent the message over HTTPS.
+func (cl *Client) dialSendTCP(ctx context.Context, realm string, kdcs map[int]string, b []byte) ([]byte, error) {
+	return cl.dialSend(ctx, "tcp", realm, kdcs, b, func(ctx context.Context, addr string) ([]byte, error) {
+		if isKDCProxyURL(addr) {
+			return cl.sendKDCProxy(ctx, addr, realm, b)
 		}
-
-		conn, err := net.DialTimeout("tcp", tcpAddr.String(), 5*time.Second)
+		conn, release, err := dialKDC(ctx, "tcp", addr)
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("error setting dial timeout on connection to %s: %v", kdcs[i], err))
-			continue
-		}
-		if err := conn.SetDeadline(time.Now().Add(5 * time.Second)); err != nil {
-			errs = append(errs, fmt.Sprintf("error setting deadline on connection to %s: %v", kdcs[i], err))
-			continue
+			return nil, err
 		}
+		defer release()
 		// conn is guaranteed to be a TCPConn
 		rb, err := sendTCP(conn.(*net.TCPConn), b)
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("error sneding to %s: %v", kdcs[i], err))
-			continue
+			return nil, fmt.Errorf("error sending to %s: %v", addr, err)
 		}
 		return rb, nil
-	}
-	return nil, errors.New("error in getting a TCP connection to any of the KDCs")
+	})
 }
 
 // sendTCP sends bytes to connection over TCP.
@@ -189,21 +218,32 @@ func sendTCP(conn *net.TCPConn, b []byte) ([]byte, error) {
 	if err != nil {
 		return r, fmt.Errorf("error sending to KDC (%s): %v", conn.RemoteAddr().String(), err)
 	}
+	return readTCPMessage(conn)
+}
 
+// readTCPMessage reads a message framed with a 4 byte length prefix as specified in RFC 4120 7.2.2.
+// The prefix and message may be received across any number of reads.
+func readTCPMessage(r io.Reader) ([]byte, error) {
 	sh := make([]byte, 4, 4)
-	_, err = conn.Read(sh)
+	_, err := io.ReadFull(r, sh)
 	if err != nil {
-		return r, fmt.Errorf("error reading response size header: %v", err)
+		return nil, fmt.Errorf("error reading response size header: %v", err)
 	}
 	s := binary.BigEndian.Uint32(sh)
-
+	// The high bit of the length is reserved for extensions to the framing, which are not supported
+	if s&0x80000000 != 0 {
+		return nil, errors.New("response size header has the reserved high bit set")
+	}
+	if s < 1 {
+		return nil, errors.New("no response data from KDC")
+	}
+	if s > maxTCPResponseSize {
+		return nil, fmt.Errorf("response size %d exceeds the maximum of %d", s, maxTCPResponseSize)
+	}
 	rb := make([]byte, s, s)
-	_, err = io.ReadFull(conn, rb)
+	_, err = io.ReadFull(r, rb)
 	if err != nil {
-		return r, fmt.Errorf("error reading response: %v", err)
-	}
-	if len(rb) < 1 {
-		return r, fmt.Errorf("no response data from KDC %s", conn.RemoteAddr().String())
+		return nil, fmt.Errorf("error reading response: %v", err)
 	}
 	return rb, nil
 }
@@ -0,0 +1,137 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDialSendTCP_ContextCancelled(t *testing.T) {
+	t.Parallel()
+	// A KDC that accepts connections but never replies
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening: %v", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+	kdcs := map[int]string{1: l.Addr().String(), 2: l.Addr().String()}
+	cl := &Client{settings: NewSettings()}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	_, err = cl.dialSendTCP(ctx, "TEST.GOKRB5", kdcs, []byte{1, 2, 3})
+	assert.Equal(t, context.Canceled, err, "error not as expected when context cancelled")
+	assert.True(t, time.Since(start) < 2*time.Second, "exchange not ended when context cancelled")
+
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	_, err = cl.dialSendTCP(ctx, "TEST.GOKRB5", kdcs, []byte{1, 2, 3})
+	assert.Equal(t, context.DeadlineExceeded, err, "error not as expected when context deadline exceeded")
+	assert.True(t, time.Since(start) < 2*time.Second, "exchange not ended at context deadline")
+}
+
+func TestReadTCPMessage(t *testing.T) {
+	t.Parallel()
+	msg := bytes.Repeat([]byte{0x6b}, 70000)
+	b := make([]byte, 4, 4+len(msg))
+	binary.BigEndian.PutUint32(b, uint32(len(msg)))
+	b = append(b, msg...)
+	// Reading a byte at a time exercises a size header and message split across reads
+	rb, err := readTCPMessage(iotest.OneByteReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatalf("error reading message: %v", err)
+	}
+	assert.Equal(t, msg, rb, "message not as expected")
+
+	_, err = readTCPMessage(bytes.NewReader(b[:1000]))
+	assert.Error(t, err, "truncated message should fail")
+	_, err = readTCPMessage(bytes.NewReader([]byte{0x80, 0, 0, 1, 0}))
+	assert.Error(t, err, "reserved high bit in size header should fail")
+	_, err = readTCPMessage(bytes.NewReader([]byte{0, 0, 0, 0}))
+	assert.Error(t, err, "empty message should fail")
+}
+
+func TestClient_sendToKDC_ResponseTooBig(t *testing.T) {
+	t.Parallel()
+	// A KDC that replies KRB_ERR_RESPONSE_TOO_BIG over UDP and with the full reply over TCP
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	defer l.Close()
+	pc, err := net.ListenPacket("udp", l.Addr().String())
+	if err != nil {
+		t.Skipf("could not listen on UDP at %s: %v", l.Addr().String(), err)
+	}
+	defer pc.Close()
+	tooBig := messages.NewKRBError(types.PrincipalName{}, "TEST.GOKRB5", errorcode.KRB_ERR_RESPONSE_TOO_BIG, "")
+	tb, err := tooBig.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRBError: %v", err)
+	}
+	go func() {
+		buf := make([]byte, 4096)
+		for {
+			_, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			pc.WriteTo(tb, addr)
+		}
+	}()
+	reply := bytes.Repeat([]byte{0x6b}, 10000)
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			if _, err := readTCPMessage(c); err == nil {
+				hb := make([]byte, 4)
+				binary.BigEndian.PutUint32(hb, uint32(len(reply)))
+				// Send the reply in pieces
+				c.Write(hb[:2])
+				c.Write(hb[2:])
+				c.Write(reply[:5000])
+				c.Write(reply[5000:])
+			}
+			c.Close()
+		}
+	}()
+
+	c, err := config.NewFromString(fmt.Sprintf("[libdefaults]\n default_realm = TEST.GOKRB5\n[realms]\n TEST.GOKRB5 = {\n  kdc = %s\n }\n", l.Addr().String()))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+	cl := &Client{Config: c, settings: NewSettings()}
+	rb, err := cl.sendToKDC(context.Background(), []byte{1, 2, 3}, "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("error sending to KDC: %v", err)
+	}
+	assert.Equal(t, reply, rb, "reply not retried over TCP")
+}
@@ -0,0 +1,119 @@
+package client
+
+import (
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// OTPChallenge is the KDC's request for a one-time password, describing the tokens the KDC accepts.
+type OTPChallenge struct {
+	// Service names the service the one-time password is for, if the KDC provided one, to show to the user.
+	Service string
+	// Tokens the KDC accepts a one-time password from.
+	Tokens []messages.OTPTokenInfo
+}
+
+// OTPResponse is the one-time password to pre-authenticate with.
+type OTPResponse struct {
+	// Token is the index in the challenge's tokens of the token the one-time password is from.
+	Token int
+	// Value is the one-time password.
+	Value string
+	// PIN is the token's PIN, if the token requires it to be sent separately from the one-time password.
+	PIN string
+}
+
+// OTPPrompter obtains the one-time password to pre-authenticate with, for example by prompting the user for it or
+// fetching it from a token system.
+type OTPPrompter interface {
+	PromptOTP(c OTPChallenge) (OTPResponse, error)
+}
+
+// OTPPromptFunc is a function that can be used as an OTPPrompter.
+type OTPPromptFunc func(c OTPChallenge) (OTPResponse, error)
+
+// PromptOTP calls f(c).
+func (f OTPPromptFunc) PromptOTP(c OTPChallenge) (OTPResponse, error) {
+	return f(c)
+}
+
+// NewWithOTP creates a new client that pre-authenticates with one-time passwords (RFC 6560) obtained from the
+// prompter. OTP pre-authentication is carried within FAST so the client must also be given a FAST armor client:
+//
+// cl := NewWithOTP(username, realm, prompter, cfg, FASTArmor(armor))
+func NewWithOTP(username, realm string, p OTPPrompter, krb5conf *config.Config, settings ...func(*Settings)) *Client {
+	return &Client{
+		Credentials: credentials.New(username, realm),
+		Config:      krb5conf,
+		settings:    NewSettings(append(settings, OTP(p))...),
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		cache: NewCache(),
+	}
+}
+
+// otpEnabled indicates if the client can pre-authenticate AS exchanges with one-time passwords.
+func (cl *Client) otpEnabled() bool {
+	return cl.settings.OTP() != nil
+}
+
+// otpPreAuth pre-authenticates an exchange armored with FAST with a one-time password. The reply is encrypted with
+// the armor key in place of the client's long-term key.
+type otpPreAuth struct{}
+
+func newOTPPreAuth(ex *PreAuthExchange) (PreAuthenticator, bool) {
+	if !ex.Armored() || !ex.Client.otpEnabled() {
+		return nil, false
+	}
+	return otpPreAuth{}, true
+}
+
+// PAData returns the PA-OTP-REQUEST pre-authentication data in response to the KDC's PA-OTP-CHALLENGE. OTP
+// pre-authentication is never pre-emptive as the KDC's challenge is needed.
+func (otpPreAuth) PAData(ex *PreAuthExchange, hints *messages.PreAuthHints) (types.PADataSequence, error) {
+	if hints == nil || hints.OTPChallenge == nil {
+		return nil, nil
+	}
+	c := hints.OTPChallenge
+	if len(c.TokenInfo) < 1 {
+		return nil, krberror.NewErrorf(krberror.KRBMsgError, "KDC's OTP challenge does not include any tokens")
+	}
+	r, err := ex.Client.settings.OTP().PromptOTP(OTPChallenge{
+		Service: c.Service,
+		Tokens:  c.TokenInfo,
+	})
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "error getting one-time password")
+	}
+	if r.Token < 0 || r.Token >= len(c.TokenInfo) {
+		return nil, krberror.NewErrorf(krberror.KRBMsgError, "one-time password is for token %d but the KDC's challenge has %d", r.Token, len(c.TokenInfo))
+	}
+	info := c.TokenInfo[r.Token]
+	armorKey, _ := ex.ArmorKey()
+	req, err := messages.NewPAOTPRequest(c.Nonce, armorKey, []byte(r.Value))
+	if err != nil {
+		return nil, err
+	}
+	if types.IsFlagSet(&info.Flags, messages.OTPFlagNextOTP) {
+		types.SetFlag(&req.Flags, messages.OTPFlagNextOTP)
+	}
+	req.PIN = r.PIN
+	req.TokenID = info.TokenID
+	req.Vendor = info.Vendor
+	req.AlgID = info.AlgID
+	pa, err := req.PAData()
+	if err != nil {
+		return nil, err
+	}
+	return types.PADataSequence{pa}, nil
+}
+
+// ReplyKey returns the FAST armor key, which the KDC replaces the reply key with.
+func (otpPreAuth) ReplyKey(ex *PreAuthExchange, asRep messages.ASRep, pas types.PADataSequence) (types.EncryptionKey, error) {
+	key, _ := ex.ArmorKey()
+	return key, nil
+}
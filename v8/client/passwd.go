@@ -1,10 +1,14 @@
 package client
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
 	"github.com/Osirium/gokrb5/v8/kadmin"
 	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
 )
 
 // Kpasswd server response codes.
@@ -17,40 +21,200 @@ const (
 	KRB5_KPASSWD_ACCESSDENIED        = 5
 	KRB5_KPASSWD_BAD_VERSION         = 6
 	KRB5_KPASSWD_INITIAL_FLAG_NEEDED = 7
+	KRB5_KPASSWD_POLICY_REJECT       = 8
 )
 
+// kpasswdResults maps the kpasswd server response codes to a description of the result.
+var kpasswdResults = map[uint16]string{
+	KRB5_KPASSWD_SUCCESS:             "success",
+	KRB5_KPASSWD_MALFORMED:           "request fails basic length checks",
+	KRB5_KPASSWD_HARDERROR:           "server error",
+	KRB5_KPASSWD_AUTHERROR:           "authentication error",
+	KRB5_KPASSWD_SOFTERROR:           "password change rejected",
+	KRB5_KPASSWD_ACCESSDENIED:        "not authorized",
+	KRB5_KPASSWD_BAD_VERSION:         "unknown protocol version",
+	KRB5_KPASSWD_INITIAL_FLAG_NEEDED: "initial ticket required",
+	KRB5_KPASSWD_POLICY_REJECT:       "password rejected by policy",
+}
+
+// KPasswdError is returned when the kpasswd server does not accept a password change.
+type KPasswdError struct {
+	// Code is the result code of the kpasswd server's reply.
+	Code uint16
+	// Result is the result string of the kpasswd server's reply.
+	Result string
+	// Policy is the Active Directory password policy the new password failed to meet, if the server provided it.
+	Policy kadmin.ADPasswordPolicy
+	// ADPolicy indicates if Policy holds the password policy returned by Active Directory.
+	ADPolicy bool
+}
+
+// Error implements the error interface.
+func (e KPasswdError) Error() string {
+	d, ok := kpasswdResults[e.Code]
+	if !ok {
+		d = "unknown result code"
+	}
+	if e.ADPolicy {
+		p := e.Policy
+		return fmt.Sprintf("kpasswd error (%d): %s: password must be at least %d characters, not match the last %d passwords and meet complexity requirements: %t",
+			e.Code, d, p.MinLength, p.History, p.Complex())
+	}
+	if e.Result != "" {
+		return fmt.Sprintf("kpasswd error (%d): %s: %s", e.Code, d, e.Result)
+	}
+	return fmt.Sprintf("kpasswd error (%d): %s", e.Code, d)
+}
+
+// newKPasswdError returns the error for a kpasswd reply that is not successful.
+func newKPasswdError(r kadmin.Reply) KPasswdError {
+	e := KPasswdError{
+		Code:   r.ResultCode,
+		Result: r.Result,
+	}
+	// Active Directory returns its password policy as a binary result string
+	if p, ok := r.ADPolicy(); ok {
+		e.Policy = p
+		e.ADPolicy = true
+		e.Result = ""
+	}
+	return e
+}
+
 // ChangePasswd changes the password of the client to the value provided.
 func (cl *Client) ChangePasswd(newPasswd string) (bool, error) {
-	ASReq, err := messages.NewASReqForChgPasswd(cl.Credentials.Domain(), cl.Config, cl.Credentials.CName())
-	if err != nil {
+	return cl.ChangePasswdContext(context.Background(), newPasswd)
+}
+
+// ChangePasswdContext changes the password of the client to the value provided.
+// The context provided can be used to cancel the change or set a deadline for it.
+func (cl *Client) ChangePasswdContext(ctx context.Context, newPasswd string) (bool, error) {
+	if err := cl.changePasswd(ctx, newPasswd); err != nil {
 		return false, err
 	}
-	ASRep, err := cl.ASExchange(cl.Credentials.Domain(), ASReq, 0)
+	cl.updateCreds(func(c *credentials.Credentials) {
+		c.WithPassword(newPasswd)
+	})
+	return true, nil
+}
+
+// changePasswd sends the password change request to the kpasswd server.
+func (cl *Client) changePasswd(ctx context.Context, newPasswd string) error {
+	c := cl.Creds()
+	ASReq, err := messages.NewASReqForChgPasswd(c.Domain(), cl.config(), c.CName())
+	if err != nil {
+		return err
+	}
+	ASRep, err := cl.ASExchangeContext(ctx, c.Domain(), ASReq, 0)
 	if err != nil {
-		return false, err
+		return err
 	}
 
-	msg, key, err := kadmin.ChangePasswdMsg(cl.Credentials.CName(), cl.Credentials.Domain(), newPasswd, ASRep.Ticket, ASRep.DecryptedEncPart.Key)
+	msg, key, err := kadmin.ChangePasswdMsg(c.CName(), c.Domain(), newPasswd, ASRep.Ticket, ASRep.DecryptedEncPart.Key)
 	if err != nil {
-		return false, err
+		return err
+	}
+	return cl.kpasswdExchange(ctx, c.Domain(), msg, key)
+}
+
+// ChangePassword changes the password of the client's principal from the old password to the new one. The client
+// need not have been created with a password; the old password is used to obtain the initial ticket for the kpasswd
+// service. If the client has password credentials they are updated to the new password.
+func (cl *Client) ChangePassword(oldPasswd, newPasswd string) error {
+	return cl.ChangePasswordContext(context.Background(), oldPasswd, newPasswd)
+}
+
+// ChangePasswordContext changes the password of the client's principal, as ChangePassword does.
+// The context provided can be used to cancel the change or set a deadline for it.
+func (cl *Client) ChangePasswordContext(ctx context.Context, oldPasswd, newPasswd string) error {
+	current := cl.Creds()
+	creds := credentials.New(current.UserName(), current.Domain())
+	c := &Client{
+		Credentials: creds.WithPassword(oldPasswd),
+		Config:      cl.Config,
+		settings:    cl.settings,
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		cache: NewCache(),
+	}
+	if err := c.changePasswd(ctx, newPasswd); err != nil {
+		return err
 	}
-	r, err := cl.sendToKPasswd(msg)
+	if current.HasPassword() {
+		cl.updateCreds(func(c *credentials.Credentials) {
+			c.WithPassword(newPasswd)
+		})
+	}
+	return nil
+}
+
+// SetPassword sets the password of the target principal to the value provided, using the set password protocol
+// (RFC 3244). The client's principal must be authorized by the KDC to set the target's password, for example an
+// administrator of the realm.
+// Target format: <NAME>@<REALM> Eg. jsmith@EXAMPLE.COM; the realm defaults to the client's realm if not included.
+func (cl *Client) SetPassword(target, newPasswd string) error {
+	return cl.SetPasswordContext(context.Background(), target, newPasswd)
+}
+
+// SetPasswordContext sets the password of the target principal, as SetPassword does.
+// The context provided can be used to cancel the change or set a deadline for it.
+func (cl *Client) SetPasswordContext(ctx context.Context, target, newPasswd string) error {
+	current := cl.Creds()
+	targName, targRealm := types.ParseSPNString(target)
+	if targRealm == "" {
+		targRealm = current.Domain()
+	}
+	tgt, skey, err := cl.sessionTGT(ctx, targRealm)
 	if err != nil {
-		return false, err
+		return err
+	}
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_SRV_INST,
+		NameString: []string{"kadmin", "changepw"},
+	}
+	_, tgsRep, err := cl.TGSREQGenerateAndExchangeContext(ctx, sname, targRealm, tgt, skey, false)
+	if err != nil {
+		return err
+	}
+	msg, key, err := kadmin.SetPasswdMsg(current.CName(), current.Domain(), targName, targRealm, newPasswd,
+		tgsRep.Ticket, tgsRep.DecryptedEncPart.Key)
+	if err != nil {
+		return err
+	}
+	if err = cl.kpasswdExchange(ctx, targRealm, msg, key); err != nil {
+		return err
+	}
+	if targName.Equal(current.CName()) && targRealm == current.Domain() && current.HasPassword() {
+		cl.updateCreds(func(c *credentials.Credentials) {
+			c.WithPassword(newPasswd)
+		})
+	}
+	return nil
+}
+
+// kpasswdExchange sends the request to the realm's kpasswd server and checks the result of the reply.
+func (cl *Client) kpasswdExchange(ctx context.Context, realm string, msg kadmin.Request, key types.EncryptionKey) error {
+	r, err := cl.sendToKPasswd(ctx, realm, msg)
+	if err != nil {
+		return err
+	}
+	if r.IsKRBError && r.ResultCode != KRB5_KPASSWD_SUCCESS {
+		// The server could not process the request and returned the result within a KRB_ERROR
+		return newKPasswdError(r)
 	}
 	err = r.Decrypt(key)
 	if err != nil {
-		return false, err
+		return err
 	}
 	if r.ResultCode != KRB5_KPASSWD_SUCCESS {
-		return false, fmt.Errorf("error response from kadmin: code: %d; result: %s; krberror: %v", r.ResultCode, r.Result, r.KRBError)
+		return newKPasswdError(r)
 	}
-	cl.Credentials.WithPassword(newPasswd)
-	return true, nil
+	return nil
 }
 
-func (cl *Client) sendToKPasswd(msg kadmin.Request) (r kadmin.Reply, err error) {
-	_, kps, err := cl.Config.GetKpasswdServers(cl.Credentials.Domain(), true)
+func (cl *Client) sendToKPasswd(ctx context.Context, realm string, msg kadmin.Request) (r kadmin.Reply, err error) {
+	_, kps, err := cl.config().GetKpasswdServers(realm, true)
 	if err != nil {
 		return
 	}
@@ -59,13 +223,13 @@ func (cl *Client) sendToKPasswd(msg kadmin.Request) (r kadmin.Reply, err error)
 		return
 	}
 	var rb []byte
-	if len(b) <= cl.Config.LibDefaults.UDPPreferenceLimit {
-		rb, err = dialSendUDP(kps, b)
+	if len(b) <= cl.config().LibDefaults.UDPPreferenceLimit && !hasKDCProxyURL(kps) {
+		rb, err = cl.dialSendUDP(ctx, realm, kps, b)
 		if err != nil {
 			return
 		}
 	} else {
-		rb, err = dialSendTCP(kps, b)
+		rb, err = cl.dialSendTCP(ctx, realm, kps, b)
 		if err != nil {
 			return
 		}
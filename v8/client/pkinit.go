@@ -0,0 +1,112 @@
+package client
+
+import (
+	"crypto"
+	"crypto/x509"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/pkinit"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// NewWithCertificate creates a new client that pre-authenticates with a certificate and its private key using PKINIT.
+// The key only needs to implement crypto.Signer so keys held in an HSM, TPM or PKCS #11 token can be used.
+// Use the PKINITAnchors and PKINITIntermediates settings to configure trust in the KDC's certificate.
+func NewWithCertificate(username, realm string, cert *x509.Certificate, key crypto.Signer, krb5conf *config.Config, settings ...func(*Settings)) *Client {
+	return &Client{
+		Credentials: credentials.New(username, realm),
+		Config:      krb5conf,
+		settings:    NewSettings(append(settings, PKINIT(cert, key))...),
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		cache: NewCache(),
+	}
+}
+
+// NewAnonymous creates a new client that obtains anonymous TGTs for the realm using anonymous PKINIT (RFC 8062).
+// Only the KDC's certificate, or the root it chains to, is needed in the PKINIT anchors. The anonymous client is
+// typically used to armor the FAST exchanges of another client on hosts that do not have a keytab:
+//
+// armor := NewAnonymous(realm, cfg, PKINITAnchors(kdcRoots))
+// cl := NewWithPassword(username, realm, password, cfg, FASTArmor(armor))
+func NewAnonymous(realm string, krb5conf *config.Config, settings ...func(*Settings)) *Client {
+	cname := types.NewAnonymousPrincipalName()
+	creds := credentials.New(cname.PrincipalNameString(), realm)
+	creds.SetCName(cname)
+	cl := &Client{
+		Credentials: creds,
+		Config:      krb5conf,
+		settings:    NewSettings(settings...),
+		sessions: &sessions{
+			Entries: make(map[string]*session),
+		},
+		cache: NewCache(),
+	}
+	cl.settings.anonymous = true
+	return cl
+}
+
+// pkinitEnabled indicates if the client pre-authenticates AS exchanges with PKINIT.
+func (cl *Client) pkinitEnabled() bool {
+	cert, key := cl.settings.PKINIT()
+	return (cert != nil && key != nil) || cl.settings.anonymous
+}
+
+// pkinitPreAuth pre-authenticates with PKINIT. The reply key is agreed with Diffie-Hellman or, if configured,
+// encrypted to the client's certificate by the KDC. PKINIT exchanges are not armored with FAST.
+type pkinitPreAuth struct {
+	request *pkinit.Request
+}
+
+func newPKINITPreAuth(ex *PreAuthExchange) (PreAuthenticator, bool) {
+	if ex.Armored() || !ex.Client.pkinitEnabled() {
+		return nil, false
+	}
+	return &pkinitPreAuth{}, true
+}
+
+// PAData returns the PA-PK-AS-REQ pre-authentication data. PKINIT always pre-authenticates pre-emptively.
+func (p *pkinitPreAuth) PAData(ex *PreAuthExchange, hints *messages.PreAuthHints) (types.PADataSequence, error) {
+	cl := ex.Client
+	var pa types.PAData
+	var err error
+	if cl.settings.anonymous {
+		types.SetFlag(&ex.ASReq.ReqBody.KDCOptions, flags.RequestAnonymous)
+		p.request, pa, err = pkinit.NewAnonymousRequest(ex.ASReq.ReqBody, cl.Creds().KDCOffset())
+	} else {
+		cert, key := cl.settings.PKINIT()
+		p.request, pa, err = pkinit.NewRequest(ex.ASReq.ReqBody, cert, key, cl.settings.PKINITIntermediates(),
+			cl.settings.PKINITKeyTransport(), cl.Creds().KDCOffset())
+	}
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.KRBMsgError, "failed creating PKINIT pre-authentication")
+	}
+	for _, r := range cl.config().Realms {
+		if r.Realm == ex.ASReq.ReqBody.Realm {
+			p.request.SetKDCHostnames(r.PKINITKDCHostname...)
+		}
+	}
+	return types.PADataSequence{pa}, nil
+}
+
+// ReplyKey verifies the KDC's PKINIT response and returns the reply key it establishes.
+func (p *pkinitPreAuth) ReplyKey(ex *PreAuthExchange, asRep messages.ASRep, pas types.PADataSequence) (types.EncryptionKey, error) {
+	cl := ex.Client
+	intermediates := x509.NewCertPool()
+	for _, c := range cl.settings.PKINITIntermediates() {
+		intermediates.AddCert(c)
+	}
+	key, err := p.request.ReplyKey(*ex.ASReq, asRep, x509.VerifyOptions{
+		Roots:         cl.settings.PKINITAnchors(),
+		Intermediates: intermediates,
+	})
+	if err != nil {
+		return key, krberror.Errorf(err, krberror.KRBMsgError, "invalid PKINIT response in AS_REP")
+	}
+	return key, nil
+}
@@ -0,0 +1,303 @@
+package client
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	stdasn1 "encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	krbcrypto "github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/pkinit"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+)
+
+// pkinitKDC is a KDC that requires PKINIT pre-authentication using Diffie-Hellman, signed by the client unless
+// anonymous.
+type pkinitKDC struct {
+	kt      *keytab.Keytab
+	roots   *x509.CertPool
+	cert    *x509.Certificate
+	key     crypto.Signer
+	session types.EncryptionKey
+	mux     sync.Mutex
+}
+
+func newTestCert(t *testing.T, tmpl, parent *x509.Certificate, parentKey crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	if parent == nil {
+		parent, parentKey = tmpl, key
+	}
+	tmpl.NotBefore = time.Now().Add(-time.Hour)
+	tmpl.NotAfter = time.Now().Add(time.Hour)
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, parent, key.Public(), parentKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	return cert, key
+}
+
+func (k *pkinitKDC) serve(l net.Listener) {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return
+		}
+		b, err := readTCPMessage(c)
+		if err == nil {
+			var asReq messages.ASReq
+			var rb []byte
+			if err = asReq.Unmarshal(b); err == nil {
+				rb, err = k.as(asReq)
+			}
+			if err == nil {
+				c.Write(tcpFrame(rb))
+			}
+		}
+		c.Close()
+	}
+}
+
+func (k *pkinitKDC) sessionKey() types.EncryptionKey {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	return k.session
+}
+
+func (k *pkinitKDC) as(asReq messages.ASReq) ([]byte, error) {
+	var req pkinit.PAPKASReq
+	for _, pa := range asReq.PAData {
+		if pa.PADataType == patype.PA_PK_AS_REQ {
+			if err := req.Unmarshal(pa.PADataValue); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if req.SignedAuthPack == nil {
+		return nil, errors.New("request is not pre-authenticated with PKINIT")
+	}
+	sd, err := pkinit.ParseSignedData(req.SignedAuthPack)
+	if err != nil {
+		return nil, err
+	}
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "user")
+	crealm := fastTestRealm
+	tktFlags := types.NewKrbFlags()
+	if types.IsFlagSet(&asReq.ReqBody.KDCOptions, flags.RequestAnonymous) {
+		if !asReq.ReqBody.CName.IsAnonymous() {
+			return nil, errors.New("anonymous request is not for the anonymous principal")
+		}
+		cname, crealm = types.NewAnonymousPrincipalName(), types.AnonymousRealm
+		types.SetFlag(&tktFlags, flags.Anonymous)
+	} else if _, err := sd.Verify(x509.VerifyOptions{Roots: k.roots}); err != nil {
+		return nil, err
+	}
+	var ap pkinit.AuthPack
+	if _, err := asn1.Unmarshal(sd.Content, &ap); err != nil {
+		return nil, err
+	}
+	if ap.PKAuthenticator.Nonce != asReq.ReqBody.Nonce {
+		return nil, errors.New("AuthPack nonce does not match the request")
+	}
+	dh, err := pkinit.NewDHKey()
+	if err != nil {
+		return nil, err
+	}
+	z, err := dh.SharedSecret(ap.ClientPublicValue.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := dh.PublicValue()
+	if err != nil {
+		return nil, err
+	}
+	kib, err := asn1.Marshal(pkinit.KDCDHKeyInfo{SubjectPublicKey: pub, Nonce: ap.PKAuthenticator.Nonce})
+	if err != nil {
+		return nil, err
+	}
+	dhsd, err := pkinit.NewSignedData(pkinit.OIDDHKeyData, kib, k.cert, k.key, nil)
+	if err != nil {
+		return nil, err
+	}
+	rep := pkinit.PAPKASRep{DHInfo: pkinit.DHRepInfo{DHSignedData: dhsd}}
+	rpb, err := rep.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	replyKey, err := pkinit.OctetString2Key(z, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	tkt, skey, err := messages.NewTicket(cname, crealm, asReq.ReqBody.SName, fastTestRealm, tktFlags, k.kt, etypeID.AES256_CTS_HMAC_SHA1_96, 1, now, now, now.Add(time.Hour), now.Add(time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	k.mux.Lock()
+	k.session = skey
+	k.mux.Unlock()
+	dep := messages.EncKDCRepPart{
+		Key:       skey,
+		LastReqs:  []messages.LastReq{},
+		Nonce:     asReq.ReqBody.Nonce,
+		Flags:     tktFlags,
+		AuthTime:  now,
+		StartTime: now,
+		EndTime:   now.Add(time.Hour),
+		RenewTill: now.Add(time.Hour),
+		SRealm:    fastTestRealm,
+		SName:     asReq.ReqBody.SName,
+	}
+	db, err := dep.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	ed, err := krbcrypto.GetEncryptedData(db, replyKey, keyusage.AS_REP_ENCPART, 0)
+	if err != nil {
+		return nil, err
+	}
+	r := messages.ASRep{KDCRepFields: messages.KDCRepFields{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_AS_REP,
+		PAData:  types.PADataSequence{{PADataType: patype.PA_PK_AS_REP, PADataValue: rpb}},
+		CRealm:  crealm,
+		CName:   cname,
+		Ticket:  tkt,
+		EncPart: ed,
+	}}
+	return r.Marshal()
+}
+
+func newTestPKINITKDC(t *testing.T, kt *keytab.Keytab) (kdc *pkinitKDC, clientCert *x509.Certificate, clientKey crypto.Signer) {
+	ca, caKey := newTestCert(t, &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}, nil, nil)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	kdcCert, kdcKey := newTestCert(t, &x509.Certificate{
+		SerialNumber:       big.NewInt(2),
+		Subject:            pkix.Name{CommonName: "kdc.test.gokrb5"},
+		DNSNames:           []string{"kdc.test.gokrb5"},
+		UnknownExtKeyUsage: []stdasn1.ObjectIdentifier{stdasn1.ObjectIdentifier(pkinit.OIDKPKdc)},
+	}, ca, caKey)
+	clientCert, clientKey = newTestCert(t, &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: "user"},
+	}, ca, caKey)
+	return &pkinitKDC{kt: kt, roots: roots, cert: kdcCert, key: kdcKey}, clientCert, clientKey
+}
+
+func testKDCConfig(t *testing.T, addr string) *config.Config {
+	c, err := config.NewFromString(fmt.Sprintf("[libdefaults]\n default_realm = %s\n udp_preference_limit = 1\n[realms]\n %s = {\n  kdc = %s\n  pkinit_kdc_hostname = kdc.test.gokrb5\n }\n", fastTestRealm, fastTestRealm, addr))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+	return c
+}
+
+func TestClient_PKINIT(t *testing.T) {
+	t.Parallel()
+	kt := keytab.New()
+	if err := kt.AddEntry("krbtgt/"+fastTestRealm, fastTestRealm, "secret", time.Now(), 1, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("error adding keytab entry: %v", err)
+	}
+	kdc, clientCert, clientKey := newTestPKINITKDC(t, kt)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	defer l.Close()
+	go kdc.serve(l)
+	c := testKDCConfig(t, l.Addr().String())
+
+	cl := NewWithCertificate("user", fastTestRealm, clientCert, clientKey, c, PKINITAnchors(kdc.roots))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in with PKINIT: %v", err)
+	}
+	_, skey, err := cl.sessionTGT(context.Background(), fastTestRealm)
+	if err != nil {
+		t.Fatalf("error getting TGT: %v", err)
+	}
+	assert.Equal(t, kdc.sessionKey(), skey, "TGT session key not as issued by the KDC")
+
+	// The KDC's certificate must chain to the anchors configured
+	cl = NewWithCertificate("user", fastTestRealm, clientCert, clientKey, c, PKINITAnchors(x509.NewCertPool()))
+	err = cl.Login()
+	if assert.Error(t, err, "login with an untrusted KDC certificate should fail") {
+		assert.Contains(t, err.Error(), "invalid PKINIT response", "error not as expected")
+	}
+}
+
+func TestClient_AnonymousPKINIT(t *testing.T) {
+	t.Parallel()
+	fastKDC := newFASTKDC(t)
+	kdc, _, _ := newTestPKINITKDC(t, fastKDC.kt)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	defer l.Close()
+	go kdc.serve(l)
+
+	// Only the KDC's certificate is trusted
+	anchors := x509.NewCertPool()
+	anchors.AddCert(kdc.cert)
+	armor := NewAnonymous(fastTestRealm, testKDCConfig(t, l.Addr().String()), PKINITAnchors(anchors))
+	err = armor.Login()
+	if err != nil {
+		t.Fatalf("error logging in with anonymous PKINIT: %v", err)
+	}
+	tgt, skey, err := armor.sessionTGT(context.Background(), fastTestRealm)
+	if err != nil {
+		t.Fatalf("error getting TGT: %v", err)
+	}
+	assert.Equal(t, kdc.sessionKey(), skey, "TGT session key not as issued by the KDC")
+	assert.Equal(t, "krbtgt/"+fastTestRealm, tgt.SName.PrincipalNameString(), "TGT not as expected")
+
+	// The anonymous TGT armors the FAST exchanges of a client without a keytab
+	fl, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("error listening on TCP: %v", err)
+	}
+	defer fl.Close()
+	go fastKDC.serve(fl)
+	cl := NewWithPassword("user", fastTestRealm, "passwd", testKDCConfig(t, fl.Addr().String()), FASTArmor(armor))
+	err = cl.Login()
+	if err != nil {
+		t.Fatalf("error logging in with FAST armored by an anonymous TGT: %v", err)
+	}
+}
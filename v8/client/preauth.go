@@ -0,0 +1,252 @@
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/crypto/etype"
+	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// maxPreAuthAttempts is the maximum number of AS_REQs sent in an AS exchange while negotiating pre-authentication.
+const maxPreAuthAttempts = 5
+
+// PreAuthenticator performs a pre-authentication mechanism in an AS exchange. A new PreAuthenticator is created for
+// each exchange so it can hold the state needed to process the KDC's reply.
+type PreAuthenticator interface {
+	// PAData returns the pre-authentication data to include in the AS_REQ. The hints are the pre-authentication data
+	// the KDC returned with its last error, or nil for pre-emptive pre-authentication. Returning no pre-authentication
+	// data without hints defers the mechanism until the KDC requests pre-authentication.
+	PAData(ex *PreAuthExchange, hints *messages.PreAuthHints) (types.PADataSequence, error)
+	// ReplyKey returns the key the AS_REP is encrypted with. The pre-authentication data provided is that of the FAST
+	// response if the exchange is armored, otherwise that of the AS_REP.
+	ReplyKey(ex *PreAuthExchange, asRep messages.ASRep, pas types.PADataSequence) (types.EncryptionKey, error)
+}
+
+// PreAuthMechanism creates the PreAuthenticator for an AS exchange. It returns false if the mechanism cannot be used
+// in the exchange, for example if the client does not have the credentials the mechanism needs.
+type PreAuthMechanism func(ex *PreAuthExchange) (PreAuthenticator, bool)
+
+// PreAuthExchange is the AS exchange a pre-authentication mechanism takes part in.
+type PreAuthExchange struct {
+	Client *Client
+	Realm  string
+	ASReq  *messages.ASReq
+	fast   *fastExchange
+}
+
+// Armored indicates if the exchange is armored with FAST. Pre-authentication data is then carried within the FAST
+// request, protected by the armor key.
+func (ex *PreAuthExchange) Armored() bool {
+	return ex.fast != nil
+}
+
+// ArmorKey returns the FAST armor key of the exchange, if it is armored.
+func (ex *PreAuthExchange) ArmorKey() (types.EncryptionKey, bool) {
+	if ex.fast == nil {
+		return types.EncryptionKey{}, false
+	}
+	return ex.fast.armorKey, true
+}
+
+// preAuthRegistry holds the pre-authentication mechanisms available to clients and their default preference order.
+var preAuthRegistry = struct {
+	mux        sync.RWMutex
+	mechanisms map[int32]PreAuthMechanism
+	order      []int32
+}{
+	mechanisms: make(map[int32]PreAuthMechanism),
+}
+
+func init() {
+	RegisterPreAuth(patype.PA_PK_AS_REQ, newPKINITPreAuth)
+	RegisterPreAuth(patype.PA_ENCRYPTED_CHALLENGE, newEncChallengePreAuth)
+	RegisterPreAuth(patype.PA_ENC_TIMESTAMP, newEncTimestampPreAuth)
+	RegisterPreAuth(patype.PA_OTP_CHALLENGE, newOTPPreAuth)
+}
+
+// RegisterPreAuth registers a pre-authentication mechanism for the pre-authentication type the KDC requests it with.
+// A mechanism registered for a new type is added to the end of the default preference order; registering a type
+// again replaces its mechanism. Use the PreAuthTypes setting to change the preference order for a client.
+func RegisterPreAuth(paType int32, m PreAuthMechanism) {
+	preAuthRegistry.mux.Lock()
+	defer preAuthRegistry.mux.Unlock()
+	if _, ok := preAuthRegistry.mechanisms[paType]; !ok {
+		preAuthRegistry.order = append(preAuthRegistry.order, paType)
+	}
+	preAuthRegistry.mechanisms[paType] = m
+}
+
+// preAuthMechanism returns the mechanism registered for the pre-authentication type.
+func preAuthMechanism(paType int32) (PreAuthMechanism, bool) {
+	preAuthRegistry.mux.RLock()
+	defer preAuthRegistry.mux.RUnlock()
+	m, ok := preAuthRegistry.mechanisms[paType]
+	return m, ok
+}
+
+// defaultPreAuthTypes returns the pre-authentication types registered in their default preference order.
+func defaultPreAuthTypes() []int32 {
+	preAuthRegistry.mux.RLock()
+	defer preAuthRegistry.mux.RUnlock()
+	t := make([]int32, len(preAuthRegistry.order))
+	copy(t, preAuthRegistry.order)
+	return t
+}
+
+// preAuth is a pre-authenticator available in an exchange and the pre-authentication type it is registered for.
+type preAuth struct {
+	paType int32
+	PreAuthenticator
+}
+
+// preAuthenticators returns the pre-authenticators the client can use in the exchange in order of preference.
+func (ex *PreAuthExchange) preAuthenticators() []preAuth {
+	var p []preAuth
+	for _, t := range ex.Client.settings.PreAuthTypes() {
+		m, ok := preAuthMechanism(t)
+		if !ok {
+			continue
+		}
+		if a, ok := m(ex); ok {
+			p = append(p, preAuth{paType: t, PreAuthenticator: a})
+		}
+	}
+	return p
+}
+
+// preAuthNegotiation tracks the pre-authentication mechanisms used through an AS exchange.
+type preAuthNegotiation struct {
+	available []preAuth
+	// current is the mechanism whose pre-authentication data was sent in the last request, if any
+	current *preAuth
+	// responded records the mechanisms that have responded to the KDC's hints
+	responded map[int32]bool
+}
+
+// preemptive returns the pre-authentication data of the first mechanism that pre-authenticates before the KDC
+// requests it.
+func (n *preAuthNegotiation) preemptive(ex *PreAuthExchange) (types.PADataSequence, error) {
+	for i := range n.available {
+		pas, err := n.available[i].PAData(ex, nil)
+		if err != nil {
+			return nil, err
+		}
+		if len(pas) > 0 {
+			n.current = &n.available[i]
+			return pas, nil
+		}
+	}
+	return nil, nil
+}
+
+// respond returns the pre-authentication data to retry the request with following the KDC's error. The most
+// preferred mechanism among those the KDC lists in its hints is used, falling back to the other mechanisms available
+// in order of preference. False is returned if there is no mechanism left to respond with.
+func (n *preAuthNegotiation) respond(ex *PreAuthExchange, e messages.KRBError, hints *messages.PreAuthHints) (types.PADataSequence, bool, error) {
+	if e.ErrorCode == errorcode.KDC_ERR_MORE_PREAUTH_DATA_REQUIRED && n.current != nil {
+		// The mechanism continues with the further data the KDC requested
+		pas, err := n.current.PAData(ex, hints)
+		return pas, len(pas) > 0, err
+	}
+	if e.ErrorCode == errorcode.KDC_ERR_PREAUTH_FAILED && n.current != nil && n.responded[n.current.paType] {
+		// The mechanism failed with the KDC's own hints so retrying it would fail again
+		return nil, false, nil
+	}
+	// Mechanisms the KDC lists in its hints are tried first
+	var candidates []*preAuth
+	for i := range n.available {
+		if hints.Accepts(n.available[i].paType) {
+			candidates = append(candidates, &n.available[i])
+		}
+	}
+	for i := range n.available {
+		if !hints.Accepts(n.available[i].paType) {
+			candidates = append(candidates, &n.available[i])
+		}
+	}
+	for _, p := range candidates {
+		if n.responded[p.paType] {
+			continue
+		}
+		n.responded[p.paType] = true
+		pas, err := p.PAData(ex, hints)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(pas) > 0 {
+			n.current = p
+			return pas, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// replyKey returns the key the AS_REP is encrypted with. Without pre-authentication it is the client's long-term key.
+func (n *preAuthNegotiation) replyKey(ex *PreAuthExchange, asRep messages.ASRep, pas types.PADataSequence) (types.EncryptionKey, error) {
+	if n.current == nil {
+		return ex.Client.asRepKey(asRep, asRep.PAData)
+	}
+	return n.current.ReplyKey(ex, asRep, pas)
+}
+
+// asRepKey returns the client's long-term key the AS_REP is encrypted with. If the key is derived from the client's
+// password the salt in the pre-authentication data provided is used, if any.
+func (cl *Client) asRepKey(asRep messages.ASRep, pas types.PADataSequence) (types.EncryptionKey, error) {
+	c := cl.Creds()
+	if c.HasKeytab() {
+		key, _, err := c.Keytab().GetEncryptionKey(asRep.CName, asRep.CRealm, asRep.EncPart.KVNO, asRep.EncPart.EType)
+		return key, err
+	}
+	if c.HasPassword() {
+		key, _, err := crypto.GetKeyFromPassword(c.Password(), asRep.CName, asRep.CRealm, asRep.EncPart.EType, pas)
+		return key, err
+	}
+	return types.EncryptionKey{}, krberror.NewErrorf(krberror.DecryptingError, "no secret available in credentials to decrypt the AS_REP")
+}
+
+// preAuthPAData returns the pre-authentication data the KDC's hints were decoded from, if there are hints.
+func preAuthPAData(hints *messages.PreAuthHints) types.PADataSequence {
+	if hints == nil {
+		return nil
+	}
+	return hints.MethodData
+}
+
+// hasLongTermKey indicates if the client has a password or keytab to derive its long-term key from.
+func (cl *Client) hasLongTermKey() bool {
+	c := cl.Creds()
+	return c.HasKeytab() || c.HasPassword()
+}
+
+// preAuthEType returns the etype to use for pre-authentication with the client's long-term key, from the ETYPE-INFO2
+// or ETYPE-INFO hints of the KDC if provided, otherwise as previously negotiated or configured.
+func (cl *Client) preAuthEType(hints *messages.PreAuthHints) (etype.EType, error) {
+	if hints != nil {
+		if etn, ok := hints.EType(); ok {
+			if !cl.etypePolicy().Permits(etn) {
+				return nil, krberror.NewErrorf(krberror.EncryptingError, "KDC requested pre-authentication with encryption type %d that is not permitted by the configuration", etn)
+			}
+			et, err := crypto.GetEtype(etn)
+			if err != nil {
+				return nil, krberror.Errorf(err, krberror.EncryptingError, "error creating etype")
+			}
+			atomic.StoreInt32(&cl.preAuthETypeID, et.GetETypeID()) // Set the etype that has been defined for potential future use
+			return et, nil
+		}
+	}
+	etn := atomic.LoadInt32(&cl.preAuthETypeID) // Use the etype that may have previously been negotiated
+	if etn == 0 {
+		etn = int32(cl.config().LibDefaults.PreferredPreauthTypes[0]) // Resort to config
+	}
+	et, err := crypto.GetEtype(etn)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for pre-auth encryption")
+	}
+	return et, nil
+}
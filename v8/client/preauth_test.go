@@ -0,0 +1,149 @@
+package client
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// stubPreAuth is a pre-authenticator that records the hints it is given.
+type stubPreAuth struct {
+	paType     int32
+	preemptive bool
+	hints      []*messages.PreAuthHints
+}
+
+func (s *stubPreAuth) PAData(ex *PreAuthExchange, hints *messages.PreAuthHints) (types.PADataSequence, error) {
+	if hints == nil && !s.preemptive {
+		return nil, nil
+	}
+	s.hints = append(s.hints, hints)
+	return types.PADataSequence{{PADataType: s.paType, PADataValue: []byte{1}}}, nil
+}
+
+func (s *stubPreAuth) ReplyKey(ex *PreAuthExchange, asRep messages.ASRep, pas types.PADataSequence) (types.EncryptionKey, error) {
+	return types.EncryptionKey{}, nil
+}
+
+func TestPreAuthNegotiation(t *testing.T) {
+	t.Parallel()
+	ex := &PreAuthExchange{}
+	otp := &stubPreAuth{paType: patype.PA_OTP_REQUEST}
+	ts := &stubPreAuth{paType: patype.PA_ENC_TIMESTAMP}
+	n := preAuthNegotiation{
+		available: []preAuth{
+			{paType: patype.PA_OTP_CHALLENGE, PreAuthenticator: otp},
+			{paType: patype.PA_ENC_TIMESTAMP, PreAuthenticator: ts},
+		},
+		responded: make(map[int32]bool),
+	}
+	pas, err := n.preemptive(ex)
+	if err != nil {
+		t.Fatalf("error getting pre-emptive pre-authentication: %v", err)
+	}
+	assert.Len(t, pas, 0, "no pre-emptive pre-authentication expected")
+
+	// The KDC's hints select the mechanism even if it is not the most preferred
+	hints := &messages.PreAuthHints{MethodData: types.PADataSequence{{PADataType: patype.PA_ENC_TIMESTAMP}}}
+	required := messages.KRBError{ErrorCode: errorcode.KDC_ERR_PREAUTH_REQUIRED}
+	pas, ok, err := n.respond(ex, required, hints)
+	if err != nil {
+		t.Fatalf("error responding to KDC: %v", err)
+	}
+	assert.True(t, ok, "mechanism expected to respond")
+	if assert.Len(t, pas, 1, "pre-authentication data not as expected") {
+		assert.Equal(t, patype.PA_ENC_TIMESTAMP, pas[0].PADataType, "mechanism not selected by the KDC's hints")
+	}
+
+	// A mechanism that failed with the KDC's hints is not retried
+	_, ok, err = n.respond(ex, messages.KRBError{ErrorCode: errorcode.KDC_ERR_PREAUTH_FAILED}, hints)
+	assert.NoError(t, err, "error not expected")
+	assert.False(t, ok, "mechanism that failed should not be retried")
+
+	// Without hints the most preferred mechanism not yet used responds, and continues when the KDC needs more data
+	pas, ok, _ = n.respond(ex, required, &messages.PreAuthHints{})
+	assert.True(t, ok, "fall back mechanism expected to respond")
+	assert.Equal(t, patype.PA_OTP_REQUEST, pas[0].PADataType, "fall back mechanism not as expected")
+	more := &messages.PreAuthHints{MethodData: types.PADataSequence{{PADataType: patype.PA_OTP_CHALLENGE}}}
+	_, ok, _ = n.respond(ex, messages.KRBError{ErrorCode: errorcode.KDC_ERR_MORE_PREAUTH_DATA_REQUIRED}, more)
+	assert.True(t, ok, "mechanism expected to continue")
+	assert.Equal(t, more, otp.hints[len(otp.hints)-1], "hints not passed to the continuing mechanism")
+
+	_, ok, _ = n.respond(ex, required, &messages.PreAuthHints{})
+	assert.False(t, ok, "no mechanism expected to be left")
+}
+
+func TestSettings_PreAuthTypes(t *testing.T) {
+	t.Parallel()
+	s := NewSettings()
+	assert.Equal(t, []int32{patype.PA_PK_AS_REQ, patype.PA_ENCRYPTED_CHALLENGE, patype.PA_ENC_TIMESTAMP},
+		s.PreAuthTypes()[:3], "default pre-authentication preference order not as expected")
+	s = NewSettings(PreAuthTypes(patype.PA_ENC_TIMESTAMP))
+	assert.Equal(t, []int32{patype.PA_ENC_TIMESTAMP}, s.PreAuthTypes(), "configured pre-authentication types not as expected")
+}
+
+// TestPreAuth_KDCOffset checks the timestamps of the encrypted timestamp and FAST encrypted challenge are in the KDC's
+// time, as known from the KDC offset of the client's credentials.
+func TestPreAuth_KDCOffset(t *testing.T) {
+	t.Parallel()
+	c, err := config.NewFromString(fmt.Sprintf("[libdefaults]\n default_realm = %s\n", fastTestRealm))
+	if err != nil {
+		t.Fatalf("error creating config: %v", err)
+	}
+	offset := time.Hour
+	cl := NewWithPassword("user", fastTestRealm, "passwd", c, AssumePreAuthentication(true))
+	cl.updateCreds(func(c *credentials.Credentials) {
+		c.SetKDCOffset(offset)
+	})
+	key, _, err := crypto.GetKeyFromPassword("passwd", cl.Creds().CName(), fastTestRealm, etypeID.AES256_CTS_HMAC_SHA1_96, types.PADataSequence{})
+	if err != nil {
+		t.Fatalf("error deriving key: %v", err)
+	}
+	hints := &messages.PreAuthHints{ETypeInfo2: types.ETypeInfo2{{EType: etypeID.AES256_CTS_HMAC_SHA1_96}}}
+	checkTimestamp := func(b []byte, key types.EncryptionKey, usage uint32, name string) {
+		var ed types.EncryptedData
+		if err := ed.Unmarshal(b); err != nil {
+			t.Fatalf("error unmarshaling %s: %v", name, err)
+		}
+		tsb, err := crypto.DecryptEncPart(ed, key, usage)
+		if err != nil {
+			t.Fatalf("error decrypting %s: %v", name, err)
+		}
+		var ts types.PAEncTSEnc
+		if err := ts.Unmarshal(tsb); err != nil {
+			t.Fatalf("error unmarshaling %s timestamp: %v", name, err)
+		}
+		assert.WithinDuration(t, time.Now().Add(offset), ts.PATimestamp, 5*time.Second, "%s timestamp should have the KDC offset applied", name)
+	}
+
+	ex := &PreAuthExchange{Client: cl, Realm: fastTestRealm, ASReq: &messages.ASReq{}}
+	pas, err := encTimestampPreAuth{}.PAData(ex, hints)
+	if err != nil {
+		t.Fatalf("error getting encrypted timestamp: %v", err)
+	}
+	if assert.Len(t, pas, 1, "encrypted timestamp expected") {
+		checkTimestamp(pas[0].PADataValue, key, keyusage.AS_REQ_PA_ENC_TIMESTAMP, "encrypted timestamp")
+	}
+
+	armorKey := types.EncryptionKey{KeyType: etypeID.AES256_CTS_HMAC_SHA1_96, KeyValue: make([]byte, 32)}
+	pa, _, err := cl.encryptedChallenge(&fastExchange{armorKey: armorKey}, hints)
+	if err != nil {
+		t.Fatalf("error getting encrypted challenge: %v", err)
+	}
+	clientKey, _, err := messages.FASTChallengeKeys(armorKey, key)
+	if err != nil {
+		t.Fatalf("error deriving challenge keys: %v", err)
+	}
+	checkTimestamp(pa.PADataValue, clientKey, keyusage.KEY_USAGE_ENC_CHALLENGE_CLIENT, "encrypted challenge")
+}
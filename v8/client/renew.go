@@ -0,0 +1,119 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultAutoRenewFraction = 5.0 / 6
+	// autoRenewRetryInterval is the time waited before trying again to obtain a TGT for the client's realm when the
+	// client has no valid TGT.
+	autoRenewRetryInterval = 30 * time.Second
+	// autoRenewMinRetry is the shortest time waited before retrying a failed renewal of a TGT that is still valid.
+	autoRenewMinRetry = time.Second
+)
+
+// EnableAutoRenew starts a goroutine that keeps the client's TGT for its realm valid until the context is done, so that
+// requests made by the client never find the TGT has expired.
+//
+// The TGT is renewed once the fraction of its lifetime configured with the AutoRenewFraction setting has passed. If it
+// is not renewable, or its renew till time has passed, a new TGT is obtained using the client's keytab or password.
+// Failures are passed to the function configured with the AutoRenewFailureHandler setting and logged, and the renewal
+// is retried until it succeeds or the context is done.
+//
+// A valid TGT is obtained before EnableAutoRenew returns, and an error is returned if this is not possible.
+// Once the context is done the TGT is refreshed when it is next required.
+func (cl *Client) EnableAutoRenew(ctx context.Context) error {
+	if err := cl.ensureValidSession(ctx, cl.Creds().Domain()); err != nil {
+		return err
+	}
+	if !atomic.CompareAndSwapInt32(&cl.autoRenew, 0, 1) {
+		return errors.New("automatic TGT renewal is already enabled")
+	}
+	go cl.autoRenewTGT(ctx)
+	return nil
+}
+
+// autoRenewEnabled indicates if EnableAutoRenew is keeping the TGT for the client's realm valid.
+func (cl *Client) autoRenewEnabled() bool {
+	return atomic.LoadInt32(&cl.autoRenew) == 1
+}
+
+// autoRenewTGT keeps the TGT for the client's realm valid until the context is done.
+func (cl *Client) autoRenewTGT(ctx context.Context) {
+	defer atomic.StoreInt32(&cl.autoRenew, 0)
+	realm := cl.Creds().Domain()
+	var failed bool
+	for {
+		w := autoRenewRetryInterval
+		s, ok := cl.sessions.get(realm)
+		if ok {
+			w, ok = cl.renewalWait(s, failed)
+		}
+		if !ok && !failed {
+			w = 0
+		}
+		timer := time.NewTimer(w)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		var err error
+		if s, ok := cl.sessions.get(realm); ok && s.valid() {
+			_, endTime, _, _, _ := cl.sessionTimes(realm)
+			if _, err = cl.refreshSession(ctx, s); err == nil {
+				if _, e, _, _, _ := cl.sessionTimes(realm); !e.After(endTime) {
+					err = errors.New("TGT was not renewed and no credentials are available to obtain a new one")
+				}
+			}
+		} else {
+			err = cl.realmLogin(ctx, realm)
+		}
+		failed = err != nil
+		if failed {
+			cl.renewalFailed(realm, err)
+		}
+	}
+}
+
+// renewalWait returns how long to wait before refreshing the session. If the last attempt to refresh the session failed
+// the wait is a sixth of the time until the session expires. False is returned if the session has expired.
+func (cl *Client) renewalWait(s *session, failed bool) (time.Duration, bool) {
+	s.mux.RLock()
+	start, end := s.startTime, s.endTime
+	if start.IsZero() {
+		start = s.authTime
+	}
+	s.mux.RUnlock()
+	now := time.Now().UTC()
+	remaining := end.Sub(now)
+	if remaining <= 0 {
+		return 0, false
+	}
+	if failed {
+		w := remaining / 6
+		if w < autoRenewMinRetry {
+			w = autoRenewMinRetry
+		}
+		return w, true
+	}
+	lifetime := end.Sub(start)
+	w := start.Add(time.Duration(float64(lifetime) * cl.settings.AutoRenewFraction())).Sub(now)
+	if w < 0 {
+		w = 0
+	}
+	return w, true
+}
+
+// renewalFailed reports a failure to renew the TGT for the realm.
+func (cl *Client) renewalFailed(realm string, err error) {
+	cl.Log("error refreshing session for %s: %v", realm, err)
+	if cl.settings.autoRenewFailure != nil {
+		cl.settings.autoRenewFailure(realm, err)
+	}
+}
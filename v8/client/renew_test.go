@@ -0,0 +1,72 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient_renewalWait(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC()
+	s := &session{
+		realm:     "TEST.GOKRB5",
+		authTime:  now.Add(-10 * time.Minute),
+		startTime: now.Add(-10 * time.Minute),
+		endTime:   now.Add(50 * time.Minute),
+	}
+	cl := NewWithKeytab("testuser1", "TEST.GOKRB5", keytab.New(), config.New())
+	w, ok := cl.renewalWait(s, false)
+	assert.True(t, ok, "session reported as expired")
+	assert.InDelta(t, float64(40*time.Minute), float64(w), float64(time.Second), "wait with default fraction not as expected")
+
+	cl = NewWithKeytab("testuser1", "TEST.GOKRB5", keytab.New(), config.New(), AutoRenewFraction(0.1))
+	w, ok = cl.renewalWait(s, false)
+	assert.True(t, ok, "session reported as expired")
+	assert.Equal(t, time.Duration(0), w, "wait when renewal is overdue not as expected")
+
+	w, ok = cl.renewalWait(s, true)
+	assert.True(t, ok, "session reported as expired")
+	assert.InDelta(t, float64(50*time.Minute/6), float64(w), float64(time.Second), "wait after failure not as expected")
+
+	s.endTime = now.Add(-time.Minute)
+	_, ok = cl.renewalWait(s, false)
+	assert.False(t, ok, "expired session not reported as expired")
+}
+
+func TestClient_EnableAutoRenew(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC()
+	var failures []string
+	cl := NewWithPassword("testuser1", "TEST.GOKRB5", "", config.New(), AutoRenewFailureHandler(func(realm string, err error) {
+		failures = append(failures, realm)
+	}))
+	cl.sessions.Entries["TEST.GOKRB5"] = &session{
+		realm:     "TEST.GOKRB5",
+		authTime:  now.Add(-time.Minute),
+		startTime: now.Add(-time.Minute),
+		endTime:   now.Add(time.Hour),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	err := cl.EnableAutoRenew(ctx)
+	if err != nil {
+		t.Fatalf("error enabling automatic renewal: %v", err)
+	}
+	assert.True(t, cl.autoRenewEnabled(), "automatic renewal not enabled")
+	assert.Error(t, cl.EnableAutoRenew(ctx), "automatic renewal enabled twice")
+	cancel()
+	for i := 0; i < 100 && cl.autoRenewEnabled(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.False(t, cl.autoRenewEnabled(), "automatic renewal not stopped when context done")
+	assert.Empty(t, failures, "renewal failures reported")
+
+	// Without a valid TGT or credentials to obtain one automatic renewal cannot be enabled
+	cl = NewWithPassword("testuser1", "TEST.GOKRB5", "", config.New())
+	assert.Error(t, cl.EnableAutoRenew(context.Background()), "automatic renewal enabled without a valid TGT")
+	assert.False(t, cl.autoRenewEnabled(), "automatic renewal enabled without a valid TGT")
+}
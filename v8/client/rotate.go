@@ -0,0 +1,138 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+const (
+	machinePasswordLength = 120
+	machinePasswordChars  = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789!#$%&()*+,-./:;<=>?@[]^_{|}~"
+)
+
+// RotateKeytab changes the password of the client's account to a new random password and writes the keys for it to the
+// keytab file at the path provided, for example to rotate the password of an Active Directory computer account as
+// msktutil --auto-update does. The client must have been created with the keytab at the path provided.
+//
+// The new keys are added with the next kvno for the client's principal and for any other principals in the keytab that
+// share its current key, such as the service principal names of a computer account. The keys are derived with the
+// salt Active Directory uses for the account, which for computer accounts (names ending in $) is based on the host name.
+// Entries for all but the keepKVNOs latest kvnos of each principal are removed. A keepKVNOs of less than one keeps all
+// entries, which allows tickets issued before the rotation to be decrypted until they expire.
+//
+// The keytab file is replaced atomically and the client continues with the new keys. The kvno of the new keys is returned.
+func (cl *Client) RotateKeytab(ktPath string, keepKVNOs int) (int, error) {
+	kt, err := keytab.Load(ktPath)
+	if err != nil {
+		return 0, fmt.Errorf("could not load keytab %s: %v", ktPath, err)
+	}
+	passwd, err := newMachinePassword()
+	if err != nil {
+		return 0, fmt.Errorf("could not generate password: %v", err)
+	}
+	c := cl.Creds()
+	kvno, err := addRotatedKeys(kt, c.CName(), c.Domain(), passwd, cl.config().LibDefaults.DefaultTktEnctypeIDs, time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	if err := cl.changePasswd(context.Background(), passwd); err != nil {
+		return 0, fmt.Errorf("error changing password: %v", err)
+	}
+	if keepKVNOs > 0 {
+		kt.Prune(keepKVNOs)
+	}
+	if err := kt.Save(ktPath); err != nil {
+		return kvno, fmt.Errorf("password changed but could not write keytab %s: %v", ktPath, err)
+	}
+	cl.updateCreds(func(c *credentials.Credentials) {
+		c.WithKeytab(kt)
+	})
+	return kvno, nil
+}
+
+// addRotatedKeys adds entries to the keytab for the password provided for the principal and any other principals
+// sharing its current key, and returns the kvno of the new entries.
+// The encryption types of the principal's current entries are used, or the types provided if it has none.
+func addRotatedKeys(kt *keytab.Keytab, cname types.PrincipalName, realm, passwd string, etypes []int32, ts time.Time) (int, error) {
+	var current uint32
+	var keys []types.EncryptionKey
+	for _, e := range kt.Entries {
+		if e.Principal.Realm != realm || e.Principal.String() != cname.PrincipalNameString()+"@"+realm {
+			continue
+		}
+		if e.KVNO > current {
+			current = e.KVNO
+			keys = nil
+		}
+		if e.KVNO == current {
+			keys = append(keys, e.Key)
+		}
+	}
+	if len(keys) > 0 {
+		etypes = nil
+		for _, k := range keys {
+			etypes = append(etypes, k.KeyType)
+		}
+	}
+	if len(etypes) < 1 {
+		return 0, errors.New("no encryption types for the new keys")
+	}
+	names := []string{cname.PrincipalNameString()}
+	for _, pn := range kt.Principals(realm) {
+		if pn.Equal(cname) {
+			continue
+		}
+		for _, k := range keys {
+			if key, _, err := kt.GetKey(pn, realm, 0, k.KeyType); err == nil && bytes.Equal(key.KeyValue, k.KeyValue) {
+				names = append(names, pn.PrincipalNameString())
+				break
+			}
+		}
+	}
+	kvno := current + 1
+	salt := accountSalt(cname, realm)
+	for _, name := range names {
+		for _, et := range etypes {
+			if err := kt.AddEntryWithSalt(name, realm, passwd, salt, ts, kvno, et); err != nil {
+				return 0, fmt.Errorf("could not add key for %s: %v", name, err)
+			}
+		}
+	}
+	return int(kvno), nil
+}
+
+// accountSalt returns the salt Active Directory uses for the keys of the account.
+// For computer accounts this is the realm, "host" and the host name qualified with the realm in lower case.
+// For other accounts the default salt is used, which is indicated by returning an empty string.
+func accountSalt(cname types.PrincipalName, realm string) string {
+	name := cname.PrincipalNameString()
+	if len(cname.NameString) != 1 || !strings.HasSuffix(name, "$") {
+		return ""
+	}
+	host := strings.ToLower(strings.TrimSuffix(name, "$"))
+	return strings.ToUpper(realm) + "host" + host + "." + strings.ToLower(realm)
+}
+
+// newMachinePassword returns a random password of printable ASCII characters.
+func newMachinePassword() (string, error) {
+	b := make([]byte, machinePasswordLength)
+	max := big.NewInt(int64(len(machinePasswordChars)))
+	for i := range b {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		b[i] = machinePasswordChars[n.Int64()]
+	}
+	return string(b), nil
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddRotatedKeys(t *testing.T) {
+	t.Parallel()
+	realm := "TEST.GOKRB5"
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HOST1$")
+	salt := accountSalt(cname, realm)
+	assert.Equal(t, "TEST.GOKRB5hosthost1.test.gokrb5", salt, "computer account salt not as expected")
+
+	kt := keytab.New()
+	for _, name := range []string{"HOST1$", "host/host1.test.gokrb5", "HTTP/host1.test.gokrb5"} {
+		kt.AddEntryWithSalt(name, realm, "oldpassword", salt, time.Unix(100, 0), 4, etypeID.AES256_CTS_HMAC_SHA1_96)
+		kt.AddEntryWithSalt(name, realm, "oldpassword", salt, time.Unix(100, 0), 4, etypeID.AES128_CTS_HMAC_SHA1_96)
+	}
+	// A principal with a different key is not updated
+	kt.AddEntry("ldap/host1.test.gokrb5", realm, "otherpassword", time.Unix(100, 0), 2, etypeID.AES256_CTS_HMAC_SHA1_96)
+
+	kvno, err := addRotatedKeys(kt, cname, realm, "newpassword", nil, time.Unix(200, 0))
+	if err != nil {
+		t.Fatalf("error adding rotated keys: %v", err)
+	}
+	assert.Equal(t, 5, kvno, "kvno of new keys not as expected")
+	assert.Equal(t, 13, len(kt.Entries), "number of keytab entries not as expected")
+
+	expected := keytab.New()
+	expected.AddEntryWithSalt("HOST1$", realm, "newpassword", salt, time.Unix(200, 0), 5, etypeID.AES256_CTS_HMAC_SHA1_96)
+	for _, name := range []string{"HOST1$", "host/host1.test.gokrb5", "HTTP/host1.test.gokrb5"} {
+		pn, _ := types.ParseSPNString(name)
+		key, kv, err := kt.GetKey(pn, realm, 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+		if err != nil {
+			t.Fatalf("error getting new key for %s: %v", name, err)
+		}
+		assert.Equal(t, 5, kv, "kvno of new key for %s not as expected", name)
+		assert.Equal(t, expected.Entries[0].Key, key, "new key for %s not as expected", name)
+		_, _, err = kt.GetKey(pn, realm, 5, etypeID.AES128_CTS_HMAC_SHA1_96)
+		assert.NoError(t, err, "new key for %s missing etype", name)
+	}
+	_, kv, _ := kt.GetKey(types.NewPrincipalName(nametype.KRB_NT_SRV_HST, "ldap/host1.test.gokrb5"), realm, 0, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Equal(t, 2, kv, "principal with a different key was updated")
+
+	_, err = addRotatedKeys(keytab.New(), cname, realm, "newpassword", nil, time.Unix(200, 0))
+	assert.Error(t, err, "no error when there are no encryption types")
+	kt = keytab.New()
+	kvno, err = addRotatedKeys(kt, types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "svcaccount"), realm, "newpassword", []int32{etypeID.AES256_CTS_HMAC_SHA1_96}, time.Unix(200, 0))
+	if err != nil {
+		t.Fatalf("error adding keys to empty keytab: %v", err)
+	}
+	assert.Equal(t, 1, kvno, "kvno of first key not as expected")
+	assert.Equal(t, 1, len(kt.Entries), "number of keytab entries not as expected")
+}
+
+func TestNewMachinePassword(t *testing.T) {
+	t.Parallel()
+	p1, err := newMachinePassword()
+	if err != nil {
+		t.Fatalf("error generating password: %v", err)
+	}
+	p2, _ := newMachinePassword()
+	assert.Equal(t, machinePasswordLength, len(p1), "password length not as expected")
+	assert.NotEqual(t, p1, p2, "passwords generated are not random")
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"sort"
@@ -8,6 +9,7 @@ import (
 	"sync"
 	"time"
 
+	"github.com/Osirium/gokrb5/v8/iana/flags"
 	"github.com/Osirium/gokrb5/v8/iana/nametype"
 	"github.com/Osirium/gokrb5/v8/krberror"
 	"github.com/Osirium/gokrb5/v8/messages"
@@ -104,6 +106,7 @@ func (cl *Client) addSession(tgt messages.Ticket, dep messages.EncKDCRepPart) {
 	}
 	cl.sessions.update(s)
 	cl.enableAutoSessionRenewal(s)
+	cl.storeCCache(tgt, dep)
 	cl.Log("TGT session added for %s (EndTime: %v)", realm, dep.EndTime)
 }
 
@@ -112,8 +115,10 @@ func (s *session) update(tgt messages.Ticket, dep messages.EncKDCRepPart) {
 	s.mux.Lock()
 	defer s.mux.Unlock()
 	s.authTime = dep.AuthTime
+	s.startTime = dep.StartTime
 	s.endTime = dep.EndTime
 	s.renewTill = dep.RenewTill
+	s.flags = dep.Flags
 	s.tgt = tgt
 	s.sessionKey = dep.Key
 	s.sessionKeyExpiration = dep.KeyExpiration
@@ -129,6 +134,7 @@ func (s *session) destroy() {
 	s.endTime = time.Now().UTC()
 	s.renewTill = s.endTime
 	s.sessionKeyExpiration = s.endTime
+	s.sessionKey.Wipe()
 }
 
 // valid informs if the TGT is still within the valid time window
@@ -191,24 +197,28 @@ func (cl *Client) enableAutoSessionRenewal(s *session) {
 	s.cancel = make(chan bool, 1)
 	s.mux.Unlock()
 	go func(s *session) {
+		var failed bool
 		for {
-			s.mux.RLock()
-			w := (s.endTime.Sub(time.Now().UTC()) * 5) / 6
-			s.mux.RUnlock()
-			if w < 0 {
+			w, ok := cl.renewalWait(s, failed)
+			if !ok {
 				return
 			}
 			timer = time.NewTimer(w)
 			select {
 			case <-timer.C:
-				renewal, err := cl.refreshSession(s)
+				if s.realm == cl.Creds().Domain() && cl.autoRenewEnabled() {
+					// The TGT for the client's realm is renewed by the goroutine started by EnableAutoRenew
+					return
+				}
+				renewal, err := cl.refreshSession(context.Background(), s)
 				if err != nil {
-					cl.Log("error refreshing session: %v", err)
+					cl.renewalFailed(s.realm, err)
 				}
 				if !renewal && err == nil {
 					// end this goroutine as there will have been a new login and new auto renewal goroutine created.
 					return
 				}
+				failed = err != nil
 			case <-s.cancel:
 				// cancel has been called. Stop the timer and exit.
 				timer.Stop()
@@ -219,13 +229,15 @@ func (cl *Client) enableAutoSessionRenewal(s *session) {
 }
 
 // renewTGT renews the client's TGT session.
-func (cl *Client) renewTGT(s *session) error {
+func (cl *Client) renewTGT(ctx context.Context, s *session) error {
 	realm, tgt, skey := s.tgtDetails()
 	spn := types.PrincipalName{
 		NameType:   nametype.KRB_NT_SRV_INST,
 		NameString: []string{"krbtgt", realm},
 	}
-	_, tgsRep, err := cl.TGSREQGenerateAndExchange(spn, cl.Credentials.Domain(), tgt, skey, true)
+	// The TGT is renewed by the KDC that issued it, which for a cross-realm TGT is that of the previous realm on the path
+	_, tgsRep, err := cl.TGSREQGenerateAndExchangeContext(ctx, spn, tgt.Realm, tgt, skey, true)
+	cl.settings.Metrics().Renewal(tgt.Realm, spn.PrincipalNameString(), err)
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "error renewing TGT for %s", realm)
 	}
@@ -237,22 +249,23 @@ func (cl *Client) renewTGT(s *session) error {
 
 // refreshSession updates either through renewal or creating a new login.
 // The boolean indicates if the update was a renewal.
-func (cl *Client) refreshSession(s *session) (bool, error) {
+func (cl *Client) refreshSession(ctx context.Context, s *session) (bool, error) {
 	s.mux.RLock()
 	realm := s.realm
 	renewTill := s.renewTill
+	renewable := types.IsFlagSet(&s.flags, flags.Renewable)
 	s.mux.RUnlock()
 	cl.Log("refreshing TGT session for %s", realm)
-	if time.Now().UTC().Before(renewTill) {
-		err := cl.renewTGT(s)
+	if renewable && time.Now().UTC().Before(renewTill) {
+		err := cl.renewTGT(ctx, s)
 		return true, err
 	}
-	err := cl.realmLogin(realm)
+	err := cl.realmLogin(ctx, realm)
 	return false, err
 }
 
 // ensureValidSession makes sure there is a valid session for the realm
-func (cl *Client) ensureValidSession(realm string) error {
+func (cl *Client) ensureValidSession(ctx context.Context, realm string) error {
 	s, ok := cl.sessions.get(realm)
 	if ok {
 		s.mux.RLock()
@@ -262,15 +275,15 @@ func (cl *Client) ensureValidSession(realm string) error {
 			return nil
 		}
 		s.mux.RUnlock()
-		_, err := cl.refreshSession(s)
+		_, err := cl.refreshSession(ctx, s)
 		return err
 	}
-	return cl.realmLogin(realm)
+	return cl.realmLogin(ctx, realm)
 }
 
 // sessionTGTDetails is a thread safe way to get the TGT and session key values for a realm
-func (cl *Client) sessionTGT(realm string) (tgt messages.Ticket, sessionKey types.EncryptionKey, err error) {
-	err = cl.ensureValidSession(realm)
+func (cl *Client) sessionTGT(ctx context.Context, realm string) (tgt messages.Ticket, sessionKey types.EncryptionKey, err error) {
+	err = cl.ensureValidSession(ctx, realm)
 	if err != nil {
 		return
 	}
@@ -296,5 +309,5 @@ func (cl *Client) sessionTimes(realm string) (authTime, endTime, renewTime, sess
 
 // spnRealm resolves the realm name of a service principal name
 func (cl *Client) spnRealm(spn types.PrincipalName) string {
-	return cl.Config.ResolveRealm(spn.NameString[len(spn.NameString)-1])
+	return cl.config().ResolveRealm(spn.NameString[len(spn.NameString)-1])
 }
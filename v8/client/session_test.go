@@ -1,6 +1,7 @@
 package client
 
 import (
+	"context"
 	"encoding/hex"
 	"fmt"
 	"io/ioutil"
@@ -42,7 +43,7 @@ func TestMultiThreadedClientSession(t *testing.T) {
 	}
 	go func() {
 		for {
-			err := cl.renewTGT(s)
+			err := cl.renewTGT(context.Background(), s)
 			if err != nil {
 				t.Logf("error renewing TGT: %v", err)
 			}
@@ -55,7 +56,7 @@ func TestMultiThreadedClientSession(t *testing.T) {
 	for i := 0; i < 10; i++ {
 		go func() {
 			defer wg.Done()
-			tgt, _, err := cl.sessionTGT("TEST.GOKRB5")
+			tgt, _, err := cl.sessionTGT(context.Background(), "TEST.GOKRB5")
 			if err != nil || tgt.Realm != "TEST.GOKRB5" {
 				t.Logf("error getting session: %v", err)
 			}
@@ -1,17 +1,57 @@
 package client
 
 import (
+	"context"
+	"crypto"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/metrics"
+	"github.com/Osirium/gokrb5/v8/trace"
 )
 
 // Settings holds optional client settings.
 type Settings struct {
 	disablePAFXFast         bool
 	assumePreAuthentication bool
-	preAuthEType            int32
+	preAuthTypes            []int32
 	logger                  *log.Logger
+	keytab                  *keytab.Keytab
+	password                string
+	autoRenewFraction       float64
+	autoRenewFailure        func(realm string, err error)
+	kdcProxyClient          *http.Client
+	kdcTimeout              time.Duration
+	kdcQuarantine           time.Duration
+	kdcMaxAttempts          int
+	kdcRetryBackoff         time.Duration
+	kdcRetryJitter          float64
+	kdcTimeoutUDP           time.Duration
+	kdcTimeoutTCP           time.Duration
+	kdcTimeoutHTTPS         time.Duration
+	fastArmor               *Client
+	pkinitCert              *x509.Certificate
+	pkinitKey               crypto.Signer
+	pkinitAnchors           *x509.CertPool
+	pkinitIntermediates     []*x509.Certificate
+	pkinitKeyTransport      bool
+	anonymous               bool
+	delegateCredentials     bool
+	mutualAuthentication    bool
+	otp                     OTPPrompter
+	configProvider          config.Provider
+	tracer                  trace.Tracer
+	traceMessages           bool
+	metrics                 metrics.Recorder
+	spans                   trace.SpanStarter
 }
 
 // jsonSettings is used when marshaling the Settings details to JSON format.
@@ -26,6 +66,14 @@ func NewSettings(settings ...func(*Settings)) *Settings {
 	for _, set := range settings {
 		set(s)
 	}
+	if s.logger == nil {
+		s.logger = traceLogger()
+	}
+	if s.tracer == nil {
+		if l := traceLogger(); l != nil {
+			s.tracer = trace.NewLogTracer(l)
+		}
+	}
 	return s
 }
 
@@ -57,6 +105,25 @@ func (s *Settings) AssumePreAuthentication() bool {
 	return s.assumePreAuthentication
 }
 
+// PreAuthTypes used to configure the pre-authentication mechanisms the client uses in AS exchanges, by the
+// pre-authentication types they are registered for, in order of preference. Defaults to all registered mechanisms:
+// PKINIT, FAST encrypted challenge, encrypted timestamp and OTP, followed by those added with RegisterPreAuth.
+//
+// s := NewSettings(PreAuthTypes(patype.PA_ENCRYPTED_CHALLENGE, patype.PA_ENC_TIMESTAMP))
+func PreAuthTypes(t ...int32) func(*Settings) {
+	return func(s *Settings) {
+		s.preAuthTypes = t
+	}
+}
+
+// PreAuthTypes returns the pre-authentication types of the mechanisms the client uses in order of preference.
+func (s *Settings) PreAuthTypes() []int32 {
+	if len(s.preAuthTypes) == 0 {
+		return defaultPreAuthTypes()
+	}
+	return s.preAuthTypes
+}
+
 // Logger used to configure client with a logger.
 //
 // s := NewSettings(kt, Logger(l))
@@ -71,6 +138,445 @@ func (s *Settings) Logger() *log.Logger {
 	return s.logger
 }
 
+// Tracer used to configure the client with a tracer that receives an event for each step of its exchanges with KDCs,
+// such as the messages sent to each KDC, pre-authentication being required, the encryption type negotiated and
+// referrals. Clients without a tracer configured trace to the file named by KRB5_TRACE if it is set.
+//
+// s := NewSettings(Tracer(trace.NewLogTracer(l)))
+func Tracer(t trace.Tracer) func(*Settings) {
+	return func(s *Settings) {
+		s.tracer = t
+	}
+}
+
+// Tracer returns the tracer the client's events are sent to, if configured.
+func (s *Settings) Tracer() trace.Tracer {
+	return s.tracer
+}
+
+// TraceMessages used to configure the client to include the messages exchanged with KDCs in its trace events.
+// Messages are redacted from events by default as they include tickets and data encrypted with the client's long-term
+// key, which can be attacked offline.
+//
+// s := NewSettings(Tracer(t), TraceMessages(true))
+func TraceMessages(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.traceMessages = b
+	}
+}
+
+// TraceMessages indicates if the client includes the messages exchanged with KDCs in its trace events.
+func (s *Settings) TraceMessages() bool {
+	return s.traceMessages
+}
+
+// Metrics used to configure the client with a recorder of measurements of its exchanges, such as the round trip time
+// of each KDC, the errors replied by KDCs, the hit rate of its ticket cache and renewals.
+//
+// s := NewSettings(Metrics(r))
+func Metrics(r metrics.Recorder) func(*Settings) {
+	return func(s *Settings) {
+		s.metrics = r
+	}
+}
+
+// Metrics returns the recorder of the client's measurements, which discards them if none is configured.
+func (s *Settings) Metrics() metrics.Recorder {
+	if s.metrics == nil {
+		return metrics.Nop{}
+	}
+	return s.metrics
+}
+
+// Spans used to configure the client with a starter of spans for its AS and TGS exchanges and each message sent to a
+// KDC, so that they appear in the distributed traces of the application, such as with an adapter to OpenTelemetry.
+// The spans are children of the span in the context passed to the client's methods.
+//
+// s := NewSettings(Spans(s))
+func Spans(s trace.SpanStarter) func(*Settings) {
+	return func(st *Settings) {
+		st.spans = s
+	}
+}
+
+// Spans returns the starter of the client's spans, if configured.
+func (s *Settings) Spans() trace.SpanStarter {
+	return s.spans
+}
+
+// StartSpan starts a span as a child of the span in the context with the client's span starter, or a span that does
+// nothing if the client has none configured. It is for instrumenting exchanges that use the client, such as SPNEGO,
+// and the span must be ended with trace.EndSpan.
+func (cl *Client) StartSpan(ctx context.Context, name string, attrs ...trace.Attribute) (context.Context, trace.Span) {
+	return trace.StartSpan(ctx, cl.settings.Spans(), name, attrs...)
+}
+
+// trace sends the event to the client's tracer, if configured, with the message redacted unless configured otherwise.
+func (cl *Client) trace(e trace.Event) {
+	t := cl.settings.Tracer()
+	if t == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if !cl.settings.TraceMessages() {
+		e.Message = nil
+	}
+	t.Trace(e)
+}
+
+var (
+	traceOnce sync.Once
+	traceLog  *log.Logger
+)
+
+// traceLogger returns the logger for the file named by the KRB5_TRACE environment variable, which clients without a
+// logger configured write to as MIT Kerberos writes its trace messages. It returns nil if KRB5_TRACE is not set.
+// The file is opened once, when the first client is created.
+func traceLogger() *log.Logger {
+	traceOnce.Do(func() {
+		traceLog = newTraceLogger(os.Getenv("KRB5_TRACE"))
+	})
+	return traceLog
+}
+
+// newTraceLogger returns a logger appending to the file at the path provided, or nil if the path is empty or the file
+// cannot be opened.
+func newTraceLogger(p string) *log.Logger {
+	if p == "" {
+		return nil
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil
+	}
+	return log.New(f, "GOKRB5 Client: ", log.LstdFlags|log.Lmicroseconds)
+}
+
+// WithKeytab used to configure a client created from a credential cache with a keytab to obtain a new TGT
+// when the cached TGT cannot be renewed.
+//
+// cl, err := NewClientFromCCache(cc, cfg, WithKeytab(kt))
+func WithKeytab(kt *keytab.Keytab) func(*Settings) {
+	return func(s *Settings) {
+		s.keytab = kt
+	}
+}
+
+// WithPassword used to configure a client created from a credential cache with a password to obtain a new TGT
+// when the cached TGT cannot be renewed.
+//
+// cl, err := NewClientFromCCache(cc, cfg, WithPassword(p))
+func WithPassword(password string) func(*Settings) {
+	return func(s *Settings) {
+		s.password = password
+	}
+}
+
+// AutoRenewFraction used to configure the fraction of a TGT's lifetime after which the client renews it, or obtains
+// a new TGT if it cannot be renewed. Values that are not greater than 0 and less than 1 are ignored.
+// Defaults to 5/6 if not specified.
+//
+// s := NewSettings(AutoRenewFraction(0.5))
+func AutoRenewFraction(f float64) func(*Settings) {
+	return func(s *Settings) {
+		s.autoRenewFraction = f
+	}
+}
+
+// AutoRenewFraction returns the fraction of a TGT's lifetime after which the client renews it.
+func (s *Settings) AutoRenewFraction() float64 {
+	if s.autoRenewFraction <= 0 || s.autoRenewFraction >= 1 {
+		return defaultAutoRenewFraction
+	}
+	return s.autoRenewFraction
+}
+
+// AutoRenewFailureHandler used to configure a function the client calls when the automatic renewal of a TGT fails.
+// The function is called with the realm of the TGT and the error and must not block. The renewal is retried.
+//
+// s := NewSettings(AutoRenewFailureHandler(f))
+func AutoRenewFailureHandler(f func(realm string, err error)) func(*Settings) {
+	return func(s *Settings) {
+		s.autoRenewFailure = f
+	}
+}
+
+// KDCProxyHTTPClient used to configure the HTTP client used to send messages to MS-KKDCP KDC proxies, which are
+// configured by setting a realm's kdc or kpasswd_server in the krb5.conf to the URL of the proxy, for example
+// kdc = https://proxy.example.com/KdcProxy
+// This can be used to trust a private certificate authority. Defaults to http.DefaultClient.
+//
+// s := NewSettings(KDCProxyHTTPClient(c))
+func KDCProxyHTTPClient(c *http.Client) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcProxyClient = c
+	}
+}
+
+// KDCProxyHTTPClient returns the HTTP client used to send messages to KDC proxies.
+func (s *Settings) KDCProxyHTTPClient() *http.Client {
+	if s.kdcProxyClient == nil {
+		return http.DefaultClient
+	}
+	return s.kdcProxyClient
+}
+
+// KDCTimeout used to configure the time allowed for the exchange with each KDC before the next KDC is tried.
+// Takes precedence over the kdc_timeout of the configuration. Defaults to 5 seconds if neither is specified.
+//
+// s := NewSettings(KDCTimeout(d))
+func KDCTimeout(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcTimeout = d
+	}
+}
+
+// KDCTimeout returns the time allowed for the exchange with each KDC.
+func (s *Settings) KDCTimeout() time.Duration {
+	if s.kdcTimeout <= 0 {
+		return defaultKDCTimeout
+	}
+	return s.kdcTimeout
+}
+
+// KDCTransportTimeouts used to configure the time allowed for the exchange with each KDC over UDP, over TCP and over
+// HTTPS to a KDC proxy, in place of the KDCTimeout. A zero duration leaves the timeout of that transport as the
+// KDCTimeout. Takes precedence over the kdc_timeout_udp, kdc_timeout_tcp and kdc_timeout_https of the configuration.
+//
+// s := NewSettings(KDCTransportTimeouts(time.Second, 5*time.Second, 10*time.Second))
+func KDCTransportTimeouts(udp, tcp, https time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcTimeoutUDP = udp
+		s.kdcTimeoutTCP = tcp
+		s.kdcTimeoutHTTPS = https
+	}
+}
+
+// KDCTransportTimeouts returns the time allowed for the exchange with each KDC over UDP, TCP and HTTPS as configured
+// with the KDCTransportTimeouts setting. A zero duration is not configured.
+func (s *Settings) KDCTransportTimeouts() (udp, tcp, https time.Duration) {
+	return s.kdcTimeoutUDP, s.kdcTimeoutTCP, s.kdcTimeoutHTTPS
+}
+
+// KDCQuarantine used to configure how long a KDC that fails to reply is only tried after the realm's other KDCs.
+// A duration less than zero disables the quarantine of KDCs. Defaults to 30 seconds if not specified.
+//
+// s := NewSettings(KDCQuarantine(d))
+func KDCQuarantine(d time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcQuarantine = d
+	}
+}
+
+// KDCQuarantine returns how long a KDC that fails to reply is only tried after the realm's other KDCs.
+func (s *Settings) KDCQuarantine() time.Duration {
+	if s.kdcQuarantine == 0 {
+		return defaultKDCQuarantine
+	}
+	if s.kdcQuarantine < 0 {
+		return 0
+	}
+	return s.kdcQuarantine
+}
+
+// KDCRetryPolicy used to configure the number of times the client tries each of a realm's KDCs before failing and
+// the wait before trying them again, which doubles after each attempt. A number of attempts less than one leaves it to
+// the max_retries of the configuration. Defaults to a single attempt and to a backoff of one second if not specified.
+//
+// s := NewSettings(KDCRetryPolicy(3, time.Second))
+func KDCRetryPolicy(maxAttempts int, backoff time.Duration) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcMaxAttempts = maxAttempts
+		s.kdcRetryBackoff = backoff
+	}
+}
+
+// KDCRetryPolicy returns the number of times the client tries each of a realm's KDCs and the initial wait between
+// attempts.
+func (s *Settings) KDCRetryPolicy() (int, time.Duration) {
+	n, b := s.kdcMaxAttempts, s.kdcRetryBackoff
+	if n < 1 {
+		n = 1
+	}
+	if b <= 0 {
+		b = defaultKDCRetryBackoff
+	}
+	return n, b
+}
+
+// KDCRetryJitter used to configure the fraction of the wait between attempts to reach the KDCs that is random, so that
+// clients that fail together do not all try again together. With a fraction of 0.5 the client waits between half and
+// all of the backoff. A fraction less than zero disables the jitter. Defaults to 0.5 if not specified.
+//
+// s := NewSettings(KDCRetryJitter(0.2))
+func KDCRetryJitter(fraction float64) func(*Settings) {
+	return func(s *Settings) {
+		s.kdcRetryJitter = fraction
+	}
+}
+
+// KDCRetryJitter returns the fraction of the wait between attempts to reach the KDCs that is random.
+func (s *Settings) KDCRetryJitter() float64 {
+	switch {
+	case s.kdcRetryJitter == 0:
+		return defaultKDCRetryJitter
+	case s.kdcRetryJitter < 0:
+		return 0
+	case s.kdcRetryJitter > 1:
+		return 1
+	}
+	return s.kdcRetryJitter
+}
+
+// ConfigProvider used to configure the client with a provider of its configuration, such as a config.Reloader or
+// config.Store, so that changes to realms and KDCs are picked up by a long running client. The configuration is
+// obtained from the provider each time it is used and takes precedence over the configuration the client was created
+// with.
+//
+// s := NewSettings(ConfigProvider(p))
+func ConfigProvider(p config.Provider) func(*Settings) {
+	return func(s *Settings) {
+		s.configProvider = p
+	}
+}
+
+// ConfigProvider returns the configuration provider of the client. If none is configured nil will be returned.
+func (s *Settings) ConfigProvider() config.Provider {
+	return s.configProvider
+}
+
+// FASTArmor used to configure the client to armor its exchanges with the KDC using FAST (RFC 6113), which protects
+// password based pre-authentication from offline attack and is required by some KDCs. The TGTs of the armor client
+// provided, typically a client for the host's keytab, are used to armor AS exchanges. Pre-authentication in armored AS
+// exchanges uses encrypted challenges rather than encrypted timestamps.
+//
+// s := NewSettings(FASTArmor(hostClient))
+func FASTArmor(armor *Client) func(*Settings) {
+	return func(s *Settings) {
+		s.fastArmor = armor
+	}
+}
+
+// FASTArmor returns the client whose TGTs are used to armor exchanges with the KDC, or nil if FAST is not used.
+func (s *Settings) FASTArmor() *Client {
+	return s.fastArmor
+}
+
+// PKINIT used to configure the client to pre-authenticate AS exchanges with the certificate and private key provided
+// (RFC 4556) rather than a password or keytab. The key only needs to sign, and to decrypt if RSA key transport is used,
+// so keys held in an HSM, TPM or PKCS #11 token can be used.
+//
+// s := NewSettings(PKINIT(cert, key))
+func PKINIT(cert *x509.Certificate, key crypto.Signer) func(*Settings) {
+	return func(s *Settings) {
+		s.pkinitCert = cert
+		s.pkinitKey = key
+	}
+}
+
+// PKINIT returns the certificate and private key used for PKINIT pre-authentication, or nil values if PKINIT is not
+// used.
+func (s *Settings) PKINIT() (*x509.Certificate, crypto.Signer) {
+	return s.pkinitCert, s.pkinitKey
+}
+
+// PKINITAnchors used to configure the trusted roots for the KDC's PKINIT certificate.
+// Defaults to the system roots if not specified. The certificate must also have the id-pkinit-KPKdc key purpose and be
+// issued to krbtgt/REALM@REALM or to one of the realm's pkinit_kdc_hostname host names in the krb5.conf.
+//
+// s := NewSettings(PKINIT(cert, key), PKINITAnchors(roots))
+func PKINITAnchors(roots *x509.CertPool) func(*Settings) {
+	return func(s *Settings) {
+		s.pkinitAnchors = roots
+	}
+}
+
+// PKINITAnchors returns the trusted roots for the KDC's PKINIT certificate, or nil if the system roots are used.
+func (s *Settings) PKINITAnchors() *x509.CertPool {
+	return s.pkinitAnchors
+}
+
+// PKINITIntermediates used to configure intermediate certificates for PKINIT. They are sent to the KDC with the
+// client's certificate and are used to build the chain of the KDC's certificate.
+//
+// s := NewSettings(PKINIT(cert, key), PKINITIntermediates(issuer))
+func PKINITIntermediates(certs ...*x509.Certificate) func(*Settings) {
+	return func(s *Settings) {
+		s.pkinitIntermediates = certs
+	}
+}
+
+// PKINITIntermediates returns the intermediate certificates for PKINIT.
+func (s *Settings) PKINITIntermediates() []*x509.Certificate {
+	return s.pkinitIntermediates
+}
+
+// PKINITKeyTransport used to configure PKINIT to have the KDC encrypt the reply key to the client's RSA certificate
+// rather than agreeing it with Diffie-Hellman. The client's private key must implement crypto.Decrypter.
+// Defaults to false, using Diffie-Hellman.
+//
+// s := NewSettings(PKINIT(cert, key), PKINITKeyTransport(true))
+func PKINITKeyTransport(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.pkinitKeyTransport = b
+	}
+}
+
+// PKINITKeyTransport indicates if PKINIT uses RSA key transport rather than Diffie-Hellman.
+func (s *Settings) PKINITKeyTransport() bool {
+	return s.pkinitKeyTransport
+}
+
+// DelegateCredentials used to configure the client to delegate its credentials to the services it authenticates to
+// with GSS-API, by including a forwarded TGT in the security context as browsers do. The client's TGT must be
+// forwardable. Only enable delegation for clients that authenticate to services trusted with the user's credentials.
+// Defaults to false.
+//
+// s := NewSettings(DelegateCredentials(true))
+func DelegateCredentials(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.delegateCredentials = b
+	}
+}
+
+// DelegateCredentials indicates if the client delegates its credentials to services in GSS-API security contexts.
+func (s *Settings) DelegateCredentials() bool {
+	return s.delegateCredentials
+}
+
+// MutualAuthentication used to configure the client to require the services it authenticates to with SPNEGO to
+// authenticate themselves in return, with an AP_REP in the response to the client's AP_REQ. Security contexts are
+// not established with services that do not. Defaults to false.
+//
+// s := NewSettings(MutualAuthentication(true))
+func MutualAuthentication(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.mutualAuthentication = b
+	}
+}
+
+// MutualAuthentication indicates if the client requires mutual authentication in SPNEGO security contexts.
+func (s *Settings) MutualAuthentication() bool {
+	return s.mutualAuthentication
+}
+
+// OTP used to configure the client to pre-authenticate with one-time passwords (RFC 6560) obtained from the prompter
+// provided when the KDC requests them. OTP pre-authentication requires the client's exchanges to be armored with FAST.
+//
+// s := NewSettings(OTP(prompter), FASTArmor(armor))
+func OTP(p OTPPrompter) func(*Settings) {
+	return func(s *Settings) {
+		s.otp = p
+	}
+}
+
+// OTP returns the prompter the client obtains one-time passwords from, if configured.
+func (s *Settings) OTP() OTPPrompter {
+	return s.otp
+}
+
 // Log will write to the service's logger if it is configured.
 func (cl *Client) Log(format string, v ...interface{}) {
 	if cl.settings.Logger() != nil {
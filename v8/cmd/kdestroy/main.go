@@ -0,0 +1,43 @@
+// Command kdestroy destroys a Kerberos credential cache.
+//
+// Usage:
+//
+//	kdestroy [-c cache_name] [-q]
+//
+// File based caches are zero-filled and truncated before they are removed. KCM and KEYRING caches are destroyed
+// through the KCM daemon and the kernel respectively.
+// If no cache name is specified KRB5CCNAME is used, falling back to the default file cache for the current user.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Osirium/gokrb5/v8/credentials"
+)
+
+func main() {
+	cname := flag.String("c", "", "name of the credential cache to destroy")
+	quiet := flag.Bool("q", false, "do not print an error if there is no cache to destroy")
+	flag.Parse()
+
+	var cc credentials.CredentialCache
+	var err error
+	if *cname != "" {
+		cc, err = credentials.ResolveCCache(*cname)
+	} else {
+		cc, err = credentials.ResolveDefaultCCache()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "kdestroy: %v\n", err)
+		os.Exit(1)
+	}
+	if err := cc.Destroy(); err != nil {
+		if os.IsNotExist(err) && *quiet {
+			os.Exit(1)
+		}
+		fmt.Fprintf(os.Stderr, "kdestroy: could not destroy credential cache %s: %v\n", cc.Name(), err)
+		os.Exit(1)
+	}
+}
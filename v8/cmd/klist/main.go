@@ -0,0 +1,65 @@
+// Command klist lists the credentials held in a Kerberos credential cache in the same format as MIT klist -e -f.
+//
+// Usage:
+//
+//	klist [-c cache_name] [-s]
+//
+// The cache name takes the same forms as the KRB5CCNAME environment variable, for example FILE:/tmp/krb5cc_1000,
+// DIR:/run/user/1000/krb5cc, KCM: or KEYRING:persistent:1000.
+// If no cache name is specified KRB5CCNAME is used, falling back to the default file cache for the current user.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/credentials"
+)
+
+func main() {
+	cname := flag.String("c", "", "name of the credential cache to list")
+	silent := flag.Bool("s", false, "produce no output but exit with a non-zero status if the cache has no valid TGT")
+	flag.Parse()
+
+	var cc credentials.CredentialCache
+	var err error
+	if *cname != "" {
+		cc, err = credentials.ResolveCCache(*cname)
+	} else {
+		cc, err = credentials.ResolveDefaultCCache()
+	}
+	if err != nil {
+		fail(err)
+	}
+	c, err := cc.Load()
+	if err != nil {
+		fail(fmt.Errorf("could not load credential cache %s: %v", cc.Name(), err))
+	}
+	if *silent {
+		if !hasValidTGT(c) {
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Printf("Ticket cache: %s\n", cc.Name())
+	fmt.Print(c.List())
+}
+
+// hasValidTGT indicates if the cache holds an unexpired TGT for the default principal's realm.
+func hasValidTGT(c *credentials.CCache) bool {
+	realm := c.GetClientRealm()
+	for _, cred := range c.GetEntries() {
+		n := cred.Server.PrincipalName.NameString
+		if len(n) == 2 && n[0] == "krbtgt" && n[1] == realm && cred.EndTime.After(time.Now()) {
+			return true
+		}
+	}
+	return false
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "klist: %v\n", err)
+	os.Exit(1)
+}
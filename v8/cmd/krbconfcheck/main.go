@@ -0,0 +1,61 @@
+// Command krbconfcheck checks a krb5.conf file for problems that are likely causes of authentication not working, such
+// as misspelt keys, a missing default realm, realms without KDCs, KDCs that cannot be reached and weak or unsupported
+// encryption types.
+//
+// Usage:
+//
+//	krbconfcheck [-c config_file] [-n] [-t timeout]
+//
+// If no file is specified the files listed in KRB5_CONFIG are checked together, falling back to /etc/krb5.conf.
+// Each problem found is printed on a line of its own and the exit status is non-zero if any are found.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+)
+
+func main() {
+	cfgPath := flag.String("c", "", "path of the krb5.conf file to check")
+	noNet := flag.Bool("n", false, "do not check that the KDCs can be connected to")
+	timeout := flag.Duration("t", 5*time.Second, "time allowed to connect to each KDC")
+	flag.Parse()
+
+	var c *config.Config
+	var err error
+	p := *cfgPath
+	if p != "" {
+		c, err = config.Load(p)
+	} else {
+		p = os.Getenv("KRB5_CONFIG")
+		if p == "" {
+			p = config.DefaultConfigPath
+		}
+		c, err = config.LoadDefault()
+	}
+	if err != nil {
+		if _, ok := err.(config.UnsupportedDirective); !ok {
+			fail(err)
+		}
+		fmt.Printf("%s: %v\n", p, err)
+	}
+	w := c.Validate()
+	if !*noNet {
+		w = append(w, c.ValidateKDCs(*timeout)...)
+	}
+	for _, warning := range w {
+		fmt.Printf("%s: %s\n", p, warning)
+	}
+	if len(w) > 0 || err != nil {
+		os.Exit(1)
+	}
+}
+
+func fail(err error) {
+	fmt.Fprintf(os.Stderr, "krbconfcheck: %v\n", err)
+	os.Exit(1)
+}
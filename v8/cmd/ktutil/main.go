@@ -0,0 +1,259 @@
+// Command ktutil manages the entries of Kerberos keytab files without the MIT Kerberos tools.
+//
+// Usage:
+//
+//	ktutil list [-e] [-K] keytab
+//	ktutil add -p principal -V kvno -e enctype [-s salt] [-key hex] keytab
+//	ktutil delete (-slot n | -V kvno) [-p principal] keytab
+//	ktutil merge keytab source_keytab...
+//	ktutil prune -n count keytab
+//
+// The add command derives the key from a password read from standard input unless a hex encoded key is provided
+// with -key. The keytab is created if it does not exist. Slots are numbered from 1 in the order listed.
+// The delete command removes the entry in the slot given or all entries with the kvno given, optionally only for the
+// principal provided. The merge command adds the entries of the source keytabs to the keytab, replacing any entries
+// for the same principal, kvno and enctype. The prune command keeps only the entries of each principal for its count
+// highest kvnos.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+const usage = `usage:
+  ktutil list [-e] [-K] keytab
+  ktutil add -p principal -V kvno -e enctype [-s salt] [-key hex] keytab
+  ktutil delete (-slot n | -V kvno) [-p principal] keytab
+  ktutil merge keytab source_keytab...
+  ktutil prune -n count keytab
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "list":
+		err = list(os.Args[2:], os.Stdout)
+	case "add":
+		err = add(os.Args[2:], os.Stdin)
+	case "delete":
+		err = del(os.Args[2:])
+	case "merge":
+		err = merge(os.Args[2:])
+	case "prune":
+		err = prune(os.Args[2:], os.Stdout)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ktutil: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func list(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	showEType := fs.Bool("e", false, "show the encryption type of each key")
+	showKey := fs.Bool("K", false, "show the value of each key")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("a single keytab must be specified")
+	}
+	kt, err := keytab.Load(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("could not load keytab %s: %v", fs.Arg(0), err)
+	}
+	fmt.Fprintln(w, "slot KVNO Principal")
+	fmt.Fprintln(w, "---- ---- ---------------------------------------------------------------------")
+	for i, e := range kt.Entries {
+		fmt.Fprintf(w, "%4d %4d %s", i+1, e.KVNO, e.Principal.String())
+		if *showEType {
+			fmt.Fprintf(w, " (%s)", eTypeName(e.Key.KeyType))
+		}
+		if *showKey {
+			fmt.Fprintf(w, " (0x%x)", e.Key.KeyValue)
+		}
+		fmt.Fprintln(w)
+	}
+	return nil
+}
+
+func add(args []string, stdin io.Reader) error {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	princ := fs.String("p", "", "principal of the entry in the form name@REALM")
+	kvno := fs.Uint("V", 0, "key version number of the entry")
+	enctype := fs.String("e", "", "encryption type of the key, for example aes256-cts-hmac-sha1-96")
+	salt := fs.String("s", "", "salt used to derive the key from the password, if not the default for the principal")
+	keyHex := fs.String("key", "", "hex encoded key to add instead of deriving one from a password")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("a single keytab must be specified")
+	}
+	if *princ == "" || *kvno == 0 || *enctype == "" {
+		return errors.New("the principal, kvno and enctype must be specified")
+	}
+	pn, realm := types.ParseSPNString(*princ)
+	if realm == "" {
+		return fmt.Errorf("principal %s does not include a realm", *princ)
+	}
+	et, ok := etypeID.ETypesByName[*enctype]
+	if !ok {
+		return fmt.Errorf("unknown enctype %s", *enctype)
+	}
+	kt, err := loadOrNew(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if *keyHex != "" {
+		k, err := hex.DecodeString(*keyHex)
+		if err != nil {
+			return fmt.Errorf("key is not valid hex: %v", err)
+		}
+		err = kt.AddKey(pn.PrincipalNameString(), realm, types.EncryptionKey{KeyType: et, KeyValue: k}, time.Now(), uint32(*kvno))
+		if err != nil {
+			return err
+		}
+	} else {
+		pw, err := readPassword(stdin, *princ)
+		if err != nil {
+			return err
+		}
+		err = kt.AddEntryWithSalt(pn.PrincipalNameString(), realm, pw, *salt, time.Now(), uint32(*kvno), et)
+		if err != nil {
+			return err
+		}
+	}
+	return save(kt, fs.Arg(0))
+}
+
+func del(args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	slot := fs.Int("slot", 0, "slot number of the entry to delete")
+	kvno := fs.Uint("V", 0, "delete all entries with this key version number")
+	princ := fs.String("p", "", "only delete entries for this principal, in the form name@REALM")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("a single keytab must be specified")
+	}
+	if (*slot == 0) == (*kvno == 0) {
+		return errors.New("either a slot or a kvno must be specified")
+	}
+	kt, err := keytab.Load(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("could not load keytab %s: %v", fs.Arg(0), err)
+	}
+	if *slot != 0 {
+		if *slot < 0 || *slot > len(kt.Entries) {
+			return fmt.Errorf("slot %d does not exist", *slot)
+		}
+		kt.Entries = append(kt.Entries[:*slot-1], kt.Entries[*slot:]...)
+		return save(kt, fs.Arg(0))
+	}
+	entries := kt.Entries[:0]
+	var n int
+	for _, e := range kt.Entries {
+		if e.KVNO == uint32(*kvno) && (*princ == "" || e.Principal.String() == *princ) {
+			n++
+			continue
+		}
+		entries = append(entries, e)
+	}
+	if n == 0 {
+		return fmt.Errorf("no entries found with kvno %d", *kvno)
+	}
+	kt.Entries = entries
+	return save(kt, fs.Arg(0))
+}
+
+func merge(args []string) error {
+	if len(args) < 2 {
+		return errors.New("a keytab and at least one source keytab must be specified")
+	}
+	kt, err := loadOrNew(args[0])
+	if err != nil {
+		return err
+	}
+	for _, p := range args[1:] {
+		src, err := keytab.Load(p)
+		if err != nil {
+			return fmt.Errorf("could not load keytab %s: %v", p, err)
+		}
+		kt = keytab.MergeKeytabs(kt, src)
+	}
+	return save(kt, args[0])
+}
+
+func prune(args []string, w io.Writer) error {
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	n := fs.Int("n", 0, "number of kvnos to keep for each principal")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("a single keytab must be specified")
+	}
+	if *n < 1 {
+		return errors.New("the number of kvnos to keep must be at least 1")
+	}
+	kt, err := keytab.Load(fs.Arg(0))
+	if err != nil {
+		return fmt.Errorf("could not load keytab %s: %v", fs.Arg(0), err)
+	}
+	fmt.Fprintf(w, "%d entries removed\n", kt.Prune(*n))
+	return save(kt, fs.Arg(0))
+}
+
+// loadOrNew loads the keytab at the path provided or returns a new keytab if the file does not exist.
+func loadOrNew(p string) (*keytab.Keytab, error) {
+	kt, err := keytab.Load(p)
+	if os.IsNotExist(err) {
+		return keytab.New(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not load keytab %s: %v", p, err)
+	}
+	return kt, nil
+}
+
+func save(kt *keytab.Keytab, p string) error {
+	if err := kt.Save(p); err != nil {
+		return fmt.Errorf("could not write keytab %s: %v", p, err)
+	}
+	return nil
+}
+
+// readPassword reads the password from the first line of input.
+func readPassword(r io.Reader, princ string) (string, error) {
+	fmt.Fprintf(os.Stderr, "Password for %s: ", princ)
+	line, err := bufio.NewReader(r).ReadString('\n')
+	fmt.Fprintln(os.Stderr)
+	if err != nil && err != io.EOF {
+		return "", fmt.Errorf("could not read password: %v", err)
+	}
+	pw := strings.TrimRight(line, "\r\n")
+	if pw == "" {
+		return "", errors.New("password is empty")
+	}
+	return pw, nil
+}
+
+func eTypeName(e int32) string {
+	if n, ok := etypeID.ETypeNames[e]; ok {
+		return n
+	}
+	return fmt.Sprintf("etype %d", e)
+}
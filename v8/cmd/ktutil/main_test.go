@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type testEntry struct {
+	princ string
+	kvno  uint32
+	etype int32
+}
+
+// testKey returns a key for the entry that differs from the keys of the other entries.
+func testKey(e testEntry) []byte {
+	return bytes.Repeat([]byte{byte(e.kvno), byte(e.etype), byte(len(e.princ))}, 32)[:32]
+}
+
+// writeTestKeytab writes a keytab holding the entries provided to a temporary directory and returns its path.
+func writeTestKeytab(t *testing.T, dir, name string, entries ...testEntry) string {
+	kt := keytab.New()
+	for _, e := range entries {
+		pn, realm := types.ParseSPNString(e.princ)
+		err := kt.AddKey(pn.PrincipalNameString(), realm, types.EncryptionKey{KeyType: e.etype, KeyValue: testKey(e)}, time.Now(), e.kvno)
+		if err != nil {
+			t.Fatalf("Error adding test keytab entry: %v", err)
+		}
+	}
+	p := filepath.Join(dir, name)
+	if err := kt.Save(p); err != nil {
+		t.Fatalf("Error writing test keytab: %v", err)
+	}
+	return p
+}
+
+// keytabEntries returns the entries of the keytab at the path provided.
+func keytabEntries(t *testing.T, p string) []testEntry {
+	kt, err := keytab.Load(p)
+	if err != nil {
+		t.Fatalf("Error loading keytab: %v", err)
+	}
+	entries := []testEntry{}
+	for _, e := range kt.Entries {
+		entries = append(entries, testEntry{princ: e.Principal.String(), kvno: e.KVNO, etype: e.Key.KeyType})
+	}
+	return entries
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir(os.TempDir(), "gokrb5-ktutil")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+var testEntries = []testEntry{
+	{"user@TEST.GOKRB5", 1, etypeID.AES256_CTS_HMAC_SHA1_96},
+	{"user@TEST.GOKRB5", 2, etypeID.AES256_CTS_HMAC_SHA1_96},
+	{"HTTP/host.test.gokrb5@TEST.GOKRB5", 2, etypeID.AES128_CTS_HMAC_SHA1_96},
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+	dir := tempDir(t)
+	p := writeTestKeytab(t, dir, "krb5.keytab", testEntries[0], testEntries[2])
+	k1 := fmt.Sprintf("0x%x", testKey(testEntries[0]))
+	k2 := fmt.Sprintf("0x%x", testKey(testEntries[2]))
+	var tests = []struct {
+		flags []string
+		want  []string
+	}{
+		{nil, []string{
+			"   1    1 user@TEST.GOKRB5",
+			"   2    2 HTTP/host.test.gokrb5@TEST.GOKRB5",
+		}},
+		{[]string{"-e"}, []string{
+			"   1    1 user@TEST.GOKRB5 (aes256-cts-hmac-sha1-96)",
+			"   2    2 HTTP/host.test.gokrb5@TEST.GOKRB5 (aes128-cts-hmac-sha1-96)",
+		}},
+		{[]string{"-K"}, []string{
+			"   1    1 user@TEST.GOKRB5 (" + k1 + ")",
+			"   2    2 HTTP/host.test.gokrb5@TEST.GOKRB5 (" + k2 + ")",
+		}},
+		{[]string{"-e", "-K"}, []string{
+			"   1    1 user@TEST.GOKRB5 (aes256-cts-hmac-sha1-96) (" + k1 + ")",
+			"   2    2 HTTP/host.test.gokrb5@TEST.GOKRB5 (aes128-cts-hmac-sha1-96) (" + k2 + ")",
+		}},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := list(append(test.flags, p), &out)
+		if err != nil {
+			t.Fatalf("Error listing keytab with flags %v: %v", test.flags, err)
+		}
+		lines := strings.Split(strings.TrimRight(out.String(), "\n"), "\n")
+		assert.Equal(t, test.want, lines[2:], "listing not as expected with flags %v", test.flags)
+	}
+
+	err := list([]string{filepath.Join(dir, "missing.keytab")}, ioutil.Discard)
+	assert.Error(t, err, "listing a missing keytab should fail")
+	err = list([]string{}, ioutil.Discard)
+	assert.Error(t, err, "listing without a keytab should fail")
+}
+
+func TestAdd(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name  string
+		args  []string
+		stdin string
+		want  []testEntry
+		err   bool
+	}{
+		{"key", []string{"-p", "HTTP/host.test.gokrb5@TEST.GOKRB5", "-V", "3", "-e", "aes128-cts-hmac-sha1-96", "-key", "000102030405060708090a0b0c0d0e0f"}, "",
+			append(testEntries[:2:2], testEntry{"HTTP/host.test.gokrb5@TEST.GOKRB5", 3, etypeID.AES128_CTS_HMAC_SHA1_96}), false},
+		{"password", []string{"-p", "user@TEST.GOKRB5", "-V", "3", "-e", "aes256-cts-hmac-sha1-96"}, "passwordvalue\n",
+			append(testEntries[:2:2], testEntry{"user@TEST.GOKRB5", 3, etypeID.AES256_CTS_HMAC_SHA1_96}), false},
+		{"password with salt", []string{"-p", "user@TEST.GOKRB5", "-V", "3", "-e", "aes256-cts-hmac-sha1-96", "-s", "OTHER.GOKRB5user"}, "passwordvalue",
+			append(testEntries[:2:2], testEntry{"user@TEST.GOKRB5", 3, etypeID.AES256_CTS_HMAC_SHA1_96}), false},
+		{"empty password", []string{"-p", "user@TEST.GOKRB5", "-V", "3", "-e", "aes256-cts-hmac-sha1-96"}, "\n", testEntries[:2], true},
+		{"invalid hex key", []string{"-p", "user@TEST.GOKRB5", "-V", "3", "-e", "aes256-cts-hmac-sha1-96", "-key", "xyz"}, "", testEntries[:2], true},
+		{"no realm", []string{"-p", "user", "-V", "3", "-e", "aes256-cts-hmac-sha1-96", "-key", "00"}, "", testEntries[:2], true},
+		{"unknown enctype", []string{"-p", "user@TEST.GOKRB5", "-V", "3", "-e", "unknown", "-key", "00"}, "", testEntries[:2], true},
+		{"no kvno", []string{"-p", "user@TEST.GOKRB5", "-e", "aes256-cts-hmac-sha1-96", "-key", "00"}, "", testEntries[:2], true},
+	}
+	for _, test := range tests {
+		p := writeTestKeytab(t, tempDir(t), "krb5.keytab", testEntries[:2]...)
+		err := add(append(test.args, p), strings.NewReader(test.stdin))
+		if test.err {
+			assert.Error(t, err, "add should fail for %s", test.name)
+		} else if err != nil {
+			t.Errorf("Error adding entry for %s: %v", test.name, err)
+		}
+		assert.Equal(t, test.want, keytabEntries(t, p), "entries not as expected for %s", test.name)
+	}
+}
+
+func TestAdd_Key(t *testing.T) {
+	t.Parallel()
+	p := filepath.Join(tempDir(t), "new.keytab")
+	err := add([]string{"-p", "user@TEST.GOKRB5", "-V", "5", "-e", "aes128-cts-hmac-sha1-96", "-key", "000102030405060708090a0b0c0d0e0f", p}, strings.NewReader(""))
+	if err != nil {
+		t.Fatalf("Error adding key to new keytab: %v", err)
+	}
+	kt, err := keytab.Load(p)
+	if err != nil {
+		t.Fatalf("Error loading keytab: %v", err)
+	}
+	pn, _ := types.ParseSPNString("user")
+	k, kvno, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 0, etypeID.AES128_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting key from keytab: %v", err)
+	}
+	assert.Equal(t, 5, kvno, "kvno not as expected")
+	assert.Equal(t, []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, k.KeyValue, "key not as expected")
+}
+
+func TestDelete(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name string
+		args []string
+		want []testEntry
+		err  bool
+	}{
+		{"first slot", []string{"-slot", "1"}, testEntries[1:], false},
+		{"last slot", []string{"-slot", "3"}, testEntries[:2], false},
+		{"slot too high", []string{"-slot", "4"}, testEntries, true},
+		{"negative slot", []string{"-slot", "-1"}, testEntries, true},
+		{"kvno", []string{"-V", "2"}, testEntries[:1], false},
+		{"kvno and principal", []string{"-V", "2", "-p", "user@TEST.GOKRB5"}, []testEntry{testEntries[0], testEntries[2]}, false},
+		{"kvno and other principal", []string{"-V", "1", "-p", "HTTP/host.test.gokrb5@TEST.GOKRB5"}, testEntries, true},
+		{"unknown kvno", []string{"-V", "9"}, testEntries, true},
+		{"slot and kvno", []string{"-slot", "1", "-V", "2"}, testEntries, true},
+		{"neither slot nor kvno", []string{"-p", "user@TEST.GOKRB5"}, testEntries, true},
+	}
+	for _, test := range tests {
+		p := writeTestKeytab(t, tempDir(t), "krb5.keytab", testEntries...)
+		err := del(append(test.args, p))
+		if test.err {
+			assert.Error(t, err, "delete should fail for %s", test.name)
+		} else if err != nil {
+			t.Errorf("Error deleting entries for %s: %v", test.name, err)
+		}
+		assert.Equal(t, test.want, keytabEntries(t, p), "entries not as expected for %s", test.name)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	t.Parallel()
+	other := testEntry{"other@TEST.GOKRB5", 1, etypeID.AES256_CTS_HMAC_SHA1_96}
+	var tests = []struct {
+		name    string
+		dest    []testEntry
+		sources [][]testEntry
+		want    []testEntry
+	}{
+		{"into new keytab", nil, [][]testEntry{testEntries}, testEntries},
+		{"disjoint", testEntries[:1], [][]testEntry{testEntries[1:]}, testEntries},
+		{"overlapping", testEntries[:2], [][]testEntry{testEntries[1:]}, testEntries},
+		{"several sources", testEntries[:1], [][]testEntry{testEntries[1:2], testEntries[2:], {other}}, append(testEntries[:3:3], other)},
+	}
+	for _, test := range tests {
+		dir := tempDir(t)
+		p := filepath.Join(dir, "krb5.keytab")
+		if test.dest != nil {
+			writeTestKeytab(t, dir, "krb5.keytab", test.dest...)
+		}
+		args := []string{p}
+		for i, s := range test.sources {
+			args = append(args, writeTestKeytab(t, dir, fmt.Sprintf("source%d.keytab", i), s...))
+		}
+		if err := merge(args); err != nil {
+			t.Errorf("Error merging keytabs for %s: %v", test.name, err)
+		}
+		assert.Equal(t, test.want, keytabEntries(t, p), "entries not as expected for %s", test.name)
+	}
+
+	dir := tempDir(t)
+	p := writeTestKeytab(t, dir, "krb5.keytab", testEntries...)
+	assert.Error(t, merge([]string{p}), "merge without a source keytab should fail")
+	assert.Error(t, merge([]string{p, filepath.Join(dir, "missing.keytab")}), "merge of a missing source keytab should fail")
+	assert.Equal(t, testEntries, keytabEntries(t, p), "entries should not change when merge fails")
+}
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+	entries := append(testEntries[:3:3], testEntry{"user@TEST.GOKRB5", 3, etypeID.AES256_CTS_HMAC_SHA1_96})
+	var tests = []struct {
+		n    string
+		want []testEntry
+		out  string
+		err  bool
+	}{
+		{"1", []testEntry{testEntries[2], entries[3]}, "2 entries removed\n", false},
+		{"2", entries[1:], "1 entries removed\n", false},
+		{"3", entries, "0 entries removed\n", false},
+		{"0", entries, "", true},
+	}
+	for _, test := range tests {
+		p := writeTestKeytab(t, tempDir(t), "krb5.keytab", entries...)
+		var out bytes.Buffer
+		err := prune([]string{"-n", test.n, p}, &out)
+		if test.err {
+			assert.Error(t, err, "prune should fail keeping %s kvnos", test.n)
+		} else if err != nil {
+			t.Errorf("Error pruning keytab keeping %s kvnos: %v", test.n, err)
+		}
+		assert.Equal(t, test.out, out.String(), "output not as expected keeping %s kvnos", test.n)
+		assert.ElementsMatch(t, test.want, keytabEntries(t, p), "entries not as expected keeping %s kvnos", test.n)
+	}
+}
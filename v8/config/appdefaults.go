@@ -0,0 +1,146 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// AppDefaults represents the [appdefaults] section of the configuration. Relations can be set for all applications or
+// within a subsection for an application, and within either of those within a subsection for a realm:
+//
+//	[appdefaults]
+//	 forwardable = true
+//	 pam = {
+//	  ticket_lifetime = 10h
+//	  TEST.GOKRB5 = {
+//	   forwardable = false
+//	  }
+//	 }
+type AppDefaults struct {
+	Relations   map[string]string      `json:",omitempty"`
+	Subsections map[string]AppDefaults `json:",omitempty"`
+}
+
+func newAppDefaults() AppDefaults {
+	return AppDefaults{
+		Relations:   make(map[string]string),
+		Subsections: make(map[string]AppDefaults),
+	}
+}
+
+// Parse the lines of the [appdefaults] section of the configuration and add to the relations. As MIT Kerberos does,
+// the first value of a relation set more than once is used.
+func (a *AppDefaults) parseLines(lines []string) error {
+	stack := []AppDefaults{*a}
+	for _, line := range lines {
+		//Remove comments after the values
+		if idx := strings.IndexAny(line, "#;"); idx != -1 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if line == "}" {
+			if len(stack) < 2 {
+				return InvalidErrorf("unpaired curly brackets")
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return InvalidErrorf("appdefaults section line (%s)", line)
+		}
+		k := strings.TrimSpace(line[:i])
+		v := strings.TrimSpace(line[i+1:])
+		s := stack[len(stack)-1]
+		if v == "{" {
+			sub, ok := s.Subsections[k]
+			if !ok {
+				sub = newAppDefaults()
+				s.Subsections[k] = sub
+			}
+			stack = append(stack, sub)
+			continue
+		}
+		if _, ok := s.Relations[k]; !ok {
+			s.Relations[k] = v
+		}
+	}
+	if len(stack) > 1 {
+		return InvalidErrorf("unpaired curly brackets")
+	}
+	return nil
+}
+
+// merge adds the relations and subsections of another [appdefaults] section, keeping the values already set.
+func (a *AppDefaults) merge(o AppDefaults) {
+	for k, v := range o.Relations {
+		if _, ok := a.Relations[k]; !ok {
+			a.Relations[k] = v
+		}
+	}
+	for k, v := range o.Subsections {
+		if sub, ok := a.Subsections[k]; ok {
+			sub.merge(v)
+		} else {
+			a.Subsections[k] = v
+		}
+	}
+}
+
+// AppDefault returns the value of the option for the application in the realm, and whether the option is set. The
+// value is taken from the first of these that sets it, as MIT Kerberos applications look them up:
+//
+//	the realm's subsection of the application's subsection of [appdefaults]
+//	the application's subsection of [appdefaults]
+//	the realm's subsection of [appdefaults]
+//	[appdefaults]
+//	the realm's entry in [realms]
+//	[libdefaults]
+func (c *Config) AppDefault(app, realm, option string) (string, bool) {
+	a := c.AppDefaults
+	for _, s := range []AppDefaults{a.Subsections[app].Subsections[realm], a.Subsections[app], a.Subsections[realm], a} {
+		if v, ok := s.Relations[option]; ok {
+			return v, true
+		}
+	}
+	for _, r := range c.Realms {
+		if r.Realm == realm {
+			if v, ok := r.relations[option]; ok {
+				return v, true
+			}
+		}
+	}
+	v, ok := c.LibDefaults.relations[option]
+	return v, ok
+}
+
+// AppDefaultBoolean returns the boolean value of the option for the application in the realm as AppDefault finds it,
+// or the default value provided if the option is not set or its value is not a boolean.
+func (c *Config) AppDefaultBoolean(app, realm, option string, def bool) bool {
+	s, ok := c.AppDefault(app, realm, option)
+	if !ok {
+		return def
+	}
+	v, err := parseBoolean(s)
+	if err != nil {
+		return def
+	}
+	return v
+}
+
+// AppDefaultDuration returns the duration value of the option for the application in the realm as AppDefault finds
+// it, or the default value provided if the option is not set or its value is not a duration.
+func (c *Config) AppDefaultDuration(app, realm, option string, def time.Duration) time.Duration {
+	s, ok := c.AppDefault(app, realm, option)
+	if !ok {
+		return def
+	}
+	v, err := parseDuration(s)
+	if err != nil {
+		return def
+	}
+	return v
+}
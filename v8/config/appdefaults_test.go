@@ -0,0 +1,93 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const krb5ConfAppDefaults = `[libdefaults]
+ default_realm = TEST.GOKRB5
+ forwardable = true
+ ticket_lifetime = 10h
+ renew_lifetime = 7d
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 10.80.88.88
+  renew_lifetime = 1d
+ }
+
+[appdefaults]
+ validate = true
+ ticket_lifetime = 36000 ; comment to be ignored
+ TEST.GOKRB5 = {
+  validate = false
+  retain_after_close = true
+ }
+ pam = {
+  debug = false
+  debug = true
+  ticket_lifetime = 8h
+  TEST.GOKRB5 = {
+   debug = yes
+   forwardable = false
+  }
+ }
+`
+
+func TestAppDefault(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(krb5ConfAppDefaults)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	var tests = []struct {
+		app    string
+		realm  string
+		option string
+		want   string
+	}{
+		// The realm's subsection of the application's subsection
+		{"pam", "TEST.GOKRB5", "debug", "yes"},
+		{"pam", "TEST.GOKRB5", "forwardable", "false"},
+		// The application's subsection, with the first value of a relation set twice
+		{"pam", "OTHER.GOKRB5", "debug", "false"},
+		{"pam", "TEST.GOKRB5", "ticket_lifetime", "8h"},
+		// The realm's subsection
+		{"kinit", "TEST.GOKRB5", "validate", "false"},
+		{"pam", "TEST.GOKRB5", "retain_after_close", "true"},
+		// The section
+		{"kinit", "OTHER.GOKRB5", "validate", "true"},
+		{"kinit", "TEST.GOKRB5", "ticket_lifetime", "36000"},
+		// The realm's entry in [realms]
+		{"kinit", "TEST.GOKRB5", "renew_lifetime", "1d"},
+		// [libdefaults]
+		{"kinit", "OTHER.GOKRB5", "renew_lifetime", "7d"},
+		{"kinit", "OTHER.GOKRB5", "forwardable", "true"},
+	}
+	for _, test := range tests {
+		v, ok := c.AppDefault(test.app, test.realm, test.option)
+		assert.True(t, ok, "%s for %s in %s not found", test.option, test.app, test.realm)
+		assert.Equal(t, test.want, v, "%s for %s in %s not as expected", test.option, test.app, test.realm)
+	}
+	_, ok := c.AppDefault("pam", "TEST.GOKRB5", "not_set")
+	assert.False(t, ok, "option not set should not be found")
+
+	assert.True(t, c.AppDefaultBoolean("pam", "TEST.GOKRB5", "debug", false), "boolean option not as expected")
+	assert.False(t, c.AppDefaultBoolean("pam", "OTHER.GOKRB5", "debug", true), "boolean option not as expected")
+	assert.True(t, c.AppDefaultBoolean("pam", "TEST.GOKRB5", "not_set", true), "boolean option not set should be the default")
+	assert.True(t, c.AppDefaultBoolean("pam", "TEST.GOKRB5", "ticket_lifetime", true), "option not a boolean should be the default")
+	assert.Equal(t, 8*time.Hour, c.AppDefaultDuration("pam", "TEST.GOKRB5", "ticket_lifetime", time.Hour), "duration option not as expected")
+	assert.Equal(t, 10*time.Hour, c.AppDefaultDuration("kinit", "TEST.GOKRB5", "ticket_lifetime", time.Hour), "duration option not as expected")
+	assert.Equal(t, time.Hour, c.AppDefaultDuration("kinit", "TEST.GOKRB5", "validate", time.Hour), "option not a duration should be the default")
+}
+
+func TestAppDefaults_UnpairedBrackets(t *testing.T) {
+	t.Parallel()
+	for _, s := range []string{"[appdefaults]\n pam = {\n debug = true\n", "[appdefaults]\n debug = true\n }\n"} {
+		_, err := NewFromString(s)
+		assert.Error(t, err, "unpaired curly brackets should be an error")
+	}
+}
@@ -0,0 +1,82 @@
+package config
+
+import (
+	"strings"
+
+	"github.com/Osirium/gokrb5/v8/fips"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+)
+
+// ETypePolicy is the encryption type policy of a configuration, from the allow_weak_crypto, permitted_enctypes,
+// default_tkt_enctypes and default_tgs_enctypes settings of the libdefaults section. It is enforced on the keys of the
+// tickets and replies accepted by clients and services.
+// Weak encryption types, those of WeakETypeList including the DES and RC4 families, are not permitted unless
+// AllowWeakCrypto is set, and in FIPS mode only FIPS approved encryption types are permitted. An empty list of encryption types places no restriction beyond that on weak types.
+type ETypePolicy struct {
+	AllowWeakCrypto bool
+	// Permitted encryption types of any key, including the long-term keys of clients and services.
+	Permitted []int32
+	// Tkt are the encryption types permitted for the session keys of TGTs.
+	Tkt []int32
+	// TGS are the encryption types permitted for the session keys of service tickets.
+	TGS []int32
+}
+
+// ETypePolicy returns the encryption type policy of the libdefaults.
+func (l *LibDefaults) ETypePolicy() ETypePolicy {
+	return ETypePolicy{
+		AllowWeakCrypto: l.AllowWeakCrypto,
+		Permitted:       append([]int32(nil), l.PermittedEnctypeIDs...),
+		Tkt:             append([]int32(nil), l.DefaultTktEnctypeIDs...),
+		TGS:             append([]int32(nil), l.DefaultTGSEnctypeIDs...),
+	}
+}
+
+// DefaultETypePolicy returns the encryption type policy of the default configuration.
+func DefaultETypePolicy() ETypePolicy {
+	l := newLibDefaults()
+	return l.ETypePolicy()
+}
+
+// IsWeakEType indicates if the encryption type is one of those deemed weak in WeakETypeList.
+func IsWeakEType(etype int32) bool {
+	for _, n := range strings.Fields(WeakETypeList) {
+		if id, ok := etypeID.ETypesByName[n]; ok && id == etype {
+			return true
+		}
+	}
+	return false
+}
+
+// Permits indicates if the policy permits the encryption type for a key.
+func (p ETypePolicy) Permits(etype int32) bool {
+	if fips.Enabled() && !fips.ApprovedEType(etype) {
+		return false
+	}
+	if !p.AllowWeakCrypto && IsWeakEType(etype) {
+		return false
+	}
+	return listPermits(p.Permitted, etype)
+}
+
+// PermitsTkt indicates if the policy permits the encryption type for the session key of a TGT.
+func (p ETypePolicy) PermitsTkt(etype int32) bool {
+	return p.Permits(etype) && listPermits(p.Tkt, etype)
+}
+
+// PermitsTGS indicates if the policy permits the encryption type for the session key of a service ticket.
+func (p ETypePolicy) PermitsTGS(etype int32) bool {
+	return p.Permits(etype) && listPermits(p.TGS, etype)
+}
+
+func listPermits(l []int32, etype int32) bool {
+	if len(l) == 0 {
+		return true
+	}
+	for _, e := range l {
+		if e == etype {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETypePolicy(t *testing.T) {
+	t.Parallel()
+	p := DefaultETypePolicy()
+	assert.True(t, p.PermitsTkt(etypeID.AES256_CTS_HMAC_SHA1_96), "AES should be permitted by default")
+	assert.True(t, p.PermitsTGS(etypeID.AES256_CTS_HMAC_SHA384_192), "AES-SHA2 should be permitted by default")
+	assert.True(t, p.PermitsTkt(etypeID.AES128_CTS_HMAC_SHA256_128), "AES-SHA2 should be permitted by default")
+	assert.False(t, p.Permits(etypeID.RC4_HMAC), "RC4 should not be permitted by default")
+	assert.False(t, p.Permits(etypeID.DES_CBC_MD5), "DES should not be permitted by default")
+
+	c, err := NewFromString(`[libdefaults]
+ allow_weak_crypto = true
+ permitted_enctypes = aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 rc4-hmac
+ default_tkt_enctypes = aes256-cts-hmac-sha1-96
+ default_tgs_enctypes = aes256-cts-hmac-sha1-96 rc4-hmac
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	p = c.LibDefaults.ETypePolicy()
+	assert.True(t, p.Permits(etypeID.RC4_HMAC), "RC4 should be permitted when weak crypto is allowed")
+	assert.True(t, p.PermitsTGS(etypeID.RC4_HMAC), "RC4 should be permitted for service tickets")
+	assert.False(t, p.PermitsTkt(etypeID.RC4_HMAC), "RC4 should not be permitted for TGTs")
+	assert.True(t, p.Permits(etypeID.AES128_CTS_HMAC_SHA1_96), "permitted etype not permitted")
+	assert.False(t, p.PermitsTkt(etypeID.AES128_CTS_HMAC_SHA1_96), "etype not in default_tkt_enctypes permitted for TGTs")
+	assert.False(t, p.Permits(etypeID.AES256_CTS_HMAC_SHA384_192), "etype not in permitted_enctypes permitted")
+
+	// Weak etypes listed are not permitted unless weak crypto is allowed
+	c.LibDefaults.AllowWeakCrypto = false
+	c.LibDefaults.SetDefaultEnctypeIDs()
+	p = c.LibDefaults.ETypePolicy()
+	assert.False(t, p.PermitsTGS(etypeID.RC4_HMAC), "RC4 should not be permitted when weak crypto is not allowed")
+	assert.Equal(t, []int32{etypeID.AES256_CTS_HMAC_SHA1_96}, p.TGS, "weak etypes not removed from default_tgs_enctypes")
+}
@@ -10,7 +10,30 @@ import (
 	"github.com/jcmturner/dnsutils/v2"
 )
 
-// GetKDCs returns the count of KDCs available and a map of KDC host names keyed on preference order.
+// lookupTXT looks up the TXT records of a DNS name.
+var lookupTXT = net.LookupTXT
+
+// lookupRealm returns the realm of the domain name from the _kerberos TXT record of the name or, if it has none, of
+// its closest parent domain that has one.
+func lookupRealm(domainName string) (string, bool) {
+	d := strings.TrimPrefix(domainName, ".")
+	for d != "" {
+		txt, err := lookupTXT("_kerberos." + d)
+		if err == nil && len(txt) > 0 && strings.TrimSpace(txt[0]) != "" {
+			return strings.TrimSpace(txt[0]), true
+		}
+		i := strings.Index(d, ".")
+		if i < 0 {
+			break
+		}
+		d = d[i+1:]
+	}
+	return "", false
+}
+
+// GetKDCs returns the count of KDCs available and a map of KDC host names keyed on preference order. KDCs listed in
+// the krb5.conf are in the order listed, as MIT Kerberos tries them. KDCs found from SRV records are ordered by priority,
+// with those of equal priority in a random order weighted by their weights.
 func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
 	if realm == "" {
 		realm = c.LibDefaults.DefaultRealm
@@ -29,8 +52,9 @@ func (c *Config) GetKDCs(realm string, tcp bool) (int, map[int]string, error) {
 	count = len(ks)
 
 	if count > 0 {
-		// Order the kdcs randomly for preference.
-		kdcs = randServOrder(ks)
+		for i, k := range ks {
+			kdcs[i+1] = k
+		}
 		return count, kdcs, nil
 	}
 
@@ -115,7 +139,11 @@ func (c *Config) GetKpasswdServers(realm string, tcp bool) (int, map[int]string,
 	return count, kdcs, nil
 }
 
-func randServOrder(ks []string) map[int]string {
+// randServOrder returns the hosts provided keyed on a random preference order. The slice provided is not modified, as
+// it may be the configuration of a realm shared between clients.
+func randServOrder(hosts []string) map[int]string {
+	ks := make([]string, len(hosts))
+	copy(ks, hosts)
 	kdcs := make(map[int]string)
 	count := len(ks)
 	i := 1
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"net"
 	"testing"
 
 	"github.com/Osirium/gokrb5/v8/test"
@@ -89,3 +91,72 @@ func TestResolveKDC(t *testing.T) {
 	}
 	assert.Equal(t, "127.0.0.1:88", res[1], "KDC not read from config as expected")
 }
+
+func TestResolveRealm_DNSLookupRealm(t *testing.T) {
+	// Not parallel as the TXT record lookup is replaced
+	txt := map[string]string{
+		"_kerberos.example.com":       "EXAMPLE.COM",
+		"_kerberos.child.example.com": "CHILD.EXAMPLE.COM",
+	}
+	var lookups []string
+	lookupTXT = func(name string) ([]string, error) {
+		lookups = append(lookups, name)
+		if r, ok := txt[name]; ok {
+			return []string{r}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+	defer func() { lookupTXT = net.LookupTXT }()
+
+	c, err := NewFromString(`[libdefaults]
+ default_realm = TEST.GOKRB5
+ dns_lookup_realm = true
+[domain_realm]
+ .test.gokrb5 = TEST.GOKRB5
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.ResolveRealm("host.test.gokrb5"), "mapped realm not as expected")
+	assert.Empty(t, lookups, "mapped domain should not be looked up")
+	assert.Equal(t, "CHILD.EXAMPLE.COM", c.ResolveRealm("host.child.example.com"), "realm of TXT record not as expected")
+	assert.Equal(t, []string{"_kerberos.host.child.example.com", "_kerberos.child.example.com"}, lookups, "TXT record lookups not as expected")
+	assert.Equal(t, "EXAMPLE.COM", c.ResolveRealm("host.other.example.com"), "realm of parent domain's TXT record not as expected")
+	assert.Equal(t, "TEST.GOKRB5", c.ResolveRealm("host.example.org"), "realm without TXT record should be the default realm")
+
+	lookups = nil
+	c.LibDefaults.DNSLookupRealm = false
+	assert.Equal(t, "TEST.GOKRB5", c.ResolveRealm("host.example.com"), "realm should not be looked up unless configured to")
+	assert.Empty(t, lookups, "TXT records should not be looked up unless configured to")
+
+	lookupTXT = func(name string) ([]string, error) {
+		return nil, errors.New("lookup failed")
+	}
+	c.LibDefaults.DNSLookupRealm = true
+	assert.Equal(t, "TEST.GOKRB5", c.ResolveRealm("host.example.com"), "realm on lookup failure should be the default realm")
+}
+
+func TestConfig_GetKDCsConfiguredOrder(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`
+[realms]
+ TEST.GOKRB5 = {
+  kdc = kdc1.test.gokrb5:88
+  kdc = kdc2.test.gokrb5:88
+  kdc = kdc3.test.gokrb5:88
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	want := []string{"kdc1.test.gokrb5:88", "kdc2.test.gokrb5:88", "kdc3.test.gokrb5:88"}
+	for i := 0; i < 20; i++ {
+		count, kdcs, err := c.GetKDCs("TEST.GOKRB5", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, 3, count, "KDC count not as expected")
+		assert.Equal(t, want, []string{kdcs[1], kdcs[2], kdcs[3]}, "KDCs should be in the order configured")
+	}
+	assert.Equal(t, want, c.Realms[0].KDC, "the configured KDCs should not be reordered")
+}
@@ -11,11 +11,14 @@ import (
 	"net"
 	"os"
 	"os/user"
+	"path/filepath"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Osirium/gokrb5/v8/fips"
 	"github.com/Osirium/gokrb5/v8/iana/etypeID"
 	"github.com/jcmturner/gofork/encoding/asn1"
 )
@@ -25,13 +28,16 @@ type Config struct {
 	LibDefaults LibDefaults
 	Realms      []Realm
 	DomainRealm DomainRealm
-	//CaPaths
-	//AppDefaults
+	CaPaths     CaPaths
+	AppDefaults AppDefaults
 	//Plugins
+
+	// unknownSections are the names of the sections that are not parsed, for Validate to check.
+	unknownSections []string
 }
 
 // WeakETypeList is a list of encryption types that have been deemed weak.
-const WeakETypeList = "des-cbc-crc des-cbc-md4 des-cbc-md5 des-cbc-raw des3-cbc-raw des-hmac-sha1 arcfour-hmac-exp rc4-hmac-exp arcfour-hmac-md5-exp des"
+const WeakETypeList = "des-cbc-crc des-cbc-md4 des-cbc-md5 des-cbc-raw des3-cbc-raw des-hmac-sha1 arcfour-hmac rc4-hmac arcfour-hmac-md5 arcfour-hmac-exp rc4-hmac-exp arcfour-hmac-md5-exp des"
 
 // New creates a new config struct instance.
 func New() *Config {
@@ -39,6 +45,8 @@ func New() *Config {
 	return &Config{
 		LibDefaults: newLibDefaults(),
 		DomainRealm: d,
+		CaPaths:     make(CaPaths),
+		AppDefaults: newAppDefaults(),
 	}
 }
 
@@ -53,10 +61,10 @@ type LibDefaults struct {
 	DefaultClientKeytabName string //default /usr/local/var/krb5/user/%{euid}/client.keytab
 	DefaultKeytabName       string //default /etc/krb5.keytab
 	DefaultRealm            string
-	DefaultTGSEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
-	DefaultTktEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
-	DefaultTGSEnctypeIDs    []int32  //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
-	DefaultTktEnctypeIDs    []int32  //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
+	DefaultTGSEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192 aes128-cts-hmac-sha256-128 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
+	DefaultTktEnctypes      []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192 aes128-cts-hmac-sha256-128 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
+	DefaultTGSEnctypeIDs    []int32  //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192 aes128-cts-hmac-sha256-128 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
+	DefaultTktEnctypeIDs    []int32  //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192 aes128-cts-hmac-sha256-128 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
 	DNSCanonicalizeHostname bool     //default true
 	DNSLookupKDC            bool     //default false
 	DNSLookupRealm          bool
@@ -67,9 +75,11 @@ type LibDefaults struct {
 	K5LoginDirectory        string         //default user's home directory. Must be owned by the user or root
 	KDCDefaultOptions       asn1.BitString //default 0x00000010 (KDC_OPT_RENEWABLE_OK)
 	KDCTimeSync             int            //default 1
+	KDCTimeout              time.Duration  //default 0, the client's own default of 5 seconds
 	//kdc_req_checksum_type int //unlikely to implement as for very old KDCs
+	MaxRetries          int      //default 0, the client's own default of a single attempt
 	NoAddresses         bool     //default true
-	PermittedEnctypes   []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
+	PermittedEnctypes   []string //default aes256-cts-hmac-sha1-96 aes128-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192 aes128-cts-hmac-sha256-128 des3-cbc-sha1 arcfour-hmac-md5 camellia256-cts-cmac camellia128-cts-cmac des-cbc-crc des-cbc-md5 des-cbc-md4
 	PermittedEnctypeIDs []int32
 	//plugin_base_dir string //not supporting plugins
 	PreferredPreauthTypes []int         //default “17, 16, 15, 14”, which forces libkrb5 to attempt to use PKINIT if it is supported
@@ -81,6 +91,15 @@ type LibDefaults struct {
 	TicketLifetime        time.Duration //default 1 day
 	UDPPreferenceLimit    int           // 1 means to always use tcp. MIT krb5 has a default value of 1465, and it prevents user setting more than 32700.
 	VerifyAPReqNofail     bool          //default false
+
+	// The time allowed for exchanges with KDCs over UDP, TCP and HTTPS to a KDC proxy, in place of KDCTimeout.
+	// These are gokrb5 extensions to the libdefaults section, as kdc_timeout_udp, kdc_timeout_tcp and kdc_timeout_https.
+	KDCTimeoutUDP   time.Duration
+	KDCTimeoutTCP   time.Duration
+	KDCTimeoutHTTPS time.Duration
+
+	// relations holds the values as configured of all relations, understood or not, for AppDefault to fall back to.
+	relations map[string]string
 }
 
 // Create a new LibDefaults struct.
@@ -100,25 +119,29 @@ func newLibDefaults() LibDefaults {
 		Clockskew:               time.Duration(300) * time.Second,
 		DefaultClientKeytabName: fmt.Sprintf("/usr/local/var/krb5/user/%s/client.keytab", uid),
 		DefaultKeytabName:       "/etc/krb5.keytab",
-		DefaultTGSEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
-		DefaultTktEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
+		DefaultTGSEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "aes256-cts-hmac-sha384-192", "aes128-cts-hmac-sha256-128", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
+		DefaultTktEnctypes:      []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "aes256-cts-hmac-sha384-192", "aes128-cts-hmac-sha256-128", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
 		DNSCanonicalizeHostname: true,
 		K5LoginDirectory:        hdir,
 		KDCDefaultOptions:       opts,
 		KDCTimeSync:             1,
 		NoAddresses:             true,
-		PermittedEnctypes:       []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
+		PermittedEnctypes:       []string{"aes256-cts-hmac-sha1-96", "aes128-cts-hmac-sha1-96", "aes256-cts-hmac-sha384-192", "aes128-cts-hmac-sha256-128", "des3-cbc-sha1", "arcfour-hmac-md5", "camellia256-cts-cmac", "camellia128-cts-cmac", "des-cbc-crc", "des-cbc-md5", "des-cbc-md4"},
 		RDNS:                    true,
 		RealmTryDomains:         -1,
 		SafeChecksumType:        8,
 		TicketLifetime:          time.Duration(24) * time.Hour,
 		UDPPreferenceLimit:      1465,
 		PreferredPreauthTypes:   []int{17, 16, 15, 14},
+		relations:               make(map[string]string),
 	}
 }
 
 // Parse the lines of the [libdefaults] section of the configuration into the LibDefaults struct.
 func (l *LibDefaults) parseLines(lines []string) error {
+	if l.relations == nil {
+		l.relations = make(map[string]string)
+	}
 	for _, line := range lines {
 		//Remove comments after the values
 		if idx := strings.IndexAny(line, "#;"); idx != -1 {
@@ -134,6 +157,9 @@ func (l *LibDefaults) parseLines(lines []string) error {
 
 		p := strings.Split(line, "=")
 		key := strings.TrimSpace(strings.ToLower(p[0]))
+		if _, ok := l.relations[key]; !ok {
+			l.relations[key] = strings.TrimSpace(line[strings.Index(line, "=")+1:])
+		}
 		switch key {
 		case "allow_weak_crypto":
 			v, err := parseBoolean(p[1])
@@ -231,6 +257,28 @@ func (l *LibDefaults) parseLines(lines []string) error {
 				return InvalidErrorf("libdefaults section line (%s)", line)
 			}
 			l.KDCTimeSync = int(v)
+		case "kdc_timeout", "kdc_timeout_udp", "kdc_timeout_tcp", "kdc_timeout_https":
+			d, err := parseDuration(p[1])
+			if err != nil || d < 0 {
+				return InvalidErrorf("libdefaults section line (%s)", line)
+			}
+			switch key {
+			case "kdc_timeout":
+				l.KDCTimeout = d
+			case "kdc_timeout_udp":
+				l.KDCTimeoutUDP = d
+			case "kdc_timeout_tcp":
+				l.KDCTimeoutTCP = d
+			default:
+				l.KDCTimeoutHTTPS = d
+			}
+		case "max_retries":
+			p[1] = strings.TrimSpace(p[1])
+			v, err := strconv.ParseInt(p[1], 10, 32)
+			if err != nil || v < 0 {
+				return InvalidErrorf("libdefaults section line (%s)", line)
+			}
+			l.MaxRetries = int(v)
 		case "noaddresses":
 			v, err := parseBoolean(p[1])
 			if err != nil {
@@ -305,6 +353,23 @@ func (l *LibDefaults) parseLines(lines []string) error {
 		}
 	}
 	l.SetDefaultEnctypeIDs()
+	if fips.Enabled() {
+		if l.AllowWeakCrypto {
+			return InvalidErrorf("libdefaults section: allow_weak_crypto cannot be enabled in FIPS mode")
+		}
+		for _, e := range []struct {
+			name string
+			ids  []int32
+		}{
+			{"default_tgs_enctypes", l.DefaultTGSEnctypeIDs},
+			{"default_tkt_enctypes", l.DefaultTktEnctypeIDs},
+			{"permitted_enctypes", l.PermittedEnctypeIDs},
+		} {
+			if len(e.ids) == 0 {
+				return InvalidErrorf("libdefaults section: %s contains no encryption types permitted in FIPS mode", e.name)
+			}
+		}
+	}
 	return nil
 }
 
@@ -325,11 +390,18 @@ type Realm struct {
 	KDC           []string
 	KPasswdServer []string //default admin_server:464
 	MasterKDC     []string
+	// PKINITKDCHostname lists the host names the PKINIT certificate of a KDC of the realm may be issued to, with a DNS
+	// name subject alternative name, rather than to the realm's krbtgt principal.
+	PKINITKDCHostname []string
+
+	// relations holds the values as configured of the relations outside subsections, for AppDefault to fall back to.
+	relations map[string]string
 }
 
 // Parse the lines of a [realms] entry into the Realm struct.
 func (r *Realm) parseLines(name string, lines []string) (err error) {
 	r.Realm = name
+	r.relations = make(map[string]string)
 	var adminServerFinal bool
 	var KDCFinal bool
 	var kpasswdServerFinal bool
@@ -378,6 +450,9 @@ func (r *Realm) parseLines(name string, lines []string) (err error) {
 		p := strings.Split(line, "=")
 		key := strings.TrimSpace(strings.ToLower(p[0]))
 		v := strings.TrimSpace(p[1])
+		if _, ok := r.relations[key]; !ok && c == 0 && !strings.ContainsAny(line, "{}") {
+			r.relations[key] = strings.TrimSpace(line[strings.Index(line, "=")+1:])
+		}
 		switch key {
 		case "admin_server":
 			appendUntilFinal(&r.AdminServer, v, &adminServerFinal)
@@ -397,6 +472,8 @@ func (r *Realm) parseLines(name string, lines []string) (err error) {
 			appendUntilFinal(&r.KPasswdServer, v, &kpasswdServerFinal)
 		case "master_kdc":
 			appendUntilFinal(&r.MasterKDC, v, &masterKDCFinal)
+		case "pkinit_kdc_hostname":
+			r.PKINITKDCHostname = append(r.PKINITKDCHostname, v)
 		}
 	}
 	//default for Kpasswd_server = admin_server:464
@@ -460,6 +537,39 @@ func parseRealms(lines []string) (realms []Realm, err error) {
 	return
 }
 
+// setRealm adds the realm to the configuration. A realm defined more than once, for example in included files, is
+// merged into its first definition.
+func (c *Config) setRealm(r Realm) {
+	for i := range c.Realms {
+		if c.Realms[i].Realm == r.Realm {
+			c.Realms[i].merge(r)
+			return
+		}
+	}
+	c.Realms = append(c.Realms, r)
+}
+
+// merge adds the servers of another definition of the realm to those of the realm. As MIT Kerberos does, the values
+// of the realm's relations are those of the first definition that sets them.
+func (r *Realm) merge(o Realm) {
+	r.AdminServer = append(r.AdminServer, o.AdminServer...)
+	r.KDC = append(r.KDC, o.KDC...)
+	r.KPasswdServer = append(r.KPasswdServer, o.KPasswdServer...)
+	r.MasterKDC = append(r.MasterKDC, o.MasterKDC...)
+	r.PKINITKDCHostname = append(r.PKINITKDCHostname, o.PKINITKDCHostname...)
+	if r.DefaultDomain == "" {
+		r.DefaultDomain = o.DefaultDomain
+	}
+	if r.relations == nil {
+		r.relations = make(map[string]string)
+	}
+	for k, v := range o.relations {
+		if _, ok := r.relations[k]; !ok {
+			r.relations[k] = v
+		}
+	}
+}
+
 // DomainRealm maps the domains to realms representing the [domain_realm] section of the configuration.
 type DomainRealm map[string]string
 
@@ -478,6 +588,8 @@ func (d *DomainRealm) parseLines(lines []string) error {
 		}
 		p := strings.Split(line, "=")
 		domain := strings.TrimSpace(strings.ToLower(p[0]))
+		// A wildcard mapping of the subdomains of a domain is the same as one prefixed with a period
+		domain = strings.TrimPrefix(domain, "*")
 		realm := strings.TrimSpace(p[1])
 		d.addMapping(domain, realm)
 	}
@@ -495,9 +607,11 @@ func (d *DomainRealm) deleteMapping(domain, realm string) {
 }
 
 // ResolveRealm resolves the kerberos realm for the specified domain name from the domain to realm mapping.
-// The most specific mapping is returned.
+// The most specific mapping is returned: that of the domain name itself, otherwise that of its longest parent domain
+// mapped with a leading period. If no mapping matches and dns_lookup_realm is enabled the realm is looked up in the
+// _kerberos TXT records of the domain name and its parent domains. Failing that the default realm is returned.
 func (c *Config) ResolveRealm(domainName string) string {
-	domainName = strings.TrimSuffix(domainName, ".")
+	domainName = strings.ToLower(strings.TrimSuffix(domainName, "."))
 
 	// Try to match the entire hostname first
 	if r, ok := c.DomainRealm[domainName]; ok {
@@ -512,9 +626,183 @@ func (c *Config) ResolveRealm(domainName string) string {
 			return r
 		}
 	}
+
+	if c.LibDefaults.DNSLookupRealm {
+		if r, ok := lookupRealm(domainName); ok {
+			return r
+		}
+	}
 	return c.LibDefaults.DefaultRealm
 }
 
+// CaPaths represents the [capaths] section of the configuration. It maps a client realm and a server realm to the
+// intermediate realms, in order, that authentication between them traverses. No intermediate realms means the server
+// realm shares a key with the client realm directly.
+type CaPaths map[string]map[string][]string
+
+// Parse the lines of the [capaths] section of the configuration and add to the paths.
+func (p *CaPaths) parseLines(lines []string) error {
+	var client string
+	for _, line := range lines {
+		//Remove comments after the values
+		if idx := strings.IndexAny(line, "#;"); idx != -1 {
+			line = line[:idx]
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, "}") {
+			if client == "" {
+				return InvalidErrorf("unpaired curly brackets")
+			}
+			client = ""
+			continue
+		}
+		if !strings.Contains(line, "=") {
+			return InvalidErrorf("capaths line (%s)", line)
+		}
+		i := strings.Index(line, "=")
+		k := strings.TrimSpace(line[:i])
+		v := strings.TrimSpace(line[i+1:])
+		if v == "{" {
+			if client != "" {
+				return InvalidErrorf("capaths line (%s)", line)
+			}
+			client = k
+			if _, ok := (*p)[client]; !ok {
+				(*p)[client] = make(map[string][]string)
+			}
+			continue
+		}
+		if client == "" {
+			return InvalidErrorf("capaths line (%s)", line)
+		}
+		// An intermediate realm of "." means the server realm is reached directly. Each intermediate realm can be a
+		// separate entry or they can be listed in one entry separated by spaces.
+		r := (*p)[client][k]
+		for _, f := range strings.Fields(v) {
+			if f != "." {
+				r = append(r, f)
+			}
+		}
+		if r == nil {
+			r = []string{}
+		}
+		(*p)[client][k] = r
+	}
+	if client != "" {
+		return InvalidErrorf("unpaired curly brackets")
+	}
+	return nil
+}
+
+// Path returns the realms traversed from the client realm to the server realm, excluding the client realm, as the
+// [capaths] section has them. A path configured for the two realms is used if there is one. Otherwise each configured
+// path is taken as a series of trust links, from the client realm through each intermediate realm to the server realm,
+// and the path with the fewest links is found across them, so that a path of several hops can be configured one hop
+// at a time. The indicator returned is false if the [capaths] section has no path between the realms.
+func (p CaPaths) Path(clientRealm, serverRealm string) ([]string, bool) {
+	if r, ok := p[clientRealm][serverRealm]; ok {
+		path := make([]string, len(r), len(r)+1)
+		copy(path, r)
+		return append(path, serverRealm), true
+	}
+	links := p.links()
+	// A breadth first search of the links finds the path with the fewest
+	prev := map[string]string{clientRealm: ""}
+	queue := []string{clientRealm}
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+		for _, next := range links[r] {
+			if _, ok := prev[next]; ok {
+				continue
+			}
+			prev[next] = r
+			if next == serverRealm {
+				var path []string
+				for n := next; n != clientRealm; n = prev[n] {
+					path = append([]string{n}, path...)
+				}
+				return path, true
+			}
+			queue = append(queue, next)
+		}
+	}
+	return nil, false
+}
+
+// links returns the realms each realm has a trust link to, in name order, from the paths of the [capaths] section.
+func (p CaPaths) links() map[string][]string {
+	seen := make(map[[2]string]bool)
+	links := make(map[string][]string)
+	for client, servers := range p {
+		for server, intermediate := range servers {
+			path := append(append([]string{client}, intermediate...), server)
+			for i := 1; i < len(path); i++ {
+				l := [2]string{path[i-1], path[i]}
+				if l[0] == l[1] || seen[l] {
+					continue
+				}
+				seen[l] = true
+				links[l[0]] = append(links[l[0]], l[1])
+			}
+		}
+	}
+	for _, l := range links {
+		sort.Strings(l)
+	}
+	return links
+}
+
+// RealmPath returns the realms to obtain cross-realm TGTs for, in order, to authenticate from the client realm to the
+// server realm. The last realm is the server realm. The path is taken from the [capaths] section of the
+// configuration if it has one between the realms, otherwise it follows the realm hierarchy up from the client realm
+// to the realm the two have in common and then down to the server realm. Realms with nothing in common are expected
+// to share a key directly.
+func (c *Config) RealmPath(clientRealm, serverRealm string) []string {
+	if clientRealm == serverRealm {
+		return nil
+	}
+	if p, ok := c.CaPaths.Path(clientRealm, serverRealm); ok {
+		return p
+	}
+	return HierarchicalPath(clientRealm, serverRealm)
+}
+
+// HierarchicalPath returns the realms traversed from one realm to another following the hierarchy of domain style
+// realm names, excluding the realm started from. For example from ENG.EXAMPLE.COM to SALES.EXAMPLE.COM the path is
+// EXAMPLE.COM then SALES.EXAMPLE.COM. Realms with no parent in common are traversed directly.
+func HierarchicalPath(from, to string) []string {
+	if from == to {
+		return nil
+	}
+	f := strings.Split(from, ".")
+	t := strings.Split(to, ".")
+	// Count the trailing components the realms have in common
+	var n int
+	for n < len(f) && n < len(t) && f[len(f)-1-n] == t[len(t)-1-n] {
+		n++
+	}
+	if n == 0 {
+		return []string{to}
+	}
+	var p []string
+	// Up the hierarchy from the realm started from to the common parent
+	for i := 1; i < len(f)-n; i++ {
+		p = append(p, strings.Join(f[i:], "."))
+	}
+	if n < len(f) {
+		p = append(p, strings.Join(f[len(f)-n:], "."))
+	}
+	// Down the hierarchy from the common parent to the realm going to
+	for i := len(t) - n - 1; i >= 0; i-- {
+		p = append(p, strings.Join(t[i:], "."))
+	}
+	return p
+}
+
 // Load the KRB5 configuration from the specified file path.
 func Load(cfgPath string) (*Config, error) {
 	fh, err := os.Open(cfgPath)
@@ -526,6 +814,82 @@ func Load(cfgPath string) (*Config, error) {
 	return NewFromScanner(scanner)
 }
 
+// DefaultConfigPath is the path of the configuration file loaded by LoadDefault if KRB5_CONFIG is not set.
+const DefaultConfigPath = "/etc/krb5.conf"
+
+// LoadDefault loads the KRB5 configuration as MIT Kerberos does: from the files listed in the KRB5_CONFIG environment
+// variable, separated as paths are in PATH, or if it is not set from DefaultConfigPath. Files that do not exist are
+// skipped. Where the files set the same relation the value of the file listed first is used.
+func LoadDefault() (*Config, error) {
+	paths := os.Getenv("KRB5_CONFIG")
+	if paths == "" {
+		paths = DefaultConfigPath
+	}
+	var c *Config
+	var e error
+	for _, p := range filepath.SplitList(paths) {
+		if p == "" {
+			continue
+		}
+		if _, err := os.Stat(p); err != nil {
+			continue
+		}
+		f, err := Load(p)
+		if err != nil {
+			if _, ok := err.(UnsupportedDirective); !ok {
+				return nil, err
+			}
+			e = err
+		}
+		if c == nil {
+			c = f
+			continue
+		}
+		if err := c.merge(f); err != nil {
+			return nil, fmt.Errorf("error merging configuration file %s: %v", p, err)
+		}
+	}
+	if c == nil {
+		return nil, errors.New("no configuration file found in " + paths)
+	}
+	return c, e
+}
+
+// merge adds the configuration of another file to the configuration. The values already set take precedence.
+func (c *Config) merge(o *Config) error {
+	var lines []string
+	for k, v := range o.LibDefaults.relations {
+		if _, ok := c.LibDefaults.relations[k]; !ok {
+			lines = append(lines, k+" = "+v)
+		}
+	}
+	sort.Strings(lines)
+	if err := c.LibDefaults.parseLines(lines); err != nil {
+		return err
+	}
+	for _, r := range o.Realms {
+		c.setRealm(r)
+	}
+	for d, r := range o.DomainRealm {
+		if _, ok := c.DomainRealm[d]; !ok {
+			c.DomainRealm[d] = r
+		}
+	}
+	for client, servers := range o.CaPaths {
+		if _, ok := c.CaPaths[client]; !ok {
+			c.CaPaths[client] = make(map[string][]string)
+		}
+		for server, path := range servers {
+			if _, ok := c.CaPaths[client][server]; !ok {
+				c.CaPaths[client][server] = path
+			}
+		}
+	}
+	c.AppDefaults.merge(o.AppDefaults)
+	c.unknownSections = append(c.unknownSections, o.unknownSections...)
+	return nil
+}
+
 // NewFromString creates a new Config struct from a string.
 func NewFromString(s string) (*Config, error) {
 	reader := strings.NewReader(s)
@@ -539,38 +903,54 @@ func NewFromReader(r io.Reader) (*Config, error) {
 }
 
 // NewFromScanner creates a new Config struct from a bufio.Scanner.
+// The include and includedir directives are processed, the included files being read from the file system.
 func NewFromScanner(scanner *bufio.Scanner) (*Config, error) {
 	c := New()
 	var e error
 	sections := make(map[int]string)
 	var sectionLineNum []int
 	var lines []string
-	for scanner.Scan() {
+	cfgLines, err := readLines(scanner, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, text := range cfgLines {
 		// Skip comments and blank lines
-		if matched, _ := regexp.MatchString(`^\s*(#|;|\n)`, scanner.Text()); matched {
+		if matched, _ := regexp.MatchString(`^\s*(#|;|\n)`, text); matched {
 			continue
 		}
-		if matched, _ := regexp.MatchString(`^\s*\[libdefaults\]\s*`, scanner.Text()); matched {
+		if matched, _ := regexp.MatchString(`^\s*\[libdefaults\]\s*`, text); matched {
 			sections[len(lines)] = "libdefaults"
 			sectionLineNum = append(sectionLineNum, len(lines))
 			continue
 		}
-		if matched, _ := regexp.MatchString(`^\s*\[realms\]\s*`, scanner.Text()); matched {
+		if matched, _ := regexp.MatchString(`^\s*\[realms\]\s*`, text); matched {
 			sections[len(lines)] = "realms"
 			sectionLineNum = append(sectionLineNum, len(lines))
 			continue
 		}
-		if matched, _ := regexp.MatchString(`^\s*\[domain_realm\]\s*`, scanner.Text()); matched {
+		if matched, _ := regexp.MatchString(`^\s*\[domain_realm\]\s*`, text); matched {
 			sections[len(lines)] = "domain_realm"
 			sectionLineNum = append(sectionLineNum, len(lines))
 			continue
 		}
-		if matched, _ := regexp.MatchString(`^\s*\[.*\]\s*`, scanner.Text()); matched {
+		if matched, _ := regexp.MatchString(`^\s*\[capaths\]\s*`, text); matched {
+			sections[len(lines)] = "capaths"
+			sectionLineNum = append(sectionLineNum, len(lines))
+			continue
+		}
+		if matched, _ := regexp.MatchString(`^\s*\[appdefaults\]\s*`, text); matched {
+			sections[len(lines)] = "appdefaults"
+			sectionLineNum = append(sectionLineNum, len(lines))
+			continue
+		}
+		if matched, _ := regexp.MatchString(`^\s*\[.*\]\s*`, text); matched {
 			sections[len(lines)] = "unknown_section"
+			c.unknownSections = append(c.unknownSections, strings.Trim(strings.TrimSpace(text), "[]"))
 			sectionLineNum = append(sectionLineNum, len(lines))
 			continue
 		}
-		lines = append(lines, scanner.Text())
+		lines = append(lines, text)
 	}
 	for i, start := range sectionLineNum {
 		var end int
@@ -596,7 +976,10 @@ func NewFromScanner(scanner *bufio.Scanner) (*Config, error) {
 				}
 				e = err
 			}
-			c.Realms = realms
+			// Included files may have further [realms] sections
+			for _, r := range realms {
+				c.setRealm(r)
+			}
 		case "domain_realm":
 			err := c.DomainRealm.parseLines(lines[start:end])
 			if err != nil {
@@ -605,15 +988,141 @@ func NewFromScanner(scanner *bufio.Scanner) (*Config, error) {
 				}
 				e = err
 			}
+		case "capaths":
+			err := c.CaPaths.parseLines(lines[start:end])
+			if err != nil {
+				return nil, fmt.Errorf("error processing capaths section: %v", err)
+			}
+		case "appdefaults":
+			err := c.AppDefaults.parseLines(lines[start:end])
+			if err != nil {
+				return nil, fmt.Errorf("error processing appdefaults section: %v", err)
+			}
 		}
 	}
 	return c, e
 }
 
-// Parse a space delimited list of ETypes into a list of EType numbers optionally filtering out weak ETypes.
+// maxIncludeDepth limits the nesting of included files, so that an include loop is an error.
+const maxIncludeDepth = 16
+
+var (
+	includeRegexp    = regexp.MustCompile(`^include\s+(\S.*?)\s*$`)
+	includeDirRegexp = regexp.MustCompile(`^includedir\s+(\S.*?)\s*$`)
+	sectionRegexp    = regexp.MustCompile(`^\s*\[.*\]`)
+)
+
+// readLines returns the lines read by the scanner with the lines of the files named by include and includedir
+// directives, which must be at the beginning of a line, in place of the directives.
+func readLines(scanner *bufio.Scanner, depth int) ([]string, error) {
+	var lines []string
+	var section string
+	for scanner.Scan() {
+		l := scanner.Text()
+		var included []string
+		var err error
+		if m := includeRegexp.FindStringSubmatch(l); m != nil {
+			included, err = includeFile(m[1], depth+1)
+		} else if m := includeDirRegexp.FindStringSubmatch(l); m != nil {
+			included, err = includeDir(m[1], depth+1)
+		} else {
+			if sectionRegexp.MatchString(l) {
+				section = l
+			}
+			lines = append(lines, l)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, included...)
+		// An included file is independent of the file including it, which carries on in the section it was in
+		if section != "" {
+			lines = append(lines, section)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading configuration: %v", err)
+	}
+	return lines, nil
+}
+
+// includeFile returns the lines of the included file.
+func includeFile(path string, depth int) ([]string, error) {
+	if !filepath.IsAbs(path) {
+		return nil, errors.New("included configuration file path is not absolute: " + path)
+	}
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("configuration includes nested more than %d deep including %s", maxIncludeDepth, path)
+	}
+	fh, err := os.Open(path)
+	if err != nil {
+		return nil, errors.New("included configuration file could not be opened: " + path + " " + err.Error())
+	}
+	defer fh.Close()
+	return readLines(bufio.NewScanner(fh), depth)
+}
+
+// includeDir returns the lines of the files of the included directory, in the order of their names. As MIT Kerberos
+// does, only files with names of alphanumeric characters, dashes and underscores, or ending in .conf, are included,
+// ignoring names beginning with a dot.
+func includeDir(dir string, depth int) ([]string, error) {
+	if !filepath.IsAbs(dir) {
+		return nil, errors.New("included configuration directory path is not absolute: " + dir)
+	}
+	fh, err := os.Open(dir)
+	if err != nil {
+		return nil, errors.New("included configuration directory could not be opened: " + dir + " " + err.Error())
+	}
+	names, err := fh.Readdirnames(-1)
+	fh.Close()
+	if err != nil {
+		return nil, errors.New("included configuration directory could not be read: " + dir + " " + err.Error())
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		if !includedFileName(name) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		l, err := includeFile(path, depth)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, l...)
+	}
+	return lines, nil
+}
+
+// includedFileName indicates if a file of an included directory is included, by its name.
+func includedFileName(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+	if strings.HasSuffix(name, ".conf") {
+		return true
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse a space delimited list of ETypes into a list of EType numbers optionally filtering out weak ETypes. In FIPS mode
+// ETypes that are not FIPS approved are also filtered out.
 func parseETypes(s []string, w bool) []int32 {
 	var eti []int32
 	for _, et := range s {
+		i := etypeID.EtypeSupported(et)
+		if fips.Enabled() && !fips.ApprovedEType(i) {
+			continue
+		}
 		if !w {
 			var weak bool
 			for _, wet := range strings.Fields(WeakETypeList) {
@@ -626,7 +1135,6 @@ func parseETypes(s []string, w bool) []int32 {
 				continue
 			}
 		}
-		i := etypeID.EtypeSupported(et)
 		if i != 0 {
 			eti = append(eti, i)
 		}
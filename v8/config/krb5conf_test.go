@@ -3,6 +3,8 @@ package config
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -67,6 +69,13 @@ const (
  hostname2.example.com = TEST.GOKRB5
  .testlowercase.org = lowercase.org
 
+[capaths]
+ TEST.GOKRB5 = {
+  EXAMPLE.COM = .
+  lowercase.org = EXAMPLE.COM ; comment to be ignored
+  lowercase.org = INTERMEDIATE.ORG
+  OTHER.ORG = EXAMPLE.COM INTERMEDIATE.ORG
+ }
 
 [appdefaults]
  pam = {
@@ -91,6 +100,8 @@ const (
     "DefaultTGSEnctypes": [
       "aes256-cts-hmac-sha1-96",
       "aes128-cts-hmac-sha1-96",
+      "aes256-cts-hmac-sha384-192",
+      "aes128-cts-hmac-sha256-128",
       "des3-cbc-sha1",
       "arcfour-hmac-md5",
       "camellia256-cts-cmac",
@@ -106,7 +117,8 @@ const (
     "DefaultTGSEnctypeIDs": [
       18,
       17,
-      23
+      20,
+      19
     ],
     "DefaultTktEnctypeIDs": [
       18,
@@ -125,10 +137,14 @@ const (
       "BitLength": 32
     },
     "KDCTimeSync": 1,
+    "KDCTimeout": 0,
+    "MaxRetries": 0,
     "NoAddresses": true,
     "PermittedEnctypes": [
       "aes256-cts-hmac-sha1-96",
       "aes128-cts-hmac-sha1-96",
+      "aes256-cts-hmac-sha384-192",
+      "aes128-cts-hmac-sha256-128",
       "des3-cbc-sha1",
       "arcfour-hmac-md5",
       "camellia256-cts-cmac",
@@ -140,7 +156,8 @@ const (
     "PermittedEnctypeIDs": [
       18,
       17,
-      23
+      20,
+      19
     ],
     "PreferredPreauthTypes": [
       17,
@@ -155,7 +172,10 @@ const (
     "SafeChecksumType": 8,
     "TicketLifetime": 36000000000000,
     "UDPPreferenceLimit": 1465,
-    "VerifyAPReqNofail": false
+    "VerifyAPReqNofail": false,
+    "KDCTimeoutUDP": 0,
+    "KDCTimeoutTCP": 0,
+    "KDCTimeoutHTTPS": 0
   },
   "Realms": [
     {
@@ -173,7 +193,8 @@ const (
       "KPasswdServer": [
         "10.80.88.88:464"
       ],
-      "MasterKDC": null
+      "MasterKDC": null,
+      "PKINITKDCHostname": null
     },
     {
       "Realm": "EXAMPLE.COM",
@@ -188,7 +209,8 @@ const (
       "KPasswdServer": [
         "kerberos.example.com:464"
       ],
-      "MasterKDC": null
+      "MasterKDC": null,
+      "PKINITKDCHostname": null
     },
     {
       "Realm": "lowercase.org",
@@ -202,7 +224,8 @@ const (
       "KPasswdServer": [
         "kerberos.lowercase.org:464"
       ],
-      "MasterKDC": null
+      "MasterKDC": null,
+      "PKINITKDCHostname": null
     }
   ],
   "DomainRealm": {
@@ -212,6 +235,32 @@ const (
     "hostname1.example.com": "EXAMPLE.COM",
     "hostname2.example.com": "TEST.GOKRB5",
     "test.gokrb5": "TEST.GOKRB5"
+  },
+  "CaPaths": {
+    "TEST.GOKRB5": {
+      "EXAMPLE.COM": [],
+      "OTHER.ORG": [
+        "EXAMPLE.COM",
+        "INTERMEDIATE.ORG"
+      ],
+      "lowercase.org": [
+        "EXAMPLE.COM",
+        "INTERMEDIATE.ORG"
+      ]
+    }
+  },
+  "AppDefaults": {
+    "Subsections": {
+      "pam": {
+        "Relations": {
+          "debug": "false",
+          "forwardable": "true",
+          "krb4_convert": "false",
+          "renew_lifetime": "36000",
+          "ticket_lifetime": "36000"
+        }
+      }
+    }
   }
 }`
 	krb5Conf2 = `
@@ -475,6 +524,90 @@ func TestLoad(t *testing.T) {
 	assert.Equal(t, "TEST.GOKRB5", c.DomainRealm[".test.gokrb5"], "Domain to realm mapping not as expected")
 	assert.Equal(t, "TEST.GOKRB5", c.DomainRealm["test.gokrb5"], "Domain to realm mapping not as expected")
 
+	assert.Equal(t, []string{}, c.CaPaths["TEST.GOKRB5"]["EXAMPLE.COM"], "[capaths] direct path not as expected")
+	assert.Equal(t, []string{"EXAMPLE.COM", "INTERMEDIATE.ORG"}, c.CaPaths["TEST.GOKRB5"]["lowercase.org"], "[capaths] path not as expected")
+	assert.Equal(t, []string{"EXAMPLE.COM", "INTERMEDIATE.ORG"}, c.CaPaths["TEST.GOKRB5"]["OTHER.ORG"], "[capaths] path not as expected")
+}
+
+func TestLoadInclude(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir(os.TempDir(), "TEST-gokrb5-krb5.conf.d")
+	if err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		// Included in the order of their names
+		"b-realm.conf": "[realms]\n SSSD.GOKRB5 = {\n  kdc = 10.80.88.90\n }\n",
+		"a_domains":    "[domain_realm]\n .sssd.gokrb5 = SSSD.GOKRB5\n",
+		// Not included
+		".hidden.conf": "[libdefaults]\n default_realm = HIDDEN.GOKRB5\n",
+		"backup.bak":   "[libdefaults]\n default_realm = BACKUP.GOKRB5\n",
+		"file~":        "[libdefaults]\n default_realm = EDITOR.GOKRB5\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatalf("Error writing included file: %v", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "subdir"), 0700); err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	inc, _ := ioutil.TempFile(os.TempDir(), "TEST-gokrb5-krb5.conf")
+	defer os.Remove(inc.Name())
+	inc.WriteString("[libdefaults]\n ticket_lifetime = 5h\n")
+
+	c, err := NewFromString(`[libdefaults]
+ default_realm = TEST.GOKRB5
+include ` + inc.Name() + `
+ forwardable = true
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 10.80.88.88
+ }
+
+includedir ` + dir + `
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.DefaultRealm, "[libdefaults] default_realm not as expected")
+	assert.Equal(t, 5*time.Hour, c.LibDefaults.TicketLifetime, "[libdefaults] ticket_lifetime of included file not as expected")
+	assert.True(t, c.LibDefaults.Forwardable, "[libdefaults] after include not as expected")
+	assert.Equal(t, 2, len(c.Realms), "Number of realms not as expected")
+	assert.Equal(t, "TEST.GOKRB5", c.Realms[0].Realm, "[realm] realm name not as expected")
+	assert.Equal(t, "SSSD.GOKRB5", c.Realms[1].Realm, "[realm] realm name of included directory not as expected")
+	assert.Equal(t, []string{"10.80.88.90:88"}, c.Realms[1].KDC, "[realm] kdc of included directory not as expected")
+	assert.Equal(t, "SSSD.GOKRB5", c.DomainRealm[".sssd.gokrb5"], "Domain to realm mapping of included directory not as expected")
+
+	_, err = NewFromString("include " + filepath.Join(dir, "missing.conf") + "\n")
+	assert.Error(t, err, "missing included file should be an error")
+	_, err = NewFromString("includedir krb5.conf.d\n")
+	assert.Error(t, err, "relative included directory path should be an error")
+
+	// An include loop is an error rather than recursing without end
+	loop := filepath.Join(dir, "loop")
+	if err := ioutil.WriteFile(loop, []byte("include "+loop+"\n"), 0600); err != nil {
+		t.Fatalf("Error writing included file: %v", err)
+	}
+	_, err = NewFromString("include " + loop + "\n")
+	assert.Error(t, err, "include loop should be an error")
+}
+
+func TestIncludedFileName(t *testing.T) {
+	t.Parallel()
+	for name, included := range map[string]bool{
+		"sssd_realm":   true,
+		"realm-1":      true,
+		"realm.conf":   true,
+		".realm.conf":  false,
+		"realm.conf~":  false,
+		"realm.rpmnew": false,
+		"#realm#":      false,
+	} {
+		assert.Equal(t, included, includedFileName(name), "inclusion of %s not as expected", name)
+	}
 }
 
 func TestLoadWithV4Lines(t *testing.T) {
@@ -608,6 +741,29 @@ func TestLoadTabs(t *testing.T) {
 
 }
 
+func TestLibDefaults_KDCTimeouts(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`[libdefaults]
+ kdc_timeout = 3s
+ kdc_timeout_udp = 1
+ kdc_timeout_https = 1m
+ max_retries = 3
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	assert.Equal(t, 3*time.Second, c.LibDefaults.KDCTimeout, "kdc_timeout not as expected")
+	assert.Equal(t, time.Second, c.LibDefaults.KDCTimeoutUDP, "kdc_timeout_udp not as expected")
+	assert.Equal(t, time.Duration(0), c.LibDefaults.KDCTimeoutTCP, "kdc_timeout_tcp not set should be zero")
+	assert.Equal(t, time.Minute, c.LibDefaults.KDCTimeoutHTTPS, "kdc_timeout_https not as expected")
+	assert.Equal(t, 3, c.LibDefaults.MaxRetries, "max_retries not as expected")
+
+	for _, s := range []string{"[libdefaults]\n kdc_timeout = soon\n", "[libdefaults]\n max_retries = -1\n"} {
+		_, err := NewFromString(s)
+		assert.Error(t, err, "invalid value should be an error: %s", s)
+	}
+}
+
 func TestParseDuration(t *testing.T) {
 	t.Parallel()
 	// https://web.mit.edu/kerberos/krb5-1.12/doc/basic/date_format.html#duration
@@ -654,7 +810,12 @@ func TestResolveRealm(t *testing.T) {
 		{"one.two.three.example.com", "EXAMPLE.COM"},
 		{".test.gokrb5", "TEST.GOKRB5"},
 		{"foo.testlowercase.org", "lowercase.org"},
+		{"HostName1.Example.COM.", "EXAMPLE.COM"},
+		{"host.eng.example.com", "ENG.EXAMPLE.COM"},
+		{"eng.example.com", "EXAMPLE.COM"},
 	}
+	// The longest matching domain, whether mapped with a wildcard or a leading period
+	c.DomainRealm.parseLines([]string{" *.eng.example.com = ENG.EXAMPLE.COM"})
 	for _, tt := range tests {
 		t.Run(tt.domainName, func(t *testing.T) {
 			if got := c.ResolveRealm(tt.domainName); got != tt.want {
@@ -679,3 +840,158 @@ func TestJSON(t *testing.T) {
 
 	t.Log(j)
 }
+
+func TestCaPaths_Path(t *testing.T) {
+	t.Parallel()
+	// Each realm's trusts are configured a hop at a time
+	c, err := NewFromString(`[capaths]
+ A.GOKRB5 = {
+  B.GOKRB5 = .
+  Z.GOKRB5 = .
+ }
+ B.GOKRB5 = {
+  C.GOKRB5 = .
+  E.GOKRB5 = C.GOKRB5 D.GOKRB5
+ }
+ Z.GOKRB5 = {
+  Y.GOKRB5 = X.GOKRB5
+  E.GOKRB5 = Y.GOKRB5
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	var tests = []struct {
+		client string
+		server string
+		want   []string
+	}{
+		{"A.GOKRB5", "B.GOKRB5", []string{"B.GOKRB5"}},
+		{"A.GOKRB5", "C.GOKRB5", []string{"B.GOKRB5", "C.GOKRB5"}},
+		{"A.GOKRB5", "D.GOKRB5", []string{"B.GOKRB5", "C.GOKRB5", "D.GOKRB5"}},
+		{"A.GOKRB5", "X.GOKRB5", []string{"Z.GOKRB5", "X.GOKRB5"}},
+		// The path with the fewest hops, through Z.GOKRB5 rather than B.GOKRB5
+		{"A.GOKRB5", "E.GOKRB5", []string{"Z.GOKRB5", "Y.GOKRB5", "E.GOKRB5"}},
+		{"B.GOKRB5", "E.GOKRB5", []string{"C.GOKRB5", "D.GOKRB5", "E.GOKRB5"}},
+		{"D.GOKRB5", "E.GOKRB5", []string{"E.GOKRB5"}},
+	}
+	for _, test := range tests {
+		p, ok := c.CaPaths.Path(test.client, test.server)
+		assert.True(t, ok, "path from %s to %s not found", test.client, test.server)
+		assert.Equal(t, test.want, p, "path from %s to %s not as expected", test.client, test.server)
+	}
+	// Trust links are one way
+	_, ok := c.CaPaths.Path("C.GOKRB5", "A.GOKRB5")
+	assert.False(t, ok, "path against the trust links should not be found")
+	_, ok = c.CaPaths.Path("A.GOKRB5", "OTHER.ORG")
+	assert.False(t, ok, "path to an unconfigured realm should not be found")
+	assert.Equal(t, []string{"OTHER.ORG"}, c.RealmPath("A.GOKRB5", "OTHER.ORG"), "realm path without capaths not as expected")
+}
+
+func TestRealmPath(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(krb5Conf)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	var tests = []struct {
+		client string
+		server string
+		want   []string
+	}{
+		{"TEST.GOKRB5", "TEST.GOKRB5", nil},
+		{"TEST.GOKRB5", "EXAMPLE.COM", []string{"EXAMPLE.COM"}},
+		{"TEST.GOKRB5", "lowercase.org", []string{"EXAMPLE.COM", "INTERMEDIATE.ORG", "lowercase.org"}},
+		{"ENG.EXAMPLE.COM", "SALES.EXAMPLE.COM", []string{"EXAMPLE.COM", "SALES.EXAMPLE.COM"}},
+		{"A.ENG.EXAMPLE.COM", "EXAMPLE.COM", []string{"ENG.EXAMPLE.COM", "EXAMPLE.COM"}},
+		{"EXAMPLE.COM", "A.ENG.EXAMPLE.COM", []string{"ENG.EXAMPLE.COM", "A.ENG.EXAMPLE.COM"}},
+		{"A.ENG.EXAMPLE.COM", "SALES.EXAMPLE.COM", []string{"ENG.EXAMPLE.COM", "EXAMPLE.COM", "SALES.EXAMPLE.COM"}},
+		{"EXAMPLE.COM", "EXAMPLE.ORG", []string{"EXAMPLE.ORG"}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, c.RealmPath(test.client, test.server), "path from %s to %s not as expected", test.client, test.server)
+	}
+}
+
+func TestLoadDefault(t *testing.T) {
+	// Not parallel as the environment is changed
+	defer os.Setenv("KRB5_CONFIG", os.Getenv("KRB5_CONFIG"))
+	dir, err := ioutil.TempDir(os.TempDir(), "TEST-gokrb5-KRB5_CONFIG")
+	if err != nil {
+		t.Fatalf("Error creating directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	first := filepath.Join(dir, "first.conf")
+	second := filepath.Join(dir, "second.conf")
+	files := map[string]string{
+		first: "[libdefaults]\n default_realm = FIRST.GOKRB5\n[realms]\n TEST.GOKRB5 = {\n  kdc = 10.80.88.1\n }\n" +
+			"[domain_realm]\n .test.gokrb5 = TEST.GOKRB5\n[appdefaults]\n pam = {\n  debug = true\n }\n",
+		second: "[libdefaults]\n default_realm = SECOND.GOKRB5\n ticket_lifetime = 5h\n[realms]\n TEST.GOKRB5 = {\n  kdc = 10.80.88.2\n }\n SECOND.GOKRB5 = {\n  kdc = 10.80.88.3\n }\n" +
+			"[domain_realm]\n .test.gokrb5 = SECOND.GOKRB5\n .second.gokrb5 = SECOND.GOKRB5\n[appdefaults]\n pam = {\n  debug = false\n  ticket_lifetime = 8h\n }\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatalf("Error writing configuration file: %v", err)
+		}
+	}
+
+	missing := filepath.Join(dir, "missing.conf")
+	os.Setenv("KRB5_CONFIG", strings.Join([]string{missing, first, second}, string(filepath.ListSeparator)))
+	c, err := LoadDefault()
+	if err != nil {
+		t.Fatalf("Error loading default configuration: %v", err)
+	}
+	assert.Equal(t, "FIRST.GOKRB5", c.LibDefaults.DefaultRealm, "the file listed first should take precedence")
+	assert.Equal(t, 5*time.Hour, c.LibDefaults.TicketLifetime, "relations only in later files should be used")
+	assert.Len(t, c.Realms, 2, "a realm in more than one file should be defined once")
+	assert.Equal(t, []string{"10.80.88.1:88", "10.80.88.2:88"}, c.Realms[0].KDC, "the KDCs of a realm in more than one file should be merged")
+	_, kdcs, _ := c.GetKDCs("SECOND.GOKRB5", true)
+	assert.Equal(t, "10.80.88.3:88", kdcs[1], "realms only in later files should be used")
+	assert.Equal(t, "TEST.GOKRB5", c.DomainRealm[".test.gokrb5"], "the domain mapping of the file listed first should take precedence")
+	assert.Equal(t, "SECOND.GOKRB5", c.DomainRealm[".second.gokrb5"], "domain mappings only in later files should be used")
+	v, _ := c.AppDefault("pam", "TEST.GOKRB5", "debug")
+	assert.Equal(t, "true", v, "the application default of the file listed first should take precedence")
+	v, _ = c.AppDefault("pam", "TEST.GOKRB5", "ticket_lifetime")
+	assert.Equal(t, "8h", v, "application defaults only in later files should be used")
+
+	os.Setenv("KRB5_CONFIG", missing)
+	_, err = LoadDefault()
+	assert.Error(t, err, "no configuration file found should be an error")
+}
+
+func TestRealmDefinedTwice(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`[libdefaults]
+ default_realm = TEST.GOKRB5
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 10.80.88.1
+  default_domain = test.gokrb5
+  kdc_timeout = 5s
+  pkinit_kdc_hostname = kdc1.test.gokrb5
+ }
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 10.80.88.2
+  admin_server = 10.80.88.3
+  default_domain = other.gokrb5
+  kdc_timeout = 10s
+  pkinit_kdc_hostname = kdc2.test.gokrb5
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	if !assert.Len(t, c.Realms, 1, "a realm defined twice should be merged") {
+		return
+	}
+	r := c.Realms[0]
+	assert.Equal(t, []string{"10.80.88.1:88", "10.80.88.2:88"}, r.KDC, "KDCs of both definitions should be listed")
+	assert.Equal(t, []string{"10.80.88.3"}, r.AdminServer, "admin server of the second definition should be used")
+	assert.Equal(t, "test.gokrb5", r.DefaultDomain, "default domain of the first definition should be used")
+	assert.Equal(t, []string{"kdc1.test.gokrb5", "kdc2.test.gokrb5"}, r.PKINITKDCHostname, "PKINIT KDC host names of both definitions should be listed")
+	v, _ := c.AppDefault("any", "TEST.GOKRB5", "kdc_timeout")
+	assert.Equal(t, "5s", v, "relation of the first definition should be used")
+}
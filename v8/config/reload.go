@@ -0,0 +1,192 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// Provider supplies the configuration to use at the time it is called.
+// Clients and services use a Provider so that the configuration can be replaced while they are running, for example
+// when the KDCs of a realm change.
+type Provider interface {
+	Config() *Config
+}
+
+// Store holds a configuration that can be replaced by another. It is a Provider and is safe for concurrent use.
+// The configuration returned by Config should not be modified: Set replaces it with another, so that operations already
+// using the previous configuration are unaffected.
+type Store struct {
+	c   *Config
+	mux sync.RWMutex
+}
+
+// NewStore returns a Store holding the configuration provided.
+func NewStore(c *Config) *Store {
+	return &Store{c: c}
+}
+
+// Config returns the configuration currently held by the Store.
+func (s *Store) Config() *Config {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.c
+}
+
+// Set replaces the configuration held by the Store.
+func (s *Store) Set(c *Config) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.c = c
+}
+
+// Reloader is a Provider for a krb5.conf file that loads the file again when it changes, so that long running
+// processes pick up changes to realms and KDCs without a restart. It is safe for concurrent use.
+//
+// The file is polled at the interval provided. A change is detected when the file is replaced or when its size or
+// modification time changes. Changes to the files it includes are not detected. The file can also be loaded again on
+// demand with Reload, for example on SIGHUP using ReloadOnSignal. If the file cannot be loaded the configuration
+// previously loaded continues to be used.
+type Reloader struct {
+	path    string
+	c       *Config
+	info    os.FileInfo
+	errors  chan error
+	cancel  chan bool
+	done    chan bool
+	stopped bool
+	mux     sync.RWMutex
+}
+
+// NewReloader loads the krb5.conf file at the path provided and starts polling it for changes at the interval
+// provided. An interval of zero disables polling so the file is only loaded again when Reload is called.
+// Stop should be called when the Reloader is no longer needed.
+func NewReloader(cfgPath string, interval time.Duration) (*Reloader, error) {
+	if interval < 0 {
+		return nil, errors.New("configuration reload interval must not be negative")
+	}
+	r := &Reloader{
+		path:   cfgPath,
+		errors: make(chan error, 1),
+		cancel: make(chan bool, 1),
+		done:   make(chan bool),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	go r.watch(interval)
+	return r, nil
+}
+
+// Config returns the most recently loaded configuration.
+func (r *Reloader) Config() *Config {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.c
+}
+
+// Reload loads the krb5.conf file again regardless of whether it has changed. A configuration with unsupported
+// directives is used as Load returns it. If the file cannot be loaded the configuration previously loaded continues to
+// be used and the error is returned.
+func (r *Reloader) Reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	c, err := Load(r.path)
+	if err != nil {
+		if _, ok := err.(UnsupportedDirective); !ok {
+			return err
+		}
+	}
+	r.mux.Lock()
+	r.c = c
+	r.info = info
+	r.mux.Unlock()
+	return nil
+}
+
+// ReloadOnSignal loads the krb5.conf file again each time one of the signals provided is received by the process,
+// such as syscall.SIGHUP, until the Reloader is stopped.
+func (r *Reloader) ReloadOnSignal(sig ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig...)
+	go func() {
+		defer signal.Stop(c)
+		for {
+			select {
+			case <-c:
+				if err := r.Reload(); err != nil {
+					r.sendError(err)
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Errors returns a channel on which errors loading the krb5.conf file in the background are delivered.
+// Only the most recent error is held.
+func (r *Reloader) Errors() <-chan error {
+	return r.errors
+}
+
+// Stop ends the polling of the krb5.conf file and the handling of signals.
+func (r *Reloader) Stop() {
+	r.mux.Lock()
+	if r.stopped {
+		r.mux.Unlock()
+		return
+	}
+	r.stopped = true
+	r.mux.Unlock()
+	r.cancel <- true
+	<-r.done
+}
+
+func (r *Reloader) watch(interval time.Duration) {
+	defer close(r.done)
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-r.cancel:
+			return
+		case <-tick:
+			if r.changed() {
+				if err := r.Reload(); err != nil {
+					r.sendError(err)
+				}
+			}
+		}
+	}
+}
+
+// changed indicates if the krb5.conf file has changed since it was last loaded.
+func (r *Reloader) changed() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		r.sendError(err)
+		return false
+	}
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return !os.SameFile(info, r.info) || info.Size() != r.info.Size() || !info.ModTime().Equal(r.info.ModTime())
+}
+
+func (r *Reloader) sendError(err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	select {
+	case <-r.errors:
+	default:
+	}
+	r.errors <- err
+}
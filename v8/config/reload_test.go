@@ -0,0 +1,75 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	c, _ := NewFromString("[libdefaults]\n default_realm = TEST.GOKRB5\n")
+	s := NewStore(c)
+	var p Provider = s
+	assert.Equal(t, c, p.Config(), "Config not as provided")
+	n, _ := NewFromString("[libdefaults]\n default_realm = OTHER.GOKRB5\n")
+	s.Set(n)
+	assert.Equal(t, "OTHER.GOKRB5", p.Config().LibDefaults.DefaultRealm, "Config not replaced")
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.DefaultRealm, "Replaced config modified")
+}
+
+func TestReloader(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "krb5conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "krb5.conf")
+	if err := ioutil.WriteFile(p, []byte(krb5Conf), 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReloader(p, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error creating reloader: %v", err)
+	}
+	defer r.Stop()
+	c := r.Config()
+	assert.Equal(t, "TEST.GOKRB5", c.LibDefaults.DefaultRealm, "Config not loaded")
+
+	tmp := p + ".new"
+	if err := ioutil.WriteFile(tmp, []byte("[libdefaults]\n default_realm = OTHER.GOKRB5\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Config() == c && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, "OTHER.GOKRB5", r.Config().LibDefaults.DefaultRealm, "Changed config not loaded")
+
+	// A config that cannot be loaded does not replace the one loaded
+	cur := r.Config()
+	if err := ioutil.WriteFile(p, []byte("[libdefaults]\n ccache_type = 9\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, r.Reload(), "Invalid config should not load")
+	assert.Equal(t, cur, r.Config(), "Config replaced by an invalid one")
+	select {
+	case err := <-r.Errors():
+		assert.Error(t, err, "Error expected from background reload")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for reload error")
+	}
+	r.Stop()
+	r.Stop()
+
+	_, err = NewReloader(filepath.Join(dir, "missing"), 0)
+	assert.Error(t, err, "Missing config should be rejected")
+}
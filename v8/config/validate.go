@@ -0,0 +1,272 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+)
+
+// WarningKind categorises the problems found in a configuration by Validate and ValidateKDCs.
+type WarningKind int
+
+// Kinds of warning.
+const (
+	// WarningUnknownSection is a section that is not part of the krb5.conf format.
+	WarningUnknownSection WarningKind = iota
+	// WarningUnknownKey is a relation that is not part of the krb5.conf format, often a misspelling.
+	WarningUnknownKey
+	// WarningUnsupportedKey is a relation of the krb5.conf format that is ignored.
+	WarningUnsupportedKey
+	// WarningMissingDefaultRealm is a configuration without a default realm.
+	WarningMissingDefaultRealm
+	// WarningNoKDCs is a realm with no KDCs configured that are not looked up in DNS either.
+	WarningNoKDCs
+	// WarningInvalidKDC is a KDC address that is not a host and port.
+	WarningInvalidKDC
+	// WarningUnreachableKDC is a KDC that cannot be connected to.
+	WarningUnreachableKDC
+	// WarningWeakEType is a weak encryption type that is permitted, or that is listed but not permitted.
+	WarningWeakEType
+	// WarningUnsupportedEType is an encryption type that is unknown or not supported.
+	WarningUnsupportedEType
+)
+
+// String returns a short description of the kind of warning.
+func (k WarningKind) String() string {
+	switch k {
+	case WarningUnknownSection:
+		return "unknown section"
+	case WarningUnknownKey:
+		return "unknown key"
+	case WarningUnsupportedKey:
+		return "unsupported key"
+	case WarningMissingDefaultRealm:
+		return "missing default realm"
+	case WarningNoKDCs:
+		return "no KDCs"
+	case WarningInvalidKDC:
+		return "invalid KDC"
+	case WarningUnreachableKDC:
+		return "unreachable KDC"
+	case WarningWeakEType:
+		return "weak encryption type"
+	case WarningUnsupportedEType:
+		return "unsupported encryption type"
+	}
+	return "warning " + strconv.Itoa(int(k))
+}
+
+// Warning is a problem found in a configuration, one that does not stop it being loaded but is a likely cause of
+// authentication not working as expected.
+type Warning struct {
+	Kind    WarningKind
+	Section string // The section the problem is in, with the realm for the [realms] section, such as realms.EXAMPLE.COM
+	Key     string // The key of the relation the problem is with, if any
+	Message string
+}
+
+// String returns the warning in a form for display.
+func (w Warning) String() string {
+	loc := "[" + w.Section + "]"
+	if w.Key != "" {
+		loc += " " + w.Key
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, w.Kind, w.Message)
+}
+
+// Relations of the libdefaults section that gokrb5 understands.
+var libDefaultsKeys = map[string]bool{
+	"allow_weak_crypto": true, "canonicalize": true, "ccache_type": true, "clockskew": true,
+	"default_client_keytab_name": true, "default_keytab_name": true, "default_realm": true,
+	"default_tgs_enctypes": true, "default_tkt_enctypes": true, "dns_canonicalize_hostname": true,
+	"dns_lookup_kdc": true, "dns_lookup_realm": true, "extra_addresses": true, "forwardable": true,
+	"ignore_acceptor_hostname": true, "k5login_authoritative": true, "k5login_directory": true,
+	"kdc_default_options": true, "kdc_timeout": true, "kdc_timeout_https": true, "kdc_timeout_tcp": true,
+	"kdc_timeout_udp": true, "kdc_timesync": true, "max_retries": true, "noaddresses": true, "permitted_enctypes": true,
+	"preferred_preauth_types": true, "proxiable": true, "rdns": true, "realm_try_domains": true,
+	"renew_lifetime": true, "safe_checksum_type": true, "ticket_lifetime": true, "udp_preference_limit": true,
+	"verify_ap_req_nofail": true,
+}
+
+// Relations of the libdefaults section of MIT Kerberos that gokrb5 ignores.
+var libDefaultsUnsupportedKeys = map[string]bool{
+	"allow_des3": true, "allow_rc4": true, "ap_req_checksum_type": true, "client_aware_channel_bindings": true,
+	"default_ccache_name": true, "default_rcache_name": true, "dns_uri_lookup": true, "enforce_ok_as_delegate": true,
+	"err_fmt": true, "kcm_mach_service": true, "kcm_socket": true, "kdc_req_checksum_type": true,
+	"plugin_base_dir": true, "qualify_shortname": true, "spake_preauth_groups": true,
+}
+
+// Relations of the realms section that gokrb5 understands.
+var realmKeys = map[string]bool{
+	"admin_server": true, "default_domain": true, "kdc": true, "kpasswd_server": true, "master_kdc": true,
+}
+
+// Relations of the realms section of MIT Kerberos that gokrb5 ignores.
+var realmUnsupportedKeys = map[string]bool{
+	"auth_to_local": true, "auth_to_local_names": true, "disable_encrypted_timestamp": true, "http_anchors": true,
+	"primary_kdc": true, "sitename": true, "v4_instance_convert": true, "v4_realm": true,
+}
+
+// Sections of the krb5.conf format that gokrb5 ignores, without warning as they do not affect clients and services.
+var ignoredSections = map[string]bool{
+	"logging": true, "plugins": true, "dbdefaults": true, "dbmodules": true, "kdcdefaults": true,
+}
+
+// Validate checks the configuration for problems that do not stop it being loaded, such as unknown sections and keys,
+// a missing default realm, realms without KDCs and weak or unsupported encryption types. It does not use the network:
+// see ValidateKDCs. No warnings are returned for a configuration with no problems found.
+func (c *Config) Validate() []Warning {
+	var w []Warning
+	for _, s := range c.unknownSections {
+		if ignoredSections[s] {
+			continue
+		}
+		w = append(w, Warning{Kind: WarningUnknownSection, Section: s, Message: "section is not part of the krb5.conf format"})
+	}
+
+	for _, k := range sortedKeys(c.LibDefaults.relations) {
+		switch {
+		case libDefaultsKeys[k]:
+		case libDefaultsUnsupportedKeys[k]:
+			w = append(w, Warning{Kind: WarningUnsupportedKey, Section: "libdefaults", Key: k, Message: "relation is ignored"})
+		case c.LibDefaults.relations[k] == "{":
+			w = append(w, Warning{Kind: WarningUnsupportedKey, Section: "libdefaults", Key: k, Message: "subsections are not supported and their relations apply to all realms"})
+		default:
+			w = append(w, Warning{Kind: WarningUnknownKey, Section: "libdefaults", Key: k, Message: "relation is not part of the krb5.conf format"})
+		}
+	}
+
+	if c.LibDefaults.DefaultRealm == "" {
+		w = append(w, Warning{Kind: WarningMissingDefaultRealm, Section: "libdefaults", Key: "default_realm", Message: "clients must be given their realm"})
+	} else if !c.LibDefaults.DNSLookupKDC && !c.hasRealm(c.LibDefaults.DefaultRealm) {
+		w = append(w, Warning{Kind: WarningNoKDCs, Section: "libdefaults", Key: "default_realm", Message: fmt.Sprintf("default realm %s is not in the realms section and dns_lookup_kdc is disabled", c.LibDefaults.DefaultRealm)})
+	}
+
+	for _, r := range c.Realms {
+		section := "realms." + r.Realm
+		for _, k := range sortedKeys(r.relations) {
+			switch {
+			case realmKeys[k]:
+			case realmUnsupportedKeys[k]:
+				w = append(w, Warning{Kind: WarningUnsupportedKey, Section: section, Key: k, Message: "relation is ignored"})
+			default:
+				w = append(w, Warning{Kind: WarningUnknownKey, Section: section, Key: k, Message: "relation is not part of the krb5.conf format"})
+			}
+		}
+		if len(r.KDC) == 0 && !c.LibDefaults.DNSLookupKDC {
+			w = append(w, Warning{Kind: WarningNoKDCs, Section: section, Key: "kdc", Message: "realm has no KDCs and dns_lookup_kdc is disabled"})
+		}
+		for _, k := range r.KDC {
+			if _, _, err := net.SplitHostPort(kdcAddress(k)); err != nil {
+				w = append(w, Warning{Kind: WarningInvalidKDC, Section: section, Key: "kdc", Message: fmt.Sprintf("%s is not a host and port: %v", k, err)})
+			}
+		}
+	}
+
+	if c.LibDefaults.AllowWeakCrypto {
+		w = append(w, Warning{Kind: WarningWeakEType, Section: "libdefaults", Key: "allow_weak_crypto", Message: "weak encryption types are permitted"})
+	}
+	for _, l := range []struct {
+		key    string
+		etypes []string
+		ids    []int32
+	}{
+		{"default_tkt_enctypes", c.LibDefaults.DefaultTktEnctypes, c.LibDefaults.DefaultTktEnctypeIDs},
+		{"default_tgs_enctypes", c.LibDefaults.DefaultTGSEnctypes, c.LibDefaults.DefaultTGSEnctypeIDs},
+		{"permitted_enctypes", c.LibDefaults.PermittedEnctypes, c.LibDefaults.PermittedEnctypeIDs},
+	} {
+		// Only the encryption types configured are checked, not those of the defaults
+		if _, ok := c.LibDefaults.relations[l.key]; !ok {
+			continue
+		}
+		for _, e := range l.etypes {
+			switch {
+			case etypeID.EtypeSupported(e) == 0:
+				w = append(w, Warning{Kind: WarningUnsupportedEType, Section: "libdefaults", Key: l.key, Message: fmt.Sprintf("%s is not a supported encryption type and is ignored", e)})
+			case IsWeakEType(etypeID.EtypeSupported(e)) && !c.LibDefaults.AllowWeakCrypto:
+				w = append(w, Warning{Kind: WarningWeakEType, Section: "libdefaults", Key: l.key, Message: fmt.Sprintf("%s is weak and is ignored as allow_weak_crypto is disabled", e)})
+			}
+		}
+		if len(l.ids) == 0 {
+			w = append(w, Warning{Kind: WarningUnsupportedEType, Section: "libdefaults", Key: l.key, Message: "no supported encryption types are permitted"})
+		}
+	}
+	return w
+}
+
+// ValidateKDCs checks that a TCP connection can be made to each of the KDCs configured in the realms section, within
+// the timeout provided. KDCs looked up in DNS are not checked. A warning is returned for each KDC that cannot be
+// connected to. KDCs that only serve UDP cannot be checked this way and are reported as unreachable.
+func (c *Config) ValidateKDCs(timeout time.Duration) []Warning {
+	var kdcs []Warning
+	for _, r := range c.Realms {
+		for _, k := range r.KDC {
+			kdcs = append(kdcs, Warning{Kind: WarningUnreachableKDC, Section: "realms." + r.Realm, Key: "kdc", Message: k})
+		}
+	}
+	results := make([]*Warning, len(kdcs))
+	var wg sync.WaitGroup
+	for i := range kdcs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			addr := kdcAddress(kdcs[i].Message)
+			conn, err := net.DialTimeout("tcp", addr, timeout)
+			if err != nil {
+				w := kdcs[i]
+				w.Message = fmt.Sprintf("could not connect to %s: %v", addr, err)
+				results[i] = &w
+				return
+			}
+			conn.Close()
+		}(i)
+	}
+	wg.Wait()
+	var w []Warning
+	for _, r := range results {
+		if r != nil {
+			w = append(w, *r)
+		}
+	}
+	return w
+}
+
+// hasRealm indicates if the realm has an entry in the realms section.
+func (c *Config) hasRealm(realm string) bool {
+	for _, r := range c.Realms {
+		if r.Realm == realm {
+			return true
+		}
+	}
+	return false
+}
+
+// kdcAddress returns the host and port of a KDC entry, without the scheme of a KDC proxy URL.
+func kdcAddress(k string) string {
+	if i := strings.Index(k, "://"); i >= 0 {
+		k = k[i+3:]
+		if j := strings.Index(k, "/"); j >= 0 {
+			k = k[:j]
+		}
+		if _, _, err := net.SplitHostPort(k); err != nil {
+			k = net.JoinHostPort(k, "443")
+		}
+	}
+	return k
+}
+
+// sortedKeys returns the keys of the map in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+	c, err := NewFromString(`[logging]
+ default = FILE:/var/log/krb5libs.log
+
+[libdefualts]
+ default_realm = TYPO.GOKRB5
+
+[libdefaults]
+ default_realm = TEST.GOKRB5
+ dns_lookup_kdc = false
+ ticket_lifetme = 10h
+ default_ccache_name = KEYRING:persistent:%{uid}
+ default_tkt_enctypes = aes256-cts-hmac-sha1-96 rc4-hmac no-such-enctype
+ permitted_enctypes = rc4-hmac
+
+[realms]
+ TEST.GOKRB5 = {
+  kdc = 10.80.88.88
+  kdc = [fe80::1
+  auth_to_local = DEFAULT
+  admin_srever = 10.80.88.88
+ }
+ EMPTY.GOKRB5 = {
+  admin_server = 10.80.88.89
+ }
+`)
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	w := c.Validate()
+	var kinds []WarningKind
+	var keys []string
+	for _, warning := range w {
+		kinds = append(kinds, warning.Kind)
+		keys = append(keys, warning.Section+" "+warning.Key)
+	}
+	assert.Equal(t, []WarningKind{
+		WarningUnknownSection,
+		WarningUnsupportedKey,
+		WarningUnknownKey,
+		WarningUnknownKey,
+		WarningUnsupportedKey,
+		WarningInvalidKDC,
+		WarningNoKDCs,
+		WarningWeakEType,
+		WarningUnsupportedEType,
+		WarningWeakEType,
+		WarningUnsupportedEType,
+	}, kinds, "warnings not as expected: %v", w)
+	assert.Equal(t, []string{
+		"libdefualts ",
+		"libdefaults default_ccache_name",
+		"libdefaults ticket_lifetme",
+		"realms.TEST.GOKRB5 admin_srever",
+		"realms.TEST.GOKRB5 auth_to_local",
+		"realms.TEST.GOKRB5 kdc",
+		"realms.EMPTY.GOKRB5 kdc",
+		"libdefaults default_tkt_enctypes",
+		"libdefaults default_tkt_enctypes",
+		"libdefaults permitted_enctypes",
+		"libdefaults permitted_enctypes",
+	}, keys, "warnings not as expected: %v", w)
+	assert.Equal(t, "[libdefaults] ticket_lifetme: unknown key: relation is not part of the krb5.conf format", w[2].String(), "warning string not as expected")
+
+	c, _ = NewFromString("[libdefaults]\n allow_weak_crypto = true\n")
+	w = c.Validate()
+	if assert.Len(t, w, 2, "warnings not as expected: %v", w) {
+		assert.Equal(t, WarningMissingDefaultRealm, w[0].Kind, "warning not as expected")
+		assert.Equal(t, WarningWeakEType, w[1].Kind, "warning not as expected")
+	}
+
+	c, _ = NewFromString(krb5Conf)
+	w = c.Validate()
+	if assert.Len(t, w, 1, "warnings of the test configuration not as expected: %v", w) {
+		assert.Equal(t, "[realms.EXAMPLE.COM] auth_to_local: unsupported key: relation is ignored", w[0].String(), "warning not as expected")
+	}
+}
+
+func TestValidateKDCs(t *testing.T) {
+	t.Parallel()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	// A port that is not listened on
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	c, err := NewFromString("[realms]\n TEST.GOKRB5 = {\n  kdc = " + l.Addr().String() + "\n  kdc = " + closedAddr + "\n }\n")
+	if err != nil {
+		t.Fatalf("Error loading config: %v", err)
+	}
+	w := c.ValidateKDCs(time.Second)
+	if assert.Len(t, w, 1, "warnings not as expected: %v", w) {
+		assert.Equal(t, WarningUnreachableKDC, w[0].Kind, "warning not as expected")
+		assert.Contains(t, w[0].Message, closedAddr, "warning not as expected")
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/jcmturner/gofork/encoding/asn1"
+	"io"
 	"io/ioutil"
-	"strings"
+	"os"
+	"path/filepath"
 	"time"
 	"unsafe"
 )
@@ -20,7 +23,7 @@ const (
 type CCache struct {
 	Version          uint8
 	Header           header
-	DefaultPrincipal principal
+	DefaultPrincipal Principal
 	Credentials      []*Credential
 	Path             string
 }
@@ -36,16 +39,34 @@ type headerField struct {
 	value  []byte
 }
 
-// Credential cache entry principal struct.
-type principal struct {
+// Principal is a credential cache entry's principal name and realm.
+type Principal struct {
 	Realm         string
 	PrincipalName types.PrincipalName
 }
 
+// NewPrincipal returns a Principal for the principal name and realm provided.
+func NewPrincipal(pn types.PrincipalName, realm string) Principal {
+	return Principal{
+		Realm:         realm,
+		PrincipalName: pn,
+	}
+}
+
+// String returns the principal in the form name@REALM.
+func (p Principal) String() string {
+	return p.PrincipalName.PrincipalNameString() + "@" + p.Realm
+}
+
+// Equal tests if the principal name and realm are the same as those of the Principal provided.
+func (p Principal) Equal(o Principal) bool {
+	return p.Realm == o.Realm && p.PrincipalName.Equal(o.PrincipalName)
+}
+
 // Credential holds a Kerberos client's ccache credential information.
 type Credential struct {
-	Client       principal
-	Server       principal
+	Client       Principal
+	Server       Principal
 	Key          types.EncryptionKey
 	AuthTime     time.Time
 	StartTime    time.Time
@@ -59,67 +80,379 @@ type Credential struct {
 	SecondTicket []byte
 }
 
+// ClientPrincipal returns the principal the credential was issued to.
+func (cred *Credential) ClientPrincipal() Principal {
+	return cred.Client
+}
+
+// ServerPrincipal returns the principal of the service the credential is for.
+func (cred *Credential) ServerPrincipal() Principal {
+	return cred.Server
+}
+
+// SessionKey returns the session key of the credential.
+func (cred *Credential) SessionKey() types.EncryptionKey {
+	return cred.Key
+}
+
+// TicketBytes returns the ASN.1 encoded ticket of the credential.
+func (cred *Credential) TicketBytes() []byte {
+	return cred.Ticket
+}
+
+// SecondTicketBytes returns the ASN.1 encoded second ticket of the credential, used in user-to-user authentication.
+func (cred *Credential) SecondTicketBytes() []byte {
+	return cred.SecondTicket
+}
+
+// Flags returns the ticket flags of the credential.
+func (cred *Credential) Flags() asn1.BitString {
+	return cred.TicketFlags
+}
+
+// HasFlag tests if the ticket flag provided is set on the credential.
+func (cred *Credential) HasFlag(f int) bool {
+	return types.IsFlagSet(&cred.TicketFlags, f)
+}
+
+// Times returns the auth time, start time, end time and renew till time of the credential.
+func (cred *Credential) Times() (authTime, startTime, endTime, renewTill time.Time) {
+	return cred.AuthTime, cred.StartTime, cred.EndTime, cred.RenewTill
+}
+
+// Expired tests if the credential's end time has passed.
+func (cred *Credential) Expired() bool {
+	return !cred.EndTime.After(time.Now().UTC())
+}
+
 // LoadCCache loads a credential cache file into a CCache type.
-func LoadCCache(cpath string) (*CCache, error) {
+// Use the WithLock option to take a shared advisory lock on the file while it is read.
+func LoadCCache(cpath string, opts ...CCacheOption) (*CCache, error) {
 	c := new(CCache)
-	b, err := ioutil.ReadFile(cpath)
-	if err != nil {
-		return c, err
+	var f *os.File
+	var err error
+	if newCCacheSettings(opts).lock {
+		var unlock func()
+		f, unlock, err = openLocked(cpath, false)
+		if err != nil {
+			return c, err
+		}
+		defer unlock()
+	} else {
+		f, err = os.Open(cpath)
+		if err != nil {
+			return c, err
+		}
+		defer f.Close()
 	}
-	err = c.Unmarshal(b)
+	c, err = ReadCCache(f)
+	c.Path = cpath
+	return c, err
+}
+
+// ReadCCache reads credential cache data from the reader provided into a CCache type.
+// The data is parsed incrementally as it is read so the whole cache need not be held in memory in its raw form.
+func ReadCCache(r io.Reader) (*CCache, error) {
+	c := new(CCache)
+	err := c.read(newCCacheDecoder(r))
 	return c, err
 }
 
+// Export writes the CCache to the file at the path provided in the MIT credential cache file format.
+// The file is replaced atomically so that concurrent readers never see a partially written cache.
+// If the file already exists its mode is preserved, otherwise it is created with mode 0600.
+//
+// Use the WithLock option to take an exclusive advisory lock on the file instead. The file is then rewritten in
+// place while the lock is held, as MIT Kerberos does, so that readers waiting on the lock see the new contents.
+//
+// The file is written using version 4 of the file format unless the WithVersion option is provided.
+func (c *CCache) Export(cpath string, opts ...CCacheOption) error {
+	s := newCCacheSettings(opts)
+	b, err := c.MarshalVersion(s.version)
+	if err != nil {
+		return err
+	}
+	if s.lock {
+		f, unlock, err := openLocked(cpath, true)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		return writeFileLocked(f, b)
+	}
+	return writeFileAtomic(cpath, b)
+}
+
+// Save writes the CCache back to the file it was loaded from.
+func (c *CCache) Save(opts ...CCacheOption) error {
+	if c.Path == "" {
+		return errors.New("credential cache has no path to save to")
+	}
+	return c.Export(c.Path, opts...)
+}
+
+// AddCredential adds a credential to the cache.
+// Any existing credential for the same client and server principals is replaced.
+func (c *CCache) AddCredential(cred *Credential) {
+	for i := range c.Credentials {
+		if c.Credentials[i].Client.Equal(cred.Client) && c.Credentials[i].Server.Equal(cred.Server) {
+			c.Credentials[i] = cred
+			return
+		}
+	}
+	c.Credentials = append(c.Credentials, cred)
+}
+
+// RemoveEntry removes the credentials for the server PrincipalName provided.
+// Returns true if any credentials were removed.
+func (c *CCache) RemoveEntry(p types.PrincipalName) bool {
+	var removed bool
+	creds := c.Credentials[:0]
+	for _, cred := range c.Credentials {
+		if cred.Server.PrincipalName.Equal(p) {
+			removed = true
+			continue
+		}
+		creds = append(creds, cred)
+	}
+	c.Credentials = creds
+	return removed
+}
+
+// MergeCCaches combines the credentials of two caches for the same default principal into a new CCache.
+// Where both caches, or either cache alone, hold more than one credential for a server principal only the one with
+// the later end time is kept. If the end times are the same the credential seen first, taking a before b, is kept.
+// The header of the returned CCache is taken from a. The credentials are shared with the caches provided, not copied.
+func MergeCCaches(a, b *CCache) (*CCache, error) {
+	if !a.DefaultPrincipal.Equal(b.DefaultPrincipal) {
+		return nil, fmt.Errorf("cannot merge credential caches for different principals: %s and %s",
+			a.DefaultPrincipal.String(), b.DefaultPrincipal.String())
+	}
+	c := &CCache{
+		Version: 4,
+		Header: header{
+			length: a.Header.length,
+			fields: append([]headerField{}, a.Header.fields...),
+		},
+		DefaultPrincipal: a.DefaultPrincipal,
+	}
+	idx := make(map[string]int)
+	for _, cred := range append(append([]*Credential{}, a.Credentials...), b.Credentials...) {
+		k := cred.Server.String()
+		if i, ok := idx[k]; ok {
+			if cred.EndTime.After(c.Credentials[i].EndTime) {
+				c.Credentials[i] = cred
+			}
+			continue
+		}
+		idx[k] = len(c.Credentials)
+		c.Credentials = append(c.Credentials, cred)
+	}
+	return c, nil
+}
+
+// Destroy overwrites the key material and tickets held in memory by the CCache's credentials and removes them.
+// If the CCache was loaded from or saved to a file, the file is zero-filled and truncated before it is removed.
+func (c *CCache) Destroy() error {
+	for _, cred := range c.Credentials {
+		cred.zero()
+	}
+	c.Credentials = nil
+	if c.Path == "" {
+		return nil
+	}
+	return wipeFile(c.Path)
+}
+
+// zero overwrites the credential's session key and tickets.
+func (cred *Credential) zero() {
+	cred.Key.Wipe()
+	zeroBytes(cred.Ticket)
+	zeroBytes(cred.SecondTicket)
+}
+
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// wipeFile overwrites the contents of the file with zeros, truncates it and then removes it.
+func wipeFile(cpath string) error {
+	f, err := os.OpenFile(cpath, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err == nil {
+		z := make([]byte, 4096)
+		for n := fi.Size(); n > 0 && err == nil; n -= int64(len(z)) {
+			if n < int64(len(z)) {
+				z = z[:n]
+			}
+			_, err = f.Write(z)
+		}
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err == nil {
+		err = f.Truncate(0)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("could not wipe credential cache file %s: %v", cpath, err)
+	}
+	return os.Remove(cpath)
+}
+
+// writeFileLocked replaces the contents of a file that is held open with an exclusive lock.
+func writeFileLocked(f *os.File, b []byte) error {
+	if err := f.Truncate(0); err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(b, 0); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// writeFileAtomic writes the bytes to a temporary file in the same directory and renames it over the path provided.
+func writeFileAtomic(cpath string, b []byte) error {
+	mode := os.FileMode(0600)
+	if fi, err := os.Stat(cpath); err == nil {
+		mode = fi.Mode().Perm()
+	}
+	f, err := ioutil.TempFile(filepath.Dir(cpath), filepath.Base(cpath)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err = f.Write(b); err == nil {
+		if err = f.Chmod(mode); err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, cpath)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
+
+// Marshal the CCache into a byte slice using version 4 of the credential cache file format.
+func (c *CCache) Marshal() ([]byte, error) {
+	return c.MarshalVersion(4)
+}
+
+// MarshalVersion marshals the CCache into a byte slice using the version of the credential cache file format provided.
+// Versions 1 and 2 use the native byte order of the host and versions 3 and 4 use big-endian byte order.
+// Only version 4 has a header so the KDC time offset is not recorded in earlier versions.
+func (c *CCache) MarshalVersion(v uint8) ([]byte, error) {
+	if v < 1 || v > 4 {
+		return nil, fmt.Errorf("invalid credential cache version %d", v)
+	}
+	var endian binary.ByteOrder
+	endian = binary.BigEndian
+	if (v == 1 || v == 2) && isNativeEndianLittle() {
+		endian = binary.LittleEndian
+	}
+	buf := new(bytes.Buffer)
+	buf.WriteByte(5)
+	buf.WriteByte(v)
+	if v == 4 {
+		hb, err := c.Header.marshal(&endian)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(hb)
+	}
+	writePrincipal(buf, c.DefaultPrincipal, v, &endian)
+	for _, cred := range c.Credentials {
+		writeCredential(buf, cred, v, &endian)
+	}
+	return buf.Bytes(), nil
+}
+
 // Unmarshal a byte slice of credential cache data into CCache type.
 func (c *CCache) Unmarshal(b []byte) error {
-	p := 0
+	return c.read(newCCacheDecoder(bytes.NewReader(b)))
+}
+
+func (c *CCache) read(d *ccacheDecoder) error {
 	//The first byte of the file always has the value 5
-	if int8(b[p]) != 5 {
+	b, err := d.readInt8()
+	if err != nil {
+		return fmt.Errorf("Invalid credential cache data. %v", err)
+	}
+	if b != 5 {
 		return errors.New("Invalid credential cache data. First byte does not equal 5")
 	}
-	p++
 	//Get credential cache version
 	//The second byte contains the version number (1 to 4)
-	c.Version = b[p]
+	v, err := d.readInt8()
+	if err != nil {
+		return fmt.Errorf("Invalid credential cache data. %v", err)
+	}
+	c.Version = uint8(v)
 	if c.Version < 1 || c.Version > 4 {
 		return errors.New("Invalid credential cache data. Keytab version is not within 1 to 4")
 	}
-	p++
 	//Version 1 or 2 of the file format uses native byte order for integer representations. Versions 3 & 4 always uses big-endian byte order
-	var endian binary.ByteOrder
-	endian = binary.BigEndian
+	d.version = c.Version
 	if (c.Version == 1 || c.Version == 2) && isNativeEndianLittle() {
-		endian = binary.LittleEndian
+		d.endian = binary.LittleEndian
 	}
 	if c.Version == 4 {
-		err := parseHeader(b, &p, c, &endian)
+		err := parseHeader(d, c)
 		if err != nil {
 			return err
 		}
 	}
-	c.DefaultPrincipal = parsePrincipal(b, &p, c, &endian)
-	for p < len(b) {
-		cred, err := parseCredential(b, &p, c, &endian)
+	c.DefaultPrincipal, err = d.readPrincipal()
+	if err != nil {
+		return fmt.Errorf("error parsing default principal: %v", err)
+	}
+	for d.more() {
+		cred, err := d.readCredential()
 		if err != nil {
-			return err
+			return fmt.Errorf("error parsing credential %d: %v", len(c.Credentials), err)
 		}
 		c.Credentials = append(c.Credentials, cred)
 	}
-	return nil
+	return d.err
 }
 
-func parseHeader(b []byte, p *int, c *CCache, e *binary.ByteOrder) error {
+func parseHeader(d *ccacheDecoder, c *CCache) error {
 	if c.Version != 4 {
 		return errors.New("Credentials cache version is not 4 so there is no header to parse.")
 	}
 	h := header{}
-	h.length = uint16(readInt16(b, p, e))
-	for *p <= int(h.length) {
+	hb, err := d.readData16()
+	if err != nil {
+		return fmt.Errorf("error parsing header: %v", err)
+	}
+	h.length = uint16(len(hb))
+	hd := newCCacheDecoder(bytes.NewReader(hb))
+	for hd.more() {
 		f := headerField{}
-		f.tag = uint16(readInt16(b, p, e))
-		f.length = uint16(readInt16(b, p, e))
-		f.value = b[*p : *p+int(f.length)]
-		*p += int(f.length)
+		tag, err := hd.readInt16()
+		if err != nil {
+			return fmt.Errorf("error parsing header field tag: %v", err)
+		}
+		f.tag = uint16(tag)
+		f.value, err = hd.readData16()
+		if err != nil {
+			return fmt.Errorf("error parsing header field value: %v", err)
+		}
+		f.length = uint16(len(f.value))
 		if !f.valid() {
 			return errors.New("Invalid credential cache header found")
 		}
@@ -129,62 +462,72 @@ func parseHeader(b []byte, p *int, c *CCache, e *binary.ByteOrder) error {
 	return nil
 }
 
-// Parse the Keytab bytes of a principal into a Keytab entry's principal.
-func parsePrincipal(b []byte, p *int, c *CCache, e *binary.ByteOrder) (princ principal) {
-	if c.Version != 1 {
-		//Name Type is omitted in version 1
-		princ.PrincipalName.NameType = readInt32(b, p, e)
+func (h *header) marshal(e *binary.ByteOrder) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	var l int
+	for _, f := range h.fields {
+		if !f.valid() {
+			return nil, errors.New("Invalid credential cache header field")
+		}
+		l += 4 + len(f.value)
+	}
+	writeInt16(buf, int16(l), e)
+	for _, f := range h.fields {
+		writeInt16(buf, int16(f.tag), e)
+		writeInt16(buf, int16(len(f.value)), e)
+		buf.Write(f.value)
+	}
+	return buf.Bytes(), nil
+}
+
+func writePrincipal(buf *bytes.Buffer, princ Principal, v uint8, e *binary.ByteOrder) {
+	if v != 1 {
+		writeInt32(buf, princ.PrincipalName.NameType, e)
 	}
-	nc := int(readInt32(b, p, e))
-	if c.Version == 1 {
-		//In version 1 the number of components includes the realm. Minus 1 to make consistent with version 2
-		nc--
+	nc := len(princ.PrincipalName.NameString)
+	if v == 1 {
+		nc++
 	}
-	lenRealm := readInt32(b, p, e)
-	princ.Realm = string(readBytes(b, p, int(lenRealm), e))
-	for i := 0; i < nc; i++ {
-		l := readInt32(b, p, e)
-		princ.PrincipalName.NameString = append(princ.PrincipalName.NameString, string(readBytes(b, p, int(l), e)))
+	writeInt32(buf, int32(nc), e)
+	writeData(buf, []byte(princ.Realm), e)
+	for _, n := range princ.PrincipalName.NameString {
+		writeData(buf, []byte(n), e)
 	}
-	return princ
 }
 
-func parseCredential(b []byte, p *int, c *CCache, e *binary.ByteOrder) (cred *Credential, err error) {
-	cred = new(Credential)
-	cred.Client = parsePrincipal(b, p, c, e)
-	cred.Server = parsePrincipal(b, p, c, e)
-	key := types.EncryptionKey{}
-	key.KeyType = int32(readInt16(b, p, e))
-	if c.Version == 3 {
+func writeCredential(buf *bytes.Buffer, cred *Credential, v uint8, e *binary.ByteOrder) {
+	writePrincipal(buf, cred.Client, v, e)
+	writePrincipal(buf, cred.Server, v, e)
+	writeInt16(buf, int16(cred.Key.KeyType), e)
+	if v == 3 {
 		//repeated twice in version 3
-		key.KeyType = int32(readInt16(b, p, e))
-	}
-	key.KeyValue = readData(b, p, e)
-	cred.Key = key
-	cred.AuthTime = readTimestamp(b, p, e)
-	cred.StartTime = readTimestamp(b, p, e)
-	cred.EndTime = readTimestamp(b, p, e)
-	cred.RenewTill = readTimestamp(b, p, e)
-	if ik := readInt8(b, p, e); ik == 0 {
-		cred.IsSKey = false
+		writeInt16(buf, int16(cred.Key.KeyType), e)
+	}
+	writeData(buf, cred.Key.KeyValue, e)
+	writeTimestamp(buf, cred.AuthTime, e)
+	writeTimestamp(buf, cred.StartTime, e)
+	writeTimestamp(buf, cred.EndTime, e)
+	writeTimestamp(buf, cred.RenewTill, e)
+	if cred.IsSKey {
+		buf.WriteByte(1)
 	} else {
-		cred.IsSKey = true
+		buf.WriteByte(0)
 	}
-	cred.TicketFlags = types.NewKrbFlags()
-	cred.TicketFlags.Bytes = readBytes(b, p, 4, e)
-	l := int(readInt32(b, p, e))
-	cred.Addresses = make([]types.HostAddress, l, l)
-	for i := range cred.Addresses {
-		cred.Addresses[i] = readAddress(b, p, e)
+	flags := make([]byte, 4)
+	copy(flags, cred.TicketFlags.Bytes)
+	buf.Write(flags)
+	writeInt32(buf, int32(len(cred.Addresses)), e)
+	for _, a := range cred.Addresses {
+		writeInt16(buf, int16(a.AddrType), e)
+		writeData(buf, a.Address, e)
 	}
-	l = int(readInt32(b, p, e))
-	cred.AuthData = make([]types.AuthorizationDataEntry, l, l)
-	for i := range cred.AuthData {
-		cred.AuthData[i] = readAuthDataEntry(b, p, e)
+	writeInt32(buf, int32(len(cred.AuthData)), e)
+	for _, a := range cred.AuthData {
+		writeInt16(buf, int16(a.ADType), e)
+		writeData(buf, a.ADData, e)
 	}
-	cred.Ticket = readData(b, p, e)
-	cred.SecondTicket = readData(b, p, e)
-	return
+	writeData(buf, cred.Ticket, e)
+	writeData(buf, cred.SecondTicket, e)
 }
 
 // GetClientPrincipalName returns a PrincipalName type for the client the credentials cache is for.
@@ -199,11 +542,47 @@ func (c *CCache) GetClientRealm() string {
 
 // GetClientCredentials returns a Credentials object representing the client of the credentials cache.
 func (c *CCache) GetClientCredentials() *Credentials {
+	d, _ := c.GetKDCOffset()
 	return &Credentials{
-		username: c.DefaultPrincipal.PrincipalName.PrincipalNameString(),
-		realm:    c.GetClientRealm(),
-		cname:    c.DefaultPrincipal.PrincipalName,
+		username:  c.DefaultPrincipal.PrincipalName.PrincipalNameString(),
+		realm:     c.GetClientRealm(),
+		cname:     c.DefaultPrincipal.PrincipalName,
+		kdcOffset: d,
+	}
+}
+
+// GetKDCOffset returns the offset of the KDC's clock from the local clock recorded in the cache's header.
+// The bool returned is false if the cache does not record an offset.
+func (c *CCache) GetKDCOffset() (time.Duration, bool) {
+	for _, f := range c.Header.fields {
+		if f.tag == headerFieldTagKDCOffset && f.valid() {
+			s := int32(binary.BigEndian.Uint32(f.value[0:4]))
+			us := int32(binary.BigEndian.Uint32(f.value[4:8]))
+			return time.Duration(s)*time.Second + time.Duration(us)*time.Microsecond, true
+		}
 	}
+	return 0, false
+}
+
+// SetKDCOffset records the offset of the KDC's clock from the local clock in the cache's header.
+// The offset is only written when the cache is marshaled in version 4 of the file format.
+func (c *CCache) SetKDCOffset(d time.Duration) {
+	v := make([]byte, 8)
+	binary.BigEndian.PutUint32(v[0:4], uint32(int32(d/time.Second)))
+	binary.BigEndian.PutUint32(v[4:8], uint32(int32((d%time.Second)/time.Microsecond)))
+	f := headerField{
+		tag:    headerFieldTagKDCOffset,
+		length: 8,
+		value:  v,
+	}
+	for i := range c.Header.fields {
+		if c.Header.fields[i].tag == headerFieldTagKDCOffset {
+			c.Header.fields[i] = f
+			return
+		}
+	}
+	c.Header.fields = append(c.Header.fields, f)
+	c.Header.length += 12
 }
 
 // Contains tests if the cache contains a credential for the provided server PrincipalName
@@ -217,20 +596,53 @@ func (c *CCache) Contains(p types.PrincipalName) bool {
 }
 
 // GetEntry returns a specific credential for the PrincipalName provided.
+// Where the cache holds more than one credential for the PrincipalName, such as an old ticket and its renewal,
+// an unexpired credential is preferred and then the one with the latest end time.
 func (c *CCache) GetEntry(p types.PrincipalName) (*Credential, bool) {
-	cred := new(Credential)
-	var found bool
-	for i := range c.Credentials {
-		if c.Credentials[i].Server.PrincipalName.Equal(p) {
-			cred = c.Credentials[i]
-			found = true
-			break
+	if cred, ok := c.selectEntry(p, time.Now().UTC(), nil); ok {
+		return cred, true
+	}
+	if cred, ok := c.selectEntry(p, time.Time{}, nil); ok {
+		return cred, true
+	}
+	return new(Credential), false
+}
+
+// GetValidEntry returns the credential for the PrincipalName provided that is valid at the time provided and has the
+// latest end time. If encryption types are provided only credentials with a session key of one of those types are
+// considered.
+func (c *CCache) GetValidEntry(p types.PrincipalName, now time.Time, etypes ...int32) (*Credential, bool) {
+	return c.selectEntry(p, now, etypes)
+}
+
+// selectEntry returns the credential for the PrincipalName with the latest end time after the time provided.
+func (c *CCache) selectEntry(p types.PrincipalName, now time.Time, etypes []int32) (*Credential, bool) {
+	var sel *Credential
+	for _, cred := range c.Credentials {
+		if !cred.Server.PrincipalName.Equal(p) || !cred.EndTime.After(now) {
+			continue
+		}
+		if !now.IsZero() && cred.StartTime.Unix() > 0 && cred.StartTime.After(now) {
+			// Postdated ticket that is not yet valid
+			continue
+		}
+		if len(etypes) > 0 && !containsEType(etypes, cred.Key.KeyType) {
+			continue
+		}
+		if sel == nil || cred.EndTime.After(sel.EndTime) {
+			sel = cred
 		}
 	}
-	if !found {
-		return cred, false
+	return sel, sel != nil
+}
+
+func containsEType(etypes []int32, e int32) bool {
+	for _, t := range etypes {
+		if t == e {
+			return true
+		}
 	}
-	return cred, true
+	return false
 }
 
 // GetEntries filters out configuration entries an returns a slice of credentials.
@@ -238,7 +650,7 @@ func (c *CCache) GetEntries() []*Credential {
 	creds := make([]*Credential, 0)
 	for _, cred := range c.Credentials {
 		// Filter out configuration entries
-		if strings.HasPrefix(cred.Server.Realm, "X-CACHECONF") {
+		if cred.IsConfigEntry() {
 			continue
 		}
 		creds = append(creds, cred)
@@ -258,60 +670,28 @@ func (h *headerField) valid() bool {
 	return false
 }
 
-func readData(b []byte, p *int, e *binary.ByteOrder) []byte {
-	l := readInt32(b, p, e)
-	return readBytes(b, p, int(l), e)
-}
-
-func readAddress(b []byte, p *int, e *binary.ByteOrder) types.HostAddress {
-	a := types.HostAddress{}
-	a.AddrType = int32(readInt16(b, p, e))
-	a.Address = readData(b, p, e)
-	return a
-}
-
-func readAuthDataEntry(b []byte, p *int, e *binary.ByteOrder) types.AuthorizationDataEntry {
-	a := types.AuthorizationDataEntry{}
-	a.ADType = int32(readInt16(b, p, e))
-	a.ADData = readData(b, p, e)
-	return a
+func writeData(buf *bytes.Buffer, b []byte, e *binary.ByteOrder) {
+	writeInt32(buf, int32(len(b)), e)
+	buf.Write(b)
 }
 
-// Read bytes representing a timestamp.
-func readTimestamp(b []byte, p *int, e *binary.ByteOrder) time.Time {
-	return time.Unix(int64(readInt32(b, p, e)), 0)
-}
-
-// Read bytes representing an eight bit integer.
-func readInt8(b []byte, p *int, e *binary.ByteOrder) (i int8) {
-	buf := bytes.NewBuffer(b[*p : *p+1])
-	binary.Read(buf, *e, &i)
-	*p++
-	return
-}
-
-// Read bytes representing a sixteen bit integer.
-func readInt16(b []byte, p *int, e *binary.ByteOrder) (i int16) {
-	buf := bytes.NewBuffer(b[*p : *p+2])
-	binary.Read(buf, *e, &i)
-	*p += 2
-	return
+// Write bytes representing a timestamp. A zero time is written as zero.
+func writeTimestamp(buf *bytes.Buffer, t time.Time, e *binary.ByteOrder) {
+	var i uint32
+	if !t.IsZero() {
+		i = uint32(t.Unix())
+	}
+	writeInt32(buf, int32(i), e)
 }
 
-// Read bytes representing a thirty two bit integer.
-func readInt32(b []byte, p *int, e *binary.ByteOrder) (i int32) {
-	buf := bytes.NewBuffer(b[*p : *p+4])
-	binary.Read(buf, *e, &i)
-	*p += 4
-	return
+// Write bytes representing a sixteen bit integer.
+func writeInt16(buf *bytes.Buffer, i int16, e *binary.ByteOrder) {
+	binary.Write(buf, *e, i)
 }
 
-func readBytes(b []byte, p *int, s int, e *binary.ByteOrder) []byte {
-	buf := bytes.NewBuffer(b[*p : *p+s])
-	r := make([]byte, s)
-	binary.Read(buf, *e, &r)
-	*p += s
-	return r
+// Write bytes representing a thirty two bit integer.
+func writeInt32(buf *bytes.Buffer, i int32, e *binary.ByteOrder) {
+	binary.Write(buf, *e, i)
 }
 
 func isNativeEndianLittle() bool {
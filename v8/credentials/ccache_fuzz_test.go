@@ -0,0 +1,37 @@
+//go:build go1.18
+// +build go1.18
+
+package credentials
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+)
+
+func FuzzCCache_Unmarshal(f *testing.F) {
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		f.Fatal("Error decoding test data")
+	}
+	f.Add(b)
+	f.Add(b[:len(b)/2])
+	f.Add([]byte{5, 1})
+	f.Add([]byte{5, 2})
+	f.Add([]byte{5, 3})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		c := new(CCache)
+		if err := c.Unmarshal(b); err != nil {
+			return
+		}
+		// Anything that parses must marshal and parse again
+		mb, err := c.Marshal()
+		if err != nil {
+			return
+		}
+		if err := new(CCache).Unmarshal(mb); err != nil {
+			t.Errorf("error parsing marshaled cache: %v", err)
+		}
+	})
+}
@@ -0,0 +1,287 @@
+package credentials
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// Data fields up to this size are read directly into a buffer of the declared length.
+// Larger fields are read in chunks so that a corrupt length cannot cause a large allocation before the data is seen.
+const ccacheMaxPrealloc = 64 * 1024
+
+// ccacheDecoder reads the fields of the credential cache format incrementally from a reader.
+type ccacheDecoder struct {
+	r       *bufio.Reader
+	endian  binary.ByteOrder
+	version uint8
+	err     error
+	b       [4]byte
+}
+
+// newCCacheDecoder returns a decoder for version 4 big-endian data read from the reader provided.
+func newCCacheDecoder(r io.Reader) *ccacheDecoder {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &ccacheDecoder{
+		r:       br,
+		endian:  binary.BigEndian,
+		version: 4,
+	}
+}
+
+// more indicates if there is further data to be read.
+// An error other than the end of the data is recorded in the decoder's err field.
+func (d *ccacheDecoder) more() bool {
+	if d.err != nil {
+		return false
+	}
+	_, err := d.r.Peek(1)
+	if err != nil && err != io.EOF {
+		d.err = err
+	}
+	return err == nil
+}
+
+func (d *ccacheDecoder) readFull(b []byte) error {
+	_, err := io.ReadFull(d.r, b)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return fmt.Errorf("credential cache data truncated: %d bytes needed", len(b))
+	}
+	return err
+}
+
+// Read bytes representing an eight bit integer.
+func (d *ccacheDecoder) readInt8() (int8, error) {
+	if err := d.readFull(d.b[:1]); err != nil {
+		return 0, err
+	}
+	return int8(d.b[0]), nil
+}
+
+// Read bytes representing a sixteen bit integer.
+func (d *ccacheDecoder) readInt16() (int16, error) {
+	if err := d.readFull(d.b[:2]); err != nil {
+		return 0, err
+	}
+	return int16(d.endian.Uint16(d.b[:2])), nil
+}
+
+// Read bytes representing a thirty two bit integer.
+func (d *ccacheDecoder) readInt32() (int32, error) {
+	if err := d.readFull(d.b[:4]); err != nil {
+		return 0, err
+	}
+	return int32(d.endian.Uint32(d.b[:4])), nil
+}
+
+// Read bytes representing a timestamp. Timestamps are unsigned so that they do not overflow in 2038.
+func (d *ccacheDecoder) readTimestamp() (time.Time, error) {
+	i, err := d.readInt32()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(int64(uint32(i)), 0), nil
+}
+
+func (d *ccacheDecoder) readBytes(n int) ([]byte, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("invalid length %d", n)
+	}
+	if n <= ccacheMaxPrealloc {
+		b := make([]byte, n)
+		return b, d.readFull(b)
+	}
+	buf := new(bytes.Buffer)
+	c, err := io.CopyN(buf, d.r, int64(n))
+	if err == io.EOF {
+		return nil, fmt.Errorf("credential cache data truncated: %d bytes needed but only %d available", n, c)
+	}
+	return buf.Bytes(), err
+}
+
+// Read a 32 bit length followed by that number of bytes.
+func (d *ccacheDecoder) readData() ([]byte, error) {
+	l, err := d.readInt32()
+	if err != nil {
+		return nil, err
+	}
+	return d.readBytes(int(l))
+}
+
+// Read a 16 bit length followed by that number of bytes.
+func (d *ccacheDecoder) readData16() ([]byte, error) {
+	l, err := d.readInt16()
+	if err != nil {
+		return nil, err
+	}
+	return d.readBytes(int(uint16(l)))
+}
+
+// Read a 32 bit count of items.
+func (d *ccacheDecoder) readCount() (int, error) {
+	l, err := d.readInt32()
+	if err != nil {
+		return 0, err
+	}
+	if l < 0 {
+		return 0, fmt.Errorf("invalid count %d", l)
+	}
+	return int(l), nil
+}
+
+// Read the bytes of a principal into a principal struct.
+func (d *ccacheDecoder) readPrincipal() (princ Principal, err error) {
+	if d.version != 1 {
+		//Name Type is omitted in version 1
+		princ.PrincipalName.NameType, err = d.readInt32()
+		if err != nil {
+			return
+		}
+	}
+	nc, err := d.readCount()
+	if err != nil {
+		return
+	}
+	if d.version == 1 {
+		//In version 1 the number of components includes the realm. Minus 1 to make consistent with version 2
+		if nc < 1 {
+			err = errors.New("invalid principal component count 0")
+			return
+		}
+		nc--
+	}
+	realm, err := d.readData()
+	if err != nil {
+		return
+	}
+	princ.Realm = string(realm)
+	for i := 0; i < nc; i++ {
+		var s []byte
+		s, err = d.readData()
+		if err != nil {
+			return
+		}
+		princ.PrincipalName.NameString = append(princ.PrincipalName.NameString, string(s))
+	}
+	return
+}
+
+// Read the bytes of a credential into a Credential.
+func (d *ccacheDecoder) readCredential() (cred *Credential, err error) {
+	cred = new(Credential)
+	cred.Client, err = d.readPrincipal()
+	if err != nil {
+		err = fmt.Errorf("error parsing client principal: %v", err)
+		return
+	}
+	cred.Server, err = d.readPrincipal()
+	if err != nil {
+		err = fmt.Errorf("error parsing server principal: %v", err)
+		return
+	}
+	key := types.EncryptionKey{}
+	kt, err := d.readInt16()
+	if err != nil {
+		return
+	}
+	if d.version == 3 {
+		//repeated twice in version 3
+		kt, err = d.readInt16()
+		if err != nil {
+			return
+		}
+	}
+	key.KeyType = int32(kt)
+	key.KeyValue, err = d.readData()
+	if err != nil {
+		err = fmt.Errorf("error parsing key value: %v", err)
+		return
+	}
+	cred.Key = key
+	for _, t := range []*time.Time{&cred.AuthTime, &cred.StartTime, &cred.EndTime, &cred.RenewTill} {
+		*t, err = d.readTimestamp()
+		if err != nil {
+			err = fmt.Errorf("error parsing timestamp: %v", err)
+			return
+		}
+	}
+	ik, err := d.readInt8()
+	if err != nil {
+		return
+	}
+	cred.IsSKey = ik != 0
+	cred.TicketFlags = types.NewKrbFlags()
+	cred.TicketFlags.Bytes, err = d.readBytes(4)
+	if err != nil {
+		err = fmt.Errorf("error parsing ticket flags: %v", err)
+		return
+	}
+	l, err := d.readCount()
+	if err != nil {
+		err = fmt.Errorf("error parsing address count: %v", err)
+		return
+	}
+	for i := 0; i < l; i++ {
+		var a types.HostAddress
+		a, err = d.readAddress()
+		if err != nil {
+			err = fmt.Errorf("error parsing address: %v", err)
+			return
+		}
+		cred.Addresses = append(cred.Addresses, a)
+	}
+	l, err = d.readCount()
+	if err != nil {
+		err = fmt.Errorf("error parsing authorization data count: %v", err)
+		return
+	}
+	for i := 0; i < l; i++ {
+		var a types.AuthorizationDataEntry
+		a, err = d.readAuthDataEntry()
+		if err != nil {
+			err = fmt.Errorf("error parsing authorization data: %v", err)
+			return
+		}
+		cred.AuthData = append(cred.AuthData, a)
+	}
+	cred.Ticket, err = d.readData()
+	if err != nil {
+		err = fmt.Errorf("error parsing ticket: %v", err)
+		return
+	}
+	cred.SecondTicket, err = d.readData()
+	if err != nil {
+		err = fmt.Errorf("error parsing second ticket: %v", err)
+		return
+	}
+	return
+}
+
+func (d *ccacheDecoder) readAddress() (a types.HostAddress, err error) {
+	t, err := d.readInt16()
+	if err != nil {
+		return
+	}
+	a.AddrType = int32(t)
+	a.Address, err = d.readData()
+	return
+}
+
+func (d *ccacheDecoder) readAuthDataEntry() (a types.AuthorizationDataEntry, err error) {
+	t, err := d.readInt16()
+	if err != nil {
+		return
+	}
+	a.ADType = int32(t)
+	a.ADData, err = d.readData()
+	return
+}
@@ -1,9 +1,17 @@
 package credentials
 
 import (
+	"bytes"
 	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	"github.com/Osirium/gokrb5/v8/iana/flags"
 	"github.com/Osirium/gokrb5/v8/iana/nametype"
 	"github.com/Osirium/gokrb5/v8/test/testdata"
 	"github.com/Osirium/gokrb5/v8/types"
@@ -115,6 +123,59 @@ func TestCCache_GetEntry(t *testing.T) {
 	assert.Equal(t, httppn, cred.Server.PrincipalName, "Credential does not have the right server principal name")
 }
 
+func TestCCache_GetEntry_Selection(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	httppn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	old, _ := c.GetEntry(httppn)
+	now := time.Now().UTC()
+	later := *old
+	later.EndTime = old.EndTime.Add(time.Hour)
+	c.Credentials = append(c.Credentials, &later)
+	cred, ok := c.GetEntry(httppn)
+	assert.True(t, ok, "Entry not found")
+	assert.Same(t, &later, cred, "Expired entry with latest end time not returned when none are valid")
+	_, ok = c.GetValidEntry(httppn, now)
+	assert.False(t, ok, "Expired entry should not be valid")
+
+	valid := *old
+	valid.StartTime = now.Add(-time.Hour)
+	valid.EndTime = now.Add(time.Hour)
+	valid.Key.KeyType = 17
+	longer := *old
+	longer.StartTime = now.Add(-time.Hour)
+	longer.EndTime = now.Add(2 * time.Hour)
+	postdated := *old
+	postdated.StartTime = now.Add(time.Hour)
+	postdated.EndTime = now.Add(3 * time.Hour)
+	c.Credentials = append(c.Credentials, &valid, &longer, &postdated)
+	cred, ok = c.GetEntry(httppn)
+	assert.True(t, ok, "Entry not found")
+	assert.Same(t, &longer, cred, "Valid entry with latest end time not returned")
+	cred, ok = c.GetValidEntry(httppn, now)
+	assert.True(t, ok, "Valid entry not found")
+	assert.Same(t, &longer, cred, "Valid entry with latest end time not returned")
+	cred, ok = c.GetValidEntry(httppn, now, 17)
+	assert.True(t, ok, "Valid entry with etype not found")
+	assert.Same(t, &valid, cred, "Entry with the requested etype not returned")
+	cred, ok = c.GetValidEntry(httppn, now.Add(150*time.Minute))
+	assert.True(t, ok, "Postdated entry not found")
+	assert.Same(t, &postdated, cred, "Postdated entry not returned once valid")
+	_, ok = c.GetValidEntry(httppn, now, 23)
+	assert.False(t, ok, "Entry with an unrequested etype should not be returned")
+}
+
 func TestCCache_GetEntries(t *testing.T) {
 	t.Parallel()
 	b, err := hex.DecodeString(testdata.CCACHE_TEST)
@@ -129,3 +190,516 @@ func TestCCache_GetEntries(t *testing.T) {
 	creds := c.GetEntries()
 	assert.Equal(t, 2, len(creds), "Number of credentials entries not as expected")
 }
+
+func TestCCache_Marshal(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	mb, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling cache: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshaled bytes not as expected")
+}
+
+func TestCCache_Export(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	dir, err := ioutil.TempDir(os.TempDir(), "gokrb5-ccache")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "krb5cc")
+	err = c.Export(p)
+	if err != nil {
+		t.Fatalf("Error exporting cache: %v", err)
+	}
+	lc, err := LoadCCache(p)
+	if err != nil {
+		t.Fatalf("Error loading exported cache: %v", err)
+	}
+	assert.Equal(t, c.DefaultPrincipal, lc.DefaultPrincipal, "Default principal not as expected")
+	assert.Equal(t, len(c.Credentials), len(lc.Credentials), "Number of credentials not as expected")
+	assert.Equal(t, c.Credentials[0].Ticket, lc.Credentials[0].Ticket, "Ticket bytes not as expected")
+}
+
+func TestCCache_AddCredential(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	httppn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	cred, _ := c.GetEntry(httppn)
+	renewed := *cred
+	renewed.EndTime = cred.EndTime.Add(time.Hour)
+	c.AddCredential(&renewed)
+	assert.Equal(t, 3, len(c.Credentials), "Existing credential not replaced")
+	cred, _ = c.GetEntry(httppn)
+	assert.Equal(t, renewed.EndTime, cred.EndTime, "Credential end time not updated")
+
+	other := renewed
+	other.Server.PrincipalName = types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "other.test.gokrb5"},
+	}
+	c.AddCredential(&other)
+	assert.Equal(t, 4, len(c.Credentials), "New credential not added")
+}
+
+func TestCCache_MarshalTimestampsAfter2038(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	endTime := time.Date(2040, time.January, 1, 0, 0, 0, 0, time.UTC)
+	renewTill := time.Date(2106, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c.Credentials[0].EndTime = endTime
+	c.Credentials[0].RenewTill = renewTill
+	mb, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling cache: %v", err)
+	}
+	mc := new(CCache)
+	err = mc.Unmarshal(mb)
+	if err != nil {
+		t.Fatalf("Error parsing marshaled cache: %v", err)
+	}
+	assert.Equal(t, endTime, mc.Credentials[0].EndTime.UTC(), "End time after 2038 not as expected")
+	assert.Equal(t, renewTill, mc.Credentials[0].RenewTill.UTC(), "Renew till time after 2038 not as expected")
+}
+
+func TestCCache_Save(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	dir, err := ioutil.TempDir(os.TempDir(), "gokrb5-ccache")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "krb5cc")
+	err = ioutil.WriteFile(p, b, 0640)
+	if err != nil {
+		t.Fatalf("Error writing cache file: %v", err)
+	}
+	c, err := LoadCCache(p)
+	if err != nil {
+		t.Fatalf("Error loading cache: %v", err)
+	}
+	c.Credentials = c.Credentials[:2]
+	err = c.Save()
+	if err != nil {
+		t.Fatalf("Error saving cache: %v", err)
+	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		t.Fatalf("Error getting cache file info: %v", err)
+	}
+	assert.Equal(t, os.FileMode(0640), fi.Mode().Perm(), "File mode not preserved")
+	lc, err := LoadCCache(p)
+	if err != nil {
+		t.Fatalf("Error loading saved cache: %v", err)
+	}
+	assert.Equal(t, 2, len(lc.Credentials), "Number of credentials not as expected")
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 1, len(files), "Temporary file left behind")
+}
+
+func TestCCache_UnmarshalTruncated(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	// Every truncation of the data that does not end on a credential boundary must return an error rather than panic
+	for i := 0; i < len(b); i++ {
+		c := new(CCache)
+		err := c.Unmarshal(b[:i])
+		if err == nil && len(c.Credentials) == 3 {
+			t.Errorf("no error and all credentials returned for data truncated to %d bytes", i)
+		}
+	}
+}
+
+func TestCCache_UnmarshalInvalidLengths(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"version only", "05"},
+		{"header length too long", "0504ffff"},
+		{"negative component count", "05040000" + "00000001" + "ffffffff"},
+		{"huge component count", "05040000" + "00000001" + "7fffffff" + "00000000"},
+		{"realm length too long", "05040000" + "00000001" + "00000001" + "7fffffff"},
+		{"negative realm length", "05040000" + "00000001" + "00000001" + "80000000"},
+	}
+	for _, test := range tests {
+		b, err := hex.DecodeString(test.data)
+		if err != nil {
+			t.Fatalf("Error decoding test data for %s", test.name)
+		}
+		c := new(CCache)
+		assert.Error(t, c.Unmarshal(b), "Expected error for %s", test.name)
+	}
+}
+
+func TestReadCCache(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	expected := new(CCache)
+	err = expected.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	c, err := ReadCCache(iotest.OneByteReader(bytes.NewReader(b)))
+	if err != nil {
+		t.Fatalf("Error reading cache: %v", err)
+	}
+	assert.Equal(t, expected, c, "Cache read from stream not as expected")
+
+	_, err = ReadCCache(iotest.OneByteReader(bytes.NewReader(b[:len(b)-1])))
+	assert.Error(t, err, "Expected error reading truncated cache")
+	_, err = ReadCCache(iotest.TimeoutReader(bytes.NewReader(b)))
+	if assert.Error(t, err, "Expected error from reader") {
+		assert.Contains(t, err.Error(), iotest.ErrTimeout.Error(), "Reader error not returned")
+	}
+}
+
+func TestReadCCache_Large(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	tmpl := c.Credentials[2]
+	for i := 0; i < 5000; i++ {
+		cred := *tmpl
+		cred.Server.PrincipalName = types.NewPrincipalName(tmpl.Server.PrincipalName.NameType, fmt.Sprintf("HTTP/host%d.test.gokrb5", i))
+		cred.Ticket = make([]byte, 1024)
+		c.Credentials = append(c.Credentials, &cred)
+	}
+	mb, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling cache: %v", err)
+	}
+	rc, err := ReadCCache(bytes.NewReader(mb))
+	if err != nil {
+		t.Fatalf("Error reading cache: %v", err)
+	}
+	assert.Equal(t, len(c.Credentials), len(rc.Credentials), "Number of credentials not as expected")
+	assert.Equal(t, c.Credentials[4999].Server, rc.Credentials[4999].Server, "Server principal not as expected")
+}
+
+func TestCredential_Accessors(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	cred := c.Credentials[2]
+	assert.Equal(t, "testuser1@TEST.GOKRB5", cred.ClientPrincipal().String(), "Client principal not as expected")
+	assert.Equal(t, "HTTP/host.test.gokrb5@TEST.GOKRB5", cred.ServerPrincipal().String(), "Server principal not as expected")
+	assert.True(t, cred.ServerPrincipal().Equal(NewPrincipal(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5"), "TEST.GOKRB5")), "Server principal not equal")
+	assert.False(t, cred.ServerPrincipal().Equal(cred.ClientPrincipal()), "Client and server principals should not be equal")
+	assert.Equal(t, cred.Key, cred.SessionKey(), "Session key not as expected")
+	assert.Equal(t, cred.Ticket, cred.TicketBytes(), "Ticket bytes not as expected")
+	assert.Equal(t, cred.SecondTicket, cred.SecondTicketBytes(), "Second ticket bytes not as expected")
+	assert.Equal(t, cred.TicketFlags, cred.Flags(), "Flags not as expected")
+	assert.True(t, cred.HasFlag(flags.Forwardable), "Forwardable flag not set")
+	authTime, startTime, endTime, renewTill := cred.Times()
+	assert.Equal(t, cred.AuthTime, authTime, "Auth time not as expected")
+	assert.Equal(t, cred.StartTime, startTime, "Start time not as expected")
+	assert.Equal(t, cred.EndTime, endTime, "End time not as expected")
+	assert.Equal(t, cred.RenewTill, renewTill, "Renew till time not as expected")
+	assert.True(t, cred.Expired(), "Credential should have expired")
+}
+
+func TestCCache_KDCOffset(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	d, ok := c.GetKDCOffset()
+	assert.True(t, ok, "KDC offset not found")
+	assert.Equal(t, 6*time.Second, d, "KDC offset not as expected")
+	assert.Equal(t, 6*time.Second, c.GetClientCredentials().KDCOffset(), "Client credentials KDC offset not as expected")
+
+	c.SetKDCOffset(-90*time.Second - 500*time.Microsecond)
+	mb, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling cache: %v", err)
+	}
+	c2 := new(CCache)
+	err = c2.Unmarshal(mb)
+	if err != nil {
+		t.Fatalf("Error parsing marshaled cache: %v", err)
+	}
+	d, ok = c2.GetKDCOffset()
+	assert.True(t, ok, "KDC offset not found")
+	assert.Equal(t, -90*time.Second-500*time.Microsecond, d, "KDC offset not as expected")
+
+	c3 := &CCache{Version: 4}
+	_, ok = c3.GetKDCOffset()
+	assert.False(t, ok, "KDC offset should not be found")
+	c3.SetKDCOffset(time.Minute)
+	d, ok = c3.GetKDCOffset()
+	assert.True(t, ok, "KDC offset not found")
+	assert.Equal(t, time.Minute, d, "KDC offset not as expected")
+}
+
+func TestCCache_ConfigEntries(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	entries := c.ConfigEntries()
+	assert.Equal(t, []ConfigEntry{{Name: ConfigFASTAvail, Principal: "krbtgt/TEST.GOKRB5@TEST.GOKRB5", Value: []byte("yes")}}, entries, "Config entries not as expected")
+	assert.True(t, c.FASTAvail("TEST.GOKRB5"), "FAST should be available")
+	assert.False(t, c.FASTAvail("OTHER.GOKRB5"), "FAST should not be available for other realm")
+	_, ok := c.PAType("TEST.GOKRB5")
+	assert.False(t, ok, "PA type should not be found")
+
+	c.SetConfigEntry(ConfigPAType, "krbtgt/TEST.GOKRB5@TEST.GOKRB5", []byte("2"))
+	rt := time.Date(2017, 7, 13, 12, 0, 0, 0, time.UTC)
+	c.SetRefreshTime(rt)
+	c.SetConfigEntry(ConfigStartRealm, "", []byte("TEST.GOKRB5"))
+	c.SetConfigEntry(ConfigStartRealm, "", []byte("TEST.GOKRB5"))
+	assert.Equal(t, 4, len(c.ConfigEntries()), "Number of config entries not as expected")
+	assert.Equal(t, 2, len(c.GetEntries()), "Config entries should not be returned as credentials")
+
+	mb, err := c.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling cache: %v", err)
+	}
+	c2 := new(CCache)
+	err = c2.Unmarshal(mb)
+	if err != nil {
+		t.Fatalf("Error parsing marshaled cache: %v", err)
+	}
+	pa, ok := c2.PAType("TEST.GOKRB5")
+	assert.True(t, ok, "PA type not found")
+	assert.Equal(t, int32(2), pa, "PA type not as expected")
+	r, ok := c2.RefreshTime()
+	assert.True(t, ok, "Refresh time not found")
+	assert.Equal(t, rt, r, "Refresh time not as expected")
+	sr, ok := c2.StartRealm()
+	assert.True(t, ok, "Start realm not found")
+	assert.Equal(t, "TEST.GOKRB5", sr, "Start realm not as expected")
+	_, ok = c2.ProxyImpersonator()
+	assert.False(t, ok, "Proxy impersonator should not be found")
+
+	assert.True(t, c2.RemoveConfigEntry(ConfigFASTAvail, "krbtgt/TEST.GOKRB5@TEST.GOKRB5"), "Config entry not removed")
+	assert.False(t, c2.FASTAvail("TEST.GOKRB5"), "FAST should no longer be available")
+}
+
+func TestCCache_Destroy(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	dir, err := ioutil.TempDir(os.TempDir(), "gokrb5-ccache")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cpath := filepath.Join(dir, "krb5cc")
+	err = ioutil.WriteFile(cpath, b, 0600)
+	if err != nil {
+		t.Fatalf("Error writing cache file: %v", err)
+	}
+	// A second link to the file allows its contents to be checked once the cache path has been removed
+	link := filepath.Join(dir, "link")
+	err = os.Link(cpath, link)
+	if err != nil {
+		t.Skipf("hard links not supported: %v", err)
+	}
+	c, err := LoadCCache(cpath)
+	if err != nil {
+		t.Fatalf("Error loading cache: %v", err)
+	}
+	key := c.Credentials[0].Key.KeyValue
+	tkt := c.Credentials[0].Ticket
+	err = c.Destroy()
+	if err != nil {
+		t.Fatalf("Error destroying cache: %v", err)
+	}
+	assert.Equal(t, make([]byte, len(key)), key, "Key material not overwritten")
+	assert.Equal(t, make([]byte, len(tkt)), tkt, "Ticket not overwritten")
+	assert.Equal(t, 0, len(c.Credentials), "Credentials not removed")
+	_, err = os.Stat(cpath)
+	assert.True(t, os.IsNotExist(err), "Cache file not removed")
+	lb, err := ioutil.ReadFile(link)
+	if err != nil {
+		t.Fatalf("Error reading linked file: %v", err)
+	}
+	assert.Equal(t, 0, len(lb), "Cache file not truncated")
+
+	err = c.Destroy()
+	assert.True(t, os.IsNotExist(err), "Expected not exist error destroying cache again")
+}
+
+func TestMergeCCaches(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	a := new(CCache)
+	if err := a.Unmarshal(b); err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	c := new(CCache)
+	if err := c.Unmarshal(b); err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	httppn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	cred, _ := c.GetEntry(httppn)
+	cred.EndTime = cred.EndTime.Add(time.Hour)
+	tgt := *c.Credentials[0]
+	tgt.EndTime = tgt.EndTime.Add(-time.Hour)
+	c.Credentials[0] = &tgt
+	other := *cred
+	other.Server.PrincipalName = types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "other.test.gokrb5"},
+	}
+	c.Credentials = append(c.Credentials, &other)
+
+	m, err := MergeCCaches(a, c)
+	if err != nil {
+		t.Fatalf("Error merging caches: %v", err)
+	}
+	assert.Equal(t, a.DefaultPrincipal, m.DefaultPrincipal, "Default principal not as expected")
+	assert.Equal(t, 4, len(m.Credentials), "Credentials not deduplicated")
+	assert.Same(t, a.Credentials[0], m.Credentials[0], "TGT with the later end time not kept")
+	assert.Same(t, a.Credentials[1], m.Credentials[1], "First configuration entry not kept")
+	assert.Same(t, cred, m.Credentials[2], "Service ticket with the later end time not kept")
+	assert.Same(t, &other, m.Credentials[3], "Credential only in the second cache not added")
+	d, ok := m.GetKDCOffset()
+	assert.True(t, ok, "KDC offset not taken from the first cache")
+	assert.Equal(t, 6*time.Second, d, "KDC offset not as expected")
+
+	c.DefaultPrincipal.Realm = "OTHER.GOKRB5"
+	_, err = MergeCCaches(a, c)
+	assert.Error(t, err, "Caches for different principals should not be merged")
+}
+
+func TestCCache_MarshalVersion(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	if err := c.Unmarshal(b); err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	for v := uint8(1); v <= 4; v++ {
+		mb, err := c.MarshalVersion(v)
+		if err != nil {
+			t.Fatalf("Error marshaling version %d: %v", v, err)
+		}
+		assert.Equal(t, v, mb[1], "Version byte not as expected")
+		u := new(CCache)
+		if err := u.Unmarshal(mb); err != nil {
+			t.Fatalf("Error parsing version %d cache: %v", v, err)
+		}
+		assert.Equal(t, v, u.Version, "Version not as expected")
+		assert.Equal(t, c.DefaultPrincipal.Realm, u.DefaultPrincipal.Realm, "Default principal realm not as expected for version %d", v)
+		assert.Equal(t, c.DefaultPrincipal.PrincipalName.NameString, u.DefaultPrincipal.PrincipalName.NameString, "Default principal not as expected for version %d", v)
+		assert.Equal(t, len(c.Credentials), len(u.Credentials), "Number of credentials not as expected for version %d", v)
+		for i := range c.Credentials {
+			assert.Equal(t, c.Credentials[i].Key, u.Credentials[i].Key, "Key not as expected for version %d", v)
+			assert.Equal(t, c.Credentials[i].Ticket, u.Credentials[i].Ticket, "Ticket not as expected for version %d", v)
+			assert.Equal(t, c.Credentials[i].EndTime, u.Credentials[i].EndTime, "End time not as expected for version %d", v)
+		}
+		_, ok := u.GetKDCOffset()
+		assert.Equal(t, v == 4, ok, "KDC offset presence not as expected for version %d", v)
+	}
+	_, err = c.MarshalVersion(5)
+	assert.Error(t, err, "Invalid version should not be marshaled")
+
+	dir, err := ioutil.TempDir("", "ccache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "krb5cc")
+	if err := c.Export(p, WithVersion(3)); err != nil {
+		t.Fatalf("Error exporting cache: %v", err)
+	}
+	fc := NewFileCache(p)
+	if err := fc.Remove(c.Credentials[2].Server.PrincipalName); err != nil {
+		t.Fatalf("Error removing credential: %v", err)
+	}
+	l, err := LoadCCache(p)
+	if err != nil {
+		t.Fatalf("Error loading cache: %v", err)
+	}
+	assert.Equal(t, uint8(3), l.Version, "Version not preserved when the file cache is updated")
+	assert.Equal(t, 2, len(l.Credentials), "Credential not removed")
+}
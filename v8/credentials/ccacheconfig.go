@@ -0,0 +1,173 @@
+package credentials
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// Configuration entries are stored in the cache as credentials for the server principal
+// krb5_ccache_conf_data/<name>[/<principal>]@X-CACHECONF: with the entry's value held in the ticket field.
+// See https://web.mit.edu/kerberos/krb5-latest/doc/formats/ccache_file_format.html
+const (
+	configRealm  = "X-CACHECONF:"
+	configPrefix = "krb5_ccache_conf_data"
+)
+
+// Configuration entry names used by MIT Kerberos.
+const (
+	// ConfigFASTAvail records that the KDC for the principal's realm supports FAST. The value is "yes".
+	ConfigFASTAvail = "fast_avail"
+	// ConfigPAType records the pre-authentication type used to obtain the TGT, as a decimal string.
+	ConfigPAType = "pa_type"
+	// ConfigRefreshTime records when the cache's credentials should be refreshed, as a decimal POSIX timestamp.
+	ConfigRefreshTime = "refresh_time"
+	// ConfigProxyImpersonator records the principal that obtained the cache's credentials through constrained delegation.
+	ConfigProxyImpersonator = "proxy_impersonator"
+	// ConfigPAConfigData records JSON data from pre-authentication mechanisms.
+	ConfigPAConfigData = "pa_config_data"
+	// ConfigStartRealm records the realm of the TGT the cache's credentials were obtained with.
+	ConfigStartRealm = "start_realm"
+)
+
+// ConfigEntry is a configuration entry held in a credential cache.
+type ConfigEntry struct {
+	// Name of the configuration entry.
+	Name string
+	// Principal the entry relates to in the form name@REALM. Empty if the entry does not relate to a principal.
+	Principal string
+	// Value of the entry.
+	Value []byte
+}
+
+// IsConfigEntry tests if the credential is a cache configuration entry rather than a ticket.
+func (cred *Credential) IsConfigEntry() bool {
+	return strings.HasPrefix(cred.Server.Realm, "X-CACHECONF")
+}
+
+// configEntry returns the configuration entry held in the credential.
+func (cred *Credential) configEntry() (ConfigEntry, bool) {
+	n := cred.Server.PrincipalName.NameString
+	if !cred.IsConfigEntry() || len(n) < 2 || n[0] != configPrefix {
+		return ConfigEntry{}, false
+	}
+	e := ConfigEntry{
+		Name:  n[1],
+		Value: cred.Ticket,
+	}
+	if len(n) > 2 {
+		e.Principal = strings.Join(n[2:], "/")
+	}
+	return e, true
+}
+
+// configServerName returns the server principal name under which a configuration entry is stored.
+func configServerName(name, principal string) types.PrincipalName {
+	pn := types.PrincipalName{
+		NameType:   nametype.KRB_NT_UNKNOWN,
+		NameString: []string{configPrefix, name},
+	}
+	if principal != "" {
+		pn.NameString = append(pn.NameString, principal)
+	}
+	return pn
+}
+
+// ConfigEntries returns the configuration entries held in the cache.
+func (c *CCache) ConfigEntries() []ConfigEntry {
+	var entries []ConfigEntry
+	for _, cred := range c.Credentials {
+		if e, ok := cred.configEntry(); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// GetConfigEntry returns the value of the named configuration entry.
+// The principal should be in the form name@REALM, or an empty string for entries that do not relate to a principal.
+func (c *CCache) GetConfigEntry(name, principal string) ([]byte, bool) {
+	for _, cred := range c.Credentials {
+		if e, ok := cred.configEntry(); ok && e.Name == name && e.Principal == principal {
+			return e.Value, true
+		}
+	}
+	return nil, false
+}
+
+// SetConfigEntry sets the value of the named configuration entry, replacing any existing value.
+// The principal should be in the form name@REALM, or an empty string for entries that do not relate to a principal.
+func (c *CCache) SetConfigEntry(name, principal string, value []byte) {
+	c.AddCredential(&Credential{
+		Client: c.DefaultPrincipal,
+		Server: Principal{
+			Realm:         configRealm,
+			PrincipalName: configServerName(name, principal),
+		},
+		TicketFlags: types.NewKrbFlags(),
+		Ticket:      value,
+	})
+}
+
+// RemoveConfigEntry removes the named configuration entry.
+// Returns true if the entry was found and removed.
+func (c *CCache) RemoveConfigEntry(name, principal string) bool {
+	return c.RemoveEntry(configServerName(name, principal))
+}
+
+// FASTAvail indicates if the cache records that the KDC for the realm provided supports FAST.
+func (c *CCache) FASTAvail(realm string) bool {
+	v, ok := c.GetConfigEntry(ConfigFASTAvail, tgsPrincipal(realm))
+	return ok && string(v) == "yes"
+}
+
+// PAType returns the pre-authentication type recorded as used to obtain the TGT for the realm provided.
+func (c *CCache) PAType(realm string) (int32, bool) {
+	v, ok := c.GetConfigEntry(ConfigPAType, tgsPrincipal(realm))
+	if !ok {
+		return 0, false
+	}
+	i, err := strconv.ParseInt(string(v), 10, 32)
+	if err != nil {
+		return 0, false
+	}
+	return int32(i), true
+}
+
+// RefreshTime returns the time at which the cache records its credentials should be refreshed.
+func (c *CCache) RefreshTime() (time.Time, bool) {
+	v, ok := c.GetConfigEntry(ConfigRefreshTime, "")
+	if !ok {
+		return time.Time{}, false
+	}
+	i, err := strconv.ParseInt(string(v), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(i, 0).UTC(), true
+}
+
+// SetRefreshTime records the time at which the cache's credentials should be refreshed.
+func (c *CCache) SetRefreshTime(t time.Time) {
+	c.SetConfigEntry(ConfigRefreshTime, "", []byte(strconv.FormatInt(t.Unix(), 10)))
+}
+
+// StartRealm returns the realm recorded for the TGT the cache's credentials were obtained with.
+func (c *CCache) StartRealm() (string, bool) {
+	v, ok := c.GetConfigEntry(ConfigStartRealm, "")
+	return string(v), ok
+}
+
+// ProxyImpersonator returns the principal recorded as having obtained the cache's credentials through constrained delegation.
+func (c *CCache) ProxyImpersonator() (string, bool) {
+	v, ok := c.GetConfigEntry(ConfigProxyImpersonator, "")
+	return string(v), ok
+}
+
+// tgsPrincipal returns the ticket granting service principal for the realm in the form name@REALM.
+func tgsPrincipal(realm string) string {
+	return "krbtgt/" + realm + "@" + realm
+}
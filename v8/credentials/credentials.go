@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"encoding/gob"
 	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/Osirium/gokrb5/v8/iana/nametype"
@@ -35,6 +36,7 @@ type Credentials struct {
 	authTime        time.Time
 	groupMembership map[string]bool
 	sessionID       string
+	kdcOffset       time.Duration
 }
 
 // marshalCredentials is used to enable marshaling and unmarshaling of credentials
@@ -68,19 +70,30 @@ type ADCredentials struct {
 	LogonDomainName     string
 	LogonDomainID       string
 	LogonServer         string
+	// S4U2ProxyTarget is the service the client's ticket was obtained for by constrained delegation (S4U2Proxy), empty
+	// if the ticket was not obtained by delegation.
+	S4U2ProxyTarget string
+	// S4UTransitedServices are the services the client's ticket has been delegated through.
+	S4UTransitedServices []string
 }
 
 // New creates a new Credentials instance.
+// A username of the form user@domain, such as an Active Directory user principal name, is an enterprise principal
+// name that the KDC maps to the principal's canonical name.
 func New(username string, realm string) *Credentials {
 	uid, err := uuid.GenerateUUID()
 	if err != nil {
 		uid = "00unique-sess-ions-uuid-unavailable0"
 	}
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, username)
+	if strings.Contains(username, "@") {
+		cname = types.NewEnterprisePrincipalName(username)
+	}
 	return &Credentials{
 		username:        username,
 		displayName:     username,
 		realm:           realm,
-		cname:           types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, username),
+		cname:           cname,
 		keytab:          keytab.New(),
 		attributes:      make(map[string]interface{}),
 		groupMembership: make(map[string]bool),
@@ -96,6 +109,22 @@ func NewFromPrincipalName(cname types.PrincipalName, realm string) *Credentials
 	return c
 }
 
+// Copy returns a copy of the credentials that can be modified without affecting them. The copy shares the keytab of
+// the credentials.
+func (c *Credentials) Copy() *Credentials {
+	n := *c
+	n.cname.NameString = append([]string(nil), c.cname.NameString...)
+	n.attributes = make(map[string]interface{}, len(c.attributes))
+	for k, v := range c.attributes {
+		n.attributes[k] = v
+	}
+	n.groupMembership = make(map[string]bool, len(c.groupMembership))
+	for k, v := range c.groupMembership {
+		n.groupMembership[k] = v
+	}
+	return &n
+}
+
 // WithKeytab sets the Keytab in the Credentials struct.
 func (c *Credentials) WithKeytab(kt *keytab.Keytab) *Credentials {
 	c.keytab = kt
@@ -141,6 +170,17 @@ func (c *Credentials) SetValidUntil(t time.Time) {
 	c.validUntil = t
 }
 
+// KDCOffset returns the offset of the KDC's clock from the local clock.
+func (c *Credentials) KDCOffset() time.Duration {
+	return c.kdcOffset
+}
+
+// SetKDCOffset sets the offset of the KDC's clock from the local clock.
+// The offset is applied to the times in the requests and authenticators generated for the credentials.
+func (c *Credentials) SetKDCOffset(d time.Duration) {
+	c.kdcOffset = d
+}
+
 // SetADCredentials adds ADCredentials attributes to the credentials
 func (c *Credentials) SetADCredentials(a ADCredentials) {
 	c.SetAttribute(AttributeKeyADCredentials, a)
@@ -3,6 +3,7 @@ package credentials
 import (
 	"testing"
 
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
 	"github.com/jcmturner/goidentity/v6"
 	"github.com/stretchr/testify/assert"
 )
@@ -26,3 +27,12 @@ func TestCredentials_Marshal(t *testing.T) {
 		t.Fatalf("could not unmarshal credetials: %v", err)
 	}
 }
+
+func TestNew_EnterpriseName(t *testing.T) {
+	t.Parallel()
+	c := New("jsmith@example.com", "EXAMPLE.COM")
+	assert.Equal(t, nametype.KRB_NT_ENTERPRISE, c.CName().NameType, "name type not as expected")
+	assert.Equal(t, []string{"jsmith@example.com"}, c.CName().NameString, "name not as expected")
+	c = New("jsmith", "EXAMPLE.COM")
+	assert.Equal(t, nametype.KRB_NT_PRINCIPAL, c.CName().NameType, "name type not as expected")
+}
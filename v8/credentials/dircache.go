@@ -0,0 +1,79 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// DIR credential cache collections are laid out as implemented by MIT krb5 (src/lib/krb5/ccache/cc_dir.c).
+// The directory holds FILE caches named tkt* and a file named primary that contains the file name of the primary cache.
+const (
+	dirPrimaryFile       = "primary"
+	dirDefaultSubsidiary = "tkt"
+)
+
+// DirCache is a FILE credential cache that is a member of a DIR cache collection.
+type DirCache struct {
+	FileCache
+	dir string
+}
+
+// newDirCache parses the residual of a DIR cache name.
+// The residual is either the collection directory, in which case the collection's primary cache is used,
+// or a colon followed by the path of a specific cache file within the collection.
+func newDirCache(residual string) (CredentialCache, error) {
+	if strings.HasPrefix(residual, ":") {
+		p := residual[1:]
+		if !strings.HasPrefix(filepath.Base(p), dirDefaultSubsidiary) {
+			return nil, fmt.Errorf("DIR credential cache file name %s does not begin with %s", p, dirDefaultSubsidiary)
+		}
+		return NewDirCache(filepath.Dir(p), filepath.Base(p)), nil
+	}
+	if residual == "" {
+		return nil, errors.New("DIR credential cache name does not specify a directory")
+	}
+	return NewDirCache(residual, ""), nil
+}
+
+// NewDirCache returns the DirCache for the named cache file within the collection directory provided.
+// If the name is an empty string the collection's primary cache is used.
+func NewDirCache(dir, name string) *DirCache {
+	if name == "" {
+		name = dirDefaultSubsidiary
+		if b, err := ioutil.ReadFile(filepath.Join(dir, dirPrimaryFile)); err == nil {
+			if n := strings.TrimSpace(string(b)); n != "" {
+				name = n
+			}
+		}
+	}
+	return &DirCache{
+		FileCache: FileCache{path: filepath.Join(dir, name)},
+		dir:       dir,
+	}
+}
+
+// Name returns the full name of the cache.
+func (d *DirCache) Name() string {
+	return CCacheTypeDir + "::" + d.path
+}
+
+// Initialize creates the collection directory if required, makes this cache the primary if there is no primary and
+// replaces the cache file with an empty cache for the default principal provided.
+func (d *DirCache) Initialize(cname types.PrincipalName, realm string) error {
+	if err := os.MkdirAll(d.dir, 0700); err != nil {
+		return err
+	}
+	pp := filepath.Join(d.dir, dirPrimaryFile)
+	if _, err := os.Stat(pp); os.IsNotExist(err) {
+		if err := writeFileAtomic(pp, []byte(filepath.Base(d.path)+"\n")); err != nil {
+			return err
+		}
+	}
+	return d.FileCache.Initialize(cname, realm)
+}
@@ -0,0 +1,295 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// KCM protocol as implemented by MIT krb5 (see include/kcm.h) and sssd-kcm.
+// Each request is sent over a unix socket prefixed with a 4 byte big-endian length and starts with the protocol
+// major and minor version bytes followed by a 16 bit opcode. Each reply is prefixed in the same way and starts
+// with a 32 bit status code. Principals and credentials are encoded as in version 4 of the ccache file format.
+const (
+	// KCMDefaultSocket is the default path of the KCM daemon's unix socket.
+	KCMDefaultSocket = "/var/run/.heim_org.h5l.kcm-socket"
+
+	kcmProtocolVersionMajor = 2
+	kcmProtocolVersionMinor = 0
+	kcmUUIDLen              = 16
+	kcmMaxReplyLen          = 10 * 1024 * 1024
+)
+
+// KCM operation codes.
+const (
+	kcmOpNoop uint16 = iota
+	kcmOpGetName
+	kcmOpResolve
+	kcmOpGenNew
+	kcmOpInitialize
+	kcmOpDestroy
+	kcmOpStore
+	kcmOpRetrieve
+	kcmOpGetPrincipal
+	kcmOpGetCredUUIDList
+	kcmOpGetCredByUUID
+	kcmOpRemoveCred
+	kcmOpSetFlags
+	kcmOpChown
+	kcmOpChmod
+	kcmOpGetInitialTicket
+	kcmOpGetTicket
+	kcmOpMoveCache
+	kcmOpGetCacheUUIDList
+	kcmOpGetCacheByUUID
+	kcmOpGetDefaultCache
+	kcmOpSetDefaultCache
+	kcmOpGetKDCOffset
+	kcmOpSetKDCOffset
+)
+
+// Kerberos library status codes that may be returned by the KCM daemon.
+const (
+	kcmStatusCCNotFound int32 = -1765328243 // KRB5_CC_NOTFOUND
+	kcmStatusCCEnd      int32 = -1765328242 // KRB5_CC_END
+	kcmStatusFCCNoFile  int32 = -1765328189 // KRB5_FCC_NOFILE
+	kcmStatusCCNoSupp   int32 = -1765328137 // KRB5_CC_NOSUPP
+)
+
+// KCMError is returned when the KCM daemon replies with a non-zero status code.
+type KCMError struct {
+	Code int32
+}
+
+// Error implements the error interface.
+func (e KCMError) Error() string {
+	switch e.Code {
+	case kcmStatusCCNotFound:
+		return "KCM error: matching credential not found"
+	case kcmStatusCCEnd:
+		return "KCM error: end of credential cache reached"
+	case kcmStatusFCCNoFile:
+		return "KCM error: no credentials cache found"
+	case kcmStatusCCNoSupp:
+		return "KCM error: operation not supported by the KCM daemon"
+	}
+	return fmt.Sprintf("KCM error: status code %d", e.Code)
+}
+
+// KCMClient communicates with a Kerberos Credential Manager (KCM) daemon, such as sssd-kcm, over its unix socket.
+type KCMClient struct {
+	socket  string
+	timeout time.Duration
+}
+
+// NewKCMClient creates a new KCMClient for the unix socket path provided.
+// If the path is an empty string the default KCM socket path is used.
+func NewKCMClient(socket string) *KCMClient {
+	if socket == "" {
+		socket = KCMDefaultSocket
+	}
+	return &KCMClient{
+		socket:  socket,
+		timeout: 5 * time.Second,
+	}
+}
+
+// DefaultCacheName returns the name of the default credential cache held by the KCM daemon.
+func (k *KCMClient) DefaultCacheName() (string, error) {
+	r, err := k.call(kcmOpGetDefaultCache, nil)
+	if err != nil {
+		return "", err
+	}
+	var p int
+	return readCString(r, &p)
+}
+
+// SetDefaultCache sets the default credential cache held by the KCM daemon.
+func (k *KCMClient) SetDefaultCache(name string) error {
+	_, err := k.call(kcmOpSetDefaultCache, cString(name))
+	return err
+}
+
+// NewCacheName requests the KCM daemon generates a new, unique credential cache name.
+func (k *KCMClient) NewCacheName() (string, error) {
+	r, err := k.call(kcmOpGenNew, nil)
+	if err != nil {
+		return "", err
+	}
+	var p int
+	return readCString(r, &p)
+}
+
+// Initialize (re)creates the named credential cache for the default principal provided.
+// Any credentials already in the cache are removed.
+func (k *KCMClient) Initialize(name string, cname types.PrincipalName, realm string) error {
+	buf := bytes.NewBuffer(cString(name))
+	writePrincipal(buf, Principal{Realm: realm, PrincipalName: cname}, 4, &kcmEndian)
+	_, err := k.call(kcmOpInitialize, buf.Bytes())
+	return err
+}
+
+// Store adds a credential to the named credential cache.
+func (k *KCMClient) Store(name string, cred *Credential) error {
+	buf := bytes.NewBuffer(cString(name))
+	writeCredential(buf, cred, 4, &kcmEndian)
+	_, err := k.call(kcmOpStore, buf.Bytes())
+	return err
+}
+
+// Remove deletes the credential matching the one provided from the named credential cache.
+func (k *KCMClient) Remove(name string, cred *Credential) error {
+	buf := bytes.NewBuffer(cString(name))
+	writeInt32(buf, 0, &kcmEndian)
+	writeCredential(buf, cred, 4, &kcmEndian)
+	_, err := k.call(kcmOpRemoveCred, buf.Bytes())
+	return err
+}
+
+// Destroy deletes the named credential cache from the KCM daemon.
+func (k *KCMClient) Destroy(name string) error {
+	_, err := k.call(kcmOpDestroy, cString(name))
+	return err
+}
+
+// GetPrincipal returns the default principal name and realm of the named credential cache.
+func (k *KCMClient) GetPrincipal(name string) (types.PrincipalName, string, error) {
+	r, err := k.call(kcmOpGetPrincipal, cString(name))
+	if err != nil {
+		return types.PrincipalName{}, "", err
+	}
+	princ, err := newCCacheDecoder(bytes.NewReader(r)).readPrincipal()
+	if err != nil {
+		return types.PrincipalName{}, "", fmt.Errorf("error parsing KCM principal: %v", err)
+	}
+	return princ.PrincipalName, princ.Realm, nil
+}
+
+// GetKDCOffset returns the KDC time offset recorded for the named credential cache.
+func (k *KCMClient) GetKDCOffset(name string) (time.Duration, error) {
+	r, err := k.call(kcmOpGetKDCOffset, cString(name))
+	if err != nil {
+		return 0, err
+	}
+	o, err := newCCacheDecoder(bytes.NewReader(r)).readInt32()
+	if err != nil {
+		return 0, fmt.Errorf("error parsing KCM KDC offset: %v", err)
+	}
+	return time.Duration(o) * time.Second, nil
+}
+
+// SetKDCOffset records the KDC time offset for the named credential cache.
+func (k *KCMClient) SetKDCOffset(name string, d time.Duration) error {
+	buf := bytes.NewBuffer(cString(name))
+	writeInt32(buf, int32(d/time.Second), &kcmEndian)
+	_, err := k.call(kcmOpSetKDCOffset, buf.Bytes())
+	return err
+}
+
+// Credentials returns all the credentials held in the named credential cache.
+func (k *KCMClient) Credentials(name string) ([]*Credential, error) {
+	r, err := k.call(kcmOpGetCredUUIDList, cString(name))
+	if err != nil {
+		return nil, err
+	}
+	var creds []*Credential
+	for p := 0; p+kcmUUIDLen <= len(r); p += kcmUUIDLen {
+		uuid := r[p : p+kcmUUIDLen]
+		if bytes.Equal(uuid, make([]byte, kcmUUIDLen)) {
+			// A zero UUID terminates the list
+			break
+		}
+		cr, err := k.call(kcmOpGetCredByUUID, append(cString(name), uuid...))
+		if err != nil {
+			return creds, err
+		}
+		cred, err := newCCacheDecoder(bytes.NewReader(cr)).readCredential()
+		if err != nil {
+			return creds, err
+		}
+		creds = append(creds, cred)
+	}
+	return creds, nil
+}
+
+// Load reads the named credential cache from the KCM daemon into a CCache.
+// If the name is an empty string the default cache is loaded.
+func (k *KCMClient) Load(name string) (*CCache, error) {
+	c := &CCache{Version: 4}
+	if name == "" {
+		n, err := k.DefaultCacheName()
+		if err != nil {
+			return c, err
+		}
+		name = n
+	}
+	cname, realm, err := k.GetPrincipal(name)
+	if err != nil {
+		return c, err
+	}
+	c.DefaultPrincipal = Principal{Realm: realm, PrincipalName: cname}
+	c.Credentials, err = k.Credentials(name)
+	return c, err
+}
+
+// call sends a request to the KCM daemon and returns the reply data following the status code.
+func (k *KCMClient) call(op uint16, data []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", k.socket, k.timeout)
+	if err != nil {
+		return nil, fmt.Errorf("could not connect to KCM socket %s: %v", k.socket, err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(k.timeout)); err != nil {
+		return nil, err
+	}
+	req := make([]byte, 8, 8+len(data))
+	binary.BigEndian.PutUint32(req[0:4], uint32(4+len(data)))
+	req[4] = kcmProtocolVersionMajor
+	req[5] = kcmProtocolVersionMinor
+	binary.BigEndian.PutUint16(req[6:8], op)
+	req = append(req, data...)
+	if _, err := conn.Write(req); err != nil {
+		return nil, fmt.Errorf("error sending request to KCM: %v", err)
+	}
+	lb := make([]byte, 4)
+	if _, err := io.ReadFull(conn, lb); err != nil {
+		return nil, fmt.Errorf("error reading KCM reply length: %v", err)
+	}
+	l := binary.BigEndian.Uint32(lb)
+	if l < 4 || l > kcmMaxReplyLen {
+		return nil, fmt.Errorf("invalid KCM reply length %d", l)
+	}
+	rb := make([]byte, l)
+	if _, err := io.ReadFull(conn, rb); err != nil {
+		return nil, fmt.Errorf("error reading KCM reply: %v", err)
+	}
+	if status := int32(binary.BigEndian.Uint32(rb[0:4])); status != 0 {
+		return nil, KCMError{Code: status}
+	}
+	return rb[4:], nil
+}
+
+// KCM integers are always big-endian.
+var kcmEndian binary.ByteOrder = binary.BigEndian
+
+// cString returns the bytes of the string terminated with a null byte.
+func cString(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// readCString reads a null terminated string.
+func readCString(b []byte, p *int) (string, error) {
+	i := bytes.IndexByte(b[*p:], 0)
+	if i < 0 {
+		return "", errors.New("KCM reply string is not null terminated")
+	}
+	s := string(b[*p : *p+i])
+	*p += i + 1
+	return s, nil
+}
@@ -0,0 +1,220 @@
+package credentials
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeKCM is a minimal in memory KCM daemon used for testing.
+type fakeKCM struct {
+	l      net.Listener
+	mux    sync.Mutex
+	caches map[string]*fakeKCMCache
+	dflt   string
+}
+
+type fakeKCMCache struct {
+	princ  []byte
+	creds  [][]byte
+	offset int32
+}
+
+func newFakeKCM(t *testing.T) (*fakeKCM, string, func()) {
+	dir, err := ioutil.TempDir(os.TempDir(), "gokrb5-kcm")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	sock := filepath.Join(dir, "kcm.socket")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Skipf("unix sockets not available: %v", err)
+	}
+	k := &fakeKCM{
+		l:      l,
+		caches: make(map[string]*fakeKCMCache),
+		dflt:   "0",
+	}
+	go k.serve()
+	return k, sock, func() {
+		l.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func (k *fakeKCM) serve() {
+	for {
+		conn, err := k.l.Accept()
+		if err != nil {
+			return
+		}
+		go k.handle(conn)
+	}
+}
+
+func (k *fakeKCM) handle(conn net.Conn) {
+	defer conn.Close()
+	lb := make([]byte, 4)
+	if _, err := io.ReadFull(conn, lb); err != nil {
+		return
+	}
+	req := make([]byte, binary.BigEndian.Uint32(lb))
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	status, reply := k.process(binary.BigEndian.Uint16(req[2:4]), req[4:])
+	rb := make([]byte, 8, 8+len(reply))
+	binary.BigEndian.PutUint32(rb[0:4], uint32(4+len(reply)))
+	binary.BigEndian.PutUint32(rb[4:8], uint32(status))
+	conn.Write(append(rb, reply...))
+}
+
+func (k *fakeKCM) process(op uint16, data []byte) (int32, []byte) {
+	k.mux.Lock()
+	defer k.mux.Unlock()
+	var p int
+	name, _ := readCString(data, &p)
+	switch op {
+	case kcmOpGetDefaultCache:
+		return 0, cString(k.dflt)
+	case kcmOpSetDefaultCache:
+		k.dflt = name
+		return 0, nil
+	case kcmOpGenNew:
+		n := string(rune('0' + len(k.caches)))
+		k.caches[n] = &fakeKCMCache{}
+		return 0, cString(n)
+	case kcmOpInitialize:
+		k.caches[name] = &fakeKCMCache{princ: data[p:]}
+		return 0, nil
+	}
+	c, ok := k.caches[name]
+	if !ok {
+		return kcmStatusFCCNoFile, nil
+	}
+	switch op {
+	case kcmOpStore:
+		c.creds = append(c.creds, data[p:])
+		return 0, nil
+	case kcmOpGetPrincipal:
+		return 0, c.princ
+	case kcmOpGetCredUUIDList:
+		var b []byte
+		for i := range c.creds {
+			uuid := make([]byte, kcmUUIDLen)
+			uuid[0] = byte(i + 1)
+			b = append(b, uuid...)
+		}
+		return 0, b
+	case kcmOpGetCredByUUID:
+		i := int(data[p]) - 1
+		if i < 0 || i >= len(c.creds) {
+			return kcmStatusCCNotFound, nil
+		}
+		return 0, c.creds[i]
+	case kcmOpRemoveCred:
+		for i := range c.creds {
+			if bytes.Equal(c.creds[i], data[p+4:]) {
+				c.creds = append(c.creds[:i], c.creds[i+1:]...)
+				return 0, nil
+			}
+		}
+		return kcmStatusCCNotFound, nil
+	case kcmOpDestroy:
+		delete(k.caches, name)
+		return 0, nil
+	case kcmOpGetKDCOffset:
+		b := make([]byte, 4)
+		binary.BigEndian.PutUint32(b, uint32(c.offset))
+		return 0, b
+	case kcmOpSetKDCOffset:
+		c.offset = int32(binary.BigEndian.Uint32(data[p:]))
+		return 0, nil
+	}
+	return kcmStatusCCNoSupp, nil
+}
+
+func TestKCMClient(t *testing.T) {
+	t.Parallel()
+	_, sock, closer := newFakeKCM(t)
+	defer closer()
+
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+
+	k := NewKCMClient(sock)
+	name, err := k.NewCacheName()
+	if err != nil {
+		t.Fatalf("Error getting new cache name: %v", err)
+	}
+	err = k.Initialize(name, c.DefaultPrincipal.PrincipalName, c.DefaultPrincipal.Realm)
+	if err != nil {
+		t.Fatalf("Error initializing cache: %v", err)
+	}
+	err = k.SetDefaultCache(name)
+	if err != nil {
+		t.Fatalf("Error setting default cache: %v", err)
+	}
+	for _, cred := range c.Credentials {
+		err = k.Store(name, cred)
+		if err != nil {
+			t.Fatalf("Error storing credential: %v", err)
+		}
+	}
+	err = k.SetKDCOffset(name, 30*time.Second)
+	if err != nil {
+		t.Fatalf("Error setting KDC offset: %v", err)
+	}
+	d, err := k.GetKDCOffset(name)
+	if err != nil {
+		t.Fatalf("Error getting KDC offset: %v", err)
+	}
+	assert.Equal(t, 30*time.Second, d, "KDC offset not as expected")
+
+	lc, err := k.Load("")
+	if err != nil {
+		t.Fatalf("Error loading cache from KCM: %v", err)
+	}
+	assert.Equal(t, c.DefaultPrincipal, lc.DefaultPrincipal, "Default principal not as expected")
+	assert.Equal(t, len(c.Credentials), len(lc.Credentials), "Number of credentials not as expected")
+	assert.Equal(t, c.Credentials[1].Ticket, lc.Credentials[1].Ticket, "Ticket not as expected")
+	assert.Equal(t, c.Credentials[1].Server, lc.Credentials[1].Server, "Server principal not as expected")
+
+	err = k.Remove(name, c.Credentials[0])
+	if err != nil {
+		t.Fatalf("Error removing credential: %v", err)
+	}
+	creds, err := k.Credentials(name)
+	if err != nil {
+		t.Fatalf("Error getting credentials: %v", err)
+	}
+	assert.Equal(t, len(c.Credentials)-1, len(creds), "Credential not removed")
+
+	err = k.Destroy(name)
+	if err != nil {
+		t.Fatalf("Error destroying cache: %v", err)
+	}
+	_, err = k.Load(name)
+	if assert.Error(t, err, "Expected error loading destroyed cache") {
+		assert.Equal(t, KCMError{Code: kcmStatusFCCNoFile}, err, "Error not as expected")
+	}
+}
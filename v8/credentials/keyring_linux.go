@@ -0,0 +1,454 @@
+//go:build linux
+// +build linux
+
+package credentials
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// Linux kernel keyring credential caches are laid out as implemented by MIT krb5 (src/lib/krb5/ccache/cc_keyring.c).
+// A collection keyring is linked into the anchor keyring and contains one keyring per cache and a key naming the
+// primary cache. Each cache keyring holds a key for the default principal and a key per credential, all encoded as in
+// version 4 of the ccache file format.
+const (
+	keyringCollectionPrefix     = "_krb_"
+	keyringPersistentCollection = "_krb"
+	keyringPrimaryKey           = "krb_ccache:primary"
+	keyringPrincipalKey         = "__krb5_princ__"
+	keyringTimeOffsetsKey       = "__krb5_time_offsets__"
+	keyringDefaultSubsidiary    = "tkt"
+	keyringCollectionVersion    = 1
+
+	keyTypeUser    = "user"
+	keyTypeKeyring = "keyring"
+
+	keySpecThreadKeyring  = -1
+	keySpecProcessKeyring = -2
+	keySpecSessionKeyring = -3
+	keySpecUserKeyring    = -4
+
+	keyctlDescribe      = 6
+	keyctlClear         = 7
+	keyctlUnlink        = 9
+	keyctlSearch        = 10
+	keyctlRead          = 11
+	keyctlGetPersistent = 22
+)
+
+// KeyringCache is a credential cache held in the Linux kernel keyring.
+type KeyringCache struct {
+	anchorType string
+	anchorName string
+	subsidiary string
+}
+
+// newKeyringCache parses the residual of a KEYRING cache name.
+// Supported forms are persistent:uid[:name], user:collection[:name], session:collection[:name],
+// process:collection[:name], thread:collection[:name] and the legacy form name which is held in the session keyring.
+func newKeyringCache(residual string) (CredentialCache, error) {
+	k := new(KeyringCache)
+	parts := strings.SplitN(residual, ":", 3)
+	switch parts[0] {
+	case "persistent", "user", "session", "process", "thread":
+		k.anchorType = parts[0]
+		if len(parts) > 1 {
+			k.anchorName = parts[1]
+		}
+		if len(parts) > 2 {
+			k.subsidiary = parts[2]
+		}
+	default:
+		k.anchorType = "legacy"
+		k.anchorName = residual
+	}
+	if k.anchorType == "persistent" && k.anchorName == "" {
+		k.anchorName = strconv.Itoa(os.Getuid())
+	}
+	if k.anchorName == "" {
+		return nil, fmt.Errorf("KEYRING credential cache name %s is not valid", residual)
+	}
+	return k, nil
+}
+
+// Name returns the full name of the cache.
+func (k *KeyringCache) Name() string {
+	if k.anchorType == "legacy" {
+		return CCacheTypeKeyring + ":" + k.anchorName
+	}
+	n := CCacheTypeKeyring + ":" + k.anchorType + ":" + k.anchorName
+	if k.subsidiary != "" {
+		n += ":" + k.subsidiary
+	}
+	return n
+}
+
+// Load reads the cache from the kernel keyring into a CCache.
+func (k *KeyringCache) Load() (*CCache, error) {
+	c := &CCache{Version: 4}
+	id, err := k.cacheKeyring(false)
+	if err != nil {
+		return c, err
+	}
+	ids, err := keyringContents(id)
+	if err != nil {
+		return c, err
+	}
+	var foundPrinc bool
+	for _, kid := range ids {
+		t, desc, err := describeKey(kid)
+		if err != nil {
+			return c, err
+		}
+		if t != keyTypeUser || desc == keyringTimeOffsetsKey {
+			continue
+		}
+		b, err := readKey(kid)
+		if err != nil {
+			return c, err
+		}
+		d := newCCacheDecoder(bytes.NewReader(b))
+		if desc == keyringPrincipalKey {
+			c.DefaultPrincipal, err = d.readPrincipal()
+			if err != nil {
+				return c, fmt.Errorf("error parsing KEYRING principal: %v", err)
+			}
+			foundPrinc = true
+			continue
+		}
+		cred, err := d.readCredential()
+		if err != nil {
+			return c, err
+		}
+		c.Credentials = append(c.Credentials, cred)
+	}
+	if !foundPrinc {
+		return c, fmt.Errorf("KEYRING credential cache %s is not initialized", k.Name())
+	}
+	return c, nil
+}
+
+// Initialize clears the cache and sets its default principal.
+func (k *KeyringCache) Initialize(cname types.PrincipalName, realm string) error {
+	id, err := k.cacheKeyring(true)
+	if err != nil {
+		return err
+	}
+	if _, err := keyctl(keyctlClear, keySpec(id)); err != nil {
+		return fmt.Errorf("could not clear keyring: %v", err)
+	}
+	buf := new(bytes.Buffer)
+	writePrincipal(buf, Principal{Realm: realm, PrincipalName: cname}, 4, &keyringEndian)
+	_, err = addKey(keyTypeUser, keyringPrincipalKey, buf.Bytes(), id)
+	return err
+}
+
+// Store adds a credential to the cache.
+func (k *KeyringCache) Store(cred *Credential) error {
+	id, err := k.cacheKeyring(false)
+	if err != nil {
+		return err
+	}
+	buf := new(bytes.Buffer)
+	writeCredential(buf, cred, 4, &keyringEndian)
+	desc := fmt.Sprintf("%s@%s", cred.Server.PrincipalName.PrincipalNameString(), cred.Server.Realm)
+	_, err = addKey(keyTypeUser, desc, buf.Bytes(), id)
+	return err
+}
+
+// DefaultPrincipal returns the principal name and realm of the client the cache is for.
+func (k *KeyringCache) DefaultPrincipal() (types.PrincipalName, string, error) {
+	return defaultPrincipal(k)
+}
+
+// GetEntry returns the credential from the cache for the server principal name provided.
+func (k *KeyringCache) GetEntry(p types.PrincipalName) (*Credential, bool, error) {
+	return getEntry(k, p)
+}
+
+// Remove deletes the credentials for the server principal name provided from the cache.
+func (k *KeyringCache) Remove(p types.PrincipalName) error {
+	id, err := k.cacheKeyring(false)
+	if err != nil {
+		return err
+	}
+	ids, err := keyringContents(id)
+	if err != nil {
+		return err
+	}
+	for _, kid := range ids {
+		t, desc, err := describeKey(kid)
+		if err != nil {
+			return err
+		}
+		if t != keyTypeUser || desc == keyringPrincipalKey || desc == keyringTimeOffsetsKey {
+			continue
+		}
+		b, err := readKey(kid)
+		if err != nil {
+			return err
+		}
+		cred, err := newCCacheDecoder(bytes.NewReader(b)).readCredential()
+		if err != nil {
+			return err
+		}
+		if cred.Server.PrincipalName.Equal(p) {
+			if _, err := keyctl(keyctlUnlink, keySpec(kid), keySpec(id)); err != nil {
+				return fmt.Errorf("could not unlink key %d: %v", kid, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Destroy clears the cache keyring and unlinks it from its collection.
+func (k *KeyringCache) Destroy() error {
+	id, err := k.cacheKeyring(false)
+	if err != nil {
+		return err
+	}
+	if _, err := keyctl(keyctlClear, keySpec(id)); err != nil {
+		return fmt.Errorf("could not clear keyring: %v", err)
+	}
+	parent := int32(keySpecSessionKeyring)
+	if k.anchorType != "legacy" {
+		parent, err = k.collection(false)
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := keyctl(keyctlUnlink, keySpec(id), keySpec(parent)); err != nil {
+		return fmt.Errorf("could not unlink keyring: %v", err)
+	}
+	return nil
+}
+
+// collection returns the serial of the cache's collection keyring, creating it if required and specified.
+func (k *KeyringCache) collection(create bool) (int32, error) {
+	anchor, err := k.anchor()
+	if err != nil {
+		return 0, err
+	}
+	collName := keyringCollectionPrefix + k.anchorName
+	if k.anchorType == "persistent" {
+		collName = keyringPersistentCollection
+	}
+	return findOrCreateKeyring(anchor, collName, create)
+}
+
+// cacheKeyring returns the serial of the cache's keyring, creating it if required and specified.
+func (k *KeyringCache) cacheKeyring(create bool) (int32, error) {
+	if k.anchorType == "legacy" {
+		return findOrCreateKeyring(keySpecSessionKeyring, k.anchorName, create)
+	}
+	coll, err := k.collection(create)
+	if err != nil {
+		return 0, err
+	}
+	if k.subsidiary == "" {
+		k.subsidiary = keyringDefaultSubsidiary
+		if pid, err := searchKey(coll, keyTypeUser, keyringPrimaryKey); err == nil {
+			if b, err := readKey(pid); err == nil {
+				if n, err := parseKeyringPrimary(b); err == nil {
+					k.subsidiary = n
+				}
+			}
+		}
+	}
+	id, err := findOrCreateKeyring(coll, k.subsidiary, create)
+	if err != nil {
+		return 0, err
+	}
+	if create {
+		if _, err := searchKey(coll, keyTypeUser, keyringPrimaryKey); err != nil {
+			if _, err := addKey(keyTypeUser, keyringPrimaryKey, marshalKeyringPrimary(k.subsidiary), coll); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return id, nil
+}
+
+// anchor returns the serial of the keyring the cache collection is linked into.
+func (k *KeyringCache) anchor() (int32, error) {
+	switch k.anchorType {
+	case "persistent":
+		uid, err := strconv.Atoi(k.anchorName)
+		if err != nil {
+			return 0, fmt.Errorf("invalid uid for persistent keyring: %v", err)
+		}
+		id, err := keyctl(keyctlGetPersistent, uintptr(uid), keySpec(keySpecProcessKeyring))
+		if err != nil {
+			return 0, fmt.Errorf("could not get persistent keyring: %v", err)
+		}
+		return id, nil
+	case "user":
+		return keySpecUserKeyring, nil
+	case "session":
+		return keySpecSessionKeyring, nil
+	case "process":
+		return keySpecProcessKeyring, nil
+	case "thread":
+		return keySpecThreadKeyring, nil
+	}
+	return 0, fmt.Errorf("unknown keyring type %s", k.anchorType)
+}
+
+// The keyring primary cache payload is a 32 bit version followed by the length prefixed subsidiary cache name.
+func parseKeyringPrimary(b []byte) (string, error) {
+	if len(b) < 8 || binary.BigEndian.Uint32(b[0:4]) != keyringCollectionVersion {
+		return "", errors.New("invalid keyring primary cache data")
+	}
+	l := int(binary.BigEndian.Uint32(b[4:8]))
+	if l > len(b)-8 {
+		return "", errors.New("invalid keyring primary cache data")
+	}
+	return string(b[8 : 8+l]), nil
+}
+
+func marshalKeyringPrimary(name string) []byte {
+	b := make([]byte, 8, 8+len(name))
+	binary.BigEndian.PutUint32(b[0:4], keyringCollectionVersion)
+	binary.BigEndian.PutUint32(b[4:8], uint32(len(name)))
+	return append(b, name...)
+}
+
+// Keyring integers are always big-endian.
+var keyringEndian binary.ByteOrder = binary.BigEndian
+
+func findOrCreateKeyring(parent int32, name string, create bool) (int32, error) {
+	id, err := searchKey(parent, keyTypeKeyring, name)
+	if err == nil || !create {
+		return id, err
+	}
+	return addKey(keyTypeKeyring, name, nil, parent)
+}
+
+func keySpec(i int32) uintptr {
+	return uintptr(uint32(i))
+}
+
+func keyctl(cmd int, args ...uintptr) (int32, error) {
+	a := make([]uintptr, 4)
+	copy(a, args)
+	r, _, errno := syscall.Syscall6(syscall.SYS_KEYCTL, uintptr(cmd), a[0], a[1], a[2], a[3], 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int32(r), nil
+}
+
+func addKey(keyType, desc string, payload []byte, ring int32) (int32, error) {
+	t, err := syscall.BytePtrFromString(keyType)
+	if err != nil {
+		return 0, err
+	}
+	d, err := syscall.BytePtrFromString(desc)
+	if err != nil {
+		return 0, err
+	}
+	var p unsafe.Pointer
+	if len(payload) > 0 {
+		p = unsafe.Pointer(&payload[0])
+	}
+	r, _, errno := syscall.Syscall6(syscall.SYS_ADD_KEY, uintptr(unsafe.Pointer(t)), uintptr(unsafe.Pointer(d)),
+		uintptr(p), uintptr(len(payload)), keySpec(ring), 0)
+	if errno != 0 {
+		return 0, fmt.Errorf("could not add %s key %s: %v", keyType, desc, errno)
+	}
+	return int32(r), nil
+}
+
+func searchKey(ring int32, keyType, desc string) (int32, error) {
+	t, err := syscall.BytePtrFromString(keyType)
+	if err != nil {
+		return 0, err
+	}
+	d, err := syscall.BytePtrFromString(desc)
+	if err != nil {
+		return 0, err
+	}
+	r, _, errno := syscall.Syscall6(syscall.SYS_KEYCTL, keyctlSearch, keySpec(ring), uintptr(unsafe.Pointer(t)),
+		uintptr(unsafe.Pointer(d)), 0, 0)
+	if errno != 0 {
+		return 0, errno
+	}
+	return int32(r), nil
+}
+
+func readKey(id int32) ([]byte, error) {
+	for {
+		l, err := keyctl(keyctlRead, keySpec(id), 0, 0)
+		if err != nil {
+			return nil, fmt.Errorf("could not read key %d: %v", id, err)
+		}
+		if l == 0 {
+			return []byte{}, nil
+		}
+		b := make([]byte, l)
+		n, err := keyctl(keyctlRead, keySpec(id), uintptr(unsafe.Pointer(&b[0])), uintptr(l))
+		if err != nil {
+			return nil, fmt.Errorf("could not read key %d: %v", id, err)
+		}
+		if n <= l {
+			return b[:n], nil
+		}
+		// The key grew between calls so try again
+	}
+}
+
+// keyringContents returns the serials of the keys linked to a keyring.
+func keyringContents(id int32) ([]int32, error) {
+	b, err := readKey(id)
+	if err != nil {
+		return nil, err
+	}
+	// The serials are returned in native byte order
+	var e binary.ByteOrder = binary.BigEndian
+	if isNativeEndianLittle() {
+		e = binary.LittleEndian
+	}
+	ids := make([]int32, len(b)/4)
+	for i := range ids {
+		ids[i] = int32(e.Uint32(b[i*4:]))
+	}
+	return ids, nil
+}
+
+// describeKey returns the type and description of a key.
+func describeKey(id int32) (string, string, error) {
+	b, err := readDescription(id)
+	if err != nil {
+		return "", "", err
+	}
+	// The description takes the form type;uid;gid;perm;description
+	parts := strings.SplitN(strings.TrimRight(string(b), "\x00"), ";", 5)
+	if len(parts) != 5 {
+		return "", "", fmt.Errorf("unexpected description of key %d", id)
+	}
+	return parts[0], parts[4], nil
+}
+
+func readDescription(id int32) ([]byte, error) {
+	l, err := keyctl(keyctlDescribe, keySpec(id), 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("could not describe key %d: %v", id, err)
+	}
+	b := make([]byte, l)
+	if l > 0 {
+		if _, err := keyctl(keyctlDescribe, keySpec(id), uintptr(unsafe.Pointer(&b[0])), uintptr(l)); err != nil {
+			return nil, fmt.Errorf("could not describe key %d: %v", id, err)
+		}
+	}
+	return b, nil
+}
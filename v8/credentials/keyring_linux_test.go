@@ -0,0 +1,64 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyringCache(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	name := fmt.Sprintf("KEYRING:process:gokrb5test%d", time.Now().UnixNano())
+	kc, err := ResolveCCache(name)
+	if err != nil {
+		t.Fatalf("Error resolving cache: %v", err)
+	}
+	err = kc.Initialize(c.DefaultPrincipal.PrincipalName, c.DefaultPrincipal.Realm)
+	if err != nil {
+		t.Skipf("kernel keyring not available: %v", err)
+	}
+	assert.Equal(t, name+":"+keyringDefaultSubsidiary, kc.Name(), "Cache name not as expected")
+	for _, cred := range c.Credentials {
+		err = kc.Store(cred)
+		if err != nil {
+			t.Fatalf("Error storing credential: %v", err)
+		}
+	}
+	// Storing the same credential again should replace rather than add
+	err = kc.Store(c.Credentials[0])
+	if err != nil {
+		t.Fatalf("Error storing credential: %v", err)
+	}
+	lc, err := kc.Load()
+	if err != nil {
+		t.Fatalf("Error loading cache: %v", err)
+	}
+	assert.Equal(t, c.DefaultPrincipal, lc.DefaultPrincipal, "Default principal not as expected")
+	assert.Equal(t, len(c.Credentials), len(lc.Credentials), "Number of credentials not as expected")
+
+	// A new handle on the same collection should find the primary cache
+	kc2, err := ResolveCCache(name)
+	if err != nil {
+		t.Fatalf("Error resolving cache: %v", err)
+	}
+	lc, err = kc2.Load()
+	if err != nil {
+		t.Fatalf("Error loading cache: %v", err)
+	}
+	assert.Equal(t, len(c.Credentials), len(lc.Credentials), "Number of credentials not as expected")
+
+	testCredentialCache(t, kc2)
+}
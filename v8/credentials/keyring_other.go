@@ -0,0 +1,10 @@
+//go:build !linux
+// +build !linux
+
+package credentials
+
+import "errors"
+
+func newKeyringCache(residual string) (CredentialCache, error) {
+	return nil, errors.New("KEYRING credential caches are only supported on Linux")
+}
@@ -0,0 +1,97 @@
+package credentials
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+
+	"github.com/Osirium/gokrb5/v8/iana/asnAppTag"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// listTimeFormat is the format of the times in the listing of a cache's credentials.
+const listTimeFormat = "01/02/06 15:04:05"
+
+// Ticket flags in the order and with the letters used by MIT klist.
+var listFlags = []struct {
+	flag   int
+	letter byte
+}{
+	{flags.Forwardable, 'F'},
+	{flags.Forwarded, 'f'},
+	{flags.Proxiable, 'P'},
+	{flags.Proxy, 'p'},
+	{flags.MayPostDate, 'D'},
+	{flags.PostDated, 'd'},
+	{flags.Invalid, 'i'},
+	{flags.Renewable, 'R'},
+	{flags.Initial, 'I'},
+	{flags.HWAuthent, 'H'},
+	{flags.PreAuthent, 'A'},
+	{flags.TransitedPolicyChecked, 'T'},
+	{flags.OKAsDelegate, 'O'},
+	{flags.Anonymous, 'a'},
+}
+
+// ticketEncPart is used to read the encryption type of a credential's ticket.
+type ticketEncPart struct {
+	TktVNO  int                 `asn1:"explicit,tag:0"`
+	Realm   string              `asn1:"generalstring,explicit,tag:1"`
+	SName   types.PrincipalName `asn1:"explicit,tag:2"`
+	EncPart types.EncryptedData `asn1:"explicit,tag:3"`
+}
+
+// List returns the cache's default principal and credentials formatted in the same way as MIT klist -e -f.
+// Configuration entries are not included.
+func (c *CCache) List() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Default principal: %s\n\n", c.DefaultPrincipal.String())
+	tw := len(listTimeFormat)
+	fmt.Fprintf(&buf, "%-*s  %-*s  %s\n", tw, "Valid starting", tw, "Expires", "Service principal")
+	for _, cred := range c.GetEntries() {
+		start := cred.StartTime
+		if start.IsZero() || start.Unix() == 0 {
+			start = cred.AuthTime
+		}
+		fmt.Fprintf(&buf, "%s  %s  %s\n", start.Local().Format(listTimeFormat), cred.EndTime.Local().Format(listTimeFormat), cred.Server.String())
+		buf.WriteString("\t")
+		if cred.HasFlag(flags.Renewable) && cred.RenewTill.Unix() > 0 {
+			fmt.Fprintf(&buf, "renew until %s, ", cred.RenewTill.Local().Format(listTimeFormat))
+		}
+		fmt.Fprintf(&buf, "Flags: %s\n", cred.FlagString())
+		fmt.Fprintf(&buf, "\tEtype (skey, tkt): %s, %s\n", eTypeName(cred.Key.KeyType), eTypeName(cred.TicketEType()))
+	}
+	return buf.String()
+}
+
+// FlagString returns the credential's ticket flags as a string of the letters used by MIT klist.
+func (cred *Credential) FlagString() string {
+	var b []byte
+	for _, f := range listFlags {
+		if cred.HasFlag(f.flag) {
+			b = append(b, f.letter)
+		}
+	}
+	return string(b)
+}
+
+// TicketEType returns the encryption type of the credential's ticket.
+// Zero is returned if the ticket cannot be decoded.
+func (cred *Credential) TicketEType() int32 {
+	var t ticketEncPart
+	_, err := asn1.UnmarshalWithParams(cred.Ticket, &t, fmt.Sprintf("application,explicit,tag:%d", asnAppTag.Ticket))
+	if err != nil {
+		return 0
+	}
+	return t.EncPart.EType
+}
+
+func eTypeName(e int32) string {
+	if n, ok := etypeID.ETypeNames[e]; ok {
+		return n
+	}
+	return "etype " + strconv.Itoa(int(e))
+}
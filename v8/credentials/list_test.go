@@ -0,0 +1,36 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCCache_List(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	tgt := c.Credentials[0]
+	assert.Equal(t, "FRI", tgt.FlagString(), "Flags not as expected")
+	assert.Equal(t, etypeID.AES256_CTS_HMAC_SHA1_96, tgt.TicketEType(), "Ticket etype not as expected")
+
+	lines := strings.Split(c.List(), "\n")
+	assert.Equal(t, "Default principal: testuser1@TEST.GOKRB5", lines[0], "Default principal line not as expected")
+	assert.Equal(t, "Valid starting     Expires            Service principal", lines[2], "Column headings not as expected")
+	assert.Equal(t, tgt.StartTime.Local().Format(listTimeFormat)+"  "+tgt.EndTime.Local().Format(listTimeFormat)+"  krbtgt/TEST.GOKRB5@TEST.GOKRB5", lines[3], "TGT line not as expected")
+	assert.Equal(t, "\trenew until "+tgt.RenewTill.Local().Format(listTimeFormat)+", Flags: FRI", lines[4], "TGT flags line not as expected")
+	assert.Equal(t, "\tEtype (skey, tkt): aes256-cts-hmac-sha1-96, aes256-cts-hmac-sha1-96", lines[5], "TGT etype line not as expected")
+	assert.Contains(t, lines[6], "HTTP/host.test.gokrb5@TEST.GOKRB5", "Service ticket not listed")
+	assert.NotContains(t, c.List(), "X-CACHECONF", "Configuration entries should not be listed")
+}
@@ -0,0 +1,95 @@
+package credentials
+
+import (
+	"os"
+	"sync"
+)
+
+// CCacheOption configures how a credential cache file is loaded or saved.
+type CCacheOption func(*ccacheSettings)
+
+type ccacheSettings struct {
+	lock    bool
+	version uint8
+}
+
+// WithLock takes an advisory lock on the credential cache file while it is read or written.
+// A shared lock is taken when loading and an exclusive lock when saving, compatible with the locks taken by MIT Kerberos.
+func WithLock() CCacheOption {
+	return func(s *ccacheSettings) {
+		s.lock = true
+	}
+}
+
+// WithVersion sets the version of the credential cache file format used when saving.
+// Use it to write caches for older implementations that cannot read version 4.
+func WithVersion(v uint8) CCacheOption {
+	return func(s *ccacheSettings) {
+		s.version = v
+	}
+}
+
+func newCCacheSettings(opts []CCacheOption) ccacheSettings {
+	s := ccacheSettings{version: 4}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	return s
+}
+
+// POSIX advisory locks are held per process so do not exclude other goroutines.
+// These mutexes, keyed by file path, provide the equivalent exclusion within the process.
+var fileMutexes = struct {
+	mux sync.Mutex
+	m   map[string]*sync.RWMutex
+}{
+	m: make(map[string]*sync.RWMutex),
+}
+
+func fileMutex(cpath string) *sync.RWMutex {
+	fileMutexes.mux.Lock()
+	defer fileMutexes.mux.Unlock()
+	m, ok := fileMutexes.m[cpath]
+	if !ok {
+		m = new(sync.RWMutex)
+		fileMutexes.m[cpath] = m
+	}
+	return m
+}
+
+// openLocked opens the file and takes an advisory lock on it.
+// An exclusive lock opens the file for writing, creating it if necessary.
+// The function returned releases the lock and closes the file.
+func openLocked(cpath string, exclusive bool) (*os.File, func(), error) {
+	m := fileMutex(cpath)
+	if exclusive {
+		m.Lock()
+	} else {
+		m.RLock()
+	}
+	unlockMutex := m.Unlock
+	if !exclusive {
+		unlockMutex = m.RUnlock
+	}
+	var f *os.File
+	var err error
+	if exclusive {
+		f, err = os.OpenFile(cpath, os.O_RDWR|os.O_CREATE, 0600)
+	} else {
+		f, err = os.Open(cpath)
+	}
+	if err != nil {
+		unlockMutex()
+		return nil, nil, err
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		unlockMutex()
+		return nil, nil, err
+	}
+	return f, func() {
+		unlockFile(f)
+		f.Close()
+		unlockMutex()
+	}, nil
+}
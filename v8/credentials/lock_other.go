@@ -0,0 +1,17 @@
+//go:build !aix && !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd && !solaris && !windows
+// +build !aix,!darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!solaris,!windows
+
+package credentials
+
+import (
+	"errors"
+	"os"
+)
+
+func lockFile(f *os.File, exclusive bool) error {
+	return errors.New("credential cache file locking is not supported on this platform")
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
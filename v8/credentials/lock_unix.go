@@ -0,0 +1,41 @@
+//go:build aix || darwin || dragonfly || freebsd || linux || netbsd || openbsd || solaris
+// +build aix darwin dragonfly freebsd linux netbsd openbsd solaris
+
+package credentials
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// lockFile takes a POSIX advisory lock on the whole file, waiting until it is available.
+func lockFile(f *os.File, exclusive bool) error {
+	var t int16 = syscall.F_RDLCK
+	if exclusive {
+		t = syscall.F_WRLCK
+	}
+	return fcntlLock(f, t)
+}
+
+func unlockFile(f *os.File) error {
+	return fcntlLock(f, syscall.F_UNLCK)
+}
+
+func fcntlLock(f *os.File, t int16) error {
+	lk := syscall.Flock_t{
+		Type:   t,
+		Whence: io.SeekStart,
+	}
+	for {
+		err := syscall.FcntlFlock(f.Fd(), syscall.F_SETLKW, &lk)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("could not lock credential cache file %s: %v", f.Name(), err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,232 @@
+package credentials
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// Memory caches are shared within the process by name.
+var memoryCaches = struct {
+	mux    sync.Mutex
+	caches map[string]*MemoryCache
+}{
+	caches: make(map[string]*MemoryCache),
+}
+
+// MemoryCache is a credential cache held in the memory of the process. It is safe for concurrent use.
+// Credentials that have passed their end time are evicted from the cache automatically.
+type MemoryCache struct {
+	name        string
+	initialized bool
+	princ       Principal
+	entries     map[string]*Credential
+	now         func() time.Time
+	mux         sync.RWMutex
+}
+
+// NewMemoryCache returns the MemoryCache with the name provided.
+// Memory caches are shared within the process so the same name will always return the same cache until it is destroyed.
+func NewMemoryCache(name string) *MemoryCache {
+	memoryCaches.mux.Lock()
+	defer memoryCaches.mux.Unlock()
+	if m, ok := memoryCaches.caches[name]; ok {
+		return m
+	}
+	m := &MemoryCache{
+		name:    name,
+		entries: make(map[string]*Credential),
+		now:     time.Now,
+	}
+	memoryCaches.caches[name] = m
+	return m
+}
+
+// Name returns the full name of the cache.
+func (m *MemoryCache) Name() string {
+	return CCacheTypeMemory + ":" + m.name
+}
+
+// Load returns a copy of the cache's unexpired contents.
+func (m *MemoryCache) Load() (*CCache, error) {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if !m.initialized {
+		return nil, m.notInitialized()
+	}
+	m.evict()
+	return &CCache{
+		Version:          4,
+		DefaultPrincipal: m.princ,
+		Credentials:      m.credentials(),
+	}, nil
+}
+
+// Initialize clears the cache and sets its default principal.
+func (m *MemoryCache) Initialize(cname types.PrincipalName, realm string) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.initialized = true
+	m.princ = Principal{Realm: realm, PrincipalName: cname}
+	m.entries = make(map[string]*Credential)
+	return nil
+}
+
+// DefaultPrincipal returns the principal name and realm of the client the cache is for.
+func (m *MemoryCache) DefaultPrincipal() (types.PrincipalName, string, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if !m.initialized {
+		return types.PrincipalName{}, "", m.notInitialized()
+	}
+	return m.princ.PrincipalName, m.princ.Realm, nil
+}
+
+// GetEntry returns an unexpired credential for the server principal name provided.
+func (m *MemoryCache) GetEntry(p types.PrincipalName) (*Credential, bool, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if !m.initialized {
+		return nil, false, m.notInitialized()
+	}
+	now := m.now()
+	for _, k := range m.keys() {
+		cred := m.entries[k]
+		if cred.Server.PrincipalName.Equal(p) && !m.expired(cred, now) {
+			return cred, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// GetClientEntry returns an unexpired credential for the client and server principals provided.
+func (m *MemoryCache) GetClientEntry(cname types.PrincipalName, crealm string, sname types.PrincipalName, srealm string) (*Credential, bool, error) {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	if !m.initialized {
+		return nil, false, m.notInitialized()
+	}
+	k := memoryCacheKey(Principal{Realm: crealm, PrincipalName: cname}, Principal{Realm: srealm, PrincipalName: sname})
+	if cred, ok := m.entries[k]; ok && !m.expired(cred, m.now()) {
+		return cred, true, nil
+	}
+	return nil, false, nil
+}
+
+// GetEntries returns the unexpired credentials held in the cache, excluding configuration entries.
+func (m *MemoryCache) GetEntries() []*Credential {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.evict()
+	c := CCache{Credentials: m.credentials()}
+	return c.GetEntries()
+}
+
+// Store adds a credential to the cache, replacing any existing credential for the same client and server principals.
+func (m *MemoryCache) Store(cred *Credential) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	if !m.initialized {
+		return m.notInitialized()
+	}
+	m.evict()
+	m.entries[memoryCacheKey(cred.Client, cred.Server)] = cred
+	return nil
+}
+
+// Remove deletes the credentials for the server principal name provided.
+func (m *MemoryCache) Remove(p types.PrincipalName) error {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	for k, cred := range m.entries {
+		if cred.Server.PrincipalName.Equal(p) {
+			delete(m.entries, k)
+		}
+	}
+	return nil
+}
+
+// EvictExpired removes the credentials that have passed their end time from the cache.
+// Returns the number of credentials removed.
+func (m *MemoryCache) EvictExpired() int {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.evict()
+}
+
+// Len returns the number of credentials held in the cache, including any that have expired but are yet to be evicted.
+func (m *MemoryCache) Len() int {
+	m.mux.RLock()
+	defer m.mux.RUnlock()
+	return len(m.entries)
+}
+
+// Destroy overwrites the key material of the cache's credentials, deletes them and removes the cache from the process.
+func (m *MemoryCache) Destroy() error {
+	memoryCaches.mux.Lock()
+	defer memoryCaches.mux.Unlock()
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	m.initialized = false
+	m.princ = Principal{}
+	for _, cred := range m.entries {
+		cred.zero()
+	}
+	m.entries = make(map[string]*Credential)
+	if memoryCaches.caches[m.name] == m {
+		delete(memoryCaches.caches, m.name)
+	}
+	return nil
+}
+
+// evict removes expired credentials. The caller must hold the write lock.
+func (m *MemoryCache) evict() int {
+	var n int
+	now := m.now()
+	for k, cred := range m.entries {
+		if m.expired(cred, now) {
+			delete(m.entries, k)
+			n++
+		}
+	}
+	return n
+}
+
+// expired indicates if the credential has passed its end time. Configuration entries never expire.
+func (m *MemoryCache) expired(cred *Credential, now time.Time) bool {
+	if cred.IsConfigEntry() {
+		return false
+	}
+	return !cred.EndTime.After(now)
+}
+
+// keys returns the entry keys in a stable order. The caller must hold a lock.
+func (m *MemoryCache) keys() []string {
+	keys := make([]string, 0, len(m.entries))
+	for k := range m.entries {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// credentials returns the credentials in a stable order. The caller must hold a lock.
+func (m *MemoryCache) credentials() []*Credential {
+	creds := make([]*Credential, 0, len(m.entries))
+	for _, k := range m.keys() {
+		creds = append(creds, m.entries[k])
+	}
+	return creds
+}
+
+func (m *MemoryCache) notInitialized() error {
+	return fmt.Errorf("memory credential cache %s is not initialized", m.name)
+}
+
+func memoryCacheKey(client, server Principal) string {
+	return fmt.Sprintf("%s@%s|%s@%s", client.PrincipalName.PrincipalNameString(), client.Realm,
+		server.PrincipalName.PrincipalNameString(), server.Realm)
+}
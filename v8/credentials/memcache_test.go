@@ -0,0 +1,91 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryCache_Eviction(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	m := NewMemoryCache("TestMemoryCache_Eviction")
+	defer m.Destroy()
+	assert.Equal(t, m, NewMemoryCache("TestMemoryCache_Eviction"), "Memory cache with the same name not shared")
+	now := c.Credentials[2].EndTime.Add(-time.Minute)
+	m.now = func() time.Time { return now }
+	err = m.Initialize(c.DefaultPrincipal.PrincipalName, c.DefaultPrincipal.Realm)
+	if err != nil {
+		t.Fatalf("Error initializing cache: %v", err)
+	}
+	for _, cred := range c.Credentials {
+		err = m.Store(cred)
+		if err != nil {
+			t.Fatalf("Error storing credential: %v", err)
+		}
+	}
+	assert.Equal(t, 3, m.Len(), "Number of credentials not as expected")
+	cred := c.Credentials[2]
+	_, ok, err := m.GetClientEntry(cred.Client.PrincipalName, cred.Client.Realm, cred.Server.PrincipalName, cred.Server.Realm)
+	if err != nil || !ok {
+		t.Fatalf("Could not get client entry: %v", err)
+	}
+
+	// Move the clock past the credential end times
+	now = c.Credentials[2].EndTime.Add(time.Minute)
+	_, ok, err = m.GetEntry(cred.Server.PrincipalName)
+	if err != nil {
+		t.Fatalf("Error getting entry: %v", err)
+	}
+	assert.False(t, ok, "Expired credential returned")
+	assert.Equal(t, 2, m.EvictExpired(), "Number of evicted credentials not as expected")
+	// The configuration entry does not expire
+	assert.Equal(t, 1, m.Len(), "Number of credentials not as expected")
+	assert.Equal(t, 0, len(m.GetEntries()), "Number of entries not as expected")
+}
+
+func TestMemoryCache_Concurrency(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	m := NewMemoryCache("TestMemoryCache_Concurrency")
+	defer m.Destroy()
+	m.now = func() time.Time { return time.Unix(0, 0) }
+	err = m.Initialize(c.DefaultPrincipal.PrincipalName, c.DefaultPrincipal.Realm)
+	if err != nil {
+		t.Fatalf("Error initializing cache: %v", err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, cred := range c.Credentials {
+				m.Store(cred)
+				m.GetEntry(cred.Server.PrincipalName)
+				m.Load()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, m.Len(), "Number of credentials not as expected")
+}
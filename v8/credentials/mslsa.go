@@ -0,0 +1,30 @@
+package credentials
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// msLSAFileTimeEpochOffset is the Unix epoch as a Windows FILETIME, in 100 nanosecond intervals since 1601.
+const msLSAFileTimeEpochOffset int64 = 116444736000000000
+
+// fileTime converts a Windows time, in 100 nanosecond intervals since 1601, to a time.Time. Times before the Unix
+// epoch, such as the zero time the LSA returns for unset times, are returned as the zero time.Time.
+func fileTime(t int64) time.Time {
+	if t <= msLSAFileTimeEpochOffset {
+		return time.Time{}
+	}
+	d := t - msLSAFileTimeEpochOffset
+	return time.Unix(d/1e7, (d%1e7)*100).UTC()
+}
+
+// lsaTicketFlags converts the ticket flags returned by the LSA, which use the bit order of the Kerberos TicketFlags
+// with the first flag in the most significant bit, to the flags of a Credential.
+func lsaTicketFlags(f uint32) asn1.BitString {
+	fl := types.NewKrbFlags()
+	binary.BigEndian.PutUint32(fl.Bytes, f)
+	return fl
+}
@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package credentials
+
+import "errors"
+
+func newMSLSACache() (CredentialCache, error) {
+	return nil, errors.New("the MSLSA credential cache is only available on Windows")
+}
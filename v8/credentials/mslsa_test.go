@@ -0,0 +1,65 @@
+package credentials
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileTime(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name string
+		ft   int64
+		want time.Time
+	}{
+		{"zero", 0, time.Time{}},
+		{"before epoch", msLSAFileTimeEpochOffset - 1, time.Time{}},
+		{"epoch", msLSAFileTimeEpochOffset, time.Time{}},
+		{"after epoch", msLSAFileTimeEpochOffset + 1, time.Unix(0, 100).UTC()},
+		{"2021", 132539328000000000, time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"sub second", 132539328001234567, time.Date(2021, time.January, 1, 0, 0, 0, 123456700, time.UTC)},
+		{"after 2038", 150842304000000000, time.Date(2079, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"never", math.MaxInt64, time.Date(30828, time.September, 14, 2, 48, 5, 477580700, time.UTC)},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, fileTime(test.ft), "time not as expected for %s", test.name)
+	}
+}
+
+func TestLSATicketFlags(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		lsa  uint32
+		set  []int
+		want []byte
+	}{
+		{0, []int{}, []byte{0x00, 0x00, 0x00, 0x00}},
+		{0x40000000, []int{flags.Forwardable}, []byte{0x40, 0x00, 0x00, 0x00}},
+		{0x40e10000, []int{flags.Forwardable, flags.Renewable, flags.Initial, flags.PreAuthent, flags.Canonicalize},
+			[]byte{0x40, 0xe1, 0x00, 0x00}},
+		{0x60a50000, []int{flags.Forwardable, flags.Forwarded, flags.Renewable, flags.PreAuthent, flags.OKAsDelegate, flags.Canonicalize},
+			[]byte{0x60, 0xa5, 0x00, 0x00}},
+	}
+	for _, test := range tests {
+		f := lsaTicketFlags(test.lsa)
+		assert.Equal(t, 32, f.BitLength, "bit length not as expected for %x", test.lsa)
+		assert.Equal(t, test.want, f.Bytes, "flag bytes not as expected for %x", test.lsa)
+		for i := 0; i < 32; i++ {
+			assert.Equal(t, containsFlag(test.set, i), types.IsFlagSet(&f, i), "flag %d not as expected for %x", i, test.lsa)
+		}
+	}
+}
+
+func containsFlag(s []int, i int) bool {
+	for _, v := range s {
+		if v == i {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,334 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+	"unsafe"
+
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// The MSLSA cache gives read access to the tickets held by the Windows Local Security Authority for the logon
+// session of the current process, as MIT Kerberos for Windows does. The tickets are retrieved from the Kerberos
+// authentication package with LsaCallAuthenticationPackage.
+//
+// Windows does not return the session key of a TGT unless the AllowTgtSessionKey registry value is set under
+// HKLM\SYSTEM\CurrentControlSet\Control\Lsa\Kerberos\Parameters, or the process is running with elevated rights.
+// Service tickets can always be retrieved with their session keys.
+
+var (
+	modsecur32                     = syscall.NewLazyDLL("secur32.dll")
+	modadvapi32                    = syscall.NewLazyDLL("advapi32.dll")
+	procLsaConnectUntrusted        = modsecur32.NewProc("LsaConnectUntrusted")
+	procLsaLookupAuthenticationPkg = modsecur32.NewProc("LsaLookupAuthenticationPackage")
+	procLsaCallAuthenticationPkg   = modsecur32.NewProc("LsaCallAuthenticationPackage")
+	procLsaFreeReturnBuffer        = modsecur32.NewProc("LsaFreeReturnBuffer")
+	procLsaDeregisterLogonProcess  = modsecur32.NewProc("LsaDeregisterLogonProcess")
+	procLsaNtStatusToWinError      = modadvapi32.NewProc("LsaNtStatusToWinError")
+	errMSLSAReadOnly               = errors.New("the MSLSA credential cache is read only")
+	msLSAKerberosPackageName       = "Kerberos"
+)
+
+// KERB_PROTOCOL_MESSAGE_TYPE values and retrieve options.
+const (
+	kerbRetrieveEncodedTicketMessage = 8
+	kerbQueryTicketCacheExMessage    = 14
+	kerbRetrieveTicketUseCacheOnly   = 0x2
+)
+
+type lsaString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        *byte
+}
+
+type unicodeString struct {
+	Length        uint16
+	MaximumLength uint16
+	Buffer        *uint16
+}
+
+type luid struct {
+	LowPart  uint32
+	HighPart int32
+}
+
+type kerbQueryTktCacheRequest struct {
+	MessageType uint32
+	LogonID     luid
+}
+
+type kerbQueryTktCacheExResponse struct {
+	MessageType    uint32
+	CountOfTickets uint32
+	Tickets        [1]kerbTicketCacheInfoEx
+}
+
+type kerbTicketCacheInfoEx struct {
+	ClientName     unicodeString
+	ClientRealm    unicodeString
+	ServerName     unicodeString
+	ServerRealm    unicodeString
+	StartTime      int64
+	EndTime        int64
+	RenewTime      int64
+	EncryptionType int32
+	TicketFlags    uint32
+}
+
+type kerbRetrieveTktRequest struct {
+	MessageType       uint32
+	LogonID           luid
+	TargetName        unicodeString
+	TicketFlags       uint32
+	CacheOptions      uint32
+	EncryptionType    int32
+	CredentialsHandle [2]uintptr
+}
+
+type kerbCryptoKey struct {
+	KeyType int32
+	Length  uint32
+	Value   *byte
+}
+
+type kerbExternalTicket struct {
+	ServiceName         *kerbExternalName
+	TargetName          *kerbExternalName
+	ClientName          *kerbExternalName
+	DomainName          unicodeString
+	TargetDomainName    unicodeString
+	AltTargetDomainName unicodeString
+	SessionKey          kerbCryptoKey
+	TicketFlags         uint32
+	Flags               uint32
+	KeyExpirationTime   int64
+	StartTime           int64
+	EndTime             int64
+	RenewUntil          int64
+	TimeSkew            int64
+	EncodedTicketSize   uint32
+	EncodedTicket       *byte
+}
+
+type kerbExternalName struct {
+	NameType  int16
+	NameCount uint16
+	Names     [1]unicodeString
+}
+
+// MSLSACache is a read only view of the Windows LSA ticket cache for the logon session of the current process.
+type MSLSACache struct{}
+
+// NewMSLSACache returns an MSLSACache for the logon session of the current process.
+func NewMSLSACache() *MSLSACache {
+	return &MSLSACache{}
+}
+
+func newMSLSACache() (CredentialCache, error) {
+	return NewMSLSACache(), nil
+}
+
+// Name returns the full name of the cache.
+func (m *MSLSACache) Name() string {
+	return CCacheTypeMSLSA + ":"
+}
+
+// Load retrieves the tickets held by the LSA into a CCache.
+func (m *MSLSACache) Load() (*CCache, error) {
+	c := &CCache{Version: 4}
+	h, pkg, err := lsaConnect()
+	if err != nil {
+		return c, err
+	}
+	defer procLsaDeregisterLogonProcess.Call(h)
+	infos, err := lsaQueryTicketCache(h, pkg)
+	if err != nil {
+		return c, err
+	}
+	for i, info := range infos {
+		if i == 0 {
+			c.DefaultPrincipal = info.client
+		}
+		cred, err := lsaRetrieveTicket(h, pkg, info)
+		if err != nil {
+			return c, err
+		}
+		c.Credentials = append(c.Credentials, cred)
+	}
+	if len(infos) == 0 {
+		return c, errors.New("the MSLSA credential cache holds no tickets")
+	}
+	return c, nil
+}
+
+// Initialize is not supported as the MSLSA cache is read only.
+func (m *MSLSACache) Initialize(cname types.PrincipalName, realm string) error {
+	return errMSLSAReadOnly
+}
+
+// DefaultPrincipal returns the principal name and realm of the client the LSA holds tickets for.
+func (m *MSLSACache) DefaultPrincipal() (types.PrincipalName, string, error) {
+	return defaultPrincipal(m)
+}
+
+// GetEntry returns the ticket held by the LSA for the server principal name provided.
+func (m *MSLSACache) GetEntry(p types.PrincipalName) (*Credential, bool, error) {
+	return getEntry(m, p)
+}
+
+// Store is not supported as the MSLSA cache is read only.
+func (m *MSLSACache) Store(cred *Credential) error {
+	return errMSLSAReadOnly
+}
+
+// Remove is not supported as the MSLSA cache is read only.
+func (m *MSLSACache) Remove(p types.PrincipalName) error {
+	return errMSLSAReadOnly
+}
+
+// Destroy is not supported as the MSLSA cache is read only.
+func (m *MSLSACache) Destroy() error {
+	return errMSLSAReadOnly
+}
+
+// lsaTicketInfo summarises a ticket listed in the LSA cache.
+type lsaTicketInfo struct {
+	client Principal
+	server Principal
+}
+
+func lsaConnect() (uintptr, uint32, error) {
+	var h uintptr
+	if err := ntStatusError(procLsaConnectUntrusted.Call(uintptr(unsafe.Pointer(&h)))); err != nil {
+		return 0, 0, fmt.Errorf("could not connect to the LSA: %v", err)
+	}
+	name := []byte(msLSAKerberosPackageName)
+	s := lsaString{
+		Length:        uint16(len(name)),
+		MaximumLength: uint16(len(name)),
+		Buffer:        &name[0],
+	}
+	var pkg uint32
+	if err := ntStatusError(procLsaLookupAuthenticationPkg.Call(h, uintptr(unsafe.Pointer(&s)), uintptr(unsafe.Pointer(&pkg)))); err != nil {
+		procLsaDeregisterLogonProcess.Call(h)
+		return 0, 0, fmt.Errorf("could not find the LSA Kerberos package: %v", err)
+	}
+	return h, pkg, nil
+}
+
+// lsaCall submits a request to the Kerberos package and returns the LSA allocated response buffer.
+// The buffer must be freed with LsaFreeReturnBuffer.
+func lsaCall(h uintptr, pkg uint32, req unsafe.Pointer, reqLen uintptr) (unsafe.Pointer, error) {
+	var ret unsafe.Pointer
+	var retLen uint32
+	var status uintptr
+	err := ntStatusError(procLsaCallAuthenticationPkg.Call(h, uintptr(pkg), uintptr(req), reqLen,
+		uintptr(unsafe.Pointer(&ret)), uintptr(unsafe.Pointer(&retLen)), uintptr(unsafe.Pointer(&status))))
+	if err != nil {
+		return nil, err
+	}
+	if err := ntStatusError(status, 0, nil); err != nil {
+		if ret != nil {
+			procLsaFreeReturnBuffer.Call(uintptr(ret))
+		}
+		return nil, err
+	}
+	return ret, nil
+}
+
+func lsaQueryTicketCache(h uintptr, pkg uint32) ([]lsaTicketInfo, error) {
+	req := kerbQueryTktCacheRequest{MessageType: kerbQueryTicketCacheExMessage}
+	ret, err := lsaCall(h, pkg, unsafe.Pointer(&req), unsafe.Sizeof(req))
+	if err != nil {
+		return nil, fmt.Errorf("could not query the LSA ticket cache: %v", err)
+	}
+	defer procLsaFreeReturnBuffer.Call(uintptr(ret))
+	resp := (*kerbQueryTktCacheExResponse)(ret)
+	infos := make([]lsaTicketInfo, 0, resp.CountOfTickets)
+	for i := uintptr(0); i < uintptr(resp.CountOfTickets); i++ {
+		t := (*kerbTicketCacheInfoEx)(unsafe.Pointer(uintptr(ret) + unsafe.Offsetof(resp.Tickets) + i*unsafe.Sizeof(resp.Tickets[0])))
+		infos = append(infos, lsaTicketInfo{
+			client: lsaPrincipal(t.ClientName, t.ClientRealm),
+			server: lsaPrincipal(t.ServerName, t.ServerRealm),
+		})
+	}
+	return infos, nil
+}
+
+func lsaRetrieveTicket(h uintptr, pkg uint32, info lsaTicketInfo) (*Credential, error) {
+	target, err := syscall.UTF16FromString(info.server.String())
+	if err != nil {
+		return nil, err
+	}
+	target = target[:len(target)-1]
+	// The target name must be held in the same buffer as the request
+	reqLen := unsafe.Sizeof(kerbRetrieveTktRequest{})
+	buf := make([]byte, reqLen+uintptr(len(target))*2)
+	req := (*kerbRetrieveTktRequest)(unsafe.Pointer(&buf[0]))
+	name := (*[1 << 20]uint16)(unsafe.Pointer(&buf[reqLen]))[:len(target):len(target)]
+	copy(name, target)
+	req.MessageType = kerbRetrieveEncodedTicketMessage
+	req.CacheOptions = kerbRetrieveTicketUseCacheOnly
+	req.TargetName = unicodeString{
+		Length:        uint16(len(target) * 2),
+		MaximumLength: uint16(len(target) * 2),
+		Buffer:        &name[0],
+	}
+	ret, err := lsaCall(h, pkg, unsafe.Pointer(&buf[0]), uintptr(len(buf)))
+	if err != nil {
+		return nil, fmt.Errorf("could not retrieve ticket for %s from the LSA: %v", info.server.String(), err)
+	}
+	defer procLsaFreeReturnBuffer.Call(uintptr(ret))
+	t := (*kerbExternalTicket)(ret)
+	cred := &Credential{
+		Client:    info.client,
+		Server:    info.server,
+		StartTime: fileTime(t.StartTime),
+		EndTime:   fileTime(t.EndTime),
+		RenewTill: fileTime(t.RenewUntil),
+		Key: types.EncryptionKey{
+			KeyType:  t.SessionKey.KeyType,
+			KeyValue: copyBytes(t.SessionKey.Value, t.SessionKey.Length),
+		},
+		TicketFlags: lsaTicketFlags(t.TicketFlags),
+		Ticket:      copyBytes(t.EncodedTicket, t.EncodedTicketSize),
+	}
+	cred.AuthTime = cred.StartTime
+	return cred, nil
+}
+
+func lsaPrincipal(name, realm unicodeString) Principal {
+	return Principal{
+		Realm:         unicodeStringToString(realm),
+		PrincipalName: types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, unicodeStringToString(name)),
+	}
+}
+
+func unicodeStringToString(s unicodeString) string {
+	if s.Buffer == nil || s.Length == 0 {
+		return ""
+	}
+	n := int(s.Length / 2)
+	return syscall.UTF16ToString((*[1 << 20]uint16)(unsafe.Pointer(s.Buffer))[:n:n])
+}
+
+func copyBytes(p *byte, n uint32) []byte {
+	if p == nil || n == 0 {
+		return []byte{}
+	}
+	b := make([]byte, n)
+	copy(b, (*[1 << 30]byte)(unsafe.Pointer(p))[:n:n])
+	return b
+}
+
+// ntStatusError converts an NTSTATUS returned by an LSA function into an error.
+func ntStatusError(status, _ uintptr, _ error) error {
+	if status == 0 {
+		return nil
+	}
+	r, _, _ := procLsaNtStatusToWinError.Call(status)
+	return syscall.Errno(r)
+}
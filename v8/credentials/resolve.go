@@ -0,0 +1,287 @@
+package credentials
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// Credential cache type prefixes as used in MIT style cache names such as FILE:/tmp/krb5cc_1000
+const (
+	CCacheTypeFile    = "FILE"
+	CCacheTypeKCM     = "KCM"
+	CCacheTypeKeyring = "KEYRING"
+	CCacheTypeMemory  = "MEMORY"
+	CCacheTypeDir     = "DIR"
+	CCacheTypeMSLSA   = "MSLSA"
+)
+
+// CredentialCache is implemented by each of the credential cache storage types.
+type CredentialCache interface {
+	// Name returns the full name of the cache including its type prefix.
+	Name() string
+	// Load reads the current contents of the cache into a CCache.
+	Load() (*CCache, error)
+	// Initialize clears the cache and sets its default principal.
+	Initialize(cname types.PrincipalName, realm string) error
+	// DefaultPrincipal returns the principal name and realm of the client the cache is for.
+	DefaultPrincipal() (types.PrincipalName, string, error)
+	// GetEntry returns the credential for the server principal name provided.
+	GetEntry(p types.PrincipalName) (*Credential, bool, error)
+	// Store adds a credential to the cache.
+	Store(cred *Credential) error
+	// Remove deletes the credentials for the server principal name provided.
+	Remove(p types.PrincipalName) error
+	// Destroy deletes the cache and all its credentials.
+	Destroy() error
+}
+
+// ResolveCCache returns the CredentialCache for the cache name provided.
+// The name takes the form TYPE:residual, for example FILE:/tmp/krb5cc_1000, KCM: or KEYRING:persistent:1000.
+// On Windows MSLSA: gives read only access to the tickets held by the LSA for the logon session.
+// A name without a type prefix is treated as a file path.
+// If the name is an empty string the default file cache for the current user is returned.
+func ResolveCCache(name string) (CredentialCache, error) {
+	if name == "" {
+		return NewFileCache(defaultCCachePath()), nil
+	}
+	t, residual := CCacheTypeFile, name
+	if i := strings.Index(name, ":"); i > 1 {
+		// Windows style paths such as C:\ have a single character before the colon so are treated as files
+		t, residual = strings.ToUpper(name[:i]), name[i+1:]
+	}
+	switch t {
+	case CCacheTypeFile:
+		if residual == "" {
+			return nil, fmt.Errorf("credential cache name %s does not specify a file path", name)
+		}
+		return NewFileCache(residual), nil
+	case CCacheTypeKCM:
+		return NewKCMCache(NewKCMClient(""), residual), nil
+	case CCacheTypeKeyring:
+		return newKeyringCache(residual)
+	case CCacheTypeMemory:
+		return NewMemoryCache(residual), nil
+	case CCacheTypeDir:
+		return newDirCache(residual)
+	case CCacheTypeMSLSA:
+		return newMSLSACache()
+	}
+	return nil, fmt.Errorf("credential cache type %s is not supported", t)
+}
+
+// ResolveDefaultCCache returns the CredentialCache named by the KRB5CCNAME environment variable, as MIT Kerberos
+// tools use by default, or if it is not set the default file cache for the current user.
+func ResolveDefaultCCache() (CredentialCache, error) {
+	return ResolveCCache(os.Getenv("KRB5CCNAME"))
+}
+
+func defaultCCachePath() string {
+	return fmt.Sprintf("/tmp/krb5cc_%d", os.Getuid())
+}
+
+// FileCache is a credential cache stored in a file.
+type FileCache struct {
+	path string
+}
+
+// NewFileCache returns a FileCache for the file path provided.
+func NewFileCache(path string) *FileCache {
+	return &FileCache{path: path}
+}
+
+// Name returns the full name of the cache.
+func (f *FileCache) Name() string {
+	return CCacheTypeFile + ":" + f.path
+}
+
+// Path returns the file path of the cache.
+func (f *FileCache) Path() string {
+	return f.path
+}
+
+// Load reads the cache file into a CCache, holding a shared lock on the file while it is read.
+func (f *FileCache) Load() (*CCache, error) {
+	return LoadCCache(f.path, WithLock())
+}
+
+// Initialize replaces the cache file with an empty cache for the default principal provided.
+func (f *FileCache) Initialize(cname types.PrincipalName, realm string) error {
+	c := &CCache{
+		Version:          4,
+		DefaultPrincipal: Principal{Realm: realm, PrincipalName: cname},
+		Path:             f.path,
+	}
+	return c.Save(WithLock())
+}
+
+// DefaultPrincipal returns the principal name and realm of the client the cache file is for.
+func (f *FileCache) DefaultPrincipal() (types.PrincipalName, string, error) {
+	return defaultPrincipal(f)
+}
+
+// GetEntry returns the credential from the cache file for the server principal name provided.
+func (f *FileCache) GetEntry(p types.PrincipalName) (*Credential, bool, error) {
+	return getEntry(f, p)
+}
+
+// Store adds a credential to the cache file.
+func (f *FileCache) Store(cred *Credential) error {
+	return f.update(func(c *CCache) bool {
+		c.AddCredential(cred)
+		return true
+	})
+}
+
+// Remove deletes the credentials for the server principal name provided from the cache file.
+func (f *FileCache) Remove(p types.PrincipalName) error {
+	return f.update(func(c *CCache) bool {
+		return c.RemoveEntry(p)
+	})
+}
+
+// update reads, modifies and rewrites the cache file while holding an exclusive lock on it.
+// The file is only rewritten if the modify function returns true.
+func (f *FileCache) update(modify func(c *CCache) bool) error {
+	if _, err := os.Stat(f.path); err != nil {
+		return err
+	}
+	fl, unlock, err := openLocked(f.path, true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	c, err := ReadCCache(fl)
+	if err != nil {
+		return err
+	}
+	c.Path = f.path
+	if !modify(c) {
+		return nil
+	}
+	// Rewrite the file in the version it was read in so that older implementations can still read it
+	b, err := c.MarshalVersion(c.Version)
+	if err != nil {
+		return err
+	}
+	return writeFileLocked(fl, b)
+}
+
+// Destroy zero-fills, truncates and deletes the cache file.
+func (f *FileCache) Destroy() error {
+	return wipeFile(f.path)
+}
+
+// KCMCache is a credential cache held by a KCM daemon.
+type KCMCache struct {
+	client *KCMClient
+	name   string
+}
+
+// NewKCMCache returns a KCMCache for the named cache held by the KCM daemon.
+// If the name is an empty string the KCM daemon's default cache is used.
+func NewKCMCache(client *KCMClient, name string) *KCMCache {
+	return &KCMCache{
+		client: client,
+		name:   name,
+	}
+}
+
+// Name returns the full name of the cache.
+func (k *KCMCache) Name() string {
+	return CCacheTypeKCM + ":" + k.name
+}
+
+// Load reads the cache from the KCM daemon into a CCache.
+func (k *KCMCache) Load() (*CCache, error) {
+	return k.client.Load(k.name)
+}
+
+// Initialize clears the cache held by the KCM daemon and sets its default principal.
+func (k *KCMCache) Initialize(cname types.PrincipalName, realm string) error {
+	name, err := k.cacheName()
+	if err != nil {
+		return err
+	}
+	return k.client.Initialize(name, cname, realm)
+}
+
+// DefaultPrincipal returns the principal name and realm of the client the cache held by the KCM daemon is for.
+func (k *KCMCache) DefaultPrincipal() (types.PrincipalName, string, error) {
+	name, err := k.cacheName()
+	if err != nil {
+		return types.PrincipalName{}, "", err
+	}
+	return k.client.GetPrincipal(name)
+}
+
+// GetEntry returns the credential from the cache held by the KCM daemon for the server principal name provided.
+func (k *KCMCache) GetEntry(p types.PrincipalName) (*Credential, bool, error) {
+	return getEntry(k, p)
+}
+
+// Remove deletes the credentials for the server principal name provided from the cache held by the KCM daemon.
+func (k *KCMCache) Remove(p types.PrincipalName) error {
+	name, err := k.cacheName()
+	if err != nil {
+		return err
+	}
+	creds, err := k.client.Credentials(name)
+	if err != nil {
+		return err
+	}
+	for _, cred := range creds {
+		if cred.Server.PrincipalName.Equal(p) {
+			if err := k.client.Remove(name, cred); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Destroy deletes the cache from the KCM daemon.
+func (k *KCMCache) Destroy() error {
+	name, err := k.cacheName()
+	if err != nil {
+		return err
+	}
+	return k.client.Destroy(name)
+}
+
+// Store adds a credential to the cache held by the KCM daemon.
+func (k *KCMCache) Store(cred *Credential) error {
+	name, err := k.cacheName()
+	if err != nil {
+		return err
+	}
+	return k.client.Store(name, cred)
+}
+
+func (k *KCMCache) cacheName() (string, error) {
+	if k.name != "" {
+		return k.name, nil
+	}
+	return k.client.DefaultCacheName()
+}
+
+// defaultPrincipal returns the default principal of a credential cache by loading its contents.
+func defaultPrincipal(cc CredentialCache) (types.PrincipalName, string, error) {
+	c, err := cc.Load()
+	if err != nil {
+		return types.PrincipalName{}, "", err
+	}
+	return c.DefaultPrincipal.PrincipalName, c.DefaultPrincipal.Realm, nil
+}
+
+// getEntry returns a credential from a credential cache by loading its contents.
+func getEntry(cc CredentialCache, p types.PrincipalName) (*Credential, bool, error) {
+	c, err := cc.Load()
+	if err != nil {
+		return nil, false, err
+	}
+	cred, ok := c.GetEntry(p)
+	return cred, ok, nil
+}
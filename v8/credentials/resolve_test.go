@@ -0,0 +1,271 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveCCache(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name     string
+		expected string
+	}{
+		{"FILE:/tmp/krb5cc_test", "FILE:/tmp/krb5cc_test"},
+		{"/tmp/krb5cc_test", "FILE:/tmp/krb5cc_test"},
+		{"KCM:1000", "KCM:1000"},
+		{"kcm:", "KCM:"},
+	}
+	for _, test := range tests {
+		c, err := ResolveCCache(test.name)
+		if err != nil {
+			t.Errorf("error resolving %s: %v", test.name, err)
+			continue
+		}
+		assert.Equal(t, test.expected, c.Name(), "Cache name not as expected")
+	}
+	_, err := ResolveCCache("MSLSA:")
+	assert.Error(t, err, "Expected error for unsupported cache type")
+	_, err = ResolveCCache("FILE:")
+	assert.Error(t, err, "Expected error for file cache without a path")
+}
+
+// testCredentialCache exercises the CredentialCache interface methods of the cache provided.
+func testCredentialCache(t *testing.T, cc CredentialCache) {
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	err = cc.Initialize(c.DefaultPrincipal.PrincipalName, c.DefaultPrincipal.Realm)
+	if err != nil {
+		t.Fatalf("Error initializing cache: %v", err)
+	}
+	for _, cred := range c.Credentials {
+		err = cc.Store(cred)
+		if err != nil {
+			t.Fatalf("Error storing credential: %v", err)
+		}
+	}
+	pn, realm, err := cc.DefaultPrincipal()
+	if err != nil {
+		t.Fatalf("Error getting default principal: %v", err)
+	}
+	assert.Equal(t, c.DefaultPrincipal.PrincipalName, pn, "Default principal name not as expected")
+	assert.Equal(t, c.DefaultPrincipal.Realm, realm, "Default principal realm not as expected")
+	lc, err := cc.Load()
+	if err != nil {
+		t.Fatalf("Error loading cache: %v", err)
+	}
+	assert.Equal(t, len(c.Credentials), len(lc.Credentials), "Number of credentials not as expected")
+
+	spn := c.Credentials[2].Server.PrincipalName
+	cred, ok, err := cc.GetEntry(spn)
+	if err != nil || !ok {
+		t.Fatalf("Could not get entry from cache: %v", err)
+	}
+	assert.Equal(t, c.Credentials[2].Ticket, cred.Ticket, "Ticket not as expected")
+	err = cc.Remove(spn)
+	if err != nil {
+		t.Fatalf("Error removing entry: %v", err)
+	}
+	_, ok, err = cc.GetEntry(spn)
+	if err != nil {
+		t.Fatalf("Error getting entry: %v", err)
+	}
+	assert.False(t, ok, "Entry not removed")
+
+	err = cc.Destroy()
+	if err != nil {
+		t.Fatalf("Error destroying cache: %v", err)
+	}
+	_, err = cc.Load()
+	assert.Error(t, err, "Expected error loading destroyed cache")
+}
+
+func TestResolveDefaultCCache(t *testing.T) {
+	// Not parallel as the environment is changed
+	defer os.Setenv("KRB5CCNAME", os.Getenv("KRB5CCNAME"))
+	os.Setenv("KRB5CCNAME", "FILE:/tmp/krb5cc_test")
+	c, err := ResolveDefaultCCache()
+	if err != nil {
+		t.Fatalf("error resolving the cache named by KRB5CCNAME: %v", err)
+	}
+	assert.Equal(t, "FILE:/tmp/krb5cc_test", c.Name(), "Cache name not as expected")
+	os.Unsetenv("KRB5CCNAME")
+	c, err = ResolveDefaultCCache()
+	if err != nil {
+		t.Fatalf("error resolving the default cache: %v", err)
+	}
+	assert.Equal(t, "FILE:"+defaultCCachePath(), c.Name(), "Cache name not as expected")
+}
+
+func TestCredentialCache(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir(os.TempDir(), "gokrb5-ccache")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	_, sock, closer := newFakeKCM(t)
+	defer closer()
+
+	names := []string{
+		"FILE:" + filepath.Join(dir, "krb5cc"),
+		"MEMORY:test",
+		"DIR:" + filepath.Join(dir, "collection"),
+	}
+	for _, name := range names {
+		cc, err := ResolveCCache(name)
+		if err != nil {
+			t.Fatalf("Error resolving %s: %v", name, err)
+		}
+		if m, ok := cc.(*MemoryCache); ok {
+			// The test data credentials have expired so fix the memory cache's clock
+			m.now = func() time.Time { return time.Unix(0, 0) }
+		}
+		t.Run(name, func(t *testing.T) {
+			testCredentialCache(t, cc)
+		})
+	}
+	t.Run("KCM", func(t *testing.T) {
+		testCredentialCache(t, NewKCMCache(NewKCMClient(sock), "1000"))
+	})
+}
+
+func TestDirCache(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir(os.TempDir(), "gokrb5-ccache")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cc, err := ResolveCCache("DIR:" + dir)
+	if err != nil {
+		t.Fatalf("Error resolving cache: %v", err)
+	}
+	assert.Equal(t, "DIR::"+filepath.Join(dir, "tkt"), cc.Name(), "Cache name not as expected")
+	err = cc.Initialize(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"), "TEST.GOKRB5")
+	if err != nil {
+		t.Fatalf("Error initializing cache: %v", err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, "primary"))
+	if err != nil {
+		t.Fatalf("Error reading primary file: %v", err)
+	}
+	assert.Equal(t, "tkt\n", string(b), "Primary file contents not as expected")
+	_, err = ResolveCCache("DIR::" + filepath.Join(dir, "other"))
+	assert.Error(t, err, "Expected error for cache file name not starting with tkt")
+}
+
+func TestFileCache(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	dir, err := ioutil.TempDir(os.TempDir(), "gokrb5-ccache")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	fc, err := ResolveCCache("FILE:" + filepath.Join(dir, "krb5cc"))
+	if err != nil {
+		t.Fatalf("Error resolving cache: %v", err)
+	}
+	err = fc.Initialize(c.DefaultPrincipal.PrincipalName, c.DefaultPrincipal.Realm)
+	if err != nil {
+		t.Fatalf("Error initializing cache: %v", err)
+	}
+	for _, cred := range c.Credentials {
+		err = fc.Store(cred)
+		if err != nil {
+			t.Fatalf("Error storing credential: %v", err)
+		}
+	}
+	lc, err := fc.Load()
+	if err != nil {
+		t.Fatalf("Error loading cache: %v", err)
+	}
+	assert.Equal(t, c.DefaultPrincipal, lc.DefaultPrincipal, "Default principal not as expected")
+	assert.Equal(t, len(c.Credentials), len(lc.Credentials), "Number of credentials not as expected")
+}
+
+func TestFileCache_ConcurrentStore(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	c := new(CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	dir, err := ioutil.TempDir(os.TempDir(), "gokrb5-ccache")
+	if err != nil {
+		t.Fatalf("Error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	cpath := filepath.Join(dir, "krb5cc")
+	fc := NewFileCache(cpath)
+	err = fc.Initialize(c.DefaultPrincipal.PrincipalName, c.DefaultPrincipal.Realm)
+	if err != nil {
+		t.Fatalf("Error initializing cache: %v", err)
+	}
+	n := 20
+	var wg sync.WaitGroup
+	wg.Add(n * 2)
+	for i := 0; i < n; i++ {
+		go func(i int) {
+			defer wg.Done()
+			cred := *c.Credentials[2]
+			cred.Server.PrincipalName = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, fmt.Sprintf("HTTP/host%d.test.gokrb5", i))
+			if err := fc.Store(&cred); err != nil {
+				t.Errorf("Error storing credential: %v", err)
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			if _, err := LoadCCache(cpath, WithLock()); err != nil {
+				t.Errorf("Error loading cache: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	lc, err := LoadCCache(cpath, WithLock())
+	if err != nil {
+		t.Fatalf("Error loading cache: %v", err)
+	}
+	assert.Equal(t, n, len(lc.Credentials), "Credentials lost during concurrent updates")
+
+	err = lc.Save(WithLock())
+	if err != nil {
+		t.Fatalf("Error saving cache: %v", err)
+	}
+	lc2, err := LoadCCache(cpath)
+	if err != nil {
+		t.Fatalf("Error loading cache: %v", err)
+	}
+	assert.Equal(t, n, len(lc2.Credentials), "Number of credentials not as expected after locked save")
+}
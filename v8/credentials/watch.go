@@ -0,0 +1,134 @@
+package credentials
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"time"
+)
+
+// Watcher monitors a credential cache file and loads it again each time it changes, for example when the tickets in
+// it are renewed by kinit run from cron. This allows long running clients to pick up the new tickets without a restart.
+//
+// The file is polled at the interval provided. A change is detected when the file is replaced, as MIT Kerberos and
+// CCache.Export do, or when its size or modification time changes.
+type Watcher struct {
+	path     string
+	interval time.Duration
+	current  *CCache
+	info     os.FileInfo
+	updates  chan *CCache
+	errors   chan error
+	cancel   chan bool
+	done     chan bool
+	mux      sync.RWMutex
+}
+
+// NewWatcher loads the credential cache file at the path provided and starts watching it for changes.
+// Stop should be called when the Watcher is no longer needed.
+func NewWatcher(cpath string, interval time.Duration) (*Watcher, error) {
+	if interval <= 0 {
+		return nil, errors.New("credential cache watch interval must be greater than zero")
+	}
+	info, err := os.Stat(cpath)
+	if err != nil {
+		return nil, err
+	}
+	c, err := LoadCCache(cpath, WithLock())
+	if err != nil {
+		return nil, err
+	}
+	w := &Watcher{
+		path:     cpath,
+		interval: interval,
+		current:  c,
+		info:     info,
+		updates:  make(chan *CCache, 1),
+		errors:   make(chan error, 1),
+		cancel:   make(chan bool, 1),
+		done:     make(chan bool),
+	}
+	go w.watch()
+	return w, nil
+}
+
+// CCache returns the most recently loaded contents of the credential cache file.
+func (w *Watcher) CCache() *CCache {
+	w.mux.RLock()
+	defer w.mux.RUnlock()
+	return w.current
+}
+
+// Updates returns a channel on which the credential cache is delivered each time it is loaded again.
+// Only the most recent update is held so a slow receiver does not see intermediate versions.
+func (w *Watcher) Updates() <-chan *CCache {
+	return w.updates
+}
+
+// Errors returns a channel on which errors loading the credential cache are delivered.
+// Only the most recent error is held. The Watcher continues watching the file after an error.
+func (w *Watcher) Errors() <-chan error {
+	return w.errors
+}
+
+// Stop ends the watching of the credential cache file and waits for the watching goroutine to exit.
+// The Updates and Errors channels are closed.
+func (w *Watcher) Stop() {
+	select {
+	case w.cancel <- true:
+	default:
+	}
+	<-w.done
+}
+
+func (w *Watcher) watch() {
+	defer func() {
+		close(w.updates)
+		close(w.errors)
+		close(w.done)
+	}()
+	t := time.NewTicker(w.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-w.cancel:
+			return
+		case <-t.C:
+			w.check()
+		}
+	}
+}
+
+// check loads the file again if it has changed since it was last loaded.
+func (w *Watcher) check() {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		w.sendError(err)
+		return
+	}
+	if os.SameFile(info, w.info) && info.Size() == w.info.Size() && info.ModTime().Equal(w.info.ModTime()) {
+		return
+	}
+	c, err := LoadCCache(w.path, WithLock())
+	if err != nil {
+		w.sendError(err)
+		return
+	}
+	w.mux.Lock()
+	w.current = c
+	w.info = info
+	w.mux.Unlock()
+	select {
+	case <-w.updates:
+	default:
+	}
+	w.updates <- c
+}
+
+func (w *Watcher) sendError(err error) {
+	select {
+	case <-w.errors:
+	default:
+	}
+	w.errors <- err
+}
@@ -0,0 +1,97 @@
+package credentials
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	dir, err := ioutil.TempDir("", "ccache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "krb5cc")
+	if err := ioutil.WriteFile(p, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(p, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error creating watcher: %v", err)
+	}
+	defer w.Stop()
+	assert.Equal(t, 3, len(w.CCache().Credentials), "Initial cache not loaded")
+
+	c := new(CCache)
+	if err := c.Unmarshal(b); err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	c.RemoveEntry(c.Credentials[2].Server.PrincipalName)
+	if err := c.Export(p); err != nil {
+		t.Fatalf("Error exporting cache: %v", err)
+	}
+	select {
+	case u := <-w.Updates():
+		assert.Equal(t, 2, len(u.Credentials), "Updated cache not delivered")
+		assert.Equal(t, u, w.CCache(), "Current cache not updated")
+	case err := <-w.Errors():
+		t.Fatalf("Error watching cache: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for cache update")
+	}
+
+	if err := os.Remove(p); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-w.Errors():
+		assert.True(t, os.IsNotExist(err), "Error not as expected: %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for watch error")
+	}
+	assert.Equal(t, 2, len(w.CCache().Credentials), "Last loaded cache not retained after an error")
+}
+
+func TestWatcher_Stop(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatal("Error decoding test data")
+	}
+	dir, err := ioutil.TempDir("", "ccache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "krb5cc")
+	if err := ioutil.WriteFile(p, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	w, err := NewWatcher(p, time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error creating watcher: %v", err)
+	}
+	w.Stop()
+	_, ok := <-w.Updates()
+	assert.False(t, ok, "Updates channel not closed")
+	_, ok = <-w.Errors()
+	assert.False(t, ok, "Errors channel not closed")
+	w.Stop()
+
+	_, err = NewWatcher(p, 0)
+	assert.Error(t, err, "Zero interval should be rejected")
+	_, err = NewWatcher(filepath.Join(dir, "missing"), time.Second)
+	assert.Error(t, err, "Missing file should be rejected")
+}
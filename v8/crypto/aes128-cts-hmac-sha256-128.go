@@ -109,6 +109,11 @@ func (e Aes128CtsHmacSha256128) DeriveRandom(protocolKey, usage []byte) ([]byte,
 	return rfc8009.DeriveRandom(protocolKey, usage, e)
 }
 
+// PRF returns the output of the etype's pseudo-random function for the data provided.
+func (e Aes128CtsHmacSha256128) PRF(protocolKey, data []byte) ([]byte, error) {
+	return rfc8009.PseudoRandom(protocolKey, data, e), nil
+}
+
 // VerifyIntegrity checks the integrity of the ciphertext message.
 // As the hash is calculated over the iv concatenated with the AES cipher output not the plaintext the pt value to this
 // interface method is not use. Pass any []byte.
@@ -146,3 +146,15 @@ func TestAes128CtsHmacSha256128_Cypto(t *testing.T) {
 		assert.Equal(t, test.hash, hex.EncodeToString(mac), "HMAC result not as expected - test %v", i)
 	}
 }
+
+func TestAes128CtsHmacSha256128_PRF(t *testing.T) {
+	t.Parallel()
+	// Test vector from RFC 8009 Appendix A
+	k, _ := hex.DecodeString("3705D96080C17728A0E800EAB6E0D23C")
+	var e Aes128CtsHmacSha256128
+	b, err := e.PRF(k, []byte("test"))
+	if err != nil {
+		t.Fatalf("error in PRF: %v", err)
+	}
+	assert.Equal(t, "9d188616f63852fe86915bb840b4a886ff3e6bb0f819b49b893393d393854295", hex.EncodeToString(b), "PRF output not as expected")
+}
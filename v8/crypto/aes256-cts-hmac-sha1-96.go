@@ -109,6 +109,11 @@ func (e Aes256CtsHmacSha96) DeriveRandom(protocolKey, usage []byte) ([]byte, err
 	return rfc3961.DeriveRandom(protocolKey, usage, e)
 }
 
+// PRF returns the output of the etype's pseudo-random function for the data provided.
+func (e Aes256CtsHmacSha96) PRF(protocolKey, data []byte) ([]byte, error) {
+	return rfc3961.PseudoRandom(protocolKey, data, e)
+}
+
 // VerifyIntegrity checks the integrity of the plaintext message.
 func (e Aes256CtsHmacSha96) VerifyIntegrity(protocolKey, ct, pt []byte, usage uint32) bool {
 	return rfc3961.VerifyIntegrity(protocolKey, ct, pt, usage, e)
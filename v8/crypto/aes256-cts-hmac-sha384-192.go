@@ -30,7 +30,7 @@ func (e Aes256CtsHmacSha384192) GetHashID() int32 {
 
 // GetKeyByteSize returns the number of bytes for key of this etype.
 func (e Aes256CtsHmacSha384192) GetKeyByteSize() int {
-	return 192 / 8
+	return 256 / 8
 }
 
 // GetKeySeedBitLength returns the number of bits for the seed for key generation.
@@ -109,6 +109,11 @@ func (e Aes256CtsHmacSha384192) DeriveRandom(protocolKey, usage []byte) ([]byte,
 	return rfc8009.DeriveRandom(protocolKey, usage, e)
 }
 
+// PRF returns the output of the etype's pseudo-random function for the data provided.
+func (e Aes256CtsHmacSha384192) PRF(protocolKey, data []byte) ([]byte, error) {
+	return rfc8009.PseudoRandom(protocolKey, data, e), nil
+}
+
 // VerifyIntegrity checks the integrity of the ciphertext message.
 // As the hash is calculated over the iv concatenated with the AES cipher output not the plaintext the pt value to this
 // interface method is not use. Pass any []byte.
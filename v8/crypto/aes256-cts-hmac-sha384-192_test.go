@@ -6,6 +6,7 @@ import (
 
 	"github.com/Osirium/gokrb5/v8/crypto/common"
 	"github.com/Osirium/gokrb5/v8/crypto/rfc8009"
+	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -145,3 +146,41 @@ func TestAes256CtsHmacSha384192_VerifyIntegrity(t *testing.T) {
 		assert.Equal(t, test.chksum, hex.EncodeToString(b), "Checksum not as expected")
 	}
 }
+
+func TestAes256CtsHmacSha384192_PRF(t *testing.T) {
+	t.Parallel()
+	// Test vector from RFC 8009 Appendix A
+	k, _ := hex.DecodeString("6D404D37FAF79F9DF0D33568D320669800EB4836472EA8A026D16B7182460C52")
+	var e Aes256CtsHmacSha384192
+	b, err := e.PRF(k, []byte("test"))
+	if err != nil {
+		t.Fatalf("error in PRF: %v", err)
+	}
+	assert.Equal(t, "9801f69a368c2bf675e59521e177d9a07f67efe1cfde8d3c8d6f6a0256e3b17db3c1b62ad1b8553360d17367eb1514d2", hex.EncodeToString(b), "PRF output not as expected")
+}
+
+func TestAes256CtsHmacSha384192_GeneratedKey(t *testing.T) {
+	t.Parallel()
+	var e Aes256CtsHmacSha384192
+	key, err := types.GenerateEncryptionKey(e)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	assert.Equal(t, 32, len(key.KeyValue), "generated key length not as expected")
+	m := []byte("a message encrypted with a generated aes256-cts-hmac-sha384-192 key")
+	ed, err := GetEncryptedData(m, key, 2, 1)
+	if err != nil {
+		t.Fatalf("error encrypting with generated key: %v", err)
+	}
+	pt, err := DecryptEncPart(ed, key, 2)
+	if err != nil {
+		t.Fatalf("error decrypting with generated key: %v", err)
+	}
+	assert.Equal(t, m, pt, "decrypted message not as expected")
+	cb, err := e.GetChecksumHash(key.KeyValue, m, 6)
+	if err != nil {
+		t.Fatalf("error getting checksum with generated key: %v", err)
+	}
+	assert.Equal(t, 24, len(cb), "checksum length not as expected")
+	assert.True(t, e.VerifyChecksum(key.KeyValue, m, cb, 6), "checksum not valid")
+}
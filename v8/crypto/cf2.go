@@ -0,0 +1,87 @@
+package crypto
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Osirium/gokrb5/v8/crypto/etype"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// KRBFXCF2 combines two keys into one as defined by KRB-FX-CF2 in RFC 6113 section 5.1:
+//
+// KRB-FX-CF2(key1, key2, pepper1, pepper2) = random-to-key(PRF+(key1, pepper1) XOR PRF+(key2, pepper2))
+//
+// The key returned has the encryption type of the first key. It is used by FAST to derive the armor key and the
+// keys for encrypted challenges.
+func KRBFXCF2(key1, key2 types.EncryptionKey, pepper1, pepper2 string) (types.EncryptionKey, error) {
+	et1, err := GetEtype(key1.KeyType)
+	if err != nil {
+		return types.EncryptionKey{}, err
+	}
+	et2, err := GetEtype(key2.KeyType)
+	if err != nil {
+		return types.EncryptionKey{}, err
+	}
+	n := et1.GetKeySeedBitLength() / 8
+	b1, err := prfPlus(et1, key1.KeyValue, []byte(pepper1), n)
+	if err != nil {
+		return types.EncryptionKey{}, fmt.Errorf("error generating pseudo-random data from first key: %v", err)
+	}
+	b2, err := prfPlus(et2, key2.KeyValue, []byte(pepper2), n)
+	if err != nil {
+		return types.EncryptionKey{}, fmt.Errorf("error generating pseudo-random data from second key: %v", err)
+	}
+	for i := range b1 {
+		b1[i] ^= b2[i]
+	}
+	return types.EncryptionKey{
+		KeyType:  key1.KeyType,
+		KeyValue: et1.RandomToKey(b1),
+	}, nil
+}
+
+// PRF returns the output of the pseudo-random function of the key's encryption type for the data provided, as defined
+// in RFC 3961 section 3.
+func PRF(key types.EncryptionKey, data []byte) ([]byte, error) {
+	et, err := GetEtype(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	return et.PRF(key.KeyValue, data)
+}
+
+// PRFPlus returns n bytes of output from the PRF+ function of RFC 6113 section 5.1 for the key and data provided.
+func PRFPlus(key types.EncryptionKey, data []byte, n int) ([]byte, error) {
+	et, err := GetEtype(key.KeyType)
+	if err != nil {
+		return nil, err
+	}
+	return prfPlus(et, key.KeyValue, data, n)
+}
+
+// prfPlus returns n bytes of output from the PRF+ function defined in RFC 6113 section 5.1:
+//
+// PRF+(key, data) = PRF(key, 1 || data) || PRF(key, 2 || data) || ...
+//
+// where the counter is a single octet.
+func prfPlus(e etype.EType, key, data []byte, n int) ([]byte, error) {
+	out := make([]byte, 0, n)
+	in := make([]byte, len(data)+1)
+	copy(in[1:], data)
+	for i := 1; len(out) < n; i++ {
+		if i > 255 {
+			return nil, errors.New("too much pseudo-random output requested")
+		}
+		in[0] = byte(i)
+		b, err := e.PRF(key, in)
+		if err != nil {
+			return nil, err
+		}
+		if len(b) < 1 {
+			return nil, errors.New("pseudo-random function returned no output")
+		}
+		out = append(out, b...)
+	}
+	return out[:n], nil
+}
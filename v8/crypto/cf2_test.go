@@ -0,0 +1,37 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKRBFXCF2(t *testing.T) {
+	t.Parallel()
+	// Test vectors from MIT Kerberos t_cf2, where each key is derived from a password used as its own salt
+	var tests = []struct {
+		etype int32
+		key   string
+	}{
+		{etypeID.AES128_CTS_HMAC_SHA1_96, "97df97e4b798b29eb31ed7280287a92a"},
+		{etypeID.AES256_CTS_HMAC_SHA1_96, "4d6ca4e629785c1f01baf55e2e548566b9617ae3a96868c337cb93b5e72b1c7b"},
+		{etypeID.DES3_CBC_SHA1_KD, "e58f9eb643862c13ad38e529313462a7f73e62834fe54a01"},
+	}
+	for _, test := range tests {
+		et, err := GetEtype(test.etype)
+		if err != nil {
+			t.Fatalf("error getting etype: %v", err)
+		}
+		k1, _ := et.StringToKey("key1", "key1", et.GetDefaultStringToKeyParams())
+		k2, _ := et.StringToKey("key2", "key2", et.GetDefaultStringToKeyParams())
+		k, err := KRBFXCF2(types.EncryptionKey{KeyType: test.etype, KeyValue: k1}, types.EncryptionKey{KeyType: test.etype, KeyValue: k2}, "a", "b")
+		if err != nil {
+			t.Fatalf("error in KRB-FX-CF2 for etype %d: %v", test.etype, err)
+		}
+		assert.Equal(t, test.etype, k.KeyType, "key type not as expected")
+		assert.Equal(t, test.key, hex.EncodeToString(k.KeyValue), "KRB-FX-CF2 output not as expected for etype %d", test.etype)
+	}
+}
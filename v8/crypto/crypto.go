@@ -4,67 +4,82 @@ package crypto
 import (
 	"encoding/hex"
 	"fmt"
+	"sync"
 
 	"github.com/Osirium/gokrb5/v8/crypto/etype"
-	"github.com/Osirium/gokrb5/v8/iana/chksumtype"
+	"github.com/Osirium/gokrb5/v8/fips"
 	"github.com/Osirium/gokrb5/v8/iana/etypeID"
 	"github.com/Osirium/gokrb5/v8/iana/patype"
 	"github.com/Osirium/gokrb5/v8/types"
 )
 
+// registry holds the encryption type implementations keyed by etype ID and by checksum type ID.
+var registry = struct {
+	sync.RWMutex
+	etypes  map[int32]etype.EType
+	chksums map[int32]etype.EType
+}{
+	etypes:  make(map[int32]etype.EType),
+	chksums: make(map[int32]etype.EType),
+}
+
+func init() {
+	for _, et := range []etype.EType{
+		Aes128CtsHmacSha96{},
+		Aes256CtsHmacSha96{},
+		Aes128CtsHmacSha256128{},
+		Aes256CtsHmacSha384192{},
+		Des3CbcSha1Kd{},
+		RC4HMAC{},
+	} {
+		registerEtype(et)
+	}
+}
+
+// RegisterEtype registers an implementation of an encryption type, and of its checksum type, so that it is returned by
+// GetEtype and GetChksumEtype for its IDs. An implementation registered for an ID replaces any previously registered,
+// including those of gokrb5. The names provided, such as those used in krb5.conf enctype lists, resolve to the
+// encryption type so that it can be configured.
+// Encryption types should be registered from an init function as registration is not safe to perform concurrently
+// with the parsing of configuration.
+func RegisterEtype(et etype.EType, names ...string) {
+	registerEtype(et)
+	etypeID.AddSupported(et.GetETypeID(), names...)
+}
+
+func registerEtype(et etype.EType) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.etypes[et.GetETypeID()] = et
+	registry.chksums[et.GetHashID()] = et
+}
+
 // GetEtype returns an instances of the required etype struct for the etype ID.
+// In FIPS mode an error is returned for encryption types that are not FIPS approved.
 func GetEtype(id int32) (etype.EType, error) {
-	switch id {
-	case etypeID.AES128_CTS_HMAC_SHA1_96:
-		var et Aes128CtsHmacSha96
-		return et, nil
-	case etypeID.AES256_CTS_HMAC_SHA1_96:
-		var et Aes256CtsHmacSha96
-		return et, nil
-	case etypeID.AES128_CTS_HMAC_SHA256_128:
-		var et Aes128CtsHmacSha256128
-		return et, nil
-	case etypeID.AES256_CTS_HMAC_SHA384_192:
-		var et Aes256CtsHmacSha384192
-		return et, nil
-	case etypeID.DES3_CBC_SHA1_KD:
-		var et Des3CbcSha1Kd
-		return et, nil
-	case etypeID.RC4_HMAC:
-		var et RC4HMAC
+	if err := fips.CheckEType(id); err != nil {
+		return nil, err
+	}
+	registry.RLock()
+	defer registry.RUnlock()
+	if et, ok := registry.etypes[id]; ok {
 		return et, nil
-	default:
-		return nil, fmt.Errorf("unknown or unsupported EType: %d", id)
 	}
+	return nil, fmt.Errorf("unknown or unsupported EType: %d", id)
 }
 
 // GetChksumEtype returns an instances of the required etype struct for the checksum ID.
+// In FIPS mode an error is returned for checksum types that are not FIPS approved.
 func GetChksumEtype(id int32) (etype.EType, error) {
-	switch id {
-	case chksumtype.HMAC_SHA1_96_AES128:
-		var et Aes128CtsHmacSha96
-		return et, nil
-	case chksumtype.HMAC_SHA1_96_AES256:
-		var et Aes256CtsHmacSha96
-		return et, nil
-	case chksumtype.HMAC_SHA256_128_AES128:
-		var et Aes128CtsHmacSha256128
-		return et, nil
-	case chksumtype.HMAC_SHA384_192_AES256:
-		var et Aes256CtsHmacSha384192
-		return et, nil
-	case chksumtype.HMAC_SHA1_DES3_KD:
-		var et Des3CbcSha1Kd
-		return et, nil
-	case chksumtype.KERB_CHECKSUM_HMAC_MD5:
-		var et RC4HMAC
+	if err := fips.CheckChksumType(id); err != nil {
+		return nil, err
+	}
+	registry.RLock()
+	defer registry.RUnlock()
+	if et, ok := registry.chksums[id]; ok {
 		return et, nil
-	//case chksumtype.KERB_CHECKSUM_HMAC_MD5_UNSIGNED:
-	//	var et RC4HMAC
-	//	return et, nil
-	default:
-		return nil, fmt.Errorf("unknown or unsupported checksum type: %d", id)
 	}
+	return nil, fmt.Errorf("unknown or unsupported checksum type: %d", id)
 }
 
 // GetKeyFromPassword generates an encryption key from the principal's password.
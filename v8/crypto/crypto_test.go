@@ -0,0 +1,48 @@
+package crypto
+
+import (
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+// siteEtype is a site-specific encryption type, implemented as aes256-cts-hmac-sha1-96 under private IDs.
+type siteEtype struct {
+	Aes256CtsHmacSha96
+}
+
+func (e siteEtype) GetETypeID() int32 {
+	return -1001
+}
+
+func (e siteEtype) GetHashID() int32 {
+	return -1002
+}
+
+func TestRegisterEtype(t *testing.T) {
+	t.Parallel()
+	_, err := GetEtype(-1001)
+	assert.Error(t, err, "unregistered etype should not be returned")
+
+	RegisterEtype(siteEtype{}, "site-aes256", "site-aes")
+	et, err := GetEtype(-1001)
+	if err != nil {
+		t.Fatalf("error getting registered etype: %v", err)
+	}
+	assert.IsType(t, siteEtype{}, et, "registered etype not returned")
+	et, err = GetChksumEtype(-1002)
+	if err != nil {
+		t.Fatalf("error getting etype of registered checksum type: %v", err)
+	}
+	assert.IsType(t, siteEtype{}, et, "registered etype not returned for its checksum type")
+	assert.Equal(t, int32(-1001), etypeID.EtypeSupported("site-aes"), "registered etype name not supported")
+	assert.Equal(t, "site-aes256", etypeID.ETypeNames[-1001], "canonical name of registered etype not as expected")
+
+	// The etypes of gokrb5 are registered by default
+	et, err = GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error getting etype: %v", err)
+	}
+	assert.IsType(t, Aes256CtsHmacSha96{}, et, "etype not as expected")
+}
@@ -90,6 +90,11 @@ func (e Des3CbcSha1Kd) DeriveRandom(protocolKey, usage []byte) ([]byte, error) {
 	return r, err
 }
 
+// PRF returns the output of the etype's pseudo-random function for the data provided.
+func (e Des3CbcSha1Kd) PRF(protocolKey, data []byte) ([]byte, error) {
+	return rfc3961.PseudoRandom(protocolKey, data, e)
+}
+
 // DeriveKey derives a key from the protocol key based on the usage value.
 func (e Des3CbcSha1Kd) DeriveKey(protocolKey, usage []byte) ([]byte, error) {
 	r, err := e.DeriveRandom(protocolKey, usage)
@@ -22,6 +22,7 @@ type EType interface {
 	GetConfounderByteSize() int
 	DeriveKey(protocolKey, usage []byte) ([]byte, error)
 	DeriveRandom(protocolKey, usage []byte) ([]byte, error)
+	PRF(protocolKey, data []byte) ([]byte, error)
 	VerifyIntegrity(protocolKey, ct, pt []byte, usage uint32) bool
 	GetChecksumHash(protocolKey, data []byte, usage uint32) ([]byte, error)
 	VerifyChecksum(protocolKey, data, chksum []byte, usage uint32) bool
@@ -113,6 +113,11 @@ func (e RC4HMAC) DeriveRandom(protocolKey, usage []byte) ([]byte, error) {
 	return rfc3961.DeriveRandom(protocolKey, usage, e)
 }
 
+// PRF returns the output of the etype's pseudo-random function for the data provided.
+func (e RC4HMAC) PRF(protocolKey, data []byte) ([]byte, error) {
+	return rfc4757.PseudoRandom(protocolKey, data), nil
+}
+
 // VerifyIntegrity checks the integrity of the plaintext message.
 func (e RC4HMAC) VerifyIntegrity(protocolKey, ct, pt []byte, usage uint32) bool {
 	return rfc4757.VerifyIntegrity(protocolKey, pt, ct, e)
@@ -71,11 +71,15 @@ func DES3StringToKey(secret, salt string, e etype.EType) ([]byte, error) {
 	return e.DeriveKey(tkey, []byte("kerberos"))
 }
 
-// PseudoRandom function as defined in RFC 3961
+// PseudoRandom function as defined in RFC 3961 for the simplified profile:
+// PRF = E(DK(Key, "prf"), truncate(H(data)), initial-cipher-state)
+// where the hash is truncated to a multiple of the cipher block size.
 func PseudoRandom(key, b []byte, e etype.EType) ([]byte, error) {
 	h := e.GetHashFunc()()
 	h.Write(b)
-	tmp := h.Sum(nil)[:e.GetMessageBlockByteSize()]
+	tmp := h.Sum(nil)
+	m := e.GetCypherBlockBitLength() / 8
+	tmp = tmp[:len(tmp)-len(tmp)%m]
 	k, err := e.DeriveKey(key, []byte(prfconstant))
 	if err != nil {
 		return []byte{}, err
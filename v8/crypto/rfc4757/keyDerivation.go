@@ -2,6 +2,8 @@ package rfc4757
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -38,3 +40,10 @@ func deriveKeys(key, checksum []byte, usage uint32, export bool) (k1, k2, k3 []b
 	k3 = HMAC(k2, checksum)
 	return
 }
+
+// PseudoRandom function for the RC4-HMAC etype, as implemented by MIT Kerberos and Windows: PRF = HMAC-SHA1(key, data)
+func PseudoRandom(key, data []byte) []byte {
+	mac := hmac.New(sha1.New, key)
+	mac.Write(data)
+	return mac.Sum(nil)
+}
@@ -7,7 +7,6 @@ import (
 	"errors"
 
 	"github.com/Osirium/gokrb5/v8/crypto/etype"
-	"github.com/Osirium/gokrb5/v8/iana/etypeID"
 	"golang.org/x/crypto/pbkdf2"
 )
 
@@ -21,41 +20,25 @@ func DeriveRandom(protocolKey, usage []byte, e etype.EType) ([]byte, error) {
 	return KDF_HMAC_SHA2(protocolKey, []byte("prf"), usage, h.Size(), e), nil
 }
 
-// DeriveKey derives a key from the protocol key based on the usage and the etype's specific methods.
+// PseudoRandom function as defined in RFC 8009: PRF = KDF-HMAC-SHA2(key, "prf", data, hash length)
+//
+// https://tools.ietf.org/html/rfc8009#section-5
+func PseudoRandom(protocolKey, b []byte, e etype.EType) []byte {
+	h := e.GetHashFunc()()
+	return KDF_HMAC_SHA2(protocolKey, []byte("prf"), b, h.Size()*8, e)
+}
+
+// DeriveKey derives a key from the protocol key based on the usage and the etype's specific methods. The checksum
+// and integrity keys, Kc and Ki, are the length of the etype's HMAC output and all other keys, including the
+// encryption key Ke, are the length of the protocol key.
 //
 // https://tools.ietf.org/html/rfc8009#section-5
 func DeriveKey(protocolKey, label []byte, e etype.EType) []byte {
-	var context []byte
-	var kl int
-	// Key length is longer for aes256-cts-hmac-sha384-192 is it is a Ke or from StringToKey (where label is "kerberos")
-	if e.GetETypeID() == etypeID.AES256_CTS_HMAC_SHA384_192 {
-	Swtch:
-		switch label[len(label)-1] {
-		case 0x73:
-			// 0x73 is "s" so label could be kerberos meaning StringToKey so now check if the label is "kerberos"
-			kerblabel := []byte("kerberos")
-			if len(label) != len(kerblabel) {
-				break
-			}
-			for i, b := range label {
-				if b != kerblabel[i] {
-					kl = e.GetKeySeedBitLength()
-					break Swtch
-				}
-			}
-			if kl == 0 {
-				// This is StringToKey
-				kl = 256
-			}
-		case 0xAA:
-			// This is a Ke
-			kl = 256
-		}
-	}
-	if kl == 0 {
-		kl = e.GetKeySeedBitLength()
+	kl := e.GetKeySeedBitLength()
+	if len(label) == 5 && (label[4] == 0x99 || label[4] == 0x55) {
+		kl = e.GetHMACBitLength()
 	}
-	return e.RandomToKey(KDF_HMAC_SHA2(protocolKey, label, context, kl, e))
+	return e.RandomToKey(KDF_HMAC_SHA2(protocolKey, label, nil, kl, e))
 }
 
 // RandomToKey returns a key from the bytes provided according to the definition in RFC 8009.
@@ -80,11 +63,7 @@ func StringToKeyIter(secret, salt string, iterations int, e etype.EType) ([]byte
 
 // StringToPBKDF2 generates an encryption key from a pass phrase and salt string using the PBKDF2 function from PKCS #5 v2.0
 func StringToPBKDF2(secret, salt string, iterations int, e etype.EType) []byte {
-	kl := e.GetKeyByteSize()
-	if e.GetETypeID() == etypeID.AES256_CTS_HMAC_SHA384_192 {
-		kl = 32
-	}
-	return pbkdf2.Key([]byte(secret), []byte(salt), iterations, kl, e.GetHashFunc())
+	return pbkdf2.Key([]byte(secret), []byte(salt), iterations, e.GetKeyByteSize(), e.GetHashFunc())
 }
 
 // KDF_HMAC_SHA2 key derivation: https://tools.ietf.org/html/rfc8009#section-3
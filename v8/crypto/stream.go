@@ -0,0 +1,289 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/Osirium/gokrb5/v8/crypto/common"
+	"github.com/Osirium/gokrb5/v8/crypto/etype"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/aescts/v2"
+)
+
+// streamChunkSize is the size of the chunks messages are read in when encrypted or decrypted as streams.
+const streamChunkSize = 32 * 1024
+
+// EncryptStream encrypts the message read from r with the key for the key usage provided, writing the encrypted
+// message, the ciphertext followed by its integrity hash, to w. The output is that of the etype's EncryptMessage so it
+// can be decrypted with DecryptMessage or DecryptStream. Messages of the AES encryption types are encrypted as they
+// are read so that large messages, such as files wrapped for a GSS-API context, are not held in memory; those of other
+// encryption types are read in full before they are encrypted.
+// The number of bytes written to w is returned.
+func EncryptStream(w io.Writer, r io.Reader, key types.EncryptionKey, usage uint32) (int64, error) {
+	et, err := GetEtype(key.KeyType)
+	if err != nil {
+		return 0, fmt.Errorf("error encrypting: %v", err)
+	}
+	s, ok, err := newAESStream(et, key, usage)
+	if err != nil {
+		return 0, fmt.Errorf("error encrypting: %v", err)
+	}
+	if !ok {
+		m, err := ioutil.ReadAll(r)
+		if err != nil {
+			return 0, err
+		}
+		_, b, err := et.EncryptMessage(key.KeyValue, m, usage)
+		if err != nil {
+			return 0, fmt.Errorf("error encrypting: %v", err)
+		}
+		n, err := w.Write(b)
+		return int64(n), err
+	}
+	return s.encrypt(w, r)
+}
+
+// DecryptStream decrypts the encrypted message read from r with the key for the key usage provided, writing the
+// message to w. Messages of the AES encryption types are decrypted as they are read so that large messages are not
+// held in memory; those of other encryption types are read in full before they are decrypted.
+// The integrity of a message can only be verified once it has been read in full, so the output written to w must not
+// be used unless DecryptStream returns without error.
+// The number of bytes written to w is returned.
+func DecryptStream(w io.Writer, r io.Reader, key types.EncryptionKey, usage uint32) (int64, error) {
+	et, err := GetEtype(key.KeyType)
+	if err != nil {
+		return 0, fmt.Errorf("error decrypting: %v", err)
+	}
+	s, ok, err := newAESStream(et, key, usage)
+	if err != nil {
+		return 0, fmt.Errorf("error decrypting: %v", err)
+	}
+	if !ok {
+		ct, err := ioutil.ReadAll(r)
+		if err != nil {
+			return 0, err
+		}
+		b, err := et.DecryptMessage(key.KeyValue, ct, usage)
+		if err != nil {
+			return 0, fmt.Errorf("error decrypting: %v", err)
+		}
+		n, err := w.Write(b)
+		return int64(n), err
+	}
+	return s.decrypt(w, r)
+}
+
+// aesStream encrypts or decrypts a message of an AES encryption type in CBC mode with ciphertext stealing (CTS).
+// All but the last two blocks are processed as plain CBC as they are read, the last two with ciphertext stealing once
+// the end of the message is reached.
+type aesStream struct {
+	et    etype.EType
+	key   []byte
+	block cipher.Block
+	iv    []byte
+	mac   hash.Hash
+	// macCiphertext is set for the encryption types of RFC 8009, whose integrity hash is of the ciphertext rather than
+	// the plaintext.
+	macCiphertext bool
+}
+
+// newAESStream returns an aesStream for the key if its encryption type is one of the AES types.
+func newAESStream(et etype.EType, key types.EncryptionKey, usage uint32) (*aesStream, bool, error) {
+	var macCiphertext bool
+	switch et.(type) {
+	case Aes128CtsHmacSha96, Aes256CtsHmacSha96:
+	case Aes128CtsHmacSha256128, Aes256CtsHmacSha384192:
+		macCiphertext = true
+	default:
+		return nil, false, nil
+	}
+	ke, err := et.DeriveKey(key.KeyValue, common.GetUsageKe(usage))
+	if err != nil {
+		return nil, true, fmt.Errorf("error deriving key for encryption: %v", err)
+	}
+	ki, err := et.DeriveKey(key.KeyValue, common.GetUsageKi(usage))
+	if err != nil {
+		return nil, true, fmt.Errorf("error deriving key for integrity: %v", err)
+	}
+	block, err := aes.NewCipher(ke)
+	if err != nil {
+		return nil, true, fmt.Errorf("error creating cipher: %v", err)
+	}
+	s := &aesStream{
+		et:            et,
+		key:           ke,
+		block:         block,
+		iv:            make([]byte, aes.BlockSize),
+		mac:           hmac.New(et.GetHashFunc(), ki),
+		macCiphertext: macCiphertext,
+	}
+	if macCiphertext {
+		// The hash is of the cipher state, which is zero, concatenated with the ciphertext
+		s.mac.Write(make([]byte, aes.BlockSize))
+	}
+	return s, true, nil
+}
+
+// decryptTail decrypts the last two blocks of a message, ct, of between one and two blocks in length, with ciphertext
+// stealing. The decryption of aescts is not used as it only handles a zero initial vector.
+func (s *aesStream) decryptTail(ct []byte) []byte {
+	pt := make([]byte, len(ct))
+	if len(ct) == aes.BlockSize {
+		cipher.NewCBCDecrypter(s.block, s.iv).CryptBlocks(pt, ct)
+		return pt
+	}
+	// The penultimate ciphertext block decrypts to the last plaintext block XORed with the zero padded last ciphertext
+	// block. The padding stolen from it completes the last ciphertext block, which decrypts to the penultimate plaintext.
+	lbs := len(ct) - aes.BlockSize
+	d := make([]byte, aes.BlockSize)
+	s.block.Decrypt(d, ct[:aes.BlockSize])
+	for i := 0; i < lbs; i++ {
+		pt[aes.BlockSize+i] = d[i] ^ ct[aes.BlockSize+i]
+	}
+	c := make([]byte, aes.BlockSize)
+	copy(c, ct[aes.BlockSize:])
+	copy(c[lbs:], d[lbs:])
+	s.block.Decrypt(pt[:aes.BlockSize], c)
+	for i := 0; i < aes.BlockSize; i++ {
+		pt[i] ^= s.iv[i]
+	}
+	return pt
+}
+
+// cbcBlocks returns the length of the bytes at the start of b that can be processed as plain CBC, leaving more than
+// one block for ciphertext stealing. trailer is the length of the bytes at the end of b that are not to be processed.
+func cbcBlocks(b []byte, trailer int) int {
+	l := len(b) - trailer
+	if l <= 2*aes.BlockSize {
+		return 0
+	}
+	return (l - aes.BlockSize - 1) / aes.BlockSize * aes.BlockSize
+}
+
+func (s *aesStream) encrypt(w io.Writer, r io.Reader) (int64, error) {
+	// The message is prefixed with a random confounder
+	p := make([]byte, s.et.GetConfounderByteSize(), streamChunkSize+2*aes.BlockSize)
+	if _, err := rand.Read(p); err != nil {
+		return 0, fmt.Errorf("could not generate random confounder: %v", err)
+	}
+	if !s.macCiphertext {
+		s.mac.Write(p)
+	}
+	mode := cipher.NewCBCEncrypter(s.block, s.iv)
+	var written int64
+	write := func(ct []byte) error {
+		if s.macCiphertext {
+			s.mac.Write(ct)
+		}
+		n, err := w.Write(ct)
+		written += int64(n)
+		return err
+	}
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			if !s.macCiphertext {
+				s.mac.Write(buf[:n])
+			}
+			p = append(p, buf[:n]...)
+			if l := cbcBlocks(p, 0); l > 0 {
+				ct := make([]byte, l)
+				mode.CryptBlocks(ct, p[:l])
+				copy(s.iv, ct[l-aes.BlockSize:])
+				if err := write(ct); err != nil {
+					return written, err
+				}
+				p = append(p[:0], p[l:]...)
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+	_, ct, err := aescts.Encrypt(s.key, s.iv, p)
+	if err != nil {
+		return written, fmt.Errorf("error encrypting data: %v", err)
+	}
+	if err := write(ct); err != nil {
+		return written, err
+	}
+	n, err := w.Write(s.mac.Sum(nil)[:s.et.GetHMACBitLength()/8])
+	written += int64(n)
+	return written, err
+}
+
+func (s *aesStream) decrypt(w io.Writer, r io.Reader) (int64, error) {
+	hl := s.et.GetHMACBitLength() / 8
+	// The confounder at the start of the message is discarded
+	skip := s.et.GetConfounderByteSize()
+	mode := cipher.NewCBCDecrypter(s.block, s.iv)
+	var written int64
+	write := func(pt []byte) error {
+		if !s.macCiphertext {
+			s.mac.Write(pt)
+		}
+		if skip > 0 {
+			n := skip
+			if n > len(pt) {
+				n = len(pt)
+			}
+			pt = pt[n:]
+			skip -= n
+		}
+		n, err := w.Write(pt)
+		written += int64(n)
+		return err
+	}
+	c := make([]byte, 0, streamChunkSize+2*aes.BlockSize+hl)
+	buf := make([]byte, streamChunkSize)
+	for {
+		n, rerr := r.Read(buf)
+		if n > 0 {
+			c = append(c, buf[:n]...)
+			// The integrity hash at the end of the message is held back from decryption
+			if l := cbcBlocks(c, hl); l > 0 {
+				if s.macCiphertext {
+					s.mac.Write(c[:l])
+				}
+				pt := make([]byte, l)
+				copy(s.iv, c[l-aes.BlockSize:l])
+				mode.CryptBlocks(pt, c[:l])
+				if err := write(pt); err != nil {
+					return written, err
+				}
+				c = append(c[:0], c[l:]...)
+			}
+		}
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			return written, rerr
+		}
+	}
+	if len(c) < aes.BlockSize+hl {
+		return written, errors.New("error decrypting: encrypted message is too short")
+	}
+	ct, h := c[:len(c)-hl], c[len(c)-hl:]
+	if s.macCiphertext {
+		s.mac.Write(ct)
+	}
+	if err := write(s.decryptTail(ct)); err != nil {
+		return written, err
+	}
+	if !hmac.Equal(h, s.mac.Sum(nil)[:hl]) {
+		return written, errors.New("error decrypting: integrity verification failed")
+	}
+	return written, nil
+}
@@ -0,0 +1,79 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+	"testing/iotest"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryptDecryptStream(t *testing.T) {
+	t.Parallel()
+	etypes := []int32{
+		etypeID.AES128_CTS_HMAC_SHA1_96,
+		etypeID.AES256_CTS_HMAC_SHA1_96,
+		etypeID.AES128_CTS_HMAC_SHA256_128,
+		etypeID.AES256_CTS_HMAC_SHA384_192,
+		etypeID.DES3_CBC_SHA1_KD,
+		etypeID.RC4_HMAC,
+	}
+	lengths := []int{0, 1, 15, 16, 17, 31, 32, 33, 100, 70000}
+	for _, id := range etypes {
+		et, err := GetEtype(id)
+		if err != nil {
+			t.Fatalf("error getting etype %d: %v", id, err)
+		}
+		key, err := types.GenerateEncryptionKey(et)
+		if err != nil {
+			t.Fatalf("error generating key for etype %d: %v", id, err)
+		}
+		for _, l := range lengths {
+			m := make([]byte, l)
+			for i := range m {
+				m[i] = byte(i)
+			}
+
+			// Stream encrypted messages decrypt with DecryptMessage
+			var ct bytes.Buffer
+			n, err := EncryptStream(&ct, iotest.OneByteReader(bytes.NewReader(m)), key, 2)
+			if err != nil {
+				t.Fatalf("error encrypting stream of length %d with etype %d: %v", l, id, err)
+			}
+			assert.Equal(t, int64(ct.Len()), n, "bytes written not as expected for etype %d length %d", id, l)
+			pt, err := DecryptMessage(ct.Bytes(), key, 2)
+			if err != nil {
+				t.Fatalf("error decrypting streamed message of length %d with etype %d: %v", l, id, err)
+			}
+			assert.True(t, bytes.Equal(m, pt[:len(m)]), "decrypted message not as expected for etype %d length %d", id, l)
+
+			// Messages from EncryptMessage decrypt as streams
+			ed, err := GetEncryptedData(m, key, 2, 1)
+			if err != nil {
+				t.Fatalf("error encrypting message of length %d with etype %d: %v", l, id, err)
+			}
+			b := ed.Cipher
+			for _, oneByte := range []bool{false, true} {
+				var out bytes.Buffer
+				r := bytes.NewReader(b)
+				var err error
+				if oneByte {
+					_, err = DecryptStream(&out, iotest.OneByteReader(r), key, 2)
+				} else {
+					_, err = DecryptStream(&out, r, key, 2)
+				}
+				if err != nil {
+					t.Fatalf("error decrypting stream of length %d with etype %d: %v", l, id, err)
+				}
+				assert.True(t, bytes.Equal(m, out.Bytes()[:len(m)]), "stream decrypted message not as expected for etype %d length %d", id, l)
+			}
+
+			// Tampered messages fail integrity verification
+			b[len(b)-1] ^= 0xff
+			_, err = DecryptStream(new(bytes.Buffer), bytes.NewReader(b), key, 2)
+			assert.Error(t, err, "tampered message should not decrypt for etype %d length %d", id, l)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package crypto
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecryptMessage_Tampered(t *testing.T) {
+	t.Parallel()
+	etypes := []int32{
+		etypeID.AES128_CTS_HMAC_SHA1_96,
+		etypeID.AES256_CTS_HMAC_SHA1_96,
+		etypeID.AES128_CTS_HMAC_SHA256_128,
+		etypeID.AES256_CTS_HMAC_SHA384_192,
+		etypeID.DES3_CBC_SHA1_KD,
+		etypeID.RC4_HMAC,
+	}
+	for _, id := range etypes {
+		et, err := GetEtype(id)
+		if err != nil {
+			t.Fatalf("error getting etype %d: %v", id, err)
+		}
+		key, err := types.GenerateEncryptionKey(et)
+		if err != nil {
+			t.Fatalf("error generating key for etype %d: %v", id, err)
+		}
+		ed, err := GetEncryptedData([]byte("a message whose integrity is verified"), key, 3, 1)
+		if err != nil {
+			t.Fatalf("error encrypting with etype %d: %v", id, err)
+		}
+
+		// A change to any byte fails in the same way, wherever it is, so that a mismatch is not revealed to be early or
+		// late in the integrity hash
+		var errText string
+		for i := range ed.Cipher {
+			b := append([]byte(nil), ed.Cipher...)
+			b[i] ^= 0x01
+			_, err := DecryptMessage(b, key, 3)
+			if !assert.Error(t, err, "tampered byte %d not detected for etype %d", i, id) {
+				continue
+			}
+			if errText == "" {
+				errText = err.Error()
+			}
+			assert.Equal(t, errText, err.Error(), "error for tampered byte %d differs for etype %d", i, id)
+		}
+
+		// Truncated messages are rejected rather than causing a panic
+		for l := 0; l < len(ed.Cipher); l++ {
+			_, err := DecryptMessage(ed.Cipher[:l], key, 3)
+			assert.Error(t, err, "truncated message of length %d not rejected for etype %d", l, id)
+		}
+		assert.False(t, et.VerifyIntegrity(key.KeyValue, nil, nil, 3), "empty message should not verify for etype %d", id)
+	}
+}
+
+func TestVerifyChecksum_Truncated(t *testing.T) {
+	t.Parallel()
+	etypes := []int32{
+		etypeID.AES128_CTS_HMAC_SHA1_96,
+		etypeID.AES256_CTS_HMAC_SHA1_96,
+		etypeID.AES128_CTS_HMAC_SHA256_128,
+		etypeID.AES256_CTS_HMAC_SHA384_192,
+		etypeID.DES3_CBC_SHA1_KD,
+		etypeID.RC4_HMAC,
+	}
+	m := []byte("a message whose checksum is verified")
+	for _, id := range etypes {
+		et, err := GetEtype(id)
+		if err != nil {
+			t.Fatalf("error getting etype %d: %v", id, err)
+		}
+		key, err := types.GenerateEncryptionKey(et)
+		if err != nil {
+			t.Fatalf("error generating key for etype %d: %v", id, err)
+		}
+		cb, err := et.GetChecksumHash(key.KeyValue, m, 6)
+		if err != nil {
+			t.Fatalf("error getting checksum for etype %d: %v", id, err)
+		}
+		assert.True(t, et.VerifyChecksum(key.KeyValue, m, cb, 6), "checksum not valid for etype %d", id)
+		// A comparison that stops at the end of the shorter input would accept a prefix of the checksum
+		for l := 0; l < len(cb); l++ {
+			assert.False(t, et.VerifyChecksum(key.KeyValue, m, cb[:l], 6), "checksum truncated to %d bytes accepted for etype %d", l, id)
+		}
+		b := append([]byte(nil), cb...)
+		b[len(b)-1] ^= 0x01
+		assert.False(t, et.VerifyChecksum(key.KeyValue, m, b, 6), "checksum with last byte changed accepted for etype %d", id)
+	}
+}
+
+// TestVerify_ConstantTimeComparison checks that the verification functions of the crypto packages compare integrity
+// hashes and checksums in constant time, with hmac.Equal or crypto/subtle, or delegate to a function that does, and
+// never with a comparison that returns at the first differing byte.
+func TestVerify_ConstantTimeComparison(t *testing.T) {
+	t.Parallel()
+	variableTime := map[string]bool{"bytes.Equal": true, "bytes.Compare": true, "reflect.DeepEqual": true}
+	constantTime := map[string]bool{"hmac.Equal": true, "subtle.ConstantTimeCompare": true}
+	var verifiers int
+	err := filepath.Walk(".", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return err
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+		if err != nil {
+			return err
+		}
+		for _, d := range f.Decls {
+			fn, ok := d.(*ast.FuncDecl)
+			if !ok || fn.Body == nil || !strings.HasPrefix(fn.Name.Name, "Verify") {
+				continue
+			}
+			verifiers++
+			var compared bool
+			ast.Inspect(fn.Body, func(n ast.Node) bool {
+				switch x := n.(type) {
+				case *ast.CallExpr:
+					sel, ok := x.Fun.(*ast.SelectorExpr)
+					if !ok {
+						return true
+					}
+					name := sel.Sel.Name
+					if id, ok := sel.X.(*ast.Ident); ok {
+						name = id.Name + "." + name
+					}
+					assert.False(t, variableTime[name], "%s %s compares with %s", path, fn.Name.Name, name)
+					if constantTime[name] || strings.HasPrefix(sel.Sel.Name, "Verify") {
+						compared = true
+					}
+				case *ast.BinaryExpr:
+					if x.Op == token.EQL || x.Op == token.NEQ {
+						_, lx := x.X.(*ast.IndexExpr)
+						_, ly := x.Y.(*ast.IndexExpr)
+						assert.False(t, lx || ly, "%s %s compares bytes individually", path, fn.Name.Name)
+					}
+				}
+				return true
+			})
+			assert.True(t, compared, "%s %s does not compare in constant time", path, fn.Name.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("error parsing crypto packages: %v", err)
+	}
+	assert.NotZero(t, verifiers, "no verification functions found")
+}
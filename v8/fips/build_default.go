@@ -0,0 +1,7 @@
+//go:build !fips
+// +build !fips
+
+package fips
+
+// buildEnabled leaves FIPS mode disabled until SetEnabled is called as the fips build tag is not set.
+const buildEnabled = false
@@ -0,0 +1,7 @@
+//go:build fips
+// +build fips
+
+package fips
+
+// buildEnabled enables FIPS mode from the start as the fips build tag is set.
+const buildEnabled = true
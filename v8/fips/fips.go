@@ -0,0 +1,74 @@
+// Package fips provides the FIPS mode switch, which restricts gokrb5 to FIPS approved cryptographic primitives.
+//
+// In FIPS mode only the AES encryption types with SHA-2 integrity of RFC 8009, aes256-cts-hmac-sha384-192 and
+// aes128-cts-hmac-sha256-128, and their checksum types may be used. The RC4-HMAC, DES, triple DES and
+// AES-SHA1 encryption types, and the MD4 and MD5 based checksums such as that of PA-FOR-USER, are refused with an
+// error rather than used.
+//
+// FIPS mode is enabled by building with the fips build tag, or at runtime with SetEnabled.
+package fips
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/Osirium/gokrb5/v8/iana/chksumtype"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+)
+
+var enabled int32
+
+func init() {
+	if buildEnabled {
+		enabled = 1
+	}
+}
+
+// Enabled indicates if FIPS mode is enabled.
+func Enabled() bool {
+	return atomic.LoadInt32(&enabled) == 1
+}
+
+// SetEnabled enables or disables FIPS mode. It should be called before any configuration is loaded or client or
+// service created.
+func SetEnabled(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&enabled, v)
+}
+
+// ApprovedEType indicates if the encryption type is FIPS approved.
+func ApprovedEType(etype int32) bool {
+	switch etype {
+	case etypeID.AES256_CTS_HMAC_SHA384_192, etypeID.AES128_CTS_HMAC_SHA256_128:
+		return true
+	}
+	return false
+}
+
+// ApprovedChksumType indicates if the checksum type is FIPS approved.
+func ApprovedChksumType(cksumtype int32) bool {
+	switch cksumtype {
+	case chksumtype.HMAC_SHA384_192_AES256, chksumtype.HMAC_SHA256_128_AES128:
+		return true
+	}
+	return false
+}
+
+// CheckEType returns an error if FIPS mode is enabled and the encryption type is not FIPS approved.
+func CheckEType(etype int32) error {
+	if Enabled() && !ApprovedEType(etype) {
+		return fmt.Errorf("encryption type %s (%d) is not permitted in FIPS mode", etypeID.ETypeNames[etype], etype)
+	}
+	return nil
+}
+
+// CheckChksumType returns an error if FIPS mode is enabled and the checksum type is not FIPS approved.
+func CheckChksumType(cksumtype int32) error {
+	if Enabled() && !ApprovedChksumType(cksumtype) {
+		return fmt.Errorf("checksum type %d is not permitted in FIPS mode", cksumtype)
+	}
+	return nil
+}
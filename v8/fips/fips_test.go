@@ -0,0 +1,62 @@
+package fips_test
+
+import (
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/fips"
+	"github.com/Osirium/gokrb5/v8/iana/chksumtype"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFIPSMode is not run in parallel as it switches FIPS mode, which is global.
+func TestFIPSMode(t *testing.T) {
+	fips.SetEnabled(true)
+	defer fips.SetEnabled(false)
+	assert.True(t, fips.Enabled(), "FIPS mode not enabled")
+
+	for _, id := range []int32{etypeID.AES256_CTS_HMAC_SHA384_192, etypeID.AES128_CTS_HMAC_SHA256_128} {
+		_, err := crypto.GetEtype(id)
+		assert.NoError(t, err, "approved etype %d should be available in FIPS mode", id)
+	}
+	for _, id := range []int32{etypeID.RC4_HMAC, etypeID.DES3_CBC_SHA1_KD, etypeID.AES256_CTS_HMAC_SHA1_96} {
+		_, err := crypto.GetEtype(id)
+		assert.Error(t, err, "etype %d should not be available in FIPS mode", id)
+	}
+	_, err := crypto.GetChksumEtype(chksumtype.KERB_CHECKSUM_HMAC_MD5)
+	assert.Error(t, err, "HMAC-MD5 checksum should not be available in FIPS mode")
+	_, err = crypto.GetChksumEtype(chksumtype.HMAC_SHA384_192_AES256)
+	assert.NoError(t, err, "approved checksum type should be available in FIPS mode")
+
+	_, err = messages.NewPAForUser(types.NewPrincipalName(1, "user"), "TEST.GOKRB5", types.EncryptionKey{KeyType: etypeID.RC4_HMAC, KeyValue: make([]byte, 16)})
+	assert.Error(t, err, "PA-FOR-USER should not be created in FIPS mode")
+
+	p := config.DefaultETypePolicy()
+	assert.False(t, p.Permits(etypeID.AES256_CTS_HMAC_SHA1_96), "AES-SHA1 should not be permitted in FIPS mode")
+	assert.True(t, p.Permits(etypeID.AES256_CTS_HMAC_SHA384_192), "AES-SHA2 should be permitted in FIPS mode")
+
+	c, err := config.NewFromString(`[libdefaults]
+ default_tkt_enctypes = aes256-cts-hmac-sha1-96 aes256-cts-hmac-sha384-192
+`)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	assert.Equal(t, []int32{etypeID.AES256_CTS_HMAC_SHA384_192}, c.LibDefaults.DefaultTktEnctypeIDs, "unapproved etypes not removed")
+
+	_, err = config.NewFromString(`[libdefaults]
+ default_tkt_enctypes = aes256-cts-hmac-sha1-96 rc4-hmac
+`)
+	assert.Error(t, err, "config requiring unapproved etypes should not load in FIPS mode")
+	_, err = config.NewFromString(`[libdefaults]
+ allow_weak_crypto = true
+`)
+	assert.Error(t, err, "config allowing weak crypto should not load in FIPS mode")
+
+	fips.SetEnabled(false)
+	_, err = crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.NoError(t, err, "etype should be available with FIPS mode disabled")
+}
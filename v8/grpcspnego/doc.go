@@ -0,0 +1,3 @@
+// Package grpcspnego provides gRPC server interceptors that authenticate calls with the Negotiate tokens sent by
+// spnego.GRPCCredentials. It is a separate module so that gokrb5 does not depend on gRPC.
+package grpcspnego
@@ -0,0 +1,62 @@
+package grpcspnego
+
+import (
+	"context"
+
+	"github.com/Osirium/gokrb5/v8/spnego"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// spnego.GRPCCredentials is passed to grpc.WithPerRPCCredentials to send a Negotiate token with each call.
+var _ credentials.PerRPCCredentials = (*spnego.GRPCCredentials)(nil)
+
+// UnaryServerInterceptor returns a unary server interceptor that verifies the Negotiate token of each call with the
+// authenticator provided. Calls without a valid token fail with codes.Unauthenticated. The handler's context holds
+// the Identity of the authenticated user, available from spnego.IdentityFromContext.
+func UnaryServerInterceptor(a *spnego.GRPCAuthenticator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, a)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a stream server interceptor that verifies the Negotiate token of each stream with
+// the authenticator provided, as UnaryServerInterceptor does for unary calls. The context of the stream passed to the
+// handler holds the Identity of the authenticated user.
+func StreamServerInterceptor(a *spnego.GRPCAuthenticator) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), a)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authenticatedStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authenticate verifies the Negotiate token in the incoming metadata of the call's context.
+func authenticate(ctx context.Context, a *spnego.GRPCAuthenticator) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	ctx, err := a.Authenticate(ctx, md.Get(spnego.GRPCMetadataAuth))
+	if err != nil {
+		return ctx, status.Error(codes.Unauthenticated, err.Error())
+	}
+	return ctx, nil
+}
+
+// authenticatedStream is a server stream whose context holds the Identity of the authenticated user.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context returns the context of the stream.
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
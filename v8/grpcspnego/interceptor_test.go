@@ -0,0 +1,144 @@
+package grpcspnego
+
+import (
+	"context"
+	"encoding/hex"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/client"
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/spnego"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// identityServer is a health service that reports the authenticated user of each call as its service name.
+type identityServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (s *identityServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if _, ok := spnego.IdentityFromContext(ctx); !ok {
+		return nil, status.Error(codes.Internal, "no identity in the context")
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *identityServer) Watch(req *healthpb.HealthCheckRequest, stream healthpb.Health_WatchServer) error {
+	if _, ok := spnego.IdentityFromContext(stream.Context()); !ok {
+		return status.Error(codes.Internal, "no identity in the stream context")
+	}
+	return stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING})
+}
+
+// newTestClient returns a client holding a ticket to HTTP/host.test.gokrb5 and the keytab of the service.
+func newTestClient(t *testing.T) (*client.Client, *keytab.Keytab) {
+	t.Helper()
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	if err := kt.Unmarshal(b); err != nil {
+		t.Fatalf("error loading keytab: %v", err)
+	}
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	st := time.Now().UTC()
+	tkt, key, err := messages.NewTicket(cname, "TEST.GOKRB5", sname, "TEST.GOKRB5", types.NewKrbFlags(), kt, 18, 1,
+		st, st, st.Add(time.Hour), st.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating ticket: %v", err)
+	}
+	tgt := messages.Ticket{
+		TktVNO: 5,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+	}
+	cred := messages.KRBCred{Tickets: []messages.Ticket{tgt, tkt}}
+	cred.DecryptedEncPart.TicketInfo = []messages.KrbCredInfo{
+		{Key: key, PRealm: "TEST.GOKRB5", PName: cname, AuthTime: st, StartTime: st, EndTime: st.Add(time.Hour),
+			SRealm: tgt.Realm, SName: tgt.SName},
+		{Key: key, PRealm: "TEST.GOKRB5", PName: cname, AuthTime: st, StartTime: st, EndTime: st.Add(time.Hour),
+			SRealm: tkt.Realm, SName: tkt.SName},
+	}
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	cl, err := client.NewFromKRBCred(cred, c)
+	if err != nil {
+		t.Fatalf("error creating client: %v", err)
+	}
+	return cl, kt
+}
+
+// newTestConn returns a connection to a health service authenticating calls with the interceptors.
+func newTestConn(t *testing.T, kt *keytab.Keytab, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+	auth := spnego.NewGRPCAuthenticator(kt)
+	s := grpc.NewServer(grpc.UnaryInterceptor(UnaryServerInterceptor(auth)), grpc.StreamInterceptor(StreamServerInterceptor(auth)))
+	healthpb.RegisterHealthServer(s, &identityServer{})
+	l := bufconn.Listen(1024 * 1024)
+	go s.Serve(l)
+	t.Cleanup(s.Stop)
+	opts = append(opts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.NewClient("passthrough:///host.test.gokrb5", opts...)
+	if err != nil {
+		t.Fatalf("error creating connection: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestServerInterceptors(t *testing.T) {
+	t.Parallel()
+	cl, kt := newTestClient(t)
+	creds := spnego.NewGRPCCredentials(cl, "HTTP/host.test.gokrb5").AllowInsecure()
+	hc := healthpb.NewHealthClient(newTestConn(t, kt, grpc.WithPerRPCCredentials(creds)))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Each call is authenticated with a new token
+	for i := 0; i < 2; i++ {
+		resp, err := hc.Check(ctx, &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("error making unary call: %v", err)
+		}
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status, "unary response not as expected")
+	}
+
+	stream, err := hc.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("error making streaming call: %v", err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("error receiving from stream: %v", err)
+	}
+	assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.Status, "stream response not as expected")
+}
+
+func TestServerInterceptors_Unauthenticated(t *testing.T) {
+	t.Parallel()
+	_, kt := newTestClient(t)
+	hc := healthpb.NewHealthClient(newTestConn(t, kt))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := hc.Check(ctx, &healthpb.HealthCheckRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "unary call without a token should be unauthenticated")
+	stream, err := hc.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err == nil {
+		_, err = stream.Recv()
+	}
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "stream without a token should be unauthenticated")
+}
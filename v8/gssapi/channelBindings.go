@@ -0,0 +1,63 @@
+package gssapi
+
+import (
+	"crypto"
+	"crypto/md5"
+	_ "crypto/sha256" // register the hashes of certificate signature algorithms
+	_ "crypto/sha512"
+	"crypto/x509"
+	"encoding/binary"
+)
+
+// RFC 2743, section 1.1.6 and RFC 4121, section 4.1.1.2
+
+// tlsServerEndPointPrefix prefixes the certificate hash of tls-server-end-point channel bindings (RFC 5929).
+const tlsServerEndPointPrefix = "tls-server-end-point:"
+
+// ChannelBindings bind a security context to the communications channel it is established over, such as a TLS
+// connection, so that a context established by a man-in-the-middle over another channel is rejected.
+// Address types are the GSS-API address family values; applications generally only provide ApplicationData.
+type ChannelBindings struct {
+	InitiatorAddrType uint32
+	InitiatorAddress  []byte
+	AcceptorAddrType  uint32
+	AcceptorAddress   []byte
+	ApplicationData   []byte
+}
+
+// NewTLSServerEndPointBindings returns the tls-server-end-point channel bindings of RFC 5929 for the certificate of a
+// TLS server, as used for Extended Protection for Authentication by Microsoft services.
+func NewTLSServerEndPointBindings(cert *x509.Certificate) ChannelBindings {
+	// The hash is that of the certificate signature algorithm, SHA-256 replacing MD5 and SHA-1
+	h := crypto.SHA256
+	switch cert.SignatureAlgorithm {
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384, x509.SHA384WithRSAPSS:
+		h = crypto.SHA384
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512, x509.SHA512WithRSAPSS:
+		h = crypto.SHA512
+	}
+	d := h.New()
+	d.Write(cert.Raw)
+	return ChannelBindings{ApplicationData: append([]byte(tlsServerEndPointPrefix), d.Sum(nil)...)}
+}
+
+// Hash returns the MD5 hash of the channel bindings carried in the Bnd field of the Kerberos authenticator checksum.
+func (c ChannelBindings) Hash() []byte {
+	var b []byte
+	b = appendUint32LE(b, c.InitiatorAddrType)
+	b = appendUint32LE(b, uint32(len(c.InitiatorAddress)))
+	b = append(b, c.InitiatorAddress...)
+	b = appendUint32LE(b, c.AcceptorAddrType)
+	b = appendUint32LE(b, uint32(len(c.AcceptorAddress)))
+	b = append(b, c.AcceptorAddress...)
+	b = appendUint32LE(b, uint32(len(c.ApplicationData)))
+	b = append(b, c.ApplicationData...)
+	h := md5.Sum(b)
+	return h[:]
+}
+
+func appendUint32LE(b []byte, v uint32) []byte {
+	var x [4]byte
+	binary.LittleEndian.PutUint32(x[:], v)
+	return append(b, x[:]...)
+}
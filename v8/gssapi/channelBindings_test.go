@@ -0,0 +1,75 @@
+package gssapi
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelBindings_Hash(t *testing.T) {
+	t.Parallel()
+	// Without bindings each of the five length and type fields is zero
+	want := md5.Sum(make([]byte, 20))
+	assert.Equal(t, want[:], ChannelBindings{}.Hash(), "hash of empty channel bindings not as expected")
+
+	cb := ChannelBindings{
+		InitiatorAddrType: 2,
+		InitiatorAddress:  []byte{127, 0, 0, 1},
+		AcceptorAddrType:  2,
+		AcceptorAddress:   []byte{10, 0, 0, 1},
+		ApplicationData:   []byte("data"),
+	}
+	b := []byte{
+		2, 0, 0, 0, 4, 0, 0, 0, 127, 0, 0, 1,
+		2, 0, 0, 0, 4, 0, 0, 0, 10, 0, 0, 1,
+		4, 0, 0, 0, 'd', 'a', 't', 'a',
+	}
+	want = md5.Sum(b)
+	assert.Equal(t, want[:], cb.Hash(), "hash of channel bindings not as expected")
+}
+
+func TestNewTLSServerEndPointBindings(t *testing.T) {
+	t.Parallel()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	for _, test := range []struct {
+		alg  x509.SignatureAlgorithm
+		hash func([]byte) []byte
+	}{
+		{x509.ECDSAWithSHA1, func(b []byte) []byte { h := sha256.Sum256(b); return h[:] }},
+		{x509.ECDSAWithSHA256, func(b []byte) []byte { h := sha256.Sum256(b); return h[:] }},
+		{x509.ECDSAWithSHA384, func(b []byte) []byte { h := sha512.Sum384(b); return h[:] }},
+		{x509.ECDSAWithSHA512, func(b []byte) []byte { h := sha512.Sum512(b); return h[:] }},
+	} {
+		tmpl := &x509.Certificate{
+			SerialNumber:       big.NewInt(1),
+			Subject:            pkix.Name{CommonName: "host.test.gokrb5"},
+			NotBefore:          time.Now(),
+			NotAfter:           time.Now().Add(time.Hour),
+			SignatureAlgorithm: test.alg,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+		if err != nil {
+			t.Fatalf("error creating certificate: %v", err)
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			t.Fatalf("error parsing certificate: %v", err)
+		}
+		cb := NewTLSServerEndPointBindings(cert)
+		want := append([]byte("tls-server-end-point:"), test.hash(der)...)
+		assert.Equal(t, want, cb.ApplicationData, "application data not as expected for %v", test.alg)
+	}
+}
@@ -0,0 +1,360 @@
+package gssapi
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/crypto/etype"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// RFC 4121, section 4.2
+
+// Wrap token flags.
+const (
+	// WrapTokenFlagSentByAcceptor indicates the sender is the context acceptor.
+	WrapTokenFlagSentByAcceptor = MICTokenFlagSentByAcceptor
+	// WrapTokenFlagSealed indicates the payload is encrypted for confidentiality.
+	WrapTokenFlagSealed = MICTokenFlagSealed
+	// WrapTokenFlagAcceptorSubkey indicates a subkey asserted by the context acceptor protects the token.
+	WrapTokenFlagAcceptorSubkey = MICTokenFlagAcceptorSubkey
+)
+
+// ContextKeys are the keys of an established security context.
+// Subkeys that were not asserted are left as the zero EncryptionKey.
+type ContextKeys struct {
+	// SessionKey is the session key of the service ticket.
+	SessionKey types.EncryptionKey
+	// InitiatorSubkey is the subkey of the initiator's AP_REQ authenticator.
+	InitiatorSubkey types.EncryptionKey
+	// AcceptorSubkey is the subkey of the acceptor's AP_REP.
+	AcceptorSubkey types.EncryptionKey
+}
+
+// SecurityContext is an established security context of the Kerberos mechanism. It protects application messages
+// with the per-message tokens of RFC 4121: Wrap tokens, which carry a message with integrity protection and
+// optionally confidentiality, and MIC tokens, which carry the checksum of a message sent separately.
+// A SecurityContext is safe for concurrent use.
+type SecurityContext struct {
+	initiator bool
+	flags     int
+	keys      ContextKeys
+	endTime   time.Time
+
+	mu         sync.Mutex
+	sendSeqNum uint64
+	recv       seqState
+	seqPolicy  SequencePolicy
+	exported   bool
+}
+
+// NewSecurityContext returns the security context of the initiator, or of the acceptor if initiator is false,
+// established with the keys provided. flags are the ContextFlag values of the context and sendSeqNum and recvSeqNum
+// the initial sequence numbers of the tokens sent and received.
+// Tokens received are checked for replays if ContextFlagReplay is set, and for being out of sequence if
+// ContextFlagSequence is set. SetSequencePolicy overrides this.
+func NewSecurityContext(initiator bool, flags int, keys ContextKeys, sendSeqNum, recvSeqNum uint64) *SecurityContext {
+	return &SecurityContext{
+		initiator:  initiator,
+		flags:      flags,
+		keys:       keys,
+		sendSeqNum: sendSeqNum,
+		recv:       newSeqState(recvSeqNum),
+		seqPolicy: SequencePolicy{
+			RejectReplays:       flags&ContextFlagReplay != 0,
+			RejectOutOfSequence: flags&ContextFlagSequence != 0,
+		},
+	}
+}
+
+// Initiator indicates if the security context is that of the initiator.
+func (c *SecurityContext) Initiator() bool {
+	return c.initiator
+}
+
+// Flags returns the ContextFlag values of the security context.
+func (c *SecurityContext) Flags() int {
+	return c.flags
+}
+
+// Keys returns the keys of the security context.
+func (c *SecurityContext) Keys() ContextKeys {
+	return c.keys
+}
+
+// EndTime returns the time the security context expires, that of the ticket it was established with. It is the zero
+// time if not known.
+func (c *SecurityContext) EndTime() time.Time {
+	return c.endTime
+}
+
+// SetEndTime sets the time the security context expires.
+func (c *SecurityContext) SetEndTime(t time.Time) {
+	c.endTime = t
+}
+
+// key returns the key protecting the tokens of the context: the acceptor subkey if there is one, otherwise the
+// initiator subkey or the session key.
+func (c *SecurityContext) key() (types.EncryptionKey, bool) {
+	if len(c.keys.AcceptorSubkey.KeyValue) > 0 {
+		return c.keys.AcceptorSubkey, true
+	}
+	if len(c.keys.InitiatorSubkey.KeyValue) > 0 {
+		return c.keys.InitiatorSubkey, false
+	}
+	return c.keys.SessionKey, false
+}
+
+// tokenEtype returns the encryption type of the key, which must be one the per-message tokens of RFC 4121 are used
+// with. RC4-HMAC and triple DES contexts use the token formats of RFC 4757 and RFC 1964 instead.
+func tokenEtype(key types.EncryptionKey) (etype.EType, error) {
+	switch key.KeyType {
+	case etypeID.RC4_HMAC, etypeID.RC4_HMAC_EXP, etypeID.DES3_CBC_SHA1_KD:
+		return nil, fmt.Errorf("per-message tokens are not supported for encryption type %d", key.KeyType)
+	}
+	return crypto.GetEtype(key.KeyType)
+}
+
+// nextSendSeqNum returns the sequence number of the next token sent.
+func (c *SecurityContext) nextSendSeqNum() (uint64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.exported {
+		return 0, errExported
+	}
+	n := c.sendSeqNum
+	c.sendSeqNum++
+	return n, nil
+}
+
+// sendFlags returns the token flags for tokens sent on the context.
+func (c *SecurityContext) sendFlags() (types.EncryptionKey, byte) {
+	key, acceptorSubkey := c.key()
+	var flags byte
+	if !c.initiator {
+		flags |= WrapTokenFlagSentByAcceptor
+	}
+	if acceptorSubkey {
+		flags |= WrapTokenFlagAcceptorSubkey
+	}
+	return key, flags
+}
+
+// recvKey checks the direction of a token received with the flags provided and returns the key that protects it.
+func (c *SecurityContext) recvKey(flags byte) (types.EncryptionKey, error) {
+	if fromAcceptor := flags&WrapTokenFlagSentByAcceptor != 0; fromAcceptor != c.initiator {
+		return types.EncryptionKey{}, errors.New("token was not sent by the peer of the security context")
+	}
+	if flags&WrapTokenFlagAcceptorSubkey != 0 {
+		if len(c.keys.AcceptorSubkey.KeyValue) == 0 {
+			return types.EncryptionKey{}, errors.New("token is protected by an acceptor subkey the security context does not have")
+		}
+		return c.keys.AcceptorSubkey, nil
+	}
+	if len(c.keys.InitiatorSubkey.KeyValue) > 0 {
+		return c.keys.InitiatorSubkey, nil
+	}
+	return c.keys.SessionKey, nil
+}
+
+// sealUsage returns the key usage of the Wrap tokens sent by the initiator, or by the acceptor.
+func sealUsage(fromInitiator bool) uint32 {
+	if fromInitiator {
+		return keyusage.GSSAPI_INITIATOR_SEAL
+	}
+	return keyusage.GSSAPI_ACCEPTOR_SEAL
+}
+
+// Wrap returns a Wrap token carrying the message. If conf is true the message is encrypted, otherwise it is sent in
+// the clear with a checksum protecting its integrity.
+func (c *SecurityContext) Wrap(msg []byte, conf bool) ([]byte, error) {
+	key, flags := c.sendFlags()
+	et, err := tokenEtype(key)
+	if err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		msg = []byte{}
+	}
+	usage := sealUsage(c.initiator)
+	seq, err := c.nextSendSeqNum()
+	if err != nil {
+		return nil, err
+	}
+	if !conf {
+		wt := WrapToken{
+			Flags:     flags,
+			EC:        uint16(et.GetHMACBitLength() / 8),
+			SndSeqNum: seq,
+			Payload:   msg,
+		}
+		if err := wt.SetCheckSum(key, usage); err != nil {
+			return nil, err
+		}
+		return wt.Marshal()
+	}
+	// The encrypted data is the message followed by a copy of the token header with an RRC of zero. AES in CTS mode
+	// needs no padding so no filler is added and the EC is zero.
+	flags |= WrapTokenFlagSealed
+	hdr := wrapTokenHeader(flags, 0, 0, seq)
+	pt := make([]byte, len(msg)+HdrLen)
+	copy(pt, msg)
+	copy(pt[len(msg):], hdr)
+	_, ct, err := et.EncryptMessage(key.KeyValue, pt, usage)
+	if err != nil {
+		return nil, fmt.Errorf("error encrypting Wrap token: %v", err)
+	}
+	return append(hdr, ct...), nil
+}
+
+// Unwrap verifies a Wrap token received from the peer and returns the message it carries, decrypting it if it was
+// sealed. conf indicates if the message was encrypted.
+// A token rejected by the sequence policy of the context returns a Status error with a supplementary code.
+func (c *SecurityContext) Unwrap(b []byte) (msg []byte, conf bool, err error) {
+	if len(b) < HdrLen {
+		return nil, false, errors.New("bytes shorter than header length")
+	}
+	if !bytes.Equal(getGssWrapTokenId()[:], b[0:2]) || b[3] != FillerByte {
+		return nil, false, errors.New("bytes are not a Wrap token")
+	}
+	flags := b[2]
+	key, err := c.recvKey(flags)
+	if err != nil {
+		return nil, false, err
+	}
+	et, err := tokenEtype(key)
+	if err != nil {
+		return nil, false, err
+	}
+	ec := int(binary.BigEndian.Uint16(b[4:6]))
+	rrc := int(binary.BigEndian.Uint16(b[6:8]))
+	seq := binary.BigEndian.Uint64(b[8:16])
+	data := unrotate(b[HdrLen:], rrc)
+	usage := sealUsage(flags&WrapTokenFlagSentByAcceptor == 0)
+
+	if flags&WrapTokenFlagSealed == 0 {
+		if ec != et.GetHMACBitLength()/8 || len(data) < ec {
+			return nil, false, errors.New("Wrap token checksum length is not valid")
+		}
+		wt := WrapToken{
+			Flags:     flags,
+			EC:        uint16(ec),
+			SndSeqNum: seq,
+			Payload:   data[:len(data)-ec],
+			CheckSum:  data[len(data)-ec:],
+		}
+		if ok, err := wt.Verify(key, usage); !ok {
+			return nil, false, err
+		}
+		if err := c.checkRecvSeqNum(seq); err != nil {
+			return nil, false, err
+		}
+		return wt.Payload, false, nil
+	}
+
+	pt, err := et.DecryptMessage(key.KeyValue, data, usage)
+	if err != nil {
+		return nil, true, fmt.Errorf("error decrypting Wrap token: %v", err)
+	}
+	if len(pt) < ec+HdrLen {
+		return nil, true, errors.New("decrypted Wrap token is too short")
+	}
+	// The encrypted copy of the header must match the header sent in the clear, other than its RRC
+	if !hmac.Equal(pt[len(pt)-HdrLen:], wrapTokenHeader(flags, uint16(ec), 0, seq)) {
+		return nil, true, errors.New("encrypted Wrap token header does not match the token header")
+	}
+	if err := c.checkRecvSeqNum(seq); err != nil {
+		return nil, true, err
+	}
+	return pt[:len(pt)-HdrLen-ec], true, nil
+}
+
+// signUsage returns the key usage of the MIC tokens sent by the initiator, or by the acceptor.
+func signUsage(fromInitiator bool) uint32 {
+	if fromInitiator {
+		return keyusage.GSSAPI_INITIATOR_SIGN
+	}
+	return keyusage.GSSAPI_ACCEPTOR_SIGN
+}
+
+// GetMIC returns a MIC token protecting the integrity of the message, which is sent to the peer separately.
+func (c *SecurityContext) GetMIC(msg []byte) ([]byte, error) {
+	key, flags := c.sendFlags()
+	if _, err := tokenEtype(key); err != nil {
+		return nil, err
+	}
+	if msg == nil {
+		msg = []byte{}
+	}
+	seq, err := c.nextSendSeqNum()
+	if err != nil {
+		return nil, err
+	}
+	mt := MICToken{
+		Flags:     flags,
+		SndSeqNum: seq,
+		Payload:   msg,
+	}
+	if err := mt.SetChecksum(key, signUsage(c.initiator)); err != nil {
+		return nil, err
+	}
+	return mt.Marshal()
+}
+
+// VerifyMIC verifies a MIC token received from the peer for the message provided.
+func (c *SecurityContext) VerifyMIC(msg, token []byte) error {
+	if len(token) < micHdrLen {
+		return errors.New("bytes shorter than header length")
+	}
+	var mt MICToken
+	if err := mt.Unmarshal(token, c.initiator); err != nil {
+		return err
+	}
+	key, err := c.recvKey(mt.Flags)
+	if err != nil {
+		return err
+	}
+	if _, err := tokenEtype(key); err != nil {
+		return err
+	}
+	if msg == nil {
+		msg = []byte{}
+	}
+	mt.Payload = msg
+	if ok, err := mt.Verify(key, signUsage(mt.Flags&MICTokenFlagSentByAcceptor == 0)); !ok {
+		return err
+	}
+	return c.checkRecvSeqNum(mt.SndSeqNum)
+}
+
+// wrapTokenHeader returns the header of a Wrap token.
+func wrapTokenHeader(flags byte, ec, rrc uint16, seq uint64) []byte {
+	h := make([]byte, HdrLen)
+	copy(h, getGssWrapTokenId()[:])
+	h[2] = flags
+	h[3] = FillerByte
+	binary.BigEndian.PutUint16(h[4:6], ec)
+	binary.BigEndian.PutUint16(h[6:8], rrc)
+	binary.BigEndian.PutUint64(h[8:16], seq)
+	return h
+}
+
+// unrotate reverses the right rotation of the data following a token header by rrc bytes.
+func unrotate(b []byte, rrc int) []byte {
+	out := make([]byte, len(b))
+	if len(b) == 0 {
+		return out
+	}
+	rrc %= len(b)
+	copy(out, b[rrc:])
+	copy(out[len(b)-rrc:], b[:rrc])
+	return out
+}
@@ -0,0 +1,179 @@
+package gssapi
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestContexts(t *testing.T, keys ContextKeys) (*SecurityContext, *SecurityContext) {
+	t.Helper()
+	flags := ContextFlagInteg | ContextFlagConf
+	return NewSecurityContext(true, flags, keys, 100, 100), NewSecurityContext(false, flags, keys, 100, 100)
+}
+
+func testKey(t *testing.T, id int32) types.EncryptionKey {
+	t.Helper()
+	et, err := crypto.GetEtype(id)
+	if err != nil {
+		t.Fatalf("error getting etype: %v", err)
+	}
+	key, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		t.Fatalf("error generating key: %v", err)
+	}
+	return key
+}
+
+func TestSecurityContext_WrapUnwrap(t *testing.T) {
+	t.Parallel()
+	for _, id := range []int32{etypeID.AES128_CTS_HMAC_SHA1_96, etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA256_128} {
+		keys := ContextKeys{SessionKey: testKey(t, id)}
+		ini, acc := newTestContexts(t, keys)
+		for _, conf := range []bool{true, false} {
+			for _, msg := range [][]byte{{}, []byte("a"), []byte("a message protected by a Wrap token")} {
+				b, err := ini.Wrap(msg, conf)
+				if err != nil {
+					t.Fatalf("error wrapping message for etype %d: %v", id, err)
+				}
+				assert.Equal(t, byte(0), b[2]&WrapTokenFlagSentByAcceptor, "initiator token should not have the acceptor flag")
+				m, c, err := acc.Unwrap(b)
+				if err != nil {
+					t.Fatalf("error unwrapping initiator token for etype %d conf %t: %v", id, conf, err)
+				}
+				assert.Equal(t, msg, m, "unwrapped message not as expected")
+				assert.Equal(t, conf, c, "confidentiality state not as expected")
+
+				b, err = acc.Wrap(msg, conf)
+				if err != nil {
+					t.Fatalf("error wrapping message for etype %d: %v", id, err)
+				}
+				m, c, err = ini.Unwrap(b)
+				if err != nil {
+					t.Fatalf("error unwrapping acceptor token for etype %d conf %t: %v", id, conf, err)
+				}
+				assert.Equal(t, msg, m, "unwrapped message not as expected")
+				assert.Equal(t, conf, c, "confidentiality state not as expected")
+
+				// A token is not accepted back by its sender
+				_, _, err = acc.Unwrap(b)
+				assert.Error(t, err, "token should not be unwrapped by its sender")
+
+				// Tampering is detected
+				b[len(b)-1] ^= 0x01
+				_, _, err = ini.Unwrap(b)
+				assert.Error(t, err, "tampered token should not be unwrapped")
+			}
+		}
+	}
+}
+
+func TestSecurityContext_AcceptorSubkey(t *testing.T) {
+	t.Parallel()
+	keys := ContextKeys{
+		SessionKey:      testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96),
+		InitiatorSubkey: testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96),
+		AcceptorSubkey:  testKey(t, etypeID.AES128_CTS_HMAC_SHA1_96),
+	}
+	ini, acc := newTestContexts(t, keys)
+	b, err := acc.Wrap([]byte("hello"), true)
+	if err != nil {
+		t.Fatalf("error wrapping message: %v", err)
+	}
+	assert.Equal(t, byte(WrapTokenFlagSentByAcceptor|WrapTokenFlagSealed|WrapTokenFlagAcceptorSubkey), b[2], "token flags not as expected")
+	m, _, err := ini.Unwrap(b)
+	if err != nil {
+		t.Fatalf("error unwrapping token: %v", err)
+	}
+	assert.Equal(t, []byte("hello"), m, "unwrapped message not as expected")
+
+	// A context without the acceptor subkey cannot unwrap the token
+	other := NewSecurityContext(true, 0, ContextKeys{SessionKey: keys.SessionKey, InitiatorSubkey: keys.InitiatorSubkey}, 0, 0)
+	_, _, err = other.Unwrap(b)
+	assert.Error(t, err, "token protected by an unknown acceptor subkey should not be unwrapped")
+}
+
+func TestSecurityContext_UnwrapRotated(t *testing.T) {
+	t.Parallel()
+	ini, acc := newTestContexts(t, ContextKeys{SessionKey: testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96)})
+	for _, conf := range []bool{true, false} {
+		b, err := ini.Wrap([]byte("a message rotated by its sender"), conf)
+		if err != nil {
+			t.Fatalf("error wrapping message: %v", err)
+		}
+		// Rotate the data following the header right by 28 bytes, as Microsoft implementations do
+		const rrc = 28
+		d := b[HdrLen:]
+		r := append(append([]byte{}, d[len(d)-rrc:]...), d[:len(d)-rrc]...)
+		copy(d, r)
+		binary.BigEndian.PutUint16(b[6:8], rrc)
+		m, _, err := acc.Unwrap(b)
+		if err != nil {
+			t.Fatalf("error unwrapping rotated token with conf %t: %v", conf, err)
+		}
+		assert.Equal(t, []byte("a message rotated by its sender"), m, "unwrapped message not as expected")
+	}
+}
+
+func TestSecurityContext_UnwrapReference(t *testing.T) {
+	t.Parallel()
+	ini := NewSecurityContext(true, 0, ContextKeys{SessionKey: getSessionKey()}, 0, 0)
+	b, _ := hex.DecodeString(testChallengeFromAcceptor)
+	m, conf, err := ini.Unwrap(b)
+	if err != nil {
+		t.Fatalf("error unwrapping reference token: %v", err)
+	}
+	assert.False(t, conf, "reference token is not sealed")
+	assert.Equal(t, []byte{0x01, 0x01, 0x00, 0x00}, m, "unwrapped message not as expected")
+}
+
+func TestSecurityContext_UnsupportedEtype(t *testing.T) {
+	t.Parallel()
+	ini := NewSecurityContext(true, 0, ContextKeys{SessionKey: types.EncryptionKey{KeyType: etypeID.RC4_HMAC, KeyValue: make([]byte, 16)}}, 0, 0)
+	_, err := ini.Wrap([]byte("hello"), true)
+	assert.Error(t, err, "RC4-HMAC contexts should not produce RFC 4121 tokens")
+}
+
+func TestSecurityContext_GetMICVerifyMIC(t *testing.T) {
+	t.Parallel()
+	for _, keys := range []ContextKeys{
+		{SessionKey: testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96)},
+		{SessionKey: testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96), AcceptorSubkey: testKey(t, etypeID.AES256_CTS_HMAC_SHA384_192)},
+	} {
+		ini, acc := newTestContexts(t, keys)
+		msg := []byte("a message sent alongside its MIC")
+		mic, err := ini.GetMIC(msg)
+		if err != nil {
+			t.Fatalf("error getting MIC: %v", err)
+		}
+		assert.NoError(t, acc.VerifyMIC(msg, mic), "initiator MIC not verified by acceptor")
+		assert.Error(t, acc.VerifyMIC([]byte("another message"), mic), "MIC verified for a different message")
+		assert.Error(t, ini.VerifyMIC(msg, mic), "MIC should not be verified by its sender")
+
+		mic, err = acc.GetMIC(msg)
+		if err != nil {
+			t.Fatalf("error getting MIC: %v", err)
+		}
+		assert.NoError(t, ini.VerifyMIC(msg, mic), "acceptor MIC not verified by initiator")
+		mic[len(mic)-1] ^= 0x01
+		assert.Error(t, ini.VerifyMIC(msg, mic), "tampered MIC verified")
+	}
+}
+
+func TestSecurityContext_MICReference(t *testing.T) {
+	t.Parallel()
+	ini := NewSecurityContext(true, 0, ContextKeys{SessionKey: getSessionKey()}, 0, 0)
+	payload, _ := hex.DecodeString(testMICPayload)
+	challenge, _ := hex.DecodeString(testMICChallengeFromAcceptor)
+	assert.NoError(t, ini.VerifyMIC(payload, challenge), "reference acceptor MIC not verified")
+	mic, err := ini.GetMIC(payload)
+	if err != nil {
+		t.Fatalf("error getting MIC: %v", err)
+	}
+	assert.Equal(t, testMICChallengeReplyFromInitiator, hex.EncodeToString(mic), "MIC not as expected")
+}
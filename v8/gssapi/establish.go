@@ -0,0 +1,99 @@
+package gssapi
+
+import (
+	"context"
+	"fmt"
+)
+
+// RFC 2743, section 2.2
+
+// ContextEstablisher carries out one side of the establishment of a security context by a mechanism: the calls of the
+// initiator to GSS_Init_sec_context, or those of the acceptor to GSS_Accept_sec_context.
+type ContextEstablisher interface {
+	// Step processes the context token received from the peer, nil on the first call of an initiator, and returns the
+	// context token to send to the peer, if any. continueNeeded is true while a further token is expected from the
+	// peer. A token may be returned with an error, such as one informing the peer of a rejection, and should be sent.
+	Step(in []byte) (out []byte, continueNeeded bool, err error)
+	// SecurityContext returns the security context established, once Step no longer needs to continue.
+	SecurityContext() (*SecurityContext, error)
+	// Context returns the context of the established security context. That of an acceptor contains the identity of
+	// the initiator and any credentials it delegated.
+	Context() context.Context
+}
+
+// TokenTransport carries the context tokens exchanged by the initiator and the acceptor of a security context, such
+// as in the messages of an application protocol or the challenges and responses of SASL.
+type TokenTransport interface {
+	// SendToken sends a context token to the peer.
+	SendToken(b []byte) error
+	// ReceiveToken returns the next context token from the peer.
+	ReceiveToken() ([]byte, error)
+}
+
+// InitSecContext establishes a security context with the acceptor as the initiator of the mechanism, exchanging
+// context tokens over the transport until the mechanism completes. It returns the security context and the context of
+// its establishment.
+func InitSecContext(m Mechanism, t TokenTransport) (*SecurityContext, context.Context, error) {
+	e, err := m.NewInitiator()
+	if err != nil {
+		return nil, nil, err
+	}
+	var in []byte
+	for {
+		cont, err := step(e, t, in)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !cont {
+			break
+		}
+		in, err = t.ReceiveToken()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error receiving context token: %v", err)
+		}
+	}
+	return established(e)
+}
+
+// AcceptSecContext establishes a security context with the initiator as the acceptor of the mechanism, exchanging
+// context tokens over the transport until the mechanism completes. It returns the security context and the context of
+// its establishment, which contains the identity of the initiator.
+func AcceptSecContext(m Mechanism, t TokenTransport) (*SecurityContext, context.Context, error) {
+	e, err := m.NewAcceptor()
+	if err != nil {
+		return nil, nil, err
+	}
+	for {
+		in, err := t.ReceiveToken()
+		if err != nil {
+			return nil, nil, fmt.Errorf("error receiving context token: %v", err)
+		}
+		cont, err := step(e, t, in)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !cont {
+			break
+		}
+	}
+	return established(e)
+}
+
+// step processes the token received and sends any token returned to the peer, even when the step failed.
+func step(e ContextEstablisher, t TokenTransport, in []byte) (bool, error) {
+	out, cont, err := e.Step(in)
+	if len(out) > 0 {
+		if serr := t.SendToken(out); serr != nil && err == nil {
+			err = fmt.Errorf("error sending context token: %v", serr)
+		}
+	}
+	return cont, err
+}
+
+func established(e ContextEstablisher) (*SecurityContext, context.Context, error) {
+	sc, err := e.SecurityContext()
+	if err != nil {
+		return nil, nil, err
+	}
+	return sc, e.Context(), nil
+}
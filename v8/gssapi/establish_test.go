@@ -0,0 +1,152 @@
+package gssapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+)
+
+// testMechanism establishes contexts in three legs: the initiator sends "1", the acceptor replies "2" and the
+// initiator completes with "3". Any other token is rejected.
+type testMechanism struct {
+	keys ContextKeys
+}
+
+func (m testMechanism) OID() asn1.ObjectIdentifier {
+	return asn1.ObjectIdentifier{1, 2, 3}
+}
+
+func (m testMechanism) NewInitiator() (ContextEstablisher, error) {
+	return &testEstablisher{keys: m.keys, initiator: true}, nil
+}
+
+func (m testMechanism) NewAcceptor() (ContextEstablisher, error) {
+	return &testEstablisher{keys: m.keys}, nil
+}
+
+type testEstablisher struct {
+	keys      ContextKeys
+	initiator bool
+	leg       int
+	done      bool
+}
+
+func (e *testEstablisher) Step(in []byte) ([]byte, bool, error) {
+	e.leg++
+	var want, out string
+	switch {
+	case e.initiator && e.leg == 1:
+		return []byte("1"), true, nil
+	case e.initiator:
+		want, out = "2", "3"
+	case e.leg == 1:
+		want, out = "1", "2"
+	default:
+		want = "3"
+	}
+	if string(in) != want {
+		return []byte("rejected"), false, Status{Code: StatusDefectiveToken, Message: fmt.Sprintf("unexpected token %q", in)}
+	}
+	e.done = e.initiator || e.leg == 2
+	if out == "" {
+		return nil, false, nil
+	}
+	return []byte(out), !e.initiator, nil
+}
+
+func (e *testEstablisher) SecurityContext() (*SecurityContext, error) {
+	if !e.done {
+		return nil, errors.New("context not established")
+	}
+	return NewSecurityContext(e.initiator, ContextFlagInteg|ContextFlagConf, e.keys, 0, 0), nil
+}
+
+func (e *testEstablisher) Context() context.Context {
+	return context.Background()
+}
+
+type chanTransport struct {
+	send chan<- []byte
+	recv <-chan []byte
+}
+
+func (t chanTransport) SendToken(b []byte) error {
+	t.send <- b
+	return nil
+}
+
+func (t chanTransport) ReceiveToken() ([]byte, error) {
+	b, ok := <-t.recv
+	if !ok {
+		return nil, errors.New("transport closed")
+	}
+	return b, nil
+}
+
+func newTestTransports() (chanTransport, chanTransport) {
+	a, b := make(chan []byte, 1), make(chan []byte, 1)
+	return chanTransport{send: a, recv: b}, chanTransport{send: b, recv: a}
+}
+
+func TestInitAcceptSecContext(t *testing.T) {
+	t.Parallel()
+	m := testMechanism{keys: ContextKeys{SessionKey: testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96)}}
+	it, at := newTestTransports()
+	type result struct {
+		sc  *SecurityContext
+		err error
+	}
+	accepted := make(chan result)
+	go func() {
+		sc, _, err := AcceptSecContext(m, at)
+		accepted <- result{sc, err}
+	}()
+	ini, ctx, err := InitSecContext(m, it)
+	if err != nil {
+		t.Fatalf("error initiating security context: %v", err)
+	}
+	assert.NotNil(t, ctx, "context should be returned")
+	r := <-accepted
+	if r.err != nil {
+		t.Fatalf("error accepting security context: %v", r.err)
+	}
+	assert.True(t, ini.Initiator(), "initiator context not as expected")
+	assert.False(t, r.sc.Initiator(), "acceptor context not as expected")
+
+	// The contexts established protect messages exchanged between them
+	b, err := ini.Wrap([]byte("message"), true)
+	if err != nil {
+		t.Fatalf("error wrapping message: %v", err)
+	}
+	msg, _, err := r.sc.Unwrap(b)
+	if err != nil {
+		t.Fatalf("error unwrapping message: %v", err)
+	}
+	assert.Equal(t, []byte("message"), msg, "unwrapped message not as expected")
+}
+
+func TestAcceptSecContext_Rejected(t *testing.T) {
+	t.Parallel()
+	m := testMechanism{keys: ContextKeys{SessionKey: testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96)}}
+	it, at := newTestTransports()
+	accepted := make(chan error)
+	go func() {
+		_, _, err := AcceptSecContext(m, at)
+		accepted <- err
+	}()
+	it.SendToken([]byte("x"))
+	err := <-accepted
+	assert.Error(t, err, "acceptor should reject an unexpected token")
+	assert.Equal(t, StatusDefectiveToken, err.(Status).Code, "status code not as expected")
+	// The rejection is sent to the initiator
+	b, err := it.ReceiveToken()
+	if err != nil {
+		t.Fatalf("error receiving rejection: %v", err)
+	}
+	assert.Equal(t, []byte("rejected"), b, "rejection token not as expected")
+}
@@ -0,0 +1,160 @@
+package gssapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// RFC 2743, section 2.2.8
+
+// exportVersion is the version of the format security contexts are exported in.
+const exportVersion = 1
+
+// errExported is returned by a security context that has been exported.
+var errExported = Status{Code: StatusNoContext, Message: "security context has been exported"}
+
+// Export returns the security context serialized, including its keys and sequence number state, for it to be
+// imported with ImportSecurityContext by another process or after a restart. As for GSS_Export_sec_context the
+// context can no longer be used once exported, so that the sequence numbers of its tokens are not reused.
+// The bytes returned contain the keys of the context and must be protected accordingly.
+func (c *SecurityContext) Export() ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.exported {
+		return nil, errExported
+	}
+	b := []byte{exportVersion, 0}
+	if c.initiator {
+		b[1] = 1
+	}
+	b = appendUint32(b, uint32(c.flags))
+	var end int64
+	if !c.endTime.IsZero() {
+		end = c.endTime.Unix()
+	}
+	b = appendUint64(b, uint64(end))
+	b = appendUint64(b, c.sendSeqNum)
+	b = appendUint64(b, c.recv.base)
+	b = appendUint64(b, c.recv.next)
+	b = appendUint64(b, c.recv.received)
+	var policy byte
+	if c.seqPolicy.RejectReplays {
+		policy |= 1
+	}
+	if c.seqPolicy.RejectOutOfSequence {
+		policy |= 2
+	}
+	b = append(b, policy)
+	b = appendUint32(b, uint32(c.seqPolicy.Window))
+	for _, k := range []types.EncryptionKey{c.keys.SessionKey, c.keys.InitiatorSubkey, c.keys.AcceptorSubkey} {
+		if len(k.KeyValue) > 0xFFFF {
+			return nil, errors.New("key is too long to export")
+		}
+		b = appendUint32(b, uint32(k.KeyType))
+		b = append(b, byte(len(k.KeyValue)>>8), byte(len(k.KeyValue)))
+		b = append(b, k.KeyValue...)
+	}
+	c.exported = true
+	return b, nil
+}
+
+// ImportSecurityContext returns the security context serialized by Export.
+func ImportSecurityContext(b []byte) (*SecurityContext, error) {
+	r := exportReader{b: b}
+	if v := r.byte(); v != exportVersion {
+		return nil, fmt.Errorf("exported security context version %d is not supported", v)
+	}
+	c := &SecurityContext{
+		initiator: r.byte() == 1,
+		flags:     int(r.uint32()),
+	}
+	if end := int64(r.uint64()); end != 0 {
+		c.endTime = time.Unix(end, 0).UTC()
+	}
+	c.sendSeqNum = r.uint64()
+	c.recv = seqState{
+		base:     r.uint64(),
+		next:     r.uint64(),
+		received: r.uint64(),
+	}
+	policy := r.byte()
+	c.seqPolicy = SequencePolicy{
+		RejectReplays:       policy&1 != 0,
+		RejectOutOfSequence: policy&2 != 0,
+		Window:              int(r.uint32()),
+	}
+	for _, k := range []*types.EncryptionKey{&c.keys.SessionKey, &c.keys.InitiatorSubkey, &c.keys.AcceptorSubkey} {
+		k.KeyType = int32(r.uint32())
+		l := int(r.byte())<<8 | int(r.byte())
+		if l > 0 {
+			k.KeyValue = r.bytes(l)
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(r.b) != 0 {
+		return nil, errors.New("exported security context has trailing data")
+	}
+	if len(c.keys.SessionKey.KeyValue) == 0 {
+		return nil, errors.New("exported security context has no session key")
+	}
+	return c, nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var n [4]byte
+	binary.BigEndian.PutUint32(n[:], v)
+	return append(b, n[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var n [8]byte
+	binary.BigEndian.PutUint64(n[:], v)
+	return append(b, n[:]...)
+}
+
+// exportReader reads the fields of an exported security context, recording the first error encountered.
+type exportReader struct {
+	b   []byte
+	err error
+}
+
+func (r *exportReader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b) < n {
+		r.err = errors.New("exported security context is truncated")
+		return nil
+	}
+	v := make([]byte, n)
+	copy(v, r.b[:n])
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *exportReader) byte() byte {
+	if b := r.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *exportReader) uint32() uint32 {
+	if b := r.bytes(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *exportReader) uint64() uint64 {
+	if b := r.bytes(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
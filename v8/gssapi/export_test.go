@@ -0,0 +1,82 @@
+package gssapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityContext_ExportImport(t *testing.T) {
+	t.Parallel()
+	keys := ContextKeys{
+		SessionKey:      testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96),
+		InitiatorSubkey: testKey(t, etypeID.AES128_CTS_HMAC_SHA256_128),
+	}
+	flags := ContextFlagInteg | ContextFlagConf | ContextFlagReplay
+	ini := NewSecurityContext(true, flags, keys, 500, 700)
+	acc := NewSecurityContext(false, flags, keys, 700, 500)
+	acc.SetSequencePolicy(SequencePolicy{RejectReplays: true, Window: 32})
+	acc.SetEndTime(time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC))
+
+	first, err := ini.Wrap([]byte("before export"), true)
+	if err != nil {
+		t.Fatalf("error wrapping message: %v", err)
+	}
+	if _, _, err := acc.Unwrap(first); err != nil {
+		t.Fatalf("error unwrapping message: %v", err)
+	}
+
+	b, err := acc.Export()
+	if err != nil {
+		t.Fatalf("error exporting context: %v", err)
+	}
+	_, err = acc.Wrap([]byte("after export"), true)
+	assert.Error(t, err, "exported context should no longer be usable")
+	_, err = acc.Export()
+	assert.Error(t, err, "context should not be exported twice")
+
+	imp, err := ImportSecurityContext(b)
+	if err != nil {
+		t.Fatalf("error importing context: %v", err)
+	}
+	assert.False(t, imp.Initiator(), "imported context should be the acceptor's")
+	assert.Equal(t, flags, imp.Flags(), "imported flags not as expected")
+	assert.Equal(t, keys, imp.Keys(), "imported keys not as expected")
+	assert.Equal(t, acc.EndTime(), imp.EndTime(), "imported end time not as expected")
+	assert.Equal(t, SequencePolicy{RejectReplays: true, Window: 32}, imp.SequencePolicy(), "imported policy not as expected")
+
+	// The sequence state carries over, so replays of tokens received before the export are detected
+	_, _, err = imp.Unwrap(first)
+	assert.Error(t, err, "replay of a token received before export should be rejected")
+	second, err := ini.Wrap([]byte("after import"), false)
+	if err != nil {
+		t.Fatalf("error wrapping message: %v", err)
+	}
+	m, _, err := imp.Unwrap(second)
+	if err != nil {
+		t.Fatalf("error unwrapping message with imported context: %v", err)
+	}
+	assert.Equal(t, []byte("after import"), m, "unwrapped message not as expected")
+	reply, err := imp.Wrap([]byte("reply"), true)
+	if err != nil {
+		t.Fatalf("error wrapping message with imported context: %v", err)
+	}
+	m, _, err = ini.Unwrap(reply)
+	if err != nil {
+		t.Fatalf("error unwrapping reply: %v", err)
+	}
+	assert.Equal(t, []byte("reply"), m, "unwrapped reply not as expected")
+
+	// Truncated or altered exports are rejected
+	for l := 0; l < len(b); l++ {
+		_, err := ImportSecurityContext(b[:l])
+		assert.Error(t, err, "truncated export of length %d should be rejected", l)
+	}
+	_, err = ImportSecurityContext(append(b, 0))
+	assert.Error(t, err, "export with trailing data should be rejected")
+	b[0] = 99
+	_, err = ImportSecurityContext(b)
+	assert.Error(t, err, "export of an unknown version should be rejected")
+}
@@ -102,16 +102,13 @@ GSS_Export_name              externalize per-mechanism name
 GSS_Duplicate_name           duplicate name object
 */
 
-// Mechanism is the GSS-API interface for authentication mechanisms.
+// Mechanism is the GSS-API interface for authentication mechanisms. A mechanism establishes security contexts by the
+// exchange of context tokens between an initiator and an acceptor, which InitSecContext and AcceptSecContext carry out
+// for any mechanism.
 type Mechanism interface {
 	OID() asn1.ObjectIdentifier
-	AcquireCred() error                                               // acquire credentials for use (eg. AS exchange for KRB5)
-	InitSecContext() (ContextToken, error)                            // initiate outbound security context (eg TGS exchange builds AP_REQ to go into ContextToken to send to service)
-	AcceptSecContext(ct ContextToken) (bool, context.Context, Status) // service verifies the token server side to establish a context
-	MIC() MICToken                                                    // apply integrity check, receive as token separate from message
-	VerifyMIC(mt MICToken) (bool, error)                              // validate integrity check token along with message
-	Wrap(msg []byte) WrapToken                                        // sign, optionally encrypt, encapsulate
-	Unwrap(wt WrapToken) []byte                                       // decapsulate, decrypt if needed, validate integrity check
+	NewInitiator() (ContextEstablisher, error) // initiate outbound security context (eg TGS exchange builds AP_REQ to go into the context token to send to the service)
+	NewAcceptor() (ContextEstablisher, error)  // accept inbound security context (eg service verifies the AP_REQ of the context token from the client)
 }
 
 // OIDName is the type for defined GSS-API OIDs.
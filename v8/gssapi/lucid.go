@@ -0,0 +1,98 @@
+package gssapi
+
+import (
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// LucidContext is the lucid form of a security context, that of gss_krb5_lucid_context_v1_t of MIT Kerberos, exported
+// by gss_krb5_export_lucid_sec_context. User-space daemons, such as rpc.gssd and cifs.upcall, pass the lucid contexts
+// of the contexts they establish to the kernel's NFS and CIFS implementations, serialized in the format the kernel
+// expects.
+type LucidContext struct {
+	Version  uint32 // version of the structure, 1
+	Initiate uint32 // 1 if the context is that of the initiator
+	EndTime  uint32 // expiry of the context, seconds since the epoch
+	SendSeq  uint64 // sequence number of the next token sent
+	RecvSeq  uint64 // sequence number of the next token expected
+	// Protocol is 0 for the RFC 1964 token formats used with triple DES and RC4-HMAC keys, 1 for those of RFC 4121.
+	Protocol  uint32
+	RFC1964KD LucidRFC1964KeyData // keys of protocol 0 contexts
+	CFXKD     LucidCFXKeyData     // keys of protocol 1 contexts
+}
+
+// LucidKey is a key of a lucid context.
+type LucidKey struct {
+	Type uint32 // encryption type
+	Data []byte
+}
+
+// LucidRFC1964KeyData are the keys of a lucid context using the token formats of RFC 1964.
+type LucidRFC1964KeyData struct {
+	SignAlg uint32
+	SealAlg uint32
+	CtxKey  LucidKey
+}
+
+// LucidCFXKeyData are the keys of a lucid context using the token formats of RFC 4121.
+type LucidCFXKeyData struct {
+	HaveAcceptorSubkey uint32
+	CtxKey             LucidKey
+	AcceptorSubkey     LucidKey
+}
+
+// RFC 1964 and RFC 4757 signing and sealing algorithm identifiers.
+const (
+	lucidSignAlgHMACSHA1DES3KD = 0x04
+	lucidSignAlgHMACMD5        = 0x11
+	lucidSealAlgDES3KD         = 0x02
+	lucidSealAlgRC4            = 0x10
+)
+
+// ExportLucid returns the lucid form of the security context. As for gss_krb5_export_lucid_sec_context the context
+// can no longer be used once exported, its use passing to the consumer of the lucid context.
+func (c *SecurityContext) ExportLucid() (LucidContext, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.exported {
+		return LucidContext{}, errExported
+	}
+	l := LucidContext{
+		Version: 1,
+		SendSeq: c.sendSeqNum,
+		RecvSeq: c.recv.next,
+	}
+	if c.initiator {
+		l.Initiate = 1
+	}
+	if !c.endTime.IsZero() {
+		l.EndTime = uint32(c.endTime.Unix())
+	}
+	// The context key is the initiator subkey if there is one, otherwise the session key
+	ctxKey := c.keys.SessionKey
+	if len(c.keys.InitiatorSubkey.KeyValue) > 0 {
+		ctxKey = c.keys.InitiatorSubkey
+	}
+	switch ctxKey.KeyType {
+	case etypeID.DES3_CBC_SHA1_KD:
+		l.RFC1964KD = LucidRFC1964KeyData{SignAlg: lucidSignAlgHMACSHA1DES3KD, SealAlg: lucidSealAlgDES3KD, CtxKey: lucidKey(ctxKey)}
+	case etypeID.RC4_HMAC, etypeID.RC4_HMAC_EXP:
+		l.RFC1964KD = LucidRFC1964KeyData{SignAlg: lucidSignAlgHMACMD5, SealAlg: lucidSealAlgRC4, CtxKey: lucidKey(ctxKey)}
+	default:
+		l.Protocol = 1
+		l.CFXKD.CtxKey = lucidKey(ctxKey)
+		if len(c.keys.AcceptorSubkey.KeyValue) > 0 {
+			l.CFXKD.HaveAcceptorSubkey = 1
+			l.CFXKD.AcceptorSubkey = lucidKey(c.keys.AcceptorSubkey)
+		}
+	}
+	c.exported = true
+	return l, nil
+}
+
+func lucidKey(k types.EncryptionKey) LucidKey {
+	return LucidKey{
+		Type: uint32(k.KeyType),
+		Data: append([]byte(nil), k.KeyValue...),
+	}
+}
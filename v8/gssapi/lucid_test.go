@@ -0,0 +1,59 @@
+package gssapi
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSecurityContext_ExportLucid(t *testing.T) {
+	t.Parallel()
+	keys := ContextKeys{
+		SessionKey:      testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96),
+		InitiatorSubkey: testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96),
+		AcceptorSubkey:  testKey(t, etypeID.AES128_CTS_HMAC_SHA1_96),
+	}
+	end := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	c := NewSecurityContext(true, ContextFlagInteg, keys, 10, 20)
+	c.SetEndTime(end)
+	if _, err := c.Wrap([]byte("message"), true); err != nil {
+		t.Fatalf("error wrapping message: %v", err)
+	}
+	l, err := c.ExportLucid()
+	if err != nil {
+		t.Fatalf("error exporting lucid context: %v", err)
+	}
+	assert.Equal(t, LucidContext{
+		Version:  1,
+		Initiate: 1,
+		EndTime:  uint32(end.Unix()),
+		SendSeq:  11,
+		RecvSeq:  20,
+		Protocol: 1,
+		CFXKD: LucidCFXKeyData{
+			HaveAcceptorSubkey: 1,
+			CtxKey:             LucidKey{Type: uint32(etypeID.AES256_CTS_HMAC_SHA1_96), Data: keys.InitiatorSubkey.KeyValue},
+			AcceptorSubkey:     LucidKey{Type: uint32(etypeID.AES128_CTS_HMAC_SHA1_96), Data: keys.AcceptorSubkey.KeyValue},
+		},
+	}, l, "lucid context not as expected")
+	_, err = c.Wrap([]byte("message"), true)
+	assert.Error(t, err, "context should no longer be usable once exported")
+
+	// Contexts of RC4-HMAC keys use the RFC 1964 token formats
+	rc4 := types.EncryptionKey{KeyType: etypeID.RC4_HMAC, KeyValue: make([]byte, 16)}
+	c = NewSecurityContext(false, 0, ContextKeys{SessionKey: rc4}, 1, 2)
+	l, err = c.ExportLucid()
+	if err != nil {
+		t.Fatalf("error exporting lucid context: %v", err)
+	}
+	assert.Equal(t, uint32(0), l.Protocol, "protocol not as expected")
+	assert.Equal(t, uint32(0), l.Initiate, "acceptor context should not be marked as initiator")
+	assert.Equal(t, LucidRFC1964KeyData{
+		SignAlg: 0x11,
+		SealAlg: 0x10,
+		CtxKey:  LucidKey{Type: uint32(etypeID.RC4_HMAC), Data: rc4.KeyValue},
+	}, l.RFC1964KD, "RFC 1964 key data not as expected")
+}
@@ -0,0 +1,75 @@
+package gssapi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// RFC 4402, section 2
+
+// GSS_Pseudo_random key selectors.
+const (
+	// PRFKeyPartial selects the initiator subkey if there is one, otherwise the session key of the ticket.
+	PRFKeyPartial = iota
+	// PRFKeyFull selects the acceptor subkey if there is one, otherwise the key selected by PRFKeyPartial.
+	PRFKeyFull
+)
+
+// PRFKey returns the key GSS_Pseudo_random uses for the key selector provided from the keys of a security context.
+// Subkeys that were not asserted are passed as the zero EncryptionKey.
+func PRFKey(prfKey int, sessionKey, initiatorSubkey, acceptorSubkey types.EncryptionKey) (types.EncryptionKey, error) {
+	switch prfKey {
+	case PRFKeyFull:
+		if len(acceptorSubkey.KeyValue) > 0 {
+			return acceptorSubkey, nil
+		}
+		fallthrough
+	case PRFKeyPartial:
+		if len(initiatorSubkey.KeyValue) > 0 {
+			return initiatorSubkey, nil
+		}
+		if len(sessionKey.KeyValue) == 0 {
+			return types.EncryptionKey{}, errors.New("security context has no session key")
+		}
+		return sessionKey, nil
+	}
+	return types.EncryptionKey{}, fmt.Errorf("unknown GSS_Pseudo_random key selector: %d", prfKey)
+}
+
+// PseudoRandom returns n bytes of pseudo-random output derived from the key and the input provided, as defined for
+// GSS_Pseudo_random by the Kerberos mechanism:
+//
+// PRF+(K, L, S) = truncate(L, T1 || T2 || ... || Tn)
+//
+// Tn = pseudo-random(K, n || S)
+//
+// where the counter n is a four octet big-endian integer starting from one and pseudo-random is the PRF of the key's
+// encryption type. The key is selected from those of the security context with PRFKey.
+func PseudoRandom(key types.EncryptionKey, prfIn []byte, n int) ([]byte, error) {
+	if n < 0 {
+		return nil, errors.New("desired output length cannot be negative")
+	}
+	out := make([]byte, 0, n)
+	in := make([]byte, 4+len(prfIn))
+	copy(in[4:], prfIn)
+	for i := uint64(1); len(out) < n; i++ {
+		if i > math.MaxUint32 {
+			return nil, errors.New("too much pseudo-random output requested")
+		}
+		binary.BigEndian.PutUint32(in[:4], uint32(i))
+		b, err := crypto.PRF(key, in)
+		if err != nil {
+			return nil, fmt.Errorf("error generating pseudo-random output: %v", err)
+		}
+		if len(b) < 1 {
+			return nil, errors.New("pseudo-random function returned no output")
+		}
+		out = append(out, b...)
+	}
+	return out[:n], nil
+}
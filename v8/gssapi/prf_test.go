@@ -0,0 +1,76 @@
+package gssapi
+
+import (
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPseudoRandom(t *testing.T) {
+	t.Parallel()
+	for _, id := range []int32{etypeID.AES256_CTS_HMAC_SHA1_96, etypeID.AES128_CTS_HMAC_SHA256_128, etypeID.RC4_HMAC} {
+		key := types.EncryptionKey{KeyType: id, KeyValue: make([]byte, 16)}
+		if id == etypeID.AES256_CTS_HMAC_SHA1_96 {
+			key.KeyValue = make([]byte, 32)
+		}
+		in := []byte("prf input")
+		b, err := PseudoRandom(key, in, 100)
+		if err != nil {
+			t.Fatalf("error generating pseudo-random output for etype %d: %v", id, err)
+		}
+		assert.Len(t, b, 100, "output length not as expected for etype %d", id)
+
+		// T1 is the PRF of the counter one, as four octets, followed by the input
+		t1, err := crypto.PRF(key, append([]byte{0, 0, 0, 1}, in...))
+		if err != nil {
+			t.Fatalf("error calculating PRF for etype %d: %v", id, err)
+		}
+		assert.Equal(t, t1, b[:len(t1)], "first block of output not as expected for etype %d", id)
+
+		s, err := PseudoRandom(key, in, 7)
+		if err != nil {
+			t.Fatalf("error generating pseudo-random output for etype %d: %v", id, err)
+		}
+		assert.Equal(t, b[:7], s, "shorter output is not a prefix of longer output for etype %d", id)
+
+		o, err := PseudoRandom(key, []byte("other input"), 100)
+		if err != nil {
+			t.Fatalf("error generating pseudo-random output for etype %d: %v", id, err)
+		}
+		assert.NotEqual(t, b, o, "output for different input should differ for etype %d", id)
+	}
+}
+
+func TestPRFKey(t *testing.T) {
+	t.Parallel()
+	session := types.EncryptionKey{KeyType: 18, KeyValue: []byte{1}}
+	initiator := types.EncryptionKey{KeyType: 18, KeyValue: []byte{2}}
+	acceptor := types.EncryptionKey{KeyType: 18, KeyValue: []byte{3}}
+	var none types.EncryptionKey
+
+	var tests = []struct {
+		prfKey                       int
+		session, initiator, acceptor types.EncryptionKey
+		want                         types.EncryptionKey
+	}{
+		{PRFKeyFull, session, initiator, acceptor, acceptor},
+		{PRFKeyFull, session, initiator, none, initiator},
+		{PRFKeyFull, session, none, none, session},
+		{PRFKeyPartial, session, initiator, acceptor, initiator},
+		{PRFKeyPartial, session, none, acceptor, session},
+	}
+	for i, test := range tests {
+		k, err := PRFKey(test.prfKey, test.session, test.initiator, test.acceptor)
+		if err != nil {
+			t.Fatalf("test %d: error selecting key: %v", i, err)
+		}
+		assert.Equal(t, test.want, k, "test %d: key selected not as expected", i)
+	}
+	_, err := PRFKey(PRFKeyPartial, none, none, acceptor)
+	assert.Error(t, err, "key should not be selected without a session key")
+	_, err = PRFKey(2, session, none, none)
+	assert.Error(t, err, "unknown key selector should be rejected")
+}
@@ -0,0 +1,102 @@
+package gssapi
+
+import "fmt"
+
+// RFC 2743, section 1.2.3
+
+// defaultSeqWindow is the number of sequence numbers before the highest received that are tracked for replays.
+const defaultSeqWindow = 64
+
+// SequencePolicy sets which of the per-message tokens received on a security context are rejected for their sequence
+// numbers. Tokens rejected return a Status error with one of the supplementary codes StatusDuplicateToken,
+// StatusOldToken, StatusUnseqToken or StatusGapToken.
+type SequencePolicy struct {
+	// RejectReplays rejects tokens that have already been received, and those too old to be checked.
+	RejectReplays bool
+	// RejectOutOfSequence rejects tokens received out of sequence, or after a gap in the sequence, as well as replays.
+	RejectOutOfSequence bool
+	// Window is the number of sequence numbers before the highest received that are tracked for replays, at most 64.
+	// If zero a window of 64 is used.
+	Window int
+}
+
+// seqState tracks the sequence numbers of the tokens received on a security context.
+type seqState struct {
+	base     uint64 // initial sequence number
+	next     uint64 // sequence number expected next
+	received uint64 // bitmap of the sequence numbers before next that have been received, bit 0 being next-1
+}
+
+func newSeqState(initial uint64) seqState {
+	return seqState{base: initial, next: initial}
+}
+
+// check records the sequence number received and returns the supplementary status code of its position in the
+// sequence, or zero if it is the next expected.
+func (s *seqState) check(seq uint64, window int) int {
+	if window <= 0 || window > defaultSeqWindow {
+		window = defaultSeqWindow
+	}
+	switch {
+	case seq == s.next:
+		s.received = s.received<<1 | 1
+		s.next++
+		return 0
+	case seq > s.next:
+		gap := seq - s.next + 1
+		if gap >= 64 {
+			s.received = 1
+		} else {
+			s.received = s.received<<gap | 1
+		}
+		s.next = seq + 1
+		return StatusGapToken
+	case seq < s.base || s.next-seq > uint64(window):
+		return StatusOldToken
+	}
+	bit := uint64(1) << (s.next - seq - 1)
+	if s.received&bit != 0 {
+		return StatusDuplicateToken
+	}
+	s.received |= bit
+	return StatusUnseqToken
+}
+
+// checkRecvSeqNum records the sequence number of a token received, whose integrity has been verified, and returns a
+// Status error if the sequence policy of the context rejects it.
+func (c *SecurityContext) checkRecvSeqNum(seq uint64) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.exported {
+		return errExported
+	}
+	code := c.recv.check(seq, c.seqPolicy.Window)
+	switch code {
+	case 0:
+		return nil
+	case StatusDuplicateToken, StatusOldToken:
+		if !c.seqPolicy.RejectReplays && !c.seqPolicy.RejectOutOfSequence {
+			return nil
+		}
+	case StatusUnseqToken, StatusGapToken:
+		if !c.seqPolicy.RejectOutOfSequence {
+			return nil
+		}
+	}
+	return Status{Code: code, Message: fmt.Sprintf("token sequence number %d", seq)}
+}
+
+// SetSequencePolicy sets the sequence policy of the security context, replacing that of its ContextFlagReplay and
+// ContextFlagSequence flags.
+func (c *SecurityContext) SetSequencePolicy(p SequencePolicy) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.seqPolicy = p
+}
+
+// SequencePolicy returns the sequence policy of the security context.
+func (c *SecurityContext) SequencePolicy() SequencePolicy {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.seqPolicy
+}
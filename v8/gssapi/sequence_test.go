@@ -0,0 +1,93 @@
+package gssapi
+
+import (
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeqState_Check(t *testing.T) {
+	t.Parallel()
+	s := newSeqState(10)
+	var tests = []struct {
+		seq  uint64
+		want int
+	}{
+		{10, 0},
+		{11, 0},
+		{11, StatusDuplicateToken},
+		{14, StatusGapToken},
+		{12, StatusUnseqToken},
+		{12, StatusDuplicateToken},
+		{13, StatusUnseqToken},
+		{15, 0},
+		{9, StatusOldToken},
+		{100, StatusGapToken},
+		{37, StatusUnseqToken},
+		{36, StatusOldToken},
+		{10, StatusOldToken},
+	}
+	for i, test := range tests {
+		assert.Equal(t, test.want, s.check(test.seq, 64), "test %d: status of sequence number %d not as expected", i, test.seq)
+	}
+
+	// A smaller window treats sequence numbers outside it as old
+	s = newSeqState(0)
+	for seq := uint64(0); seq < 20; seq++ {
+		if seq == 5 {
+			continue
+		}
+		s.check(seq, 8)
+	}
+	assert.Equal(t, StatusOldToken, s.check(5, 8), "sequence number outside the window should be old")
+	assert.Equal(t, StatusDuplicateToken, s.check(15, 8), "sequence number inside the window should be a duplicate")
+}
+
+func TestSecurityContext_SequencePolicy(t *testing.T) {
+	t.Parallel()
+	keys := ContextKeys{SessionKey: testKey(t, etypeID.AES256_CTS_HMAC_SHA1_96)}
+	ini := NewSecurityContext(true, ContextFlagReplay, keys, 0, 0)
+	acc := NewSecurityContext(false, ContextFlagReplay, keys, 0, 0)
+	assert.Equal(t, SequencePolicy{RejectReplays: true}, acc.SequencePolicy(), "policy from the context flags not as expected")
+
+	var tokens [][]byte
+	for i := 0; i < 3; i++ {
+		b, err := ini.Wrap([]byte("message"), true)
+		if err != nil {
+			t.Fatalf("error wrapping message: %v", err)
+		}
+		tokens = append(tokens, b)
+	}
+	mic, err := ini.GetMIC([]byte("message"))
+	if err != nil {
+		t.Fatalf("error getting MIC: %v", err)
+	}
+
+	// Out of sequence tokens are accepted when only replays are rejected
+	_, _, err = acc.Unwrap(tokens[1])
+	assert.NoError(t, err, "first token received should be accepted")
+	_, _, err = acc.Unwrap(tokens[0])
+	assert.NoError(t, err, "out of sequence token should be accepted")
+	_, _, err = acc.Unwrap(tokens[1])
+	if assert.Error(t, err, "replayed token should be rejected") {
+		assert.Equal(t, StatusDuplicateToken, err.(Status).Code, "status of replayed token not as expected")
+	}
+	assert.NoError(t, acc.VerifyMIC([]byte("message"), mic), "MIC after a gap should be accepted")
+	err = acc.VerifyMIC([]byte("message"), mic)
+	if assert.Error(t, err, "replayed MIC should be rejected") {
+		assert.Equal(t, StatusDuplicateToken, err.(Status).Code, "status of replayed MIC not as expected")
+	}
+
+	// Out of sequence tokens are rejected when sequencing is required
+	acc.SetSequencePolicy(SequencePolicy{RejectOutOfSequence: true})
+	_, _, err = acc.Unwrap(tokens[2])
+	if assert.Error(t, err, "out of sequence token should be rejected") {
+		assert.Equal(t, StatusUnseqToken, err.(Status).Code, "status of out of sequence token not as expected")
+	}
+
+	// Without detection tokens are accepted whatever their sequence number
+	acc.SetSequencePolicy(SequencePolicy{})
+	_, _, err = acc.Unwrap(tokens[0])
+	assert.NoError(t, err, "replayed token should be accepted without replay detection")
+}
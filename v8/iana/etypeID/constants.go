@@ -76,26 +76,64 @@ var ETypesByName = map[string]int32{
 	"subkey-keymaterial":           SUBKEY_KEYMATERIAL,
 }
 
+// ETypeNames is a map of EncType numbers to their canonical names.
+var ETypeNames = map[int32]string{
+	DES_CBC_CRC:                  "des-cbc-crc",
+	DES_CBC_MD4:                  "des-cbc-md4",
+	DES_CBC_MD5:                  "des-cbc-md5",
+	DES_CBC_RAW:                  "des-cbc-raw",
+	DES3_CBC_MD5:                 "des3-cbc-md5",
+	DES3_CBC_RAW:                 "des3-cbc-raw",
+	DES3_CBC_SHA1:                "des3-cbc-sha1",
+	DES_HMAC_SHA1:                "des-hmac-sha1",
+	DSAWITHSHA1_CMSOID:           "dsaWithSHA1-CmsOID",
+	MD5WITHRSAENCRYPTION_CMSOID:  "md5WithRSAEncryption-CmsOID",
+	SHA1WITHRSAENCRYPTION_CMSOID: "sha1WithRSAEncryption-CmsOID",
+	RC2CBC_ENVOID:                "rc2CBC-EnvOID",
+	RSAENCRYPTION_ENVOID:         "rsaEncryption-EnvOID",
+	RSAES_OAEP_ENV_OID:           "rsaES-OAEP-ENV-OID",
+	DES_EDE3_CBC_ENV_OID:         "des-ede3-cbc-Env-OID",
+	DES3_CBC_SHA1_KD:             "des3-cbc-sha1-kd",
+	AES128_CTS_HMAC_SHA1_96:      "aes128-cts-hmac-sha1-96",
+	AES256_CTS_HMAC_SHA1_96:      "aes256-cts-hmac-sha1-96",
+	AES128_CTS_HMAC_SHA256_128:   "aes128-cts-hmac-sha256-128",
+	AES256_CTS_HMAC_SHA384_192:   "aes256-cts-hmac-sha384-192",
+	RC4_HMAC:                     "arcfour-hmac",
+	RC4_HMAC_EXP:                 "arcfour-hmac-exp",
+	CAMELLIA128_CTS_CMAC:         "camellia128-cts-cmac",
+	CAMELLIA256_CTS_CMAC:         "camellia256-cts-cmac",
+	SUBKEY_KEYMATERIAL:           "subkey-keymaterial",
+}
+
+// supported is the set of the IDs of the encryption types implemented by gokrb5 or registered with it.
+var supported = map[int32]bool{
+	AES128_CTS_HMAC_SHA1_96:    true,
+	AES256_CTS_HMAC_SHA1_96:    true,
+	AES128_CTS_HMAC_SHA256_128: true,
+	AES256_CTS_HMAC_SHA384_192: true,
+	DES3_CBC_SHA1_KD:           true,
+	RC4_HMAC:                   true,
+}
+
+// AddSupported marks the encryption type ID as supported, adding the names provided to ETypesByName and the first
+// name as the canonical name in ETypeNames if it has none. It is called when an encryption type implementation is
+// registered with crypto.RegisterEtype and like it is not safe to call concurrently with the use of encryption types.
+func AddSupported(id int32, names ...string) {
+	supported[id] = true
+	for _, n := range names {
+		ETypesByName[n] = id
+	}
+	if _, ok := ETypeNames[id]; !ok && len(names) > 0 {
+		ETypeNames[id] = names[0]
+	}
+}
+
 // EtypeSupported resolves the etype name string to the etype ID.
 // If zero is returned the etype is not supported by gokrb5.
 func EtypeSupported(etype string) int32 {
-	// Slice of supported enctype IDs
-	s := []int32{
-		AES128_CTS_HMAC_SHA1_96,
-		AES256_CTS_HMAC_SHA1_96,
-		AES128_CTS_HMAC_SHA256_128,
-		AES256_CTS_HMAC_SHA384_192,
-		DES3_CBC_SHA1_KD,
-		RC4_HMAC,
-	}
 	id := ETypesByName[etype]
-	if id == 0 {
-		return id
-	}
-	for _, sid := range s {
-		if id == sid {
-			return id
-		}
+	if !supported[id] {
+		return 0
 	}
-	return 0
+	return id
 }
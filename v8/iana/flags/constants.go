@@ -17,17 +17,25 @@ const (
 	PreAuthent             = 10
 	HWAuthent              = 11
 	OptHardwareAuth        = 11
-	RequestAnonymous       = 12
 	TransitedPolicyChecked = 12
 	OKAsDelegate           = 13
+	Anonymous              = 14
+	CNameInAddlTkt         = 14 // MS-SFU
 	EncPARep               = 15
 	Canonicalize           = 15
+	RequestAnonymous       = 16 // RFC 6112
 	DisableTransitedCheck  = 26
 	RenewableOK            = 27
 	EncTktInSkey           = 28
 	Renew                  = 30
 	Validate               = 31
 
+	// PAC Option Flags (MS-KILE)
+	PACOptionClaims                             = 0
+	PACOptionBranchAware                        = 1
+	PACOptionForwardToFullDC                    = 2
+	PACOptionResourceBasedConstrainedDelegation = 3
+
 	// AP Option Flags
 	// 0 Reserved for future use.
 	APOptionUseSessionKey  = 1
@@ -27,6 +27,7 @@ const (
 	GSSAPI_ACCEPTOR_SIGN           = 23
 	GSSAPI_INITIATOR_SEAL          = 24
 	GSSAPI_INITIATOR_SIGN          = 25
+	KEY_USAGE_PA_OTP_REQUEST       = 45
 	KEY_USAGE_FAST_REQ_CHKSUM      = 50
 	KEY_USAGE_FAST_ENC             = 51
 	KEY_USAGE_FAST_REP             = 52
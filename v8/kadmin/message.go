@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"time"
 
 	"github.com/Osirium/gokrb5/v8/messages"
 	"github.com/Osirium/gokrb5/v8/types"
@@ -68,12 +69,21 @@ func (m *Request) Marshal() (b []byte, err error) {
 
 // Unmarshal a byte slice into a Reply.
 func (m *Reply) Unmarshal(b []byte) error {
+	if len(b) < 6 {
+		return fmt.Errorf("kadmin reply too short: %d bytes", len(b))
+	}
 	m.MessageLength = int(binary.BigEndian.Uint16(b[0:2]))
+	if m.MessageLength < 6 || m.MessageLength > len(b) {
+		return fmt.Errorf("kadmin reply message length %d not valid for %d bytes received", m.MessageLength, len(b))
+	}
 	m.Version = int(binary.BigEndian.Uint16(b[2:4]))
 	if m.Version != 1 {
 		return fmt.Errorf("kadmin reply has incorrect protocol version number: %d", m.Version)
 	}
 	m.APREPLength = int(binary.BigEndian.Uint16(b[4:6]))
+	if 6+m.APREPLength > m.MessageLength {
+		return fmt.Errorf("kadmin reply AP_REP length %d exceeds the message length %d", m.APREPLength, m.MessageLength)
+	}
 	if m.APREPLength != 0 {
 		err := m.APREP.Unmarshal(b[6 : 6+m.APREPLength])
 		if err != nil {
@@ -92,6 +102,9 @@ func (m *Reply) Unmarshal(b []byte) error {
 }
 
 func parseResponse(b []byte) (c uint16, s string) {
+	if len(b) < 2 {
+		return
+	}
 	c = binary.BigEndian.Uint16(b[0:2])
 	buf := bytes.NewBuffer(b[2:])
 	m := make([]byte, len(b)-2)
@@ -112,3 +125,40 @@ func (m *Reply) Decrypt(key types.EncryptionKey) error {
 	m.ResultCode, m.Result = parseResponse(m.KRBPriv.DecryptedEncPart.UserData)
 	return nil
 }
+
+// ADPasswordPolicy is the password policy Active Directory returns in the result string of a reply that rejects a
+// password for not meeting the policy.
+type ADPasswordPolicy struct {
+	MinLength  uint32
+	History    uint32
+	Properties uint32
+	MaxAge     time.Duration
+	MinAge     time.Duration
+}
+
+// adPolicyLength is the length of the result string holding Active Directory's password policy.
+const adPolicyLength = 30
+
+// adPolicyComplex is the password properties flag that indicates passwords must meet complexity requirements.
+const adPolicyComplex = 1
+
+// Complex indicates if the policy requires passwords to meet complexity requirements.
+func (p ADPasswordPolicy) Complex() bool {
+	return p.Properties&adPolicyComplex != 0
+}
+
+// ADPolicy returns the Active Directory password policy from the result string of the reply, if it holds one.
+func (m *Reply) ADPolicy() (ADPasswordPolicy, bool) {
+	var p ADPasswordPolicy
+	b := []byte(m.Result)
+	if len(b) != adPolicyLength || b[0] != 0 || b[1] != 0 {
+		return p, false
+	}
+	p.MinLength = binary.BigEndian.Uint32(b[2:6])
+	p.History = binary.BigEndian.Uint32(b[6:10])
+	p.Properties = binary.BigEndian.Uint32(b[10:14])
+	// Ages are in 100 nanosecond intervals
+	p.MaxAge = time.Duration(binary.BigEndian.Uint64(b[14:22])) * 100
+	p.MinAge = time.Duration(binary.BigEndian.Uint64(b[22:30])) * 100
+	return p, true
+}
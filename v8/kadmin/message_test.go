@@ -1,8 +1,10 @@
 package kadmin
 
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"testing"
+	"time"
 
 	"github.com/Osirium/gokrb5/v8/iana"
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
@@ -33,3 +35,35 @@ func TestUnmarshalReply(t *testing.T) {
 }
 
 // Request marshal is tested via integration test in the client package due to the dynamic keys and encryption.
+
+func TestReply_ADPolicy(t *testing.T) {
+	t.Parallel()
+	b := make([]byte, adPolicyLength)
+	binary.BigEndian.PutUint32(b[2:6], 7)
+	binary.BigEndian.PutUint32(b[6:10], 24)
+	binary.BigEndian.PutUint32(b[10:14], adPolicyComplex)
+	binary.BigEndian.PutUint64(b[14:22], uint64(42*24*time.Hour/100))
+	binary.BigEndian.PutUint64(b[22:30], uint64(24*time.Hour/100))
+	r := Reply{Result: string(b)}
+	p, ok := r.ADPolicy()
+	if !ok {
+		t.Fatal("AD password policy not found in result string")
+	}
+	assert.Equal(t, uint32(7), p.MinLength, "minimum length not as expected")
+	assert.Equal(t, uint32(24), p.History, "history not as expected")
+	assert.True(t, p.Complex(), "complexity not as expected")
+	assert.Equal(t, 42*24*time.Hour, p.MaxAge, "maximum age not as expected")
+	assert.Equal(t, 24*time.Hour, p.MinAge, "minimum age not as expected")
+
+	r = Reply{Result: "Password change rejected"}
+	_, ok = r.ADPolicy()
+	assert.False(t, ok, "AD password policy not expected in a text result string")
+}
+
+func TestReply_UnmarshalShort(t *testing.T) {
+	t.Parallel()
+	var r Reply
+	assert.Error(t, r.Unmarshal([]byte{0, 4}), "error expected for a reply that is too short")
+	assert.Error(t, r.Unmarshal([]byte{0, 100, 0, 1, 0, 0}), "error expected for a message length beyond the reply")
+	assert.Error(t, r.Unmarshal([]byte{0, 6, 0, 1, 0, 10}), "error expected for an AP_REP length beyond the message")
+}
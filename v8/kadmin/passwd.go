@@ -10,11 +10,17 @@ import (
 
 // ChangePasswdMsg generate a change password request and also return the key needed to decrypt the reply.
 func ChangePasswdMsg(cname types.PrincipalName, realm, password string, tkt messages.Ticket, sessionKey types.EncryptionKey) (r Request, k types.EncryptionKey, err error) {
+	return SetPasswdMsg(cname, realm, cname, realm, password, tkt, sessionKey)
+}
+
+// SetPasswdMsg generates a request to set the password of the target principal (RFC 3244) and also returns the key
+// needed to decrypt the reply. The ticket provided is the client's ticket for the kadmin/changepw service.
+func SetPasswdMsg(cname types.PrincipalName, realm string, targName types.PrincipalName, targRealm, password string, tkt messages.Ticket, sessionKey types.EncryptionKey) (r Request, k types.EncryptionKey, err error) {
 	// Create change password data struct and marshal to bytes
 	chgpasswd := ChangePasswdData{
 		NewPasswd: []byte(password),
-		TargName:  cname,
-		TargRealm: realm,
+		TargName:  targName,
+		TargRealm: targRealm,
 	}
 	chpwdb, err := chgpasswd.Marshal()
 	if err != nil {
@@ -0,0 +1,48 @@
+package kadmin
+
+import (
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetPasswdMsg(t *testing.T) {
+	t.Parallel()
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, _ := types.GenerateEncryptionKey(et)
+	tkt := messages.Ticket{
+		TktVNO:  5,
+		Realm:   testdata.TEST_REALM,
+		SName:   types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "kadmin/changepw"),
+		EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte("cipher")},
+	}
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "admin")
+	targName := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	r, key, err := SetPasswdMsg(cname, testdata.TEST_REALM, targName, testdata.TEST_REALM, "newpassword", tkt, sessionKey)
+	if err != nil {
+		t.Fatalf("error creating set password message: %v", err)
+	}
+	_, err = r.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling set password message: %v", err)
+	}
+	err = r.KRBPriv.DecryptEncPart(key)
+	if err != nil {
+		t.Fatalf("error decrypting KRB_PRIV with the key returned: %v", err)
+	}
+	var d ChangePasswdData
+	_, err = asn1.Unmarshal(r.KRBPriv.DecryptedEncPart.UserData, &d)
+	if err != nil {
+		t.Fatalf("error unmarshaling change passwd data: %v", err)
+	}
+	assert.Equal(t, []byte("newpassword"), d.NewPasswd, "new password not as expected")
+	assert.True(t, targName.Equal(d.TargName), "target name not as expected")
+	assert.Equal(t, testdata.TEST_REALM, d.TargRealm, "target realm not as expected")
+}
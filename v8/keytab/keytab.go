@@ -9,6 +9,8 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 	"unsafe"
@@ -22,6 +24,9 @@ const (
 )
 
 // Keytab struct.
+//
+// The methods that read a Keytab, such as GetKey, may be called concurrently. A Keytab must not be modified while it
+// is in use by other goroutines; use a Store for a keytab that changes while services are using it.
 type Keytab struct {
 	version uint8
 	Entries []entry
@@ -98,6 +103,43 @@ func (kt *Keytab) GetEncryptionKey(princName types.PrincipalName, realm string,
 	return key, kv, nil
 }
 
+// GetKey returns the EncryptionKey from the Keytab for the entry with the principal, realm, kvno and etype provided,
+// along with the kvno of the entry. This is the key a service should use to decrypt a ticket issued to it, as after a
+// key rotation the keytab may hold entries for several kvnos of the same principal and etype.
+//
+// If the kvno is zero, as when a ticket does not specify one, the entry with the highest kvno is returned.
+// Keytab entries that only hold an 8 bit kvno match a kvno with the same low 8 bits when there is no exact match.
+func (kt *Keytab) GetKey(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error) {
+	var exact, truncated *entry
+	for i := range kt.Entries {
+		k := &kt.Entries[i]
+		if k.Principal.Realm != realm || k.Key.KeyType != etype || !k.Principal.matches(princName) {
+			continue
+		}
+		switch {
+		case kvno == 0:
+			if exact == nil || k.KVNO > exact.KVNO || (k.KVNO == exact.KVNO && k.Timestamp.After(exact.Timestamp)) {
+				exact = k
+			}
+		case k.KVNO == uint32(kvno):
+			if exact == nil || k.Timestamp.After(exact.Timestamp) {
+				exact = k
+			}
+		case k.KVNO < 256 && uint8(k.KVNO) == uint8(kvno):
+			if truncated == nil || k.Timestamp.After(truncated.Timestamp) {
+				truncated = k
+			}
+		}
+	}
+	if exact == nil {
+		exact = truncated
+	}
+	if exact == nil || len(exact.Key.KeyValue) < 1 {
+		return types.EncryptionKey{}, 0, fmt.Errorf("matching key not found in keytab. Looking for %v realm: %v kvno: %v etype: %v", princName.NameString, realm, kvno, etype)
+	}
+	return exact.Key, int(exact.KVNO), nil
+}
+
 // Create a new Keytab entry.
 func newEntry() entry {
 	var b []byte
@@ -125,13 +167,37 @@ func (kt Keytab) String() string {
 }
 
 // AddEntry adds an entry to the keytab. The password should be provided in plain text and it will be converted using the defined enctype to be stored.
+// The key is derived with the default salt for the principal: the realm followed by the principal's name components.
 func (kt *Keytab) AddEntry(principalName, realm, password string, ts time.Time, KVNO uint8, encType int32) error {
-	// Generate a key from the password
+	return kt.AddEntryWithSalt(principalName, realm, password, "", ts, uint32(KVNO), encType)
+}
+
+// AddEntryWithSalt adds an entry to the keytab with a key derived from the plain text password using the string to key
+// function of the enctype (RFC 3961 and RFC 3962) and the salt provided.
+// If the salt is an empty string the default salt for the principal is used. A salt needs to be provided where the KDC
+// uses a different one, such as for Active Directory computer accounts.
+func (kt *Keytab) AddEntryWithSalt(principalName, realm, password, salt string, ts time.Time, kvno uint32, encType int32) error {
 	princ, _ := types.ParseSPNString(principalName)
-	key, _, err := crypto.GetKeyFromPassword(password, princ, realm, encType, types.PADataSequence{})
+	if salt == "" {
+		salt = princ.GetSalt(realm)
+	}
+	et, err := crypto.GetEtype(encType)
 	if err != nil {
-		return err
+		return fmt.Errorf("error getting encryption type: %v", err)
+	}
+	k, err := et.StringToKey(password, salt, et.GetDefaultStringToKeyParams())
+	if err != nil {
+		return fmt.Errorf("error deriving key from password: %v", err)
 	}
+	return kt.AddKey(principalName, realm, types.EncryptionKey{KeyType: encType, KeyValue: k}, ts, kvno)
+}
+
+// AddKey adds an entry to the keytab with the key provided.
+func (kt *Keytab) AddKey(principalName, realm string, key types.EncryptionKey, ts time.Time, kvno uint32) error {
+	if len(key.KeyValue) == 0 {
+		return errors.New("key value is empty")
+	}
+	princ, _ := types.ParseSPNString(principalName)
 
 	// Populate the keytab entry principal
 	ktep := newPrincipal()
@@ -148,8 +214,8 @@ func (kt *Keytab) AddEntry(principalName, realm, password string, ts time.Time,
 	e := newEntry()
 	e.Principal = ktep
 	e.Timestamp = ts
-	e.KVNO8 = KVNO
-	e.KVNO = uint32(KVNO)
+	e.KVNO8 = uint8(kvno)
+	e.KVNO = kvno
 	e.Key = key
 
 	kt.Entries = append(kt.Entries, e)
@@ -167,6 +233,37 @@ func newPrincipal() principal {
 	}
 }
 
+// Principals returns the distinct principal names in the keytab for the realm provided, in the order they first appear.
+func (kt *Keytab) Principals(realm string) []types.PrincipalName {
+	var pns []types.PrincipalName
+	seen := make(map[string]bool)
+	for _, e := range kt.Entries {
+		if e.Principal.Realm != realm || seen[e.Principal.String()] {
+			continue
+		}
+		seen[e.Principal.String()] = true
+		pns = append(pns, types.PrincipalName{
+			NameType:   e.Principal.NameType,
+			NameString: append([]string(nil), e.Principal.Components...),
+		})
+	}
+	return pns
+}
+
+// matches indicates if the principal has the same name components as the PrincipalName provided.
+// The name type is not compared as it is not always set consistently by the tools that create keytabs.
+func (p principal) matches(pn types.PrincipalName) bool {
+	if len(p.Components) != len(pn.NameString) {
+		return false
+	}
+	for i, n := range p.Components {
+		if pn.NameString[i] != n {
+			return false
+		}
+	}
+	return true
+}
+
 // Load a Keytab file into a Keytab type.
 func Load(ktPath string) (*Keytab, error) {
 	kt := new(Keytab)
@@ -175,18 +272,58 @@ func Load(ktPath string) (*Keytab, error) {
 		return kt, err
 	}
 	err = kt.Unmarshal(b)
+	// The keys are copied out of the file's data so it is zeroed to not leave them in memory
+	zeroBytes(b)
 	return kt, err
 }
 
-// Marshal keytab into byte slice
+// DefaultKeytabPath is the path of the keytab loaded by LoadDefault if KRB5_KTNAME is not set.
+const DefaultKeytabPath = "/etc/krb5.keytab"
+
+// LoadName loads the keytab of an MIT Kerberos style keytab name, such as the value of KRB5_KTNAME or of the
+// default_keytab_name relation of krb5.conf. The name is a file path with an optional FILE: or WRFILE: prefix.
+func LoadName(name string) (*Keytab, error) {
+	p := name
+	if i := strings.Index(name, ":"); i > 1 {
+		// Windows style paths such as C:\ have a single character before the colon so are treated as files
+		switch t := strings.ToUpper(name[:i]); t {
+		case "FILE", "WRFILE":
+			p = name[i+1:]
+		default:
+			return new(Keytab), fmt.Errorf("keytab type %s is not supported", t)
+		}
+	}
+	if p == "" {
+		return new(Keytab), fmt.Errorf("keytab name %s does not specify a file path", name)
+	}
+	return Load(p)
+}
+
+// LoadDefault loads the keytab named by the KRB5_KTNAME environment variable, as MIT Kerberos services use by
+// default, or if it is not set the keytab at DefaultKeytabPath.
+func LoadDefault() (*Keytab, error) {
+	name := os.Getenv("KRB5_KTNAME")
+	if name == "" {
+		name = DefaultKeytabPath
+	}
+	return LoadName(name)
+}
+
+// Marshal keytab into byte slice using the 0x502 keytab file format, or 0x501 if the keytab was loaded from data in that format.
 func (kt *Keytab) Marshal() ([]byte, error) {
-	b := []byte{keytabFirstByte, kt.version}
+	v := kt.version
+	if v == 0 {
+		// Keytab not created with New or loaded from data
+		v = 2
+	}
+	b := []byte{keytabFirstByte, v}
 	for _, e := range kt.Entries {
-		eb, err := e.marshal(int(kt.version))
+		eb, err := e.marshal(int(v))
 		if err != nil {
 			return b, err
 		}
 		b = append(b, eb...)
+		zeroBytes(eb)
 	}
 	return b, nil
 }
@@ -195,12 +332,42 @@ func (kt *Keytab) Marshal() ([]byte, error) {
 // Returns the number of bytes written
 func (kt *Keytab) Write(w io.Writer) (int, error) {
 	b, err := kt.Marshal()
+	defer zeroBytes(b)
 	if err != nil {
 		return 0, fmt.Errorf("error marshaling keytab: %v", err)
 	}
 	return w.Write(b)
 }
 
+// Save writes the keytab to the file at the path provided with mode 0600.
+// The keytab is written to a temporary file in the same directory which then replaces the file, so that services
+// reading the file never see a partially written keytab.
+func (kt *Keytab) Save(ktPath string) error {
+	b, err := kt.Marshal()
+	defer zeroBytes(b)
+	if err != nil {
+		return fmt.Errorf("error marshaling keytab: %v", err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(ktPath), "."+filepath.Base(ktPath)+".")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), ktPath)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
 // Unmarshal byte slice of Keytab data into Keytab type.
 func (kt *Keytab) Unmarshal(b []byte) error {
 	if len(b) < 2 {
@@ -317,19 +484,19 @@ func (e entry) marshal(v int) ([]byte, error) {
 		endian = binary.LittleEndian
 	}
 
+	kvno8 := e.KVNO8
+	if kvno8 == 0 {
+		// Only the low 8 bits of the key version are held in the 8 bit field
+		kvno8 = uint8(e.KVNO)
+	}
 	t := make([]byte, 9)
 	endian.PutUint32(t[0:4], uint32(e.Timestamp.Unix()))
-	t[4] = e.KVNO8
+	t[4] = kvno8
 	endian.PutUint16(t[5:7], uint16(e.Key.KeyType))
 	endian.PutUint16(t[7:9], uint16(len(e.Key.KeyValue)))
 	b = append(b, t...)
 
-	buf := new(bytes.Buffer)
-	err = binary.Write(buf, endian, e.Key.KeyValue)
-	if err != nil {
-		return b, err
-	}
-	b = append(b, buf.Bytes()...)
+	b = append(b, e.Key.KeyValue...)
 
 	t = make([]byte, 4)
 	endian.PutUint32(t, e.KVNO)
@@ -391,7 +558,12 @@ func (p principal) marshal(v int) ([]byte, error) {
 	if v == 1 && isNativeEndianLittle() {
 		endian = binary.LittleEndian
 	}
-	endian.PutUint16(b[0:], uint16(p.NumComponents))
+	nc := len(p.Components)
+	if v == 1 {
+		//In version 1 the number of components includes the realm
+		nc++
+	}
+	endian.PutUint16(b[0:], uint16(nc))
 	realm, err := marshalString(p.Realm, v)
 	if err != nil {
 		return b, err
@@ -430,13 +602,14 @@ func marshalString(s string, v int) ([]byte, error) {
 	return b, err
 }
 
-// Read bytes representing a timestamp.
+// Read bytes representing a timestamp. As MIT Kerberos does, the timestamp is read as an unsigned integer so that
+// timestamps beyond 2038 are valid, until 2106.
 func readTimestamp(b []byte, p *int, e *binary.ByteOrder) (time.Time, error) {
 	i32, err := readInt32(b, p, e)
 	if err != nil {
 		return time.Time{}, err
 	}
-	return time.Unix(int64(i32), 0), nil
+	return time.Unix(int64(uint32(i32)), 0), nil
 }
 
 // Read bytes representing an eight bit integer.
@@ -494,15 +667,19 @@ func readBytes(b []byte, p *int, s int, e *binary.ByteOrder) ([]byte, error) {
 	if i > len(b) {
 		return nil, fmt.Errorf("%s's length is greater than %d", b, i)
 	}
-	buf := bytes.NewBuffer(b[*p:i])
 	r := make([]byte, s)
-	if err := binary.Read(buf, *e, &r); err != nil {
-		return nil, err
-	}
+	copy(r, b[*p:i])
 	*p += s
 	return r, nil
 }
 
+// zeroBytes overwrites the bytes with zeros.
+func zeroBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
 func isNativeEndianLittle() bool {
 	var x = 0x012345678
 	var p = unsafe.Pointer(&x)
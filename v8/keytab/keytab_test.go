@@ -1,11 +1,14 @@
 package keytab
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
 	"time"
 
@@ -55,6 +58,117 @@ func TestMarshal(t *testing.T) {
 	}
 }
 
+func TestWrite(t *testing.T) {
+	t.Parallel()
+	kt := new(Keytab)
+	ts := time.Unix(1600000000, 0)
+	err := kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", ts, 1, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error adding entry: %v", err)
+	}
+	err = kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", ts.Add(time.Hour), 2, etypeID.AES128_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error adding entry: %v", err)
+	}
+	kt.Entries[1].KVNO = 300
+	kt.Entries[1].KVNO8 = 0
+	var buf bytes.Buffer
+	n, err := kt.Write(&buf)
+	if err != nil {
+		t.Fatalf("Error writing keytab: %v", err)
+	}
+	assert.Equal(t, buf.Len(), n, "Number of bytes written not as expected")
+	assert.Equal(t, []byte{5, 2}, buf.Bytes()[:2], "Keytab not written in the 0x502 format")
+	rkt := New()
+	err = rkt.Unmarshal(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Error parsing written keytab: %v", err)
+	}
+	assert.Equal(t, 2, len(rkt.Entries), "Number of entries not as expected")
+	for i, e := range rkt.Entries {
+		assert.Equal(t, kt.Entries[i].Principal.Components, e.Principal.Components, "Principal not as expected")
+		assert.Equal(t, kt.Entries[i].Principal.Realm, e.Principal.Realm, "Realm not as expected")
+		assert.Equal(t, kt.Entries[i].Principal.NameType, e.Principal.NameType, "Name type not as expected")
+		assert.True(t, kt.Entries[i].Timestamp.Equal(e.Timestamp), "Timestamp not as expected")
+		assert.Equal(t, kt.Entries[i].Key, e.Key, "Key not as expected")
+	}
+	assert.Equal(t, uint32(1), rkt.Entries[0].KVNO, "KVNO not as expected")
+	assert.Equal(t, uint32(300), rkt.Entries[1].KVNO, "32 bit KVNO not as expected")
+	assert.Equal(t, uint8(44), rkt.Entries[1].KVNO8, "8 bit KVNO not as expected")
+
+	// Version 1 counts the realm as a principal component
+	rkt.version = 1
+	b, err := rkt.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling version 1 keytab: %v", err)
+	}
+	v1 := New()
+	err = v1.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing version 1 keytab: %v", err)
+	}
+	assert.Equal(t, 2, len(v1.Entries), "Number of version 1 entries not as expected")
+	assert.Equal(t, kt.Entries[0].Principal.Components, v1.Entries[0].Principal.Components, "Version 1 principal not as expected")
+	assert.Equal(t, kt.Entries[0].Key, v1.Entries[0].Key, "Version 1 key not as expected")
+}
+
+func TestUnmarshal_TimestampBeyond2038(t *testing.T) {
+	t.Parallel()
+	kt := new(Keytab)
+	ts := time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", ts, 2, etypeID.AES256_CTS_HMAC_SHA1_96); err != nil {
+		t.Fatalf("Error adding entry: %v", err)
+	}
+	b, err := kt.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling keytab: %v", err)
+	}
+	kt2 := new(Keytab)
+	if err := kt2.Unmarshal(b); err != nil {
+		t.Fatalf("Error unmarshaling keytab: %v", err)
+	}
+	assert.True(t, ts.Equal(kt2.Entries[0].Timestamp), "timestamp not as expected: %v", kt2.Entries[0].Timestamp)
+}
+
+func TestKeytab_AddEntryWithSalt(t *testing.T) {
+	t.Parallel()
+	ts := time.Unix(1600000000, 0)
+	kt := New()
+	err := kt.AddEntry("host/pc1.example.org", "EXAMPLE.ORG", "hello123", ts, 3, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error adding entry: %v", err)
+	}
+	err = kt.AddEntryWithSalt("host/pc1.example.org", "EXAMPLE.ORG", "hello123", "EXAMPLE.ORGhostpc1.example.org", ts, 3, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error adding entry with default salt: %v", err)
+	}
+	assert.Equal(t, kt.Entries[0].Key, kt.Entries[1].Key, "Explicit default salt should derive the same key")
+
+	// Active Directory computer accounts are salted with the realm, "host" and the lower case host name
+	err = kt.AddEntryWithSalt("PC1$", "EXAMPLE.ORG", "hello123", "EXAMPLE.ORGhostpc1.example.org", ts, 3, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error adding entry with salt: %v", err)
+	}
+	assert.Equal(t, kt.Entries[0].Key, kt.Entries[2].Key, "Key not derived with the salt provided")
+	assert.Equal(t, []string{"PC1$"}, kt.Entries[2].Principal.Components, "Principal not as expected")
+
+	err = kt.AddEntryWithSalt("PC1$", "EXAMPLE.ORG", "hello123", "", ts, 3, 999)
+	assert.Error(t, err, "Unsupported enctype should return an error")
+
+	err = kt.AddKey("HTTP/www.example.org", "EXAMPLE.ORG", kt.Entries[0].Key, ts, 300)
+	if err != nil {
+		t.Fatalf("Error adding key: %v", err)
+	}
+	key, kvno, err := kt.GetEncryptionKey(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/www.example.org"), "EXAMPLE.ORG", 300, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("Error getting added key: %v", err)
+	}
+	assert.Equal(t, 300, kvno, "KVNO not as expected")
+	assert.Equal(t, kt.Entries[0].Key, key, "Key not as expected")
+	err = kt.AddKey("HTTP/www.example.org", "EXAMPLE.ORG", types.EncryptionKey{KeyType: 18}, ts, 1)
+	assert.Error(t, err, "Empty key should return an error")
+}
+
 func TestLoad(t *testing.T) {
 	t.Parallel()
 	f := "test/testdata/testuser1.testtab"
@@ -99,6 +213,49 @@ func TestLoad(t *testing.T) {
 	}
 }
 
+func TestLoadName(t *testing.T) {
+	t.Parallel()
+	f := "test/testdata/testuser1.testtab"
+	cwd, _ := os.Getwd()
+	dir := os.Getenv("TRAVIS_BUILD_DIR")
+	if dir != "" {
+		f = dir + "/" + f
+	} else if filepath.Base(cwd) == "keytab" {
+		f = "../" + f
+	}
+	for _, name := range []string{f, "FILE:" + f, "WRFILE:" + f} {
+		kt, err := LoadName(name)
+		if err != nil {
+			t.Errorf("could not load keytab %s: %v", name, err)
+			continue
+		}
+		assert.Equal(t, 12, len(kt.Entries), "keytab entry count not as expected for %s", name)
+	}
+	for _, name := range []string{"FILE:", "MEMORY:test", "KDB:"} {
+		_, err := LoadName(name)
+		assert.Error(t, err, "loading keytab %s should be an error", name)
+	}
+}
+
+func TestLoadDefault(t *testing.T) {
+	// Not parallel as the environment is changed
+	defer os.Setenv("KRB5_KTNAME", os.Getenv("KRB5_KTNAME"))
+	b, _ := hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
+	f, err := ioutil.TempFile("", "keytab")
+	if err != nil {
+		t.Fatalf("error creating keytab file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	f.Write(b)
+	f.Close()
+	os.Setenv("KRB5_KTNAME", "FILE:"+f.Name())
+	kt, err := LoadDefault()
+	if err != nil {
+		t.Fatalf("could not load keytab named by KRB5_KTNAME: %v", err)
+	}
+	assert.Equal(t, 12, len(kt.Entries), "keytab entry count not as expected")
+}
+
 // This test provides inputs to readBytes that previously
 // caused a panic.
 func TestReadBytes(t *testing.T) {
@@ -249,3 +406,86 @@ func TestKeytab_GetEncryptionKey(t *testing.T) {
 	}
 	assert.Equal(t, 3, kvno)
 }
+
+func TestKeytab_GetKey(t *testing.T) {
+	t.Parallel()
+	princ := "HTTP/princ.test.gokrb5"
+	realm := "TEST.GOKRB5"
+
+	kt := New()
+	kt.AddEntry(princ, realm, "passwordv1", time.Unix(100, 0), 1, 18)
+	kt.AddEntry(princ, realm, "passwordv2", time.Unix(200, 0), 2, 18)
+	kt.AddEntry(princ, realm, "passwordv2", time.Unix(200, 0), 2, 17)
+	kt.AddEntry(princ, realm, "passwordv3", time.Unix(150, 0), 3, 18)
+	kt.AddKey("HTTP/other.test.gokrb5", realm, types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)}, time.Unix(500, 0), 9)
+	// An entry holding only the low 8 bits of kvno 258
+	kt.AddEntry("host/princ.test.gokrb5", realm, "passwordv258", time.Unix(100, 0), 2, 18)
+
+	pn := types.NewPrincipalName(nametype.KRB_NT_SRV_HST, princ)
+	for _, kvno := range []int{1, 2, 3} {
+		key, kv, err := kt.GetKey(pn, realm, kvno, 18)
+		if err != nil {
+			t.Fatalf("error getting key for kvno %d: %v", kvno, err)
+		}
+		assert.Equal(t, kvno, kv, "kvno of key not as expected")
+		assert.Equal(t, kt.Entries[map[int]int{1: 0, 2: 1, 3: 3}[kvno]].Key, key, "key for kvno %d not as expected", kvno)
+	}
+
+	key, kv, err := kt.GetKey(pn, realm, 2, 17)
+	if err != nil {
+		t.Fatalf("error getting key for etype 17: %v", err)
+	}
+	assert.Equal(t, 2, kv, "kvno of key not as expected")
+	assert.Equal(t, kt.Entries[2].Key, key, "key for etype 17 not as expected")
+
+	// The highest kvno is used when none is specified, regardless of the entry timestamps
+	_, kv, err = kt.GetKey(pn, realm, 0, 18)
+	if err != nil {
+		t.Fatalf("error getting key for kvno 0: %v", err)
+	}
+	assert.Equal(t, 3, kv, "highest kvno not returned when kvno is zero")
+
+	_, _, err = kt.GetKey(pn, realm, 4, 18)
+	assert.Error(t, err, "key returned for kvno not in keytab")
+	_, _, err = kt.GetKey(pn, realm, 3, 17)
+	assert.Error(t, err, "key returned for etype not in keytab")
+	_, _, err = kt.GetKey(pn, "OTHER.GOKRB5", 1, 18)
+	assert.Error(t, err, "key returned for realm not in keytab")
+
+	_, kv, err = kt.GetKey(types.NewPrincipalName(nametype.KRB_NT_SRV_HST, "host/princ.test.gokrb5"), realm, 258, 18)
+	if err != nil {
+		t.Fatalf("error getting key for 8 bit kvno: %v", err)
+	}
+	assert.Equal(t, 2, kv, "8 bit kvno entry not matched")
+}
+
+func TestKeytab_Save(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "keytab")
+	if err != nil {
+		t.Fatalf("error creating temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	ktPath := filepath.Join(dir, "test.keytab")
+	kt := New()
+	kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "password", time.Unix(100, 0), 1, 18)
+	for i := 0; i < 2; i++ {
+		if err := kt.Save(ktPath); err != nil {
+			t.Fatalf("error saving keytab: %v", err)
+		}
+	}
+	fi, err := os.Stat(ktPath)
+	if err != nil {
+		t.Fatalf("error stating keytab file: %v", err)
+	}
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "keytab file mode not as expected")
+	}
+	l, err := Load(ktPath)
+	if err != nil {
+		t.Fatalf("error loading saved keytab: %v", err)
+	}
+	assert.Equal(t, kt.Entries, l.Entries, "entries of saved keytab not as expected")
+	files, _ := ioutil.ReadDir(dir)
+	assert.Equal(t, 1, len(files), "temporary file not removed")
+}
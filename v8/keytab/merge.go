@@ -0,0 +1,94 @@
+package keytab
+
+import (
+	"sort"
+)
+
+// entryID identifies the key of a principal for a kvno and etype.
+type entryID struct {
+	principal string
+	kvno      uint32
+	etype     int32
+}
+
+func (e entry) id() entryID {
+	return entryID{
+		principal: e.Principal.String(),
+		kvno:      e.KVNO,
+		etype:     e.Key.KeyType,
+	}
+}
+
+// MergeKeytabs returns a new keytab holding the entries of both keytabs, for example to combine the keytabs of several
+// services into the single keytab a host uses.
+// Where both keytabs have an entry for the same principal, kvno and etype the entry from b is kept in place of the
+// entry from a. The order of the remaining entries is preserved with the entries of a first.
+func MergeKeytabs(a, b *Keytab) *Keytab {
+	kt := New()
+	if a.version != 0 {
+		kt.version = a.version
+	}
+	idx := make(map[entryID]int)
+	for _, t := range []*Keytab{a, b} {
+		for _, e := range t.Entries {
+			if i, ok := idx[e.id()]; ok {
+				kt.Entries[i] = e
+				continue
+			}
+			idx[e.id()] = len(kt.Entries)
+			kt.Entries = append(kt.Entries, e)
+		}
+	}
+	return kt
+}
+
+// Prune removes the entries for obsolete kvnos from the keytab, keeping the entries of each principal for its
+// keepLatestN highest kvnos. Keeping more than one kvno allows tickets issued before a key rotation to still be
+// decrypted until they expire. A keepLatestN less than one is treated as one.
+// The number of entries removed is returned.
+func (kt *Keytab) Prune(keepLatestN int) int {
+	if keepLatestN < 1 {
+		keepLatestN = 1
+	}
+	kvnos := make(map[string][]uint32)
+	for _, e := range kt.Entries {
+		p := e.Principal.String()
+		if !containsKVNO(kvnos[p], e.KVNO) {
+			kvnos[p] = append(kvnos[p], e.KVNO)
+		}
+	}
+	keep := make(map[string]map[uint32]bool)
+	for p, ks := range kvnos {
+		sort.Slice(ks, func(i, j int) bool { return ks[i] > ks[j] })
+		if len(ks) > keepLatestN {
+			ks = ks[:keepLatestN]
+		}
+		keep[p] = make(map[uint32]bool)
+		for _, k := range ks {
+			keep[p][k] = true
+		}
+	}
+	entries := kt.Entries[:0]
+	for _, e := range kt.Entries {
+		if keep[e.Principal.String()][e.KVNO] {
+			entries = append(entries, e)
+		}
+	}
+	n := len(kt.Entries) - len(entries)
+	// Clear the entries removed from the end of the backing array so their keys are no longer reachable. The key
+	// values are not overwritten as they may be shared with a keytab merged from this one.
+	for i := len(entries); i < len(kt.Entries); i++ {
+		kt.Entries[i] = entry{}
+	}
+	kt.Entries = entries
+	return n
+}
+
+func containsKVNO(ks []uint32, k uint32) bool {
+	for _, v := range ks {
+		if v == k {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package keytab
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeKeytabs(t *testing.T) {
+	t.Parallel()
+	realm := "TEST.GOKRB5"
+	a := New()
+	a.AddEntry("HTTP/host.test.gokrb5", realm, "passwordv1", time.Unix(100, 0), 1, 18)
+	a.AddEntry("HTTP/host.test.gokrb5", realm, "passwordv2", time.Unix(200, 0), 2, 18)
+	b := New()
+	b.AddEntry("ldap/host.test.gokrb5", realm, "ldappassword", time.Unix(100, 0), 5, 18)
+	b.AddEntry("HTTP/host.test.gokrb5", realm, "replacedv2", time.Unix(300, 0), 2, 18)
+	b.AddEntry("HTTP/host.test.gokrb5", realm, "passwordv2", time.Unix(200, 0), 2, 17)
+
+	kt := MergeKeytabs(a, b)
+	if !assert.Equal(t, 4, len(kt.Entries), "number of merged entries not as expected") {
+		t.FailNow()
+	}
+	assert.Equal(t, a.Entries[0], kt.Entries[0], "first entry not as expected")
+	assert.Equal(t, b.Entries[1], kt.Entries[1], "duplicate entry not replaced by entry from second keytab")
+	assert.Equal(t, b.Entries[0], kt.Entries[2], "third entry not as expected")
+	assert.Equal(t, b.Entries[2], kt.Entries[3], "fourth entry not as expected")
+	assert.Equal(t, 2, len(a.Entries), "first keytab modified by merge")
+
+	_, err := kt.Marshal()
+	assert.NoError(t, err, "error marshaling merged keytab")
+}
+
+func TestKeytab_Prune(t *testing.T) {
+	t.Parallel()
+	realm := "TEST.GOKRB5"
+	kt := New()
+	for kvno := uint8(1); kvno <= 3; kvno++ {
+		kt.AddEntry("HTTP/host.test.gokrb5", realm, "password", time.Unix(int64(kvno)*100, 0), kvno, 18)
+		kt.AddEntry("HTTP/host.test.gokrb5", realm, "password", time.Unix(int64(kvno)*100, 0), kvno, 17)
+	}
+	kt.AddEntry("ldap/host.test.gokrb5", realm, "password", time.Unix(100, 0), 7, 18)
+
+	n := kt.Prune(2)
+	assert.Equal(t, 2, n, "number of entries pruned not as expected")
+	assert.Equal(t, 5, len(kt.Entries), "number of entries remaining not as expected")
+	for _, e := range kt.Entries {
+		assert.NotEqual(t, uint32(1), e.KVNO, "entry for oldest kvno not pruned")
+	}
+	for _, e := range kt.Entries[len(kt.Entries):cap(kt.Entries)] {
+		assert.Equal(t, entry{}, e, "pruned entry should be cleared from the backing array")
+	}
+
+	n = kt.Prune(0)
+	assert.Equal(t, 2, n, "number of entries pruned not as expected")
+	if assert.Equal(t, 3, len(kt.Entries), "number of entries remaining not as expected") {
+		assert.Equal(t, uint32(3), kt.Entries[0].KVNO, "latest kvno not kept")
+		assert.Equal(t, uint32(3), kt.Entries[1].KVNO, "latest kvno not kept")
+		assert.Equal(t, uint32(7), kt.Entries[2].KVNO, "kvno of other principal not kept")
+	}
+}
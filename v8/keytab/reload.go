@@ -0,0 +1,160 @@
+package keytab
+
+import (
+	"errors"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// Provider supplies the keytab to use at the time it is called.
+// Services use a Provider so that a keytab can be replaced while they are running, for example after key rotation.
+type Provider interface {
+	Keytab() *Keytab
+}
+
+// Reloader is a Provider for a keytab file that loads the file again when it changes, so that services continue to
+// work across key rotations by tools such as msktutil without a restart. It is safe for concurrent use.
+//
+// The file is polled at the interval provided. A change is detected when the file is replaced or when its size or
+// modification time changes. The file can also be loaded again on demand with Reload, for example on SIGHUP using
+// ReloadOnSignal. If the file cannot be loaded the keytab previously loaded continues to be used.
+type Reloader struct {
+	path    string
+	kt      *Keytab
+	info    os.FileInfo
+	errors  chan error
+	cancel  chan bool
+	done    chan bool
+	stopped bool
+	mux     sync.RWMutex
+}
+
+// NewReloader loads the keytab file at the path provided and starts polling it for changes at the interval provided.
+// An interval of zero disables polling so the file is only loaded again when Reload is called.
+// Stop should be called when the Reloader is no longer needed.
+func NewReloader(ktPath string, interval time.Duration) (*Reloader, error) {
+	if interval < 0 {
+		return nil, errors.New("keytab reload interval must not be negative")
+	}
+	r := &Reloader{
+		path:   ktPath,
+		errors: make(chan error, 1),
+		cancel: make(chan bool, 1),
+		done:   make(chan bool),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	go r.watch(interval)
+	return r, nil
+}
+
+// Keytab returns the most recently loaded keytab.
+func (r *Reloader) Keytab() *Keytab {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.kt
+}
+
+// Reload loads the keytab file again regardless of whether it has changed.
+// If the file cannot be loaded the keytab previously loaded continues to be used and the error is returned.
+func (r *Reloader) Reload() error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	kt, err := Load(r.path)
+	if err != nil {
+		return err
+	}
+	r.mux.Lock()
+	r.kt = kt
+	r.info = info
+	r.mux.Unlock()
+	return nil
+}
+
+// ReloadOnSignal loads the keytab file again each time one of the signals provided is received by the process,
+// such as syscall.SIGHUP, until the Reloader is stopped.
+func (r *Reloader) ReloadOnSignal(sig ...os.Signal) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sig...)
+	go func() {
+		defer signal.Stop(c)
+		for {
+			select {
+			case <-c:
+				if err := r.Reload(); err != nil {
+					r.sendError(err)
+				}
+			case <-r.done:
+				return
+			}
+		}
+	}()
+}
+
+// Errors returns a channel on which errors loading the keytab file in the background are delivered.
+// Only the most recent error is held.
+func (r *Reloader) Errors() <-chan error {
+	return r.errors
+}
+
+// Stop ends the polling of the keytab file and the handling of signals.
+func (r *Reloader) Stop() {
+	r.mux.Lock()
+	if r.stopped {
+		r.mux.Unlock()
+		return
+	}
+	r.stopped = true
+	r.mux.Unlock()
+	r.cancel <- true
+	<-r.done
+}
+
+func (r *Reloader) watch(interval time.Duration) {
+	defer close(r.done)
+	var tick <-chan time.Time
+	if interval > 0 {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		tick = t.C
+	}
+	for {
+		select {
+		case <-r.cancel:
+			return
+		case <-tick:
+			if r.changed() {
+				if err := r.Reload(); err != nil {
+					r.sendError(err)
+				}
+			}
+		}
+	}
+}
+
+// changed indicates if the keytab file has changed since it was last loaded.
+func (r *Reloader) changed() bool {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		r.sendError(err)
+		return false
+	}
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return !os.SameFile(info, r.info) || info.Size() != r.info.Size() || !info.ModTime().Equal(r.info.ModTime())
+}
+
+func (r *Reloader) sendError(err error) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	select {
+	case <-r.errors:
+	default:
+	}
+	r.errors <- err
+}
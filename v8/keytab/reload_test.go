@@ -0,0 +1,76 @@
+package keytab
+
+import (
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReloader(t *testing.T) {
+	t.Parallel()
+	b, _ := hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
+	dir, err := ioutil.TempDir("", "keytab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := filepath.Join(dir, "krb5.keytab")
+	if err := ioutil.WriteFile(p, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReloader(p, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Error creating reloader: %v", err)
+	}
+	defer r.Stop()
+	n := len(r.Keytab().Entries)
+	assert.True(t, n > 0, "Keytab not loaded")
+
+	kt := r.Keytab()
+	err = kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", time.Now(), 3, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nb, err := kt.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmp := p + ".new"
+	if err := ioutil.WriteFile(tmp, nb, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Keytab() == kt && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, n+1, len(r.Keytab().Entries), "Changed keytab not loaded")
+
+	// A keytab that cannot be loaded does not replace the one loaded
+	cur := r.Keytab()
+	if err := ioutil.WriteFile(p, []byte{5}, 0600); err != nil {
+		t.Fatal(err)
+	}
+	assert.Error(t, r.Reload(), "Invalid keytab should not load")
+	assert.Equal(t, cur, r.Keytab(), "Keytab replaced by an invalid one")
+	select {
+	case err := <-r.Errors():
+		assert.Error(t, err, "Error expected from background reload")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for reload error")
+	}
+	r.Stop()
+	r.Stop()
+
+	_, err = NewReloader(filepath.Join(dir, "missing"), 0)
+	assert.Error(t, err, "Missing keytab should be rejected")
+}
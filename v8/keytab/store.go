@@ -0,0 +1,99 @@
+package keytab
+
+import (
+	"sync"
+
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// Store holds a keytab in memory for use by services handling requests concurrently. It is a Provider and is safe for
+// concurrent use.
+//
+// The keytab returned by Keytab is never modified by the Store. Changes made with Set and Update replace it with a new
+// keytab, so requests already using the previous keytab are unaffected. Zeroize overwrites the key material of every
+// keytab the Store has held and should be called on shutdown once requests are no longer being handled.
+type Store struct {
+	kt      *Keytab
+	retired []*Keytab
+	mux     sync.RWMutex
+}
+
+// NewStore returns a Store holding a copy of the keytab provided.
+func NewStore(kt *Keytab) *Store {
+	return &Store{
+		kt: kt.clone(),
+	}
+}
+
+// Keytab returns the keytab currently held by the Store. It must not be modified.
+func (s *Store) Keytab() *Keytab {
+	s.mux.RLock()
+	defer s.mux.RUnlock()
+	return s.kt
+}
+
+// GetKey returns the key for the principal, realm, kvno and etype provided from the keytab currently held by the Store.
+// See Keytab.GetKey.
+func (s *Store) GetKey(princName types.PrincipalName, realm string, kvno int, etype int32) (types.EncryptionKey, int, error) {
+	return s.Keytab().GetKey(princName, realm, kvno, etype)
+}
+
+// Set replaces the keytab held by the Store with a copy of the keytab provided.
+func (s *Store) Set(kt *Keytab) {
+	c := kt.clone()
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.retired = append(s.retired, s.kt)
+	s.kt = c
+}
+
+// Update calls the function provided with a copy of the keytab held by the Store, for example to add or prune entries.
+// If the function returns nil the copy replaces the keytab held by the Store, otherwise the error is returned and the
+// keytab is unchanged. Calls to Update are serialised.
+func (s *Store) Update(f func(*Keytab) error) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	c := s.kt.clone()
+	if err := f(c); err != nil {
+		c.Zeroize()
+		return err
+	}
+	s.retired = append(s.retired, s.kt)
+	s.kt = c
+	return nil
+}
+
+// Zeroize overwrites the key material of the keytab held by the Store, and of any keytabs it has replaced, and leaves
+// the Store holding an empty keytab.
+func (s *Store) Zeroize() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.kt.Zeroize()
+	for _, kt := range s.retired {
+		kt.Zeroize()
+	}
+	s.retired = nil
+	s.kt = &Keytab{version: s.kt.version}
+}
+
+// Zeroize overwrites the key material of the keytab's entries and removes them.
+func (kt *Keytab) Zeroize() {
+	for i := range kt.Entries {
+		kt.Entries[i].Key.Wipe()
+	}
+	kt.Entries = nil
+}
+
+// clone returns a copy of the keytab that shares no memory with it.
+func (kt *Keytab) clone() *Keytab {
+	c := &Keytab{
+		version: kt.version,
+		Entries: make([]entry, len(kt.Entries)),
+	}
+	for i, e := range kt.Entries {
+		e.Principal.Components = append([]string(nil), e.Principal.Components...)
+		e.Key.KeyValue = append([]byte(nil), e.Key.KeyValue...)
+		c.Entries[i] = e
+	}
+	return c
+}
@@ -0,0 +1,69 @@
+package keytab
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStore(t *testing.T) {
+	t.Parallel()
+	princ := "HTTP/host.test.gokrb5"
+	realm := "TEST.GOKRB5"
+	pn := types.NewPrincipalName(nametype.KRB_NT_SRV_HST, princ)
+	kt := New()
+	kt.AddEntry(princ, realm, "passwordv1", time.Unix(100, 0), 1, 18)
+
+	s := NewStore(kt)
+	kt.Entries[0].Key.KeyValue[0]++
+	key, _, err := s.GetKey(pn, realm, 1, 18)
+	if err != nil {
+		t.Fatalf("error getting key: %v", err)
+	}
+	assert.NotEqual(t, kt.Entries[0].Key.KeyValue, key.KeyValue, "store shares key material with the keytab it was created from")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, _, err := s.GetKey(pn, realm, 1, 18); err != nil {
+					t.Errorf("error getting key concurrently: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	old := s.Keytab()
+	err = s.Update(func(kt *Keytab) error {
+		return kt.AddEntry(princ, realm, "passwordv2", time.Unix(200, 0), 2, 18)
+	})
+	wg.Wait()
+	if err != nil {
+		t.Fatalf("error updating store: %v", err)
+	}
+	assert.Equal(t, 1, len(old.Entries), "keytab previously returned by store was modified")
+	assert.Equal(t, 2, len(s.Keytab().Entries), "store not updated")
+
+	err = s.Update(func(kt *Keytab) error {
+		kt.Entries = nil
+		return errors.New("update failed")
+	})
+	assert.Error(t, err, "error from update function not returned")
+	assert.Equal(t, 2, len(s.Keytab().Entries), "store changed by failed update")
+
+	entries := append(append([]entry{}, old.Entries...), s.Keytab().Entries...)
+	s.Zeroize()
+	for _, e := range entries {
+		assert.Equal(t, make([]byte, len(e.Key.KeyValue)), e.Key.KeyValue, "key material not zeroized")
+	}
+	assert.Equal(t, 0, len(s.Keytab().Entries), "store not empty after zeroize")
+	_, _, err = s.GetKey(pn, realm, 2, 18)
+	assert.Error(t, err, "key returned after zeroize")
+}
@@ -1,9 +1,11 @@
 package krberror
 
 import (
+	"errors"
 	"fmt"
 	"testing"
 
+	"github.com/Osirium/gokrb5/v8/iana/errorcode"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,3 +23,23 @@ func TestErrorf(t *testing.T) {
 	a = Errorf(err, "cause", "arg1=%d arg2=%s", 123, "arg")
 	assert.Equal(t, "[Root cause: another error] cause: arg1=123 arg2=arg < another error: some text", a.Error())
 }
+
+func TestErrorf_Unwrap(t *testing.T) {
+	err := fmt.Errorf("an error")
+	a := Errorf(err, "cause", "some text")
+	assert.True(t, errors.Is(a, err), "error not unwrapped to its cause")
+	a = Errorf(a, "another cause", "more text")
+	assert.True(t, errors.Is(a, err), "cause not retained when adding to the error")
+	assert.Nil(t, NewErrorf("cause", "some text").Unwrap(), "new error should not have a cause")
+}
+
+func TestCodeError(t *testing.T) {
+	err, ok := CodeError(errorcode.KDC_ERR_PREAUTH_FAILED)
+	assert.True(t, ok, "sentinel error not found")
+	assert.Equal(t, ErrPreauthFailed, err, "sentinel error not as expected")
+	err, ok = CodeError(errorcode.KRB_AP_ERR_TKT_NYV)
+	assert.True(t, ok, "sentinel error not found")
+	assert.Equal(t, ErrTicketNotYetValid, err, "sentinel error not as expected")
+	_, ok = CodeError(errorcode.KDC_ERR_NONE)
+	assert.False(t, ok, "sentinel error not expected")
+}
@@ -0,0 +1,55 @@
+package krberror
+
+import (
+	"errors"
+
+	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+)
+
+// Sentinel errors for classes of Kerberos error. A KRB_ERROR returned by a KDC or service, and any error wrapping it,
+// matches the sentinel error for its error code with errors.Is.
+var (
+	ErrClientPrincipalUnknown = errors.New("client principal unknown")
+	ErrSPrincipalUnknown      = errors.New("service principal unknown")
+	ErrPolicy                 = errors.New("KDC policy rejects request")
+	ErrBadOption              = errors.New("KDC cannot accommodate requested option")
+	ErrETypeNotSupported      = errors.New("encryption type not supported")
+	ErrClientRevoked          = errors.New("client credentials have been revoked")
+	ErrPasswordExpired        = errors.New("password has expired")
+	ErrPreauthFailed          = errors.New("pre-authentication failed")
+	ErrPreauthRequired        = errors.New("pre-authentication required")
+	ErrBadIntegrity           = errors.New("integrity check failed")
+	ErrTicketExpired          = errors.New("ticket expired")
+	ErrTicketNotYetValid      = errors.New("ticket not yet valid")
+	ErrReplay                 = errors.New("request is a replay")
+	ErrClockSkew              = errors.New("clock skew too great")
+	ErrModified               = errors.New("message stream modified")
+	ErrWrongRealm             = errors.New("wrong realm")
+)
+
+// kerberosErrors maps Kerberos error codes to their sentinel error.
+var kerberosErrors = map[int32]error{
+	errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN:        ErrClientPrincipalUnknown,
+	errorcode.KDC_ERR_S_PRINCIPAL_UNKNOWN:        ErrSPrincipalUnknown,
+	errorcode.KDC_ERR_POLICY:                     ErrPolicy,
+	errorcode.KDC_ERR_BADOPTION:                  ErrBadOption,
+	errorcode.KDC_ERR_ETYPE_NOSUPP:               ErrETypeNotSupported,
+	errorcode.KDC_ERR_CLIENT_REVOKED:             ErrClientRevoked,
+	errorcode.KDC_ERR_KEY_EXPIRED:                ErrPasswordExpired,
+	errorcode.KDC_ERR_PREAUTH_FAILED:             ErrPreauthFailed,
+	errorcode.KDC_ERR_PREAUTH_REQUIRED:           ErrPreauthRequired,
+	errorcode.KDC_ERR_MORE_PREAUTH_DATA_REQUIRED: ErrPreauthRequired,
+	errorcode.KRB_AP_ERR_BAD_INTEGRITY:           ErrBadIntegrity,
+	errorcode.KRB_AP_ERR_TKT_EXPIRED:             ErrTicketExpired,
+	errorcode.KRB_AP_ERR_TKT_NYV:                 ErrTicketNotYetValid,
+	errorcode.KRB_AP_ERR_REPEAT:                  ErrReplay,
+	errorcode.KRB_AP_ERR_SKEW:                    ErrClockSkew,
+	errorcode.KRB_AP_ERR_MODIFIED:                ErrModified,
+	errorcode.KDC_ERR_WRONG_REALM:                ErrWrongRealm,
+}
+
+// CodeError returns the sentinel error for the Kerberos error code, if there is one.
+func CodeError(code int32) (error, bool) {
+	err, ok := kerberosErrors[code]
+	return err, ok
+}
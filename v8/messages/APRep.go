@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Osirium/gokrb5/v8/asn1tools"
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana"
 	"github.com/Osirium/gokrb5/v8/iana/asnAppTag"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
 	"github.com/Osirium/gokrb5/v8/krberror"
 	"github.com/Osirium/gokrb5/v8/types"
@@ -26,6 +30,55 @@ type EncAPRepPart struct {
 	SequenceNumber int64               `asn1:"optional,explicit,tag:3"`
 }
 
+// NewAPRep generates a new KRB_AP_REP struct replying to the authenticator of an AP_REQ, encrypted with the session
+// key. The subkey and sequence number are optional and omitted if zero.
+func NewAPRep(auth types.Authenticator, sessionKey, subkey types.EncryptionKey, seqNum int64) (APRep, error) {
+	var a APRep
+	enc := EncAPRepPart{
+		CTime:          auth.CTime,
+		Cusec:          auth.Cusec,
+		Subkey:         subkey,
+		SequenceNumber: seqNum,
+	}
+	b, err := enc.Marshal()
+	if err != nil {
+		return a, err
+	}
+	ed, err := crypto.GetEncryptedData(b, sessionKey, keyusage.AP_REP_ENCPART, 0)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error encrypting AP_REP EncPart")
+	}
+	a = APRep{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_AP_REP,
+		EncPart: ed,
+	}
+	return a, nil
+}
+
+// Marshal the APRep.
+func (a *APRep) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*a)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling AP_REP")
+	}
+	return asn1tools.AddASNAppTag(b, asnAppTag.APREP), nil
+}
+
+// DecryptEncPart decrypts the encrypted part of the APRep with the session key of the AP_REQ it replies to.
+func (a *APRep) DecryptEncPart(sessionKey types.EncryptionKey) (EncAPRepPart, error) {
+	var enc EncAPRepPart
+	b, err := crypto.DecryptEncPart(a.EncPart, sessionKey, keyusage.AP_REP_ENCPART)
+	if err != nil {
+		return enc, krberror.Errorf(err, krberror.DecryptingError, "error decrypting AP_REP EncPart")
+	}
+	err = enc.Unmarshal(b)
+	if err != nil {
+		return enc, err
+	}
+	return enc, nil
+}
+
 // Unmarshal bytes b into the APRep struct.
 func (a *APRep) Unmarshal(b []byte) error {
 	_, err := asn1.UnmarshalWithParams(b, a, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.APREP))
@@ -39,6 +92,15 @@ func (a *APRep) Unmarshal(b []byte) error {
 	return nil
 }
 
+// Marshal the APRep encrypted part.
+func (a *EncAPRepPart) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*a)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling EncAPRepPart")
+	}
+	return asn1tools.AddASNAppTag(b, asnAppTag.EncAPRepPart), nil
+}
+
 // Unmarshal bytes b into the APRep encrypted part struct.
 func (a *EncAPRepPart) Unmarshal(b []byte) error {
 	_, err := asn1.UnmarshalWithParams(b, a, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.EncAPRepPart))
@@ -8,6 +8,7 @@ import (
 	"github.com/Osirium/gokrb5/v8/iana"
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
 	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -67,3 +68,67 @@ func TestUnmarshalEncAPRepPart_optionalsNULL(t *testing.T) {
 	assert.Equal(t, tt, a.CTime, "CTime not as expected")
 	assert.Equal(t, 123456, a.Cusec, "Client microseconds not as expected")
 }
+
+func TestMarshalAPRep(t *testing.T) {
+	t.Parallel()
+	for _, v := range []string{testdata.MarshaledKRB5ap_rep} {
+		var a APRep
+		b, _ := hex.DecodeString(v)
+		err := a.Unmarshal(b)
+		if err != nil {
+			t.Fatalf("Unmarshal error: %v", err)
+		}
+		mb, err := a.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		assert.Equal(t, b, mb, "marshaled bytes not as test vector")
+	}
+	for _, v := range []string{testdata.MarshaledKRB5ap_rep_enc_part, testdata.MarshaledKRB5ap_rep_enc_partOptionalsNULL} {
+		var a EncAPRepPart
+		b, _ := hex.DecodeString(v)
+		err := a.Unmarshal(b)
+		if err != nil {
+			t.Fatalf("Unmarshal error: %v", err)
+		}
+		mb, err := a.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		assert.Equal(t, b, mb, "marshaled bytes not as test vector")
+	}
+}
+
+func TestNewAPRep(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{KeyType: 18, KeyValue: make([]byte, 32)}
+	subkey := types.EncryptionKey{KeyType: 18, KeyValue: []byte("12345678901234567890123456789012")}
+	auth, err := types.NewAuthenticator("TEST.GOKRB5", types.NewPrincipalName(1, "testuser1"))
+	if err != nil {
+		t.Fatalf("Error creating authenticator: %v", err)
+	}
+	a, err := NewAPRep(auth, key, subkey, 17)
+	if err != nil {
+		t.Fatalf("Error creating AP_REP: %v", err)
+	}
+	b, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	var u APRep
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	enc, err := u.DecryptEncPart(key)
+	if err != nil {
+		t.Fatalf("Error decrypting AP_REP: %v", err)
+	}
+	assert.True(t, auth.CTime.Truncate(time.Second).Equal(enc.CTime), "CTime not as expected")
+	assert.Equal(t, auth.Cusec, enc.Cusec, "Client microseconds not as expected")
+	assert.Equal(t, subkey, enc.Subkey, "Subkey not as expected")
+	assert.Equal(t, int64(17), enc.SequenceNumber, "Sequence number not as expected")
+
+	_, err = u.DecryptEncPart(subkey)
+	assert.Error(t, err, "AP_REP should not decrypt with the wrong key")
+}
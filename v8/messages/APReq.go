@@ -13,6 +13,7 @@ import (
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
 	"github.com/Osirium/gokrb5/v8/keytab"
 	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/pac"
 	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/jcmturner/gofork/encoding/asn1"
 )
@@ -138,22 +139,62 @@ func (a *APReq) Marshal() ([]byte, error) {
 	return mk, nil
 }
 
+// VerifySettings holds the settings of the verification of an AP_REQ and the PAC of its ticket.
+type VerifySettings struct {
+	ignoreTicketTimes        bool
+	pacKDCVerifier           pac.KDCChecksumVerifier
+	requirePACTicketChecksum bool
+}
+
+// IgnoreTicketTimes sets that the start and end times of the AP_REQ's ticket are not enforced, only the clock skew of
+// its authenticator being checked.
+//
+// ok, err := a.Verify(kt, d, cAddr, nil, IgnoreTicketTimes(true))
+func IgnoreTicketTimes(b bool) func(*VerifySettings) {
+	return func(s *VerifySettings) {
+		s.ignoreTicketTimes = b
+	}
+}
+
+// IgnoreTicketTimes indicates if the start and end times of the AP_REQ's ticket are not enforced.
+func (s *VerifySettings) IgnoreTicketTimes() bool {
+	return s.ignoreTicketTimes
+}
+
+// PACKDCVerifier sets the verifier of the checksums of a PAC made with the KDC's key: the KDC signature and, if the PAC
+// has one, the ticket signature. By default only the server signature of a PAC is verified.
+//
+// isPAC, p, err := tkt.GetPACType(kt, sname, l, PACKDCVerifier(pac.NewKDCKeyVerifier(krbtgtKey)))
+func PACKDCVerifier(v pac.KDCChecksumVerifier) func(*VerifySettings) {
+	return func(s *VerifySettings) {
+		s.pacKDCVerifier = v
+	}
+}
+
+// PACKDCVerifier returns the verifier of the checksums of a PAC made with the KDC's key, nil if they are not verified.
+func (s *VerifySettings) PACKDCVerifier() pac.KDCChecksumVerifier {
+	return s.pacKDCVerifier
+}
+
+// RequirePACTicketChecksum sets that a PAC must have a ticket signature, binding it to the ticket it was issued in, as
+// the KDCs of domains that have applied the November 2021 updates sign PACs.
+//
+// isPAC, p, err := tkt.GetPACType(kt, sname, l, RequirePACTicketChecksum(true))
+func RequirePACTicketChecksum(b bool) func(*VerifySettings) {
+	return func(s *VerifySettings) {
+		s.requirePACTicketChecksum = b
+	}
+}
+
+// RequirePACTicketChecksum indicates if a PAC must have a ticket signature.
+func (s *VerifySettings) RequirePACTicketChecksum() bool {
+	return s.requirePACTicketChecksum
+}
+
 // Verify an AP_REQ using service's keytab, spn and max acceptable clock skew duration.
 // The service ticket encrypted part and authenticator will be decrypted as part of this operation.
-func (a *APReq) Verify(kt *keytab.Keytab, d time.Duration, cAddr types.HostAddress, snameOverride *types.PrincipalName) (bool, error) {
+func (a *APReq) Verify(kt *keytab.Keytab, d time.Duration, cAddr types.HostAddress, snameOverride *types.PrincipalName, settings ...func(*VerifySettings)) (bool, error) {
 	// Decrypt ticket's encrypted part with service key
-	//TODO decrypt with service's session key from its TGT is use-to-user. Need to figure out how to get TGT.
-	//if types.IsFlagSet(&a.APOptions, flags.APOptionUseSessionKey) {
-	//	err := a.Ticket.Decrypt(tgt.DecryptedEncPart.Key)
-	//	if err != nil {
-	//		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting encpart of ticket provided using session key")
-	//	}
-	//} else {
-	//	err := a.Ticket.DecryptEncPart(*kt, &a.Ticket.SName)
-	//	if err != nil {
-	//		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting encpart of service ticket provided")
-	//	}
-	//}
 	sname := &a.Ticket.SName
 	if snameOverride != nil {
 		sname = snameOverride
@@ -162,11 +203,33 @@ func (a *APReq) Verify(kt *keytab.Keytab, d time.Duration, cAddr types.HostAddre
 	if err != nil {
 		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting encpart of service ticket provided")
 	}
+	return a.verifyTicket(d, cAddr, settings)
+}
+
+// VerifyWithSessionKey verifies the AP_REQ of user-to-user authentication, whose ticket is encrypted with the session
+// key of the service's TGT rather than a key in its keytab (https://tools.ietf.org/html/rfc4120#section-3.7).
+func (a *APReq) VerifyWithSessionKey(key types.EncryptionKey, d time.Duration, cAddr types.HostAddress, settings ...func(*VerifySettings)) (bool, error) {
+	err := a.Ticket.Decrypt(key)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting encpart of user-to-user ticket provided using the TGT session key")
+	}
+	return a.verifyTicket(d, cAddr, settings)
+}
+
+// verifyTicket verifies the AP_REQ once its ticket has been decrypted.
+func (a *APReq) verifyTicket(d time.Duration, cAddr types.HostAddress, settings []func(*VerifySettings)) (bool, error) {
+	s := new(VerifySettings)
+	for _, set := range settings {
+		set(s)
+	}
+	t := time.Now().UTC()
 
 	// Check time validity of ticket
-	ok, err := a.Ticket.Valid(d)
-	if err != nil || !ok {
-		return ok, err
+	if !s.ignoreTicketTimes {
+		ok, err := a.Ticket.ValidAt(t, d)
+		if err != nil || !ok {
+			return ok, err
+		}
 	}
 
 	// Check client's address is listed in the client addresses in the ticket
@@ -179,7 +242,7 @@ func (a *APReq) Verify(kt *keytab.Keytab, d time.Duration, cAddr types.HostAddre
 	}
 
 	// Decrypt authenticator with session key from ticket's encrypted part
-	err = a.DecryptAuthenticator(a.Ticket.DecryptedEncPart.Key)
+	err := a.DecryptAuthenticator(a.Ticket.DecryptedEncPart.Key)
 	if err != nil {
 		return false, NewKRBError(a.Ticket.SName, a.Ticket.Realm, errorcode.KRB_AP_ERR_BAD_INTEGRITY, "could not decrypt authenticator")
 	}
@@ -191,9 +254,14 @@ func (a *APReq) Verify(kt *keytab.Keytab, d time.Duration, cAddr types.HostAddre
 
 	// Check the clock skew between the client and the service server
 	ct := a.Authenticator.CTime.Add(time.Duration(a.Authenticator.Cusec) * time.Microsecond)
-	t := time.Now().UTC()
-	if t.Sub(ct) > d || ct.Sub(t) > d {
-		return false, NewKRBError(a.Ticket.SName, a.Ticket.Realm, errorcode.KRB_AP_ERR_SKEW, fmt.Sprintf("clock skew with client too large. greater than %v seconds", d))
+	if ct.After(t.Add(d)) || t.After(ct.Add(d)) {
+		skew := t.Sub(ct)
+		if skew < 0 {
+			skew = -skew
+		}
+		return false, NewKRBError(a.Ticket.SName, a.Ticket.Realm, errorcode.KRB_AP_ERR_SKEW,
+			fmt.Sprintf("clock skew with client too large: authenticator time %s is %v from the service's time of %s, greater than the maximum of %v",
+				ct.Format(time.RFC3339), skew, t.Format(time.RFC3339), d))
 	}
 	return true, nil
 }
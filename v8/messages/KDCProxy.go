@@ -0,0 +1,59 @@
+package messages
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// KDCProxyMessage implements the MS-KKDCP KDC-PROXY-MESSAGE used to send Kerberos messages to a KDC through an HTTPS
+// proxy: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-kkdcp/5778aff5-b182-4b97-a970-29c7f911eef2
+type KDCProxyMessage struct {
+	KerbMessage   []byte `asn1:"explicit,tag:0"`
+	TargetDomain  string `asn1:"generalstring,optional,explicit,tag:1"`
+	DCLocatorHint int    `asn1:"optional,explicit,tag:2"`
+}
+
+// NewKDCProxyMessage creates a KDCProxyMessage for the Kerberos message bytes to be sent to a KDC for the realm provided.
+// The message is framed with its length as it would be when sent over TCP.
+func NewKDCProxyMessage(b []byte, realm string) KDCProxyMessage {
+	m := make([]byte, 4, 4+len(b))
+	binary.BigEndian.PutUint32(m, uint32(len(b)))
+	return KDCProxyMessage{
+		KerbMessage:  append(m, b...),
+		TargetDomain: realm,
+	}
+}
+
+// Marshal the KDCProxyMessage.
+func (k *KDCProxyMessage) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling KDC proxy message")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes into the KDCProxyMessage.
+func (k *KDCProxyMessage) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, k)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDC proxy message")
+	}
+	return nil
+}
+
+// Message returns the Kerberos message carried by the KDCProxyMessage with its length framing removed.
+func (k *KDCProxyMessage) Message() ([]byte, error) {
+	if len(k.KerbMessage) < 4 {
+		return nil, errors.New("KDC proxy message too short to contain a Kerberos message")
+	}
+	l := binary.BigEndian.Uint32(k.KerbMessage[:4])
+	if int64(l) != int64(len(k.KerbMessage)-4) {
+		return nil, fmt.Errorf("KDC proxy message length %d does not match the %d bytes of the Kerberos message", l, len(k.KerbMessage)-4)
+	}
+	return k.KerbMessage[4:], nil
+}
@@ -0,0 +1,35 @@
+package messages
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKDCProxyMessage_MarshalUnmarshal(t *testing.T) {
+	t.Parallel()
+	m := NewKDCProxyMessage([]byte{1, 2, 3}, "TEST.GOKRB5")
+	b, err := m.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KDC proxy message: %v", err)
+	}
+	// SEQUENCE { [0] OCTET STRING 0x00000003010203, [1] GeneralString "TEST.GOKRB5" }
+	assert.Equal(t, "301aa009040700000003010203a10d1b0b544553542e474f4b524235", hex.EncodeToString(b), "encoding not as expected")
+	var u KDCProxyMessage
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling KDC proxy message: %v", err)
+	}
+	assert.Equal(t, "TEST.GOKRB5", u.TargetDomain, "target domain not as expected")
+	assert.Equal(t, 0, u.DCLocatorHint, "dclocator hint not as expected")
+	kb, err := u.Message()
+	if err != nil {
+		t.Fatalf("error getting Kerberos message: %v", err)
+	}
+	assert.Equal(t, []byte{1, 2, 3}, kb, "Kerberos message not as expected")
+
+	u.KerbMessage = []byte{0, 0, 0, 9, 1}
+	_, err = u.Message()
+	assert.Error(t, err, "no error for Kerberos message with incorrect length")
+}
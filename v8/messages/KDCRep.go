@@ -244,38 +244,77 @@ func (k *ASRep) DecryptEncPart(c *credentials.Credentials) (types.EncryptionKey,
 	return key, nil
 }
 
+// DecryptEncPartWithKey decrypts the encrypted part of an AS_REP with the reply key provided, for example a reply key
+// strengthened by a FAST exchange.
+func (k *ASRep) DecryptEncPartWithKey(key types.EncryptionKey) error {
+	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.AS_REP_ENCPART)
+	if err != nil {
+		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting AS_REP encrypted part")
+	}
+	var denc EncKDCRepPart
+	err = denc.Unmarshal(b)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling decrypted encpart of AS_REP")
+	}
+	k.DecryptedEncPart = denc
+	return nil
+}
+
 // Verify checks the validity of AS_REP message.
 func (k *ASRep) Verify(cfg *config.Config, creds *credentials.Credentials, asReq ASReq) (bool, error) {
-	//Ref RFC 4120 Section 3.1.5
-	if !k.CName.Equal(asReq.ReqBody.CName) {
-		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
-	}
-	if k.CRealm != asReq.ReqBody.Realm {
-		return false, krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
+	if ok, err := k.verifyNames(asReq); !ok {
+		return ok, err
 	}
 	key, err := k.DecryptEncPart(creds)
 	if err != nil {
 		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
 	}
-	if k.DecryptedEncPart.Nonce != asReq.ReqBody.Nonce {
-		return false, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in response does not match that in request")
+	return k.verifyEncPart(cfg, asReq, key)
+}
+
+// VerifyWithKey checks the validity of the AS_REP message, decrypting it with the reply key provided.
+func (k *ASRep) VerifyWithKey(cfg *config.Config, key types.EncryptionKey, asReq ASReq) (bool, error) {
+	if ok, err := k.verifyNames(asReq); !ok {
+		return ok, err
 	}
-	if !k.DecryptedEncPart.SName.Equal(asReq.ReqBody.SName) {
-		return false, krberror.NewErrorf(krberror.KRBMsgError, "SName in response does not match what was requested. Requested: %v; Reply: %v", asReq.ReqBody.SName, k.DecryptedEncPart.SName)
+	if err := k.DecryptEncPartWithKey(key); err != nil {
+		return false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting EncPart of AS_REP")
 	}
-	if k.DecryptedEncPart.SRealm != asReq.ReqBody.Realm {
-		return false, krberror.NewErrorf(krberror.KRBMsgError, "SRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.DecryptedEncPart.SRealm)
+	return k.verifyEncPart(cfg, asReq, key)
+}
+
+func (k *ASRep) verifyNames(asReq ASReq) (bool, error) {
+	if types.IsFlagSet(&asReq.ReqBody.KDCOptions, flags.Canonicalize) {
+		// The KDC may return canonical names, which are verified once the reply is decrypted
+		return true, nil
 	}
-	if len(asReq.ReqBody.Addresses) > 0 {
-		if !types.HostAddressesEqual(k.DecryptedEncPart.CAddr, asReq.ReqBody.Addresses) {
-			return false, krberror.NewErrorf(krberror.KRBMsgError, "addresses listed in the AS_REP does not match those listed in the AS_REQ")
-		}
+	//Ref RFC 4120 Section 3.1.5
+	if !k.CName.Equal(asReq.ReqBody.CName) {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", asReq.ReqBody.CName, k.CName)
 	}
-	t := time.Now().UTC()
-	if t.Sub(k.DecryptedEncPart.AuthTime) > cfg.LibDefaults.Clockskew || k.DecryptedEncPart.AuthTime.Sub(t) > cfg.LibDefaults.Clockskew {
-		return false, krberror.NewErrorf(krberror.KRBMsgError, "clock skew with KDC too large. Greater than %v seconds", cfg.LibDefaults.Clockskew.Seconds())
+	// The realm of an anonymous client is not disclosed in the reply to an anonymous request (RFC 6112 section 4.1)
+	anonymous := types.IsFlagSet(&asReq.ReqBody.KDCOptions, flags.RequestAnonymous) && k.CName.IsAnonymous()
+	if k.CRealm != asReq.ReqBody.Realm && !(anonymous && k.CRealm == types.AnonymousRealm) {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "CRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.CRealm)
+	}
+	return true, nil
+}
+
+// canonicalized indicates if the KDC has replied with names other than those requested.
+func (k *ASRep) canonicalized(asReq ASReq) bool {
+	anonymous := types.IsFlagSet(&asReq.ReqBody.KDCOptions, flags.RequestAnonymous) && k.CName.IsAnonymous()
+	crealm := k.CRealm != asReq.ReqBody.Realm && !(anonymous && k.CRealm == types.AnonymousRealm)
+	return crealm || !k.CName.Equal(asReq.ReqBody.CName) ||
+		!k.DecryptedEncPart.SName.Equal(asReq.ReqBody.SName) || k.DecryptedEncPart.SRealm != asReq.ReqBody.Realm
+}
+
+func (k *ASRep) verifyEncPart(cfg *config.Config, asReq ASReq, key types.EncryptionKey) (bool, error) {
+	if k.DecryptedEncPart.Nonce != asReq.ReqBody.Nonce {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in response does not match that in request")
 	}
 	// RFC 6806 https://tools.ietf.org/html/rfc6806.html#section-11
+	// Names canonicalized by the KDC are only accepted from a reply protected by FAST or the encrypted PA-REQ-ENC-PA-REP
+	protected := asReq.PAData.Contains(patype.PA_FX_FAST)
 	if asReq.PAData.Contains(patype.PA_REQ_ENC_PA_REP) && types.IsFlagSet(&k.DecryptedEncPart.Flags, flags.EncPARep) {
 		if len(k.DecryptedEncPart.EncPAData) < 2 || !k.DecryptedEncPart.EncPAData.Contains(patype.PA_FX_FAST) {
 			return false, krberror.NewErrorf(krberror.KRBMsgError, "KDC did not respond appropriately to FAST negotiation")
@@ -295,9 +334,35 @@ func (k *ASRep) Verify(cfg *config.Config, creds *credentials.Credentials, asReq
 				if !etype.VerifyChecksum(key.KeyValue, ab, pafast.Chksum, keyusage.KEY_USAGE_AS_REQ) {
 					return false, krberror.Errorf(err, krberror.ChksumError, "KDC FAST negotiation response checksum invalid")
 				}
+				protected = true
 			}
 		}
 	}
+	if types.IsFlagSet(&asReq.ReqBody.KDCOptions, flags.Canonicalize) && k.canonicalized(asReq) {
+		if !protected {
+			return false, krberror.NewErrorf(krberror.KRBMsgError, "KDC canonicalized the names in an unprotected response. Requested: %s@%s; Reply: %s@%s",
+				asReq.ReqBody.CName.PrincipalNameString(), asReq.ReqBody.Realm, k.CName.PrincipalNameString(), k.CRealm)
+		}
+		if k.DecryptedEncPart.SRealm != k.Ticket.Realm {
+			return false, krberror.NewErrorf(krberror.KRBMsgError, "SRealm in response does not match the ticket's realm. Ticket: %s; SRealm: %s", k.Ticket.Realm, k.DecryptedEncPart.SRealm)
+		}
+	} else {
+		if !k.DecryptedEncPart.SName.Equal(asReq.ReqBody.SName) {
+			return false, krberror.NewErrorf(krberror.KRBMsgError, "SName in response does not match what was requested. Requested: %v; Reply: %v", asReq.ReqBody.SName, k.DecryptedEncPart.SName)
+		}
+		if k.DecryptedEncPart.SRealm != asReq.ReqBody.Realm {
+			return false, krberror.NewErrorf(krberror.KRBMsgError, "SRealm in response does not match what was requested. Requested: %s; Reply: %s", asReq.ReqBody.Realm, k.DecryptedEncPart.SRealm)
+		}
+	}
+	if len(asReq.ReqBody.Addresses) > 0 {
+		if !types.HostAddressesEqual(k.DecryptedEncPart.CAddr, asReq.ReqBody.Addresses) {
+			return false, krberror.NewErrorf(krberror.KRBMsgError, "addresses listed in the AS_REP does not match those listed in the AS_REQ")
+		}
+	}
+	t := time.Now().UTC()
+	if t.Sub(k.DecryptedEncPart.AuthTime) > cfg.LibDefaults.Clockskew || k.DecryptedEncPart.AuthTime.Sub(t) > cfg.LibDefaults.Clockskew {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "clock skew with KDC too large. Greater than %v seconds", cfg.LibDefaults.Clockskew.Seconds())
+	}
 	return true, nil
 }
 
@@ -316,10 +381,43 @@ func (k *TGSRep) DecryptEncPart(key types.EncryptionKey) error {
 	return nil
 }
 
+// DecryptEncPartWithSubKey decrypts the encrypted part of a TGS_REP to a TGS_REQ whose authenticator carried the
+// sub-session key provided, or with a reply key derived from it by a FAST exchange.
+func (k *TGSRep) DecryptEncPartWithSubKey(key types.EncryptionKey) error {
+	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.TGS_REP_ENCPART_AUTHENTICATOR_SUB_KEY)
+	if err != nil {
+		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting TGS_REP EncPart")
+	}
+	var denc EncKDCRepPart
+	err = denc.Unmarshal(b)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling encrypted part")
+	}
+	k.DecryptedEncPart = denc
+	return nil
+}
+
 // Verify checks the validity of the TGS_REP message.
 func (k *TGSRep) Verify(cfg *config.Config, tgsReq TGSReq) (bool, error) {
-	if !k.CName.Equal(tgsReq.ReqBody.CName) {
-		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", tgsReq.ReqBody.CName, k.CName)
+	cname := tgsReq.ReqBody.CName
+	// The ticket of an S4U2Self request is issued to the user it was requested for
+	pfu, ok, err := tgsReq.ForUser()
+	if err != nil {
+		return false, err
+	}
+	if ok {
+		cname = pfu.UserName
+	}
+	// The ticket of an S4U2Proxy request is issued to the client of the evidence ticket, which can only be checked if
+	// the evidence ticket has been decrypted
+	if types.IsFlagSet(&tgsReq.ReqBody.KDCOptions, flags.CNameInAddlTkt) && len(tgsReq.ReqBody.AdditionalTickets) > 0 {
+		cname = tgsReq.ReqBody.AdditionalTickets[0].DecryptedEncPart.CName
+		if len(cname.NameString) == 0 {
+			cname = k.CName
+		}
+	}
+	if !k.CName.Equal(cname) {
+		return false, krberror.NewErrorf(krberror.KRBMsgError, "CName in response does not match what was requested. Requested: %+v; Reply: %+v", cname, k.CName)
 	}
 	if k.Ticket.Realm != tgsReq.ReqBody.Realm {
 		return false, krberror.NewErrorf(krberror.KRBMsgError, "realm in response ticket does not match what was requested. Requested: %s; Reply: %s", tgsReq.ReqBody.Realm, k.Ticket.Realm)
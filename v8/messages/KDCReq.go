@@ -49,6 +49,7 @@ type ASReq struct {
 // TGSReq implements RFC 4120 KRB_TGS_REQ: https://tools.ietf.org/html/rfc4120#section-5.4.1.
 type TGSReq struct {
 	KDCReqFields
+	subKey types.EncryptionKey
 }
 
 type marshalKDCReqBody struct {
@@ -131,7 +132,8 @@ func NewASReq(realm string, c *config.Config, cname, sname types.PrincipalName)
 	if c.LibDefaults.Forwardable {
 		types.SetFlag(&a.ReqBody.KDCOptions, flags.Forwardable)
 	}
-	if c.LibDefaults.Canonicalize {
+	// Enterprise names are only mapped to the principal's canonical name if canonicalization is requested
+	if c.LibDefaults.Canonicalize || cname.NameType == nametype.KRB_NT_ENTERPRISE {
 		types.SetFlag(&a.ReqBody.KDCOptions, flags.Canonicalize)
 	}
 	if c.LibDefaults.Proxiable {
@@ -158,7 +160,7 @@ func NewTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt
 	if err != nil {
 		return a, err
 	}
-	err = a.setPAData(tgt, sessionKey)
+	err = a.setPAData(tgt, sessionKey, 0)
 	return a, err
 }
 
@@ -170,10 +172,73 @@ func NewUser2UserTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Co
 	}
 	a.ReqBody.AdditionalTickets = []Ticket{verifyingTGT}
 	types.SetFlag(&a.ReqBody.KDCOptions, flags.EncTktInSkey)
-	err = a.setPAData(clientTGT, sessionKey)
+	err = a.setPAData(clientTGT, sessionKey, 0)
+	return a, err
+}
+
+// NewForwardedTGTReq returns a TGS_REQ for a forwarded TGT for the realm of the forwardable TGT provided, so that the
+// client's credentials can be delegated to a service. The forwarded TGT is requested without addresses as it is to be
+// used from the service's host.
+func NewForwardedTGTReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt Ticket, sessionKey types.EncryptionKey) (TGSReq, error) {
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+kdcRealm)
+	a, err := tgsReq(cname, sname, kdcRealm, false, c)
+	if err != nil {
+		return a, err
+	}
+	a.ReqBody.Addresses = nil
+	types.SetFlag(&a.ReqBody.KDCOptions, flags.Forwardable)
+	types.SetFlag(&a.ReqBody.KDCOptions, flags.Forwarded)
+	err = a.setPAData(tgt, sessionKey, 0)
 	return a, err
 }
 
+// NewS4U2SelfTGSReq returns a TGS_REQ with which a service obtains a ticket to itself on behalf of the user provided
+// (MS-SFU S4U2Self). The service names itself with sname and the TGT provided must be its own.
+func NewS4U2SelfTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt Ticket, sessionKey types.EncryptionKey, sname types.PrincipalName, user types.PrincipalName, userRealm string) (TGSReq, error) {
+	a, err := tgsReq(cname, sname, kdcRealm, false, c)
+	if err != nil {
+		return a, err
+	}
+	err = a.setPAData(tgt, sessionKey, 0)
+	if err != nil {
+		return a, err
+	}
+	pfu, err := NewPAForUser(user, userRealm, sessionKey)
+	if err != nil {
+		return a, err
+	}
+	pa, err := pfu.PAData()
+	if err != nil {
+		return a, err
+	}
+	a.PAData = append(a.PAData, pa)
+	return a, nil
+}
+
+// NewS4U2ProxyTGSReq returns a TGS_REQ with which a service obtains a ticket to another service on behalf of the user
+// the evidence ticket provided was issued to (MS-SFU S4U2Proxy). The evidence ticket is the user's forwardable ticket
+// to the requesting service, whose TGT must be provided. Resource-based constrained delegation is requested as well
+// as classic constrained delegation.
+func NewS4U2ProxyTGSReq(cname types.PrincipalName, kdcRealm string, c *config.Config, tgt Ticket, sessionKey types.EncryptionKey, sname types.PrincipalName, evidence Ticket) (TGSReq, error) {
+	a, err := tgsReq(cname, sname, kdcRealm, false, c)
+	if err != nil {
+		return a, err
+	}
+	a.ReqBody.AdditionalTickets = []Ticket{evidence}
+	types.SetFlag(&a.ReqBody.KDCOptions, flags.CNameInAddlTkt)
+	types.SetFlag(&a.ReqBody.KDCOptions, flags.Forwardable)
+	err = a.setPAData(tgt, sessionKey, 0)
+	if err != nil {
+		return a, err
+	}
+	pa, err := types.NewPAPACOptions(flags.PACOptionResourceBasedConstrainedDelegation)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PAC-OPTIONS")
+	}
+	a.PAData = append(a.PAData, pa)
+	return a, nil
+}
+
 // tgsReq populates the fields for a TGS_REQ
 func tgsReq(cname, sname types.PrincipalName, kdcRealm string, renewal bool, c *config.Config) (TGSReq, error) {
 	nonce, err := rand.Int(rand.Reader, big.NewInt(math.MaxInt32))
@@ -229,11 +294,41 @@ func tgsReq(cname, sname types.PrincipalName, kdcRealm string, renewal bool, c *
 	}
 
 	return TGSReq{
-		k,
+		KDCReqFields: k,
 	}, nil
 }
 
-func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey) error {
+// ApplyKDCOffset adjusts the times in the TGS_REQ by the offset of the KDC's clock from the local clock.
+// The pre-authentication data is regenerated so that its authenticator carries the adjusted time.
+func (k *TGSReq) ApplyKDCOffset(d time.Duration, tgt Ticket, sessionKey types.EncryptionKey) error {
+	k.ReqBody.Till = k.ReqBody.Till.Add(d)
+	if !k.ReqBody.RTime.IsZero() {
+		k.ReqBody.RTime = k.ReqBody.RTime.Add(d)
+	}
+	return k.setPAData(tgt, sessionKey, d)
+}
+
+// SetSubKey regenerates the pre-authentication data of the TGS_REQ with an authenticator carrying a new sub-session
+// key, which the KDC uses in place of the TGT session key to encrypt the reply. The sub-session key is returned and
+// is kept if the pre-authentication data is regenerated by ApplyKDCOffset.
+func (k *TGSReq) SetSubKey(tgt Ticket, sessionKey types.EncryptionKey, kdcOffset time.Duration) (types.EncryptionKey, error) {
+	et, err := crypto.GetEtype(sessionKey.KeyType)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for sub-session key")
+	}
+	k.subKey, err = types.GenerateEncryptionKey(et)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error generating sub-session key")
+	}
+	return k.subKey, k.setPAData(tgt, sessionKey, kdcOffset)
+}
+
+// SubKey returns the sub-session key carried in the TGS_REQ's authenticator, if SetSubKey has been called.
+func (k *TGSReq) SubKey() (types.EncryptionKey, bool) {
+	return k.subKey, len(k.subKey.KeyValue) > 0
+}
+
+func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey, kdcOffset time.Duration) error {
 	// Marshal the request and calculate checksum
 	b, err := k.ReqBody.Marshal()
 	if err != nil {
@@ -254,6 +349,12 @@ func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey) error {
 	if err != nil {
 		return krberror.Errorf(err, krberror.KRBMsgError, "error generating new authenticator")
 	}
+	if kdcOffset != 0 {
+		auth.SetTime(auth.CTime.Add(kdcOffset))
+	}
+	if len(k.subKey.KeyValue) > 0 {
+		auth.SubKey = k.subKey
+	}
 	auth.Cksum = types.Checksum{
 		CksumType: etype.GetHashID(),
 		Checksum:  cb,
@@ -267,12 +368,19 @@ func (k *TGSReq) setPAData(tgt Ticket, sessionKey types.EncryptionKey) error {
 	if err != nil {
 		return krberror.Errorf(err, krberror.EncodingError, "error marshaling AP_REQ for pre-authentication data")
 	}
-	k.PAData = types.PADataSequence{
-		types.PAData{
-			PADataType:  patype.PA_TGS_REQ,
-			PADataValue: apb,
-		},
+	// Replace only the PA-TGS-REQ so that other pre-authentication data, such as the PA-FOR-USER of S4U2Self, is kept
+	// when the authenticator is regenerated.
+	pa := types.PAData{
+		PADataType:  patype.PA_TGS_REQ,
+		PADataValue: apb,
+	}
+	for i := range k.PAData {
+		if k.PAData[i].PADataType == patype.PA_TGS_REQ {
+			k.PAData[i] = pa
+			return nil
+		}
 	}
+	k.PAData = append(types.PADataSequence{pa}, k.PAData...)
 	return nil
 }
 
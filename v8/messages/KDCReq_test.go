@@ -6,12 +6,15 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/credentials"
 	"github.com/Osirium/gokrb5/v8/iana"
 	"github.com/Osirium/gokrb5/v8/iana/addrtype"
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
 	"github.com/Osirium/gokrb5/v8/iana/nametype"
 	"github.com/Osirium/gokrb5/v8/iana/patype"
 	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -424,3 +427,47 @@ func TestMarshalTGSReq(t *testing.T) {
 	}
 	assert.Equal(t, b, mb, "Marshal bytes of TGSReq not as expected")
 }
+
+func TestTGSReq_ApplyKDCOffset(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	c := new(credentials.CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	tgt, err := CCacheTicket(c.Credentials[0])
+	if err != nil {
+		t.Fatalf("Error decoding TGT: %v", err)
+	}
+	sessionKey := c.Credentials[0].Key
+	cfg, _ := config.NewFromString(testdata.KRB5_CONF)
+	cfg.LibDefaults.NoAddresses = true
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	tgsReq, err := NewTGSReq(c.GetClientPrincipalName(), c.GetClientRealm(), cfg, tgt, sessionKey, sname, false)
+	if err != nil {
+		t.Fatalf("Error creating TGS_REQ: %v", err)
+	}
+	till := tgsReq.ReqBody.Till
+	offset := time.Hour
+	err = tgsReq.ApplyKDCOffset(offset, tgt, sessionKey)
+	if err != nil {
+		t.Fatalf("Error applying KDC offset: %v", err)
+	}
+	assert.Equal(t, till.Add(offset), tgsReq.ReqBody.Till, "Till time not adjusted")
+
+	var apReq APReq
+	err = apReq.Unmarshal(tgsReq.PAData[0].PADataValue)
+	if err != nil {
+		t.Fatalf("Error unmarshaling AP_REQ from PAData: %v", err)
+	}
+	err = apReq.DecryptAuthenticator(sessionKey)
+	if err != nil {
+		t.Fatalf("Error decrypting authenticator: %v", err)
+	}
+	d := apReq.Authenticator.CTime.Sub(time.Now().UTC())
+	assert.True(t, d > offset-time.Minute && d < offset+time.Minute, "Authenticator time not adjusted by offset: %v", d)
+}
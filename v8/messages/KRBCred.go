@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Osirium/gokrb5/v8/asn1tools"
+	"github.com/Osirium/gokrb5/v8/credentials"
 	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana"
 	"github.com/Osirium/gokrb5/v8/iana/asnAppTag"
 	"github.com/Osirium/gokrb5/v8/iana/keyusage"
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
@@ -49,11 +52,144 @@ type KrbCredInfo struct {
 	StartTime time.Time           `asn1:"generalized,optional,explicit,tag:5"`
 	EndTime   time.Time           `asn1:"generalized,optional,explicit,tag:6"`
 	RenewTill time.Time           `asn1:"generalized,optional,explicit,tag:7"`
-	SRealm    string              `asn1:"optional,explicit,ia5,tag:8"`
+	SRealm    string              `asn1:"generalstring,optional,explicit,tag:8"`
 	SName     types.PrincipalName `asn1:"optional,explicit,tag:9"`
 	CAddr     types.HostAddresses `asn1:"optional,explicit,tag:10"`
 }
 
+// NewKRBCred returns a KRB_CRED that transfers the tickets provided, with the details of each ticket including its
+// session key in the corresponding KrbCredInfo. The encrypted part is encrypted with the key provided.
+func NewKRBCred(tkts []Ticket, infos []KrbCredInfo, key types.EncryptionKey) (KRBCred, error) {
+	k := KRBCred{
+		PVNO:    iana.PVNO,
+		MsgType: msgtype.KRB_CRED,
+		Tickets: tkts,
+		DecryptedEncPart: EncKrbCredPart{
+			TicketInfo: infos,
+		},
+	}
+	err := k.EncryptEncPart(key)
+	return k, err
+}
+
+// NewKrbCredInfo returns the KrbCredInfo for a ticket issued to the client principal provided, from the encrypted part
+// of the reply the ticket was issued in.
+func NewKrbCredInfo(crealm string, cname types.PrincipalName, dep EncKDCRepPart) KrbCredInfo {
+	return KrbCredInfo{
+		Key:       dep.Key,
+		PRealm:    crealm,
+		PName:     cname,
+		Flags:     dep.Flags,
+		AuthTime:  dep.AuthTime,
+		StartTime: dep.StartTime,
+		EndTime:   dep.EndTime,
+		RenewTill: dep.RenewTill,
+		SRealm:    dep.SRealm,
+		SName:     dep.SName,
+		CAddr:     dep.CAddr,
+	}
+}
+
+// NewKRBCredFromCCache returns a KRB_CRED that transfers the entries of the credential cache provided, encrypted with
+// the key provided.
+func NewKRBCredFromCCache(c *credentials.CCache, key types.EncryptionKey) (KRBCred, error) {
+	var tkts []Ticket
+	var infos []KrbCredInfo
+	for _, cred := range c.GetEntries() {
+		tkt, err := CCacheTicket(cred)
+		if err != nil {
+			return KRBCred{}, err
+		}
+		tkts = append(tkts, tkt)
+		infos = append(infos, KrbCredInfo{
+			Key:       cred.Key,
+			PRealm:    cred.Client.Realm,
+			PName:     cred.Client.PrincipalName,
+			Flags:     cred.TicketFlags,
+			AuthTime:  cred.AuthTime,
+			StartTime: cred.StartTime,
+			EndTime:   cred.EndTime,
+			RenewTill: cred.RenewTill,
+			SRealm:    cred.Server.Realm,
+			SName:     cred.Server.PrincipalName,
+			CAddr:     cred.Addresses,
+		})
+	}
+	return NewKRBCred(tkts, infos, key)
+}
+
+// CCache returns the tickets transferred in the decrypted KRB_CRED as a credential cache for the principal of the
+// first ticket.
+func (k *KRBCred) CCache() (*credentials.CCache, error) {
+	infos := k.DecryptedEncPart.TicketInfo
+	if len(k.Tickets) < 1 || len(infos) != len(k.Tickets) {
+		return nil, krberror.NewErrorf(krberror.KRBMsgError, "KRB_CRED does not contain decrypted details of its tickets")
+	}
+	c := &credentials.CCache{
+		Version:          4,
+		DefaultPrincipal: credentials.NewPrincipal(infos[0].PName, infos[0].PRealm),
+	}
+	for i, tkt := range k.Tickets {
+		b, err := tkt.Marshal()
+		if err != nil {
+			return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling ticket %d of KRB_CRED", i+1)
+		}
+		info := infos[i]
+		c.AddCredential(&credentials.Credential{
+			Client:      credentials.NewPrincipal(info.PName, info.PRealm),
+			Server:      credentials.NewPrincipal(tkt.SName, tkt.Realm),
+			Key:         info.Key,
+			AuthTime:    info.AuthTime,
+			StartTime:   info.StartTime,
+			EndTime:     info.EndTime,
+			RenewTill:   info.RenewTill,
+			TicketFlags: info.Flags,
+			Addresses:   info.CAddr,
+			Ticket:      b,
+		})
+	}
+	return c, nil
+}
+
+// Marshal the KRBCred.
+func (k *KRBCred) Marshal() ([]byte, error) {
+	m := marshalKRBCred{
+		PVNO:    k.PVNO,
+		MsgType: k.MsgType,
+		EncPart: k.EncPart,
+	}
+	var err error
+	m.Tickets, err = MarshalTicketSequence(k.Tickets)
+	if err != nil {
+		return []byte{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling tickets within KRB_CRED")
+	}
+	m.Tickets.Tag = 2
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return []byte{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling KRB_CRED")
+	}
+	return asn1tools.AddASNAppTag(b, asnAppTag.KRBCred), nil
+}
+
+// EncryptEncPart encrypts the DecryptedEncPart within the KRBCred.
+// Use to prepare for marshaling. If the key provided has an etype of zero the encrypted part is not encrypted, as
+// used when the KRB_CRED is protected by other means.
+func (k *KRBCred) EncryptEncPart(key types.EncryptionKey) error {
+	b, err := k.DecryptedEncPart.Marshal()
+	if err != nil {
+		return err
+	}
+	if key.KeyType == 0 {
+		k.EncPart = types.EncryptedData{Cipher: b}
+		return nil
+	}
+	k.EncPart, err = crypto.GetEncryptedData(b, key, keyusage.KRB_CRED_ENCPART, 0)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncryptingError, "error encrypting KRB_CRED EncPart")
+	}
+	return nil
+}
+
 // Unmarshal bytes b into the KRBCred struct.
 func (k *KRBCred) Unmarshal(b []byte) error {
 	var m marshalKRBCred
@@ -78,10 +214,15 @@ func (k *KRBCred) Unmarshal(b []byte) error {
 }
 
 // DecryptEncPart decrypts the encrypted part of a KRB_CRED.
+// An encrypted part with an etype of zero is not encrypted and is unmarshaled without the key.
 func (k *KRBCred) DecryptEncPart(key types.EncryptionKey) error {
-	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.KRB_CRED_ENCPART)
-	if err != nil {
-		return krberror.Errorf(err, krberror.DecryptingError, "error decrypting KRB_CRED EncPart")
+	b := k.EncPart.Cipher
+	var err error
+	if k.EncPart.EType != 0 {
+		b, err = crypto.DecryptEncPart(k.EncPart, key, keyusage.KRB_CRED_ENCPART)
+		if err != nil {
+			return krberror.Errorf(err, krberror.DecryptingError, "error decrypting KRB_CRED EncPart")
+		}
 	}
 	var denc EncKrbCredPart
 	err = denc.Unmarshal(b)
@@ -92,6 +233,15 @@ func (k *KRBCred) DecryptEncPart(key types.EncryptionKey) error {
 	return nil
 }
 
+// Marshal the encrypted part of KRB_CRED.
+func (k *EncKrbCredPart) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*k)
+	if err != nil {
+		return []byte{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling EncKrbCredPart")
+	}
+	return asn1tools.AddASNAppTag(b, asnAppTag.EncKrbCredPart), nil
+}
+
 // Unmarshal bytes b into the encrypted part of KRB_CRED.
 func (k *EncKrbCredPart) Unmarshal(b []byte) error {
 	_, err := asn1.UnmarshalWithParams(b, k, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.EncKrbCredPart))
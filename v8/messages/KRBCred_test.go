@@ -6,11 +6,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/Osirium/gokrb5/v8/crypto"
 	"github.com/Osirium/gokrb5/v8/iana"
 	"github.com/Osirium/gokrb5/v8/iana/addrtype"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
 	"github.com/Osirium/gokrb5/v8/iana/nametype"
 	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -130,3 +133,160 @@ func TestUnmarshalEncCredPart_optionalsNULL(t *testing.T) {
 		assert.Equal(t, "12d00023", hex.EncodeToString(addr.Address), fmt.Sprintf("Host address not as expected for address item %d within ticket info %d", j+1, i+1))
 	}
 }
+
+func TestMarshalKRBCred(t *testing.T) {
+	t.Parallel()
+	var a KRBCred
+	b, err := hex.DecodeString(testdata.MarshaledKRB5cred)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshaled bytes not as expected")
+}
+
+func TestMarshalEncCredPart(t *testing.T) {
+	t.Parallel()
+	for _, v := range []string{testdata.MarshaledKRB5enc_cred_part, testdata.MarshaledKRB5enc_cred_partOptionalsNULL} {
+		var a EncKrbCredPart
+		b, err := hex.DecodeString(v)
+		if err != nil {
+			t.Fatalf("Test vector read error: %v", err)
+		}
+		err = a.Unmarshal(b)
+		if err != nil {
+			t.Fatalf("Unmarshal error: %v", err)
+		}
+		mb, err := a.Marshal()
+		if err != nil {
+			t.Fatalf("Marshal error: %v", err)
+		}
+		assert.Equal(t, b, mb, "Marshaled bytes not as expected")
+	}
+}
+
+func TestKRBCred_MarshalRoundTrip(t *testing.T) {
+	t.Parallel()
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	key, _ := types.GenerateEncryptionKey(et)
+	skey, _ := types.GenerateEncryptionKey(et)
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+testdata.TEST_REALM)
+	tkt := Ticket{
+		TktVNO:  iana.PVNO,
+		Realm:   testdata.TEST_REALM,
+		SName:   sname,
+		EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte("cipher")},
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	info := KrbCredInfo{
+		Key:      skey,
+		PRealm:   testdata.TEST_REALM,
+		PName:    types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"),
+		Flags:    types.NewKrbFlags(),
+		AuthTime: now,
+		EndTime:  now.Add(time.Hour),
+		SRealm:   testdata.TEST_REALM,
+		SName:    sname,
+	}
+	k, err := NewKRBCred([]Ticket{tkt}, []KrbCredInfo{info}, key)
+	if err != nil {
+		t.Fatalf("error creating KRB_CRED: %v", err)
+	}
+	b, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRB_CRED: %v", err)
+	}
+	var u KRBCred
+	if err := u.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling KRB_CRED: %v", err)
+	}
+	if assert.Len(t, u.Tickets, 1, "number of tickets not as expected") {
+		assert.Equal(t, sname, u.Tickets[0].SName, "ticket SName not as expected")
+	}
+	if err := u.DecryptEncPart(key); err != nil {
+		t.Fatalf("error decrypting KRB_CRED: %v", err)
+	}
+	if assert.Len(t, u.DecryptedEncPart.TicketInfo, 1, "number of ticket infos not as expected") {
+		ti := u.DecryptedEncPart.TicketInfo[0]
+		assert.Equal(t, skey, ti.Key, "ticket session key not as expected")
+		assert.Equal(t, info.PName, ti.PName, "principal name not as expected")
+		assert.Equal(t, testdata.TEST_REALM, ti.SRealm, "service realm not as expected")
+		assert.Equal(t, now.Add(time.Hour), ti.EndTime, "end time not as expected")
+	}
+}
+
+func TestKRBCred_CCache(t *testing.T) {
+	t.Parallel()
+	now := time.Now().UTC().Truncate(time.Second)
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	var tkts []Ticket
+	var infos []KrbCredInfo
+	for _, spn := range []string{"krbtgt/" + testdata.TEST_REALM, "HTTP/host.test.gokrb5"} {
+		et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+		skey, _ := types.GenerateEncryptionKey(et)
+		sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, spn)
+		tkts = append(tkts, Ticket{
+			TktVNO:  iana.PVNO,
+			Realm:   testdata.TEST_REALM,
+			SName:   sname,
+			EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte("cipher")},
+		})
+		infos = append(infos, NewKrbCredInfo(testdata.TEST_REALM, cname, EncKDCRepPart{
+			Key:       skey,
+			Flags:     types.NewKrbFlags(),
+			AuthTime:  now,
+			StartTime: now,
+			EndTime:   now.Add(time.Hour),
+			RenewTill: now.Add(time.Hour),
+			SRealm:    testdata.TEST_REALM,
+			SName:     sname,
+		}))
+	}
+	// A KRB_CRED that is not encrypted is passed between processes of the same user
+	k, err := NewKRBCred(tkts, infos, types.EncryptionKey{})
+	if err != nil {
+		t.Fatalf("error creating KRB_CRED: %v", err)
+	}
+	assert.Equal(t, int32(0), k.EncPart.EType, "encPart etype not as expected")
+	b, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRB_CRED: %v", err)
+	}
+	var u KRBCred
+	if err := u.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling KRB_CRED: %v", err)
+	}
+	if err := u.DecryptEncPart(types.EncryptionKey{}); err != nil {
+		t.Fatalf("error decoding KRB_CRED encPart: %v", err)
+	}
+	c, err := u.CCache()
+	if err != nil {
+		t.Fatalf("error converting KRB_CRED to a credential cache: %v", err)
+	}
+	assert.Equal(t, cname, c.DefaultPrincipal.PrincipalName, "default principal not as expected")
+	assert.Len(t, c.GetEntries(), 2, "number of credential cache entries not as expected")
+	cred, ok := c.GetEntry(tkts[1].SName)
+	if assert.True(t, ok, "service ticket not in credential cache") {
+		assert.Equal(t, infos[1].Key, cred.Key, "session key not as expected")
+		assert.Equal(t, now.Add(time.Hour), cred.EndTime, "end time not as expected")
+	}
+
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	key, _ := types.GenerateEncryptionKey(et)
+	k, err = NewKRBCredFromCCache(c, key)
+	if err != nil {
+		t.Fatalf("error creating KRB_CRED from credential cache: %v", err)
+	}
+	assert.Len(t, k.Tickets, 2, "number of tickets not as expected")
+	if err := k.DecryptEncPart(key); err != nil {
+		t.Fatalf("error decrypting KRB_CRED: %v", err)
+	}
+	assert.Equal(t, infos, k.DecryptedEncPart.TicketInfo, "ticket infos not as expected")
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/Osirium/gokrb5/v8/iana/asnAppTag"
 	"github.com/Osirium/gokrb5/v8/iana/errorcode"
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
 	"github.com/Osirium/gokrb5/v8/krberror"
 	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/jcmturner/gofork/encoding/asn1"
@@ -79,6 +80,86 @@ func (k KRBError) Error() string {
 	return etxt
 }
 
+// Is reports whether the target is the krberror sentinel error for the KRBError's error code, so that errors.Is can
+// be used to branch on the class of a Kerberos error:
+//
+// if errors.Is(err, krberror.ErrClockSkew) { ... }
+func (k KRBError) Is(target error) bool {
+	err, ok := krberror.CodeError(k.ErrorCode)
+	return ok && err == target
+}
+
+// PreAuthHints holds the pre-authentication hints a KDC returns in the METHOD-DATA of a KRB_ERROR requesting
+// pre-authentication (RFC 4120 section 5.2.7), decoded into their types.
+type PreAuthHints struct {
+	// MethodData is the pre-authentication data the hints are decoded from. It lists the mechanisms the KDC accepts.
+	MethodData types.PADataSequence
+	ETypeInfo2 types.ETypeInfo2
+	ETypeInfo  types.ETypeInfo
+	// Cookie is the PA-FX-COOKIE to return to the KDC in the next request (RFC 6113 section 5.2).
+	Cookie []byte
+	// OTPChallenge is the KDC's request for a one-time password (RFC 6560), if any.
+	OTPChallenge *PAOTPChallenge
+}
+
+// NewPreAuthHints decodes the pre-authentication hints in the pre-authentication data provided.
+func NewPreAuthHints(pas types.PADataSequence) (PreAuthHints, error) {
+	h := PreAuthHints{MethodData: pas}
+	var err error
+	for _, pa := range pas {
+		switch pa.PADataType {
+		case patype.PA_ETYPE_INFO2:
+			h.ETypeInfo2, err = pa.GetETypeInfo2()
+			if err != nil {
+				return h, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling ETYPE-INFO2 hint")
+			}
+		case patype.PA_ETYPE_INFO:
+			h.ETypeInfo, err = pa.GetETypeInfo()
+			if err != nil {
+				return h, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling ETYPE-INFO hint")
+			}
+		case patype.PA_FX_COOKIE:
+			h.Cookie = pa.PADataValue
+		case patype.PA_OTP_CHALLENGE:
+			var c PAOTPChallenge
+			if err = c.Unmarshal(pa.PADataValue); err != nil {
+				return h, err
+			}
+			h.OTPChallenge = &c
+		}
+	}
+	return h, nil
+}
+
+// PreAuthHints decodes the pre-authentication hints in the e-data of the KRB_ERROR, which holds METHOD-DATA when the
+// KDC requires pre-authentication or pre-authentication failed. Errors without e-data have no hints.
+func (k *KRBError) PreAuthHints() (PreAuthHints, error) {
+	var pas types.PADataSequence
+	if len(k.EData) > 0 {
+		if err := pas.Unmarshal(k.EData); err != nil {
+			return PreAuthHints{}, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KRB_ERROR e-data as METHOD-DATA")
+		}
+	}
+	return NewPreAuthHints(pas)
+}
+
+// Accepts indicates if the KDC lists the pre-authentication type in its hints.
+func (h *PreAuthHints) Accepts(paType int32) bool {
+	return h.MethodData.Contains(paType)
+}
+
+// EType returns the etype the KDC indicates the client's long-term key is to be used with, from ETYPE-INFO2 in
+// preference to ETYPE-INFO (RFC 4120 section 5.2.7.5).
+func (h *PreAuthHints) EType() (int32, bool) {
+	if len(h.ETypeInfo2) > 0 {
+		return h.ETypeInfo2[0].EType, true
+	}
+	if len(h.ETypeInfo) > 0 {
+		return h.ETypeInfo[0].EType, true
+	}
+	return 0, false
+}
+
 func processUnmarshalReplyError(b []byte, err error) error {
 	switch err.(type) {
 	case asn1.StructuralError:
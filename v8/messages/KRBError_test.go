@@ -2,14 +2,20 @@ package messages
 
 import (
 	"encoding/hex"
+	"errors"
 	"testing"
 	"time"
 
 	"github.com/Osirium/gokrb5/v8/iana"
 	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
 	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/krberror"
 	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -83,3 +89,69 @@ func TestUnmarshalMarshalKRBError_optionalsNULL(t *testing.T) {
 	}
 	assert.Equal(t, b, b2, "marshalled bytes not as expected")
 }
+
+func TestKRBError_PreAuthHints(t *testing.T) {
+	t.Parallel()
+	info, err := asn1.Marshal(types.ETypeInfo2{{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Salt: "TEST.GOKRB5user"}})
+	if err != nil {
+		t.Fatalf("error marshaling ETYPE-INFO2: %v", err)
+	}
+	c := PAOTPChallenge{Nonce: []byte("nonce"), TokenInfo: []OTPTokenInfo{{Flags: types.NewKrbFlags()}}}
+	otp, err := c.PAData()
+	if err != nil {
+		t.Fatalf("error marshaling PA-OTP-CHALLENGE: %v", err)
+	}
+	e := NewKRBError(types.PrincipalName{}, "TEST.GOKRB5", errorcode.KDC_ERR_PREAUTH_REQUIRED, "")
+	e.EData, err = asn1.Marshal(types.PADataSequence{
+		{PADataType: patype.PA_ENC_TIMESTAMP},
+		{PADataType: patype.PA_ETYPE_INFO2, PADataValue: info},
+		{PADataType: patype.PA_FX_COOKIE, PADataValue: []byte("cookie")},
+		otp,
+	})
+	if err != nil {
+		t.Fatalf("error marshaling METHOD-DATA: %v", err)
+	}
+	h, err := e.PreAuthHints()
+	if err != nil {
+		t.Fatalf("error decoding pre-authentication hints: %v", err)
+	}
+	assert.True(t, h.Accepts(patype.PA_ENC_TIMESTAMP), "encrypted timestamp not accepted")
+	assert.False(t, h.Accepts(patype.PA_PK_AS_REQ), "PKINIT not expected to be accepted")
+	et, ok := h.EType()
+	assert.True(t, ok, "etype hint not found")
+	assert.Equal(t, etypeID.AES256_CTS_HMAC_SHA1_96, et, "etype hint not as expected")
+	if assert.Len(t, h.ETypeInfo2, 1, "ETYPE-INFO2 not as expected") {
+		assert.Equal(t, "TEST.GOKRB5user", h.ETypeInfo2[0].Salt, "salt not as expected")
+	}
+	assert.Equal(t, []byte("cookie"), h.Cookie, "cookie not as expected")
+	if assert.NotNil(t, h.OTPChallenge, "OTP challenge not decoded") {
+		assert.Equal(t, []byte("nonce"), h.OTPChallenge.Nonce, "OTP challenge nonce not as expected")
+	}
+
+	// An error without e-data has no hints
+	e.EData = nil
+	h, err = e.PreAuthHints()
+	assert.NoError(t, err, "error not expected without e-data")
+	_, ok = h.EType()
+	assert.False(t, ok, "etype hint not expected without e-data")
+
+	e.EData = []byte{0x01}
+	_, err = e.PreAuthHints()
+	assert.Error(t, err, "error expected for e-data that is not METHOD-DATA")
+}
+
+func TestKRBError_Is(t *testing.T) {
+	t.Parallel()
+	e := NewKRBError(types.PrincipalName{}, "TEST.GOKRB5", errorcode.KRB_AP_ERR_SKEW, "")
+	assert.True(t, errors.Is(e, krberror.ErrClockSkew), "KRB_ERROR does not match its sentinel error")
+	assert.False(t, errors.Is(e, krberror.ErrPreauthFailed), "KRB_ERROR matches another sentinel error")
+
+	// The KRB_ERROR can be found through the errors that wrap it
+	err := krberror.Errorf(e, krberror.KDCError, "AS Exchange Error: kerberos error response from KDC")
+	err = krberror.Errorf(err, krberror.KRBMsgError, "error logging in")
+	assert.True(t, errors.Is(err, krberror.ErrClockSkew), "wrapped KRB_ERROR does not match its sentinel error")
+	var ke KRBError
+	if assert.True(t, errors.As(err, &ke), "KRB_ERROR not found in wrapped error") {
+		assert.Equal(t, errorcode.KRB_AP_ERR_SKEW, ke.ErrorCode, "error code not as expected")
+	}
+}
@@ -0,0 +1,462 @@
+package messages
+
+// Reference: https://tools.ietf.org/html/rfc6113
+// Section: 5.4
+
+import (
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+const (
+	// FXFastArmorAPRequest is the armor type of a KrbFastArmor that holds an AP_REQ for an armor TGT.
+	FXFastArmorAPRequest int32 = 1
+)
+
+// FAST key derivation peppers from RFC 6113.
+const (
+	fastSubkeyArmorPepper        = "subkeyarmor"
+	fastTicketArmorPepper        = "ticketarmor"
+	fastStrengthenKeyPepper      = "strengthenkey"
+	fastReplyKeyPepper           = "replykey"
+	fastClientChallengePepper    = "clientchallengearmor"
+	fastKDCChallengePepper       = "kdcchallengearmor"
+	fastChallengeLongTermPepper  = "challengelongterm"
+	fastArmoredDataChoiceTagSpec = "explicit,tag:0"
+)
+
+// KrbFastArmor implements RFC 6113 KrbFastArmor: https://tools.ietf.org/html/rfc6113#section-5.4.1.
+type KrbFastArmor struct {
+	ArmorType  int32  `asn1:"explicit,tag:0"`
+	ArmorValue []byte `asn1:"explicit,tag:1"`
+}
+
+// KrbFastArmoredReq implements RFC 6113 KrbFastArmoredReq, the armored-data choice of PA-FX-FAST-REQUEST.
+type KrbFastArmoredReq struct {
+	Armor       KrbFastArmor        `asn1:"explicit,optional,tag:0"`
+	ReqChecksum types.Checksum      `asn1:"explicit,tag:1"`
+	EncFastReq  types.EncryptedData `asn1:"explicit,tag:2"`
+}
+
+type marshalKrbFastReq struct {
+	FastOptions asn1.BitString       `asn1:"explicit,tag:0"`
+	PAData      types.PADataSequence `asn1:"explicit,tag:1"`
+	ReqBody     asn1.RawValue        `asn1:"explicit,tag:2"`
+}
+
+// KrbFastReq implements RFC 6113 KrbFastReq, which is encrypted within the KrbFastArmoredReq.
+type KrbFastReq struct {
+	FastOptions asn1.BitString
+	PAData      types.PADataSequence
+	ReqBody     KDCReqBody
+}
+
+// KrbFastArmoredRep implements RFC 6113 KrbFastArmoredRep, the armored-data choice of PA-FX-FAST-REPLY.
+type KrbFastArmoredRep struct {
+	EncFastRep types.EncryptedData `asn1:"explicit,tag:0"`
+}
+
+// KrbFastResponse implements RFC 6113 KrbFastResponse, which is encrypted within the KrbFastArmoredRep.
+type KrbFastResponse struct {
+	PAData        types.PADataSequence `asn1:"explicit,tag:0"`
+	StrengthenKey types.EncryptionKey  `asn1:"explicit,optional,tag:1"`
+	Finished      KrbFastFinished      `asn1:"explicit,optional,tag:2"`
+	Nonce         int                  `asn1:"explicit,tag:3"`
+}
+
+// KrbFastFinished implements RFC 6113 KrbFastFinished, which binds the ticket in the reply to the FAST exchange.
+type KrbFastFinished struct {
+	Timestamp      time.Time           `asn1:"generalized,explicit,tag:0"`
+	Usec           int                 `asn1:"explicit,tag:1"`
+	CRealm         string              `asn1:"generalstring,explicit,tag:2"`
+	CName          types.PrincipalName `asn1:"explicit,tag:3"`
+	TicketChecksum types.Checksum      `asn1:"explicit,tag:4"`
+}
+
+// NewKrbFastArmor creates the armor for an AS exchange from an armor TGT and its session key, as described in
+// RFC 6113 section 5.4.1.1. The AP_REQ in the armor carries a new sub-session key and the armor key returned is
+// derived from the sub-session key and the TGT's session key.
+func NewKrbFastArmor(tgt Ticket, sessionKey types.EncryptionKey, cname types.PrincipalName, crealm string) (KrbFastArmor, types.EncryptionKey, error) {
+	var armor KrbFastArmor
+	var armorKey types.EncryptionKey
+	et, err := crypto.GetEtype(sessionKey.KeyType)
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.EncryptingError, "error getting etype of armor TGT session key")
+	}
+	auth, err := types.NewAuthenticator(crealm, cname)
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.KRBMsgError, "error generating armor authenticator")
+	}
+	err = auth.GenerateSeqNumberAndSubKey(sessionKey.KeyType, et.GetKeyByteSize())
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.KRBMsgError, "error generating armor sub-session key")
+	}
+	ab, err := auth.Marshal()
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.EncodingError, "error marshaling armor authenticator")
+	}
+	// The armor AP_REQ is not part of a TGS_REQ so its authenticator uses the AP_REQ key usage
+	ed, err := crypto.GetEncryptedData(ab, sessionKey, keyusage.AP_REQ_AUTHENTICATOR, tgt.EncPart.KVNO)
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.EncryptingError, "error encrypting armor authenticator")
+	}
+	apReq := APReq{
+		PVNO:                   iana.PVNO,
+		MsgType:                msgtype.KRB_AP_REQ,
+		APOptions:              types.NewKrbFlags(),
+		Ticket:                 tgt,
+		EncryptedAuthenticator: ed,
+	}
+	b, err := apReq.Marshal()
+	if err != nil {
+		return armor, armorKey, krberror.Errorf(err, krberror.EncodingError, "error marshaling armor AP_REQ")
+	}
+	armorKey, err = FASTArmorKey(auth.SubKey, sessionKey)
+	if err != nil {
+		return armor, armorKey, err
+	}
+	armor = KrbFastArmor{
+		ArmorType:  FXFastArmorAPRequest,
+		ArmorValue: b,
+	}
+	return armor, armorKey, nil
+}
+
+// FASTArmorKey derives the FAST armor key from the sub-session key of the armor or TGS_REQ authenticator and the
+// session key of the ticket: KRB-FX-CF2(subkey, ticket session key, "subkeyarmor", "ticketarmor").
+func FASTArmorKey(subKey, sessionKey types.EncryptionKey) (types.EncryptionKey, error) {
+	k, err := crypto.KRBFXCF2(subKey, sessionKey, fastSubkeyArmorPepper, fastTicketArmorPepper)
+	if err != nil {
+		return k, krberror.Errorf(err, krberror.EncryptingError, "error deriving FAST armor key")
+	}
+	return k, nil
+}
+
+// FASTStrengthenReplyKey combines the strengthen key from a KrbFastResponse with the reply key of the exchange:
+// KRB-FX-CF2(strengthen key, reply key, "strengthenkey", "replykey").
+func FASTStrengthenReplyKey(strengthenKey, replyKey types.EncryptionKey) (types.EncryptionKey, error) {
+	k, err := crypto.KRBFXCF2(strengthenKey, replyKey, fastStrengthenKeyPepper, fastReplyKeyPepper)
+	if err != nil {
+		return k, krberror.Errorf(err, krberror.EncryptingError, "error deriving FAST strengthened reply key")
+	}
+	return k, nil
+}
+
+// FASTChallengeKeys returns the keys used to encrypt the client's and the KDC's encrypted challenges, derived from the
+// armor key and the client's long-term key as described in RFC 6113 section 5.4.6.
+func FASTChallengeKeys(armorKey, longTermKey types.EncryptionKey) (client, kdc types.EncryptionKey, err error) {
+	client, err = crypto.KRBFXCF2(armorKey, longTermKey, fastClientChallengePepper, fastChallengeLongTermPepper)
+	if err != nil {
+		err = krberror.Errorf(err, krberror.EncryptingError, "error deriving client challenge key")
+		return
+	}
+	kdc, err = crypto.KRBFXCF2(armorKey, longTermKey, fastKDCChallengePepper, fastChallengeLongTermPepper)
+	if err != nil {
+		err = krberror.Errorf(err, krberror.EncryptingError, "error deriving KDC challenge key")
+	}
+	return
+}
+
+// NewKrbFastArmoredReq encrypts the KrbFastReq with the armor key and checksums the body of the outer KDC_REQ that
+// will carry it. The armor is nil for a TGS_REQ, where the TGT in the PA-TGS-REQ provides the armor.
+func NewKrbFastArmoredReq(armor *KrbFastArmor, armorKey types.EncryptionKey, outerBody KDCReqBody, fastReq KrbFastReq) (KrbFastArmoredReq, error) {
+	var a KrbFastArmoredReq
+	et, err := crypto.GetEtype(armorKey.KeyType)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error getting etype of FAST armor key")
+	}
+	bb, err := outerBody.Marshal()
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncodingError, "error marshaling KDC_REQ body for FAST checksum")
+	}
+	cb, err := et.GetChecksumHash(armorKey.KeyValue, bb, keyusage.KEY_USAGE_FAST_REQ_CHKSUM)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.ChksumError, "error calculating FAST request checksum")
+	}
+	fb, err := fastReq.Marshal()
+	if err != nil {
+		return a, err
+	}
+	ed, err := crypto.GetEncryptedData(fb, armorKey, keyusage.KEY_USAGE_FAST_ENC, 0)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error encrypting KrbFastReq")
+	}
+	a.ReqChecksum = types.Checksum{
+		CksumType: et.GetHashID(),
+		Checksum:  cb,
+	}
+	a.EncFastReq = ed
+	if armor != nil {
+		a.Armor = *armor
+	}
+	return a, nil
+}
+
+// PAData returns the PA-FX-FAST pre-authentication data carrying the KrbFastArmoredReq.
+func (a *KrbFastArmoredReq) PAData() (types.PAData, error) {
+	b, err := marshalArmoredData(*a)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-FX-FAST request")
+	}
+	return types.PAData{
+		PADataType:  patype.PA_FX_FAST,
+		PADataValue: b,
+	}, nil
+}
+
+// Unmarshal bytes b, the value of PA-FX-FAST pre-authentication data in a request, into the KrbFastArmoredReq struct.
+func (a *KrbFastArmoredReq) Unmarshal(b []byte) error {
+	_, err := asn1.UnmarshalWithParams(b, a, fastArmoredDataChoiceTagSpec)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-FX-FAST request")
+	}
+	return nil
+}
+
+// Decrypt decrypts the KrbFastReq within the KrbFastArmoredReq and verifies the checksum of the outer request body.
+func (a *KrbFastArmoredReq) Decrypt(armorKey types.EncryptionKey, outerBody KDCReqBody) (KrbFastReq, error) {
+	var r KrbFastReq
+	et, err := crypto.GetChksumEtype(a.ReqChecksum.CksumType)
+	if err != nil {
+		return r, krberror.Errorf(err, krberror.ChksumError, "FAST request checksum type not supported")
+	}
+	bb, err := outerBody.Marshal()
+	if err != nil {
+		return r, krberror.Errorf(err, krberror.EncodingError, "error marshaling KDC_REQ body for FAST checksum")
+	}
+	if !et.VerifyChecksum(armorKey.KeyValue, bb, a.ReqChecksum.Checksum, keyusage.KEY_USAGE_FAST_REQ_CHKSUM) {
+		return r, krberror.NewErrorf(krberror.ChksumError, "FAST request checksum invalid")
+	}
+	b, err := crypto.DecryptEncPart(a.EncFastReq, armorKey, keyusage.KEY_USAGE_FAST_ENC)
+	if err != nil {
+		return r, krberror.Errorf(err, krberror.DecryptingError, "error decrypting KrbFastReq")
+	}
+	err = r.Unmarshal(b)
+	return r, err
+}
+
+// Marshal the KrbFastReq struct.
+func (r *KrbFastReq) Marshal() ([]byte, error) {
+	bb, err := r.ReqBody.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	m := marshalKrbFastReq{
+		FastOptions: r.FastOptions,
+		PAData:      r.PAData,
+		ReqBody: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			IsCompound: true,
+			Tag:        2,
+			Bytes:      bb,
+		},
+	}
+	if m.FastOptions.Bytes == nil {
+		m.FastOptions = types.NewKrbFlags()
+	}
+	if m.PAData == nil {
+		m.PAData = types.PADataSequence{}
+	}
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastReq")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the KrbFastReq struct.
+func (r *KrbFastReq) Unmarshal(b []byte) error {
+	var m marshalKrbFastReq
+	_, err := asn1.Unmarshal(b, &m)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastReq")
+	}
+	var body KDCReqBody
+	err = body.Unmarshal(m.ReqBody.Bytes)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastReq body")
+	}
+	r.FastOptions = m.FastOptions
+	r.PAData = m.PAData
+	r.ReqBody = body
+	return nil
+}
+
+// NewKrbFastArmoredRep encrypts the KrbFastResponse with the armor key.
+func NewKrbFastArmoredRep(armorKey types.EncryptionKey, resp KrbFastResponse) (KrbFastArmoredRep, error) {
+	var a KrbFastArmoredRep
+	b, err := resp.Marshal()
+	if err != nil {
+		return a, err
+	}
+	a.EncFastRep, err = crypto.GetEncryptedData(b, armorKey, keyusage.KEY_USAGE_FAST_REP, 0)
+	if err != nil {
+		return a, krberror.Errorf(err, krberror.EncryptingError, "error encrypting KrbFastResponse")
+	}
+	return a, nil
+}
+
+// PAData returns the PA-FX-FAST pre-authentication data carrying the KrbFastArmoredRep.
+func (a *KrbFastArmoredRep) PAData() (types.PAData, error) {
+	b, err := marshalArmoredData(*a)
+	if err != nil {
+		return types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-FX-FAST reply")
+	}
+	return types.PAData{
+		PADataType:  patype.PA_FX_FAST,
+		PADataValue: b,
+	}, nil
+}
+
+// Unmarshal bytes b, the value of PA-FX-FAST pre-authentication data in a reply, into the KrbFastArmoredRep struct.
+func (a *KrbFastArmoredRep) Unmarshal(b []byte) error {
+	_, err := asn1.UnmarshalWithParams(b, a, fastArmoredDataChoiceTagSpec)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-FX-FAST reply")
+	}
+	return nil
+}
+
+// Decrypt decrypts the KrbFastResponse within the KrbFastArmoredRep.
+func (a *KrbFastArmoredRep) Decrypt(armorKey types.EncryptionKey) (KrbFastResponse, error) {
+	var r KrbFastResponse
+	b, err := crypto.DecryptEncPart(a.EncFastRep, armorKey, keyusage.KEY_USAGE_FAST_REP)
+	if err != nil {
+		return r, krberror.Errorf(err, krberror.DecryptingError, "error decrypting KrbFastResponse")
+	}
+	err = r.Unmarshal(b)
+	return r, err
+}
+
+// Marshal the KrbFastResponse struct.
+func (r *KrbFastResponse) Marshal() ([]byte, error) {
+	m := *r
+	if m.PAData == nil {
+		m.PAData = types.PADataSequence{}
+	}
+	b, err := asn1.Marshal(m)
+	if err != nil {
+		return b, krberror.Errorf(err, krberror.EncodingError, "error marshaling KrbFastResponse")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the KrbFastResponse struct.
+func (r *KrbFastResponse) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, r)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KrbFastResponse")
+	}
+	return nil
+}
+
+// HasFinished indicates if the KrbFastResponse includes the KrbFastFinished, which it must in a reply that issues a
+// ticket.
+func (r *KrbFastResponse) HasFinished() bool {
+	return !r.Finished.Timestamp.IsZero() || len(r.Finished.TicketChecksum.Checksum) > 0
+}
+
+// Error returns the KRBError carried in the PA-FX-ERROR of the KrbFastResponse to a KDC_REQ that failed.
+func (r *KrbFastResponse) Error() (KRBError, bool, error) {
+	var e KRBError
+	for _, pa := range r.PAData {
+		if pa.PADataType == patype.PA_FX_ERROR {
+			err := e.Unmarshal(pa.PADataValue)
+			if err != nil {
+				return e, false, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-FX-ERROR")
+			}
+			return e, true, nil
+		}
+	}
+	return e, false, nil
+}
+
+// NewKrbFastFinished creates the KrbFastFinished for a reply issuing the ticket provided.
+func NewKrbFastFinished(armorKey types.EncryptionKey, crealm string, cname types.PrincipalName, tkt Ticket) (KrbFastFinished, error) {
+	var f KrbFastFinished
+	et, err := crypto.GetEtype(armorKey.KeyType)
+	if err != nil {
+		return f, krberror.Errorf(err, krberror.ChksumError, "error getting etype of FAST armor key")
+	}
+	tb, err := tkt.Marshal()
+	if err != nil {
+		return f, krberror.Errorf(err, krberror.EncodingError, "error marshaling ticket for FAST finished checksum")
+	}
+	cb, err := et.GetChecksumHash(armorKey.KeyValue, tb, keyusage.KEY_USAGE_FAST_FINISHED)
+	if err != nil {
+		return f, krberror.Errorf(err, krberror.ChksumError, "error calculating FAST finished checksum")
+	}
+	t := time.Now().UTC()
+	f = KrbFastFinished{
+		Timestamp: t.Truncate(time.Second),
+		Usec:      t.Nanosecond() / int(time.Microsecond),
+		CRealm:    crealm,
+		CName:     cname,
+		TicketChecksum: types.Checksum{
+			CksumType: et.GetHashID(),
+			Checksum:  cb,
+		},
+	}
+	return f, nil
+}
+
+// Verify checks the ticket checksum of the KrbFastFinished against the ticket in the reply.
+func (f *KrbFastFinished) Verify(armorKey types.EncryptionKey, tkt Ticket) error {
+	et, err := crypto.GetChksumEtype(f.TicketChecksum.CksumType)
+	if err != nil {
+		return krberror.Errorf(err, krberror.ChksumError, "FAST finished checksum type not supported")
+	}
+	tb, err := tkt.Marshal()
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error marshaling ticket for FAST finished checksum")
+	}
+	if !et.VerifyChecksum(armorKey.KeyValue, tb, f.TicketChecksum.Checksum, keyusage.KEY_USAGE_FAST_FINISHED) {
+		return krberror.NewErrorf(krberror.ChksumError, "FAST finished ticket checksum invalid")
+	}
+	return nil
+}
+
+// FASTReply finds the PA-FX-FAST pre-authentication data in a KDC reply, or in the e-data of a KRBError, and
+// decrypts the KrbFastResponse within it. The nonce of the response must match that of the request.
+func FASTReply(pas types.PADataSequence, armorKey types.EncryptionKey, nonce int) (KrbFastResponse, error) {
+	for _, pa := range pas {
+		if pa.PADataType != patype.PA_FX_FAST {
+			continue
+		}
+		var rep KrbFastArmoredRep
+		if err := rep.Unmarshal(pa.PADataValue); err != nil {
+			return KrbFastResponse{}, err
+		}
+		r, err := rep.Decrypt(armorKey)
+		if err != nil {
+			return r, err
+		}
+		if r.Nonce != nonce {
+			return r, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in FAST response does not match that in request")
+		}
+		return r, nil
+	}
+	return KrbFastResponse{}, krberror.NewErrorf(krberror.KRBMsgError, "KDC reply does not contain a FAST response")
+}
+
+// marshalArmoredData marshals the value as the armored-data choice of PA-FX-FAST-REQUEST or PA-FX-FAST-REPLY.
+func marshalArmoredData(v interface{}) ([]byte, error) {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		IsCompound: true,
+		Tag:        0,
+		Bytes:      b,
+	})
+}
@@ -0,0 +1,161 @@
+package messages
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnmarshalMarshalKrbFastResponse(t *testing.T) {
+	t.Parallel()
+	var a KrbFastResponse
+	b, err := hex.DecodeString(testdata.MarshaledKRB5fast_response)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	tt, _ := time.Parse(testdata.TEST_TIME_FORMAT, testdata.TEST_TIME)
+
+	assert.Equal(t, 2, len(a.PAData), "Number of PAData items not as expected")
+	for _, pa := range a.PAData {
+		assert.Equal(t, patype.PA_SAM_RESPONSE, pa.PADataType, "PAData type not as expected")
+		assert.Equal(t, []byte("pa-data"), pa.PADataValue, "PAData value not as expected")
+	}
+	assert.Equal(t, int32(1), a.StrengthenKey.KeyType, "Strengthen key type not as expected")
+	assert.Equal(t, []byte("12345678"), a.StrengthenKey.KeyValue, "Strengthen key value not as expected")
+	assert.True(t, a.HasFinished(), "Finished not found")
+	assert.Equal(t, tt, a.Finished.Timestamp, "Finished timestamp not as expected")
+	assert.Equal(t, 123456, a.Finished.Usec, "Finished usec not as expected")
+	assert.Equal(t, testdata.TEST_REALM, a.Finished.CRealm, "Finished CRealm not as expected")
+	assert.Equal(t, nametype.KRB_NT_PRINCIPAL, a.Finished.CName.NameType, "Finished CName NameType not as expected")
+	assert.Equal(t, testdata.TEST_PRINCIPALNAME_NAMESTRING, a.Finished.CName.NameString, "Finished CName not as expected")
+	assert.Equal(t, int32(1), a.Finished.TicketChecksum.CksumType, "Finished checksum type not as expected")
+	assert.Equal(t, []byte("1234"), a.Finished.TicketChecksum.Checksum, "Finished checksum not as expected")
+	assert.Equal(t, 42, a.Nonce, "Nonce not as expected")
+
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KrbFastResponse: %v", err)
+	}
+	assert.Equal(t, b, mb, "marshaled bytes not as expected")
+}
+
+func TestUnmarshalMarshalKrbFastArmoredRep(t *testing.T) {
+	t.Parallel()
+	var a KrbFastArmoredRep
+	b, err := hex.DecodeString(testdata.MarshaledKRB5pa_fx_fast_reply)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	assert.Equal(t, int32(0), a.EncFastRep.EType, "EType not as expected")
+	assert.Equal(t, 5, a.EncFastRep.KVNO, "KVNO not as expected")
+	assert.Equal(t, []byte(testdata.TEST_CIPHERTEXT), a.EncFastRep.Cipher, "Cipher not as expected")
+
+	pa, err := a.PAData()
+	if err != nil {
+		t.Fatalf("error marshaling PA-FX-FAST: %v", err)
+	}
+	assert.Equal(t, patype.PA_FX_FAST, pa.PADataType, "PAData type not as expected")
+	assert.Equal(t, b, pa.PADataValue, "marshaled bytes not as expected")
+}
+
+func TestKrbFastArmoredReq_Decrypt(t *testing.T) {
+	t.Parallel()
+	armorKey := types.EncryptionKey{
+		KeyType:  etypeID.AES256_CTS_HMAC_SHA1_96,
+		KeyValue: []byte("0123456789abcdef0123456789abcdef"),
+	}
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	body := KDCReqBody{
+		KDCOptions: types.NewKrbFlags(),
+		CName:      cname,
+		Realm:      "TEST.GOKRB5",
+		SName:      types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+		Till:       time.Now().UTC().Add(time.Hour).Truncate(time.Second),
+		Nonce:      1234,
+		EType:      []int32{etypeID.AES256_CTS_HMAC_SHA1_96},
+	}
+	fr := KrbFastReq{
+		PAData:  types.PADataSequence{{PADataType: patype.PA_FX_COOKIE, PADataValue: []byte("cookie")}},
+		ReqBody: body,
+	}
+	armor := KrbFastArmor{ArmorType: FXFastArmorAPRequest, ArmorValue: []byte{1, 2, 3}}
+	a, err := NewKrbFastArmoredReq(&armor, armorKey, body, fr)
+	if err != nil {
+		t.Fatalf("error creating KrbFastArmoredReq: %v", err)
+	}
+	pa, err := a.PAData()
+	if err != nil {
+		t.Fatalf("error marshaling PA-FX-FAST: %v", err)
+	}
+	var a2 KrbFastArmoredReq
+	if err := a2.Unmarshal(pa.PADataValue); err != nil {
+		t.Fatalf("error unmarshaling PA-FX-FAST: %v", err)
+	}
+	assert.Equal(t, armor, a2.Armor, "armor not as expected")
+	fr2, err := a2.Decrypt(armorKey, body)
+	if err != nil {
+		t.Fatalf("error decrypting KrbFastReq: %v", err)
+	}
+	assert.Equal(t, fr.PAData, fr2.PAData, "KrbFastReq PAData not as expected")
+	assert.Equal(t, body.Nonce, fr2.ReqBody.Nonce, "KrbFastReq body not as expected")
+	assert.Equal(t, body.CName, fr2.ReqBody.CName, "KrbFastReq body not as expected")
+
+	// The checksum binds the encrypted request to the outer request body
+	body.Nonce++
+	_, err = a2.Decrypt(armorKey, body)
+	assert.Error(t, err, "checksum over modified outer body should fail")
+}
+
+func TestFASTReply(t *testing.T) {
+	t.Parallel()
+	armorKey := types.EncryptionKey{
+		KeyType:  etypeID.AES128_CTS_HMAC_SHA1_96,
+		KeyValue: []byte("0123456789abcdef"),
+	}
+	kerr := NewKRBError(types.PrincipalName{}, "TEST.GOKRB5", 25, "")
+	eb, err := kerr.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRBError: %v", err)
+	}
+	rep, err := NewKrbFastArmoredRep(armorKey, KrbFastResponse{
+		PAData: types.PADataSequence{{PADataType: patype.PA_FX_ERROR, PADataValue: eb}},
+		Nonce:  99,
+	})
+	if err != nil {
+		t.Fatalf("error creating KrbFastArmoredRep: %v", err)
+	}
+	pa, err := rep.PAData()
+	if err != nil {
+		t.Fatalf("error marshaling PA-FX-FAST: %v", err)
+	}
+	r, err := FASTReply(types.PADataSequence{pa}, armorKey, 99)
+	if err != nil {
+		t.Fatalf("error processing FAST reply: %v", err)
+	}
+	assert.False(t, r.HasFinished(), "error response should not have finished")
+	e, ok, err := r.Error()
+	if err != nil || !ok {
+		t.Fatalf("PA-FX-ERROR not found: %v", err)
+	}
+	assert.Equal(t, int32(25), e.ErrorCode, "error code not as expected")
+
+	_, err = FASTReply(types.PADataSequence{pa}, armorKey, 100)
+	assert.Error(t, err, "nonce mismatch should fail")
+	_, err = FASTReply(types.PADataSequence{}, armorKey, 99)
+	assert.Error(t, err, "missing FAST response should fail")
+}
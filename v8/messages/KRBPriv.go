@@ -94,6 +94,21 @@ func (k *KRBPriv) EncryptEncPart(key types.EncryptionKey) error {
 	return nil
 }
 
+// Verify decrypts the encrypted part of the KRB_PRIV with the key provided and checks the message with the checks
+// provided.
+func (k *KRBPriv) Verify(key types.EncryptionKey, c AppDataChecks) (bool, error) {
+	err := k.DecryptEncPart(key)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.DecryptingError, "KRB_PRIV could not be decrypted")
+	}
+	p := k.DecryptedEncPart
+	err = c.verify(p.Timestamp, p.Usec, p.SequenceNumber, p.SAddress, p.RAddress)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // DecryptEncPart decrypts the encrypted part of the KRBPriv message.
 func (k *KRBPriv) DecryptEncPart(key types.EncryptionKey) error {
 	b, err := crypto.DecryptEncPart(k.EncPart, key, keyusage.KRB_PRIV_ENCPART)
@@ -2,6 +2,7 @@ package messages
 
 import (
 	"encoding/hex"
+	"net"
 	"testing"
 	"time"
 
@@ -131,3 +132,50 @@ func TestKRBPriv_EncryptEncPart(t *testing.T) {
 		t.Fatalf("error encrypting encpart: %v", err)
 	}
 }
+
+func TestKRBPriv_Verify(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{
+		KeyType:  int32(18),
+		KeyValue: []byte("12345678901234567890123456789012"),
+	}
+	addr := types.HostAddressFromNetIP(net.ParseIP("192.0.2.1"))
+	now := time.Now().UTC()
+	p := NewKRBPriv(EncKrbPrivPart{
+		UserData:       []byte("application data"),
+		Timestamp:      now.Truncate(time.Second),
+		Usec:           now.Nanosecond() / 1000,
+		SequenceNumber: 42,
+		SAddress:       addr,
+	})
+	if err := p.EncryptEncPart(key); err != nil {
+		t.Fatalf("error encrypting encpart: %v", err)
+	}
+	b, err := p.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRBPriv: %v", err)
+	}
+
+	var tests = []struct {
+		name   string
+		checks AppDataChecks
+		ok     bool
+	}{
+		{"sequence number", AppDataChecks{UseSequenceNumber: true, SequenceNumber: 42}, true},
+		{"wrong sequence number", AppDataChecks{UseSequenceNumber: true, SequenceNumber: 43}, false},
+		{"timestamp", AppDataChecks{}, true},
+		{"sender address", AppDataChecks{SAddress: addr}, true},
+		{"wrong sender address", AppDataChecks{SAddress: types.HostAddressFromNetIP(net.ParseIP("192.0.2.2"))}, false},
+	}
+	for _, test := range tests {
+		var r KRBPriv
+		if err := r.Unmarshal(b); err != nil {
+			t.Fatalf("Unmarshal error: %v", err)
+		}
+		ok, err := r.Verify(key, test.checks)
+		assert.Equal(t, test.ok, ok, "%s: verification result not as expected: %v", test.name, err)
+		if ok {
+			assert.Equal(t, []byte("application data"), r.DecryptedEncPart.UserData, "%s: user data not as expected", test.name)
+		}
+	}
+}
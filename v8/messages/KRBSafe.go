@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/Osirium/gokrb5/v8/asn1tools"
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana"
 	"github.com/Osirium/gokrb5/v8/iana/asnAppTag"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
 	"github.com/Osirium/gokrb5/v8/krberror"
 	"github.com/Osirium/gokrb5/v8/types"
@@ -29,6 +33,112 @@ type KRBSafeBody struct {
 	RAddress       types.HostAddress `asn1:"optional,explicit,tag:5"`
 }
 
+// AppDataChecks are the checks made of a KRB_SAFE or KRB_PRIV message received by an application, as described in
+// RFC 4120 sections 3.4.1 and 3.5.1. Either the sequence number of the message is checked or, if sequence numbers are
+// not used, its timestamp must be within the maximum clock skew. The application is responsible for detecting
+// replayed messages when sequence numbers are not used.
+type AppDataChecks struct {
+	// UseSequenceNumber indicates that the message must have the SequenceNumber expected.
+	UseSequenceNumber bool
+	SequenceNumber    int64
+	// MaxClockSkew is the maximum difference of the message timestamp from the local time. Defaults to 5 minutes.
+	MaxClockSkew time.Duration
+	// SAddress is the address of the sender. If set the sender address of the message must match it.
+	SAddress types.HostAddress
+	// RAddress is the address of the recipient. If set the recipient address of the message, if present, must match it.
+	RAddress types.HostAddress
+}
+
+// verify checks the sequence number or timestamp and the addresses of an application message.
+func (c AppDataChecks) verify(ts time.Time, usec int, seq int64, sAddr, rAddr types.HostAddress) error {
+	if len(c.SAddress.Address) > 0 && !c.SAddress.Equal(sAddr) {
+		return krberror.NewErrorf(krberror.KRBMsgError, "sender address of message is not as expected")
+	}
+	if len(c.RAddress.Address) > 0 && len(rAddr.Address) > 0 && !c.RAddress.Equal(rAddr) {
+		return krberror.NewErrorf(krberror.KRBMsgError, "recipient address of message is not as expected")
+	}
+	if c.UseSequenceNumber {
+		if seq != c.SequenceNumber {
+			return krberror.NewErrorf(krberror.KRBMsgError, "message sequence number %d is not the %d expected", seq, c.SequenceNumber)
+		}
+		return nil
+	}
+	d := c.MaxClockSkew
+	if d == 0 {
+		d = 5 * time.Minute
+	}
+	t := ts.Add(time.Duration(usec) * time.Microsecond)
+	if now := time.Now().UTC(); t.Before(now.Add(-d)) || t.After(now.Add(d)) {
+		return krberror.NewErrorf(krberror.KRBMsgError, "message timestamp %v is outside the maximum clock skew", t)
+	}
+	return nil
+}
+
+// NewKRBSafe returns a KRB_SAFE for the body provided with a checksum keyed with the key provided, which is typically
+// the subkey or session key of an established security context.
+func NewKRBSafe(body KRBSafeBody, key types.EncryptionKey) (KRBSafe, error) {
+	s := KRBSafe{
+		PVNO:     iana.PVNO,
+		MsgType:  msgtype.KRB_SAFE,
+		SafeBody: body,
+	}
+	b, err := body.Marshal()
+	if err != nil {
+		return s, err
+	}
+	et, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return s, krberror.Errorf(err, krberror.ChksumError, "error getting etype for KRB_SAFE checksum")
+	}
+	cb, err := et.GetChecksumHash(key.KeyValue, b, keyusage.KRB_SAFE_CHKSUM)
+	if err != nil {
+		return s, krberror.Errorf(err, krberror.ChksumError, "error calculating KRB_SAFE checksum")
+	}
+	s.Cksum = types.Checksum{
+		CksumType: et.GetHashID(),
+		Checksum:  cb,
+	}
+	return s, nil
+}
+
+// Marshal the KRBSafe.
+func (s *KRBSafe) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*s)
+	if err != nil {
+		return []byte{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling KRB_SAFE")
+	}
+	return asn1tools.AddASNAppTag(b, asnAppTag.KRBSafe), nil
+}
+
+// Marshal the KRBSafeBody.
+func (s *KRBSafeBody) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*s)
+	if err != nil {
+		return []byte{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling KRB_SAFE body")
+	}
+	return b, nil
+}
+
+// Verify the checksum of the KRB_SAFE with the key provided and check the message with the checks provided.
+func (s *KRBSafe) Verify(key types.EncryptionKey, c AppDataChecks) (bool, error) {
+	b, err := s.SafeBody.Marshal()
+	if err != nil {
+		return false, err
+	}
+	et, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return false, krberror.Errorf(err, krberror.ChksumError, "error getting etype for KRB_SAFE checksum")
+	}
+	if s.Cksum.CksumType != et.GetHashID() || !et.VerifyChecksum(key.KeyValue, b, s.Cksum.Checksum, keyusage.KRB_SAFE_CHKSUM) {
+		return false, krberror.NewErrorf(krberror.ChksumError, "KRB_SAFE checksum is not valid")
+	}
+	err = c.verify(s.SafeBody.Timestamp, s.SafeBody.Usec, s.SafeBody.SequenceNumber, s.SafeBody.SAddress, s.SafeBody.RAddress)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // Unmarshal bytes b into the KRBSafe struct.
 func (s *KRBSafe) Unmarshal(b []byte) error {
 	_, err := asn1.UnmarshalWithParams(b, s, fmt.Sprintf("application,explicit,tag:%v", asnAppTag.KRBSafe))
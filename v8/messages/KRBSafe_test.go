@@ -2,6 +2,7 @@ package messages
 
 import (
 	"encoding/hex"
+	"net"
 	"testing"
 	"time"
 
@@ -9,6 +10,7 @@ import (
 	"github.com/Osirium/gokrb5/v8/iana/addrtype"
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
 	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -60,3 +62,68 @@ func TestUnmarshalKRBSafe_optionalsNULL(t *testing.T) {
 	assert.Equal(t, int32(1), a.Cksum.CksumType, "Checksum type not as expected")
 	assert.Equal(t, []byte("1234"), a.Cksum.Checksum, "Checksum not as expected")
 }
+
+func TestMarshalKRBSafe(t *testing.T) {
+	t.Parallel()
+	var a KRBSafe
+	b, err := hex.DecodeString(testdata.MarshaledKRB5safe)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	mb, err := a.Marshal()
+	if err != nil {
+		t.Fatalf("Marshal error: %v", err)
+	}
+	assert.Equal(t, b, mb, "Marshaled bytes not as expected")
+}
+
+func TestKRBSafe_Verify(t *testing.T) {
+	t.Parallel()
+	key := types.EncryptionKey{
+		KeyType:  int32(18),
+		KeyValue: []byte("12345678901234567890123456789012"),
+	}
+	saddr := types.HostAddressFromNetIP(net.ParseIP("192.0.2.1"))
+	raddr := types.HostAddressFromNetIP(net.ParseIP("192.0.2.2"))
+	s, err := NewKRBSafe(KRBSafeBody{
+		UserData:  []byte("application data"),
+		Timestamp: time.Now().UTC().Add(-time.Minute).Truncate(time.Second),
+		SAddress:  saddr,
+		RAddress:  raddr,
+	}, key)
+	if err != nil {
+		t.Fatalf("error creating KRBSafe: %v", err)
+	}
+	b, err := s.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRBSafe: %v", err)
+	}
+	var a KRBSafe
+	if err := a.Unmarshal(b); err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+
+	var tests = []struct {
+		name   string
+		checks AppDataChecks
+		ok     bool
+	}{
+		{"timestamp", AppDataChecks{}, true},
+		{"addresses", AppDataChecks{SAddress: saddr, RAddress: raddr}, true},
+		{"wrong recipient address", AppDataChecks{RAddress: saddr}, false},
+		{"clock skew", AppDataChecks{MaxClockSkew: time.Second}, false},
+		{"sequence number", AppDataChecks{UseSequenceNumber: true, SequenceNumber: 1}, false},
+	}
+	for _, test := range tests {
+		ok, err := a.Verify(key, test.checks)
+		assert.Equal(t, test.ok, ok, "%s: verification result not as expected: %v", test.name, err)
+	}
+
+	a.SafeBody.UserData = []byte("modified data")
+	ok, _ := a.Verify(key, AppDataChecks{})
+	assert.False(t, ok, "modified KRBSafe should not verify")
+}
@@ -0,0 +1,116 @@
+package messages
+
+// Reference: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-sfu
+// Section: 2.2.1
+
+import (
+	"crypto/hmac"
+	"encoding/binary"
+
+	"github.com/Osirium/gokrb5/v8/crypto/rfc4757"
+	"github.com/Osirium/gokrb5/v8/fips"
+	"github.com/Osirium/gokrb5/v8/iana/chksumtype"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// S4UAuthPackage is the authentication package named in a PA-FOR-USER.
+const S4UAuthPackage = "Kerberos"
+
+// PAForUser implements MS-SFU PA-FOR-USER, which identifies the user a service requests a ticket to itself for with
+// S4U2Self.
+type PAForUser struct {
+	UserName    types.PrincipalName `asn1:"explicit,tag:0"`
+	UserRealm   string              `asn1:"generalstring,explicit,tag:1"`
+	Cksum       types.Checksum      `asn1:"explicit,tag:2"`
+	AuthPackage string              `asn1:"generalstring,explicit,tag:3"`
+}
+
+// NewPAForUser returns a PA-FOR-USER for the user provided, with its checksum keyed with the session key of the TGT
+// the TGS_REQ is made with.
+// The checksum is HMAC-MD5 based so a PA-FOR-USER cannot be created in FIPS mode.
+func NewPAForUser(user types.PrincipalName, realm string, sessionKey types.EncryptionKey) (PAForUser, error) {
+	pa := PAForUser{
+		UserName:    user,
+		UserRealm:   realm,
+		AuthPackage: S4UAuthPackage,
+	}
+	if err := fips.CheckChksumType(chksumtype.KERB_CHECKSUM_HMAC_MD5); err != nil {
+		return pa, krberror.Errorf(err, krberror.ChksumError, "error calculating PA-FOR-USER checksum")
+	}
+	cb, err := rfc4757.Checksum(sessionKey.KeyValue, keyusage.KERB_NON_KERB_CKSUM_SALT, pa.checksumData())
+	if err != nil {
+		return pa, krberror.Errorf(err, krberror.ChksumError, "error calculating PA-FOR-USER checksum")
+	}
+	pa.Cksum = types.Checksum{
+		CksumType: chksumtype.KERB_CHECKSUM_HMAC_MD5,
+		Checksum:  cb,
+	}
+	return pa, nil
+}
+
+// checksumData returns the data the PA-FOR-USER checksum is calculated over: the name type as a little-endian four
+// byte integer followed by the name components, realm and authentication package.
+func (pa *PAForUser) checksumData() []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, uint32(pa.UserName.NameType))
+	for _, s := range pa.UserName.NameString {
+		b = append(b, s...)
+	}
+	b = append(b, pa.UserRealm...)
+	return append(b, pa.AuthPackage...)
+}
+
+// Verify checks the PA-FOR-USER checksum with the session key of the TGT the TGS_REQ was made with.
+func (pa *PAForUser) Verify(sessionKey types.EncryptionKey) bool {
+	if pa.Cksum.CksumType != chksumtype.KERB_CHECKSUM_HMAC_MD5 || fips.Enabled() {
+		return false
+	}
+	cb, err := rfc4757.Checksum(sessionKey.KeyValue, keyusage.KERB_NON_KERB_CKSUM_SALT, pa.checksumData())
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(cb, pa.Cksum.Checksum)
+}
+
+// Marshal the PA-FOR-USER.
+func (pa *PAForUser) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*pa)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-FOR-USER")
+	}
+	return b, nil
+}
+
+// Unmarshal bytes b into the PA-FOR-USER.
+func (pa *PAForUser) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, pa)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-FOR-USER")
+	}
+	return nil
+}
+
+// PAData returns the PA-FOR-USER as pre-authentication data.
+func (pa *PAForUser) PAData() (types.PAData, error) {
+	b, err := pa.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{PADataType: patype.PA_FOR_USER, PADataValue: b}, nil
+}
+
+// ForUser returns the PA-FOR-USER of the TGS_REQ, if it is an S4U2Self request.
+func (k *TGSReq) ForUser() (PAForUser, bool, error) {
+	for _, pa := range k.PAData {
+		if pa.PADataType == patype.PA_FOR_USER {
+			var p PAForUser
+			err := p.Unmarshal(pa.PADataValue)
+			return p, err == nil, err
+		}
+	}
+	return PAForUser{}, false, nil
+}
@@ -0,0 +1,98 @@
+package messages
+
+import (
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/chksumtype"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPAForUser(t *testing.T) {
+	t.Parallel()
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	key, _ := types.GenerateEncryptionKey(et)
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "jsmith")
+	pa, err := NewPAForUser(user, testdata.TEST_REALM, key)
+	if err != nil {
+		t.Fatalf("error creating PA-FOR-USER: %v", err)
+	}
+	assert.Equal(t, chksumtype.KERB_CHECKSUM_HMAC_MD5, pa.Cksum.CksumType, "checksum type not as expected")
+	assert.Equal(t, append([]byte{1, 0, 0, 0}, "jsmith"+testdata.TEST_REALM+"Kerberos"...), pa.checksumData(), "checksum data not as expected")
+
+	b, err := pa.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling PA-FOR-USER: %v", err)
+	}
+	var u PAForUser
+	if err := u.Unmarshal(b); err != nil {
+		t.Fatalf("error unmarshaling PA-FOR-USER: %v", err)
+	}
+	assert.Equal(t, pa, u, "PA-FOR-USER not as expected after round trip")
+	assert.True(t, u.Verify(key), "PA-FOR-USER checksum not valid")
+
+	other, _ := types.GenerateEncryptionKey(et)
+	assert.False(t, u.Verify(other), "PA-FOR-USER checksum should not be valid with another key")
+	u.UserName = types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "administrator")
+	assert.False(t, u.Verify(key), "PA-FOR-USER checksum should not be valid for another user")
+}
+
+func TestNewS4U2SelfTGSReq(t *testing.T) {
+	t.Parallel()
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	key, _ := types.GenerateEncryptionKey(et)
+	svc := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	user := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "jsmith")
+	tkt := Ticket{Realm: testdata.TEST_REALM, SName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+testdata.TEST_REALM)}
+	req, err := NewS4U2SelfTGSReq(svc, testdata.TEST_REALM, c, tkt, key, svc, user, testdata.TEST_REALM)
+	if err != nil {
+		t.Fatalf("error creating S4U2Self TGS_REQ: %v", err)
+	}
+	pa, ok, err := req.ForUser()
+	if err != nil || !ok {
+		t.Fatalf("PA-FOR-USER not found in TGS_REQ: %v", err)
+	}
+	assert.Equal(t, user, pa.UserName, "PA-FOR-USER user not as expected")
+	assert.True(t, pa.Verify(key), "PA-FOR-USER checksum not valid")
+	assert.Equal(t, svc, req.ReqBody.SName, "TGS_REQ SName not as expected")
+}
+
+func TestNewS4U2ProxyTGSReq(t *testing.T) {
+	t.Parallel()
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	key, _ := types.GenerateEncryptionKey(et)
+	svc := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	backend := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/backend.test.gokrb5")
+	tkt := Ticket{Realm: testdata.TEST_REALM, SName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+testdata.TEST_REALM)}
+	evidence := Ticket{Realm: testdata.TEST_REALM, SName: svc}
+	req, err := NewS4U2ProxyTGSReq(svc, testdata.TEST_REALM, c, tkt, key, backend, evidence)
+	if err != nil {
+		t.Fatalf("error creating S4U2Proxy TGS_REQ: %v", err)
+	}
+	assert.True(t, types.IsFlagSet(&req.ReqBody.KDCOptions, flags.CNameInAddlTkt), "cname-in-addl-tkt flag not set")
+	if assert.Len(t, req.ReqBody.AdditionalTickets, 1, "number of additional tickets not as expected") {
+		assert.Equal(t, svc, req.ReqBody.AdditionalTickets[0].SName, "evidence ticket not as expected")
+	}
+	assert.Equal(t, backend, req.ReqBody.SName, "TGS_REQ SName not as expected")
+	var found bool
+	for _, pa := range req.PAData {
+		if pa.PADataType == patype.PA_PAC_OPTIONS {
+			found = true
+			var opts types.PAPACOptions
+			if err := opts.Unmarshal(pa.PADataValue); err != nil {
+				t.Fatalf("error unmarshaling PA-PAC-OPTIONS: %v", err)
+			}
+			assert.True(t, types.IsFlagSet(&opts.KerbValidationFlags, flags.PACOptionResourceBasedConstrainedDelegation), "RBCD PAC option not set")
+		}
+	}
+	assert.True(t, found, "PA-PAC-OPTIONS not found in TGS_REQ")
+}
@@ -0,0 +1,174 @@
+package messages
+
+// Reference: https://tools.ietf.org/html/rfc6560
+// Section: 4
+
+import (
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// OTP flags.
+const (
+	OTPFlagReserved            = 0
+	OTPFlagNextOTP             = 1
+	OTPFlagCombine             = 2
+	OTPFlagCollectPIN          = 3
+	OTPFlagDoNotCollectPIN     = 4
+	OTPFlagMustEncryptNonce    = 5
+	OTPFlagSeparatePINRequired = 6
+	OTPFlagCheckDigit          = 7
+)
+
+// OTP formats.
+const (
+	OTPFormatDecimal      = 0
+	OTPFormatHexadecimal  = 1
+	OTPFormatAlphanumeric = 2
+	OTPFormatBinary       = 3
+	OTPFormatBase64       = 4
+)
+
+// PAOTPChallenge implements RFC 6560 PA-OTP-CHALLENGE, with which the KDC requests a one-time password and describes
+// the tokens it accepts.
+type PAOTPChallenge struct {
+	Nonce     []byte         `asn1:"explicit,tag:0"`
+	Service   string         `asn1:"utf8,optional,explicit,tag:1"`
+	TokenInfo []OTPTokenInfo `asn1:"explicit,tag:2"`
+	Salt      string         `asn1:"generalstring,optional,explicit,tag:3"`
+	S2KParams []byte         `asn1:"optional,explicit,tag:4"`
+}
+
+// OTPTokenInfo implements RFC 6560 OTP-TOKENINFO, which describes a token the KDC accepts one-time passwords from.
+type OTPTokenInfo struct {
+	Flags            asn1.BitString        `asn1:"explicit,tag:0"`
+	Vendor           string                `asn1:"utf8,optional,explicit,tag:1"`
+	Challenge        []byte                `asn1:"optional,explicit,tag:2"`
+	Length           int32                 `asn1:"optional,explicit,tag:3"`
+	Format           int32                 `asn1:"optional,explicit,tag:4"`
+	TokenID          []byte                `asn1:"optional,explicit,tag:5"`
+	AlgID            string                `asn1:"utf8,optional,explicit,tag:6"`
+	SupportedHashAlg []AlgorithmIdentifier `asn1:"optional,explicit,tag:7"`
+	IterationCount   int32                 `asn1:"optional,explicit,tag:8"`
+}
+
+// AlgorithmIdentifier is the X.509 AlgorithmIdentifier.
+type AlgorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+// PAOTPRequest implements RFC 6560 PA-OTP-REQUEST, which carries the client's one-time password to the KDC.
+type PAOTPRequest struct {
+	Flags          asn1.BitString      `asn1:"explicit,tag:0"`
+	Nonce          []byte              `asn1:"optional,explicit,tag:1"`
+	EncData        types.EncryptedData `asn1:"explicit,tag:2"`
+	HashAlg        AlgorithmIdentifier `asn1:"optional,explicit,tag:3"`
+	IterationCount int32               `asn1:"optional,explicit,tag:4"`
+	OTPValue       []byte              `asn1:"optional,explicit,tag:5"`
+	PIN            string              `asn1:"utf8,optional,explicit,tag:6"`
+	Challenge      []byte              `asn1:"optional,explicit,tag:7"`
+	Time           time.Time           `asn1:"generalized,optional,explicit,tag:8"`
+	Counter        []byte              `asn1:"optional,explicit,tag:9"`
+	Format         int32               `asn1:"optional,explicit,tag:10"`
+	TokenID        []byte              `asn1:"optional,explicit,tag:11"`
+	AlgID          string              `asn1:"utf8,optional,explicit,tag:12"`
+	Vendor         string              `asn1:"utf8,optional,explicit,tag:13"`
+}
+
+// PAOTPEncRequest implements RFC 6560 PA-OTP-ENC-REQUEST, the encrypted part of the PA-OTP-REQUEST.
+type PAOTPEncRequest struct {
+	Nonce []byte `asn1:"explicit,tag:0"`
+}
+
+// Unmarshal bytes b into the PA-OTP-CHALLENGE.
+func (c *PAOTPChallenge) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, c)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-CHALLENGE")
+	}
+	return nil
+}
+
+// Marshal the PA-OTP-CHALLENGE.
+func (c *PAOTPChallenge) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*c)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-OTP-CHALLENGE")
+	}
+	return b, nil
+}
+
+// PAData returns the PA-OTP-CHALLENGE as pre-authentication data.
+func (c *PAOTPChallenge) PAData() (types.PAData, error) {
+	b, err := c.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{PADataType: patype.PA_OTP_CHALLENGE, PADataValue: b}, nil
+}
+
+// NewPAOTPRequest returns a PA-OTP-REQUEST for the one-time password provided, with the KDC's challenge nonce encrypted
+// with the FAST armor key.
+func NewPAOTPRequest(nonce []byte, armorKey types.EncryptionKey, otp []byte) (PAOTPRequest, error) {
+	r := PAOTPRequest{
+		Flags:    types.NewKrbFlags(),
+		OTPValue: otp,
+	}
+	b, err := asn1.Marshal(PAOTPEncRequest{Nonce: nonce})
+	if err != nil {
+		return r, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-OTP-ENC-REQUEST")
+	}
+	r.EncData, err = crypto.GetEncryptedData(b, armorKey, keyusage.KEY_USAGE_PA_OTP_REQUEST, 0)
+	if err != nil {
+		return r, krberror.Errorf(err, krberror.EncryptingError, "error encrypting PA-OTP-ENC-REQUEST")
+	}
+	return r, nil
+}
+
+// DecryptNonce decrypts the encrypted part of the PA-OTP-REQUEST with the FAST armor key and returns the nonce within.
+func (r *PAOTPRequest) DecryptNonce(armorKey types.EncryptionKey) ([]byte, error) {
+	b, err := crypto.DecryptEncPart(r.EncData, armorKey, keyusage.KEY_USAGE_PA_OTP_REQUEST)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.DecryptingError, "error decrypting PA-OTP-ENC-REQUEST")
+	}
+	var e PAOTPEncRequest
+	_, err = asn1.Unmarshal(b, &e)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-ENC-REQUEST")
+	}
+	return e.Nonce, nil
+}
+
+// Unmarshal bytes b into the PA-OTP-REQUEST.
+func (r *PAOTPRequest) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, r)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-OTP-REQUEST")
+	}
+	return nil
+}
+
+// Marshal the PA-OTP-REQUEST.
+func (r *PAOTPRequest) Marshal() ([]byte, error) {
+	b, err := asn1.Marshal(*r)
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-OTP-REQUEST")
+	}
+	return b, nil
+}
+
+// PAData returns the PA-OTP-REQUEST as pre-authentication data.
+func (r *PAOTPRequest) PAData() (types.PAData, error) {
+	b, err := r.Marshal()
+	if err != nil {
+		return types.PAData{}, err
+	}
+	return types.PAData{PADataType: patype.PA_OTP_REQUEST, PADataValue: b}, nil
+}
@@ -0,0 +1,78 @@
+package messages
+
+import (
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPAOTPChallenge_MarshalRoundTrip(t *testing.T) {
+	t.Parallel()
+	flags := types.NewKrbFlags()
+	types.SetFlag(&flags, OTPFlagCollectPIN)
+	c := PAOTPChallenge{
+		Nonce:   []byte("kdc-nonce"),
+		Service: "Token service",
+		TokenInfo: []OTPTokenInfo{{
+			Flags:   flags,
+			Vendor:  "Example",
+			Length:  6,
+			TokenID: []byte("token-1"),
+		}},
+	}
+	pa, err := c.PAData()
+	if err != nil {
+		t.Fatalf("error marshaling PA-OTP-CHALLENGE: %v", err)
+	}
+	assert.Equal(t, patype.PA_OTP_CHALLENGE, pa.PADataType, "pre-authentication type not as expected")
+	var u PAOTPChallenge
+	err = u.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-OTP-CHALLENGE: %v", err)
+	}
+	assert.Equal(t, c.Nonce, u.Nonce, "nonce not as expected")
+	assert.Equal(t, c.Service, u.Service, "service not as expected")
+	if assert.Len(t, u.TokenInfo, 1, "token info not as expected") {
+		assert.True(t, types.IsFlagSet(&u.TokenInfo[0].Flags, OTPFlagCollectPIN), "collect PIN flag not set")
+		assert.Equal(t, "Example", u.TokenInfo[0].Vendor, "vendor not as expected")
+		assert.Equal(t, int32(6), u.TokenInfo[0].Length, "length not as expected")
+		assert.Equal(t, []byte("token-1"), u.TokenInfo[0].TokenID, "token ID not as expected")
+	}
+}
+
+func TestPAOTPRequest(t *testing.T) {
+	t.Parallel()
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	armorKey, _ := types.GenerateEncryptionKey(et)
+	r, err := NewPAOTPRequest([]byte("kdc-nonce"), armorKey, []byte("123456"))
+	if err != nil {
+		t.Fatalf("error creating PA-OTP-REQUEST: %v", err)
+	}
+	r.PIN = "1234"
+	r.TokenID = []byte("token-1")
+	pa, err := r.PAData()
+	if err != nil {
+		t.Fatalf("error marshaling PA-OTP-REQUEST: %v", err)
+	}
+	assert.Equal(t, patype.PA_OTP_REQUEST, pa.PADataType, "pre-authentication type not as expected")
+	var u PAOTPRequest
+	err = u.Unmarshal(pa.PADataValue)
+	if err != nil {
+		t.Fatalf("error unmarshaling PA-OTP-REQUEST: %v", err)
+	}
+	assert.Equal(t, []byte("123456"), u.OTPValue, "OTP value not as expected")
+	assert.Equal(t, "1234", u.PIN, "PIN not as expected")
+	assert.Equal(t, []byte("token-1"), u.TokenID, "token ID not as expected")
+	nonce, err := u.DecryptNonce(armorKey)
+	if err != nil {
+		t.Fatalf("error decrypting PA-OTP-ENC-REQUEST: %v", err)
+	}
+	assert.Equal(t, []byte("kdc-nonce"), nonce, "nonce not as expected")
+	wrongKey, _ := types.GenerateEncryptionKey(et)
+	_, err = u.DecryptNonce(wrongKey)
+	assert.Error(t, err, "decrypting with the wrong key should fail")
+}
@@ -1,11 +1,15 @@
 package messages
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/Osirium/gokrb5/v8/asn1tools"
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/credentials"
 	"github.com/Osirium/gokrb5/v8/crypto"
 	"github.com/Osirium/gokrb5/v8/iana"
 	"github.com/Osirium/gokrb5/v8/iana/adtype"
@@ -13,6 +17,7 @@ import (
 	"github.com/Osirium/gokrb5/v8/iana/errorcode"
 	"github.com/Osirium/gokrb5/v8/iana/flags"
 	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/iana/trtype"
 	"github.com/Osirium/gokrb5/v8/keytab"
 	"github.com/Osirium/gokrb5/v8/krberror"
 	"github.com/Osirium/gokrb5/v8/pac"
@@ -53,8 +58,127 @@ type TransitedEncoding struct {
 	Contents []byte `asn1:"explicit,tag:1"`
 }
 
+// NewTransitedEncoding returns the DOMAIN-X500-COMPRESS transited encoding of the realms traversed, in the order
+// traversed, excluding the client's realm and the realm issuing the ticket. Each realm that extends the realm before
+// it is compressed.
+// https://tools.ietf.org/html/rfc4120#section-3.3.3.2
+func NewTransitedEncoding(realms []string) TransitedEncoding {
+	esc := strings.NewReplacer(`\`, `\\`, ",", `\,`)
+	f := make([]string, len(realms))
+	for i, r := range realms {
+		e := r
+		if i > 0 {
+			prev := realms[i-1]
+			switch {
+			case !strings.HasPrefix(r, "/") && strings.HasSuffix(r, "."+prev):
+				// Domain style names are written without the previous realm that follows their trailing dot
+				e = r[:len(r)-len(prev)]
+			case strings.HasPrefix(r, prev+"/") && strings.HasPrefix(prev, "/"):
+				// X.500 style names are written without the previous realm they begin with
+				e = r[len(prev):]
+			case strings.HasPrefix(r, "/"):
+				// A leading space prevents an X.500 style name being read as extending the previous realm
+				e = " " + r
+			}
+		}
+		f[i] = esc.Replace(e)
+	}
+	return TransitedEncoding{
+		TRType:   trtype.DOMAIN_X500_COMPRESS,
+		Contents: []byte(strings.Join(f, ",")),
+	}
+}
+
+// Realms returns the realms traversed, in the order traversed, that the transited encoding records between the
+// client's realm and the realm that issued the ticket. Empty entries, which stand for all the realms between their
+// neighbours in the realm hierarchy, are expanded.
+func (t TransitedEncoding) Realms(crealm, srealm string) ([]string, error) {
+	if t.TRType != trtype.DOMAIN_X500_COMPRESS {
+		return nil, fmt.Errorf("transited encoding type %d not supported", t.TRType)
+	}
+	if len(t.Contents) == 0 {
+		return nil, nil
+	}
+	// Split the names on the commas not escaped with a backslash
+	var names []string
+	var b strings.Builder
+	var escaped bool
+	for _, c := range string(t.Contents) {
+		switch {
+		case escaped:
+			b.WriteRune(c)
+			escaped = false
+		case c == '\\':
+			escaped = true
+		case c == ',':
+			names = append(names, b.String())
+			b.Reset()
+		default:
+			b.WriteRune(c)
+		}
+	}
+	if escaped {
+		return nil, errors.New("transited encoding ends with an escape character")
+	}
+	names = append(names, b.String())
+
+	// Decompress the names relative to the realm named before them
+	realms := make([]string, len(names))
+	var prev string
+	for i, n := range names {
+		switch {
+		case n == "":
+			continue
+		case strings.HasPrefix(n, " "):
+			n = n[1:]
+		case strings.HasSuffix(n, ".") && prev != "":
+			n = n + prev
+		case strings.HasPrefix(n, "/") && strings.HasPrefix(prev, "/"):
+			n = prev + n
+		}
+		realms[i] = n
+		prev = n
+	}
+
+	// Expand the empty names with the realm hierarchy between their neighbours
+	var r []string
+	for i, n := range realms {
+		if n != "" {
+			r = append(r, n)
+			continue
+		}
+		from := crealm
+		if len(r) > 0 {
+			from = r[len(r)-1]
+		}
+		to := srealm
+		for _, next := range realms[i+1:] {
+			if next != "" {
+				to = next
+				break
+			}
+		}
+		if p := config.HierarchicalPath(from, to); len(p) > 0 {
+			r = append(r, p[:len(p)-1]...)
+		}
+	}
+	return r, nil
+}
+
 // NewTicket creates a new Ticket instance.
 func NewTicket(cname types.PrincipalName, crealm string, sname types.PrincipalName, srealm string, flags asn1.BitString, sktab *keytab.Keytab, eTypeID int32, kvno int, authTime, startTime, endTime, renewTill time.Time) (Ticket, types.EncryptionKey, error) {
+	return newTicket(cname, crealm, sname, srealm, flags, sktab, eTypeID, kvno, authTime, startTime, endTime, renewTill, nil, types.EncryptionKey{})
+}
+
+// NewTicketWithPAC creates a new Ticket instance as NewTicket does, carrying the PAC built by the builder provided.
+// The PAC's server signature is made with the service's key from the keytab and its KDC and ticket signatures with
+// kdcKey, which stands for the key of the KDC's krbtgt account. It is intended for the tests of services' authorization
+// logic.
+func NewTicketWithPAC(cname types.PrincipalName, crealm string, sname types.PrincipalName, srealm string, flags asn1.BitString, sktab *keytab.Keytab, eTypeID int32, kvno int, authTime, startTime, endTime, renewTill time.Time, pb *pac.Builder, kdcKey types.EncryptionKey) (Ticket, types.EncryptionKey, error) {
+	return newTicket(cname, crealm, sname, srealm, flags, sktab, eTypeID, kvno, authTime, startTime, endTime, renewTill, pb, kdcKey)
+}
+
+func newTicket(cname types.PrincipalName, crealm string, sname types.PrincipalName, srealm string, flags asn1.BitString, sktab *keytab.Keytab, eTypeID int32, kvno int, authTime, startTime, endTime, renewTill time.Time, pb *pac.Builder, kdcKey types.EncryptionKey) (Ticket, types.EncryptionKey, error) {
 	etype, err := crypto.GetEtype(eTypeID)
 	if err != nil {
 		return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for new ticket")
@@ -63,6 +187,10 @@ func NewTicket(cname types.PrincipalName, crealm string, sname types.PrincipalNa
 	if err != nil {
 		return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error generating session key")
 	}
+	skey, _, err := sktab.GetKey(sname, srealm, kvno, eTypeID)
+	if err != nil {
+		return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting encryption key for new ticket")
+	}
 
 	etp := EncTicketPart{
 		Flags:     flags,
@@ -75,15 +203,17 @@ func NewTicket(cname types.PrincipalName, crealm string, sname types.PrincipalNa
 		EndTime:   endTime,
 		RenewTill: renewTill,
 	}
+	if pb != nil {
+		etp.AuthorizationData, err = newPACAuthorizationData(etp, pb, skey, kdcKey)
+		if err != nil {
+			return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error creating PAC for new ticket")
+		}
+	}
 	b, err := asn1.Marshal(etp)
 	if err != nil {
 		return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error marshalling ticket encpart")
 	}
 	b = asn1tools.AddASNAppTag(b, asnAppTag.EncTicketPart)
-	skey, _, err := sktab.GetEncryptionKey(sname, srealm, kvno, eTypeID)
-	if err != nil {
-		return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting encryption key for new ticket")
-	}
 	ed, err := crypto.GetEncryptedData(b, skey, keyusage.KDC_REP_TICKET, kvno)
 	if err != nil {
 		return Ticket{}, types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error encrypting ticket encpart")
@@ -97,6 +227,25 @@ func NewTicket(cname types.PrincipalName, crealm string, sname types.PrincipalNa
 	return tkt, sessionKey, nil
 }
 
+// newPACAuthorizationData returns the authorization data carrying the PAC built for the EncTicketPart. The ticket
+// signature is made over the EncTicketPart with the PAC replaced by a single zero byte, before the PAC is built.
+func newPACAuthorizationData(etp EncTicketPart, pb *pac.Builder, skey, kdcKey types.EncryptionKey) (types.AuthorizationData, error) {
+	ad, err := pac.NewAuthorizationData([]byte{0})
+	if err != nil {
+		return nil, err
+	}
+	etp.AuthorizationData = ad
+	b, err := asn1.Marshal(etp)
+	if err != nil {
+		return nil, err
+	}
+	p, err := pb.BuildWithTicketChecksum(skey, kdcKey, asn1tools.AddASNAppTag(b, asnAppTag.EncTicketPart))
+	if err != nil {
+		return nil, err
+	}
+	return pac.NewAuthorizationData(p)
+}
+
 // Unmarshal bytes b into a Ticket struct.
 func (t *Ticket) Unmarshal(b []byte) error {
 	_, err := asn1.UnmarshalWithParams(b, t, fmt.Sprintf("application,explicit,tag:%d", asnAppTag.Ticket))
@@ -119,6 +268,28 @@ func (t *EncTicketPart) Unmarshal(b []byte) error {
 	return err
 }
 
+// CCacheTicket returns the Ticket held in a credential cache entry.
+func CCacheTicket(cred *credentials.Credential) (Ticket, error) {
+	t, err := unmarshalTicket(cred.Ticket)
+	if err != nil {
+		return t, fmt.Errorf("credential cache entry ticket bytes are not valid: %v", err)
+	}
+	return t, nil
+}
+
+// CCacheSecondTicket returns the second Ticket held in a credential cache entry, as used in user-to-user authentication.
+// The bool returned is false if the entry has no second ticket.
+func CCacheSecondTicket(cred *credentials.Credential) (Ticket, bool, error) {
+	if len(cred.SecondTicket) == 0 {
+		return Ticket{}, false, nil
+	}
+	t, err := unmarshalTicket(cred.SecondTicket)
+	if err != nil {
+		return t, false, fmt.Errorf("credential cache entry second ticket bytes are not valid: %v", err)
+	}
+	return t, true, nil
+}
+
 // unmarshalTicket returns a ticket from the bytes provided.
 func unmarshalTicket(b []byte) (t Ticket, err error) {
 	err = t.Unmarshal(b)
@@ -186,17 +357,39 @@ func MarshalTicketSequence(tkts []Ticket) (asn1.RawValue, error) {
 // DecryptEncPart decrypts the encrypted part of the ticket.
 // The sname argument can be used to specify which service principal's key should be used to decrypt the ticket.
 // If nil is passed as the sname then the service principal specified within the ticket it used.
+// The key used is the keytab entry matching the kvno and etype of the ticket's encrypted part.
 func (t *Ticket) DecryptEncPart(keytab *keytab.Keytab, sname *types.PrincipalName) error {
 	if sname == nil {
 		sname = &t.SName
 	}
-	key, _, err := keytab.GetEncryptionKey(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
+	key, _, err := keytab.GetKey(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
 	if err != nil {
 		return NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("Could not get key from keytab: %v", err))
 	}
 	return t.Decrypt(key)
 }
 
+// FindKeytabPrincipal returns the principal in the keytab whose key decrypts the ticket's encrypted part.
+// The ticket's service principal is returned if the keytab holds a key for it, otherwise the key of each principal in
+// the keytab for the ticket's realm is tried. This allows a service to accept tickets for any of the names it is known
+// by, such as HTTP/ and host/ principals or several DNS aliases, without naming the principal to use.
+func (t *Ticket) FindKeytabPrincipal(kt *keytab.Keytab) (*types.PrincipalName, error) {
+	if _, _, err := kt.GetKey(t.SName, t.Realm, t.EncPart.KVNO, t.EncPart.EType); err == nil {
+		return &t.SName, nil
+	}
+	for _, pn := range kt.Principals(t.Realm) {
+		key, _, err := kt.GetKey(pn, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
+		if err != nil {
+			continue
+		}
+		if _, err := crypto.DecryptEncPart(t.EncPart, key, keyusage.KDC_REP_TICKET); err == nil {
+			pn := pn
+			return &pn, nil
+		}
+	}
+	return nil, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, "no key in keytab decrypts the ticket")
+}
+
 // Decrypt decrypts the encrypted part of the ticket using the key provided.
 func (t *Ticket) Decrypt(key types.EncryptionKey) error {
 	b, err := crypto.DecryptEncPart(t.EncPart, key, keyusage.KDC_REP_TICKET)
@@ -213,7 +406,9 @@ func (t *Ticket) Decrypt(key types.EncryptionKey) error {
 }
 
 // GetPACType returns a Microsoft PAC that has been extracted from the ticket and processed.
-func (t *Ticket) GetPACType(keytab *keytab.Keytab, sname *types.PrincipalName, l *log.Logger) (bool, pac.PACType, error) {
+// The PAC's server signature is verified with the service's key. Its KDC and ticket signatures are verified if a
+// verifier is provided with the PACKDCVerifier setting.
+func (t *Ticket) GetPACType(keytab *keytab.Keytab, sname *types.PrincipalName, l *log.Logger, settings ...func(*VerifySettings)) (bool, pac.PACType, error) {
 	var isPAC bool
 	for _, ad := range t.DecryptedEncPart.AuthorizationData {
 		if ad.ADType == adtype.ADIfRelevant {
@@ -233,11 +428,15 @@ func (t *Ticket) GetPACType(keytab *keytab.Keytab, sname *types.PrincipalName, l
 				if sname == nil {
 					sname = &t.SName
 				}
-				key, _, err := keytab.GetEncryptionKey(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
+				key, _, err := keytab.GetKey(*sname, t.Realm, t.EncPart.KVNO, t.EncPart.EType)
 				if err != nil {
 					return isPAC, p, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_NOKEY, fmt.Sprintf("Could not get key from keytab: %v", err))
 				}
 				err = p.ProcessPACInfoBuffers(key, l)
+				if err != nil {
+					return isPAC, p, err
+				}
+				err = t.verifyPACKDCChecksums(&p, settings)
 				return isPAC, p, err
 			}
 		}
@@ -245,17 +444,92 @@ func (t *Ticket) GetPACType(keytab *keytab.Keytab, sname *types.PrincipalName, l
 	return isPAC, pac.PACType{}, nil
 }
 
+// verifyPACKDCChecksums verifies the signatures of the ticket's PAC made with the KDC's key, as the settings require.
+func (t *Ticket) verifyPACKDCChecksums(p *pac.PACType, settings []func(*VerifySettings)) error {
+	s := new(VerifySettings)
+	for _, set := range settings {
+		set(s)
+	}
+	if s.requirePACTicketChecksum && p.TicketChecksum == nil {
+		return NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_MODIFIED, "PAC does not have a ticket checksum")
+	}
+	if s.pacKDCVerifier == nil {
+		return nil
+	}
+	if err := p.VerifyKDCChecksum(s.pacKDCVerifier); err != nil {
+		return NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_MODIFIED, err.Error())
+	}
+	if p.TicketChecksum == nil {
+		return nil
+	}
+	b, err := t.pacTicketChecksumData()
+	if err != nil {
+		return fmt.Errorf("error encoding ticket for PAC ticket checksum: %v", err)
+	}
+	if err := p.VerifyTicketChecksum(s.pacKDCVerifier, b); err != nil {
+		return NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_MODIFIED, err.Error())
+	}
+	return nil
+}
+
+// pacTicketChecksumData returns the data the ticket signature of the ticket's PAC is made over: the encoded
+// EncTicketPart with the PAC replaced by a single zero byte.
+func (t *Ticket) pacTicketChecksumData() ([]byte, error) {
+	etp := t.DecryptedEncPart
+	etp.AuthorizationData = make(types.AuthorizationData, len(t.DecryptedEncPart.AuthorizationData))
+	copy(etp.AuthorizationData, t.DecryptedEncPart.AuthorizationData)
+	for i, ad := range etp.AuthorizationData {
+		if ad.ADType != adtype.ADIfRelevant {
+			continue
+		}
+		var ad2 types.AuthorizationData
+		if err := ad2.Unmarshal(ad.ADData); err != nil || len(ad2) < 1 || ad2[0].ADType != adtype.ADWin2KPAC {
+			continue
+		}
+		ad2[0].ADData = []byte{0}
+		b, err := asn1.Marshal(ad2)
+		if err != nil {
+			return nil, err
+		}
+		etp.AuthorizationData[i].ADData = b
+		break
+	}
+	b, err := asn1.Marshal(etp)
+	if err != nil {
+		return nil, err
+	}
+	return asn1tools.AddASNAppTag(b, asnAppTag.EncTicketPart), nil
+}
+
 // Valid checks it the ticket is currently valid. Max duration passed endtime passed in as argument.
 func (t *Ticket) Valid(d time.Duration) (bool, error) {
-	// Check for future tickets or invalid tickets
-	time := time.Now().UTC()
-	if t.DecryptedEncPart.StartTime.Sub(time) > d || types.IsFlagSet(&t.DecryptedEncPart.Flags, flags.Invalid) {
-		return false, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_TKT_NYV, "service ticket provided is not yet valid")
+	return t.ValidAt(time.Now().UTC(), d)
+}
+
+// ValidAt checks if the ticket is valid at the time provided, allowing for the maximum clock skew provided beyond its
+// start and end times. The ticket's start time is its auth time if it has none. As Kerberos times are generalized
+// times, not 32 bit timestamps, times beyond 2038 are compared as any other.
+func (t *Ticket) ValidAt(now time.Time, d time.Duration) (bool, error) {
+	if types.IsFlagSet(&t.DecryptedEncPart.Flags, flags.Invalid) {
+		return false, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_TKT_NYV, "service ticket provided is flagged invalid")
+	}
+	// Check for future tickets
+	st := t.DecryptedEncPart.StartTime
+	if st.IsZero() {
+		st = t.DecryptedEncPart.AuthTime
+	}
+	if st.After(now.Add(d)) {
+		return false, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_TKT_NYV,
+			fmt.Sprintf("service ticket provided is not valid until %s, %v after the service's time of %s, beyond the maximum clock skew of %v",
+				st.UTC().Format(time.RFC3339), st.Sub(now), now.UTC().Format(time.RFC3339), d))
 	}
 
 	// Check for expired ticket
-	if time.Sub(t.DecryptedEncPart.EndTime) > d {
-		return false, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_TKT_EXPIRED, "service ticket provided has expired")
+	et := t.DecryptedEncPart.EndTime
+	if now.After(et.Add(d)) {
+		return false, NewKRBError(t.SName, t.Realm, errorcode.KRB_AP_ERR_TKT_EXPIRED,
+			fmt.Sprintf("service ticket provided expired at %s, %v before the service's time of %s, beyond the maximum clock skew of %v",
+				et.UTC().Format(time.RFC3339), now.Sub(et), now.UTC().Format(time.RFC3339), d))
 	}
 
 	return true, nil
@@ -3,17 +3,22 @@ package messages
 import (
 	"bytes"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"testing"
 	"time"
 
+	"github.com/Osirium/gokrb5/v8/credentials"
 	"github.com/Osirium/gokrb5/v8/iana"
 	"github.com/Osirium/gokrb5/v8/iana/addrtype"
 	"github.com/Osirium/gokrb5/v8/iana/adtype"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
 	"github.com/Osirium/gokrb5/v8/iana/nametype"
 	"github.com/Osirium/gokrb5/v8/iana/trtype"
 	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/pac"
 	"github.com/Osirium/gokrb5/v8/test/testdata"
 	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
@@ -41,6 +46,46 @@ func TestUnmarshalTicket(t *testing.T) {
 	assert.Equal(t, []byte(testdata.TEST_CIPHERTEXT), a.EncPart.Cipher, "Cipher of Ticket EncPart not as expected")
 }
 
+func TestCCacheTicket(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.CCACHE_TEST)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	c := new(credentials.CCache)
+	err = c.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error parsing cache: %v", err)
+	}
+	cred := c.Credentials[2]
+	tkt, err := CCacheTicket(cred)
+	if err != nil {
+		t.Fatalf("Error decoding ticket: %v", err)
+	}
+	assert.Equal(t, iana.PVNO, tkt.TktVNO, "Ticket version number not as expected")
+	assert.Equal(t, "TEST.GOKRB5", tkt.Realm, "Realm not as expected")
+	assert.Equal(t, []string{"HTTP", "host.test.gokrb5"}, tkt.SName.NameString, "SName name strings not as expected")
+
+	_, ok, err := CCacheSecondTicket(cred)
+	if err != nil {
+		t.Fatalf("Error decoding second ticket: %v", err)
+	}
+	assert.False(t, ok, "Entry should not have a second ticket")
+
+	u2u := *cred
+	u2u.SecondTicket = cred.Ticket
+	st, ok, err := CCacheSecondTicket(&u2u)
+	if err != nil {
+		t.Fatalf("Error decoding second ticket: %v", err)
+	}
+	assert.True(t, ok, "Entry should have a second ticket")
+	assert.Equal(t, tkt, st, "Second ticket not as expected")
+
+	u2u.Ticket = []byte{0x01, 0x02}
+	_, err = CCacheTicket(&u2u)
+	assert.Error(t, err, "Expected error for invalid ticket bytes")
+}
+
 func TestUnmarshalEncTicketPart(t *testing.T) {
 	t.Parallel()
 	var a EncTicketPart
@@ -164,3 +209,178 @@ func TestAuthorizationData_GetPACType_GOKRB5TestData(t *testing.T) {
 	assert.NotNil(t, pac.KDCChecksum, "PAC KDC Checksum info is nil")
 	assert.NotNil(t, pac.ServerChecksum, "PAC Server checksum info is nil")
 }
+
+func TestTicket_GetPACType_KDCChecksums(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_AuthorizationData_GOKRB5)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	var a types.AuthorizationData
+	err = a.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	tkt := Ticket{
+		Realm: "TEST.GOKRB5",
+		EncPart: types.EncryptedData{
+			EType: 18,
+			KVNO:  2,
+		},
+		DecryptedEncPart: EncTicketPart{
+			AuthTime:          time.Date(2021, 11, 9, 10, 0, 0, 0, time.UTC),
+			EndTime:           time.Date(2021, 11, 9, 20, 0, 0, 0, time.UTC),
+			AuthorizationData: a,
+		},
+	}
+	b, _ = hex.DecodeString(testdata.KEYTAB_SYSHTTP_TEST_GOKRB5)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	sname := types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"sysHTTP"}}
+	l := log.New(bytes.NewBufferString(""), "", 0)
+
+	// The reference PAC predates ticket signatures
+	_, _, err = tkt.GetPACType(kt, &sname, l, RequirePACTicketChecksum(true))
+	assert.Error(t, err, "PAC without a ticket checksum should be rejected when required")
+
+	var data []byte
+	_, p, err := tkt.GetPACType(kt, &sname, l, PACKDCVerifier(pac.KDCChecksumVerifierFunc(func(d []byte, _ pac.SignatureData) error {
+		data = d
+		return nil
+	})))
+	assert.NoError(t, err, "PAC should be accepted by the KDC checksum verifier")
+	assert.Equal(t, p.ServerChecksum.Signature, data, "KDC checksum should be verified over the server signature")
+
+	_, _, err = tkt.GetPACType(kt, &sname, l, PACKDCVerifier(pac.KDCChecksumVerifierFunc(func(_ []byte, _ pac.SignatureData) error {
+		return errors.New("KDC checksum not valid")
+	})))
+	if assert.Error(t, err, "PAC should be rejected by the KDC checksum verifier") {
+		assert.Contains(t, err.Error(), "KDC checksum not valid", "error not as expected")
+	}
+
+	// The ticket checksum is made over the ticket with the PAC replaced by a zero byte
+	b, err = tkt.pacTicketChecksumData()
+	if err != nil {
+		t.Fatalf("error encoding ticket for the ticket checksum: %v", err)
+	}
+	var etp EncTicketPart
+	err = etp.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling ticket checksum data: %v", err)
+	}
+	var ad2 types.AuthorizationData
+	err = ad2.Unmarshal(etp.AuthorizationData[0].ADData)
+	if err != nil {
+		t.Fatalf("error unmarshaling AD-IF-RELEVANT: %v", err)
+	}
+	assert.Equal(t, int32(adtype.ADWin2KPAC), ad2[0].ADType, "AD type not as expected")
+	assert.Equal(t, []byte{0}, ad2[0].ADData, "PAC not replaced by a zero byte")
+	assert.NotEqual(t, []byte{0}, tkt.DecryptedEncPart.AuthorizationData[0].ADData, "ticket's PAC should not be modified")
+}
+
+func TestTicket_DecryptEncPart_RotatedKeytab(t *testing.T) {
+	t.Parallel()
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_HST, "HTTP/host.test.gokrb5")
+	cname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1")
+	realm := "TEST.GOKRB5"
+	kt := keytab.New()
+	// The entry for the previous kvno is listed first and has the later timestamp
+	kt.AddEntry(sname.PrincipalNameString(), realm, "newpassword", time.Unix(100, 0), 3, 18)
+	kt.AddEntry(sname.PrincipalNameString(), realm, "oldpassword", time.Unix(200, 0), 2, 18)
+	now := time.Now().UTC()
+	for _, kvno := range []int{2, 3} {
+		tkt, _, err := NewTicket(cname, realm, sname, realm, types.NewKrbFlags(), kt, 18, kvno, now, now, now.Add(time.Hour), now.Add(time.Hour))
+		if err != nil {
+			t.Fatalf("error creating ticket with kvno %d: %v", kvno, err)
+		}
+		err = tkt.DecryptEncPart(kt, nil)
+		if err != nil {
+			t.Errorf("error decrypting ticket with kvno %d: %v", kvno, err)
+		}
+		assert.Equal(t, cname, tkt.DecryptedEncPart.CName, "CName of ticket with kvno %d not as expected", kvno)
+	}
+}
+
+func TestTransitedEncoding(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		realms   []string
+		contents string
+	}{
+		{nil, ""},
+		{[]string{"EDU", "MIT.EDU", "ATHENA.MIT.EDU", "WASHINGTON.EDU", "CS.WASHINGTON.EDU"}, "EDU,MIT.,ATHENA.,WASHINGTON.EDU,CS."},
+		{[]string{"/COM", "/COM/HP", "/COM/HP/APOLLO", "/COM/DEC"}, "/COM,/HP,/APOLLO, /COM/DEC"},
+		{[]string{"ODD,REALM", `BACK\SLASH`}, `ODD\,REALM,BACK\\SLASH`},
+	}
+	for _, test := range tests {
+		te := NewTransitedEncoding(test.realms)
+		assert.Equal(t, trtype.DOMAIN_X500_COMPRESS, te.TRType, "transited encoding type not as expected")
+		assert.Equal(t, test.contents, string(te.Contents), "transited encoding not as expected")
+		r, err := te.Realms("CLIENT.REALM", "SERVER.REALM")
+		if err != nil {
+			t.Fatalf("error decoding transited encoding %q: %v", test.contents, err)
+		}
+		assert.Equal(t, test.realms, r, "realms decoded not as expected")
+	}
+
+	// Empty entries stand for the realms between their neighbours in the realm hierarchy
+	te := TransitedEncoding{TRType: trtype.DOMAIN_X500_COMPRESS, Contents: []byte(",EXAMPLE.COM,")}
+	r, err := te.Realms("A.ENG.EXAMPLE.COM", "SALES.EXAMPLE.COM")
+	if err != nil {
+		t.Fatalf("error decoding transited encoding: %v", err)
+	}
+	assert.Equal(t, []string{"ENG.EXAMPLE.COM", "EXAMPLE.COM"}, r, "realms decoded not as expected")
+
+	_, err = TransitedEncoding{TRType: 0, Contents: []byte("EDU")}.Realms("CLIENT.REALM", "SERVER.REALM")
+	assert.Error(t, err, "unsupported transited encoding type should not be decoded")
+}
+
+func TestTicket_ValidAt(t *testing.T) {
+	t.Parallel()
+	now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	skew := 5 * time.Minute
+	var tests = []struct {
+		name            string
+		auth, st, et    time.Time
+		invalid         bool
+		sentinel        error
+		expectedMessage string
+	}{
+		{name: "valid", auth: now, st: now.Add(-time.Hour), et: now.Add(time.Hour)},
+		{name: "start within skew", auth: now, st: now.Add(4 * time.Minute), et: now.Add(time.Hour)},
+		{name: "end within skew", auth: now, st: now.Add(-time.Hour), et: now.Add(-4 * time.Minute)},
+		{name: "end beyond 2038", auth: now, st: now, et: time.Date(2040, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "end at the maximum generalized time", auth: now, st: now, et: time.Date(9999, 12, 31, 23, 59, 59, 0, time.UTC)},
+		{name: "no start time", auth: now.Add(-time.Hour), et: now.Add(time.Hour)},
+		{name: "not yet valid", auth: now, st: now.Add(10 * time.Minute), et: now.Add(time.Hour),
+			sentinel: krberror.ErrTicketNotYetValid, expectedMessage: "not valid until 2020-06-01T12:10:00Z, 10m0s after"},
+		{name: "auth time not yet valid", auth: now.Add(10 * time.Minute), et: now.Add(time.Hour),
+			sentinel: krberror.ErrTicketNotYetValid, expectedMessage: "not valid until 2020-06-01T12:10:00Z"},
+		{name: "expired", auth: now, st: now.Add(-time.Hour), et: now.Add(-10 * time.Minute),
+			sentinel: krberror.ErrTicketExpired, expectedMessage: "expired at 2020-06-01T11:50:00Z, 10m0s before"},
+		{name: "flagged invalid", auth: now, st: now, et: now.Add(time.Hour), invalid: true,
+			sentinel: krberror.ErrTicketNotYetValid, expectedMessage: "flagged invalid"},
+	}
+	for _, test := range tests {
+		tkt := Ticket{
+			Realm: "TEST.GOKRB5",
+			SName: types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5"),
+		}
+		tkt.DecryptedEncPart.Flags = types.NewKrbFlags()
+		if test.invalid {
+			types.SetFlag(&tkt.DecryptedEncPart.Flags, flags.Invalid)
+		}
+		tkt.DecryptedEncPart.AuthTime = test.auth
+		tkt.DecryptedEncPart.StartTime = test.st
+		tkt.DecryptedEncPart.EndTime = test.et
+		ok, err := tkt.ValidAt(now, skew)
+		if test.sentinel == nil {
+			assert.True(t, ok, "%s: ticket not valid", test.name)
+			assert.NoError(t, err, "%s: error not expected", test.name)
+			continue
+		}
+		assert.False(t, ok, "%s: ticket valid", test.name)
+		assert.True(t, errors.Is(err, test.sentinel), "%s: error not as expected: %v", test.name, err)
+		assert.Contains(t, err.Error(), test.expectedMessage, "%s: error message not as expected", test.name)
+	}
+}
@@ -0,0 +1,55 @@
+// Package metrics provides the interface through which clients and services report measurements of their Kerberos
+// exchanges, so that operators can monitor the health of Kerberos with the metrics system of their choice, such as
+// Prometheus counters and histograms.
+package metrics
+
+import "time"
+
+// Recorder receives the measurements of clients and services. Its methods are called synchronously as exchanges
+// progress, and concurrently by exchanges in different goroutines, so they should return quickly.
+//
+// Implementations should embed Nop so that they continue to compile if methods are added to the interface:
+//
+//	type promRecorder struct {
+//		metrics.Nop
+//		kdcLatency *prometheus.HistogramVec
+//	}
+//
+//	func (r promRecorder) KDCExchange(realm, kdc, transport string, d time.Duration, err error) {
+//		r.kdcLatency.WithLabelValues(realm, kdc, transport, strconv.FormatBool(err == nil)).Observe(d.Seconds())
+//	}
+type Recorder interface {
+	// KDCExchange records the round trip time of a message sent to a KDC over the transport: udp, tcp or https.
+	// The error is nil if the KDC replied, including with a KRB_ERROR, and otherwise why it did not.
+	KDCExchange(realm, kdc, transport string, d time.Duration, err error)
+	// KDCError records a KRB_ERROR replied by a KDC of the realm, by its error code. These include errors such as
+	// KDC_ERR_PREAUTH_REQUIRED that are part of an exchange that goes on to succeed.
+	KDCError(realm string, code int32)
+	// TicketCache records a request for a service ticket, and whether it was satisfied from the client's cache.
+	TicketCache(hit bool)
+	// Renewal records the renewal of a ticket for the service in the realm, which for the renewal of a TGT is the
+	// krbtgt service. The error is nil if the ticket was renewed.
+	Renewal(realm, service string, err error)
+	// APReq records an AP_REQ verified by a service, and the error code it was rejected with, or zero if accepted or
+	// rejected for a reason other than a KRB_ERROR.
+	APReq(realm string, accepted bool, code int32)
+}
+
+// Nop is a Recorder that discards its measurements. It is used when no Recorder is configured and can be embedded in
+// implementations of Recorder that only record some measurements.
+type Nop struct{}
+
+// KDCExchange discards the measurement.
+func (Nop) KDCExchange(realm, kdc, transport string, d time.Duration, err error) {}
+
+// KDCError discards the measurement.
+func (Nop) KDCError(realm string, code int32) {}
+
+// TicketCache discards the measurement.
+func (Nop) TicketCache(hit bool) {}
+
+// Renewal discards the measurement.
+func (Nop) Renewal(realm, service string, err error) {}
+
+// APReq discards the measurement.
+func (Nop) APReq(realm string, accepted bool, code int32) {}
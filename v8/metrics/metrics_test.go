@@ -0,0 +1,18 @@
+package metrics
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNop(t *testing.T) {
+	t.Parallel()
+	var r Recorder = Nop{}
+	// The measurements are discarded without effect
+	r.KDCExchange("TEST.GOKRB5", "10.80.88.88:88", "udp", time.Millisecond, errors.New("no reply"))
+	r.KDCError("TEST.GOKRB5", 25)
+	r.TicketCache(true)
+	r.Renewal("TEST.GOKRB5", "krbtgt/TEST.GOKRB5", nil)
+	r.APReq("TEST.GOKRB5", true, 0)
+}
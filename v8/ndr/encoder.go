@@ -0,0 +1,492 @@
+package ndr
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/jcmturner/rpc/v2/mstypes"
+)
+
+const (
+	// commonHeader is the common header of type serialization version 1: version 1, little endian, ASCII, IEEE
+	// floating point, header length 8 and filler.
+	commonHeader = "\x01\x10\x08\x00\xcc\xcc\xcc\xcc"
+	// firstReferentID is the referent ID of the first pointer marshaled. Referent IDs increment by 4, as Microsoft's
+	// NDR engine assigns them.
+	firstReferentID uint32 = 0x00020000
+	// tagSize is the key of the tag value holding the size of a RawBytes field.
+	tagSize = "size"
+)
+
+var rpcUnicodeStringType = reflect.TypeOf(mstypes.RPCUnicodeString{})
+
+// Encoder marshals Go structs to an NDR byte stream.
+type Encoder struct {
+	w         io.Writer
+	buf       bytes.Buffer        // the serialized top-level type, written to w with its headers once complete
+	referent  uint32              // the referent ID of the next pointer
+	referents map[valueKey]uint32 // the referent IDs assigned to the pointers to marshal
+	current   []string            // keeps track of the current field being marshaled
+}
+
+// valueKey identifies an addressable value, the type distinguishing a struct from its first field.
+type valueKey struct {
+	addr uintptr
+	t    reflect.Type
+}
+
+// deferredPtr is the referent of a pointer, marshaled after the structure holding the pointer.
+type deferredPtr struct {
+	v   reflect.Value
+	tag tags
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+// Encode writes the NDR encoding of the struct pointed to by s.
+func (enc *Encoder) Encode(s interface{}) error {
+	v := reflect.ValueOf(s)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("could not encode: a pointer to a struct must be provided")
+	}
+	enc.buf.Reset()
+	enc.current = nil
+	enc.referent = firstReferentID
+	enc.referents = make(map[valueKey]uint32)
+	// The top-level type is referenced by a unique pointer
+	enc.writeUint32(enc.nextReferent())
+	if err := enc.assignReferents(v.Elem(), tags{}); err != nil {
+		return fmt.Errorf("could not encode: %v", err)
+	}
+	if err := enc.process(v.Elem(), tags{}); err != nil {
+		return fmt.Errorf("could not encode: %v", err)
+	}
+	enc.align(8)
+
+	var h [16]byte
+	copy(h[:], commonHeader)
+	// Private header: the length of the serialized type including its padding, and filler
+	binary.LittleEndian.PutUint32(h[8:], uint32(enc.buf.Len()))
+	if _, err := enc.w.Write(h[:]); err != nil {
+		return err
+	}
+	_, err := enc.w.Write(enc.buf.Bytes())
+	return err
+}
+
+// assignReferents assigns referent IDs to the pointers within the value. As Microsoft's NDR engine does, the pointers
+// are numbered in a depth first walk, the pointers within a referent numbered after the pointer to it, rather than in
+// the order they are marshaled.
+func (enc *Encoder) assignReferents(v reflect.Value, tag tags) error {
+	if tag.has(TagPointer) {
+		if v.IsZero() {
+			return nil
+		}
+		enc.assignReferent(v)
+		tag = tag.without(TagPointer)
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == rpcUnicodeStringType {
+			enc.assignReferent(v.FieldByName("Value"))
+			return nil
+		}
+		fields, err := structFields(v)
+		if err != nil {
+			return err
+		}
+		for _, i := range fields {
+			if err := enc.assignReferents(v.Field(i), parseTags(v.Type().Field(i).Tag)); err != nil {
+				return err
+			}
+		}
+	case reflect.Array, reflect.Slice:
+		if isRawBytes(v.Type()) {
+			return nil
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := enc.assignReferents(v.Index(i), tag); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// assignReferent assigns the next referent ID to the pointer to the value.
+func (enc *Encoder) assignReferent(v reflect.Value) {
+	if v.CanAddr() {
+		enc.referents[valueKey{addr: v.UnsafeAddr(), t: v.Type()}] = enc.nextReferent()
+	}
+}
+
+// referentID returns the referent ID assigned to the pointer to the value.
+func (enc *Encoder) referentID(v reflect.Value) uint32 {
+	if v.CanAddr() {
+		if r, ok := enc.referents[valueKey{addr: v.UnsafeAddr(), t: v.Type()}]; ok {
+			return r
+		}
+	}
+	return enc.nextReferent()
+}
+
+// process marshals the value followed by the referents of the pointers within it.
+func (enc *Encoder) process(v reflect.Value, tag tags) error {
+	// The maximum counts of conformant arrays are moved to the beginning of the structure
+	// http://pubs.opengroup.org/onlinepubs/9629399/chap14.htm#tagfcjh_37
+	var maxCounts []uint32
+	if err := enc.conformantScan(v, tag, &maxCounts); err != nil {
+		return fmt.Errorf("failed to scan for embedded conformant arrays: %v", err)
+	}
+	for _, m := range maxCounts {
+		enc.writeUint32(m)
+	}
+	var def []deferredPtr
+	if err := enc.fill(v, tag, &def); err != nil {
+		return err
+	}
+	for _, p := range def {
+		if err := enc.process(p.v, p.tag); err != nil {
+			return fmt.Errorf("could not encode deferred referent: %v", err)
+		}
+	}
+	return nil
+}
+
+// conformantScan collects the maximum counts of the conformant arrays within the value, not behind a pointer.
+func (enc *Encoder) conformantScan(v reflect.Value, tag tags, maxCounts *[]uint32) error {
+	if tag.has(TagPointer) {
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if err := enc.conformantScan(v.Field(i), parseTags(v.Type().Field(i).Tag), maxCounts); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if !tag.has(TagConformant) {
+			break
+		}
+		m, _, err := stringCounts(v.String(), tag)
+		if err != nil {
+			return err
+		}
+		*maxCounts = append(*maxCounts, m)
+	case reflect.Slice:
+		if !tag.has(TagConformant) {
+			break
+		}
+		if err := checkSlice(v.Type(), tag); err != nil {
+			return err
+		}
+		*maxCounts = append(*maxCounts, uint32(v.Len()))
+	}
+	return nil
+}
+
+// fill marshals the value, deferring the referents of pointers.
+func (enc *Encoder) fill(v reflect.Value, tag tags, def *[]deferredPtr) error {
+	if tag.has(TagPointer) {
+		if v.IsZero() {
+			enc.writeUint32(0)
+			return nil
+		}
+		enc.writeUint32(enc.referentID(v))
+		*def = append(*def, deferredPtr{v: v, tag: tag.without(TagPointer)})
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() == rpcUnicodeStringType {
+			return enc.fillRPCUnicodeString(v, def)
+		}
+		return enc.fillStruct(v, def)
+	case reflect.Bool:
+		if v.Bool() {
+			enc.writeUint8(1)
+		} else {
+			enc.writeUint8(0)
+		}
+	case reflect.Uint8:
+		enc.writeUint8(uint8(v.Uint()))
+	case reflect.Uint16:
+		enc.writeUint16(uint16(v.Uint()))
+	case reflect.Uint32:
+		enc.writeUint32(uint32(v.Uint()))
+	case reflect.Uint64:
+		enc.writeUint64(v.Uint())
+	case reflect.Int8:
+		enc.writeUint8(uint8(v.Int()))
+	case reflect.Int16:
+		enc.writeUint16(uint16(v.Int()))
+	case reflect.Int32:
+		enc.writeUint32(uint32(v.Int()))
+	case reflect.Int64:
+		enc.writeUint64(uint64(v.Int()))
+	case reflect.Float32:
+		enc.writeUint32(math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		enc.writeUint64(math.Float64bits(v.Float()))
+	case reflect.String:
+		return enc.fillString(v.String(), tag)
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := enc.fill(v.Index(i), tag, def); err != nil {
+				return fmt.Errorf("could not encode index %d of fixed array: %v", i, err)
+			}
+		}
+	case reflect.Slice:
+		if isRawBytes(v.Type()) {
+			return enc.fillRawBytes(v, tag)
+		}
+		if err := checkSlice(v.Type(), tag); err != nil {
+			return err
+		}
+		if tag.has(TagVarying) {
+			// Offset and actual count
+			enc.writeUint32(0)
+			enc.writeUint32(uint32(v.Len()))
+		}
+		for i := 0; i < v.Len(); i++ {
+			if err := enc.fill(v.Index(i), tag, def); err != nil {
+				return fmt.Errorf("could not encode index %d of array: %v", i, err)
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported type %v", v.Type())
+	}
+	return nil
+}
+
+// fillStruct marshals the fields of the struct, only the selected field of a union.
+func (enc *Encoder) fillStruct(v reflect.Value, def *[]deferredPtr) error {
+	enc.current = append(enc.current, v.Type().Name())
+	fields, err := structFields(v)
+	if err != nil {
+		return err
+	}
+	for _, i := range fields {
+		f := v.Type().Field(i)
+		tag := parseTags(f.Tag)
+		enc.current = append(enc.current, f.Name)
+		// The discriminant of a non-encapsulated union precedes the union as well as being one of its fields
+		if tag.has(TagUnionTag) && !tag.has(TagEncapsulated) {
+			if err := enc.writeRaw(v.Field(i)); err != nil {
+				return fmt.Errorf("could not encode union discriminant(%s): %v", strings.Join(enc.current, "/"), err)
+			}
+		}
+		if isRawBytes(f.Type) {
+			tag.Map[tagSize] = strconv.Itoa(v.Field(i).Interface().(RawBytes).Size(v.Interface()))
+		}
+		if err := enc.fill(v.Field(i), tag, def); err != nil {
+			return fmt.Errorf("could not encode struct field(%s): %v", strings.Join(enc.current, "/"), err)
+		}
+		enc.current = enc.current[:len(enc.current)-1]
+	}
+	enc.current = enc.current[:len(enc.current)-1]
+	return nil
+}
+
+// structFields returns the indices of the fields of the struct to marshal, omitting the fields of a union other than
+// the one its discriminant selects.
+func structFields(v reflect.Value) ([]int, error) {
+	var fields []int
+	var unionTag reflect.Value
+	var unionField string
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		tag := parseTags(f.Tag)
+		if !unionTag.IsValid() {
+			if tag.has(TagUnionTag) {
+				unionTag = v.Field(i)
+			}
+		} else if tag.has(TagUnionField) {
+			if unionField == "" {
+				var err error
+				unionField, err = unionSelectedField(v, unionTag)
+				if err != nil {
+					return nil, fmt.Errorf("could not determine selected union value field for %s: %v", v.Type().Name(), err)
+				}
+			}
+			if f.Name != unionField {
+				continue
+			}
+		}
+		fields = append(fields, i)
+	}
+	return fields, nil
+}
+
+// fillRPCUnicodeString marshals an RPC_UNICODE_STRING, setting its lengths from its value, which is not null
+// terminated. The lengths of a string unmarshaled are kept, so that its maximum length is preserved.
+func (enc *Encoder) fillRPCUnicodeString(v reflect.Value, def *[]deferredPtr) error {
+	s := v.Interface().(mstypes.RPCUnicodeString)
+	l := 2 * len(utf16.Encode([]rune(s.Value)))
+	if l > math.MaxUint16 {
+		return fmt.Errorf("string of %d bytes too long for an RPC_UNICODE_STRING", l)
+	}
+	length, maxLength := uint16(l), s.MaximumLength
+	if s.Length != length || maxLength < length {
+		maxLength = length
+	}
+	enc.writeUint16(length)
+	enc.writeUint16(maxLength)
+	// The buffer is not null even for an empty string, as Microsoft's encoding has it
+	enc.writeUint32(enc.referentID(v.FieldByName("Value")))
+	*def = append(*def, deferredPtr{
+		v: v.FieldByName("Value"),
+		tag: tags{
+			Values: []string{TagConformant, TagVarying, tagUnterminated},
+			Map:    map[string]string{tagMaxCount: strconv.Itoa(int(maxLength / 2))},
+		},
+	})
+	return nil
+}
+
+// fillString marshals a varying string, preceded by its maximum count if it is not conformant.
+func (enc *Encoder) fillString(s string, tag tags) error {
+	_, n, err := stringCounts(s, tag)
+	if err != nil {
+		return err
+	}
+	// Offset and actual count
+	enc.writeUint32(0)
+	enc.writeUint32(n)
+	for _, c := range utf16.Encode([]rune(s)) {
+		enc.writeUint16(c)
+	}
+	if !tag.has(tagUnterminated) {
+		enc.writeUint16(0)
+	}
+	return nil
+}
+
+// stringCounts returns the maximum and actual counts of the characters of the string.
+func stringCounts(s string, tag tags) (uint32, uint32, error) {
+	n := uint32(len(utf16.Encode([]rune(s))))
+	if !tag.has(tagUnterminated) {
+		n++
+	}
+	m := n
+	if ms, ok := tag.Map[tagMaxCount]; ok {
+		i, err := strconv.ParseUint(ms, 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid maximum count %q: %v", ms, err)
+		}
+		m = uint32(i)
+	}
+	return m, n, nil
+}
+
+// checkSlice returns an error for the slices the encoder does not support.
+func checkSlice(t reflect.Type, tag tags) error {
+	if tag.has(TagPipe) {
+		return errors.New("pipes are not supported")
+	}
+	if t.Elem().Kind() == reflect.Slice {
+		return errors.New("multi-dimensional slices are not supported")
+	}
+	if t.Elem().Kind() == reflect.String {
+		return errors.New("string arrays are not supported")
+	}
+	return nil
+}
+
+// isRawBytes indicates if the type is a byte slice implementing RawBytes.
+func isRawBytes(t reflect.Type) bool {
+	return t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 && t.Implements(reflect.TypeOf(new(RawBytes)).Elem())
+}
+
+// fillRawBytes marshals the bytes of a RawBytes field, which must be of the size of the field.
+func (enc *Encoder) fillRawBytes(v reflect.Value, tag tags) error {
+	s, ok := tag.Map[tagSize]
+	if !ok {
+		return errors.New("size of raw bytes not available")
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return fmt.Errorf("size not valid: %v", err)
+	}
+	if v.Len() != n {
+		return fmt.Errorf("raw bytes of length %d do not match their size %d", v.Len(), n)
+	}
+	enc.buf.Write(v.Bytes())
+	return nil
+}
+
+// unionSelectedField returns the name of the field holding the value of the union for the discriminant provided.
+func unionSelectedField(union, discriminant reflect.Value) (string, error) {
+	u, ok := union.Interface().(Union)
+	if !ok {
+		return "", errors.New("struct does not implement union interface")
+	}
+	f := u.SwitchFunc(discriminant.Interface())
+	if f == "" {
+		return "", errors.New("the union select function did not return the name of the field to encode")
+	}
+	return f, nil
+}
+
+// writeRaw writes an integer without aligning it, as the decoder skips a non-encapsulated union's discriminant.
+func (enc *Encoder) writeRaw(v reflect.Value) error {
+	switch v.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return binary.Write(&enc.buf, binary.LittleEndian, v.Interface())
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return binary.Write(&enc.buf, binary.LittleEndian, v.Interface())
+	}
+	return fmt.Errorf("unsupported discriminant type %v", v.Type())
+}
+
+// nextReferent returns the referent ID of the next pointer.
+func (enc *Encoder) nextReferent() uint32 {
+	r := enc.referent
+	enc.referent += 4
+	return r
+}
+
+// align pads the stream to a multiple of n bytes. The stream's headers are a multiple of 8 bytes.
+func (enc *Encoder) align(n int) {
+	if s := enc.buf.Len() % n; s != 0 {
+		enc.buf.Write(make([]byte, n-s))
+	}
+}
+
+func (enc *Encoder) writeUint8(i uint8) {
+	enc.buf.WriteByte(i)
+}
+
+func (enc *Encoder) writeUint16(i uint16) {
+	enc.align(2)
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], i)
+	enc.buf.Write(b[:])
+}
+
+func (enc *Encoder) writeUint32(i uint32) {
+	enc.align(4)
+	var b [4]byte
+	binary.LittleEndian.PutUint32(b[:], i)
+	enc.buf.Write(b[:])
+}
+
+func (enc *Encoder) writeUint64(i uint64) {
+	enc.align(8)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], i)
+	enc.buf.Write(b[:])
+}
@@ -0,0 +1,76 @@
+// Package ndr marshals and unmarshals Go structs in the Network Data Representation (NDR) of type serialization
+// version 1 [MS-RPCE] section 2.2.6, the encoding of the structures of the Microsoft PAC and of other Microsoft types.
+//
+// Structs are described declaratively with struct tags, so that new types are added without hand-written byte walks:
+//
+//	type GroupMembership struct {
+//		RelativeID uint32
+//		Attributes uint32
+//	}
+//
+//	type Groups struct {
+//		GroupCount uint32
+//		GroupIDs   []GroupMembership `ndr:"pointer,conformant"`
+//	}
+//
+// The ndr struct tag takes the values:
+//
+//	pointer      - the field is a unique pointer to its value, which is deferred to after the enclosing structure. A
+//	               pointer to a zero value is marshaled as a null pointer.
+//	conformant   - the slice or string is a conformant array, its maximum count moved to the beginning of the
+//	               enclosing structure.
+//	varying      - the slice is a varying array, with an offset and actual count. Strings are always varying.
+//	unionTag     - the field is the discriminant of a union, the struct implementing the Union interface to select the
+//	               field holding its value.
+//	unionField   - the field is one of the fields of a union, only marshaled if the union selects it.
+//	encapsulated - the union's discriminant is not repeated before the union.
+//
+// Strings are marshaled as null terminated UTF-16 strings, as [string] IDL types are, other than the value of an
+// RPC_UNICODE_STRING, which is not null terminated and has its Length and MaximumLength set from its value.
+//
+// The Encoder mirrors the Decoder of github.com/jcmturner/rpc/v2/ndr, which Unmarshal uses, so that a struct
+// unmarshaled from bytes marshals to the same bytes.
+package ndr
+
+import (
+	"bytes"
+	"fmt"
+
+	rpcndr "github.com/jcmturner/rpc/v2/ndr"
+)
+
+// Struct tag values
+const (
+	TagConformant   = rpcndr.TagConformant
+	TagVarying      = rpcndr.TagVarying
+	TagPointer      = rpcndr.TagPointer
+	TagPipe         = rpcndr.TagPipe
+	TagUnionTag     = rpcndr.TagUnionTag
+	TagUnionField   = rpcndr.TagUnionField
+	TagEncapsulated = rpcndr.TagEncapsulated
+)
+
+// Union must be implemented by structs representing a union. The union's discriminant is passed to SwitchFunc, which
+// returns the name of the field holding the union's value.
+type Union = rpcndr.Union
+
+// RawBytes must be implemented by byte slice types marshaled as a number of bytes, rather than as an array, the number
+// of bytes being returned by Size when passed the enclosing struct.
+type RawBytes = rpcndr.RawBytes
+
+// Marshal returns the NDR encoding of the struct pointed to by v.
+func Marshal(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+	if err := NewEncoder(&b).Encode(v); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// Unmarshal decodes the NDR encoded bytes into the struct pointed to by v.
+func Unmarshal(b []byte, v interface{}) error {
+	if err := rpcndr.NewDecoder(bytes.NewReader(b)).Decode(v); err != nil {
+		return fmt.Errorf("could not unmarshal NDR: %v", err)
+	}
+	return nil
+}
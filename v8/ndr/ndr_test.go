@@ -0,0 +1,93 @@
+package ndr
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/rpc/v2/mstypes"
+	"github.com/stretchr/testify/assert"
+)
+
+type testStruct struct {
+	A   uint16
+	S   []uint32 `ndr:"pointer,conformant"`
+	Str mstypes.RPCUnicodeString
+	B   uint8
+	P   mstypes.RPCSID `ndr:"pointer"`
+}
+
+func TestMarshal(t *testing.T) {
+	t.Parallel()
+	s := testStruct{
+		A:   1,
+		S:   []uint32{2, 3},
+		Str: mstypes.RPCUnicodeString{Value: "hi"},
+		B:   7,
+	}
+	b, err := Marshal(&s)
+	if err != nil {
+		t.Fatalf("error marshaling: %v", err)
+	}
+	expected := "01100800cccccccc" + "38000000" + "00000000" + // headers
+		"00000200" + // top-level referent
+		"0100" + "0000" + "04000200" + // A, padding and S referent
+		"0400" + "0400" + "08000200" + // Str lengths and buffer referent
+		"07" + "000000" + "00000000" + // B, padding and null pointer P
+		"02000000" + "02000000" + "03000000" + // S
+		"02000000" + "00000000" + "02000000" + "68006900" // Str value
+	assert.Equal(t, expected, hex.EncodeToString(b), "marshaled bytes not as expected")
+
+	var u testStruct
+	if err := Unmarshal(b, &u); err != nil {
+		t.Fatalf("error unmarshaling: %v", err)
+	}
+	assert.Equal(t, s.A, u.A, "A not as expected")
+	assert.Equal(t, s.S, u.S, "S not as expected")
+	assert.Equal(t, "hi", u.Str.Value, "Str not as expected")
+	assert.Equal(t, uint16(4), u.Str.Length, "Str length not as expected")
+	assert.Equal(t, s.B, u.B, "B not as expected")
+}
+
+func TestMarshal_NotPointer(t *testing.T) {
+	t.Parallel()
+	_, err := Marshal(testStruct{})
+	assert.Error(t, err, "marshaling a struct not by pointer should error")
+}
+
+func TestMarshal_RoundTrip(t *testing.T) {
+	t.Parallel()
+	var tests = []string{
+		testdata.MarshaledPAC_ClientClaimsInfoStr,
+		testdata.MarshaledPAC_ClientClaimsInfoInt,
+		testdata.MarshaledPAC_ClientClaimsInfoMulti,
+		testdata.MarshaledPAC_ClientClaimsInfoMultiUint,
+		testdata.MarshaledPAC_ClientClaimsInfoMultiStr,
+	}
+	for i, test := range tests {
+		b, err := hex.DecodeString(test)
+		if err != nil {
+			t.Fatalf("test %d: could not decode test data hex string", i)
+		}
+		var m mstypes.ClaimsSetMetadata
+		if err := Unmarshal(b, &m); err != nil {
+			t.Fatalf("test %d: error unmarshaling ClaimsSetMetadata: %v", i, err)
+		}
+		mb, err := Marshal(&m)
+		if err != nil {
+			t.Fatalf("test %d: error marshaling ClaimsSetMetadata: %v", i, err)
+		}
+		assert.Equal(t, test, hex.EncodeToString(mb), "test %d: ClaimsSetMetadata not marshaled as unmarshaled", i)
+
+		// The claims sets of the test data are not compressed
+		var c mstypes.ClaimsSet
+		if err := Unmarshal(m.ClaimsSetBytes, &c); err != nil {
+			t.Fatalf("test %d: error unmarshaling ClaimsSet: %v", i, err)
+		}
+		cb, err := Marshal(&c)
+		if err != nil {
+			t.Fatalf("test %d: error marshaling ClaimsSet: %v", i, err)
+		}
+		assert.Equal(t, hex.EncodeToString(m.ClaimsSetBytes), hex.EncodeToString(cb), "test %d: ClaimsSet not marshaled as unmarshaled", i)
+	}
+}
@@ -0,0 +1,62 @@
+package ndr
+
+import (
+	"reflect"
+	"strings"
+)
+
+const (
+	ndrNameSpace = "ndr"
+	// tagUnterminated and tagMaxCount are set internally on the value of an RPC_UNICODE_STRING, which is not null
+	// terminated and whose maximum count is given by its MaximumLength.
+	tagUnterminated = "X-unterminated"
+	tagMaxCount     = "X-maxCount"
+)
+
+// tags are the values of an ndr struct tag, of the format ndr:"value,key:value1,value2"
+type tags struct {
+	Values []string
+	Map    map[string]string
+}
+
+// parseTags extracts the ndr values of the struct tag.
+func parseTags(st reflect.StructTag) tags {
+	t := tags{Map: make(map[string]string)}
+	s := st.Get(ndrNameSpace)
+	if s == "" {
+		return t
+	}
+	for _, v := range strings.Split(s, ",") {
+		if strings.Contains(v, ":") {
+			m := strings.SplitN(v, ":", 2)
+			t.Map[m[0]] = m[1]
+		} else {
+			t.Values = append(t.Values, v)
+		}
+	}
+	return t
+}
+
+// has indicates if the tags have the value provided.
+func (t tags) has(s string) bool {
+	for _, v := range t.Values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// without returns a copy of the tags without the value provided.
+func (t tags) without(s string) tags {
+	c := tags{Map: make(map[string]string)}
+	for _, v := range t.Values {
+		if v != s {
+			c.Values = append(c.Values, v)
+		}
+	}
+	for k, v := range t.Map {
+		c.Map[k] = v
+	}
+	return c
+}
@@ -0,0 +1,268 @@
+package pac
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/adtype"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/jcmturner/rpc/v2/mstypes"
+)
+
+const (
+	// groupAttributes are the attributes of the group memberships of a built PAC: mandatory, enabled by default and
+	// enabled.
+	groupAttributes uint32 = 1<<(31-mstypes.SEGroupMandatory) | 1<<(31-mstypes.SEGroupEnabledByDefault) | 1<<(31-mstypes.SEGroupEnabled)
+	// resourceGroupAttributes are the attributes of the resource group memberships of a built PAC.
+	resourceGroupAttributes = groupAttributes | 1<<(31-mstypes.SEGroupResource)
+	// userAccountNormal is the USER_NORMAL_ACCOUNT UserAccountControl flag, MS-SAMR section 2.2.1.12.
+	userAccountNormal uint32 = 0x00000010
+)
+
+// neverFileTime is the FILETIME of a time that never comes, as the KDC sets the logoff and kickoff times.
+var neverFileTime = mstypes.FileTime{LowDateTime: 0xFFFFFFFF, HighDateTime: 0x7FFFFFFF}
+
+// Builder builds signed PACs, so that services can test their authorization logic with tickets carrying the PAC of a
+// user without an Active Directory domain. The counts of the KerbValidationInfo's lists are set from the lists and the
+// optional info buffers are included if they are not nil.
+type Builder struct {
+	KerbValidationInfo KerbValidationInfo
+	ClientInfo         ClientInfo
+	S4UDelegationInfo  *S4UDelegationInfo
+	UPNDNSInfo         *UPNDNSInfo
+	ClientClaimsInfo   *ClientClaimsInfo
+	DeviceInfo         *DeviceInfo
+	DeviceClaimsInfo   *DeviceClaimsInfo
+}
+
+// NewBuilder returns a Builder for the PAC of the user of the relative ID provided within the domain, a member of the
+// domain's Domain Users group, authenticated at the time provided.
+func NewBuilder(username, domainName string, domainSID SID, userID uint32, authTime time.Time) *Builder {
+	return &Builder{
+		KerbValidationInfo: KerbValidationInfo{
+			LogOnTime:          mstypes.GetFileTime(authTime),
+			LogOffTime:         neverFileTime,
+			KickOffTime:        neverFileTime,
+			PasswordMustChange: neverFileTime,
+			EffectiveName:      mstypes.RPCUnicodeString{Value: username},
+			UserID:             userID,
+			PrimaryGroupID:     RIDDomainUsers,
+			GroupIDs:           []mstypes.GroupMembership{{RelativeID: RIDDomainUsers, Attributes: groupAttributes}},
+			LogonDomainName:    mstypes.RPCUnicodeString{Value: domainName},
+			LogonDomainID:      domainSID.RPCSID(),
+			UserAccountControl: userAccountNormal,
+		},
+		ClientInfo: ClientInfo{
+			ClientID: mstypes.GetFileTime(authTime),
+			Name:     username,
+		},
+	}
+}
+
+// AddGroups adds the user to the groups of the relative IDs provided within the user's domain.
+func (b *Builder) AddGroups(rids ...uint32) *Builder {
+	for _, rid := range rids {
+		b.KerbValidationInfo.GroupIDs = append(b.KerbValidationInfo.GroupIDs, mstypes.GroupMembership{RelativeID: rid, Attributes: groupAttributes})
+	}
+	return b
+}
+
+// AddExtraSIDs adds the SIDs provided, of groups outside the user's domain, to the PAC's extra SIDs.
+func (b *Builder) AddExtraSIDs(sids ...SID) *Builder {
+	for _, s := range sids {
+		b.KerbValidationInfo.ExtraSIDs = append(b.KerbValidationInfo.ExtraSIDs, mstypes.KerbSidAndAttributes{SID: s.RPCSID(), Attributes: groupAttributes})
+	}
+	b.KerbValidationInfo.UserFlags |= 1 << (31 - USERFLAG_EXTRA_SIDS)
+	return b
+}
+
+// AddResourceGroups adds the user to the resource groups of the relative IDs provided within the resource domain. A
+// PAC has the resource groups of a single domain.
+func (b *Builder) AddResourceGroups(domainSID SID, rids ...uint32) *Builder {
+	b.KerbValidationInfo.ResourceGroupDomainSID = domainSID.RPCSID()
+	for _, rid := range rids {
+		b.KerbValidationInfo.ResourceGroupIDs = append(b.KerbValidationInfo.ResourceGroupIDs, mstypes.GroupMembership{RelativeID: rid, Attributes: resourceGroupAttributes})
+	}
+	b.KerbValidationInfo.UserFlags |= 1 << (31 - USERFLAG_RESOURCE_GROUPIDS)
+	return b
+}
+
+// Build returns the encoded PAC, its server signature made with the service's key and its KDC signature made with the
+// key of the KDC's krbtgt account.
+func (b *Builder) Build(serviceKey, kdcKey types.EncryptionKey) ([]byte, error) {
+	return b.build(serviceKey, kdcKey, nil)
+}
+
+// BuildWithTicketChecksum returns the encoded PAC as Build does, with a ticket signature made with the KDC's key over
+// encTicketPart: the encoded EncTicketPart of the ticket the PAC is for, with the PAC replaced by a single zero byte.
+func (b *Builder) BuildWithTicketChecksum(serviceKey, kdcKey types.EncryptionKey, encTicketPart []byte) ([]byte, error) {
+	return b.build(serviceKey, kdcKey, encTicketPart)
+}
+
+// pacBuffer is an info buffer of a PAC being built.
+type pacBuffer struct {
+	ulType uint32
+	data   []byte
+}
+
+func (b *Builder) build(serviceKey, kdcKey types.EncryptionKey, encTicketPart []byte) ([]byte, error) {
+	var bufs []pacBuffer
+	k := b.KerbValidationInfo
+	k.GroupCount = uint32(len(k.GroupIDs))
+	k.SIDCount = uint32(len(k.ExtraSIDs))
+	k.ResourceGroupCount = uint32(len(k.ResourceGroupIDs))
+	kb, err := k.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	bufs = append(bufs, pacBuffer{infoTypeKerbValidationInfo, kb})
+	ci := b.ClientInfo
+	bufs = append(bufs, pacBuffer{infoTypePACClientInfo, ci.Marshal()})
+	if b.S4UDelegationInfo != nil {
+		s := *b.S4UDelegationInfo
+		s.TransitedListSize = uint32(len(s.S4UTransitedServices))
+		sb, err := s.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		bufs = append(bufs, pacBuffer{infoTypeS4UDelegationInfo, sb})
+	}
+	if b.UPNDNSInfo != nil {
+		u := *b.UPNDNSInfo
+		ub, err := u.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		bufs = append(bufs, pacBuffer{infoTypeUPNDNSInfo, ub})
+	}
+	if b.ClientClaimsInfo != nil {
+		c := *b.ClientClaimsInfo
+		cb, err := c.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		bufs = append(bufs, pacBuffer{infoTypePACClientClaimsInfo, cb})
+	}
+	if b.DeviceInfo != nil {
+		d := *b.DeviceInfo
+		d.AccountGroupCount = uint32(len(d.AccountGroupIDs))
+		d.SIDCount = uint32(len(d.ExtraSIDs))
+		d.DomainGroupCount = uint32(len(d.DomainGroup))
+		db, err := d.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		bufs = append(bufs, pacBuffer{infoTypePACDeviceInfo, db})
+	}
+	if b.DeviceClaimsInfo != nil {
+		c := *b.DeviceClaimsInfo
+		cb, err := c.Marshal()
+		if err != nil {
+			return nil, err
+		}
+		bufs = append(bufs, pacBuffer{infoTypePACDeviceClaimsInfo, cb})
+	}
+
+	// The server and KDC signatures are zeroed while the server signature is made over the PAC
+	serverSig, err := zeroSignature(serviceKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating PAC server signature: %v", err)
+	}
+	kdcSig, err := zeroSignature(kdcKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating PAC KDC signature: %v", err)
+	}
+	serverIdx := len(bufs)
+	bufs = append(bufs, pacBuffer{infoTypePACServerSignatureData, serverSig.Marshal()})
+	kdcIdx := len(bufs)
+	bufs = append(bufs, pacBuffer{infoTypePACKDCSignatureData, kdcSig.Marshal()})
+	if encTicketPart != nil {
+		ticketSig, err := sign(kdcKey, encTicketPart)
+		if err != nil {
+			return nil, fmt.Errorf("error creating PAC ticket signature: %v", err)
+		}
+		bufs = append(bufs, pacBuffer{infoTypePACTicketChecksum, ticketSig.Marshal()})
+	}
+
+	// The buffers follow the info buffer descriptions, each at an offset that is a multiple of eight
+	offsets := make([]int, len(bufs))
+	n := 8 + 16*len(bufs)
+	for i, buf := range bufs {
+		offsets[i] = n
+		n += (len(buf.data) + 7) &^ 7
+	}
+	p := make([]byte, n)
+	binary.LittleEndian.PutUint32(p, uint32(len(bufs)))
+	for i, buf := range bufs {
+		d := p[8+16*i:]
+		binary.LittleEndian.PutUint32(d, buf.ulType)
+		binary.LittleEndian.PutUint32(d[4:], uint32(len(buf.data)))
+		binary.LittleEndian.PutUint64(d[8:], uint64(offsets[i]))
+		copy(p[offsets[i]:], buf.data)
+	}
+
+	serverSig, err = sign(serviceKey, p)
+	if err != nil {
+		return nil, fmt.Errorf("error creating PAC server signature: %v", err)
+	}
+	copy(p[offsets[serverIdx]:], serverSig.Marshal())
+	kdcSig, err = sign(kdcKey, serverSig.Signature)
+	if err != nil {
+		return nil, fmt.Errorf("error creating PAC KDC signature: %v", err)
+	}
+	copy(p[offsets[kdcIdx]:], kdcSig.Marshal())
+	return p, nil
+}
+
+// NewAuthorizationData returns the authorization data of a ticket carrying the encoded PAC, an AD-WIN2K-PAC element
+// within AD-IF-RELEVANT.
+func NewAuthorizationData(pac []byte) (types.AuthorizationData, error) {
+	b, err := asn1.Marshal(types.AuthorizationData{{ADType: adtype.ADWin2KPAC, ADData: pac}})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling PAC authorization data: %v", err)
+	}
+	return types.AuthorizationData{{ADType: adtype.ADIfRelevant, ADData: b}}, nil
+}
+
+// signatureType returns the checksum type of the PAC signatures made with the key, that of its encryption type.
+func signatureType(key types.EncryptionKey) (uint32, error) {
+	et, err := crypto.GetEtype(key.KeyType)
+	if err != nil {
+		return 0, err
+	}
+	t := uint32(et.GetHashID())
+	if signatureSize(t) == 0 {
+		return 0, fmt.Errorf("PAC signatures cannot be made with keys of encryption type %d", key.KeyType)
+	}
+	return t, nil
+}
+
+// zeroSignature returns a zeroed signature of the type made with the key.
+func zeroSignature(key types.EncryptionKey) (SignatureData, error) {
+	t, err := signatureType(key)
+	if err != nil {
+		return SignatureData{}, err
+	}
+	return SignatureData{SignatureType: t, Signature: make([]byte, signatureSize(t))}, nil
+}
+
+// sign returns the signature over the data made with the key.
+func sign(key types.EncryptionKey, data []byte) (SignatureData, error) {
+	t, err := signatureType(key)
+	if err != nil {
+		return SignatureData{}, err
+	}
+	etype, err := crypto.GetChksumEtype(int32(t))
+	if err != nil {
+		return SignatureData{}, err
+	}
+	cksum, err := etype.GetChecksumHash(key.KeyValue, data, keyusage.KERB_NON_KERB_CKSUM_SALT)
+	if err != nil {
+		return SignatureData{}, err
+	}
+	return SignatureData{SignatureType: t, Signature: cksum}, nil
+}
@@ -0,0 +1,130 @@
+package pac
+
+import (
+	"bytes"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/rpc/v2/mstypes"
+	"github.com/stretchr/testify/assert"
+)
+
+// testBuiltPAC returns the PAC unmarshaled from the bytes and processed with the key provided.
+func testBuiltPAC(t *testing.T, b []byte, key types.EncryptionKey) PACType {
+	var pac PACType
+	err := pac.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling built PAC: %v", err)
+	}
+	err = pac.ProcessPACInfoBuffers(key, log.New(bytes.NewBufferString(""), "", 0))
+	if err != nil {
+		t.Fatalf("Error processing built PAC: %v", err)
+	}
+	return pac
+}
+
+func TestBuilder_Build(t *testing.T) {
+	t.Parallel()
+	domain, _ := ParseSID("S-1-5-21-1-2-3")
+	resource, _ := ParseSID("S-1-5-21-4-5-6")
+	extra, _ := ParseSID(SIDAuthenticationAuthorityAssertedIdentity)
+	authTime := time.Date(2021, 11, 9, 10, 0, 0, 0, time.UTC)
+	pb := NewBuilder("testuser1", "TEST", domain, 1105, authTime).
+		AddGroups(RIDDomainAdmins, 1110).
+		AddExtraSIDs(extra).
+		AddResourceGroups(resource, 1120)
+	pb.UPNDNSInfo = &UPNDNSInfo{
+		UPN:       "testuser1@test.gokrb5",
+		DNSDomain: "TEST.GOKRB5",
+		Flags:     UPNDNSFlagExtended,
+		SamName:   "testuser1",
+		SID:       domain.WithRID(1105).RPCSID(),
+	}
+	pb.S4UDelegationInfo = &S4UDelegationInfo{
+		S4U2proxyTarget:      mstypes.RPCUnicodeString{Value: "HTTP/backend.test.gokrb5"},
+		S4UTransitedServices: []mstypes.RPCUnicodeString{{Value: "HTTP/frontend.test.gokrb5@TEST.GOKRB5"}},
+	}
+	pb.ClientClaimsInfo = &ClientClaimsInfo{
+		ClaimsSet: mstypes.ClaimsSet{
+			ClaimsArrayCount: 1,
+			ClaimsArrays: []mstypes.ClaimsArray{{
+				ClaimsSourceType: mstypes.ClaimsSourceTypeAD,
+				ClaimsCount:      1,
+				ClaimEntries: []mstypes.ClaimEntry{{
+					ID:         ClaimsEntryIDStr,
+					Type:       mstypes.ClaimTypeIDString,
+					TypeString: mstypes.ClaimTypeString{ValueCount: 1, Value: []mstypes.LPWSTR{{Value: ClaimsEntryValueStr}}},
+				}},
+			}},
+		},
+	}
+
+	etype, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	serviceKey, _ := types.GenerateEncryptionKey(etype)
+	kdcKey, _ := types.GenerateEncryptionKey(etype)
+	b, err := pb.Build(serviceKey, kdcKey)
+	if err != nil {
+		t.Fatalf("Error building PAC: %v", err)
+	}
+	pac := testBuiltPAC(t, b, serviceKey)
+
+	assert.Equal(t, "testuser1", pac.KerbValidationInfo.EffectiveName.Value, "EffectiveName not as expected")
+	assert.Equal(t, authTime, pac.KerbValidationInfo.LogOnTime.Time(), "LogOnTime not as expected")
+	assert.Equal(t, "S-1-5-21-1-2-3-1105", pac.KerbValidationInfo.UserSID().String(), "user SID not as expected")
+	assert.Equal(t, []string{
+		"S-1-5-21-1-2-3-513",
+		"S-1-5-21-1-2-3-512",
+		"S-1-5-21-1-2-3-1110",
+		"S-1-18-1",
+		"S-1-5-21-4-5-6-1120",
+	}, pac.KerbValidationInfo.GetGroupMembershipSIDs(), "group SIDs not as expected")
+	assert.Equal(t, uint32(3), pac.KerbValidationInfo.GroupCount, "GroupCount not as expected")
+	assert.Equal(t, uint32(0x220), pac.KerbValidationInfo.UserFlags, "UserFlags not as expected")
+	assert.Equal(t, "testuser1", pac.ClientInfo.Name, "ClientInfo name not as expected")
+	assert.Equal(t, authTime, pac.ClientInfo.ClientID.Time(), "ClientInfo time not as expected")
+	assert.Equal(t, "testuser1@test.gokrb5", pac.UPNDNSInfo.UPN, "UPN not as expected")
+	assert.Equal(t, "TEST.GOKRB5", pac.UPNDNSInfo.DNSDomain, "DNS domain not as expected")
+	assert.Equal(t, "testuser1", pac.UPNDNSInfo.SamName, "SAM name not as expected")
+	assert.Equal(t, "S-1-5-21-1-2-3-1105", pac.UPNDNSInfo.SID.String(), "UPN_DNS_INFO SID not as expected")
+	assert.Equal(t, "HTTP/backend.test.gokrb5", pac.S4UDelegationInfo.S4U2proxyTarget.Value, "S4U2proxy target not as expected")
+	assert.Equal(t, uint32(1), pac.S4UDelegationInfo.TransitedListSize, "transited list size not as expected")
+	assert.Equal(t, []interface{}{ClaimsEntryValueStr}, pac.ClientClaimsInfo.Claims()[ClaimsEntryIDStr], "claim not as expected")
+	assert.Nil(t, pac.DeviceInfo, "DeviceInfo should not be included")
+	assert.Nil(t, pac.TicketChecksum, "TicketChecksum should not be included")
+
+	assert.NoError(t, pac.VerifyKDCChecksum(NewKDCKeyVerifier(kdcKey)), "KDC checksum should verify with the KDC key")
+	assert.Error(t, pac.VerifyKDCChecksum(NewKDCKeyVerifier(serviceKey)), "KDC checksum should not verify with another key")
+
+	var other PACType
+	otherKey, _ := types.GenerateEncryptionKey(etype)
+	other.Unmarshal(b)
+	err = other.ProcessPACInfoBuffers(otherKey, log.New(bytes.NewBufferString(""), "", 0))
+	assert.Error(t, err, "server checksum should not verify with another key")
+}
+
+func TestBuilder_BuildWithTicketChecksum(t *testing.T) {
+	t.Parallel()
+	domain, _ := ParseSID("S-1-5-21-1-2-3")
+	pb := NewBuilder("testuser1", "TEST", domain, 1105, time.Now().UTC())
+	etype, _ := crypto.GetEtype(etypeID.RC4_HMAC)
+	serviceKey, _ := types.GenerateEncryptionKey(etype)
+	etype, _ = crypto.GetEtype(etypeID.AES128_CTS_HMAC_SHA1_96)
+	kdcKey, _ := types.GenerateEncryptionKey(etype)
+	encTicketPart := []byte("encoded EncTicketPart")
+	b, err := pb.BuildWithTicketChecksum(serviceKey, kdcKey, encTicketPart)
+	if err != nil {
+		t.Fatalf("Error building PAC: %v", err)
+	}
+	pac := testBuiltPAC(t, b, serviceKey)
+	assert.NoError(t, pac.VerifyKDCChecksum(NewKDCKeyVerifier(kdcKey)), "KDC checksum should verify with the KDC key")
+	assert.NoError(t, pac.VerifyTicketChecksum(NewKDCKeyVerifier(kdcKey), encTicketPart), "ticket checksum should verify with the KDC key")
+
+	etype, _ = crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA384_192)
+	key, _ := types.GenerateEncryptionKey(etype)
+	_, err = pb.Build(key, kdcKey)
+	assert.Error(t, err, "PAC signatures should not be made with a key of an encryption type not supported in PACs")
+}
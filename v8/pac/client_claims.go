@@ -1,11 +1,11 @@
 package pac
 
 import (
-	"bytes"
+	"errors"
 	"fmt"
 
+	"github.com/Osirium/gokrb5/v8/ndr"
 	"github.com/jcmturner/rpc/v2/mstypes"
-	"github.com/jcmturner/rpc/v2/ndr"
 )
 
 // Claims reference: https://msdn.microsoft.com/en-us/library/hh553895.aspx
@@ -18,17 +18,95 @@ type ClientClaimsInfo struct {
 
 // Unmarshal bytes into the ClientClaimsInfo struct
 func (k *ClientClaimsInfo) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
-	m := new(mstypes.ClaimsSetMetadata)
-	err = dec.Decode(m)
+	k.ClaimsSetMetadata, k.ClaimsSet, err = unmarshalClaims(b)
 	if err != nil {
-		err = fmt.Errorf("error unmarshaling ClientClaimsInfo ClaimsSetMetadata: %v", err)
+		err = fmt.Errorf("error unmarshaling ClientClaimsInfo %v", err)
+	}
+	return
+}
+
+// Claims returns the values of the client's claims by claim ID.
+func (k *ClientClaimsInfo) Claims() map[string][]interface{} {
+	return claimValues(k.ClaimsSet)
+}
+
+// unmarshalClaims unmarshals the ClaimsSetMetadata of a claims buffer and the ClaimsSet it holds, decompressing it if
+// it is compressed.
+func unmarshalClaims(b []byte) (m mstypes.ClaimsSetMetadata, c mstypes.ClaimsSet, err error) {
+	err = ndr.Unmarshal(b, &m)
+	if err != nil {
+		err = fmt.Errorf("ClaimsSetMetadata: %v", err)
 		return
 	}
-	k.ClaimsSetMetadata = *m
-	k.ClaimsSet, err = k.ClaimsSetMetadata.ClaimsSet()
+	if len(m.ClaimsSetBytes) < 1 {
+		err = errors.New("ClaimsSet: no bytes available")
+		return
+	}
+	cb, err := decompress(m.CompressionFormat, m.ClaimsSetBytes, m.UncompressedClaimsSetSize)
+	if err != nil {
+		err = fmt.Errorf("ClaimsSet: could not decompress format %d: %v", m.CompressionFormat, err)
+		return
+	}
+	err = ndr.Unmarshal(cb, &c)
 	if err != nil {
-		err = fmt.Errorf("error unmarshaling ClientClaimsInfo ClaimsSet: %v", err)
+		err = fmt.Errorf("ClaimsSet: %v", err)
 	}
 	return
 }
+
+// Marshal the ClientClaimsInfo struct into the bytes of a client claims buffer, holding its ClaimsSet uncompressed.
+func (k *ClientClaimsInfo) Marshal() ([]byte, error) {
+	b, err := marshalClaims(&k.ClaimsSetMetadata, k.ClaimsSet)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling ClientClaimsInfo: %v", err)
+	}
+	return b, nil
+}
+
+// marshalClaims marshals the claims set into the ClaimsSetMetadata, uncompressed, returning the encoded metadata.
+func marshalClaims(m *mstypes.ClaimsSetMetadata, c mstypes.ClaimsSet) ([]byte, error) {
+	cb, err := ndr.Marshal(&c)
+	if err != nil {
+		return nil, fmt.Errorf("ClaimsSet: %v", err)
+	}
+	m.ClaimsSetSize = uint32(len(cb))
+	m.ClaimsSetBytes = cb
+	m.CompressionFormat = mstypes.CompressionFormatNone
+	m.UncompressedClaimsSetSize = uint32(len(cb))
+	b, err := ndr.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("ClaimsSetMetadata: %v", err)
+	}
+	return b, nil
+}
+
+// claimValues returns the values of the claims in the set by claim ID. Values are int64, uint64, string or bool
+// according to the type of the claim.
+func claimValues(c mstypes.ClaimsSet) map[string][]interface{} {
+	claims := make(map[string][]interface{})
+	for _, a := range c.ClaimsArrays {
+		for _, e := range a.ClaimEntries {
+			var v []interface{}
+			switch e.Type {
+			case mstypes.ClaimTypeIDInt64:
+				for _, i := range e.TypeInt64.Value {
+					v = append(v, i)
+				}
+			case mstypes.ClaimTypeIDUInt64:
+				for _, i := range e.TypeUInt64.Value {
+					v = append(v, i)
+				}
+			case mstypes.ClaimTypeIDString:
+				for _, s := range e.TypeString.Value {
+					v = append(v, s.Value)
+				}
+			case mstypes.ClaimsTypeIDBoolean:
+				for _, b := range e.TypeBool.Value {
+					v = append(v, b)
+				}
+			}
+			claims[e.ID] = append(claims[e.ID], v...)
+		}
+	}
+	return claims
+}
@@ -127,17 +127,21 @@ func TestPAC_ClientClaimsInfoMultiEntry_Unmarshal(t *testing.T) {
 	assert.Equal(t, mstypes.CompressionFormatNone, k.ClaimsSetMetadata.CompressionFormat, "compression format not as expected")
 }
 
-// Compressed claims not yet supported.
-//func TestPAC_ClientClaimsInfo_Unmarshal_UnsupportedCompression(t *testing.T) {
-//	t.Parallel()
-//	b, err := hex.DecodeString(testdata.MarshaledPAC_ClientClaimsInfo_XPRESS_HUFF)
-//	if err != nil {
-//		t.Fatal("Could not decode test data hex string")
-//	}
-//	var k ClientClaimsInfo
-//	err = k.Unmarshal(b)
-//	if err != nil {
-//		t.Fatalf("Error unmarshaling test data: %v", err)
-//	}
-//	assert.Equal(t, mstypes.CompressionFormatXPressHuff, k.ClaimsSetMetadata.CompressionFormat, "compression format not as expected")
-//}
+func TestPAC_ClientClaimsInfo_Unmarshal_XPressHuff(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_ClientClaimsInfo_XPRESS_HUFF)
+	if err != nil {
+		t.Fatal("Could not decode test data hex string")
+	}
+	var k ClientClaimsInfo
+	err = k.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	assert.Equal(t, mstypes.CompressionFormatXPressHuff, k.ClaimsSetMetadata.CompressionFormat, "compression format not as expected")
+	assert.Equal(t, uint32(3), k.ClaimsSet.ClaimsArrays[0].ClaimsCount, "claims count not as expected")
+	claims := k.Claims()
+	assert.Equal(t, []interface{}{ClaimsEntryValueStr}, claims[ClaimsEntryIDStr], "string claim not as expected")
+	assert.Equal(t, []interface{}{uint64(655369), uint64(65543), uint64(65542), uint64(65536)}, claims[ClaimsEntryIDUInt64], "uint64 claim not as expected")
+	assert.Equal(t, []interface{}{int64(805306368)}, claims["ad://ext/sAMAccountType:88d5de79a7ecf8c7"], "int64 claim not as expected")
+}
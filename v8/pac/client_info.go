@@ -2,6 +2,7 @@ package pac
 
 import (
 	"bytes"
+	"encoding/binary"
 
 	"github.com/jcmturner/rpc/v2/mstypes"
 )
@@ -29,3 +30,14 @@ func (k *ClientInfo) Unmarshal(b []byte) (err error) {
 	k.Name, err = r.UTF16String(int(k.NameLength))
 	return
 }
+
+// Marshal the ClientInfo struct into the bytes of a client info buffer, setting NameLength from the Name.
+func (k *ClientInfo) Marshal() []byte {
+	name := utf16Bytes(k.Name)
+	k.NameLength = uint16(len(name))
+	b := make([]byte, 10, 10+len(name))
+	binary.LittleEndian.PutUint32(b, k.ClientID.LowDateTime)
+	binary.LittleEndian.PutUint32(b[4:], k.ClientID.HighDateTime)
+	binary.LittleEndian.PutUint16(b[8:], k.NameLength)
+	return append(b, name...)
+}
@@ -24,3 +24,17 @@ func TestPAC_ClientInfo_Unmarshal(t *testing.T) {
 	assert.Equal(t, uint16(18), k.NameLength, "Client name length not as expected")
 	assert.Equal(t, "testuser1", k.Name, "Client name not as expected")
 }
+
+func TestPAC_ClientInfo_Marshal(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_Client_Info)
+	if err != nil {
+		t.Fatal("Could not decode test data hex string")
+	}
+	var k ClientInfo
+	err = k.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	assert.Equal(t, b, k.Marshal(), "ClientInfo not marshaled as unmarshaled")
+}
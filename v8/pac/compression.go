@@ -0,0 +1,350 @@
+package pac
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jcmturner/rpc/v2/mstypes"
+)
+
+// Claims sets may be compressed with one of the formats of the Microsoft Xpress Compression Algorithm [MS-XCA].
+// Reference: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-xca/a8b7cb0a-92a6-4187-a23b-5e14273b96f8
+
+const (
+	// xpressHuffTableSize is the size, in bytes, of the table of symbol bit lengths beginning each LZ77+Huffman block.
+	xpressHuffTableSize = 256
+	// xpressHuffBlockSize is the number of bytes each LZ77+Huffman block decompresses to, bar the last.
+	xpressHuffBlockSize = 65536
+	// xpressHuffMaxBitLength is the maximum bit length of a LZ77+Huffman symbol.
+	xpressHuffMaxBitLength = 15
+	// lznt1ChunkSize is the number of bytes each LZNT1 chunk decompresses to, bar the last.
+	lznt1ChunkSize = 4096
+)
+
+var errCompressedDataTruncated = errors.New("compressed data truncated")
+
+// decompress returns the bytes decompressed from b in the compression format provided, which must decompress to the
+// size provided.
+func decompress(format uint16, b []byte, size uint32) ([]byte, error) {
+	var d []byte
+	var err error
+	switch format {
+	case mstypes.CompressionFormatNone:
+		return b, nil
+	case mstypes.CompressionFormatLZNT1:
+		d, err = decompressLZNT1(b, int(size))
+	case mstypes.CompressionFormatXPress:
+		d, err = decompressXpress(b, int(size))
+	case mstypes.CompressionFormatXPressHuff:
+		d, err = decompressXpressHuff(b, int(size))
+	default:
+		return nil, fmt.Errorf("compression format %d not supported", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(d) != int(size) {
+		return nil, fmt.Errorf("decompressed size %d does not match the expected size %d", len(d), size)
+	}
+	return d, nil
+}
+
+// copyMatch appends the match of the length provided at the offset back from the end of the output.
+// The match may overlap the bytes it appends.
+func copyMatch(out []byte, offset, length int) ([]byte, error) {
+	if offset < 1 || offset > len(out) {
+		return nil, fmt.Errorf("match offset %d out of range of %d bytes decompressed", offset, len(out))
+	}
+	start := len(out) - offset
+	for i := 0; i < length; i++ {
+		out = append(out, out[start+i])
+	}
+	return out, nil
+}
+
+// decompressXpress decompresses the Plain LZ77 format, MS-XCA section 2.4.
+func decompressXpress(b []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	var flags uint32
+	var flagCount uint
+	var pos, lastLengthHalfByte int
+	for len(out) < size {
+		if flagCount == 0 {
+			if pos+4 > len(b) {
+				return nil, errCompressedDataTruncated
+			}
+			flags = binary.LittleEndian.Uint32(b[pos:])
+			pos += 4
+			flagCount = 32
+		}
+		flagCount--
+		if flags&(1<<flagCount) == 0 {
+			if pos >= len(b) {
+				return nil, errCompressedDataTruncated
+			}
+			out = append(out, b[pos])
+			pos++
+			continue
+		}
+		if pos+2 > len(b) {
+			return nil, errCompressedDataTruncated
+		}
+		match := int(binary.LittleEndian.Uint16(b[pos:]))
+		pos += 2
+		length := match % 8
+		offset := match/8 + 1
+		if length == 7 {
+			// The extended length is held in half bytes, the second half of the byte shared with the next match
+			if lastLengthHalfByte == 0 {
+				if pos >= len(b) {
+					return nil, errCompressedDataTruncated
+				}
+				length = int(b[pos] % 16)
+				lastLengthHalfByte = pos
+				pos++
+			} else {
+				length = int(b[lastLengthHalfByte] / 16)
+				lastLengthHalfByte = 0
+			}
+			if length == 15 {
+				var err error
+				length, pos, err = readExtendedLength(b, pos, 15+7)
+				if err != nil {
+					return nil, err
+				}
+			}
+			length += 7
+		}
+		length += 3
+		var err error
+		if out, err = copyMatch(out, offset, length); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// readExtendedLength reads the length of a match that does not fit in the bits of its symbol, from the byte at pos
+// and, if that is 255, the following 16 or 32 bits. bias is the part of the length accounted for by the symbol.
+// It returns the length less the bias plus 15, and the position after the bytes read.
+func readExtendedLength(b []byte, pos, bias int) (int, int, error) {
+	if pos >= len(b) {
+		return 0, pos, errCompressedDataTruncated
+	}
+	length := int(b[pos])
+	pos++
+	if length == 255 {
+		if pos+2 > len(b) {
+			return 0, pos, errCompressedDataTruncated
+		}
+		length = int(binary.LittleEndian.Uint16(b[pos:]))
+		pos += 2
+		if length == 0 {
+			if pos+4 > len(b) {
+				return 0, pos, errCompressedDataTruncated
+			}
+			length = int(binary.LittleEndian.Uint32(b[pos:]))
+			pos += 4
+		}
+		if length < bias {
+			return 0, pos, errors.New("invalid match length")
+		}
+		length -= bias
+	}
+	return length + 15, pos, nil
+}
+
+// decompressXpressHuff decompresses the LZ77+Huffman format, MS-XCA section 2.2.
+func decompressXpressHuff(b []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	pos := 0
+	for len(out) < size {
+		// Each block begins with the bit lengths of its 512 symbols, two to a byte
+		if pos+xpressHuffTableSize > len(b) {
+			return nil, errCompressedDataTruncated
+		}
+		var lengths [512]uint8
+		for i, l := range b[pos : pos+xpressHuffTableSize] {
+			lengths[2*i] = l & 0x0F
+			lengths[2*i+1] = l >> 4
+		}
+		pos += xpressHuffTableSize
+		table, err := xpressHuffDecodingTable(lengths)
+		if err != nil {
+			return nil, err
+		}
+
+		// The bit stream is read as 16 bit little endian words, most significant bit first
+		r := &xpressHuffBitReader{b: b, pos: pos}
+		if err := r.init(); err != nil {
+			return nil, err
+		}
+		blockEnd := len(out) + xpressHuffBlockSize
+		for len(out) < blockEnd && len(out) < size {
+			symbol := int(table[r.bits>>(32-xpressHuffMaxBitLength)])
+			if err := r.consume(uint(lengths[symbol])); err != nil {
+				return nil, err
+			}
+			if symbol < 256 {
+				out = append(out, byte(symbol))
+				continue
+			}
+			symbol -= 256
+			length := symbol % 16
+			offsetBitLength := uint(symbol / 16)
+			if length == 15 {
+				length, r.pos, err = readExtendedLength(b, r.pos, 15)
+				if err != nil {
+					return nil, err
+				}
+			}
+			length += 3
+			offset := int(r.bits>>(32-offsetBitLength)) + 1<<offsetBitLength
+			if err := r.consume(offsetBitLength); err != nil {
+				return nil, err
+			}
+			if out, err = copyMatch(out, offset, length); err != nil {
+				return nil, err
+			}
+		}
+		pos = r.pos
+	}
+	return out, nil
+}
+
+// xpressHuffDecodingTable returns the table decoding the symbol from the next 15 bits of a LZ77+Huffman bit stream,
+// for the canonical Huffman code of the bit lengths of the symbols provided.
+func xpressHuffDecodingTable(lengths [512]uint8) ([]uint16, error) {
+	table := make([]uint16, 1<<xpressHuffMaxBitLength)
+	i := 0
+	for l := uint8(1); l <= xpressHuffMaxBitLength; l++ {
+		for symbol, sl := range lengths {
+			if sl != l {
+				continue
+			}
+			n := 1 << (xpressHuffMaxBitLength - l)
+			if i+n > len(table) {
+				return nil, errors.New("invalid Huffman code lengths")
+			}
+			for j := 0; j < n; j++ {
+				table[i+j] = uint16(symbol)
+			}
+			i += n
+		}
+	}
+	if i != len(table) {
+		return nil, errors.New("invalid Huffman code lengths")
+	}
+	return table, nil
+}
+
+// xpressHuffBitReader reads the bit stream of a LZ77+Huffman block.
+type xpressHuffBitReader struct {
+	b          []byte
+	pos        int
+	bits       uint32 // The next bits of the stream, most significant first
+	extraCount int    // The number of bits held beyond the 16 that are always available
+}
+
+func (r *xpressHuffBitReader) init() error {
+	if r.pos+4 > len(r.b) {
+		return errCompressedDataTruncated
+	}
+	r.bits = uint32(binary.LittleEndian.Uint16(r.b[r.pos:]))<<16 | uint32(binary.LittleEndian.Uint16(r.b[r.pos+2:]))
+	r.pos += 4
+	r.extraCount = 16
+	return nil
+}
+
+// consume discards the next n bits, reading the next word of the stream if fewer than 16 bits are left.
+func (r *xpressHuffBitReader) consume(n uint) error {
+	r.bits <<= n
+	r.extraCount -= int(n)
+	if r.extraCount < 0 {
+		if r.pos+2 > len(r.b) {
+			// The stream may end once the last symbols are in the bits held
+			if r.extraCount+16 < 0 {
+				return errCompressedDataTruncated
+			}
+			r.extraCount += 16
+			return nil
+		}
+		r.bits |= uint32(binary.LittleEndian.Uint16(r.b[r.pos:])) << uint(-r.extraCount)
+		r.extraCount += 16
+		r.pos += 2
+	}
+	return nil
+}
+
+// decompressLZNT1 decompresses the LZNT1 format, MS-XCA section 2.5.
+func decompressLZNT1(b []byte, size int) ([]byte, error) {
+	out := make([]byte, 0, size)
+	pos := 0
+	for pos+2 <= len(b) && len(out) < size {
+		header := binary.LittleEndian.Uint16(b[pos:])
+		pos += 2
+		if header == 0 {
+			break
+		}
+		end := pos + int(header&0x0FFF) + 1
+		if end > len(b) {
+			return nil, errCompressedDataTruncated
+		}
+		chunk := b[pos:end]
+		pos = end
+		if header&0x8000 == 0 {
+			out = append(out, chunk...)
+			continue
+		}
+		var err error
+		if out, err = decompressLZNT1Chunk(out, chunk); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// decompressLZNT1Chunk appends the bytes decompressed from a compressed LZNT1 chunk to the output.
+func decompressLZNT1Chunk(out, chunk []byte) ([]byte, error) {
+	start := len(out)
+	pos := 0
+	for pos < len(chunk) {
+		flags := chunk[pos]
+		pos++
+		for i := uint(0); i < 8 && pos < len(chunk); i++ {
+			if flags&(1<<i) == 0 {
+				out = append(out, chunk[pos])
+				pos++
+				continue
+			}
+			if pos+2 > len(chunk) {
+				return nil, errCompressedDataTruncated
+			}
+			token := int(binary.LittleEndian.Uint16(chunk[pos:]))
+			pos += 2
+			// The bits of the token holding the offset grow with the position in the chunk
+			n := len(out) - start
+			if n == 0 {
+				return nil, errors.New("LZNT1 chunk begins with a match")
+			}
+			lengthBits := uint(12)
+			for p := n - 1; p >= 0x10; p >>= 1 {
+				lengthBits--
+			}
+			length := token&(1<<lengthBits-1) + 3
+			offset := token>>lengthBits + 1
+			if offset > n {
+				return nil, fmt.Errorf("match offset %d out of range of %d bytes decompressed in the chunk", offset, n)
+			}
+			var err error
+			if out, err = copyMatch(out, offset, length); err != nil {
+				return nil, err
+			}
+			if len(out)-start > lznt1ChunkSize {
+				return nil, errors.New("LZNT1 chunk decompresses beyond the chunk size")
+			}
+		}
+	}
+	return out, nil
+}
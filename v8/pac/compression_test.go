@@ -0,0 +1,112 @@
+package pac
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/jcmturner/rpc/v2/mstypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompress_XPress(t *testing.T) {
+	t.Parallel()
+	// Examples from MS-XCA section 3.1
+	var tests = []struct {
+		compressed string
+		plain      []byte
+	}{
+		{"3f000000" + hex.EncodeToString([]byte("abcdefghijklmnopqrstuvwxyz")), []byte("abcdefghijklmnopqrstuvwxyz")},
+		{"ffffff1f61626317000fff2601", bytes.Repeat([]byte("abc"), 100)},
+	}
+	for i, test := range tests {
+		b, _ := hex.DecodeString(test.compressed)
+		d, err := decompress(mstypes.CompressionFormatXPress, b, uint32(len(test.plain)))
+		if err != nil {
+			t.Fatalf("test %d: error decompressing: %v", i, err)
+		}
+		assert.Equal(t, test.plain, d, "test %d: decompressed bytes not as expected", i)
+	}
+}
+
+func TestDecompress_LZNT1(t *testing.T) {
+	t.Parallel()
+	plain := []byte("abcabcabcabc")
+	// A compressed chunk of three literals and a match of 9 bytes at offset 3, followed by an uncompressed chunk
+	b, _ := hex.DecodeString("05b008616263062002306465660000")
+	d, err := decompress(mstypes.CompressionFormatLZNT1, b, uint32(len(plain)+3))
+	if err != nil {
+		t.Fatalf("error decompressing: %v", err)
+	}
+	assert.Equal(t, append(plain, []byte("def")...), d, "decompressed bytes not as expected")
+}
+
+func TestDecompress_XPressHuff(t *testing.T) {
+	t.Parallel()
+	// Every symbol is coded in 9 bits, so a literal byte is coded as its value
+	var w huffBitWriter
+	for _, c := range []byte("abc") {
+		w.write(uint32(c), 9)
+	}
+	// A match of 15 bytes at offset 3: 2 + 1 coded in 1 bit
+	w.write(256+1<<4+(15-3), 9)
+	w.write(1, 1)
+	w.write(256, 9)
+	b := append(bytes.Repeat([]byte{0x99}, xpressHuffTableSize), w.bytes()...)
+	d, err := decompress(mstypes.CompressionFormatXPressHuff, b, 18)
+	if err != nil {
+		t.Fatalf("error decompressing: %v", err)
+	}
+	assert.Equal(t, bytes.Repeat([]byte("abc"), 6), d, "decompressed bytes not as expected")
+}
+
+func TestDecompress_Errors(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name   string
+		format uint16
+		hex    string
+		size   uint32
+	}{
+		{"XPress truncated", mstypes.CompressionFormatXPress, "000000006162", 26},
+		{"XPress offset out of range", mstypes.CompressionFormatXPress, "ffffff7f611700", 10},
+		{"XPressHuff truncated table", mstypes.CompressionFormatXPressHuff, "9999", 1},
+		{"XPressHuff invalid code lengths", mstypes.CompressionFormatXPressHuff, hex.EncodeToString(make([]byte, xpressHuffTableSize+4)), 1},
+		{"LZNT1 truncated chunk", mstypes.CompressionFormatLZNT1, "05b00861", 12},
+		{"LZNT1 size mismatch", mstypes.CompressionFormatLZNT1, "0230616263", 10},
+		{"unknown format", 9, "00", 1},
+	}
+	for _, test := range tests {
+		b, _ := hex.DecodeString(test.hex)
+		_, err := decompress(test.format, b, test.size)
+		assert.Error(t, err, test.name)
+	}
+}
+
+// huffBitWriter writes a LZ77+Huffman bit stream: 16 bit little endian words filled from the most significant bit.
+type huffBitWriter struct {
+	words []uint16
+	n     uint
+}
+
+func (w *huffBitWriter) write(v uint32, bits uint) {
+	for i := bits; i > 0; i-- {
+		if w.n%16 == 0 {
+			w.words = append(w.words, 0)
+		}
+		if v&(1<<(i-1)) != 0 {
+			w.words[len(w.words)-1] |= 1 << (15 - w.n%16)
+		}
+		w.n++
+	}
+}
+
+func (w *huffBitWriter) bytes() []byte {
+	// Pad so that the decoder's initial read of 32 bits is satisfied
+	b := make([]byte, 2*len(w.words), 2*len(w.words)+4)
+	for i, v := range w.words {
+		b[2*i] = byte(v)
+		b[2*i+1] = byte(v >> 8)
+	}
+	return append(b, 0, 0, 0, 0)
+}
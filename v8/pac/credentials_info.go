@@ -7,9 +7,9 @@ import (
 
 	"github.com/Osirium/gokrb5/v8/crypto"
 	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/ndr"
 	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/jcmturner/rpc/v2/mstypes"
-	"github.com/jcmturner/rpc/v2/ndr"
 )
 
 // https://msdn.microsoft.com/en-us/library/cc237931.aspx
@@ -77,8 +77,7 @@ type CredentialData struct {
 
 // Unmarshal converts the bytes provided into a CredentialData type.
 func (c *CredentialData) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
-	err = dec.Decode(c)
+	err = ndr.Unmarshal(b, c)
 	if err != nil {
 		err = fmt.Errorf("error unmarshaling KerbValidationInfo: %v", err)
 	}
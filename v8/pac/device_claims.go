@@ -1,11 +1,9 @@
 package pac
 
 import (
-	"bytes"
 	"fmt"
 
 	"github.com/jcmturner/rpc/v2/mstypes"
-	"github.com/jcmturner/rpc/v2/ndr"
 )
 
 // Claims reference: https://msdn.microsoft.com/en-us/library/hh553895.aspx
@@ -16,19 +14,25 @@ type DeviceClaimsInfo struct {
 	ClaimsSet         mstypes.ClaimsSet
 }
 
-// Unmarshal bytes into the ClientClaimsInfo struct
+// Unmarshal bytes into the DeviceClaimsInfo struct
 func (k *DeviceClaimsInfo) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
-	m := new(mstypes.ClaimsSetMetadata)
-	err = dec.Decode(m)
+	k.ClaimsSetMetadata, k.ClaimsSet, err = unmarshalClaims(b)
 	if err != nil {
-		err = fmt.Errorf("error unmarshaling ClientClaimsInfo ClaimsSetMetadata: %v", err)
-		return
+		err = fmt.Errorf("error unmarshaling DeviceClaimsInfo %v", err)
 	}
-	k.ClaimsSetMetadata = *m
-	k.ClaimsSet, err = k.ClaimsSetMetadata.ClaimsSet()
+	return
+}
+
+// Marshal the DeviceClaimsInfo struct into the bytes of a device claims buffer, holding its ClaimsSet uncompressed.
+func (k *DeviceClaimsInfo) Marshal() ([]byte, error) {
+	b, err := marshalClaims(&k.ClaimsSetMetadata, k.ClaimsSet)
 	if err != nil {
-		err = fmt.Errorf("error unmarshaling ClientClaimsInfo ClaimsSet: %v", err)
+		return nil, fmt.Errorf("error marshaling DeviceClaimsInfo: %v", err)
 	}
-	return
+	return b, nil
+}
+
+// Claims returns the values of the device's claims by claim ID.
+func (k *DeviceClaimsInfo) Claims() map[string][]interface{} {
+	return claimValues(k.ClaimsSet)
 }
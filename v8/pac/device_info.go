@@ -1,11 +1,10 @@
 package pac
 
 import (
-	"bytes"
 	"fmt"
 
+	"github.com/Osirium/gokrb5/v8/ndr"
 	"github.com/jcmturner/rpc/v2/mstypes"
-	"github.com/jcmturner/rpc/v2/ndr"
 )
 
 // DeviceInfo implements https://msdn.microsoft.com/en-us/library/hh536402.aspx
@@ -23,10 +22,41 @@ type DeviceInfo struct {
 
 // Unmarshal bytes into the DeviceInfo struct
 func (k *DeviceInfo) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
-	err = dec.Decode(k)
+	err = ndr.Unmarshal(b, k)
 	if err != nil {
 		err = fmt.Errorf("error unmarshaling DeviceInfo: %v", err)
 	}
 	return
 }
+
+// Marshal the DeviceInfo struct into its NDR encoding, as held in a PAC info buffer.
+func (k *DeviceInfo) Marshal() ([]byte, error) {
+	b, err := ndr.Marshal(k)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling DeviceInfo: %v", err)
+	}
+	return b, nil
+}
+
+// GetDeviceSID returns the SID of the device's account.
+func (k *DeviceInfo) GetDeviceSID() string {
+	return fmt.Sprintf("%s-%d", k.AccountDomainID.String(), k.UserID)
+}
+
+// GetGroupMembershipSIDs returns the SIDs of the groups the device is a member of, in its account domain, in other
+// domains and the extra SIDs, without duplicates.
+func (k *DeviceInfo) GetGroupMembershipSIDs() []string {
+	return sidStrings(k.GroupSIDs())
+}
+
+// GroupSIDs returns the fully qualified SIDs of the groups the device is a member of, in its account domain, in other
+// domains and the extra SIDs, without duplicates.
+func (k *DeviceInfo) GroupSIDs() []SID {
+	var l sidList
+	l.addGroups(k.AccountDomainID, k.AccountGroupIDs)
+	l.addExtraSIDs(k.ExtraSIDs)
+	for _, d := range k.DomainGroup {
+		l.addGroups(d.DomainID, d.GroupIDs)
+	}
+	return l.sids
+}
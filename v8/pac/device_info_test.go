@@ -0,0 +1,26 @@
+package pac
+
+import (
+	"testing"
+
+	"github.com/jcmturner/rpc/v2/mstypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceInfo_GetGroupMembershipSIDs(t *testing.T) {
+	t.Parallel()
+	domain := mstypes.RPCSID{Revision: 1, SubAuthorityCount: 4, IdentifierAuthority: [6]byte{0, 0, 0, 0, 0, 5}, SubAuthority: []uint32{21, 1, 2, 3}}
+	other := mstypes.RPCSID{Revision: 1, SubAuthorityCount: 4, IdentifierAuthority: [6]byte{0, 0, 0, 0, 0, 5}, SubAuthority: []uint32{21, 4, 5, 6}}
+	k := DeviceInfo{
+		UserID:          1105,
+		AccountDomainID: domain,
+		AccountGroupIDs: []mstypes.GroupMembership{{RelativeID: 515}, {RelativeID: 1110}},
+		ExtraSIDs: []mstypes.KerbSidAndAttributes{
+			{SID: mstypes.RPCSID{Revision: 1, SubAuthorityCount: 1, IdentifierAuthority: [6]byte{0, 0, 0, 0, 0, 5}, SubAuthority: []uint32{11}}},
+			{SID: mstypes.RPCSID{Revision: 1, SubAuthorityCount: 5, IdentifierAuthority: [6]byte{0, 0, 0, 0, 0, 5}, SubAuthority: []uint32{21, 1, 2, 3, 515}}},
+		},
+		DomainGroup: []mstypes.DomainGroupMembership{{DomainID: other, GroupIDs: []mstypes.GroupMembership{{RelativeID: 1120}}}},
+	}
+	assert.Equal(t, "S-1-5-21-1-2-3-1105", k.GetDeviceSID(), "device SID not as expected")
+	assert.Equal(t, []string{"S-1-5-21-1-2-3-515", "S-1-5-21-1-2-3-1110", "S-1-5-11", "S-1-5-21-4-5-6-1120"}, k.GetGroupMembershipSIDs(), "group SIDs not as expected")
+}
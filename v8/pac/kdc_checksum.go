@@ -0,0 +1,87 @@
+package pac
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+/*
+The KDC signature and ticket signature of a PAC are made with the key of the KDC's krbtgt account, which services do
+not hold. Verifying them protects a service against a PAC forged by the holder of the service's key, so requires a
+trusted party: a service with access to the krbtgt key, such as one running on the KDC, or the domain controller itself
+via the MS-PAC validation of the Netlogon RPC interface (NetrLogonSamLogonEx with a PAC validation logon).
+
+KDC Signature: https://msdn.microsoft.com/en-us/library/dd357117.aspx
+Ticket Signature (SignatureType = 0x00000010): https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-pac/76c10ef5-bcc4-4b6b-8c4d-4f4ba5d5b1b9
+*/
+
+// KDCChecksumVerifier verifies the checksums of a PAC made with the KDC's key.
+type KDCChecksumVerifier interface {
+	// VerifyKDCChecksum verifies the signature made by the KDC over the data provided, returning an error if it is not
+	// valid.
+	VerifyKDCChecksum(data []byte, sig SignatureData) error
+}
+
+// KDCChecksumVerifierFunc is a function implementing KDCChecksumVerifier, such as one sending the checksum to a
+// domain controller for validation.
+type KDCChecksumVerifierFunc func(data []byte, sig SignatureData) error
+
+// VerifyKDCChecksum calls the function to verify the signature over the data.
+func (f KDCChecksumVerifierFunc) VerifyKDCChecksum(data []byte, sig SignatureData) error {
+	return f(data, sig)
+}
+
+// kdcKeyVerifier verifies KDC checksums with the KDC's key.
+type kdcKeyVerifier struct {
+	key types.EncryptionKey
+}
+
+// NewKDCKeyVerifier returns a KDCChecksumVerifier verifying checksums with the key of the KDC's krbtgt account, for
+// services trusted with it.
+func NewKDCKeyVerifier(key types.EncryptionKey) KDCChecksumVerifier {
+	return kdcKeyVerifier{key: key}
+}
+
+// VerifyKDCChecksum verifies the signature over the data with the KDC's key.
+func (v kdcKeyVerifier) VerifyKDCChecksum(data []byte, sig SignatureData) error {
+	etype, err := crypto.GetChksumEtype(int32(sig.SignatureType))
+	if err != nil {
+		return err
+	}
+	if !etype.VerifyChecksum(v.key.KeyValue, data, sig.Signature, keyusage.KERB_NON_KERB_CKSUM_SALT) {
+		return errors.New("checksum does not match")
+	}
+	return nil
+}
+
+// VerifyKDCChecksum verifies the KDC signature of the PAC, made over its server signature, with the verifier provided.
+// The PAC's info buffers must have been processed.
+func (pac *PACType) VerifyKDCChecksum(v KDCChecksumVerifier) error {
+	if pac.ServerChecksum == nil {
+		return errors.New("PAC Info Buffers does not contain a ServerChecksum")
+	}
+	if pac.KDCChecksum == nil {
+		return errors.New("PAC Info Buffers does not contain a KDCChecksum")
+	}
+	if err := v.VerifyKDCChecksum(pac.ServerChecksum.Signature, *pac.KDCChecksum); err != nil {
+		return fmt.Errorf("PAC KDC checksum verification failed: %v", err)
+	}
+	return nil
+}
+
+// VerifyTicketChecksum verifies the ticket signature of the PAC with the verifier provided. encTicketPart is the
+// encoded EncTicketPart of the ticket holding the PAC, with the PAC replaced by a single zero byte, which the signature
+// is made over. The PAC's info buffers must have been processed.
+func (pac *PACType) VerifyTicketChecksum(v KDCChecksumVerifier, encTicketPart []byte) error {
+	if pac.TicketChecksum == nil {
+		return errors.New("PAC Info Buffers does not contain a TicketChecksum")
+	}
+	if err := v.VerifyKDCChecksum(encTicketPart, *pac.TicketChecksum); err != nil {
+		return fmt.Errorf("PAC ticket checksum verification failed: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package pac
+
+import (
+	"bytes"
+	"encoding/hex"
+	"log"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/chksumtype"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/keyusage"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// testProcessedPAC returns the reference PAC with its info buffers processed.
+func testProcessedPAC(t *testing.T) PACType {
+	b, err := hex.DecodeString(testdata.MarshaledPAC_AD_WIN2K_PAC)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	var pac PACType
+	err = pac.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	b, _ = hex.DecodeString(testdata.KEYTAB_SYSHTTP_TEST_GOKRB5)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	pn, _ := types.ParseSPNString("sysHTTP")
+	key, _, err := kt.GetEncryptionKey(pn, "TEST.GOKRB5", 2, 18)
+	if err != nil {
+		t.Fatalf("Error getting key: %v", err)
+	}
+	err = pac.ProcessPACInfoBuffers(key, log.New(bytes.NewBufferString(""), "", 0))
+	if err != nil {
+		t.Fatalf("Processing reference pac error: %v", err)
+	}
+	return pac
+}
+
+// testKDCSignature returns the signature over the data with the key provided.
+func testKDCSignature(t *testing.T, key types.EncryptionKey, data []byte) SignatureData {
+	etype, err := crypto.GetChksumEtype(chksumtype.HMAC_SHA1_96_AES256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cksum, err := etype.GetChecksumHash(key.KeyValue, data, keyusage.KERB_NON_KERB_CKSUM_SALT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return SignatureData{SignatureType: uint32(chksumtype.HMAC_SHA1_96_AES256), Signature: cksum}
+}
+
+func TestPACType_VerifyKDCChecksum(t *testing.T) {
+	t.Parallel()
+	pac := testProcessedPAC(t)
+	etype, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	krbtgtKey, _ := types.GenerateEncryptionKey(etype)
+	otherKey, _ := types.GenerateEncryptionKey(etype)
+
+	// The reference PAC's KDC signature is made with a krbtgt key not held
+	err := pac.VerifyKDCChecksum(NewKDCKeyVerifier(krbtgtKey))
+	assert.Error(t, err, "KDC checksum made with another key should not verify")
+
+	sig := testKDCSignature(t, krbtgtKey, pac.ServerChecksum.Signature)
+	pac.KDCChecksum = &sig
+	err = pac.VerifyKDCChecksum(NewKDCKeyVerifier(krbtgtKey))
+	assert.NoError(t, err, "KDC checksum should verify with the krbtgt key")
+	err = pac.VerifyKDCChecksum(NewKDCKeyVerifier(otherKey))
+	assert.Error(t, err, "KDC checksum should not verify with another key")
+
+	var data []byte
+	err = pac.VerifyKDCChecksum(KDCChecksumVerifierFunc(func(d []byte, s SignatureData) error {
+		data = d
+		return nil
+	}))
+	assert.NoError(t, err, "KDC checksum should verify with the verifier function")
+	assert.Equal(t, pac.ServerChecksum.Signature, data, "KDC checksum should be verified over the server signature")
+
+	pac.KDCChecksum = nil
+	err = pac.VerifyKDCChecksum(NewKDCKeyVerifier(krbtgtKey))
+	assert.Error(t, err, "PAC without a KDC checksum should not verify")
+}
+
+func TestPACType_VerifyTicketChecksum(t *testing.T) {
+	t.Parallel()
+	pac := testProcessedPAC(t)
+	etype, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	krbtgtKey, _ := types.GenerateEncryptionKey(etype)
+	encTicketPart := []byte("encoded EncTicketPart")
+
+	err := pac.VerifyTicketChecksum(NewKDCKeyVerifier(krbtgtKey), encTicketPart)
+	assert.Error(t, err, "PAC without a ticket checksum should not verify")
+
+	sig := testKDCSignature(t, krbtgtKey, encTicketPart)
+	pac.TicketChecksum = &sig
+	err = pac.VerifyTicketChecksum(NewKDCKeyVerifier(krbtgtKey), encTicketPart)
+	assert.NoError(t, err, "ticket checksum should verify with the krbtgt key")
+	err = pac.VerifyTicketChecksum(NewKDCKeyVerifier(krbtgtKey), []byte("another EncTicketPart"))
+	assert.Error(t, err, "ticket checksum should not verify over other data")
+}
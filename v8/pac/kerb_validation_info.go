@@ -2,11 +2,10 @@
 package pac
 
 import (
-	"bytes"
 	"fmt"
 
+	"github.com/Osirium/gokrb5/v8/ndr"
 	"github.com/jcmturner/rpc/v2/mstypes"
-	"github.com/jcmturner/rpc/v2/ndr"
 )
 
 // KERB_VALIDATION_INFO flags.
@@ -66,45 +65,38 @@ type KerbValidationInfo struct {
 
 // Unmarshal bytes into the DeviceInfo struct
 func (k *KerbValidationInfo) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
-	err = dec.Decode(k)
+	err = ndr.Unmarshal(b, k)
 	if err != nil {
 		err = fmt.Errorf("error unmarshaling KerbValidationInfo: %v", err)
 	}
 	return
 }
 
+// Marshal the KerbValidationInfo struct into its NDR encoding, as held in a PAC info buffer.
+func (k *KerbValidationInfo) Marshal() ([]byte, error) {
+	b, err := ndr.Marshal(k)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling KerbValidationInfo: %v", err)
+	}
+	return b, nil
+}
+
 // GetGroupMembershipSIDs returns a slice of strings containing the group membership SIDs found in the PAC.
 func (k *KerbValidationInfo) GetGroupMembershipSIDs() []string {
-	var g []string
-	lSID := k.LogonDomainID.String()
-	for i := range k.GroupIDs {
-		g = append(g, fmt.Sprintf("%s-%d", lSID, k.GroupIDs[i].RelativeID))
-	}
-	for _, s := range k.ExtraSIDs {
-		var exists = false
-		for _, es := range g {
-			if es == s.SID.String() {
-				exists = true
-				break
-			}
-		}
-		if !exists {
-			g = append(g, s.SID.String())
-		}
-	}
-	for _, r := range k.ResourceGroupIDs {
-		var exists = false
-		s := fmt.Sprintf("%s-%d", k.ResourceGroupDomainSID.String(), r.RelativeID)
-		for _, es := range g {
-			if es == s {
-				exists = true
-				break
-			}
-		}
-		if !exists {
-			g = append(g, s)
-		}
-	}
-	return g
+	return sidStrings(k.GroupSIDs())
+}
+
+// UserSID returns the SID of the user, the user's RID within the logon domain.
+func (k *KerbValidationInfo) UserSID() SID {
+	return SIDFromRPCSID(k.LogonDomainID).WithRID(k.UserID)
+}
+
+// GroupSIDs returns the fully qualified SIDs of the groups the user is a member of, without duplicates: the groups of
+// the logon domain, the extra SIDs and the resource groups of the resource domain.
+func (k *KerbValidationInfo) GroupSIDs() []SID {
+	var l sidList
+	l.addGroups(k.LogonDomainID, k.GroupIDs)
+	l.addExtraSIDs(k.ExtraSIDs)
+	l.addGroups(k.ResourceGroupDomainSID, k.ResourceGroupIDs)
+	return l.sids
 }
@@ -266,3 +266,28 @@ func TestKerbValidationInfo_Unmarshal_DomainTrust(t *testing.T) {
 		"S-1-5-21-3062750306-1230139592-1973306805-1108"}
 	assert.Equal(t, groupSids, k.GetGroupMembershipSIDs(), "GroupMembershipSIDs not as expected")
 }
+
+func TestKerbValidationInfo_Marshal(t *testing.T) {
+	t.Parallel()
+	var tests = []string{
+		testdata.MarshaledPAC_Kerb_Validation_Info_MS,
+		testdata.MarshaledPAC_Kerb_Validation_Info,
+		testdata.MarshaledPAC_Kerb_Validation_Info_Trust,
+	}
+	for i, test := range tests {
+		b, err := hex.DecodeString(test)
+		if err != nil {
+			t.Fatalf("test %d: could not decode test data hex string", i)
+		}
+		var k KerbValidationInfo
+		err = k.Unmarshal(b)
+		if err != nil {
+			t.Fatalf("test %d: error unmarshaling KerbValidationInfo: %v", i, err)
+		}
+		mb, err := k.Marshal()
+		if err != nil {
+			t.Fatalf("test %d: error marshaling KerbValidationInfo: %v", i, err)
+		}
+		assert.Equal(t, test, hex.EncodeToString(mb), "test %d: KerbValidationInfo not marshaled as unmarshaled", i)
+	}
+}
@@ -23,6 +23,7 @@ const (
 	infoTypePACClientClaimsInfo    uint32 = 13
 	infoTypePACDeviceInfo          uint32 = 14
 	infoTypePACDeviceClaimsInfo    uint32 = 15
+	infoTypePACTicketChecksum      uint32 = 16
 )
 
 // PACType implements: https://msdn.microsoft.com/en-us/library/cc237950.aspx
@@ -41,6 +42,7 @@ type PACType struct {
 	ClientClaimsInfo   *ClientClaimsInfo
 	DeviceInfo         *DeviceInfo
 	DeviceClaimsInfo   *DeviceClaimsInfo
+	TicketChecksum     *SignatureData
 	ZeroSigData        []byte
 }
 
@@ -213,6 +215,18 @@ func (pac *PACType) ProcessPACInfoBuffers(key types.EncryptionKey, l *log.Logger
 				continue
 			}
 			pac.DeviceClaimsInfo = &k
+		case infoTypePACTicketChecksum:
+			if pac.TicketChecksum != nil {
+				//Must ignore subsequent buffers of this type
+				continue
+			}
+			// The ticket signature is not zeroed for the server signature, which is made over it
+			var k SignatureData
+			_, err := k.Unmarshal(p)
+			if err != nil {
+				return fmt.Errorf("error processing TicketChecksum: %v", err)
+			}
+			pac.TicketChecksum = &k
 		}
 	}
 
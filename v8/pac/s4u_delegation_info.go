@@ -1,11 +1,10 @@
 package pac
 
 import (
-	"bytes"
 	"fmt"
 
+	"github.com/Osirium/gokrb5/v8/ndr"
 	"github.com/jcmturner/rpc/v2/mstypes"
-	"github.com/jcmturner/rpc/v2/ndr"
 )
 
 // S4UDelegationInfo implements https://msdn.microsoft.com/en-us/library/cc237944.aspx
@@ -17,10 +16,27 @@ type S4UDelegationInfo struct {
 
 // Unmarshal bytes into the S4UDelegationInfo struct
 func (k *S4UDelegationInfo) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
-	err = dec.Decode(k)
+	err = ndr.Unmarshal(b, k)
 	if err != nil {
 		err = fmt.Errorf("error unmarshaling S4UDelegationInfo: %v", err)
 	}
 	return
 }
+
+// Marshal the S4UDelegationInfo struct into its NDR encoding, as held in a PAC info buffer.
+func (k *S4UDelegationInfo) Marshal() ([]byte, error) {
+	b, err := ndr.Marshal(k)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling S4UDelegationInfo: %v", err)
+	}
+	return b, nil
+}
+
+// TransitedServices returns the names of the services the client's ticket has been delegated through.
+func (k *S4UDelegationInfo) TransitedServices() []string {
+	var s []string
+	for _, t := range k.S4UTransitedServices {
+		s = append(s, t.Value)
+	}
+	return s
+}
@@ -0,0 +1,35 @@
+package pac
+
+import (
+	"testing"
+
+	"github.com/jcmturner/rpc/v2/mstypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestS4UDelegationInfo_Unmarshal(t *testing.T) {
+	t.Parallel()
+	k := S4UDelegationInfo{
+		S4U2proxyTarget:   mstypes.RPCUnicodeString{Value: "HTTP/backend.test.gokrb5"},
+		TransitedListSize: 2,
+		S4UTransitedServices: []mstypes.RPCUnicodeString{
+			{Value: "HTTP/frontend.test.gokrb5@TEST.GOKRB5"},
+			{Value: "HTTP/middle.test.gokrb5@TEST.GOKRB5"},
+		},
+	}
+	b, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling S4UDelegationInfo: %v", err)
+	}
+	var u S4UDelegationInfo
+	err = u.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling S4UDelegationInfo: %v", err)
+	}
+	assert.Equal(t, "HTTP/backend.test.gokrb5", u.S4U2proxyTarget.Value, "S4U2proxy target not as expected")
+	assert.Equal(t, uint32(2), u.TransitedListSize, "transited list size not as expected")
+	assert.Equal(t, []string{"HTTP/frontend.test.gokrb5@TEST.GOKRB5", "HTTP/middle.test.gokrb5@TEST.GOKRB5"}, u.TransitedServices(), "transited services not as expected")
+
+	err = u.Unmarshal(b[:len(b)-16])
+	assert.Error(t, err, "truncated S4UDelegationInfo not rejected")
+}
@@ -0,0 +1,225 @@
+package pac
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jcmturner/rpc/v2/mstypes"
+)
+
+// SID reference: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-dtyp/78eb9013-1c3a-4970-ad1f-2b1dad588a25
+
+// Well-known SIDs, MS-DTYP section 2.4.2.4.
+const (
+	SIDNull                                    = "S-1-0-0"
+	SIDEveryone                                = "S-1-1-0"
+	SIDNetwork                                 = "S-1-5-2"
+	SIDBatch                                   = "S-1-5-3"
+	SIDInteractive                             = "S-1-5-4"
+	SIDService                                 = "S-1-5-6"
+	SIDAnonymous                               = "S-1-5-7"
+	SIDEnterpriseDomainControllers             = "S-1-5-9"
+	SIDAuthenticatedUsers                      = "S-1-5-11"
+	SIDThisOrganization                        = "S-1-5-15"
+	SIDLocalSystem                             = "S-1-5-18"
+	SIDOtherOrganization                       = "S-1-5-1000"
+	SIDBuiltinAdministrators                   = "S-1-5-32-544"
+	SIDBuiltinUsers                            = "S-1-5-32-545"
+	SIDBuiltinGuests                           = "S-1-5-32-546"
+	SIDAuthenticationAuthorityAssertedIdentity = "S-1-18-1"
+	SIDServiceAssertedIdentity                 = "S-1-18-2"
+	SIDCompoundedAuthentication                = "S-1-5-21-0-0-0-496"
+	SIDClaimsValid                             = "S-1-5-21-0-0-0-497"
+)
+
+// Well-known relative IDs of the accounts and groups of a domain, MS-DTYP section 2.4.2.4.
+const (
+	RIDAdministrator             uint32 = 500
+	RIDGuest                     uint32 = 501
+	RIDKrbtgt                    uint32 = 502
+	RIDDomainAdmins              uint32 = 512
+	RIDDomainUsers               uint32 = 513
+	RIDDomainGuests              uint32 = 514
+	RIDDomainComputers           uint32 = 515
+	RIDDomainControllers         uint32 = 516
+	RIDCertPublishers            uint32 = 517
+	RIDSchemaAdmins              uint32 = 518
+	RIDEnterpriseAdmins          uint32 = 519
+	RIDGroupPolicyCreatorOwners  uint32 = 520
+	RIDReadOnlyDomainControllers uint32 = 521
+	RIDProtectedUsers            uint32 = 525
+)
+
+// sidMaxSubAuthorities is the maximum number of sub-authorities of a SID.
+const sidMaxSubAuthorities = 15
+
+// SID is a security identifier, MS-DTYP section 2.4.2.
+type SID struct {
+	Revision            uint8
+	IdentifierAuthority uint64 // The 48 bit authority under which the SID was created, 5 for the NT authority.
+	SubAuthority        []uint32
+}
+
+// ParseSID parses the string representation of a SID, such as S-1-5-21-3623811015-3361044348-30300820-1013.
+func ParseSID(s string) (SID, error) {
+	var sid SID
+	parts := strings.Split(s, "-")
+	if len(parts) < 3 || !strings.EqualFold(parts[0], "S") {
+		return sid, fmt.Errorf("%q is not a SID", s)
+	}
+	r, err := strconv.ParseUint(parts[1], 10, 8)
+	if err != nil || r != 1 {
+		return sid, fmt.Errorf("SID %q revision not supported", s)
+	}
+	sid.Revision = uint8(r)
+	// An authority of 2^32 or more is formatted as 12 hexadecimal digits
+	if strings.HasPrefix(strings.ToLower(parts[2]), "0x") {
+		sid.IdentifierAuthority, err = strconv.ParseUint(parts[2][2:], 16, 48)
+	} else {
+		sid.IdentifierAuthority, err = strconv.ParseUint(parts[2], 10, 48)
+	}
+	if err != nil {
+		return sid, fmt.Errorf("SID %q identifier authority not valid: %v", s, err)
+	}
+	if len(parts)-3 > sidMaxSubAuthorities {
+		return sid, fmt.Errorf("SID %q has more than %d sub-authorities", s, sidMaxSubAuthorities)
+	}
+	for _, p := range parts[3:] {
+		a, err := strconv.ParseUint(p, 10, 32)
+		if err != nil {
+			return sid, fmt.Errorf("SID %q sub-authority not valid: %v", s, err)
+		}
+		sid.SubAuthority = append(sid.SubAuthority, uint32(a))
+	}
+	return sid, nil
+}
+
+// SIDFromRPCSID returns the SID of an RPC_SID, as held in the PAC.
+func SIDFromRPCSID(r mstypes.RPCSID) SID {
+	b := append(make([]byte, 2), r.IdentifierAuthority[:]...)
+	return SID{
+		Revision:            r.Revision,
+		IdentifierAuthority: binary.BigEndian.Uint64(b),
+		SubAuthority:        append([]uint32(nil), r.SubAuthority...),
+	}
+}
+
+// RPCSID returns the SID as an RPC_SID.
+func (s SID) RPCSID() mstypes.RPCSID {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], s.IdentifierAuthority)
+	r := mstypes.RPCSID{
+		Revision:          s.Revision,
+		SubAuthorityCount: uint8(len(s.SubAuthority)),
+		SubAuthority:      append([]uint32(nil), s.SubAuthority...),
+	}
+	copy(r.IdentifierAuthority[:], b[2:])
+	return r
+}
+
+// String returns the string representation of the SID, S-1- followed by its identifier authority and sub-authorities.
+func (s SID) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "S-%d-", s.Revision)
+	if s.IdentifierAuthority > 0xFFFFFFFF {
+		fmt.Fprintf(&b, "0x%012x", s.IdentifierAuthority)
+	} else {
+		fmt.Fprintf(&b, "%d", s.IdentifierAuthority)
+	}
+	for _, a := range s.SubAuthority {
+		fmt.Fprintf(&b, "-%d", a)
+	}
+	return b.String()
+}
+
+// Equal indicates if the SIDs are the same.
+func (s SID) Equal(o SID) bool {
+	if s.Revision != o.Revision || s.IdentifierAuthority != o.IdentifierAuthority || len(s.SubAuthority) != len(o.SubAuthority) {
+		return false
+	}
+	for i := range s.SubAuthority {
+		if s.SubAuthority[i] != o.SubAuthority[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// WithRID returns the SID of the account or group of the relative ID provided within the domain of the SID.
+func (s SID) WithRID(rid uint32) SID {
+	sa := make([]uint32, len(s.SubAuthority), len(s.SubAuthority)+1)
+	copy(sa, s.SubAuthority)
+	return SID{
+		Revision:            s.Revision,
+		IdentifierAuthority: s.IdentifierAuthority,
+		SubAuthority:        append(sa, rid),
+	}
+}
+
+// RID returns the relative ID of the SID, its last sub-authority, and the SID of its domain.
+func (s SID) RID() (uint32, SID, error) {
+	if len(s.SubAuthority) < 1 {
+		return 0, SID{}, errors.New("SID has no sub-authorities")
+	}
+	n := len(s.SubAuthority) - 1
+	return s.SubAuthority[n], SID{
+		Revision:            s.Revision,
+		IdentifierAuthority: s.IdentifierAuthority,
+		SubAuthority:        append([]uint32(nil), s.SubAuthority[:n]...),
+	}, nil
+}
+
+// ContainsSID indicates if the list of SIDs contains the SID provided.
+func ContainsSID(sids []SID, sid SID) bool {
+	for _, s := range sids {
+		if s.Equal(sid) {
+			return true
+		}
+	}
+	return false
+}
+
+// sidList accumulates SIDs, omitting duplicates.
+type sidList struct {
+	sids []SID
+	seen map[string]bool
+}
+
+// add appends the SID to the list if it is not already in it.
+func (l *sidList) add(s SID) {
+	if l.seen == nil {
+		l.seen = make(map[string]bool)
+	}
+	k := s.String()
+	if !l.seen[k] {
+		l.seen[k] = true
+		l.sids = append(l.sids, s)
+	}
+}
+
+// addGroups appends the SIDs of the groups of the domain provided.
+func (l *sidList) addGroups(domain mstypes.RPCSID, groups []mstypes.GroupMembership) {
+	d := SIDFromRPCSID(domain)
+	for _, g := range groups {
+		l.add(d.WithRID(g.RelativeID))
+	}
+}
+
+// addExtraSIDs appends the SIDs of the extra SIDs.
+func (l *sidList) addExtraSIDs(extra []mstypes.KerbSidAndAttributes) {
+	for _, s := range extra {
+		l.add(SIDFromRPCSID(s.SID))
+	}
+}
+
+// sidStrings returns the string representations of the SIDs.
+func sidStrings(sids []SID) []string {
+	var s []string
+	for _, sid := range sids {
+		s = append(s, sid.String())
+	}
+	return s
+}
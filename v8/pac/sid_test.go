@@ -0,0 +1,88 @@
+package pac
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/jcmturner/rpc/v2/mstypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSID(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		s   string
+		sid SID
+	}{
+		{"S-1-5-21-3623811015-3361044348-30300820-1013", SID{Revision: 1, IdentifierAuthority: 5, SubAuthority: []uint32{21, 3623811015, 3361044348, 30300820, 1013}}},
+		{SIDEveryone, SID{Revision: 1, IdentifierAuthority: 1, SubAuthority: []uint32{0}}},
+		{"S-1-5", SID{Revision: 1, IdentifierAuthority: 5}},
+		{"S-1-0x00ffffffffff-1", SID{Revision: 1, IdentifierAuthority: 0xffffffffff, SubAuthority: []uint32{1}}},
+	}
+	for _, test := range tests {
+		sid, err := ParseSID(test.s)
+		if err != nil {
+			t.Fatalf("error parsing %s: %v", test.s, err)
+		}
+		assert.Equal(t, test.sid, sid, "SID of %s not as expected", test.s)
+		assert.Equal(t, test.s, sid.String(), "string of SID not as expected")
+	}
+	for _, s := range []string{"", "S-1", "X-1-5-21", "S-2-5-21", "S-1-5-21-4294967296", "S-1-5-a", "S-1-5-1-2-3-4-5-6-7-8-9-10-11-12-13-14-15-16"} {
+		_, err := ParseSID(s)
+		assert.Error(t, err, "parsing %q should error", s)
+	}
+}
+
+func TestSID_RPCSID(t *testing.T) {
+	t.Parallel()
+	r := mstypes.RPCSID{Revision: 1, SubAuthorityCount: 4, IdentifierAuthority: [6]byte{0, 0, 0, 0, 0, 5}, SubAuthority: []uint32{21, 1, 2, 3}}
+	sid := SIDFromRPCSID(r)
+	assert.Equal(t, r.String(), sid.String(), "SID not as expected")
+	assert.Equal(t, r, sid.RPCSID(), "RPC_SID not as expected")
+}
+
+func TestSID_RID(t *testing.T) {
+	t.Parallel()
+	domain, err := ParseSID("S-1-5-21-1-2-3")
+	if err != nil {
+		t.Fatalf("error parsing SID: %v", err)
+	}
+	sid := domain.WithRID(RIDDomainAdmins)
+	assert.Equal(t, "S-1-5-21-1-2-3-512", sid.String(), "SID not as expected")
+	assert.Equal(t, "S-1-5-21-1-2-3", domain.String(), "domain SID modified")
+	rid, d, err := sid.RID()
+	if err != nil {
+		t.Fatalf("error getting RID: %v", err)
+	}
+	assert.Equal(t, RIDDomainAdmins, rid, "RID not as expected")
+	assert.True(t, d.Equal(domain), "domain SID not as expected")
+	assert.False(t, sid.Equal(domain), "SIDs of different lengths should not be equal")
+	_, _, err = SID{Revision: 1, IdentifierAuthority: 5}.RID()
+	assert.Error(t, err, "SID without sub-authorities should not have a RID")
+}
+
+func TestKerbValidationInfo_GroupSIDs(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_Kerb_Validation_Info_Trust)
+	if err != nil {
+		t.Fatal("Could not decode test data hex string")
+	}
+	var k KerbValidationInfo
+	err = k.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling KerbValidationInfo: %v", err)
+	}
+	sids := k.GroupSIDs()
+	assert.Equal(t, k.GetGroupMembershipSIDs(), sidStrings(sids), "group SIDs not as expected")
+	assert.Equal(t, "S-1-5-21-2284869408-3503417140-1141177250-1106", k.UserSID().String(), "user SID not as expected")
+
+	users, _ := ParseSID("S-1-5-21-2284869408-3503417140-1141177250-513")
+	assert.True(t, ContainsSID(sids, users), "domain users group SID not found")
+	extra, _ := ParseSID(SIDAuthenticationAuthorityAssertedIdentity)
+	assert.True(t, ContainsSID(sids, extra), "extra SID not found")
+	resource, _ := ParseSID("S-1-5-21-3062750306-1230139592-1973306805-1107")
+	assert.True(t, ContainsSID(sids, resource), "resource group SID not found")
+	other, _ := ParseSID("S-1-5-21-1-2-3-513")
+	assert.False(t, ContainsSID(sids, other), "SID of another domain found")
+}
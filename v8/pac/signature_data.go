@@ -2,6 +2,7 @@ package pac
 
 import (
 	"bytes"
+	"encoding/binary"
 
 	"github.com/Osirium/gokrb5/v8/iana/chksumtype"
 	"github.com/jcmturner/rpc/v2/mstypes"
@@ -35,15 +36,7 @@ func (k *SignatureData) Unmarshal(b []byte) (rb []byte, err error) {
 		return
 	}
 
-	var c int
-	switch k.SignatureType {
-	case chksumtype.KERB_CHECKSUM_HMAC_MD5_UNSIGNED:
-		c = 16
-	case uint32(chksumtype.HMAC_SHA1_96_AES128):
-		c = 12
-	case uint32(chksumtype.HMAC_SHA1_96_AES256):
-		c = 12
-	}
+	c := signatureSize(k.SignatureType)
 	k.Signature, err = r.ReadBytes(c)
 	if err != nil {
 		return
@@ -65,3 +58,28 @@ func (k *SignatureData) Unmarshal(b []byte) (rb []byte, err error) {
 
 	return
 }
+
+// Marshal the SignatureData struct into the bytes of a signature buffer.
+func (k *SignatureData) Marshal() []byte {
+	b := make([]byte, 4, 4+len(k.Signature)+2)
+	binary.LittleEndian.PutUint32(b, k.SignatureType)
+	b = append(b, k.Signature...)
+	if k.RODCIdentifier != 0 {
+		b = append(b, byte(k.RODCIdentifier), byte(k.RODCIdentifier>>8))
+	}
+	return b
+}
+
+// signatureSize returns the size, in bytes, of the signatures of the checksum type, 0 if it is not one of those PAC
+// signatures may be made with.
+func signatureSize(signatureType uint32) int {
+	switch signatureType {
+	case chksumtype.KERB_CHECKSUM_HMAC_MD5_UNSIGNED:
+		return 16
+	case uint32(chksumtype.HMAC_SHA1_96_AES128):
+		return 12
+	case uint32(chksumtype.HMAC_SHA1_96_AES256):
+		return 12
+	}
+	return 0
+}
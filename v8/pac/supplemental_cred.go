@@ -6,8 +6,8 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/Osirium/gokrb5/v8/ndr"
 	"github.com/jcmturner/rpc/v2/mstypes"
-	"github.com/jcmturner/rpc/v2/ndr"
 )
 
 const (
@@ -78,8 +78,7 @@ type SECPKGSupplementalCred struct {
 
 // Unmarshal converts the bytes provided into a SECPKGSupplementalCred.
 func (c *SECPKGSupplementalCred) Unmarshal(b []byte) (err error) {
-	dec := ndr.NewDecoder(bytes.NewReader(b))
-	err = dec.Decode(c)
+	err = ndr.Unmarshal(b, c)
 	if err != nil {
 		err = fmt.Errorf("error unmarshaling SECPKGSupplementalCred: %v", err)
 	}
@@ -2,6 +2,11 @@ package pac
 
 import (
 	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unicode/utf16"
 
 	"github.com/jcmturner/rpc/v2/mstypes"
 )
@@ -13,12 +18,21 @@ type UPNDNSInfo struct {
 	DNSDomainNameLength uint16
 	DNSDomainNameOffset uint16
 	Flags               uint32
+	SamNameLength       uint16 // Present if the UPNDNSFlagExtended flag is set.
+	SamNameOffset       uint16 // Present if the UPNDNSFlagExtended flag is set.
+	SIDLength           uint16 // Present if the UPNDNSFlagExtended flag is set.
+	SIDOffset           uint16 // Present if the UPNDNSFlagExtended flag is set.
 	UPN                 string
 	DNSDomain           string
+	SamName             string         // The sAMAccountName of the user, if the UPNDNSFlagExtended flag is set.
+	SID                 mstypes.RPCSID // The SID of the user, if the UPNDNSFlagExtended flag is set.
 }
 
 const (
-	upnNoUPNAttr = 31 // The user account object does not have the userPrincipalName attribute ([MS-ADA3] section 2.349) set. A UPN constructed by concatenating the user name with the DNS domain name of the account domain is provided.
+	// UPNDNSFlagNoUPN is set if the user account object does not have the userPrincipalName attribute ([MS-ADA3] section 2.349) set. A UPN constructed by concatenating the user name with the DNS domain name of the account domain is provided.
+	UPNDNSFlagNoUPN uint32 = 0x00000001
+	// UPNDNSFlagExtended is set if the structure has been extended with the user account's SAM name and SID.
+	UPNDNSFlagExtended uint32 = 0x00000002
 )
 
 // Unmarshal bytes into the UPN_DNSInfo struct
@@ -45,29 +59,144 @@ func (k *UPNDNSInfo) Unmarshal(b []byte) (err error) {
 	if err != nil {
 		return
 	}
-	ub := mstypes.NewReader(bytes.NewReader(b[k.UPNOffset : k.UPNOffset+k.UPNLength]))
-	db := mstypes.NewReader(bytes.NewReader(b[k.DNSDomainNameOffset : k.DNSDomainNameOffset+k.DNSDomainNameLength]))
+	if k.Flags&UPNDNSFlagExtended != 0 {
+		for _, f := range []*uint16{&k.SamNameLength, &k.SamNameOffset, &k.SIDLength, &k.SIDOffset} {
+			*f, err = r.Uint16()
+			if err != nil {
+				return
+			}
+		}
+	}
 
-	u := make([]rune, k.UPNLength/2, k.UPNLength/2)
-	for i := 0; i < len(u); i++ {
-		var r uint16
-		r, err = ub.Uint16()
+	k.UPN, err = utf16Field(b, k.UPNOffset, k.UPNLength)
+	if err != nil {
+		return fmt.Errorf("error reading UPN: %v", err)
+	}
+	k.DNSDomain, err = utf16Field(b, k.DNSDomainNameOffset, k.DNSDomainNameLength)
+	if err != nil {
+		return fmt.Errorf("error reading DNS domain name: %v", err)
+	}
+	if k.Flags&UPNDNSFlagExtended != 0 {
+		k.SamName, err = utf16Field(b, k.SamNameOffset, k.SamNameLength)
 		if err != nil {
-			return
+			return fmt.Errorf("error reading SAM name: %v", err)
 		}
-		u[i] = rune(r)
-	}
-	k.UPN = string(u)
-	d := make([]rune, k.DNSDomainNameLength/2, k.DNSDomainNameLength/2)
-	for i := 0; i < len(d); i++ {
-		var r uint16
-		r, err = db.Uint16()
+		sb, e := field(b, k.SIDOffset, k.SIDLength)
+		if e != nil {
+			return fmt.Errorf("error reading SID: %v", e)
+		}
+		k.SID, err = sidFromBytes(sb)
 		if err != nil {
-			return
+			return fmt.Errorf("error reading SID: %v", err)
 		}
-		d[i] = rune(r)
 	}
-	k.DNSDomain = string(d)
+	return
+}
+
+// Marshal the UPNDNSInfo struct into the bytes of a UPN_DNS_INFO buffer, setting the lengths and offsets of the
+// fields from their values. The SAM name and SID are included if the UPNDNSFlagExtended flag is set.
+func (k *UPNDNSInfo) Marshal() ([]byte, error) {
+	fields := [][]byte{utf16Bytes(k.UPN), utf16Bytes(k.DNSDomain)}
+	header := 12
+	if k.Flags&UPNDNSFlagExtended != 0 {
+		fields = append(fields, utf16Bytes(k.SamName), sidBytes(k.SID))
+		header = 20
+	}
+	// Each field is aligned to 8 bytes, as is the end of the buffer, as Windows lays them out
+	var offsets []int
+	n := header
+	for _, f := range fields {
+		n = (n + 7) &^ 7
+		offsets = append(offsets, n)
+		n += len(f)
+		if n > math.MaxUint16 {
+			return nil, errors.New("UPN_DNS_INFO fields too long")
+		}
+	}
+	k.UPNLength, k.UPNOffset = uint16(len(fields[0])), uint16(offsets[0])
+	k.DNSDomainNameLength, k.DNSDomainNameOffset = uint16(len(fields[1])), uint16(offsets[1])
+	if k.Flags&UPNDNSFlagExtended != 0 {
+		k.SamNameLength, k.SamNameOffset = uint16(len(fields[2])), uint16(offsets[2])
+		k.SIDLength, k.SIDOffset = uint16(len(fields[3])), uint16(offsets[3])
+	}
+
+	b := make([]byte, (n+7)&^7)
+	binary.LittleEndian.PutUint16(b, k.UPNLength)
+	binary.LittleEndian.PutUint16(b[2:], k.UPNOffset)
+	binary.LittleEndian.PutUint16(b[4:], k.DNSDomainNameLength)
+	binary.LittleEndian.PutUint16(b[6:], k.DNSDomainNameOffset)
+	binary.LittleEndian.PutUint32(b[8:], k.Flags)
+	if k.Flags&UPNDNSFlagExtended != 0 {
+		binary.LittleEndian.PutUint16(b[12:], k.SamNameLength)
+		binary.LittleEndian.PutUint16(b[14:], k.SamNameOffset)
+		binary.LittleEndian.PutUint16(b[16:], k.SIDLength)
+		binary.LittleEndian.PutUint16(b[18:], k.SIDOffset)
+	}
+	for i, f := range fields {
+		copy(b[offsets[i]:], f)
+	}
+	return b, nil
+}
+
+// field returns the bytes of the field at the offset and of the length provided, checking they are within the buffer.
+func field(b []byte, offset, length uint16) ([]byte, error) {
+	if int(offset)+int(length) > len(b) {
+		return nil, fmt.Errorf("field at offset %d of length %d exceeds the %d bytes of the buffer", offset, length, len(b))
+	}
+	return b[offset : offset+length], nil
+}
+
+// utf16Field returns the UTF-16LE string of the field at the offset and of the length provided.
+func utf16Field(b []byte, offset, length uint16) (string, error) {
+	fb, err := field(b, offset, length)
+	if err != nil {
+		return "", err
+	}
+	u := make([]rune, len(fb)/2)
+	for i := range u {
+		u[i] = rune(binary.LittleEndian.Uint16(fb[2*i:]))
+	}
+	return string(u), nil
+}
 
+// sidFromBytes returns the SID of its binary representation, MS-DTYP section 2.4.2.2.
+func sidFromBytes(b []byte) (s mstypes.RPCSID, err error) {
+	if len(b) < 8 {
+		err = fmt.Errorf("%d bytes too short for a SID", len(b))
+		return
+	}
+	s.Revision = b[0]
+	s.SubAuthorityCount = b[1]
+	copy(s.IdentifierAuthority[:], b[2:8])
+	if len(b) < 8+4*int(s.SubAuthorityCount) {
+		err = fmt.Errorf("%d bytes too short for a SID of %d sub-authorities", len(b), s.SubAuthorityCount)
+		return
+	}
+	s.SubAuthority = make([]uint32, s.SubAuthorityCount)
+	for i := range s.SubAuthority {
+		s.SubAuthority[i] = binary.LittleEndian.Uint32(b[8+4*i:])
+	}
 	return
 }
+
+// utf16Bytes returns the UTF-16LE encoding of the string.
+func utf16Bytes(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+// sidBytes returns the binary representation of the SID, MS-DTYP section 2.4.2.2.
+func sidBytes(s mstypes.RPCSID) []byte {
+	b := make([]byte, 8+4*len(s.SubAuthority))
+	b[0] = s.Revision
+	b[1] = uint8(len(s.SubAuthority))
+	copy(b[2:8], s.IdentifierAuthority[:])
+	for i, a := range s.SubAuthority {
+		binary.LittleEndian.PutUint32(b[8+4*i:], a)
+	}
+	return b
+}
@@ -1,6 +1,7 @@
 package pac
 
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"testing"
 
@@ -27,3 +28,63 @@ func TestUPN_DNSInfo_Unmarshal(t *testing.T) {
 	assert.Equal(t, "TEST.GOKRB5", k.DNSDomain, "DNS Domain not as expected")
 	assert.Equal(t, uint32(0), k.Flags, "DNS Domain not as expected")
 }
+
+func TestUPN_DNSInfo_Unmarshal_Extended(t *testing.T) {
+	t.Parallel()
+	utf16 := func(s string) []byte {
+		var b []byte
+		for _, r := range s {
+			b = append(b, byte(r), byte(r>>8))
+		}
+		return b
+	}
+	upn := utf16("testuser1@test.gokrb5")
+	dns := utf16("TEST.GOKRB5")
+	sam := utf16("testuser1")
+	// S-1-5-21-3167651404-3865080224-2280184895-1107
+	sid, _ := hex.DecodeString("010500000000000515000000" + "4c86cebca07160e63fdce88753040000")
+	b := make([]byte, 20)
+	off := uint16(len(b))
+	for i, f := range [][]byte{upn, dns, sam, sid} {
+		binary.LittleEndian.PutUint16(b[[]int{0, 4, 12, 16}[i]:], uint16(len(f)))
+		binary.LittleEndian.PutUint16(b[[]int{2, 6, 14, 18}[i]:], off)
+		off += uint16(len(f))
+	}
+	binary.LittleEndian.PutUint32(b[8:], UPNDNSFlagNoUPN|UPNDNSFlagExtended)
+	b = append(append(append(append(b, upn...), dns...), sam...), sid...)
+
+	var k UPNDNSInfo
+	err := k.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	assert.Equal(t, "testuser1@test.gokrb5", k.UPN, "UPN not as expected")
+	assert.Equal(t, "TEST.GOKRB5", k.DNSDomain, "DNS Domain not as expected")
+	assert.Equal(t, "testuser1", k.SamName, "SAM name not as expected")
+	assert.Equal(t, "S-1-5-21-3167651404-3865080224-2280184895-1107", k.SID.String(), "SID not as expected")
+	assert.NotZero(t, k.Flags&UPNDNSFlagNoUPN, "no UPN flag not set")
+
+	// Fields beyond the end of the buffer are rejected rather than panicking
+	err = k.Unmarshal(b[:len(b)-4])
+	assert.Error(t, err, "truncated SID not rejected")
+	err = k.Unmarshal(b[:30])
+	assert.Error(t, err, "truncated UPN not rejected")
+}
+
+func TestUPN_DNSInfo_Marshal(t *testing.T) {
+	t.Parallel()
+	b, err := hex.DecodeString(testdata.MarshaledPAC_UPN_DNS_Info)
+	if err != nil {
+		t.Fatal("Could not decode test data hex string")
+	}
+	var k UPNDNSInfo
+	err = k.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Error unmarshaling test data: %v", err)
+	}
+	mb, err := k.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshaling UPNDNSInfo: %v", err)
+	}
+	assert.Equal(t, b, mb, "UPNDNSInfo not marshaled as unmarshaled")
+}
@@ -0,0 +1,717 @@
+package pkinit
+
+// Reference: https://tools.ietf.org/html/rfc5652
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/subtle"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// CMS object identifiers.
+var (
+	oidSignedData             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidEnvelopedData          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 3}
+	oidAttributeContentType   = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 3}
+	oidAttributeMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+	oidSHA1                   = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256                 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	oidSHA384                 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}
+	oidSHA512                 = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}
+	oidRSAEncryption          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+	oidRSAESOAEP              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 7}
+	oidSHA1WithRSA            = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}
+	oidSHA256WithRSA          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}
+	oidSHA384WithRSA          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}
+	oidSHA512WithRSA          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}
+	oidECDSAWithSHA1          = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}
+	oidECDSAWithSHA256        = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}
+	oidECDSAWithSHA384        = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}
+	oidECDSAWithSHA512        = asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}
+	oidDESEDE3CBC             = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+	oidAES128CBC              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+var asn1Null = asn1.RawValue{Tag: 5}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+type issuerAndSerialNumber struct {
+	Issuer       asn1.RawValue
+	SerialNumber *big.Int
+}
+
+type encapsulatedContentInfo struct {
+	EContentType asn1.ObjectIdentifier
+	EContent     []byte `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms asn1.RawValue
+	EncapContentInfo encapsulatedContentInfo
+	Certificates     asn1.RawValue   `asn1:"optional"`
+	SignerInfos      []asn1.RawValue `asn1:"set"`
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    algorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional"`
+	SignatureAlgorithm algorithmIdentifier
+	Signature          []byte
+}
+
+// SignedData is the content of a CMS SignedData as used by PKINIT, with the signer information needed to verify it.
+type SignedData struct {
+	ContentType  asn1.ObjectIdentifier
+	Content      []byte
+	Certificates []*x509.Certificate
+	signers      []parsedSignerInfo
+}
+
+type parsedSignerInfo struct {
+	issuer             []byte
+	serial             *big.Int
+	subjectKeyID       []byte
+	digestAlgorithm    asn1.ObjectIdentifier
+	signedAttrs        []byte
+	signatureAlgorithm asn1.ObjectIdentifier
+	signature          []byte
+}
+
+// NewSignedData returns the DER encoded ContentInfo of a CMS SignedData holding the content provided, signed with the
+// private key of the certificate provided using SHA-256. The certificate and the chain provided are included in the
+// SignedData. If the certificate is nil the SignedData has no signers, as used by anonymous PKINIT.
+func NewSignedData(contentType asn1.ObjectIdentifier, content []byte, cert *x509.Certificate, key crypto.Signer, chain []*x509.Certificate) ([]byte, error) {
+	// SET OF fields are encoded manually as the asn1 package applies the set tag to their elements
+	sd := signedData{
+		Version:          3,
+		DigestAlgorithms: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true},
+		EncapContentInfo: encapsulatedContentInfo{
+			EContentType: contentType,
+			EContent:     content,
+		},
+	}
+	if cert != nil {
+		si, err := newSignerInfo(contentType, content, cert, key)
+		if err != nil {
+			return nil, err
+		}
+		da, err := asn1.Marshal(algorithmIdentifier{Algorithm: oidSHA256})
+		if err != nil {
+			return nil, err
+		}
+		sd.DigestAlgorithms.Bytes = da
+		sd.SignerInfos = []asn1.RawValue{{FullBytes: si}}
+		var certs []byte
+		for _, c := range append([]*x509.Certificate{cert}, chain...) {
+			certs = append(certs, c.Raw...)
+		}
+		sd.Certificates = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certs}
+	}
+	b, err := asn1.Marshal(sd)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling SignedData: %v", err)
+	}
+	return marshalContentInfo(oidSignedData, b)
+}
+
+func newSignerInfo(contentType asn1.ObjectIdentifier, content []byte, cert *x509.Certificate, key crypto.Signer) ([]byte, error) {
+	var sigAlg algorithmIdentifier
+	switch key.Public().(type) {
+	case *rsa.PublicKey:
+		sigAlg = algorithmIdentifier{Algorithm: oidSHA256WithRSA, Parameters: asn1Null}
+	case *ecdsa.PublicKey:
+		sigAlg = algorithmIdentifier{Algorithm: oidECDSAWithSHA256}
+	default:
+		return nil, fmt.Errorf("signing with a %T key is not supported", key.Public())
+	}
+	sid, err := asn1.Marshal(issuerAndSerialNumber{
+		Issuer:       asn1.RawValue{FullBytes: cert.RawIssuer},
+		SerialNumber: cert.SerialNumber,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling signer identifier: %v", err)
+	}
+	ct, err := asn1.Marshal(contentType)
+	if err != nil {
+		return nil, err
+	}
+	d := crypto.SHA256.New()
+	d.Write(content)
+	md, err := asn1.Marshal(d.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	// The signed attributes are a DER SET OF so their encodings are sorted
+	var attrs [][]byte
+	for _, a := range []struct {
+		oid   asn1.ObjectIdentifier
+		value []byte
+	}{
+		{oid: oidAttributeContentType, value: ct},
+		{oid: oidAttributeMessageDigest, value: md},
+	} {
+		ab, err := marshalAttribute(a.oid, a.value)
+		if err != nil {
+			return nil, fmt.Errorf("error marshaling signed attribute: %v", err)
+		}
+		attrs = append(attrs, ab)
+	}
+	sort.Slice(attrs, func(i, j int) bool { return bytes.Compare(attrs[i], attrs[j]) < 0 })
+	signedAttrs := bytes.Join(attrs, nil)
+	sb, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: signedAttrs})
+	if err != nil {
+		return nil, err
+	}
+	d = crypto.SHA256.New()
+	d.Write(sb)
+	sig, err := key.Sign(rand.Reader, d.Sum(nil), crypto.SHA256)
+	if err != nil {
+		return nil, fmt.Errorf("error signing: %v", err)
+	}
+	b, err := asn1.Marshal(signerInfo{
+		Version:            1,
+		SID:                asn1.RawValue{FullBytes: sid},
+		DigestAlgorithm:    algorithmIdentifier{Algorithm: oidSHA256},
+		SignedAttrs:        asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: signedAttrs},
+		SignatureAlgorithm: sigAlg,
+		Signature:          sig,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling SignerInfo: %v", err)
+	}
+	return b, nil
+}
+
+// ParseSignedData parses a CMS SignedData, either within a ContentInfo or on its own.
+func ParseSignedData(b []byte) (*SignedData, error) {
+	if ct, content, err := unmarshalContentInfo(b); err == nil {
+		if !ct.Equal(oidSignedData) {
+			return nil, fmt.Errorf("content type %v is not SignedData", ct)
+		}
+		b = content
+	}
+	elems, err := sequence(b)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling SignedData: %v", err)
+	}
+	// version, digestAlgorithms, encapContentInfo, [0] certificates, [1] crls, signerInfos
+	if len(elems) < 4 {
+		return nil, errors.New("SignedData is truncated")
+	}
+	var eci encapsulatedContentInfo
+	if _, err := asn1.Unmarshal(elems[2].FullBytes, &eci); err != nil {
+		return nil, fmt.Errorf("error unmarshaling SignedData content: %v", err)
+	}
+	sd := &SignedData{
+		ContentType: eci.EContentType,
+		Content:     eci.EContent,
+	}
+	for _, e := range elems[3 : len(elems)-1] {
+		if e.Class == asn1.ClassContextSpecific && e.Tag == 0 {
+			certs, err := children(e.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("error unmarshaling SignedData certificates: %v", err)
+			}
+			for _, c := range certs {
+				if c.Class != asn1.ClassUniversal {
+					// Other certificate formats are ignored
+					continue
+				}
+				cert, err := x509.ParseCertificate(c.FullBytes)
+				if err != nil {
+					return nil, fmt.Errorf("error parsing SignedData certificate: %v", err)
+				}
+				sd.Certificates = append(sd.Certificates, cert)
+			}
+		}
+	}
+	sis, err := children(elems[len(elems)-1].Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshaling SignerInfos: %v", err)
+	}
+	for _, si := range sis {
+		s, err := parseSignerInfo(si.FullBytes)
+		if err != nil {
+			return nil, err
+		}
+		sd.signers = append(sd.signers, s)
+	}
+	return sd, nil
+}
+
+func parseSignerInfo(b []byte) (parsedSignerInfo, error) {
+	var s parsedSignerInfo
+	elems, err := sequence(b)
+	if err != nil {
+		return s, fmt.Errorf("error unmarshaling SignerInfo: %v", err)
+	}
+	// version, sid, digestAlgorithm, [0] signedAttrs, signatureAlgorithm, signature, [1] unsignedAttrs
+	if len(elems) < 5 {
+		return s, errors.New("SignerInfo is truncated")
+	}
+	if elems[1].Class == asn1.ClassContextSpecific && elems[1].Tag == 0 {
+		s.subjectKeyID = elems[1].Bytes
+	} else {
+		var ias issuerAndSerialNumber
+		if _, err := asn1.Unmarshal(elems[1].FullBytes, &ias); err != nil {
+			return s, fmt.Errorf("error unmarshaling SignerInfo identifier: %v", err)
+		}
+		s.issuer = ias.Issuer.FullBytes
+		s.serial = ias.SerialNumber
+	}
+	var alg algorithmIdentifier
+	if _, err := asn1.Unmarshal(elems[2].FullBytes, &alg); err != nil {
+		return s, fmt.Errorf("error unmarshaling SignerInfo digest algorithm: %v", err)
+	}
+	s.digestAlgorithm = alg.Algorithm
+	i := 3
+	if elems[i].Class == asn1.ClassContextSpecific && elems[i].Tag == 0 {
+		s.signedAttrs = elems[i].Bytes
+		i++
+	}
+	if len(elems) < i+2 {
+		return s, errors.New("SignerInfo is truncated")
+	}
+	if _, err := asn1.Unmarshal(elems[i].FullBytes, &alg); err != nil {
+		return s, fmt.Errorf("error unmarshaling SignerInfo signature algorithm: %v", err)
+	}
+	s.signatureAlgorithm = alg.Algorithm
+	if _, err := asn1.Unmarshal(elems[i+1].FullBytes, &s.signature); err != nil {
+		return s, fmt.Errorf("error unmarshaling SignerInfo signature: %v", err)
+	}
+	return s, nil
+}
+
+// Verify checks the signature of the SignedData and that the signer's certificate chains to a trusted root using
+// the options provided. The certificates included in the SignedData are used as intermediates. The signer's
+// certificate is returned.
+func (s *SignedData) Verify(opts x509.VerifyOptions) (*x509.Certificate, error) {
+	if len(s.signers) < 1 {
+		return nil, errors.New("SignedData is not signed")
+	}
+	si := s.signers[0]
+	var cert *x509.Certificate
+	for _, c := range s.Certificates {
+		if (si.serial != nil && bytes.Equal(c.RawIssuer, si.issuer) && c.SerialNumber.Cmp(si.serial) == 0) ||
+			(si.subjectKeyID != nil && bytes.Equal(c.SubjectKeyId, si.subjectKeyID)) {
+			cert = c
+			break
+		}
+	}
+	if cert == nil {
+		return nil, errors.New("SignedData does not include the signer's certificate")
+	}
+	h, err := hashFunc(si.digestAlgorithm)
+	if err != nil {
+		return nil, err
+	}
+	signed := s.Content
+	if si.signedAttrs != nil {
+		if err := verifySignedAttributes(si.signedAttrs, s.ContentType, s.Content, h); err != nil {
+			return nil, err
+		}
+		signed, err = asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: si.signedAttrs})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := verifySignature(cert, h, si.signatureAlgorithm, signed, si.signature); err != nil {
+		return nil, err
+	}
+	if opts.Intermediates == nil {
+		opts.Intermediates = x509.NewCertPool()
+	}
+	for _, c := range s.Certificates {
+		if c != cert {
+			opts.Intermediates.AddCert(c)
+		}
+	}
+	if len(opts.KeyUsages) == 0 {
+		// PKINIT key purposes are checked by the caller
+		opts.KeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageAny}
+	}
+	if _, err := cert.Verify(opts); err != nil {
+		return nil, fmt.Errorf("signer's certificate is not trusted: %v", err)
+	}
+	return cert, nil
+}
+
+func verifySignedAttributes(signedAttrs []byte, contentType asn1.ObjectIdentifier, content []byte, h crypto.Hash) error {
+	attrs, err := children(signedAttrs)
+	if err != nil {
+		return fmt.Errorf("error unmarshaling signed attributes: %v", err)
+	}
+	var ctOK, mdOK bool
+	for _, a := range attrs {
+		typ, values, err := unmarshalAttribute(a.FullBytes)
+		if err != nil {
+			return fmt.Errorf("error unmarshaling signed attribute: %v", err)
+		}
+		if len(values) != 1 {
+			continue
+		}
+		switch {
+		case typ.Equal(oidAttributeContentType):
+			var ct asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(values[0].FullBytes, &ct); err != nil || !ct.Equal(contentType) {
+				return errors.New("content type signed attribute does not match the content")
+			}
+			ctOK = true
+		case typ.Equal(oidAttributeMessageDigest):
+			var md []byte
+			d := h.New()
+			d.Write(content)
+			if _, err := asn1.Unmarshal(values[0].FullBytes, &md); err != nil || subtle.ConstantTimeCompare(md, d.Sum(nil)) != 1 {
+				return errors.New("message digest signed attribute does not match the content")
+			}
+			mdOK = true
+		}
+	}
+	if !ctOK || !mdOK {
+		return errors.New("signed attributes do not include the content type and message digest")
+	}
+	return nil
+}
+
+// marshalAttribute returns the DER encoding of an Attribute with the single encoded value provided.
+func marshalAttribute(typ asn1.ObjectIdentifier, value []byte) ([]byte, error) {
+	tb, err := asn1.Marshal(typ)
+	if err != nil {
+		return nil, err
+	}
+	vb, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: value})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: append(tb, vb...)})
+}
+
+// unmarshalAttribute returns the type and encoded values of a DER encoded Attribute.
+func unmarshalAttribute(b []byte) (asn1.ObjectIdentifier, []asn1.RawValue, error) {
+	elems, err := sequence(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(elems) != 2 || elems[1].Tag != asn1.TagSet {
+		return nil, nil, errors.New("attribute is not valid")
+	}
+	var typ asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(elems[0].FullBytes, &typ); err != nil {
+		return nil, nil, err
+	}
+	values, err := children(elems[1].Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return typ, values, nil
+}
+
+func verifySignature(cert *x509.Certificate, h crypto.Hash, sigAlg asn1.ObjectIdentifier, signed, sig []byte) error {
+	d := h.New()
+	d.Write(signed)
+	digest := d.Sum(nil)
+	switch {
+	case sigAlg.Equal(oidRSAEncryption), sigAlg.Equal(oidSHA1WithRSA), sigAlg.Equal(oidSHA256WithRSA),
+		sigAlg.Equal(oidSHA384WithRSA), sigAlg.Equal(oidSHA512WithRSA):
+		pub, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return errors.New("signature algorithm does not match the signer's public key")
+		}
+		if err := rsa.VerifyPKCS1v15(pub, h, digest, sig); err != nil {
+			return fmt.Errorf("SignedData signature is not valid: %v", err)
+		}
+	case sigAlg.Equal(oidECDSAWithSHA1), sigAlg.Equal(oidECDSAWithSHA256), sigAlg.Equal(oidECDSAWithSHA384),
+		sigAlg.Equal(oidECDSAWithSHA512):
+		pub, ok := cert.PublicKey.(*ecdsa.PublicKey)
+		if !ok {
+			return errors.New("signature algorithm does not match the signer's public key")
+		}
+		if !ecdsa.VerifyASN1(pub, digest, sig) {
+			return errors.New("SignedData signature is not valid")
+		}
+	default:
+		return fmt.Errorf("signature algorithm %v is not supported", sigAlg)
+	}
+	return nil
+}
+
+func hashFunc(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	switch {
+	case oid.Equal(oidSHA1):
+		return crypto.SHA1, nil
+	case oid.Equal(oidSHA256):
+		return crypto.SHA256, nil
+	case oid.Equal(oidSHA384):
+		return crypto.SHA384, nil
+	case oid.Equal(oidSHA512):
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("digest algorithm %v is not supported", oid)
+}
+
+// DecryptEnvelopedData decrypts the content of a CMS EnvelopedData, either within a ContentInfo or on its own, that
+// was encrypted for the certificate provided using RSA key transport. The private key of the certificate must
+// implement crypto.Decrypter. The content type and content are returned.
+func DecryptEnvelopedData(b []byte, cert *x509.Certificate, key crypto.Decrypter) (asn1.ObjectIdentifier, []byte, error) {
+	if ct, content, err := unmarshalContentInfo(b); err == nil {
+		if !ct.Equal(oidEnvelopedData) {
+			return nil, nil, fmt.Errorf("content type %v is not EnvelopedData", ct)
+		}
+		b = content
+	}
+	elems, err := sequence(b)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error unmarshaling EnvelopedData: %v", err)
+	}
+	// version, [0] originatorInfo, recipientInfos, encryptedContentInfo, [1] unprotectedAttrs
+	i := 1
+	if len(elems) > i && elems[i].Class == asn1.ClassContextSpecific && elems[i].Tag == 0 {
+		i++
+	}
+	if len(elems) < i+2 {
+		return nil, nil, errors.New("EnvelopedData is truncated")
+	}
+	ris, err := children(elems[i].Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error unmarshaling RecipientInfos: %v", err)
+	}
+	var encKey []byte
+	var keyAlg algorithmIdentifier
+	for _, ri := range ris {
+		if ri.Class != asn1.ClassUniversal {
+			// Only KeyTransRecipientInfo is supported
+			continue
+		}
+		ek, alg, match, err := parseKeyTransRecipientInfo(ri.FullBytes, cert)
+		if err != nil {
+			return nil, nil, err
+		}
+		if match || encKey == nil {
+			encKey, keyAlg = ek, alg
+		}
+		if match {
+			break
+		}
+	}
+	if encKey == nil {
+		return nil, nil, errors.New("EnvelopedData has no key transport recipient")
+	}
+	var opts crypto.DecrypterOpts
+	switch {
+	case keyAlg.Algorithm.Equal(oidRSAEncryption):
+		opts = &rsa.PKCS1v15DecryptOptions{}
+	case keyAlg.Algorithm.Equal(oidRSAESOAEP):
+		h, err := oaepHash(keyAlg.Parameters)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = &rsa.OAEPOptions{Hash: h}
+	default:
+		return nil, nil, fmt.Errorf("key encryption algorithm %v is not supported", keyAlg.Algorithm)
+	}
+	cek, err := key.Decrypt(rand.Reader, encKey, opts)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error decrypting content encryption key: %v", err)
+	}
+	eci, err := sequence(elems[i+1].FullBytes)
+	if err != nil || len(eci) < 3 {
+		return nil, nil, errors.New("error unmarshaling EncryptedContentInfo")
+	}
+	var ct asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(eci[0].FullBytes, &ct); err != nil {
+		return nil, nil, fmt.Errorf("error unmarshaling EncryptedContentInfo content type: %v", err)
+	}
+	var contentAlg algorithmIdentifier
+	if _, err := asn1.Unmarshal(eci[1].FullBytes, &contentAlg); err != nil {
+		return nil, nil, fmt.Errorf("error unmarshaling content encryption algorithm: %v", err)
+	}
+	ciphertext := eci[2].Bytes
+	if eci[2].IsCompound {
+		// A constructed encoding holds the ciphertext in segments
+		segs, err := children(eci[2].Bytes)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error unmarshaling encrypted content: %v", err)
+		}
+		ciphertext = nil
+		for _, s := range segs {
+			ciphertext = append(ciphertext, s.Bytes...)
+		}
+	}
+	content, err := decryptContent(contentAlg, cek, ciphertext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ct, content, nil
+}
+
+func parseKeyTransRecipientInfo(b []byte, cert *x509.Certificate) (encKey []byte, alg algorithmIdentifier, match bool, err error) {
+	elems, err := sequence(b)
+	if err != nil || len(elems) < 4 {
+		err = errors.New("error unmarshaling KeyTransRecipientInfo")
+		return
+	}
+	if elems[1].Class == asn1.ClassContextSpecific && elems[1].Tag == 0 {
+		match = bytes.Equal(elems[1].Bytes, cert.SubjectKeyId)
+	} else {
+		var ias issuerAndSerialNumber
+		if _, err = asn1.Unmarshal(elems[1].FullBytes, &ias); err != nil {
+			err = fmt.Errorf("error unmarshaling recipient identifier: %v", err)
+			return
+		}
+		match = bytes.Equal(ias.Issuer.FullBytes, cert.RawIssuer) && ias.SerialNumber.Cmp(cert.SerialNumber) == 0
+	}
+	if _, err = asn1.Unmarshal(elems[2].FullBytes, &alg); err != nil {
+		err = fmt.Errorf("error unmarshaling key encryption algorithm: %v", err)
+		return
+	}
+	if _, err = asn1.Unmarshal(elems[3].FullBytes, &encKey); err != nil {
+		err = fmt.Errorf("error unmarshaling encrypted key: %v", err)
+	}
+	return
+}
+
+// oaepHash returns the hash function of RSAES-OAEP parameters, which default to SHA-1 (RFC 4055 section 4.1).
+func oaepHash(params asn1.RawValue) (crypto.Hash, error) {
+	if len(params.FullBytes) == 0 || params.Tag == 5 {
+		return crypto.SHA1, nil
+	}
+	elems, err := children(params.Bytes)
+	if err != nil {
+		return 0, fmt.Errorf("error unmarshaling RSAES-OAEP parameters: %v", err)
+	}
+	for _, e := range elems {
+		if e.Class == asn1.ClassContextSpecific && e.Tag == 0 {
+			var alg algorithmIdentifier
+			if _, err := asn1.Unmarshal(e.Bytes, &alg); err != nil {
+				return 0, fmt.Errorf("error unmarshaling RSAES-OAEP hash algorithm: %v", err)
+			}
+			return hashFunc(alg.Algorithm)
+		}
+	}
+	return crypto.SHA1, nil
+}
+
+func decryptContent(alg algorithmIdentifier, key, ciphertext []byte) ([]byte, error) {
+	var block cipher.Block
+	var err error
+	switch {
+	case alg.Algorithm.Equal(oidDESEDE3CBC):
+		block, err = des.NewTripleDESCipher(key)
+	case alg.Algorithm.Equal(oidAES128CBC), alg.Algorithm.Equal(oidAES192CBC), alg.Algorithm.Equal(oidAES256CBC):
+		block, err = aes.NewCipher(key)
+	default:
+		return nil, fmt.Errorf("content encryption algorithm %v is not supported", alg.Algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating content cipher: %v", err)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(alg.Parameters.FullBytes, &iv); err != nil || len(iv) != block.BlockSize() {
+		return nil, errors.New("content encryption IV is not valid")
+	}
+	if len(ciphertext) == 0 || len(ciphertext)%block.BlockSize() != 0 {
+		return nil, errors.New("encrypted content is not a multiple of the block size")
+	}
+	pt := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(pt, ciphertext)
+	// Remove the PKCS #7 padding
+	n, ok := pkcs7PaddingLen(pt, block.BlockSize())
+	if !ok {
+		return nil, errors.New("encrypted content padding is not valid")
+	}
+	return pt[:len(pt)-n], nil
+}
+
+// pkcs7PaddingLen returns the length of the PKCS #7 padding at the end of b, a whole number of blocks of the size
+// provided, and if it is valid. The padding is checked in constant time so that the time taken does not reveal where it
+// is invalid.
+func pkcs7PaddingLen(b []byte, blockSize int) (int, bool) {
+	n := int(b[len(b)-1])
+	good := subtle.ConstantTimeLessOrEq(1, n) & subtle.ConstantTimeLessOrEq(n, blockSize)
+	for i := 1; i <= blockSize; i++ {
+		// Only the last n bytes are padding and each must equal n
+		inPad := subtle.ConstantTimeLessOrEq(i, n)
+		good &= subtle.ConstantTimeSelect(inPad, subtle.ConstantTimeByteEq(b[len(b)-i], byte(n)), 1)
+	}
+	return n, good == 1
+}
+
+func marshalContentInfo(contentType asn1.ObjectIdentifier, content []byte) ([]byte, error) {
+	ct, err := asn1.Marshal(contentType)
+	if err != nil {
+		return nil, err
+	}
+	c, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: content})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: append(ct, c...)})
+}
+
+func unmarshalContentInfo(b []byte) (asn1.ObjectIdentifier, []byte, error) {
+	elems, err := sequence(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(elems) != 2 || elems[1].Class != asn1.ClassContextSpecific || elems[1].Tag != 0 {
+		return nil, nil, errors.New("not a ContentInfo")
+	}
+	var ct asn1.ObjectIdentifier
+	if _, err := asn1.Unmarshal(elems[0].FullBytes, &ct); err != nil {
+		return nil, nil, errors.New("not a ContentInfo")
+	}
+	return ct, elems[1].Bytes, nil
+}
+
+// sequence returns the elements of the DER encoded SEQUENCE provided.
+func sequence(b []byte) ([]asn1.RawValue, error) {
+	var rv asn1.RawValue
+	rest, err := asn1.Unmarshal(b, &rv)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) > 0 {
+		return nil, errors.New("trailing data")
+	}
+	if rv.Class != asn1.ClassUniversal || rv.Tag != asn1.TagSequence || !rv.IsCompound {
+		return nil, errors.New("not a SEQUENCE")
+	}
+	return children(rv.Bytes)
+}
+
+// children returns the encoded values that make up the content of a constructed value.
+func children(b []byte) ([]asn1.RawValue, error) {
+	var elems []asn1.RawValue
+	for len(b) > 0 {
+		var rv asn1.RawValue
+		var err error
+		b, err = asn1.Unmarshal(b, &rv)
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, rv)
+	}
+	return elems, nil
+}
@@ -0,0 +1,131 @@
+package pkinit
+
+import (
+	"crypto"
+	"crypto/x509"
+	"testing"
+
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignedData(t *testing.T) {
+	t.Parallel()
+	p := newTestPKI(t, true, false)
+	content := []byte("signed content")
+	var tests = []struct {
+		name string
+		sign func() ([]byte, error)
+		cert []byte
+	}{
+		{"RSA", func() ([]byte, error) { return NewSignedData(OIDAuthData, content, p.clientCert, p.clientKey, nil) }, p.clientCert.Raw},
+		{"ECDSA", func() ([]byte, error) { return NewSignedData(OIDDHKeyData, content, p.kdcCert, p.kdcKey, nil) }, p.kdcCert.Raw},
+	}
+	for _, test := range tests {
+		b, err := test.sign()
+		if err != nil {
+			t.Fatalf("%s: error signing: %v", test.name, err)
+		}
+		sd, err := ParseSignedData(b)
+		if err != nil {
+			t.Fatalf("%s: error parsing SignedData: %v", test.name, err)
+		}
+		assert.Equal(t, content, sd.Content, "%s: content not as expected", test.name)
+		cert, err := sd.Verify(p.verifyOptions())
+		if err != nil {
+			t.Fatalf("%s: error verifying SignedData: %v", test.name, err)
+		}
+		assert.Equal(t, test.cert, cert.Raw, "%s: signer not as expected", test.name)
+
+		_, err = sd.Verify(x509.VerifyOptions{Roots: x509.NewCertPool()})
+		assert.Error(t, err, "%s: signer without a trusted root should be rejected", test.name)
+
+		sd.Content = []byte("tampered content")
+		_, err = sd.Verify(p.verifyOptions())
+		assert.Error(t, err, "%s: tampered content should be rejected", test.name)
+	}
+}
+
+func TestSignedData_Encoding(t *testing.T) {
+	t.Parallel()
+	p := newTestPKI(t, true, false)
+	b, err := NewSignedData(OIDAuthData, []byte("content"), p.kdcCert, p.kdcKey, nil)
+	if err != nil {
+		t.Fatalf("error signing: %v", err)
+	}
+	ct, sdb, err := unmarshalContentInfo(b)
+	if err != nil {
+		t.Fatalf("error unmarshaling ContentInfo: %v", err)
+	}
+	assert.True(t, ct.Equal(oidSignedData), "content type not as expected")
+	elems, err := sequence(sdb)
+	if err != nil {
+		t.Fatalf("error unmarshaling SignedData: %v", err)
+	}
+	// digestAlgorithms is a SET OF AlgorithmIdentifier
+	assert.Equal(t, asn1.TagSet, elems[1].Tag, "digestAlgorithms tag not as expected")
+	algs, _ := children(elems[1].Bytes)
+	if assert.Len(t, algs, 1, "number of digest algorithms not as expected") {
+		assert.Equal(t, asn1.TagSequence, algs[0].Tag, "digest algorithm tag not as expected")
+	}
+	// signerInfos is a SET OF SignerInfo
+	last := elems[len(elems)-1]
+	assert.Equal(t, asn1.TagSet, last.Tag, "signerInfos tag not as expected")
+	sis, _ := children(last.Bytes)
+	if assert.Len(t, sis, 1, "number of signers not as expected") {
+		assert.Equal(t, asn1.TagSequence, sis[0].Tag, "signer info tag not as expected")
+	}
+}
+
+func TestSignedData_Unsigned(t *testing.T) {
+	t.Parallel()
+	b, err := NewSignedData(OIDAuthData, []byte("content"), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("error creating unsigned SignedData: %v", err)
+	}
+	sd, err := ParseSignedData(b)
+	if err != nil {
+		t.Fatalf("error parsing unsigned SignedData: %v", err)
+	}
+	assert.True(t, sd.ContentType.Equal(OIDAuthData), "content type not as expected")
+	assert.Equal(t, []byte("content"), sd.Content, "content not as expected")
+	assert.Empty(t, sd.Certificates, "unsigned SignedData should not include certificates")
+	_, err = sd.Verify(x509.VerifyOptions{})
+	assert.Error(t, err, "unsigned SignedData should not verify")
+}
+
+func TestDecryptEnvelopedData(t *testing.T) {
+	t.Parallel()
+	p := newTestPKI(t, true, false)
+	b := envelope(t, p.clientCert, OIDRKeyData, []byte("enveloped content"))
+	ct, content, err := DecryptEnvelopedData(b, p.clientCert, p.clientKey.(crypto.Decrypter))
+	if err != nil {
+		t.Fatalf("error decrypting EnvelopedData: %v", err)
+	}
+	assert.True(t, ct.Equal(OIDRKeyData), "content type not as expected")
+	assert.Equal(t, []byte("enveloped content"), content, "content not as expected")
+}
+
+func TestPKCS7PaddingLen(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		b  []byte
+		n  int
+		ok bool
+	}{
+		{[]byte{1, 2, 3, 4, 5, 6, 7, 1}, 1, true},
+		{[]byte{1, 2, 3, 4, 5, 3, 3, 3}, 3, true},
+		{[]byte{8, 8, 8, 8, 8, 8, 8, 8}, 8, true},
+		{[]byte{1, 2, 3, 4, 5, 6, 7, 0}, 0, false},
+		{[]byte{1, 2, 3, 4, 5, 6, 7, 9}, 9, false},
+		{[]byte{1, 2, 3, 4, 5, 2, 3, 3}, 3, false},
+		{[]byte{7, 8, 8, 8, 8, 8, 8, 8}, 8, false},
+	}
+	for _, test := range tests {
+		n, ok := pkcs7PaddingLen(test.b, 8)
+		assert.Equal(t, test.ok, ok, "validity of padding %v not as expected", test.b)
+		if ok {
+			assert.Equal(t, test.n, n, "padding length of %v not as expected", test.b)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package pkinit
+
+import (
+	"crypto/rand"
+	"crypto/sha1"
+	"errors"
+	"math/big"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// modp2048 is the 2048-bit MODP group (group 14) from RFC 3526 section 3, the group used for Diffie-Hellman key
+// agreement. Its generator is 2.
+const modp2048 = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
+	"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
+	"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3DC2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
+	"83655D23DCA3AD961C62F356208552BB9ED529077096966D670C354E4ABC9804F1746C08CA18217C32905E462E36CE3B" +
+	"E39E772C180E86039B2783A2EC07A28FB5C55DF06F4C52C9DE2BCBF6955817183995497CEA956AE515D2261898FA0510" +
+	"15728E5A8AACAA68FFFFFFFFFFFFFFFF"
+
+// dhDomainParameters implements the X9.42 DomainParameters of a Diffie-Hellman public key (RFC 3279 section 2.3.3).
+type dhDomainParameters struct {
+	P *big.Int
+	G *big.Int
+	Q *big.Int
+}
+
+// subjectPublicKeyInfo implements the X.509 SubjectPublicKeyInfo (RFC 5280 section 4.1).
+type subjectPublicKeyInfo struct {
+	Algorithm algorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// DHKey is a Diffie-Hellman key pair in a MODP group.
+type DHKey struct {
+	p *big.Int
+	g *big.Int
+	x *big.Int
+	y *big.Int
+}
+
+// NewDHKey generates a Diffie-Hellman key pair in the 2048-bit MODP group from RFC 3526.
+func NewDHKey() (*DHKey, error) {
+	p, _ := new(big.Int).SetString(modp2048, 16)
+	g := big.NewInt(2)
+	q := new(big.Int).Rsh(p, 1)
+	// The private value is chosen from [2, q-1]
+	x, err := rand.Int(rand.Reader, new(big.Int).Sub(q, big.NewInt(2)))
+	if err != nil {
+		return nil, krberror.Errorf(err, krberror.EncryptingError, "error generating Diffie-Hellman private value")
+	}
+	x.Add(x, big.NewInt(2))
+	return &DHKey{
+		p: p,
+		g: g,
+		x: x,
+		y: new(big.Int).Exp(g, x, p),
+	}, nil
+}
+
+// PublicKeyInfo returns the DER encoded SubjectPublicKeyInfo of the public value of the key, with the group's domain
+// parameters, as carried in the clientPublicValue of the AuthPack.
+func (k *DHKey) PublicKeyInfo() ([]byte, error) {
+	spki, err := k.publicKeyInfo()
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(spki)
+}
+
+func (k *DHKey) publicKeyInfo() (subjectPublicKeyInfo, error) {
+	params, err := asn1.Marshal(dhDomainParameters{
+		P: k.p,
+		G: k.g,
+		Q: new(big.Int).Rsh(k.p, 1),
+	})
+	if err != nil {
+		return subjectPublicKeyInfo{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling Diffie-Hellman domain parameters")
+	}
+	pub, err := k.PublicValue()
+	if err != nil {
+		return subjectPublicKeyInfo{}, err
+	}
+	return subjectPublicKeyInfo{
+		Algorithm: algorithmIdentifier{
+			Algorithm:  oidDHPublicNumber,
+			Parameters: asn1.RawValue{FullBytes: params},
+		},
+		PublicKey: pub,
+	}, nil
+}
+
+// PublicValue returns the public value of the key as the DER encoded INTEGER within a BIT STRING, as carried in the
+// subjectPublicKey of a SubjectPublicKeyInfo or of the KDCDHKeyInfo.
+func (k *DHKey) PublicValue() (asn1.BitString, error) {
+	b, err := asn1.Marshal(k.y)
+	if err != nil {
+		return asn1.BitString{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling Diffie-Hellman public value")
+	}
+	return asn1.BitString{Bytes: b, BitLength: len(b) * 8}, nil
+}
+
+// SharedSecret returns the Diffie-Hellman shared secret with the peer's public value, which is the DER encoded INTEGER
+// within the BIT STRING provided. The secret is padded on the left with zeros to the length of the group's prime.
+func (k *DHKey) SharedSecret(pub asn1.BitString) ([]byte, error) {
+	y := new(big.Int)
+	if _, err := asn1.Unmarshal(pub.Bytes, &y); err != nil {
+		return nil, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling Diffie-Hellman public value")
+	}
+	// The public value must be in the range [2, p-2]
+	if y.Cmp(big.NewInt(1)) <= 0 || y.Cmp(new(big.Int).Sub(k.p, big.NewInt(1))) >= 0 {
+		return nil, errors.New("Diffie-Hellman public value is not valid for the group")
+	}
+	z := new(big.Int).Exp(y, k.x, k.p).Bytes()
+	b := make([]byte, (k.p.BitLen()+7)/8)
+	copy(b[len(b)-len(z):], z)
+	return b, nil
+}
+
+// OctetString2Key derives a key of the encryption type from the octet string provided using the octetstring2key
+// function of RFC 4556 section 3.2.3.1.
+func OctetString2Key(x []byte, etypeID int32) (types.EncryptionKey, error) {
+	et, err := crypto.GetEtype(etypeID)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncryptingError, "error getting etype for PKINIT reply key")
+	}
+	n := et.GetKeySeedBitLength() / 8
+	var k []byte
+	for i := 0; len(k) < n; i++ {
+		h := sha1.New()
+		h.Write([]byte{byte(i)})
+		h.Write(x)
+		k = h.Sum(k)
+	}
+	return types.EncryptionKey{
+		KeyType:  etypeID,
+		KeyValue: et.RandomToKey(k[:n]),
+	}, nil
+}
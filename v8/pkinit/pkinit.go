@@ -0,0 +1,383 @@
+// Package pkinit implements public key cryptography for initial authentication in Kerberos (PKINIT), RFC 4556, and
+// anonymous PKINIT, RFC 8062.
+package pkinit
+
+// Reference: https://tools.ietf.org/html/rfc4556
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	krbcrypto "github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// PKINIT object identifiers.
+var (
+	OIDAuthData       = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 1}
+	OIDDHKeyData      = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 2}
+	OIDRKeyData       = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 3}
+	OIDKPClientAuth   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 4}
+	OIDKPKdc          = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 3, 5}
+	OIDPKINITSAN      = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 2, 2}
+	oidDHPublicNumber = asn1.ObjectIdentifier{1, 2, 840, 10046, 2, 1}
+	oidSubjectAltName = asn1.ObjectIdentifier{2, 5, 29, 17}
+)
+
+// KeyUsageASChecksum is the key usage of the asChecksum in the ReplyKeyPack (RFC 4556 section 3.2.3.2).
+const KeyUsageASChecksum = 6
+
+// PAPKASReq implements RFC 4556 PA-PK-AS-REQ.
+type PAPKASReq struct {
+	SignedAuthPack    []byte          `asn1:"tag:0"`
+	TrustedCertifiers []asn1.RawValue `asn1:"explicit,optional,tag:1"`
+	KDCPkID           []byte          `asn1:"optional,tag:2"`
+}
+
+// AuthPack implements RFC 4556 AuthPack, the content of the SignedData in the PA-PK-AS-REQ.
+type AuthPack struct {
+	PKAuthenticator   PKAuthenticator       `asn1:"explicit,tag:0"`
+	ClientPublicValue subjectPublicKeyInfo  `asn1:"explicit,optional,tag:1"`
+	SupportedCMSTypes []algorithmIdentifier `asn1:"explicit,optional,tag:2"`
+	ClientDHNonce     []byte                `asn1:"explicit,optional,tag:3"`
+}
+
+// PKAuthenticator implements RFC 4556 PKAuthenticator.
+type PKAuthenticator struct {
+	Cusec      int       `asn1:"explicit,tag:0"`
+	CTime      time.Time `asn1:"generalized,explicit,tag:1"`
+	Nonce      int       `asn1:"explicit,tag:2"`
+	PAChecksum []byte    `asn1:"explicit,optional,tag:3"`
+}
+
+// PAPKASRep implements RFC 4556 PA-PK-AS-REP, which holds either the DHInfo or the EncKeyPack.
+type PAPKASRep struct {
+	DHInfo     DHRepInfo
+	EncKeyPack []byte
+}
+
+// DHRepInfo implements RFC 4556 DHRepInfo.
+type DHRepInfo struct {
+	DHSignedData  []byte `asn1:"tag:0"`
+	ServerDHNonce []byte `asn1:"explicit,optional,tag:1"`
+}
+
+// KDCDHKeyInfo implements RFC 4556 KDCDHKeyInfo, the content of the SignedData in the DHRepInfo.
+type KDCDHKeyInfo struct {
+	SubjectPublicKey asn1.BitString `asn1:"explicit,tag:0"`
+	Nonce            int            `asn1:"explicit,tag:1"`
+	DHKeyExpiration  time.Time      `asn1:"generalized,explicit,optional,tag:2"`
+}
+
+// ReplyKeyPack implements RFC 4556 ReplyKeyPack, the content of the SignedData in the EncKeyPack.
+type ReplyKeyPack struct {
+	ReplyKey   types.EncryptionKey `asn1:"explicit,tag:0"`
+	ASChecksum types.Checksum      `asn1:"explicit,tag:1"`
+}
+
+// krb5PrincipalName implements the KRB5PrincipalName of the id-pkinit-san subject alternative name.
+type krb5PrincipalName struct {
+	Realm         string              `asn1:"generalstring,explicit,tag:0"`
+	PrincipalName types.PrincipalName `asn1:"explicit,tag:1"`
+}
+
+// Marshal the PA-PK-AS-REQ.
+func (a *PAPKASReq) Marshal() ([]byte, error) {
+	return asn1.Marshal(*a)
+}
+
+// Unmarshal bytes b into the PA-PK-AS-REQ.
+func (a *PAPKASReq) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, a)
+	return err
+}
+
+// Marshal the PA-PK-AS-REP.
+func (a *PAPKASRep) Marshal() ([]byte, error) {
+	if len(a.EncKeyPack) > 0 {
+		return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 1, Bytes: a.EncKeyPack})
+	}
+	b, err := asn1.Marshal(a.DHInfo)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: b})
+}
+
+// Unmarshal bytes b into the PA-PK-AS-REP.
+func (a *PAPKASRep) Unmarshal(b []byte) error {
+	var rv asn1.RawValue
+	if _, err := asn1.Unmarshal(b, &rv); err != nil {
+		return err
+	}
+	if rv.Class != asn1.ClassContextSpecific {
+		return errors.New("PA-PK-AS-REP choice not recognised")
+	}
+	switch rv.Tag {
+	case 0:
+		_, err := asn1.Unmarshal(rv.Bytes, &a.DHInfo)
+		return err
+	case 1:
+		a.EncKeyPack = rv.Bytes
+		return nil
+	}
+	return fmt.Errorf("PA-PK-AS-REP choice %d not recognised", rv.Tag)
+}
+
+// Request holds the client's state for an AS exchange pre-authenticated with PKINIT.
+type Request struct {
+	nonce        int
+	cert         *x509.Certificate
+	key          crypto.Signer
+	dh           *DHKey
+	kdcHostnames []string
+}
+
+// NewRequest creates the PA-PK-AS-REQ pre-authentication data for an AS_REQ with the body provided, signed with the
+// certificate and private key provided. The chain of intermediate certificates is included for the KDC to verify
+// the certificate. The reply key is agreed using Diffie-Hellman unless RSA key transport is requested, in which case
+// the private key must also implement crypto.Decrypter. The KDC offset is applied to the time in the request.
+func NewRequest(body messages.KDCReqBody, cert *x509.Certificate, key crypto.Signer, chain []*x509.Certificate, keyTransport bool, kdcOffset time.Duration) (*Request, types.PAData, error) {
+	r := &Request{
+		nonce: body.Nonce,
+		cert:  cert,
+		key:   key,
+	}
+	bb, err := body.Marshal()
+	if err != nil {
+		return nil, types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling KDC_REQ body for PKINIT")
+	}
+	sum := sha1.Sum(bb)
+	t := time.Now().UTC().Add(kdcOffset)
+	ap := AuthPack{
+		PKAuthenticator: PKAuthenticator{
+			Cusec:      t.Nanosecond() / int(time.Microsecond),
+			CTime:      t.Truncate(time.Second),
+			Nonce:      r.nonce,
+			PAChecksum: sum[:],
+		},
+	}
+	if keyTransport {
+		if _, ok := key.(crypto.Decrypter); !ok {
+			return nil, types.PAData{}, krberror.NewErrorf(krberror.EncryptingError, "PKINIT RSA key transport requires a private key that can decrypt")
+		}
+	} else {
+		r.dh, err = NewDHKey()
+		if err != nil {
+			return nil, types.PAData{}, err
+		}
+		ap.ClientPublicValue, err = r.dh.publicKeyInfo()
+		if err != nil {
+			return nil, types.PAData{}, err
+		}
+	}
+	apb, err := asn1.Marshal(ap)
+	if err != nil {
+		return nil, types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PKINIT AuthPack")
+	}
+	sd, err := NewSignedData(OIDAuthData, apb, cert, key, chain)
+	if err != nil {
+		return nil, types.PAData{}, krberror.Errorf(err, krberror.EncryptingError, "error signing PKINIT AuthPack")
+	}
+	req := PAPKASReq{SignedAuthPack: sd}
+	b, err := req.Marshal()
+	if err != nil {
+		return nil, types.PAData{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling PA-PK-AS-REQ")
+	}
+	return r, types.PAData{PADataType: patype.PA_PK_AS_REQ, PADataValue: b}, nil
+}
+
+// NewAnonymousRequest creates the PA-PK-AS-REQ pre-authentication data for an anonymous AS_REQ with the body provided
+// (RFC 8062). The AuthPack is not signed and the reply key is agreed using Diffie-Hellman. The body should request the
+// anonymous principal with the request-anonymous KDC option set.
+func NewAnonymousRequest(body messages.KDCReqBody, kdcOffset time.Duration) (*Request, types.PAData, error) {
+	return NewRequest(body, nil, nil, nil, false, kdcOffset)
+}
+
+// SetKDCHostnames sets the host names, as configured with pkinit_kdc_hostname, that the KDC's certificate may be issued
+// to with a DNS name subject alternative name rather than the krbtgt principal name of the realm.
+func (r *Request) SetKDCHostnames(names ...string) {
+	r.kdcHostnames = names
+}
+
+// ReplyKey verifies the PA-PK-AS-REP in the AS_REP to the AS_REQ that carried the request and returns the reply key
+// the AS_REP is encrypted with. The KDC's certificate must chain to a root trusted by the verify options provided and
+// must be issued to the KDC of the realm requested.
+func (r *Request) ReplyKey(asReq messages.ASReq, asRep messages.ASRep, opts x509.VerifyOptions) (types.EncryptionKey, error) {
+	var rep PAPKASRep
+	var found bool
+	for _, pa := range asRep.PAData {
+		if pa.PADataType == patype.PA_PK_AS_REP {
+			if err := rep.Unmarshal(pa.PADataValue); err != nil {
+				return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PA-PK-AS-REP")
+			}
+			found = true
+		}
+	}
+	if !found {
+		return types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "AS_REP does not contain a PA-PK-AS-REP")
+	}
+	if r.dh != nil {
+		return r.dhReplyKey(rep, asReq.ReqBody.Realm, asRep.EncPart.EType, opts)
+	}
+	return r.encKeyPackReplyKey(rep, asReq, opts)
+}
+
+func (r *Request) dhReplyKey(rep PAPKASRep, realm string, etypeID int32, opts x509.VerifyOptions) (types.EncryptionKey, error) {
+	if len(rep.DHInfo.DHSignedData) == 0 {
+		return types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "PA-PK-AS-REP does not contain the Diffie-Hellman reply")
+	}
+	sd, err := ParseSignedData(rep.DHInfo.DHSignedData)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PKINIT Diffie-Hellman reply")
+	}
+	if !sd.ContentType.Equal(OIDDHKeyData) {
+		return types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "PKINIT Diffie-Hellman reply content type not as expected")
+	}
+	if err := verifyKDC(sd, realm, r.kdcHostnames, opts); err != nil {
+		return types.EncryptionKey{}, err
+	}
+	var ki KDCDHKeyInfo
+	if _, err := asn1.Unmarshal(sd.Content, &ki); err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling KDCDHKeyInfo")
+	}
+	if ki.Nonce != r.nonce {
+		return types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "possible replay attack, nonce in PKINIT reply does not match that in request")
+	}
+	z, err := r.dh.SharedSecret(ki.SubjectPublicKey)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.DecryptingError, "error agreeing PKINIT reply key")
+	}
+	return OctetString2Key(z, etypeID)
+}
+
+func (r *Request) encKeyPackReplyKey(rep PAPKASRep, asReq messages.ASReq, opts x509.VerifyOptions) (types.EncryptionKey, error) {
+	if len(rep.EncKeyPack) == 0 {
+		return types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "PA-PK-AS-REP does not contain the encrypted reply key")
+	}
+	ct, content, err := DecryptEnvelopedData(rep.EncKeyPack, r.cert, r.key.(crypto.Decrypter))
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.DecryptingError, "error decrypting PKINIT reply key")
+	}
+	if !ct.Equal(oidSignedData) {
+		return types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "PKINIT encrypted reply key content type not as expected")
+	}
+	sd, err := ParseSignedData(content)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling PKINIT reply key")
+	}
+	if !sd.ContentType.Equal(OIDRKeyData) {
+		return types.EncryptionKey{}, krberror.NewErrorf(krberror.KRBMsgError, "PKINIT reply key content type not as expected")
+	}
+	if err := verifyKDC(sd, asReq.ReqBody.Realm, r.kdcHostnames, opts); err != nil {
+		return types.EncryptionKey{}, err
+	}
+	var rkp ReplyKeyPack
+	if _, err := asn1.Unmarshal(sd.Content, &rkp); err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling ReplyKeyPack")
+	}
+	// The checksum binds the reply key to the AS_REQ
+	b, err := asReq.Marshal()
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.EncodingError, "error marshaling AS_REQ")
+	}
+	et, err := krbcrypto.GetChksumEtype(rkp.ASChecksum.CksumType)
+	if err != nil {
+		return types.EncryptionKey{}, krberror.Errorf(err, krberror.ChksumError, "PKINIT reply key checksum type not supported")
+	}
+	if !et.VerifyChecksum(rkp.ReplyKey.KeyValue, b, rkp.ASChecksum.Checksum, KeyUsageASChecksum) {
+		return types.EncryptionKey{}, krberror.NewErrorf(krberror.ChksumError, "PKINIT reply key checksum of AS_REQ invalid")
+	}
+	return rkp.ReplyKey, nil
+}
+
+// verifyKDC verifies the signature of the SignedData from the KDC and checks that the signer's certificate is issued
+// to the KDC of the realm, as MIT Kerberos does. The certificate must have the id-pkinit-KPKdc key purpose and either
+// the id-pkinit-san of krbtgt/REALM@REALM or a DNS name subject alternative name of one of the KDC host names provided.
+func verifyKDC(sd *SignedData, realm string, hostnames []string, opts x509.VerifyOptions) error {
+	cert, err := sd.Verify(opts)
+	if err != nil {
+		return krberror.Errorf(err, krberror.KRBMsgError, "could not verify the KDC's PKINIT signature")
+	}
+	var kdcEKU bool
+	for _, eku := range cert.UnknownExtKeyUsage {
+		if asn1.ObjectIdentifier(eku).Equal(OIDKPKdc) {
+			kdcEKU = true
+			break
+		}
+	}
+	if !kdcEKU {
+		return krberror.NewErrorf(krberror.KRBMsgError, "KDC certificate does not have the id-pkinit-KPKdc key purpose")
+	}
+	names, err := PrincipalNames(cert)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncodingError, "error reading principal names from KDC certificate")
+	}
+	for _, n := range names {
+		if n.Realm == realm && len(n.PrincipalName.NameString) == 2 &&
+			n.PrincipalName.NameString[0] == "krbtgt" && n.PrincipalName.NameString[1] == realm {
+			return nil
+		}
+	}
+	for _, h := range hostnames {
+		for _, d := range cert.DNSNames {
+			if strings.EqualFold(strings.TrimSuffix(h, "."), strings.TrimSuffix(d, ".")) {
+				return nil
+			}
+		}
+	}
+	return krberror.NewErrorf(krberror.KRBMsgError, "KDC certificate is not issued to the KDC of realm %s", realm)
+}
+
+// PrincipalName is a Kerberos principal name held in the id-pkinit-san subject alternative name of a certificate.
+type PrincipalName struct {
+	Realm         string
+	PrincipalName types.PrincipalName
+}
+
+// PrincipalNames returns the Kerberos principal names in the id-pkinit-san subject alternative names of the
+// certificate.
+func PrincipalNames(cert *x509.Certificate) ([]PrincipalName, error) {
+	var names []PrincipalName
+	for _, ext := range cert.Extensions {
+		if !asn1.ObjectIdentifier(ext.Id).Equal(oidSubjectAltName) {
+			continue
+		}
+		gns, err := sequence(ext.Value)
+		if err != nil {
+			return nil, err
+		}
+		for _, gn := range gns {
+			// otherName [0] { type-id OBJECT IDENTIFIER, value [0] EXPLICIT ANY }
+			if gn.Class != asn1.ClassContextSpecific || gn.Tag != 0 {
+				continue
+			}
+			on, err := children(gn.Bytes)
+			if err != nil || len(on) != 2 {
+				return nil, errors.New("subject alternative name otherName is not valid")
+			}
+			var id asn1.ObjectIdentifier
+			if _, err := asn1.Unmarshal(on[0].FullBytes, &id); err != nil {
+				return nil, err
+			}
+			if !id.Equal(OIDPKINITSAN) {
+				continue
+			}
+			var kpn krb5PrincipalName
+			if _, err := asn1.Unmarshal(on[1].Bytes, &kpn); err != nil {
+				return nil, err
+			}
+			names = append(names, PrincipalName(kpn))
+		}
+	}
+	return names, nil
+}
@@ -0,0 +1,448 @@
+package pkinit
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	stdasn1 "encoding/asn1"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/config"
+	krbcrypto "github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/iana/patype"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+)
+
+const testRealm = "TEST.GOKRB5"
+
+type stdOID = stdasn1.ObjectIdentifier
+
+type testPKI struct {
+	ca         *x509.Certificate
+	caKey      crypto.Signer
+	roots      *x509.CertPool
+	kdcCert    *x509.Certificate
+	kdcKey     crypto.Signer
+	clientCert *x509.Certificate
+	clientKey  crypto.Signer
+}
+
+func newTestPKI(t *testing.T, kdcEKU bool, kdcSAN bool) *testPKI {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating CA key: %v", err)
+	}
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	cab, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatalf("error creating CA certificate: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(cab)
+	p := &testPKI{ca: ca, caKey: caKey, roots: x509.NewCertPool()}
+	p.roots.AddCert(ca)
+
+	kdcKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("error generating KDC key: %v", err)
+	}
+	kdcTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "kdc.test.gokrb5"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if kdcEKU {
+		kdcTmpl.UnknownExtKeyUsage = []stdOID{stdOID(OIDKPKdc)}
+	}
+	if kdcSAN {
+		kdcTmpl.ExtraExtensions = []pkix.Extension{pkinitSAN(t, testRealm, "krbtgt", testRealm)}
+	}
+	p.kdcCert, p.kdcKey = p.issue(t, kdcTmpl, kdcKey)
+
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("error generating client key: %v", err)
+	}
+	clientTmpl := &x509.Certificate{
+		SerialNumber:       big.NewInt(3),
+		Subject:            pkix.Name{CommonName: "testuser1"},
+		NotBefore:          time.Now().Add(-time.Hour),
+		NotAfter:           time.Now().Add(time.Hour),
+		KeyUsage:           x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		UnknownExtKeyUsage: []stdOID{stdOID(OIDKPClientAuth)},
+		ExtraExtensions:    []pkix.Extension{pkinitSAN(t, testRealm, "testuser1")},
+	}
+	p.clientCert, p.clientKey = p.issue(t, clientTmpl, clientKey)
+	return p
+}
+
+func (p *testPKI) issue(t *testing.T, tmpl *x509.Certificate, key crypto.Signer) (*x509.Certificate, crypto.Signer) {
+	b, err := x509.CreateCertificate(rand.Reader, tmpl, p.ca, key.Public(), p.caKey)
+	if err != nil {
+		t.Fatalf("error creating certificate: %v", err)
+	}
+	c, err := x509.ParseCertificate(b)
+	if err != nil {
+		t.Fatalf("error parsing certificate: %v", err)
+	}
+	return c, key
+}
+
+func (p *testPKI) verifyOptions() x509.VerifyOptions {
+	return x509.VerifyOptions{Roots: p.roots}
+}
+
+func pkinitSAN(t *testing.T, realm string, name ...string) pkix.Extension {
+	kpn, err := asn1.Marshal(krb5PrincipalName{
+		Realm:         realm,
+		PrincipalName: types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: name},
+	})
+	if err != nil {
+		t.Fatalf("error marshaling KRB5PrincipalName: %v", err)
+	}
+	id, _ := asn1.Marshal(OIDPKINITSAN)
+	v, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: kpn})
+	on, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: append(id, v...)})
+	gns, _ := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: on})
+	return pkix.Extension{Id: stdOID(oidSubjectAltName), Value: gns}
+}
+
+func testASReq(t *testing.T) messages.ASReq {
+	c, err := config.NewFromString(testdata.KRB5_CONF)
+	if err != nil {
+		t.Fatalf("error loading config: %v", err)
+	}
+	asReq, err := messages.NewASReqForTGT(testRealm, c, types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"))
+	if err != nil {
+		t.Fatalf("error creating AS_REQ: %v", err)
+	}
+	return asReq
+}
+
+// kdcVerifyRequest performs the KDC's processing of the PA-PK-AS-REQ.
+func kdcVerifyRequest(t *testing.T, p *testPKI, asReq messages.ASReq) AuthPack {
+	var req PAPKASReq
+	for _, pa := range asReq.PAData {
+		if pa.PADataType == patype.PA_PK_AS_REQ {
+			if err := req.Unmarshal(pa.PADataValue); err != nil {
+				t.Fatalf("error unmarshaling PA-PK-AS-REQ: %v", err)
+			}
+		}
+	}
+	sd, err := ParseSignedData(req.SignedAuthPack)
+	if err != nil {
+		t.Fatalf("error parsing signed AuthPack: %v", err)
+	}
+	assert.True(t, sd.ContentType.Equal(OIDAuthData), "AuthPack content type not as expected")
+	cert, err := sd.Verify(p.verifyOptions())
+	if err != nil {
+		t.Fatalf("error verifying signed AuthPack: %v", err)
+	}
+	assert.Equal(t, p.clientCert.Raw, cert.Raw, "AuthPack signer not as expected")
+	var ap AuthPack
+	if _, err := asn1.Unmarshal(sd.Content, &ap); err != nil {
+		t.Fatalf("error unmarshaling AuthPack: %v", err)
+	}
+	bb, _ := asReq.ReqBody.Marshal()
+	sum := sha1.Sum(bb)
+	assert.Equal(t, sum[:], ap.PKAuthenticator.PAChecksum, "AuthPack checksum not as expected")
+	assert.Equal(t, asReq.ReqBody.Nonce, ap.PKAuthenticator.Nonce, "AuthPack nonce not as expected")
+	return ap
+}
+
+func TestRequest_ReplyKey_DH(t *testing.T) {
+	t.Parallel()
+	p := newTestPKI(t, true, true)
+	asReq := testASReq(t)
+	r, pa, err := NewRequest(asReq.ReqBody, p.clientCert, p.clientKey, nil, false, 0)
+	if err != nil {
+		t.Fatalf("error creating PKINIT request: %v", err)
+	}
+	asReq.PAData = append(asReq.PAData, pa)
+
+	ap := kdcVerifyRequest(t, p, asReq)
+	assert.True(t, ap.ClientPublicValue.Algorithm.Algorithm.Equal(oidDHPublicNumber), "client public value algorithm not as expected")
+	kdcDH, err := NewDHKey()
+	if err != nil {
+		t.Fatalf("error generating KDC DH key: %v", err)
+	}
+	z, err := kdcDH.SharedSecret(ap.ClientPublicValue.PublicKey)
+	if err != nil {
+		t.Fatalf("error agreeing shared secret: %v", err)
+	}
+	pub, _ := kdcDH.PublicValue()
+	kib, _ := asn1.Marshal(KDCDHKeyInfo{SubjectPublicKey: pub, Nonce: ap.PKAuthenticator.Nonce})
+	sd, err := NewSignedData(OIDDHKeyData, kib, p.kdcCert, p.kdcKey, nil)
+	if err != nil {
+		t.Fatalf("error signing KDCDHKeyInfo: %v", err)
+	}
+	rep := PAPKASRep{DHInfo: DHRepInfo{DHSignedData: sd}}
+	rb, err := rep.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling PA-PK-AS-REP: %v", err)
+	}
+	var asRep messages.ASRep
+	asRep.PAData = types.PADataSequence{{PADataType: patype.PA_PK_AS_REP, PADataValue: rb}}
+	asRep.EncPart.EType = etypeID.AES256_CTS_HMAC_SHA1_96
+
+	key, err := r.ReplyKey(asReq, asRep, p.verifyOptions())
+	if err != nil {
+		t.Fatalf("error getting reply key: %v", err)
+	}
+	expected, _ := OctetString2Key(z, etypeID.AES256_CTS_HMAC_SHA1_96)
+	assert.Equal(t, expected, key, "reply key not as expected")
+
+	// A reply signed by a certificate not issued to the KDC is rejected
+	sd, _ = NewSignedData(OIDDHKeyData, kib, p.clientCert, p.clientKey, nil)
+	rep = PAPKASRep{DHInfo: DHRepInfo{DHSignedData: sd}}
+	rb, _ = rep.Marshal()
+	asRep.PAData = types.PADataSequence{{PADataType: patype.PA_PK_AS_REP, PADataValue: rb}}
+	_, err = r.ReplyKey(asReq, asRep, p.verifyOptions())
+	assert.Error(t, err, "reply signed by the client's certificate should be rejected")
+}
+
+func TestRequest_ReplyKey_KeyTransport(t *testing.T) {
+	t.Parallel()
+	p := newTestPKI(t, true, true)
+	asReq := testASReq(t)
+	r, pa, err := NewRequest(asReq.ReqBody, p.clientCert, p.clientKey, nil, true, 0)
+	if err != nil {
+		t.Fatalf("error creating PKINIT request: %v", err)
+	}
+	asReq.PAData = append(asReq.PAData, pa)
+
+	ap := kdcVerifyRequest(t, p, asReq)
+	assert.Empty(t, ap.ClientPublicValue.PublicKey.Bytes, "client public value should not be sent for key transport")
+	et, _ := krbcrypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	replyKey, _ := types.GenerateEncryptionKey(et)
+	ab, _ := asReq.Marshal()
+	cksum, err := et.GetChecksumHash(replyKey.KeyValue, ab, KeyUsageASChecksum)
+	if err != nil {
+		t.Fatalf("error calculating AS_REQ checksum: %v", err)
+	}
+	rkp, _ := asn1.Marshal(ReplyKeyPack{
+		ReplyKey:   replyKey,
+		ASChecksum: types.Checksum{CksumType: et.GetHashID(), Checksum: cksum},
+	})
+	sd, err := NewSignedData(OIDRKeyData, rkp, p.kdcCert, p.kdcKey, nil)
+	if err != nil {
+		t.Fatalf("error signing ReplyKeyPack: %v", err)
+	}
+	// The EnvelopedData holds the SignedData itself rather than its ContentInfo
+	_, sdb, _ := unmarshalContentInfo(sd)
+	rep := PAPKASRep{EncKeyPack: envelope(t, p.clientCert, oidSignedData, sdb)}
+	rb, err := rep.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling PA-PK-AS-REP: %v", err)
+	}
+	var asRep messages.ASRep
+	asRep.PAData = types.PADataSequence{{PADataType: patype.PA_PK_AS_REP, PADataValue: rb}}
+
+	key, err := r.ReplyKey(asReq, asRep, p.verifyOptions())
+	if err != nil {
+		t.Fatalf("error getting reply key: %v", err)
+	}
+	assert.Equal(t, replyKey, key, "reply key not as expected")
+
+	// The checksum binds the reply key to the AS_REQ
+	asReq.ReqBody.Nonce++
+	_, err = r.ReplyKey(asReq, asRep, p.verifyOptions())
+	assert.Error(t, err, "reply key for a different AS_REQ should be rejected")
+}
+
+// envelope creates a CMS EnvelopedData of the content for the certificate using RSA key transport and AES-256-CBC.
+func envelope(t *testing.T, cert *x509.Certificate, contentType asn1.ObjectIdentifier, content []byte) []byte {
+	cek := make([]byte, 32)
+	iv := make([]byte, aes.BlockSize)
+	rand.Read(cek)
+	rand.Read(iv)
+	n := aes.BlockSize - len(content)%aes.BlockSize
+	pt := append(append([]byte{}, content...), bytes.Repeat([]byte{byte(n)}, n)...)
+	block, _ := aes.NewCipher(cek)
+	ct := make([]byte, len(pt))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ct, pt)
+	ek, err := rsa.EncryptPKCS1v15(rand.Reader, cert.PublicKey.(*rsa.PublicKey), cek)
+	if err != nil {
+		t.Fatalf("error encrypting content encryption key: %v", err)
+	}
+	type keyTransRecipientInfo struct {
+		Version                int
+		RID                    issuerAndSerialNumber
+		KeyEncryptionAlgorithm algorithmIdentifier
+		EncryptedKey           []byte
+	}
+	type encryptedContentInfo struct {
+		ContentType                asn1.ObjectIdentifier
+		ContentEncryptionAlgorithm algorithmIdentifier
+		EncryptedContent           []byte `asn1:"tag:0"`
+	}
+	type envelopedData struct {
+		Version              int
+		RecipientInfos       asn1.RawValue
+		EncryptedContentInfo encryptedContentInfo
+	}
+	ivb, _ := asn1.Marshal(iv)
+	ri, _ := asn1.Marshal(keyTransRecipientInfo{
+		RID:                    issuerAndSerialNumber{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, SerialNumber: cert.SerialNumber},
+		KeyEncryptionAlgorithm: algorithmIdentifier{Algorithm: oidRSAEncryption, Parameters: asn1Null},
+		EncryptedKey:           ek,
+	})
+	b, err := asn1.Marshal(envelopedData{
+		RecipientInfos: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: ri},
+		EncryptedContentInfo: encryptedContentInfo{
+			ContentType:                contentType,
+			ContentEncryptionAlgorithm: algorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivb}},
+			EncryptedContent:           ct,
+		},
+	})
+	if err != nil {
+		t.Fatalf("error marshaling EnvelopedData: %v", err)
+	}
+	ci, err := marshalContentInfo(oidEnvelopedData, b)
+	if err != nil {
+		t.Fatalf("error marshaling ContentInfo: %v", err)
+	}
+	return ci
+}
+
+func TestPrincipalNames(t *testing.T) {
+	t.Parallel()
+	p := newTestPKI(t, false, true)
+	names, err := PrincipalNames(p.kdcCert)
+	if err != nil {
+		t.Fatalf("error reading principal names: %v", err)
+	}
+	if assert.Len(t, names, 1, "number of principal names not as expected") {
+		assert.Equal(t, testRealm, names[0].Realm, "realm not as expected")
+		assert.Equal(t, "krbtgt/"+testRealm, names[0].PrincipalName.PrincipalNameString(), "principal name not as expected")
+	}
+}
+
+func TestVerifyKDC(t *testing.T) {
+	t.Parallel()
+	p := newTestPKI(t, true, true)
+	kdcEKU := []stdOID{stdOID(OIDKPKdc)}
+	var tests = []struct {
+		name      string
+		eku       []stdOID
+		san       []pkix.Extension
+		dnsNames  []string
+		hostnames []string
+		valid     bool
+	}{
+		{"EKU and realm SAN", kdcEKU, []pkix.Extension{pkinitSAN(t, testRealm, "krbtgt", testRealm)}, nil, nil, true},
+		{"EKU and DNS SAN of KDC host name", kdcEKU, nil, []string{"kdc.test.gokrb5"}, []string{"KDC.test.gokrb5"}, true},
+		{"EKU only", kdcEKU, nil, nil, nil, false},
+		{"EKU and SAN of another realm", kdcEKU, []pkix.Extension{pkinitSAN(t, "OTHER.GOKRB5", "krbtgt", "OTHER.GOKRB5")}, nil, nil, false},
+		{"EKU and SAN of a client", kdcEKU, []pkix.Extension{pkinitSAN(t, testRealm, "testuser1")}, nil, nil, false},
+		{"EKU and DNS SAN not a KDC host name", kdcEKU, nil, []string{"kdc.other.gokrb5"}, []string{"kdc.test.gokrb5"}, false},
+		{"EKU and DNS SAN without KDC host names", kdcEKU, nil, []string{"kdc.test.gokrb5"}, nil, false},
+		{"realm SAN only", nil, []pkix.Extension{pkinitSAN(t, testRealm, "krbtgt", testRealm)}, nil, nil, false},
+		{"client EKU and realm SAN", []stdOID{stdOID(OIDKPClientAuth)}, []pkix.Extension{pkinitSAN(t, testRealm, "krbtgt", testRealm)}, nil, nil, false},
+	}
+	for i, test := range tests {
+		cert, key := p.issue(t, &x509.Certificate{
+			SerialNumber:       big.NewInt(int64(10 + i)),
+			Subject:            pkix.Name{CommonName: "kdc"},
+			NotBefore:          time.Now().Add(-time.Hour),
+			NotAfter:           time.Now().Add(time.Hour),
+			KeyUsage:           x509.KeyUsageDigitalSignature,
+			UnknownExtKeyUsage: test.eku,
+			ExtraExtensions:    test.san,
+			DNSNames:           test.dnsNames,
+		}, p.kdcKey)
+		b, err := NewSignedData(OIDRKeyData, []byte("content"), cert, key, nil)
+		if err != nil {
+			t.Fatalf("error signing content for %s: %v", test.name, err)
+		}
+		sd, err := ParseSignedData(b)
+		if err != nil {
+			t.Fatalf("error parsing signed content for %s: %v", test.name, err)
+		}
+		err = verifyKDC(sd, testRealm, test.hostnames, p.verifyOptions())
+		if test.valid {
+			assert.NoError(t, err, "KDC certificate should be accepted with %s", test.name)
+		} else {
+			assert.Error(t, err, "KDC certificate should be rejected with %s", test.name)
+		}
+	}
+}
+
+func TestOctetString2Key(t *testing.T) {
+	t.Parallel()
+	x := []byte("shared secret")
+	h0 := sha1.Sum(append([]byte{0}, x...))
+	h1 := sha1.Sum(append([]byte{1}, x...))
+	k, err := OctetString2Key(x, etypeID.AES128_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error deriving key: %v", err)
+	}
+	assert.Equal(t, h0[:16], k.KeyValue, "AES128 key not as expected")
+	k, err = OctetString2Key(x, etypeID.AES256_CTS_HMAC_SHA1_96)
+	if err != nil {
+		t.Fatalf("error deriving key: %v", err)
+	}
+	assert.Equal(t, append(h0[:], h1[:12]...), k.KeyValue, "AES256 key not as expected")
+}
+
+func TestModp2048(t *testing.T) {
+	t.Parallel()
+	p, ok := new(big.Int).SetString(modp2048, 16)
+	if !assert.True(t, ok, "group prime not valid hex") {
+		return
+	}
+	assert.Equal(t, 2048, p.BitLen(), "group prime length not as expected")
+	// The group is a safe prime group
+	assert.True(t, p.ProbablyPrime(20), "group modulus is not prime")
+	assert.True(t, new(big.Int).Rsh(p, 1).ProbablyPrime(20), "group order is not prime")
+}
+
+func TestNewAnonymousRequest(t *testing.T) {
+	t.Parallel()
+	asReq := testASReq(t)
+	_, pa, err := NewAnonymousRequest(asReq.ReqBody, 0)
+	if err != nil {
+		t.Fatalf("error creating anonymous PKINIT request: %v", err)
+	}
+	var req PAPKASReq
+	if err := req.Unmarshal(pa.PADataValue); err != nil {
+		t.Fatalf("error unmarshaling PA-PK-AS-REQ: %v", err)
+	}
+	sd, err := ParseSignedData(req.SignedAuthPack)
+	if err != nil {
+		t.Fatalf("error parsing AuthPack: %v", err)
+	}
+	assert.Empty(t, sd.Certificates, "anonymous AuthPack should not include certificates")
+	_, err = sd.Verify(x509.VerifyOptions{})
+	assert.Error(t, err, "anonymous AuthPack should not be signed")
+	var ap AuthPack
+	if _, err := asn1.Unmarshal(sd.Content, &ap); err != nil {
+		t.Fatalf("error unmarshaling AuthPack: %v", err)
+	}
+	assert.True(t, ap.ClientPublicValue.Algorithm.Algorithm.Equal(oidDHPublicNumber), "anonymous PKINIT should use Diffie-Hellman")
+}
@@ -1,19 +1,82 @@
 package service
 
 import (
+	"fmt"
 	"time"
 
 	"github.com/Osirium/gokrb5/v8/credentials"
 	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
+	"github.com/Osirium/gokrb5/v8/krberror"
 	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/trace"
+	"github.com/Osirium/gokrb5/v8/types"
 )
 
 // VerifyAPREQ verifies an AP_REQ sent to the service. Returns a boolean for if the AP_REQ is valid and the client's principal name and realm.
 func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credentials, error) {
+	ok, creds, err := verifyAPREQ(APReq, s)
+	var code int32
+	if krberr, isKRBErr := err.(messages.KRBError); isKRBErr {
+		code = krberr.ErrorCode
+	}
+	s.Metrics().APReq(APReq.Ticket.Realm, ok, code)
+	if t := s.Tracer(); t != nil {
+		e := trace.Event{
+			Type:        trace.APReqAccepted,
+			Time:        time.Now().UTC(),
+			Realm:       APReq.Ticket.Realm,
+			MessageType: msgtype.KRB_AP_REQ,
+			Service:     APReq.Ticket.SName.PrincipalNameString(),
+			EType:       APReq.Ticket.EncPart.EType,
+		}
+		if ok {
+			e.Client = creds.CName().PrincipalNameString()
+		} else {
+			e.Type = trace.APReqRejected
+			e.Err = err
+			e.ErrorCode = code
+		}
+		if s.TraceMessages() {
+			e.Message, _ = APReq.Marshal()
+		}
+		t.Trace(e)
+	}
+	return ok, creds, err
+}
+
+func verifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credentials, error) {
 	var creds *credentials.Credentials
-	ok, err := APReq.Verify(s.Keytab, s.MaxClockSkew(), s.ClientAddress(), s.KeytabPrincipal())
-	if err != nil || !ok {
-		return false, creds, err
+	// The same keytab is used throughout in case the provider loads a new one
+	kt := s.currentKeytab()
+	p := s.ETypePolicy()
+	if !p.Permits(APReq.Ticket.EncPart.EType) {
+		return false, creds, messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KDC_ERR_ETYPE_NOSUPP, fmt.Sprintf("ticket encryption type %d not permitted", APReq.Ticket.EncPart.EType))
+	}
+	var sname *types.PrincipalName
+	// A user-to-user ticket is encrypted with the session key of the service's TGT rather than a key in the keytab
+	user2User := types.IsFlagSet(&APReq.APOptions, flags.APOptionUseSessionKey)
+	if user2User {
+		ok, err := verifyUser2User(APReq, s)
+		if err != nil || !ok {
+			return false, creds, err
+		}
+	} else {
+		var err error
+		sname, err = s.ticketPrincipal(kt, &APReq.Ticket)
+		if err != nil {
+			return false, creds, err
+		}
+		ok, err := APReq.Verify(kt, s.MaxClockSkew(), s.ClientAddress(), sname, messages.IgnoreTicketTimes(!s.EnforceTicketTimes()))
+		if err != nil || !ok {
+			return false, creds, err
+		}
+	}
+
+	if !p.Permits(APReq.Ticket.DecryptedEncPart.Key.KeyType) ||
+		(APReq.Authenticator.SubKey.KeyType != 0 && !p.Permits(APReq.Authenticator.SubKey.KeyType)) {
+		return false, creds, messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KDC_ERR_ETYPE_NOSUPP, "session key encryption type not permitted")
 	}
 
 	if s.RequireHostAddr() && len(APReq.Ticket.DecryptedEncPart.CAddr) < 1 {
@@ -22,8 +85,13 @@ func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credent
 	}
 
 	// Check for replay
-	rc := GetReplayCache(s.MaxClockSkew())
-	if rc.IsReplay(APReq.Ticket.SName, APReq.Authenticator) {
+	// An authenticator is recorded for as long as it is within the clock skew window, after which it is rejected as skewed
+	e := NewReplayEntry(APReq.Ticket.SName, APReq.Authenticator)
+	replay, err := s.AuthenticatorReplayCache().IsReplay(e, e.CTime.Add(s.MaxClockSkew()))
+	if err != nil {
+		return false, creds, krberror.Errorf(err, krberror.KRBMsgError, "could not check the replay cache")
+	}
+	if replay {
 		return false, creds,
 			messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_REPEAT, "replay detected")
 	}
@@ -35,14 +103,15 @@ func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credent
 	creds.SetValidUntil(APReq.Ticket.DecryptedEncPart.EndTime)
 
 	//PAC decoding
-	if !s.disablePACDecoding {
-		isPAC, pac, err := APReq.Ticket.GetPACType(s.Keytab, s.KeytabPrincipal(), s.Logger())
+	// The PAC of a user-to-user ticket cannot be verified without the service's long-term key
+	if !s.disablePACDecoding && !user2User {
+		isPAC, pac, err := APReq.Ticket.GetPACType(kt, sname, s.Logger(), s.pacVerifySettings()...)
 		if isPAC && err != nil {
 			return false, creds, err
 		}
 		if isPAC {
 			// There is a valid PAC. Adding attributes to creds
-			creds.SetADCredentials(credentials.ADCredentials{
+			a := credentials.ADCredentials{
 				GroupMembershipSIDs: pac.KerbValidationInfo.GetGroupMembershipSIDs(),
 				LogOnTime:           pac.KerbValidationInfo.LogOnTime.Time(),
 				LogOffTime:          pac.KerbValidationInfo.LogOffTime.Time(),
@@ -54,8 +123,25 @@ func VerifyAPREQ(APReq *messages.APReq, s *Settings) (bool, *credentials.Credent
 				LogonServer:         pac.KerbValidationInfo.LogonServer.Value,
 				LogonDomainName:     pac.KerbValidationInfo.LogonDomainName.Value,
 				LogonDomainID:       pac.KerbValidationInfo.LogonDomainID.String(),
-			})
+			}
+			if pac.S4UDelegationInfo != nil {
+				a.S4U2ProxyTarget = pac.S4UDelegationInfo.S4U2proxyTarget.Value
+				a.S4UTransitedServices = pac.S4UDelegationInfo.TransitedServices()
+			}
+			creds.SetADCredentials(a)
 		}
 	}
 	return true, creds, nil
 }
+
+// verifyUser2User verifies the AP_REQ of user-to-user authentication with the session key of the service's TGT.
+func verifyUser2User(APReq *messages.APReq, s *Settings) (bool, error) {
+	if s.user2UserKey == nil {
+		return false, messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_NO_TGT, "service does not accept user-to-user authentication")
+	}
+	key, err := s.user2UserKey()
+	if err != nil {
+		return false, messages.NewKRBError(APReq.Ticket.SName, APReq.Ticket.Realm, errorcode.KRB_AP_ERR_NO_TGT, fmt.Sprintf("could not get the TGT session key for user-to-user authentication: %v", err))
+	}
+	return APReq.VerifyWithSessionKey(key, s.MaxClockSkew(), s.ClientAddress(), messages.IgnoreTicketTimes(!s.EnforceTicketTimes()))
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/hex"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -9,12 +10,17 @@ import (
 	"github.com/Osirium/gokrb5/v8/client"
 	"github.com/Osirium/gokrb5/v8/config"
 	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/crypto"
 	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
 	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
 	"github.com/Osirium/gokrb5/v8/iana/nametype"
 	"github.com/Osirium/gokrb5/v8/keytab"
 	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/metrics"
 	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/trace"
 	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/stretchr/testify/assert"
 )
@@ -61,6 +67,233 @@ func TestVerifyAPREQ(t *testing.T) {
 	}
 }
 
+func TestVerifyAPREQ_Trace(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	var events []trace.Event
+	s := NewSettings(kt, ClientAddress(h), Tracer(trace.Func(func(e trace.Event) {
+		events = append(events, e)
+	})), TraceMessages(true))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one trace event, got %d", len(events))
+	}
+	assert.Equal(t, trace.APReqAccepted, events[0].Type, "trace event type not as expected")
+	assert.Equal(t, cl.Credentials.CName().PrincipalNameString(), events[0].Client, "client in trace event not as expected")
+	assert.Equal(t, "HTTP/host.test.gokrb5", events[0].Service, "service in trace event not as expected")
+	assert.Equal(t, int32(msgtype.KRB_AP_REQ), trace.MessageType(events[0].Message), "AP_REQ not included in trace event")
+
+	// The AP_REQ is rejected as a replay when verified again
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	if ok || err == nil {
+		t.Fatal("Validation of replayed AP_REQ should have failed")
+	}
+	assert.Len(t, events, 2, "expected a trace event for the rejected AP_REQ")
+	assert.Equal(t, trace.APReqRejected, events[1].Type, "trace event type not as expected")
+	assert.Equal(t, errorcode.KRB_AP_ERR_REPEAT, events[1].ErrorCode, "error code in trace event not as expected")
+}
+
+func TestVerifyAPREQ_Metrics(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	r := new(apReqRecorder)
+	s := NewSettings(kt, ClientAddress(h), Metrics(r))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+
+	// The AP_REQ is rejected as a replay when verified again
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	if ok || err == nil {
+		t.Fatal("Validation of replayed AP_REQ should have failed")
+	}
+	assert.Equal(t, []string{"TEST.GOKRB5 true 0", fmt.Sprintf("TEST.GOKRB5 false %d", errorcode.KRB_AP_ERR_REPEAT)}, r.apReqs, "AP_REQs recorded not as expected")
+}
+
+// apReqRecorder is a metrics.Recorder that keeps the AP_REQs recorded.
+type apReqRecorder struct {
+	metrics.Nop
+	apReqs []string
+}
+
+func (r *apReqRecorder) APReq(realm string, accepted bool, code int32) {
+	r.apReqs = append(r.apReqs, fmt.Sprintf("%s %v %d", realm, accepted, code))
+}
+
+type staticKeytabProvider struct {
+	kt *keytab.Keytab
+}
+
+func (p staticKeytabProvider) Keytab() *keytab.Keytab {
+	return p.kt
+}
+
+func TestVerifyAPREQWithKeytabProvider(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	// The provider's keytab takes precedence over the empty static keytab
+	s := NewSettings(keytab.New(), ClientAddress(h), KeytabProvider(staticKeytabProvider{kt: kt}))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+}
+
+func TestVerifyAPREQAcceptAnyPrincipal(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	key, _, err := kt.GetKey(types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5"), "TEST.GOKRB5", 1, 18)
+	if err != nil {
+		t.Fatalf("Error getting key from test keytab: %v", err)
+	}
+	// The ticket is for an alias of the service that shares its key but is not in the service's keytab
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_HST, "HTTP/alias.test.gokrb5")
+	aliasKT := keytab.New()
+	aliasKT.AddKey(sname.PrincipalNameString(), "TEST.GOKRB5", key, time.Now(), 1)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		aliasKT,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	newAPReq := func() messages.APReq {
+		APReq, err := messages.NewAPReq(
+			tkt,
+			sessionKey,
+			newTestAuthenticator(*cl.Credentials),
+		)
+		if err != nil {
+			t.Fatalf("Error getting test AP_REQ: %v", err)
+		}
+		return APReq
+	}
+
+	APReq := newAPReq()
+	ok, _, err := VerifyAPREQ(&APReq, NewSettings(kt, ClientAddress(h)))
+	if ok || err == nil {
+		t.Fatal("Validation of AP_REQ for principal not in keytab passed when it should not have")
+	}
+
+	APReq = newAPReq()
+	ok, _, err = VerifyAPREQ(&APReq, NewSettings(kt, ClientAddress(h), AcceptAnyPrincipal(true)))
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+}
+
 func TestVerifyAPREQWithPrincipalOverride(t *testing.T) {
 	t.Parallel()
 	cl := getClient()
@@ -201,6 +434,7 @@ func TestVerifyAPREQ_LargeClockSkew(t *testing.T) {
 	}
 	if _, ok := err.(messages.KRBError); ok {
 		assert.Equal(t, errorcode.KRB_AP_ERR_SKEW, err.(messages.KRBError).ErrorCode, "Error code not as expected")
+		assert.Contains(t, err.Error(), "greater than the maximum of 5m0s", "Error message not as expected")
 	} else {
 		t.Fatalf("Error is not a KRBError: %v", err)
 	}
@@ -400,6 +634,175 @@ func TestVerifyAPREQ_ExpiredTicket(t *testing.T) {
 	}
 }
 
+func TestVerifyAPREQ_EnforceTicketTimes(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(-30)*time.Minute),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	assert.True(t, NewSettings(kt).EnforceTicketTimes(), "ticket times not enforced by default")
+	s := NewSettings(kt, ClientAddress(h), EnforceTicketTimes(false))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ with an expired ticket failed when ticket times are not enforced: %v", err)
+	}
+}
+
+func TestVerifyAPREQ_WeakEType(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "HTTP/host.test.gokrb5")
+	kt := keytab.New()
+	kt.AddEntry("HTTP/host.test.gokrb5", "TEST.GOKRB5", "passwordvalue", time.Now(), 1, etypeID.RC4_HMAC)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		etypeID.RC4_HMAC,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+
+	// Weak etypes are not permitted by default
+	s := NewSettings(kt, ClientAddress(h))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if ok || err == nil {
+		t.Fatal("Validation of AP_REQ with a weak etype passed when it should not have")
+	}
+	if _, ok := err.(messages.KRBError); ok {
+		assert.Equal(t, errorcode.KDC_ERR_ETYPE_NOSUPP, err.(messages.KRBError).ErrorCode, "Error code not as expected")
+	} else {
+		t.Fatalf("Error is not a KRBError: %v", err)
+	}
+
+	c, _ := config.NewFromString("[libdefaults]\n allow_weak_crypto = true\n")
+	s = NewSettings(kt, ClientAddress(h), ETypePolicy(c.LibDefaults.ETypePolicy()))
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when weak etypes are allowed: %v", err)
+	}
+
+	// The policy of the configuration from the provider is used, as it changes
+	store := config.NewStore(config.New())
+	s = NewSettings(kt, ClientAddress(h), ConfigProvider(store))
+	ok, _, _ = VerifyAPREQ(&APReq, s)
+	assert.False(t, ok, "Validation of AP_REQ with a weak etype passed when the provided config does not allow it")
+	store.Set(c)
+	APReq, err = messages.NewAPReq(tkt, sessionKey, newTestAuthenticator(*cl.Credentials))
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	ok, _, err = VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of AP_REQ failed when the provided config allows weak etypes: %v", err)
+	}
+}
+
+func TestVerifyAPREQ_User2User(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "peer")
+	// The user-to-user ticket is encrypted with the session key of the peer's TGT
+	et, _ := crypto.GetEtype(18)
+	tgtKey, err := types.GenerateEncryptionKey(et)
+	if err != nil {
+		t.Fatalf("Error generating TGT session key: %v", err)
+	}
+	kt := keytab.New()
+	kt.AddKey("peer", "TEST.GOKRB5", tgtKey, time.Now(), 1)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	types.SetFlag(&APReq.APOptions, flags.APOptionUseSessionKey)
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+
+	// Services not configured for user-to-user authentication reject the AP_REQ
+	s := NewSettings(nil, ClientAddress(h))
+	ok, _, err := VerifyAPREQ(&APReq, s)
+	if ok || err == nil {
+		t.Fatal("Validation of user-to-user AP_REQ passed when it should not have")
+	}
+	if _, ok := err.(messages.KRBError); ok {
+		assert.Equal(t, errorcode.KRB_AP_ERR_NO_TGT, err.(messages.KRBError).ErrorCode, "Error code not as expected")
+	} else {
+		t.Fatalf("Error is not a KRBError: %v", err)
+	}
+
+	s = NewSettings(nil, ClientAddress(h), User2User(func() (types.EncryptionKey, error) {
+		return tgtKey, nil
+	}))
+	ok, creds, err := VerifyAPREQ(&APReq, s)
+	if !ok || err != nil {
+		t.Fatalf("Validation of user-to-user AP_REQ failed when it should not have: %v", err)
+	}
+	assert.Equal(t, cl.Credentials.CName(), creds.CName(), "Client name not as expected")
+}
+
 func newTestAuthenticator(creds credentials.Credentials) types.Authenticator {
 	auth, _ := types.NewAuthenticator(creds.Domain(), creds.CName())
 	auth.GenerateSeqNumberAndSubKey(18, 32)
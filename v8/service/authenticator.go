@@ -41,7 +41,11 @@ func (a KRB5BasicAuthenticator) Authenticate() (i goidentity.Identity, ok bool,
 		err = fmt.Errorf("could not parse basic authentication header: %v", err)
 		return
 	}
-	cl := client.NewWithPassword(a.username, a.realm, a.password, a.clientConfig)
+	c := a.clientConfig
+	if p := a.serviceSettings.ConfigProvider(); p != nil {
+		c = p.Config()
+	}
+	cl := client.NewWithPassword(a.username, a.realm, a.password, c)
 	err = cl.Login()
 	if err != nil {
 		// Username and/or password could be wrong
@@ -53,14 +57,20 @@ func (a KRB5BasicAuthenticator) Authenticate() (i goidentity.Identity, ok bool,
 		err = fmt.Errorf("could not get service ticket: %v", err)
 		return
 	}
-	err = tkt.DecryptEncPart(a.serviceSettings.Keytab, a.serviceSettings.KeytabPrincipal())
+	kt := a.serviceSettings.currentKeytab()
+	sname, err := a.serviceSettings.ticketPrincipal(kt, &tkt)
+	if err != nil {
+		err = fmt.Errorf("could not decrypt service ticket: %v", err)
+		return
+	}
+	err = tkt.DecryptEncPart(kt, sname)
 	if err != nil {
 		err = fmt.Errorf("could not decrypt service ticket: %v", err)
 		return
 	}
 	cl.Credentials.SetAuthTime(time.Now().UTC())
 	cl.Credentials.SetAuthenticated(true)
-	isPAC, pac, err := tkt.GetPACType(a.serviceSettings.Keytab, a.serviceSettings.KeytabPrincipal(), a.serviceSettings.Logger())
+	isPAC, pac, err := tkt.GetPACType(kt, sname, a.serviceSettings.Logger(), a.serviceSettings.pacVerifySettings()...)
 	if isPAC && err != nil {
 		err = fmt.Errorf("error processing PAC: %v", err)
 		return
@@ -10,6 +10,8 @@ import (
 // Replay cache is required as specified in RFC 4120 section 3.2.3
 
 // Cache for tickets received from clients keyed by fully qualified client name. Used to track replay of tickets.
+//
+// Deprecated: AP_REQs are verified against a ReplayCache, a MemoryReplayCache by default.
 type Cache struct {
 	entries map[string]clientEntries
 	mux     sync.RWMutex
@@ -52,6 +54,8 @@ var replayCache Cache
 var once sync.Once
 
 // GetReplayCache returns a pointer to the Cache singleton.
+//
+// Deprecated: AP_REQs are verified against a ReplayCache, a MemoryReplayCache by default.
 func GetReplayCache(d time.Duration) *Cache {
 	// Create a singleton of the ReplayCache and start a background thread to regularly clean out old entries
 	once.Do(func() {
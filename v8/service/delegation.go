@@ -0,0 +1,49 @@
+package service
+
+import (
+	"encoding/binary"
+
+	"github.com/Osirium/gokrb5/v8/gssapi"
+	"github.com/Osirium/gokrb5/v8/iana/chksumtype"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/messages"
+)
+
+// DelegatedCredentials returns the credentials delegated to the service in the GSS-API checksum of the AP_REQ's
+// authenticator (RFC 4121 section 4.1.1), if the client delegated any. The AP_REQ must have been verified. The KRB_CRED
+// returned is decrypted and can be used to create a client that acts on behalf of the user with client.NewFromKRBCred.
+func DelegatedCredentials(APReq *messages.APReq) (messages.KRBCred, bool, error) {
+	var cred messages.KRBCred
+	c := APReq.Authenticator.Cksum
+	if c.CksumType != chksumtype.GSSAPI || len(c.Checksum) < 24 {
+		return cred, false, nil
+	}
+	if binary.LittleEndian.Uint32(c.Checksum[20:24])&gssapi.ContextFlagDeleg == 0 {
+		return cred, false, nil
+	}
+	if len(c.Checksum) < 28 || binary.LittleEndian.Uint16(c.Checksum[24:26]) != 1 {
+		return cred, false, nil
+	}
+	l := int(binary.LittleEndian.Uint16(c.Checksum[26:28]))
+	if l == 0 {
+		return cred, false, nil
+	}
+	if len(c.Checksum) < 28+l {
+		return cred, false, krberror.NewErrorf(krberror.EncodingError, "delegated credentials length %d exceeds the authenticator checksum", l)
+	}
+	err := cred.Unmarshal(c.Checksum[28 : 28+l])
+	if err != nil {
+		return cred, false, krberror.Errorf(err, krberror.EncodingError, "error unmarshaling delegated credentials")
+	}
+	// The KRB_CRED is encrypted with the authenticator's subkey, if there is one, otherwise the ticket's session key
+	if len(APReq.Authenticator.SubKey.KeyValue) > 0 {
+		if err = cred.DecryptEncPart(APReq.Authenticator.SubKey); err == nil {
+			return cred, true, nil
+		}
+	}
+	err = cred.DecryptEncPart(APReq.Ticket.DecryptedEncPart.Key)
+	if err != nil {
+		return cred, false, krberror.Errorf(err, krberror.DecryptingError, "error decrypting delegated credentials")
+	}
+	return cred, true, nil
+}
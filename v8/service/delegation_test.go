@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/gssapi"
+	"github.com/Osirium/gokrb5/v8/iana/chksumtype"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// delegationChksum returns a GSS-API authenticator checksum that delegates the KRB_CRED provided.
+func delegationChksum(t *testing.T, cred messages.KRBCred) types.Checksum {
+	b, err := cred.Marshal()
+	if err != nil {
+		t.Fatalf("error marshaling KRB_CRED: %v", err)
+	}
+	c := make([]byte, 28)
+	binary.LittleEndian.PutUint32(c[:4], 16)
+	binary.LittleEndian.PutUint32(c[20:24], gssapi.ContextFlagDeleg|gssapi.ContextFlagInteg)
+	binary.LittleEndian.PutUint16(c[24:26], 1)
+	binary.LittleEndian.PutUint16(c[26:28], uint16(len(b)))
+	return types.Checksum{CksumType: chksumtype.GSSAPI, Checksum: append(c, b...)}
+}
+
+func TestDelegatedCredentials(t *testing.T) {
+	t.Parallel()
+	et, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	sessionKey, _ := types.GenerateEncryptionKey(et)
+	subKey, _ := types.GenerateEncryptionKey(et)
+	sname := types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/"+testdata.TEST_REALM)
+	tgt := messages.Ticket{
+		TktVNO:  5,
+		Realm:   testdata.TEST_REALM,
+		SName:   sname,
+		EncPart: types.EncryptedData{EType: etypeID.AES256_CTS_HMAC_SHA1_96, Cipher: []byte("cipher")},
+	}
+	info := messages.KrbCredInfo{
+		Key:    subKey,
+		PRealm: testdata.TEST_REALM,
+		PName:  types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"),
+		SRealm: testdata.TEST_REALM,
+		SName:  sname,
+	}
+
+	var tests = []struct {
+		name   string
+		subKey types.EncryptionKey
+		key    types.EncryptionKey
+	}{
+		{"subkey", subKey, subKey},
+		{"session key", types.EncryptionKey{}, sessionKey},
+	}
+	for _, test := range tests {
+		cred, err := messages.NewKRBCred([]messages.Ticket{tgt}, []messages.KrbCredInfo{info}, test.key)
+		if err != nil {
+			t.Fatalf("%s: error creating KRB_CRED: %v", test.name, err)
+		}
+		var apReq messages.APReq
+		apReq.Ticket.DecryptedEncPart.Key = sessionKey
+		apReq.Authenticator.SubKey = test.subKey
+		apReq.Authenticator.Cksum = delegationChksum(t, cred)
+		dc, ok, err := DelegatedCredentials(&apReq)
+		if err != nil {
+			t.Fatalf("%s: error getting delegated credentials: %v", test.name, err)
+		}
+		assert.True(t, ok, "%s: delegated credentials not found", test.name)
+		if assert.Len(t, dc.DecryptedEncPart.TicketInfo, 1, "%s: number of ticket infos not as expected", test.name) {
+			assert.Equal(t, info.PName, dc.DecryptedEncPart.TicketInfo[0].PName, "%s: principal not as expected", test.name)
+		}
+	}
+
+	// Without the delegation flag there are no delegated credentials
+	var apReq messages.APReq
+	c := make([]byte, 24)
+	binary.LittleEndian.PutUint32(c[:4], 16)
+	apReq.Authenticator.Cksum = types.Checksum{CksumType: chksumtype.GSSAPI, Checksum: c}
+	_, ok, err := DelegatedCredentials(&apReq)
+	assert.NoError(t, err, "error not expected without delegation")
+	assert.False(t, ok, "delegated credentials not expected")
+}
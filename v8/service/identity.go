@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/goidentity/v6"
+)
+
+// Identity is the identity of a client authenticated by a service. It carries the authorization data from the PAC of
+// the client's ticket, so that authorization decisions can be made without parsing the PAC again.
+type Identity interface {
+	goidentity.Identity
+	// Principal returns the client's principal name.
+	Principal() types.PrincipalName
+	// Realm returns the client's realm.
+	Realm() string
+	// UserSID returns the security identifier of the user, empty if the ticket had no PAC.
+	UserSID() string
+	// GroupSIDs returns the security identifiers of the groups the user is a member of, from the PAC.
+	GroupSIDs() []string
+	// LogonTime returns the time the user logged on, from the PAC.
+	LogonTime() time.Time
+	// DelegationTarget returns the service the client's ticket was obtained for by constrained delegation (S4U2Proxy),
+	// from the PAC. It is empty if the ticket was not obtained by delegation.
+	DelegationTarget() string
+	// TransitedServices returns the services the client's ticket has been delegated through, from the PAC, so that the
+	// delegation chain of a request can be audited.
+	TransitedServices() []string
+	// SessionKey returns the key of the session established with the client, the subkey of the client's authenticator
+	// if it provided one or the session key of its ticket otherwise. It is empty for an identity restored from a
+	// session, as the key is not kept with the credentials.
+	SessionKey() types.EncryptionKey
+}
+
+// identity implements Identity over the client's credentials.
+type identity struct {
+	*credentials.Credentials
+	sessionKey types.EncryptionKey
+}
+
+// NewIdentity returns the Identity of the authenticated credentials, for the session key provided.
+func NewIdentity(creds *credentials.Credentials, sessionKey types.EncryptionKey) Identity {
+	return &identity{
+		Credentials: creds,
+		sessionKey:  sessionKey,
+	}
+}
+
+// VerifyAPREQIdentity verifies an AP_REQ sent to the service as VerifyAPREQ does, returning the Identity of the
+// authenticated client.
+func VerifyAPREQIdentity(APReq *messages.APReq, s *Settings) (Identity, error) {
+	ok, creds, err := VerifyAPREQ(APReq, s)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("AP_REQ not valid")
+	}
+	key := APReq.Ticket.DecryptedEncPart.Key
+	if APReq.Authenticator.SubKey.KeyType != 0 {
+		key = APReq.Authenticator.SubKey
+	}
+	return NewIdentity(creds, key), nil
+}
+
+// Principal returns the client's principal name.
+func (i *identity) Principal() types.PrincipalName {
+	return i.CName()
+}
+
+// UserSID returns the security identifier of the user, empty if the ticket had no PAC.
+func (i *identity) UserSID() string {
+	a := i.GetADCredentials()
+	if a.LogonDomainID == "" {
+		return ""
+	}
+	return a.LogonDomainID + "-" + strconv.Itoa(a.UserID)
+}
+
+// GroupSIDs returns the security identifiers of the groups the user is a member of, from the PAC.
+func (i *identity) GroupSIDs() []string {
+	return i.GetADCredentials().GroupMembershipSIDs
+}
+
+// LogonTime returns the time the user logged on, from the PAC.
+func (i *identity) LogonTime() time.Time {
+	return i.GetADCredentials().LogOnTime
+}
+
+// DelegationTarget returns the service the client's ticket was obtained for by constrained delegation.
+func (i *identity) DelegationTarget() string {
+	return i.GetADCredentials().S4U2ProxyTarget
+}
+
+// TransitedServices returns the services the client's ticket has been delegated through.
+func (i *identity) TransitedServices() []string {
+	return i.GetADCredentials().S4UTransitedServices
+}
+
+// SessionKey returns the key of the session established with the client.
+func (i *identity) SessionKey() types.EncryptionKey {
+	return i.sessionKey
+}
+
+// String returns the principal name of the identity in the form principal@realm.
+func (i *identity) String() string {
+	return i.CName().PrincipalNameString() + "@" + i.Realm()
+}
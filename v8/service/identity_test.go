@@ -0,0 +1,169 @@
+package service
+
+import (
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/crypto"
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/pac"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/rpc/v2/mstypes"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewIdentity(t *testing.T) {
+	t.Parallel()
+	creds := credentials.New("testuser1", "TEST.GOKRB5")
+	lt := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	creds.SetADCredentials(credentials.ADCredentials{
+		UserID:              1105,
+		LogonDomainID:       "S-1-5-21-1-2-3",
+		LogOnTime:           lt,
+		GroupMembershipSIDs: []string{"S-1-5-21-1-2-3-513", "S-1-5-21-1-2-3-1108"},
+	})
+	key := types.EncryptionKey{KeyType: 18, KeyValue: []byte{1, 2, 3}}
+	id := NewIdentity(creds, key)
+	assert.Equal(t, creds.CName(), id.Principal(), "principal not as expected")
+	assert.Equal(t, "TEST.GOKRB5", id.Realm(), "realm not as expected")
+	assert.Equal(t, "testuser1", id.UserName(), "user name not as expected")
+	assert.Equal(t, "S-1-5-21-1-2-3-1105", id.UserSID(), "user SID not as expected")
+	assert.Equal(t, []string{"S-1-5-21-1-2-3-513", "S-1-5-21-1-2-3-1108"}, id.GroupSIDs(), "group SIDs not as expected")
+	assert.True(t, id.Authorized("S-1-5-21-1-2-3-513"), "group membership not an authorization attribute")
+	assert.Equal(t, lt, id.LogonTime(), "logon time not as expected")
+	assert.Equal(t, key, id.SessionKey(), "session key not as expected")
+
+	id = NewIdentity(credentials.New("testuser1", "TEST.GOKRB5"), types.EncryptionKey{})
+	assert.Empty(t, id.UserSID(), "user SID of credentials without a PAC not empty")
+	assert.Empty(t, id.GroupSIDs(), "group SIDs of credentials without a PAC not empty")
+	assert.Empty(t, id.DelegationTarget(), "delegation target of credentials without a PAC not empty")
+	assert.Empty(t, id.TransitedServices(), "transited services of credentials without a PAC not empty")
+}
+
+func TestVerifyAPREQIdentity(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	a := newTestAuthenticator(*cl.Credentials)
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		a,
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	s := NewSettings(kt, ClientAddress(h))
+	id, err := VerifyAPREQIdentity(&APReq, s)
+	if err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+	assert.Equal(t, cl.Credentials.CName(), id.Principal(), "principal not as expected")
+	assert.Equal(t, "TEST.GOKRB5", id.Realm(), "realm not as expected")
+	assert.True(t, id.Authenticated(), "identity not authenticated")
+	// The authenticator's subkey takes precedence over the ticket's session key
+	assert.Equal(t, a.SubKey, id.SessionKey(), "session key not as expected")
+
+	// Replay
+	_, err = VerifyAPREQIdentity(&APReq, s)
+	assert.Error(t, err, "replayed AP_REQ verified")
+}
+
+func TestVerifyAPREQIdentity_PAC(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	etype, _ := crypto.GetEtype(etypeID.AES256_CTS_HMAC_SHA1_96)
+	kdcKey, _ := types.GenerateEncryptionKey(etype)
+	domain, _ := pac.ParseSID("S-1-5-21-1-2-3")
+	st := time.Now().UTC()
+	pb := pac.NewBuilder("testuser1", "TEST", domain, 1105, st).AddGroups(pac.RIDDomainAdmins)
+	pb.S4UDelegationInfo = &pac.S4UDelegationInfo{
+		S4U2proxyTarget:      mstypes.RPCUnicodeString{Value: "HTTP/host.test.gokrb5"},
+		S4UTransitedServices: []mstypes.RPCUnicodeString{{Value: "HTTP/frontend.test.gokrb5@TEST.GOKRB5"}},
+	}
+	tkt, sessionKey, err := messages.NewTicketWithPAC(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+		pb,
+		kdcKey,
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	s := NewSettings(kt, ClientAddress(h), PACKDCVerifier(pac.NewKDCKeyVerifier(kdcKey)), RequirePACTicketChecksum(true))
+	id, err := VerifyAPREQIdentity(&APReq, s)
+	if err != nil {
+		t.Fatalf("Validation of AP_REQ failed when it should not have: %v", err)
+	}
+	assert.Equal(t, "S-1-5-21-1-2-3-1105", id.UserSID(), "user SID not as expected")
+	assert.Equal(t, []string{"S-1-5-21-1-2-3-513", "S-1-5-21-1-2-3-512"}, id.GroupSIDs(), "group SIDs not as expected")
+	assert.Equal(t, "HTTP/host.test.gokrb5", id.DelegationTarget(), "delegation target not as expected")
+	assert.Equal(t, []string{"HTTP/frontend.test.gokrb5@TEST.GOKRB5"}, id.TransitedServices(), "transited services not as expected")
+
+	// The PAC's KDC signatures do not verify with another KDC key
+	otherKey, _ := types.GenerateEncryptionKey(etype)
+	APReq, err = messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+	s = NewSettings(kt, ClientAddress(h), PACKDCVerifier(pac.NewKDCKeyVerifier(otherKey)))
+	_, err = VerifyAPREQIdentity(&APReq, s)
+	assert.Error(t, err, "PAC with KDC signatures made with another key verified")
+}
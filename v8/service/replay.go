@@ -0,0 +1,241 @@
+package service
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/types"
+)
+
+// defaultReplayCacheCapacity is the number of authenticators the default replay cache holds.
+const defaultReplayCacheCapacity = 100000
+
+// defaultReplayCache is the replay cache shared by services not configured with one, so that replays are detected
+// across the Settings of each request.
+var defaultReplayCache = NewMemoryReplayCache(defaultReplayCacheCapacity)
+
+// ReplayCache records the authenticators of the AP_REQs accepted by a service, so that the replay of an
+// authenticator within the clock skew window is detected as RFC 4120 section 3.2.3 requires of acceptors.
+//
+// A replay cache shared by the instances of a service, such as one kept in Redis, implements IsReplay by setting the
+// entry's key only if it is not already set, expiring at the time provided (SET key value NX PXAT expiry).
+type ReplayCache interface {
+	// IsReplay tests if the entry was recorded before and has not expired. If it is not a replay the entry is recorded
+	// until the expiry time.
+	IsReplay(e ReplayEntry, expiry time.Time) (bool, error)
+}
+
+// ReplayEntry identifies an authenticator presented to a service.
+type ReplayEntry struct {
+	CName    types.PrincipalName
+	CRealm   string
+	SName    types.PrincipalName
+	CTime    time.Time // This combines the authenticator's CTime and Cusec
+	Checksum []byte
+}
+
+// NewReplayEntry returns the entry of the authenticator presented to the service.
+func NewReplayEntry(sname types.PrincipalName, a types.Authenticator) ReplayEntry {
+	return ReplayEntry{
+		CName:    a.CName,
+		CRealm:   a.CRealm,
+		SName:    sname,
+		CTime:    a.CTime.Add(time.Duration(a.Cusec) * time.Microsecond),
+		Checksum: a.Cksum.Checksum,
+	}
+}
+
+// Key returns the key identifying the entry, a hex encoded SHA-256 hash of its fields.
+func (e ReplayEntry) Key() string {
+	h := sha256.New()
+	for _, s := range []string{e.CName.PrincipalNameString(), e.CRealm, e.SName.PrincipalNameString()} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(e.CTime.UnixNano()))
+	h.Write(b)
+	h.Write(e.Checksum)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// MemoryReplayCache is a ReplayCache held in memory. Once it holds its capacity of entries the least recently used
+// entry is evicted, even if it has not expired, to bound the memory used.
+type MemoryReplayCache struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	lru      *list.List
+}
+
+// replayElement is an entry of a MemoryReplayCache.
+type replayElement struct {
+	key    string
+	expiry time.Time
+}
+
+// NewMemoryReplayCache returns an empty MemoryReplayCache holding up to the capacity of entries provided.
+func NewMemoryReplayCache(capacity int) *MemoryReplayCache {
+	if capacity < 1 {
+		capacity = defaultReplayCacheCapacity
+	}
+	return &MemoryReplayCache{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// IsReplay tests if the entry was recorded before and has not expired. If it is not a replay the entry is recorded
+// until the expiry time.
+func (c *MemoryReplayCache) IsReplay(e ReplayEntry, expiry time.Time) (bool, error) {
+	return c.isReplay(e.Key(), expiry), nil
+}
+
+func (c *MemoryReplayCache) isReplay(key string, expiry time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if el, ok := c.entries[key]; ok {
+		if now.Before(el.Value.(*replayElement).expiry) {
+			c.lru.MoveToFront(el)
+			return true
+		}
+		c.remove(el)
+	}
+	// Remove the expired entries at the back before evicting any entry that has not expired
+	for el := c.lru.Back(); el != nil && !now.Before(el.Value.(*replayElement).expiry); el = c.lru.Back() {
+		c.remove(el)
+	}
+	if c.lru.Len() >= c.capacity {
+		c.remove(c.lru.Back())
+	}
+	c.entries[key] = c.lru.PushFront(&replayElement{key: key, expiry: expiry})
+	return false
+}
+
+func (c *MemoryReplayCache) remove(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*replayElement).key)
+}
+
+// Len returns the number of entries in the cache, including any expired ones not yet removed.
+func (c *MemoryReplayCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+// FileReplayCache is a ReplayCache held in memory and persisted to a file, so that replays are detected across
+// restarts of the service. Each entry recorded is appended to the file, which is compacted to the entries that have
+// not expired when the cache is opened.
+type FileReplayCache struct {
+	mu    sync.Mutex
+	cache *MemoryReplayCache
+	file  *os.File
+}
+
+// NewFileReplayCache opens the replay cache persisted to the file at the path provided, creating it if it does not
+// exist, holding up to the capacity of entries provided.
+func NewFileReplayCache(path string, capacity int) (*FileReplayCache, error) {
+	c := &FileReplayCache{cache: NewMemoryReplayCache(capacity)}
+	if err := c.load(path); err != nil {
+		return nil, err
+	}
+	// Compact the file to the entries loaded
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return nil, fmt.Errorf("could not compact replay cache file: %v", err)
+	}
+	w := bufio.NewWriter(tmp)
+	for el := c.cache.lru.Back(); el != nil; el = el.Prev() {
+		e := el.Value.(*replayElement)
+		fmt.Fprintf(w, "%s %d\n", e.key, e.expiry.UnixNano())
+	}
+	err = w.Flush()
+	if err == nil {
+		err = tmp.Chmod(0600)
+	}
+	if err == nil {
+		err = tmp.Close()
+	} else {
+		tmp.Close()
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, fmt.Errorf("could not compact replay cache file: %v", err)
+	}
+	c.file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("could not open replay cache file: %v", err)
+	}
+	return c, nil
+}
+
+// load reads the entries that have not expired from the file, if it exists.
+func (c *FileReplayCache) load(path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("could not open replay cache file: %v", err)
+	}
+	defer f.Close()
+	now := time.Now()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 {
+			// A partially written entry is ignored
+			continue
+		}
+		ns, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if expiry := time.Unix(0, ns); now.Before(expiry) {
+			c.cache.isReplay(fields[0], expiry)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return fmt.Errorf("could not read replay cache file: %v", err)
+	}
+	return nil
+}
+
+// IsReplay tests if the entry was recorded before and has not expired. If it is not a replay the entry is recorded
+// until the expiry time and appended to the file.
+func (c *FileReplayCache) IsReplay(e ReplayEntry, expiry time.Time) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	key := e.Key()
+	if c.cache.isReplay(key, expiry) {
+		return true, nil
+	}
+	if _, err := fmt.Fprintf(c.file, "%s %d\n", key, expiry.UnixNano()); err != nil {
+		return false, fmt.Errorf("could not write replay cache file: %v", err)
+	}
+	return false, nil
+}
+
+// Close closes the file the cache is persisted to.
+func (c *FileReplayCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.file.Close()
+}
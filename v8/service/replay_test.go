@@ -0,0 +1,167 @@
+package service
+
+import (
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func testReplayEntry(i int) ReplayEntry {
+	return ReplayEntry{
+		CName:    types.NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "testuser1"),
+		CRealm:   "TEST.GOKRB5",
+		SName:    types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/host.test.gokrb5"),
+		CTime:    time.Unix(1600000000, int64(i)*1000),
+		Checksum: []byte{1, 2, 3},
+	}
+}
+
+func TestReplayEntry_Key(t *testing.T) {
+	t.Parallel()
+	e := testReplayEntry(0)
+	assert.Equal(t, e.Key(), testReplayEntry(0).Key(), "keys of the same entry differ")
+	assert.NotEqual(t, e.Key(), testReplayEntry(1).Key(), "keys of entries with different times equal")
+	o := testReplayEntry(0)
+	o.Checksum = []byte{1, 2, 4}
+	assert.NotEqual(t, e.Key(), o.Key(), "keys of entries with different checksums equal")
+	o = testReplayEntry(0)
+	o.SName = types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "HTTP/other.test.gokrb5")
+	assert.NotEqual(t, e.Key(), o.Key(), "keys of entries for different services equal")
+
+	a := types.Authenticator{
+		CRealm: "TEST.GOKRB5",
+		CName:  e.CName,
+		Cksum:  types.Checksum{Checksum: []byte{1, 2, 3}},
+		Cusec:  1,
+		CTime:  time.Unix(1600000000, 0),
+	}
+	assert.Equal(t, testReplayEntry(1).Key(), NewReplayEntry(e.SName, a).Key(), "key of the authenticator's entry not as expected")
+}
+
+func TestMemoryReplayCache(t *testing.T) {
+	t.Parallel()
+	c := NewMemoryReplayCache(2)
+	exp := time.Now().Add(time.Minute)
+	replay, err := c.IsReplay(testReplayEntry(0), exp)
+	assert.NoError(t, err)
+	assert.False(t, replay, "first presentation detected as a replay")
+	replay, _ = c.IsReplay(testReplayEntry(0), exp)
+	assert.True(t, replay, "replay not detected")
+
+	// An expired entry is not a replay
+	c.IsReplay(testReplayEntry(1), time.Now().Add(-time.Second))
+	replay, _ = c.IsReplay(testReplayEntry(1), exp)
+	assert.False(t, replay, "expired entry detected as a replay")
+
+	// The least recently used entry is evicted once the capacity is reached
+	c.IsReplay(testReplayEntry(0), exp)
+	c.IsReplay(testReplayEntry(2), exp)
+	assert.Equal(t, 2, c.Len(), "number of entries not as expected")
+	replay, _ = c.IsReplay(testReplayEntry(0), exp)
+	assert.True(t, replay, "recently used entry evicted")
+	replay, _ = c.IsReplay(testReplayEntry(1), exp)
+	assert.False(t, replay, "least recently used entry not evicted")
+}
+
+func TestFileReplayCache(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "replaycache")
+	if err != nil {
+		t.Fatalf("Error creating temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rcache")
+
+	c, err := NewFileReplayCache(path, 0)
+	if err != nil {
+		t.Fatalf("Error opening replay cache: %v", err)
+	}
+	exp := time.Now().Add(time.Minute)
+	replay, err := c.IsReplay(testReplayEntry(0), exp)
+	assert.NoError(t, err)
+	assert.False(t, replay, "first presentation detected as a replay")
+	c.IsReplay(testReplayEntry(1), time.Now().Add(-time.Second))
+	assert.NoError(t, c.Close())
+
+	// Entries that have not expired are detected after reopening the cache
+	c, err = NewFileReplayCache(path, 0)
+	if err != nil {
+		t.Fatalf("Error reopening replay cache: %v", err)
+	}
+	defer c.Close()
+	replay, _ = c.IsReplay(testReplayEntry(0), exp)
+	assert.True(t, replay, "replay not detected after reopening")
+	replay, _ = c.IsReplay(testReplayEntry(1), exp)
+	assert.False(t, replay, "expired entry detected as a replay after reopening")
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Error getting file info: %v", err)
+	}
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm(), "file permissions not as expected")
+}
+
+type errReplayCache struct{}
+
+func (errReplayCache) IsReplay(e ReplayEntry, expiry time.Time) (bool, error) {
+	return false, errors.New("cache unavailable")
+}
+
+func TestSettings_AuthenticatorReplayCache(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, defaultReplayCache, NewSettings(nil).AuthenticatorReplayCache(), "default replay cache not as expected")
+	rc := NewMemoryReplayCache(0)
+	assert.Equal(t, rc, NewSettings(nil, AuthenticatorReplayCache(rc)).AuthenticatorReplayCache(), "replay cache not as expected")
+}
+
+func TestVerifyAPREQ_ReplayCacheError(t *testing.T) {
+	t.Parallel()
+	cl := getClient()
+	sname := types.PrincipalName{
+		NameType:   nametype.KRB_NT_PRINCIPAL,
+		NameString: []string{"HTTP", "host.test.gokrb5"},
+	}
+	b, _ := hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	st := time.Now().UTC()
+	tkt, sessionKey, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(),
+		sname, "TEST.GOKRB5",
+		types.NewKrbFlags(),
+		kt,
+		18,
+		1,
+		st,
+		st,
+		st.Add(time.Duration(24)*time.Hour),
+		st.Add(time.Duration(48)*time.Hour),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	APReq, err := messages.NewAPReq(
+		tkt,
+		sessionKey,
+		newTestAuthenticator(*cl.Credentials),
+	)
+	if err != nil {
+		t.Fatalf("Error getting test AP_REQ: %v", err)
+	}
+
+	h, _ := types.GetHostAddress("127.0.0.1:1234")
+	ok, _, err := VerifyAPREQ(&APReq, NewSettings(kt, ClientAddress(h), AuthenticatorReplayCache(errReplayCache{})))
+	assert.False(t, ok, "AP_REQ verified when the replay cache failed")
+	assert.IsType(t, krberror.Krberror{}, err, "error not as expected")
+}
@@ -5,21 +5,41 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/gssapi"
 	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/metrics"
+	"github.com/Osirium/gokrb5/v8/pac"
+	"github.com/Osirium/gokrb5/v8/trace"
 	"github.com/Osirium/gokrb5/v8/types"
 )
 
 // Settings defines service side configuration settings.
 type Settings struct {
 	Keytab             *keytab.Keytab
+	keytabProvider     keytab.Provider
 	ktprinc            *types.PrincipalName
+	acceptAny          bool
 	sname              string
 	requireHostAddr    bool
 	disablePACDecoding bool
+	ignoreTicketTimes  bool
 	cAddr              types.HostAddress
 	maxClockSkew       time.Duration
 	logger             *log.Logger
 	sessionMgr         SessionMgr
+	user2UserKey       func() (types.EncryptionKey, error)
+	etypePolicy        *config.ETypePolicy
+	configProvider     config.Provider
+	channelBindings    *gssapi.ChannelBindings
+	replayCache        ReplayCache
+	pacKDCVerifier     pac.KDCChecksumVerifier
+	requirePACTktCksum bool
+	tracer             trace.Tracer
+	traceMessages      bool
+	metrics            metrics.Recorder
+	spans              trace.SpanStarter
 }
 
 // NewSettings creates a new service Settings.
@@ -32,6 +52,29 @@ func NewSettings(kt *keytab.Keytab, settings ...func(*Settings)) *Settings {
 	return s
 }
 
+// KeytabProvider used to configure service side with a provider of the keytab, such as a keytab.Reloader or keytab.Store.
+// The keytab is obtained from the provider each time a ticket is decrypted and takes precedence over any static keytab.
+//
+// s := NewSettings(nil, KeytabProvider(p))
+func KeytabProvider(p keytab.Provider) func(*Settings) {
+	return func(s *Settings) {
+		s.keytabProvider = p
+	}
+}
+
+// KeytabProvider returns the keytab provider configured for the service. If none is configured nil will be returned.
+func (s *Settings) KeytabProvider() keytab.Provider {
+	return s.keytabProvider
+}
+
+// currentKeytab returns the keytab from the provider if one is configured, otherwise the static keytab.
+func (s *Settings) currentKeytab() *keytab.Keytab {
+	if s.keytabProvider != nil {
+		return s.keytabProvider.Keytab()
+	}
+	return s.Keytab
+}
+
 // RequireHostAddr used to configure service side to required host addresses to be specified in Kerberos tickets.
 //
 // s := NewSettings(kt, RequireHostAddr(true))
@@ -61,6 +104,49 @@ func (s *Settings) DecodePAC() bool {
 	return !s.disablePACDecoding
 }
 
+// PACKDCVerifier used to configure service side with the verifier of the PAC checksums made with the KDC's key, the KDC
+// signature and ticket signature, so that a PAC forged with the service's key is rejected. The verifier may hold the
+// key of the KDC's krbtgt account, see pac.NewKDCKeyVerifier, or have the domain controller validate the checksums.
+// By default only the server signature of a PAC is verified.
+//
+// s := NewSettings(kt, PACKDCVerifier(v))
+func PACKDCVerifier(v pac.KDCChecksumVerifier) func(*Settings) {
+	return func(s *Settings) {
+		s.pacKDCVerifier = v
+	}
+}
+
+// PACKDCVerifier returns the verifier of the PAC checksums made with the KDC's key. If none is configured nil will be
+// returned.
+func (s *Settings) PACKDCVerifier() pac.KDCChecksumVerifier {
+	return s.pacKDCVerifier
+}
+
+// RequirePACTicketChecksum used to configure service side to reject PACs without a ticket signature, which binds the
+// PAC to the ticket it was issued in. KDCs sign tickets so once Active Directory domain controllers have the November
+// 2021 updates applied.
+// Defaults to not required if not specified.
+//
+// s := NewSettings(kt, RequirePACTicketChecksum(true))
+func RequirePACTicketChecksum(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.requirePACTktCksum = b
+	}
+}
+
+// RequirePACTicketChecksum indicates whether the service rejects PACs without a ticket signature.
+func (s *Settings) RequirePACTicketChecksum() bool {
+	return s.requirePACTktCksum
+}
+
+// pacVerifySettings returns the settings of the verification of the PAC of a ticket.
+func (s *Settings) pacVerifySettings() []func(*messages.VerifySettings) {
+	return []func(*messages.VerifySettings){
+		messages.PACKDCVerifier(s.pacKDCVerifier),
+		messages.RequirePACTicketChecksum(s.requirePACTktCksum),
+	}
+}
+
 // ClientAddress used to configure service side with the clients host address to be used during validation.
 //
 // s := NewSettings(kt, ClientAddress(h))
@@ -89,6 +175,68 @@ func (s *Settings) Logger() *log.Logger {
 	return s.logger
 }
 
+// Tracer used to configure service side with a tracer that receives an event for each AP_REQ accepted or rejected.
+//
+// s := NewSettings(kt, Tracer(trace.NewLogTracer(l)))
+func Tracer(t trace.Tracer) func(*Settings) {
+	return func(s *Settings) {
+		s.tracer = t
+	}
+}
+
+// Tracer returns the tracer configured for the service. If none is configured nil will be returned.
+func (s *Settings) Tracer() trace.Tracer {
+	return s.tracer
+}
+
+// TraceMessages used to configure service side to include the AP_REQs it verifies in its trace events. They are
+// redacted from events by default as an AP_REQ includes the client's ticket.
+//
+// s := NewSettings(kt, Tracer(t), TraceMessages(true))
+func TraceMessages(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.traceMessages = b
+	}
+}
+
+// TraceMessages indicates if the service includes the AP_REQs it verifies in its trace events.
+func (s *Settings) TraceMessages() bool {
+	return s.traceMessages
+}
+
+// Metrics used to configure service side with a recorder of the AP_REQs accepted and rejected.
+//
+// s := NewSettings(kt, Metrics(r))
+func Metrics(r metrics.Recorder) func(*Settings) {
+	return func(s *Settings) {
+		s.metrics = r
+	}
+}
+
+// Metrics returns the recorder configured for the service. If none is configured a recorder that discards the
+// measurements is returned.
+func (s *Settings) Metrics() metrics.Recorder {
+	if s.metrics == nil {
+		return metrics.Nop{}
+	}
+	return s.metrics
+}
+
+// Spans used to configure service side with a starter of spans for the SPNEGO authentication of each request, as
+// children of the span in the request's context.
+//
+// s := NewSettings(kt, Spans(s))
+func Spans(s trace.SpanStarter) func(*Settings) {
+	return func(st *Settings) {
+		st.spans = s
+	}
+}
+
+// Spans returns the starter of spans configured for the service, if any.
+func (s *Settings) Spans() trace.SpanStarter {
+	return s.spans
+}
+
 // KeytabPrincipal used to override the principal name used to find the key in the keytab.
 //
 // s := NewSettings(kt, KeytabPrincipal("someaccount"))
@@ -104,6 +252,31 @@ func (s *Settings) KeytabPrincipal() *types.PrincipalName {
 	return s.ktprinc
 }
 
+// AcceptAnyPrincipal used to configure service side to accept tickets for any principal in the keytab for the
+// ticket's realm rather than only the principal named in the ticket. This is useful for hosts known by several names,
+// such as HTTP/ and host/ principals or DNS aliases. It has no effect if the KeytabPrincipal setting is used.
+//
+// s := NewSettings(kt, AcceptAnyPrincipal(true))
+func AcceptAnyPrincipal(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.acceptAny = b
+	}
+}
+
+// AcceptAnyPrincipal indicates if the service accepts tickets for any principal in the keytab.
+func (s *Settings) AcceptAnyPrincipal() bool {
+	return s.acceptAny
+}
+
+// ticketPrincipal returns the principal name used to find the key in the keytab for the ticket provided.
+// If nil is returned the ticket's service principal is used.
+func (s *Settings) ticketPrincipal(kt *keytab.Keytab, tkt *messages.Ticket) (*types.PrincipalName, error) {
+	if s.ktprinc != nil || !s.acceptAny {
+		return s.ktprinc, nil
+	}
+	return tkt.FindKeytabPrincipal(kt)
+}
+
 // MaxClockSkew used to configure service side with the maximum acceptable clock skew
 // between the service and the issue time of kerberos tickets
 //
@@ -123,6 +296,41 @@ func (s *Settings) MaxClockSkew() time.Duration {
 	return s.maxClockSkew
 }
 
+// AuthenticatorReplayCache used to configure service side with the cache recording the authenticators accepted, such
+// as a FileReplayCache or one shared by the instances of the service.
+//
+// s := NewSettings(kt, AuthenticatorReplayCache(rc))
+func AuthenticatorReplayCache(rc ReplayCache) func(*Settings) {
+	return func(s *Settings) {
+		s.replayCache = rc
+	}
+}
+
+// AuthenticatorReplayCache returns the cache recording the authenticators accepted. If none is configured an in-memory
+// cache shared by all services is returned.
+func (s *Settings) AuthenticatorReplayCache() ReplayCache {
+	if s.replayCache == nil {
+		return defaultReplayCache
+	}
+	return s.replayCache
+}
+
+// EnforceTicketTimes used to configure service side to enable/disable enforcing the start and end times of tickets,
+// allowing for the maximum clock skew. If disabled only the clock skew of the client's authenticator is checked.
+// Defaults to enabled if not specified.
+//
+// s := NewSettings(kt, EnforceTicketTimes(false))
+func EnforceTicketTimes(b bool) func(*Settings) {
+	return func(s *Settings) {
+		s.ignoreTicketTimes = !b
+	}
+}
+
+// EnforceTicketTimes indicates whether the service enforces the start and end times of tickets.
+func (s *Settings) EnforceTicketTimes() bool {
+	return !s.ignoreTicketTimes
+}
+
 // SName used provide a specific service name to the service settings.
 //
 // s := NewSettings(kt, SName("HTTP/some.service.com"))
@@ -151,6 +359,81 @@ func (s *Settings) SessionManager() SessionMgr {
 	return s.sessionMgr
 }
 
+// ETypePolicy used to configure service side with the encryption types permitted for the keys of tickets and
+// authenticators, such as the policy of the service's krb5.conf.
+//
+// s := NewSettings(kt, ETypePolicy(cfg.LibDefaults.ETypePolicy()))
+func ETypePolicy(p config.ETypePolicy) func(*Settings) {
+	return func(s *Settings) {
+		s.etypePolicy = &p
+	}
+}
+
+// ETypePolicy returns the encryption type policy of the service.
+// If none is defined the policy of the configuration from the service's configuration provider is returned, or if it
+// has none the policy of the default configuration, which does not permit weak encryption types.
+func (s *Settings) ETypePolicy() config.ETypePolicy {
+	if s.etypePolicy == nil {
+		if s.configProvider != nil {
+			return s.configProvider.Config().LibDefaults.ETypePolicy()
+		}
+		return config.DefaultETypePolicy()
+	}
+	return *s.etypePolicy
+}
+
+// ConfigProvider used to configure service side with a provider of the krb5.conf configuration, such as a
+// config.Reloader or config.Store, so that changes are picked up by a long running service. The configuration is
+// obtained from the provider each time it is used: for the encryption type policy if none is set with ETypePolicy,
+// and by the KRB5BasicAuthenticator to obtain tickets for the users it authenticates.
+//
+// s := NewSettings(kt, ConfigProvider(p))
+func ConfigProvider(p config.Provider) func(*Settings) {
+	return func(s *Settings) {
+		s.configProvider = p
+	}
+}
+
+// ConfigProvider returns the configuration provider of the service. If none is configured nil will be returned.
+func (s *Settings) ConfigProvider() config.Provider {
+	return s.configProvider
+}
+
+// User2User used to configure service side to accept user-to-user tickets, which are encrypted with the session key
+// of the service's TGT rather than a key in its keytab, from clients that request them with the service's TGT. The
+// function provided returns the session key of the TGT given to clients, such as the key returned by a client's GetTGT.
+//
+// s := NewSettings(kt, User2User(f))
+func User2User(key func() (types.EncryptionKey, error)) func(*Settings) {
+	return func(s *Settings) {
+		s.user2UserKey = key
+	}
+}
+
+// User2User returns the function providing the session key of the service's TGT for user-to-user authentication.
+// If user-to-user authentication is not configured nil will be returned.
+func (s *Settings) User2User() func() (types.EncryptionKey, error) {
+	return s.user2UserKey
+}
+
+// ChannelBindings used to configure service side with the channel bindings of the channel clients connect over, such
+// as the tls-server-end-point bindings of the service's TLS certificate. The GSS-API authenticator checksum of a
+// client's AP_REQ is rejected if it carries the hash of other channel bindings. Clients not providing channel
+// bindings are accepted.
+//
+// s := NewSettings(kt, ChannelBindings(gssapi.NewTLSServerEndPointBindings(cert)))
+func ChannelBindings(cb gssapi.ChannelBindings) func(*Settings) {
+	return func(s *Settings) {
+		s.channelBindings = &cb
+	}
+}
+
+// ChannelBindings returns the channel bindings of the service.
+// If channel bindings are not configured nil will be returned.
+func (s *Settings) ChannelBindings() *gssapi.ChannelBindings {
+	return s.channelBindings
+}
+
 // SessionMgr must provide a ways to:
 //
 // - Create new sessions and in the process add a value to the session under the key provided.
@@ -0,0 +1,549 @@
+package spnego
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Osirium/gokrb5/v8/gssapi"
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// NewInitiator returns the initiator side of the establishment of a security context with the service, for use with
+// gssapi.InitSecContext. The SPNEGO mechanism must be configured for client side use.
+func (s *SPNEGO) NewInitiator() (gssapi.ContextEstablisher, error) {
+	if s.client == nil {
+		return nil, errors.New("SPNEGO is not configured for client side use")
+	}
+	return &spnegoInitiator{spnego: s}, nil
+}
+
+// NewAcceptor returns the acceptor side of the establishment of a security context with a client, for use with
+// gssapi.AcceptSecContext. The SPNEGO mechanism must be configured for service side use.
+func (s *SPNEGO) NewAcceptor() (gssapi.ContextEstablisher, error) {
+	if s.client != nil {
+		return nil, errors.New("SPNEGO is not configured for service side use")
+	}
+	return &spnegoAcceptor{spnego: s}, nil
+}
+
+// MICProvider computes and verifies the MIC tokens of an established security context, as required for the
+// mechListMIC. It is implemented by gssapi.SecurityContext and must be implemented by the context establishers of
+// mechanisms whose security contexts are not provided as a gssapi.SecurityContext, such as NTLMSSP.
+type MICProvider interface {
+	GetMIC(msg []byte) ([]byte, error)
+	VerifyMIC(msg, token []byte) error
+}
+
+// spnegoInitiator establishes a security context by sending a NegTokenInit offering the mechanisms of SPNEGO, with the
+// optimistic token of the preferred one, and exchanging the tokens of the mechanism the acceptor selects in
+// NegTokenResps. The mechListMIC of RFC 4178 section 5 is verified if the acceptor sends it, and exchanged if the
+// acceptor requests it or selects a mechanism other than the preferred one.
+type spnegoInitiator struct {
+	spnego       *SPNEGO
+	mechs        []gssapi.Mechanism
+	mechTypes    []asn1.ObjectIdentifier
+	mech         gssapi.ContextEstablisher
+	mechType     asn1.ObjectIdentifier
+	mechComplete bool
+	mic          MICProvider
+	sc           *gssapi.SecurityContext
+	micRequired  bool
+	micVerified  bool
+	micSent      bool
+	complete     bool
+}
+
+// Step returns the NegTokenInit on the first call and processes the acceptor's NegTokenResps on subsequent calls,
+// returning the NegTokenResps carrying the tokens of the mechanism selected and the initiator's mechListMIC.
+func (i *spnegoInitiator) Step(in []byte) ([]byte, bool, error) {
+	if i.complete {
+		return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: "security context already established"}
+	}
+	if i.mechTypes == nil {
+		return i.initToken()
+	}
+	var t SPNEGOToken
+	if err := t.Unmarshal(in); err != nil {
+		return nil, false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: err.Error()}
+	}
+	if !t.Resp {
+		return nil, false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "SPNEGO token from acceptor is not a NegTokenResp"}
+	}
+	r := t.NegTokenResp
+	switch r.State() {
+	case NegStateAcceptCompleted, NegStateAcceptIncomplete, NegStateRequestMIC:
+	case NegStateReject:
+		return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: "acceptor rejected the negotiation"}
+	default:
+		return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: fmt.Sprintf("negotiation state %d not supported", r.NegState)}
+	}
+	tok := r.ResponseToken
+	if i.mechType == nil {
+		restarted, err := i.selectMech(r.SupportedMech)
+		if err != nil {
+			return nil, false, err
+		}
+		if restarted {
+			// The acceptor's first token is a request for the initial token of the mechanism it selected
+			tok = nil
+		}
+	}
+	var out []byte
+	if !i.mechComplete {
+		var cont bool
+		var err error
+		out, cont, err = i.mech.Step(tok)
+		if err != nil {
+			return nil, false, mechStatus(err)
+		}
+		if cont {
+			if r.State() == NegStateAcceptCompleted {
+				return nil, false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "acceptor completed the negotiation before the mechanism"}
+			}
+			b, err := negTokenResp(NegStateAcceptIncomplete, nil, out, nil)
+			return b, true, err
+		}
+		if err := i.completeMech(); err != nil {
+			return nil, false, err
+		}
+	}
+	if len(r.MechListMIC) > 0 {
+		if err := VerifyMechListMIC(i.mic, i.mechTypes, r.MechListMIC); err != nil {
+			return nil, false, gssapi.Status{Code: gssapi.StatusBadMIC, Message: err.Error()}
+		}
+		i.micVerified = true
+	}
+	if len(out) > 0 {
+		// The final token of the mechanism is sent with the initiator's mechListMIC
+		if r.State() == NegStateAcceptCompleted {
+			return nil, false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "acceptor completed the negotiation before the mechanism"}
+		}
+		return i.micToken(out)
+	}
+	if r.State() == NegStateAcceptCompleted {
+		if i.micRequired && !i.micVerified {
+			return nil, false, gssapi.Status{Code: gssapi.StatusBadMIC, Message: "NegTokenResp does not contain the required mechListMIC"}
+		}
+		i.complete = true
+		return nil, false, nil
+	}
+	// The acceptor requests the mechListMIC of the initiator
+	if i.micSent {
+		return nil, false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "acceptor continued the negotiation after the mechListMIC exchange"}
+	}
+	i.micRequired = true
+	return i.micToken(nil)
+}
+
+// initToken returns the NegTokenInit offering the mechanisms of SPNEGO with the optimistic token of the first able to
+// initiate a security context. Mechanisms which are not, such as Kerberos V5 without a service ticket, are not offered.
+func (i *spnegoInitiator) initToken() ([]byte, bool, error) {
+	var mechs []gssapi.Mechanism
+	var failed []asn1.ObjectIdentifier
+	var e gssapi.ContextEstablisher
+	var tok []byte
+	var cont bool
+	var err error
+	for _, m := range i.spnego.mechanisms() {
+		if containsMech(failed, m.OID()) {
+			continue
+		}
+		if e == nil {
+			var me gssapi.ContextEstablisher
+			me, err = m.NewInitiator()
+			if err == nil {
+				tok, cont, err = me.Step(nil)
+			}
+			if err != nil {
+				failed = append(failed, m.OID())
+				continue
+			}
+			e = me
+		}
+		mechs = append(mechs, m)
+	}
+	if e == nil {
+		return nil, false, mechStatus(err)
+	}
+	return i.negTokenInit(mechs, e, tok, cont)
+}
+
+// negTokenInit returns the NegTokenInit offering the mechanisms with the optimistic token of the establisher of the
+// first.
+func (i *spnegoInitiator) negTokenInit(mechs []gssapi.Mechanism, e gssapi.ContextEstablisher, tok []byte, cont bool) ([]byte, bool, error) {
+	mechTypes := make([]asn1.ObjectIdentifier, len(mechs))
+	for n, m := range mechs {
+		mechTypes[n] = m.OID()
+	}
+	t := SPNEGOToken{
+		Init: true,
+		NegTokenInit: NegTokenInit{
+			MechTypes:      mechTypes,
+			MechTokenBytes: tok,
+		},
+	}
+	b, err := t.Marshal()
+	if err != nil {
+		return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: err.Error()}
+	}
+	i.mechs = mechs
+	i.mechTypes = mechTypes
+	i.mech = e
+	if !cont {
+		if err := i.completeMech(); err != nil {
+			return nil, false, err
+		}
+	}
+	return b, true, nil
+}
+
+// selectMech processes the mechanism selected by the acceptor. If it is not that of the optimistic token, the
+// establishment restarts with the selected mechanism and the mechListMIC exchange is required.
+func (i *spnegoInitiator) selectMech(oid asn1.ObjectIdentifier) (bool, error) {
+	if len(oid) == 0 {
+		oid = i.mechTypes[0]
+	}
+	for n, t := range i.mechTypes {
+		if !t.Equal(oid) {
+			continue
+		}
+		i.mechType = oid
+		i.micRequired = n != 0
+		if sameMech(oid, i.mechTypes[0]) {
+			return false, nil
+		}
+		e, err := i.mechs[n].NewInitiator()
+		if err != nil {
+			return false, mechStatus(err)
+		}
+		i.mech = e
+		i.mechComplete = false
+		return true, nil
+	}
+	return false, gssapi.Status{Code: gssapi.StatusBadMech, Message: fmt.Sprintf("acceptor selected mechanism %s", oid.String())}
+}
+
+// completeMech records the completion of the mechanism and its security context, which computes the mechListMIC.
+func (i *spnegoInitiator) completeMech() error {
+	mic, sc, err := establishedMech(i.mech)
+	if err != nil {
+		return err
+	}
+	i.mechComplete = true
+	i.mic = mic
+	i.sc = sc
+	return nil
+}
+
+// micToken returns the NegTokenResp with the initiator's mechListMIC and any final token of the mechanism. The security
+// context is established once the acceptor's mechListMIC has also been verified.
+func (i *spnegoInitiator) micToken(tok []byte) ([]byte, bool, error) {
+	mic, err := MechListMIC(i.mic, i.mechTypes)
+	if err != nil {
+		return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: err.Error()}
+	}
+	state := NegStateAcceptIncomplete
+	if i.micVerified {
+		state = NegStateAcceptCompleted
+	}
+	b, err := negTokenResp(state, nil, tok, mic)
+	if err != nil {
+		return nil, false, err
+	}
+	i.micSent = true
+	if i.micVerified {
+		i.complete = true
+		return b, false, nil
+	}
+	return b, true, nil
+}
+
+// SecurityContext returns the security context established with the acceptor.
+func (i *spnegoInitiator) SecurityContext() (*gssapi.SecurityContext, error) {
+	if !i.complete {
+		return nil, gssapi.Status{Code: gssapi.StatusNoContext, Message: "security context not established"}
+	}
+	if i.sc == nil {
+		return i.mech.SecurityContext()
+	}
+	return i.sc, nil
+}
+
+// Context returns the context of the initiator.
+func (i *spnegoInitiator) Context() context.Context {
+	if i.mech == nil {
+		return context.Background()
+	}
+	return i.mech.Context()
+}
+
+// verifyMutualAuth verifies the AP_REP in the response token of the acceptor's NegTokenResp against the initiator's
+// KRB5 token, completing mutual authentication. The AP_REP is required if the initiator requested mutual
+// authentication.
+func verifyMutualAuth(mt *KRB5Token, r NegTokenResp) error {
+	if len(r.ResponseToken) == 0 {
+		if mt.flags&gssapi.ContextFlagMutual != 0 {
+			return gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "NegTokenResp does not contain the AP_REP required for mutual authentication"}
+		}
+		return nil
+	}
+	var rep KRB5Token
+	if err := rep.Unmarshal(r.ResponseToken); err != nil {
+		return gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: err.Error()}
+	}
+	if rep.IsKRBError() {
+		return gssapi.Status{Code: gssapi.StatusFailure, Message: rep.KRBError.Error()}
+	}
+	if err := mt.VerifyAPRep(rep); err != nil {
+		return gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: err.Error()}
+	}
+	return nil
+}
+
+// spnegoAcceptor establishes a security context by selecting the first of the mechanisms offered in the initiator's
+// NegTokenInit that SPNEGO supports, and exchanging the tokens of that mechanism in NegTokenResps. The acceptor's
+// mechListMIC completes the negotiation, and that of the initiator is required if the mechanism selected was not its
+// preferred one.
+type spnegoAcceptor struct {
+	spnego       *SPNEGO
+	mechTypes    []asn1.ObjectIdentifier
+	mech         gssapi.ContextEstablisher
+	mechType     asn1.ObjectIdentifier
+	mechComplete bool
+	mic          MICProvider
+	sc           *gssapi.SecurityContext
+	micRequired  bool
+	micVerified  bool
+	micSent      bool
+	complete     bool
+}
+
+// Step processes the initiator's NegTokenInit, and any subsequent NegTokenResps, and returns the NegTokenResp
+// continuing, completing or rejecting the negotiation.
+func (a *spnegoAcceptor) Step(in []byte) ([]byte, bool, error) {
+	if a.complete {
+		return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: "security context already established"}
+	}
+	var t SPNEGOToken
+	if err := t.Unmarshal(in); err != nil {
+		return rejectToken(), false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: err.Error()}
+	}
+	var supportedMech asn1.ObjectIdentifier
+	var tok, mic []byte
+	if a.mech == nil {
+		if !t.Init || len(t.NegTokenInit.MechTypes) == 0 {
+			return rejectToken(), false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "SPNEGO token from initiator is not a NegTokenInit"}
+		}
+		optimistic, err := a.selectMech(t.NegTokenInit.MechTypes)
+		if err != nil {
+			return rejectToken(), false, err
+		}
+		supportedMech = a.mechType
+		if !optimistic || len(t.NegTokenInit.MechTokenBytes) == 0 {
+			// Request the initial token of the selected mechanism
+			b, err := negTokenResp(NegStateAcceptIncomplete, supportedMech, nil, nil)
+			return b, true, err
+		}
+		tok, mic = t.NegTokenInit.MechTokenBytes, t.NegTokenInit.MechListMIC
+	} else {
+		if !t.Resp {
+			return rejectToken(), false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "SPNEGO token from initiator is not a NegTokenResp"}
+		}
+		tok, mic = t.NegTokenResp.ResponseToken, t.NegTokenResp.MechListMIC
+	}
+	var out []byte
+	if !a.mechComplete {
+		var cont bool
+		var err error
+		out, cont, err = a.mech.Step(tok)
+		if err != nil {
+			return rejectToken(), false, mechStatus(err)
+		}
+		if cont {
+			b, err := negTokenResp(NegStateAcceptIncomplete, supportedMech, out, nil)
+			return b, true, err
+		}
+		if a.mic, a.sc, err = establishedMech(a.mech); err != nil {
+			return rejectToken(), false, err
+		}
+		a.mechComplete = true
+	}
+	if len(mic) > 0 {
+		if err := VerifyMechListMIC(a.mic, a.mechTypes, mic); err != nil {
+			return rejectToken(), false, gssapi.Status{Code: gssapi.StatusBadMIC, Message: err.Error()}
+		}
+		a.micVerified = true
+	}
+	if a.micRequired && !a.micVerified {
+		if a.micSent {
+			return rejectToken(), false, gssapi.Status{Code: gssapi.StatusBadMIC, Message: "NegTokenResp does not contain the required mechListMIC"}
+		}
+		// Send the acceptor's mechListMIC, requesting that of the initiator
+		return a.micToken(NegStateAcceptIncomplete, supportedMech, out)
+	}
+	a.complete = true
+	if a.micSent {
+		return nil, false, nil
+	}
+	return a.micToken(NegStateAcceptCompleted, supportedMech, out)
+}
+
+// selectMech selects the first of the initiator's mechanisms that SPNEGO supports. The initiator's optimistic token is
+// for the selected mechanism if it is the initiator's preferred one.
+func (a *spnegoAcceptor) selectMech(mechTypes []asn1.ObjectIdentifier) (bool, error) {
+	for n, oid := range mechTypes {
+		for _, m := range a.spnego.mechanisms() {
+			if !m.OID().Equal(oid) {
+				continue
+			}
+			e, err := m.NewAcceptor()
+			if err != nil {
+				continue
+			}
+			a.mechTypes = mechTypes
+			a.mechType = oid
+			a.mech = e
+			a.micRequired = n != 0
+			return n == 0, nil
+		}
+	}
+	return false, gssapi.Status{Code: gssapi.StatusBadMech, Message: "none of the mechanisms offered by the initiator are supported"}
+}
+
+// micToken returns the NegTokenResp with the acceptor's mechListMIC and any final token of the mechanism.
+func (a *spnegoAcceptor) micToken(state NegState, supportedMech asn1.ObjectIdentifier, tok []byte) ([]byte, bool, error) {
+	mic, err := MechListMIC(a.mic, a.mechTypes)
+	if err != nil {
+		return rejectToken(), false, gssapi.Status{Code: gssapi.StatusFailure, Message: err.Error()}
+	}
+	b, err := negTokenResp(state, supportedMech, tok, mic)
+	if err != nil {
+		return nil, false, err
+	}
+	a.micSent = true
+	return b, state != NegStateAcceptCompleted, nil
+}
+
+// SecurityContext returns the security context established with the initiator.
+func (a *spnegoAcceptor) SecurityContext() (*gssapi.SecurityContext, error) {
+	if !a.complete {
+		return nil, gssapi.Status{Code: gssapi.StatusNoContext, Message: "security context not established"}
+	}
+	if a.sc == nil {
+		return a.mech.SecurityContext()
+	}
+	return a.sc, nil
+}
+
+// Context returns the context of the acceptor which will contain the verified identity of the initiator and any
+// credentials it delegated.
+func (a *spnegoAcceptor) Context() context.Context {
+	if !a.complete {
+		return nil
+	}
+	return a.mech.Context()
+}
+
+// establishedMech returns the MIC provider of the security context established by the mechanism, which is the
+// establisher if it provides MICs, and any security context it provides.
+func establishedMech(e gssapi.ContextEstablisher) (MICProvider, *gssapi.SecurityContext, error) {
+	sc, err := e.SecurityContext()
+	if m, ok := e.(MICProvider); ok {
+		return m, sc, nil
+	}
+	if err != nil {
+		return nil, nil, mechStatus(err)
+	}
+	return sc, sc, nil
+}
+
+// mechStatus returns the error of a mechanism as a GSS-API status.
+func mechStatus(err error) error {
+	if _, ok := err.(gssapi.Status); ok {
+		return err
+	}
+	return gssapi.Status{Code: gssapi.StatusFailure, Message: err.Error()}
+}
+
+// sameMech indicates if the OIDs are those of the same mechanism, Kerberos V5 having a standard and a Microsoft legacy
+// OID.
+func sameMech(a, b asn1.ObjectIdentifier) bool {
+	return a.Equal(b) || (isKRB5(a) && isKRB5(b))
+}
+
+func isKRB5(oid asn1.ObjectIdentifier) bool {
+	return oid.Equal(gssapi.OIDKRB5.OID()) || oid.Equal(gssapi.OIDMSLegacyKRB5.OID())
+}
+
+// containsMech indicates if the OID is that of the same mechanism as one of the OIDs.
+func containsMech(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+	for _, o := range oids {
+		if sameMech(o, oid) {
+			return true
+		}
+	}
+	return false
+}
+
+// negTokenResp returns the marshalled NegTokenResp.
+func negTokenResp(state NegState, supportedMech asn1.ObjectIdentifier, tok, mic []byte) ([]byte, error) {
+	t := SPNEGOToken{
+		Resp: true,
+		NegTokenResp: NegTokenResp{
+			NegState:      asn1.Enumerated(state),
+			SupportedMech: supportedMech,
+			ResponseToken: tok,
+			MechListMIC:   mic,
+		},
+	}
+	b, err := t.Marshal()
+	if err != nil {
+		return nil, gssapi.Status{Code: gssapi.StatusFailure, Message: err.Error()}
+	}
+	return b, nil
+}
+
+// acceptCompletedToken returns the NegTokenResp completing the negotiation of the verified NegTokenInit, with the
+// AP_REP of its KRB5 mech token if the initiator requested mutual authentication, and the security context it
+// establishes. The NegTokenResp carries the acceptor's mechListMIC so the initiator can detect a downgrade of the
+// mechanism list.
+func acceptCompletedToken(t *SPNEGOToken, mt *KRB5Token) (SPNEGOToken, *gssapi.SecurityContext, error) {
+	r := SPNEGOToken{
+		Resp: true,
+		NegTokenResp: NegTokenResp{
+			NegState:      asn1.Enumerated(NegStateAcceptCompleted),
+			SupportedMech: t.NegTokenInit.MechTypes[0],
+		},
+	}
+	if mutualRequested(mt) {
+		rep, err := NewKRB5TokenAPREP(mt)
+		if err != nil {
+			return r, nil, err
+		}
+		r.NegTokenResp.ResponseToken, err = rep.Marshal()
+		if err != nil {
+			return r, nil, err
+		}
+	}
+	// The context keys include any acceptor subkey of the AP_REP
+	sc, err := mt.SecurityContext()
+	if err != nil {
+		return r, nil, err
+	}
+	r.NegTokenResp.MechListMIC, err = MechListMIC(sc, t.NegTokenInit.MechTypes)
+	if err != nil {
+		return r, nil, err
+	}
+	return r, sc, nil
+}
+
+// rejectToken returns the NegTokenResp informing the initiator the negotiation is rejected.
+func rejectToken() []byte {
+	t := SPNEGOToken{
+		Resp:         true,
+		NegTokenResp: NegTokenResp{NegState: asn1.Enumerated(NegStateReject)},
+	}
+	b, _ := t.Marshal()
+	return b
+}
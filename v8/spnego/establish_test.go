@@ -0,0 +1,638 @@
+package spnego
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/client"
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/gssapi"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/service"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestTicket returns a client, with the settings provided, and a service ticket issued to it, with its session key,
+// encrypted with the service's keytab.
+func newTestTicket(t *testing.T, settings ...func(*client.Settings)) (*client.Client, messages.Ticket, types.EncryptionKey, *keytab.Keytab) {
+	t.Helper()
+	b, _ := hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
+	ckt := keytab.New()
+	ckt.Unmarshal(b)
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	cl := client.NewWithKeytab("testuser1", "TEST.GOKRB5", ckt, c, settings...)
+
+	b, _ = hex.DecodeString(testdata.HTTP_KEYTAB)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	sname := types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: []string{"HTTP", "host.test.gokrb5"}}
+	st := time.Now().UTC()
+	tkt, key, err := messages.NewTicket(cl.Credentials.CName(), cl.Credentials.Domain(), sname, "TEST.GOKRB5",
+		types.NewKrbFlags(), kt, 18, 1, st, st, st.Add(24*time.Hour), st.Add(48*time.Hour))
+	if err != nil {
+		t.Fatalf("Error getting test ticket: %v", err)
+	}
+	return cl, tkt, key, kt
+}
+
+// newTestInitiator returns an initiator, with the NegTokenInit of its first step, for a service ticket issued to the
+// client with the service's keytab, and an SPNEGO mechanism configured for the service.
+func newTestInitiator(t *testing.T, settings ...func(*client.Settings)) (*spnegoInitiator, []byte, *SPNEGO) {
+	t.Helper()
+	cl, tkt, key, kt := newTestTicket(t, settings...)
+	i := &spnegoInitiator{spnego: SPNEGOClient(cl, "HTTP/host.test.gokrb5")}
+	return i, initTestInitiator(t, i, tkt, key), SPNEGOService(kt)
+}
+
+// initTestInitiator returns the NegTokenInit of the initiator with the optimistic AP_REQ token for the service ticket.
+func initTestInitiator(t *testing.T, i *spnegoInitiator, tkt messages.Ticket, key types.EncryptionKey) []byte {
+	t.Helper()
+	mechs := i.spnego.mechanisms()
+	e := &krb5Initiator{mech: mechs[0].(*KRB5)}
+	tok, cont, err := e.apReqToken(tkt, key)
+	if err != nil {
+		t.Fatalf("Error creating AP_REQ token: %v", err)
+	}
+	b, cont, err := i.negTokenInit(mechs, e, tok, cont)
+	if err != nil {
+		t.Fatalf("Error creating NegTokenInit: %v", err)
+	}
+	assert.True(t, cont, "initiator should expect a NegTokenResp")
+	return b
+}
+
+// testKRB5Token returns the KRB5 token with the AP_REQ of the initiator.
+func testKRB5Token(i *spnegoInitiator) *KRB5Token {
+	return i.mech.(*krb5Initiator).token
+}
+
+func TestSPNEGO_EstablishSecurityContext(t *testing.T) {
+	t.Parallel()
+	i, tb, s := newTestInitiator(t)
+	a, err := s.NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	rb, cont, err := a.Step(tb)
+	if err != nil {
+		t.Fatalf("Error accepting NegTokenInit: %v", err)
+	}
+	assert.False(t, cont, "acceptor should complete on the NegTokenInit")
+	id, ok := a.Context().Value(ctxCredentials).(*credentials.Credentials)
+	if assert.True(t, ok, "acceptor context should contain the initiator's credentials") {
+		assert.Equal(t, "testuser1", id.UserName(), "initiator identity not as expected")
+	}
+
+	_, err = i.SecurityContext()
+	assert.Error(t, err, "initiator context should not be established before the NegTokenResp")
+	ob, cont, err := i.Step(rb)
+	if err != nil {
+		t.Fatalf("Error processing NegTokenResp: %v", err)
+	}
+	assert.False(t, cont, "initiator should complete on the NegTokenResp")
+	assert.Nil(t, ob, "initiator should not send a further token")
+
+	isc, err := i.SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting initiator security context: %v", err)
+	}
+	asc, err := a.SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting acceptor security context: %v", err)
+	}
+	wb, err := asc.Wrap([]byte("message"), true)
+	if err != nil {
+		t.Fatalf("Error wrapping message: %v", err)
+	}
+	msg, _, err := isc.Unwrap(wb)
+	if err != nil {
+		t.Fatalf("Error unwrapping message: %v", err)
+	}
+	assert.Equal(t, []byte("message"), msg, "unwrapped message not as expected")
+}
+
+func TestSPNEGO_EstablishSecurityContext_Rejected(t *testing.T) {
+	t.Parallel()
+	i, _, s := newTestInitiator(t)
+	a, err := s.NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	rb, _, err := a.Step([]byte{0x60, 0x01, 0x00})
+	assert.Error(t, err, "acceptor should reject a defective token")
+	_, err = a.SecurityContext()
+	assert.Error(t, err, "acceptor context should not be established")
+
+	_, _, err = i.Step(rb)
+	if assert.Error(t, err, "initiator should fail on the rejection") {
+		assert.Equal(t, gssapi.StatusFailure, err.(gssapi.Status).Code, "status code not as expected")
+	}
+}
+
+func TestSPNEGO_NewEstablisher(t *testing.T) {
+	t.Parallel()
+	_, err := SPNEGOService(keytab.New()).NewInitiator()
+	assert.Error(t, err, "service side SPNEGO should not initiate")
+	_, err = SPNEGOClient(&client.Client{}, "HTTP/host.test.gokrb5").NewAcceptor()
+	assert.Error(t, err, "client side SPNEGO should not accept")
+	var _ gssapi.Mechanism = &SPNEGO{}
+}
+
+func TestSPNEGO_ChannelBindings(t *testing.T) {
+	t.Parallel()
+	cl, tkt, key, kt := newTestTicket(t)
+	ci := SPNEGOClient(cl, "HTTP/host.test.gokrb5")
+	ci.SetChannelBindings(gssapi.ChannelBindings{ApplicationData: []byte("tls-server-end-point:bindings")})
+	i := &spnegoInitiator{spnego: ci}
+	b := initTestInitiator(t, i, tkt, key)
+	s := SPNEGOService(kt, service.ChannelBindings(gssapi.ChannelBindings{ApplicationData: []byte("tls-server-end-point:other")}))
+	a, err := s.NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	_, _, err = a.Step(b)
+	if assert.Error(t, err, "NegTokenInit with other channel bindings should be rejected") {
+		assert.Equal(t, gssapi.StatusBadBindings, err.(gssapi.Status).Code, "status code not as expected")
+	}
+}
+
+func TestSPNEGO_EstablishSecurityContext_MutualAuthentication(t *testing.T) {
+	t.Parallel()
+	i, tb, s := newTestInitiator(t, client.MutualAuthentication(true))
+	assert.True(t, types.IsFlagSet(&testKRB5Token(i).APReq.APOptions, flags.APOptionMutualRequired), "AP_REQ should require mutual authentication")
+	a, err := s.NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	rb, _, err := a.Step(tb)
+	if err != nil {
+		t.Fatalf("Error accepting NegTokenInit: %v", err)
+	}
+	var rt SPNEGOToken
+	if err := rt.Unmarshal(rb); err != nil {
+		t.Fatalf("Error unmarshalling NegTokenResp: %v", err)
+	}
+	assert.NotEmpty(t, rt.NegTokenResp.ResponseToken, "NegTokenResp should carry the AP_REP")
+
+	// A NegTokenResp without the AP_REP does not complete mutual authentication
+	_, _, err = i.Step(completedTokenWithoutAPRep(t))
+	assert.Error(t, err, "NegTokenResp without AP_REP should fail mutual authentication")
+	assert.False(t, testKRB5Token(i).MutualAuthComplete(), "mutual authentication should not be complete")
+
+	_, _, err = i.Step(rb)
+	if err != nil {
+		t.Fatalf("Error processing NegTokenResp: %v", err)
+	}
+	assert.True(t, testKRB5Token(i).MutualAuthComplete(), "mutual authentication should be complete")
+	assert.NotEmpty(t, testKRB5Token(i).AcceptorSubkey().KeyValue, "acceptor subkey should be exposed")
+	isc, err := i.SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting initiator security context: %v", err)
+	}
+	asc, err := a.SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting acceptor security context: %v", err)
+	}
+	assert.Equal(t, testKRB5Token(i).AcceptorSubkey(), isc.Keys().AcceptorSubkey, "initiator context should use the acceptor subkey")
+	wb, err := asc.Wrap([]byte("message"), true)
+	if err != nil {
+		t.Fatalf("Error wrapping message: %v", err)
+	}
+	msg, _, err := isc.Unwrap(wb)
+	if err != nil {
+		t.Fatalf("Error unwrapping message: %v", err)
+	}
+	assert.Equal(t, []byte("message"), msg, "unwrapped message not as expected")
+}
+
+// completedTokenWithoutAPRep returns a NegTokenResp completing the negotiation without a response token.
+func completedTokenWithoutAPRep(t *testing.T) []byte {
+	t.Helper()
+	st := SPNEGOToken{
+		Resp: true,
+		NegTokenResp: NegTokenResp{
+			NegState:      asn1.Enumerated(NegStateAcceptCompleted),
+			SupportedMech: gssapi.OIDKRB5.OID(),
+		},
+	}
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling NegTokenResp: %v", err)
+	}
+	return b
+}
+
+// newTestNegTokenResp returns an initiator, the acceptor's NegTokenResp to its NegTokenInit and the acceptor.
+func newTestNegTokenResp(t *testing.T) (*spnegoInitiator, NegTokenResp, gssapi.ContextEstablisher) {
+	t.Helper()
+	i, tb, s := newTestInitiator(t)
+	a, err := s.NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	rb, _, err := a.Step(tb)
+	if err != nil {
+		t.Fatalf("Error accepting NegTokenInit: %v", err)
+	}
+	var rt SPNEGOToken
+	if err := rt.Unmarshal(rb); err != nil {
+		t.Fatalf("Error unmarshalling NegTokenResp: %v", err)
+	}
+	return i, rt.NegTokenResp, a
+}
+
+func marshalTestNegTokenResp(t *testing.T, r NegTokenResp) []byte {
+	t.Helper()
+	st := SPNEGOToken{Resp: true, NegTokenResp: r}
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling NegTokenResp: %v", err)
+	}
+	return b
+}
+
+func TestSPNEGO_MechListMIC(t *testing.T) {
+	t.Parallel()
+	i, r, _ := newTestNegTokenResp(t)
+	assert.NotEmpty(t, r.MechListMIC, "NegTokenResp should carry the acceptor's mechListMIC")
+
+	// A mechListMIC not over the mechanism list of the NegTokenInit is rejected
+	tr := r
+	tr.MechListMIC = append([]byte{}, r.MechListMIC...)
+	tr.MechListMIC[len(tr.MechListMIC)-1] ^= 0xff
+	_, _, err := i.Step(marshalTestNegTokenResp(t, tr))
+	if assert.Error(t, err, "tampered mechListMIC should be rejected") {
+		assert.Equal(t, gssapi.StatusBadMIC, err.(gssapi.Status).Code, "status code not as expected")
+	}
+	_, err = i.SecurityContext()
+	assert.Error(t, err, "initiator context should not be established")
+
+	_, cont, err := i.Step(marshalTestNegTokenResp(t, r))
+	if err != nil {
+		t.Fatalf("Error processing NegTokenResp: %v", err)
+	}
+	assert.False(t, cont, "initiator should complete on the NegTokenResp")
+}
+
+func TestSPNEGO_MechListMIC_Downgrade(t *testing.T) {
+	t.Parallel()
+	i, r, _ := newTestNegTokenResp(t)
+	// Selecting a mechanism other than the initiator's preferred one requires the mechListMIC
+	r.SupportedMech = gssapi.OIDMSLegacyKRB5.OID()
+	r.MechListMIC = nil
+	_, _, err := i.Step(marshalTestNegTokenResp(t, r))
+	if assert.Error(t, err, "NegTokenResp without the required mechListMIC should be rejected") {
+		assert.Equal(t, gssapi.StatusBadMIC, err.(gssapi.Status).Code, "status code not as expected")
+	}
+}
+
+func TestSPNEGO_MechListMIC_AcceptIncomplete(t *testing.T) {
+	t.Parallel()
+	i, r, a := newTestNegTokenResp(t)
+	// The acceptor sends its mechListMIC and requests that of the initiator
+	r.NegState = asn1.Enumerated(NegStateAcceptIncomplete)
+	ob, cont, err := i.Step(marshalTestNegTokenResp(t, r))
+	if err != nil {
+		t.Fatalf("Error processing NegTokenResp: %v", err)
+	}
+	assert.False(t, cont, "initiator should complete having verified the acceptor's mechListMIC")
+	var ot SPNEGOToken
+	if err := ot.Unmarshal(ob); err != nil {
+		t.Fatalf("Error unmarshalling initiator's NegTokenResp: %v", err)
+	}
+	assert.Equal(t, NegStateAcceptCompleted, ot.NegTokenResp.State(), "negotiation state not as expected")
+	asc, err := a.SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting acceptor security context: %v", err)
+	}
+	assert.NoError(t, VerifyMechListMIC(asc, i.mechTypes, ot.NegTokenResp.MechListMIC), "initiator's mechListMIC not verified")
+	_, err = i.SecurityContext()
+	assert.NoError(t, err, "initiator context should be established")
+}
+
+func TestSPNEGO_MechListMIC_RequestMIC(t *testing.T) {
+	t.Parallel()
+	i, r, _ := newTestNegTokenResp(t)
+	// The acceptor requests the initiator's mechListMIC before sending its own
+	mic := r.MechListMIC
+	r.NegState = asn1.Enumerated(NegStateRequestMIC)
+	r.MechListMIC = nil
+	ob, cont, err := i.Step(marshalTestNegTokenResp(t, r))
+	if err != nil {
+		t.Fatalf("Error processing NegTokenResp: %v", err)
+	}
+	assert.True(t, cont, "initiator should expect the acceptor's mechListMIC")
+	assert.NotEmpty(t, ob, "initiator should send its mechListMIC")
+
+	// The acceptor's mechListMIC is then required
+	_, _, err = i.Step(marshalTestNegTokenResp(t, NegTokenResp{NegState: asn1.Enumerated(NegStateAcceptCompleted)}))
+	if assert.Error(t, err, "completion without the acceptor's mechListMIC should be rejected") {
+		assert.Equal(t, gssapi.StatusBadMIC, err.(gssapi.Status).Code, "status code not as expected")
+	}
+	_, cont, err = i.Step(marshalTestNegTokenResp(t, NegTokenResp{NegState: asn1.Enumerated(NegStateAcceptCompleted), MechListMIC: mic}))
+	if err != nil {
+		t.Fatalf("Error processing NegTokenResp: %v", err)
+	}
+	assert.False(t, cont, "initiator should complete on the acceptor's mechListMIC")
+}
+
+func TestSPNEGO_MechListMIC_NegTokenInit(t *testing.T) {
+	t.Parallel()
+	i, tb, s := newTestInitiator(t)
+	var st SPNEGOToken
+	if err := st.Unmarshal(tb); err != nil {
+		t.Fatalf("Error unmarshalling NegTokenInit: %v", err)
+	}
+	sc, err := testKRB5Token(i).SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting initiator security context: %v", err)
+	}
+	// A mechListMIC in the NegTokenInit is verified against its mechanism list
+	st.NegTokenInit.MechListMIC, err = MechListMIC(sc, []asn1.ObjectIdentifier{gssapi.OIDMSLegacyKRB5.OID()})
+	if err != nil {
+		t.Fatalf("Error getting mechListMIC: %v", err)
+	}
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling NegTokenInit: %v", err)
+	}
+	a, err := s.NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	_, _, err = a.Step(b)
+	if assert.Error(t, err, "NegTokenInit with a mechListMIC for another mechanism list should be rejected") {
+		assert.Equal(t, gssapi.StatusBadMIC, err.(gssapi.Status).Code, "status code not as expected")
+	}
+}
+
+// testMech is a three leg mechanism, like NTLMSSP, whose establishers provide MICs computed with a shared key rather
+// than a gssapi.SecurityContext.
+type testMech struct {
+	oid asn1.ObjectIdentifier
+}
+
+func (m *testMech) OID() asn1.ObjectIdentifier {
+	return m.oid
+}
+
+func (m *testMech) NewInitiator() (gssapi.ContextEstablisher, error) {
+	return &testMechEstablisher{initiator: true}, nil
+}
+
+func (m *testMech) NewAcceptor() (gssapi.ContextEstablisher, error) {
+	return &testMechEstablisher{}, nil
+}
+
+type testMechEstablisher struct {
+	initiator bool
+	leg       int
+	complete  bool
+}
+
+// testMechLegs are the tokens of the test mechanism, alternately sent by the initiator and the acceptor.
+var testMechLegs = []string{"NEGOTIATE", "CHALLENGE", "AUTHENTICATE"}
+
+func (e *testMechEstablisher) Step(in []byte) ([]byte, bool, error) {
+	if e.initiator && e.leg == 0 {
+		e.leg++
+		return []byte(testMechLegs[0]), true, nil
+	}
+	if e.leg >= len(testMechLegs) || string(in) != testMechLegs[e.leg] {
+		return nil, false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: fmt.Sprintf("unexpected token %q", in)}
+	}
+	e.leg++
+	if e.leg == len(testMechLegs) {
+		e.complete = true
+		return nil, false, nil
+	}
+	out := testMechLegs[e.leg]
+	e.leg++
+	e.complete = e.leg == len(testMechLegs)
+	return []byte(out), !e.complete, nil
+}
+
+func (e *testMechEstablisher) SecurityContext() (*gssapi.SecurityContext, error) {
+	return nil, gssapi.Status{Code: gssapi.StatusUnavailable, Message: "test mechanism does not provide a security context"}
+}
+
+func (e *testMechEstablisher) Context() context.Context {
+	return context.Background()
+}
+
+func (e *testMechEstablisher) GetMIC(msg []byte) ([]byte, error) {
+	h := sha256.Sum256(append([]byte("test mechanism key"), msg...))
+	return h[:], nil
+}
+
+func (e *testMechEstablisher) VerifyMIC(msg, token []byte) error {
+	mic, _ := e.GetMIC(msg)
+	if !bytes.Equal(mic, token) {
+		return gssapi.Status{Code: gssapi.StatusBadMIC}
+	}
+	return nil
+}
+
+// exchangeTestTokens exchanges the context tokens of the initiator and the acceptor until both complete, returning the
+// tokens sent by the initiator.
+func exchangeTestTokens(t *testing.T, i, a gssapi.ContextEstablisher) []SPNEGOToken {
+	t.Helper()
+	var sent []SPNEGOToken
+	b, icont, err := i.Step(nil)
+	acont := true
+	for n := 0; n < 10 && (icont || acont); n++ {
+		if err != nil {
+			t.Fatalf("Error in initiator step %d: %v", n, err)
+		}
+		var st SPNEGOToken
+		if err := st.Unmarshal(b); err != nil {
+			t.Fatalf("Error unmarshalling initiator token %d: %v", n, err)
+		}
+		sent = append(sent, st)
+		b, acont, err = a.Step(b)
+		if err != nil {
+			t.Fatalf("Error in acceptor step %d: %v", n, err)
+		}
+		if !icont {
+			assert.Nil(t, b, "acceptor should not send a token the initiator does not expect")
+			break
+		}
+		b, icont, err = i.Step(b)
+		if !icont {
+			if err != nil {
+				t.Fatalf("Error in final initiator step: %v", err)
+			}
+			if acont {
+				continue
+			}
+			assert.Nil(t, b, "initiator should not send a token the acceptor does not expect")
+		}
+	}
+	assert.False(t, icont || acont, "establishment should complete")
+	return sent
+}
+
+func TestSPNEGO_FallbackMechanism(t *testing.T) {
+	t.Parallel()
+	// Kerberos V5 is not available without a KDC, so the initiator falls back to the added mechanism
+	cl := client.NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New())
+	ci := SPNEGOClient(cl, "HTTP/host.test.gokrb5")
+	mech := &testMech{oid: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 2, 2, 10}}
+	ci.AddMechanism(mech)
+	i, err := ci.NewInitiator()
+	if err != nil {
+		t.Fatalf("Error getting initiator: %v", err)
+	}
+	s := SPNEGOService(keytab.New())
+	s.AddMechanism(mech)
+	a, err := s.NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	sent := exchangeTestTokens(t, i, a)
+	if assert.Len(t, sent, 2, "initiator tokens not as expected") {
+		assert.Equal(t, []asn1.ObjectIdentifier{mech.oid}, sent[0].NegTokenInit.MechTypes, "mechanisms offered not as expected")
+		assert.Equal(t, []byte("AUTHENTICATE"), sent[1].NegTokenResp.ResponseToken, "final token not as expected")
+		assert.NotEmpty(t, sent[1].NegTokenResp.MechListMIC, "final token should carry the initiator's mechListMIC")
+	}
+	_, err = a.SecurityContext()
+	assert.Error(t, err, "test mechanism should not provide a security context")
+}
+
+func TestSPNEGO_SelectMechanism(t *testing.T) {
+	t.Parallel()
+	// The acceptor does not support the initiator's preferred mechanism, so the initiator restarts with the other and
+	// the mechListMIC exchange is required
+	preferred := &testMech{oid: asn1.ObjectIdentifier{1, 2, 3, 1}}
+	other := &testMech{oid: asn1.ObjectIdentifier{1, 2, 3, 2}}
+	ci := SPNEGOClient(client.NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New()), "HTTP/host.test.gokrb5")
+	ci.AddMechanism(preferred)
+	ci.AddMechanism(other)
+	i, err := ci.NewInitiator()
+	if err != nil {
+		t.Fatalf("Error getting initiator: %v", err)
+	}
+	s := SPNEGOService(keytab.New())
+	s.AddMechanism(other)
+	a, err := s.NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	sent := exchangeTestTokens(t, i, a)
+	if assert.Len(t, sent, 3, "initiator tokens not as expected") {
+		assert.Equal(t, []byte("NEGOTIATE"), sent[0].NegTokenInit.MechTokenBytes, "optimistic token not as expected")
+		assert.Equal(t, []byte("NEGOTIATE"), sent[1].NegTokenResp.ResponseToken, "restarted token not as expected")
+		assert.NotEmpty(t, sent[2].NegTokenResp.MechListMIC, "final token should carry the initiator's mechListMIC")
+	}
+	assert.True(t, a.(*spnegoAcceptor).micVerified, "acceptor should have verified the initiator's mechListMIC")
+	assert.True(t, i.(*spnegoInitiator).micVerified, "initiator should have verified the acceptor's mechListMIC")
+}
+
+func TestSPNEGO_SelectMechanism_NotSupported(t *testing.T) {
+	t.Parallel()
+	st := SPNEGOToken{
+		Init: true,
+		NegTokenInit: NegTokenInit{
+			MechTypes:      []asn1.ObjectIdentifier{{1, 2, 3, 1}},
+			MechTokenBytes: []byte("NEGOTIATE"),
+		},
+	}
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling NegTokenInit: %v", err)
+	}
+	a, err := SPNEGOService(keytab.New()).NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	rb, _, err := a.Step(b)
+	if assert.Error(t, err, "NegTokenInit without a supported mechanism should be rejected") {
+		assert.Equal(t, gssapi.StatusBadMech, err.(gssapi.Status).Code, "status code not as expected")
+	}
+	var rt SPNEGOToken
+	if err := rt.Unmarshal(rb); err != nil {
+		t.Fatalf("Error unmarshalling NegTokenResp: %v", err)
+	}
+	assert.Equal(t, NegStateReject, rt.NegTokenResp.State(), "negotiation state not as expected")
+}
+
+func TestSPNEGO_SelectMechanism_KRB5(t *testing.T) {
+	t.Parallel()
+	// The initiator prefers a mechanism the acceptor does not support, so the acceptor requests a Kerberos V5 token
+	i, tb, s := newTestInitiator(t)
+	var it SPNEGOToken
+	if err := it.Unmarshal(tb); err != nil {
+		t.Fatalf("Error unmarshalling NegTokenInit: %v", err)
+	}
+	krb5Tok := it.NegTokenInit.MechTokenBytes
+	mechTypes := append([]asn1.ObjectIdentifier{{1, 2, 3, 1}}, it.NegTokenInit.MechTypes...)
+	st := SPNEGOToken{Init: true, NegTokenInit: NegTokenInit{MechTypes: mechTypes, MechTokenBytes: []byte("NEGOTIATE")}}
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling NegTokenInit: %v", err)
+	}
+	a, err := s.NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	rb, cont, err := a.Step(b)
+	if err != nil {
+		t.Fatalf("Error accepting NegTokenInit: %v", err)
+	}
+	assert.True(t, cont, "acceptor should expect a Kerberos V5 token")
+	var rt SPNEGOToken
+	if err := rt.Unmarshal(rb); err != nil {
+		t.Fatalf("Error unmarshalling NegTokenResp: %v", err)
+	}
+	assert.Equal(t, NegStateAcceptIncomplete, rt.NegTokenResp.State(), "negotiation state not as expected")
+	assert.Equal(t, gssapi.OIDKRB5.OID(), rt.NegTokenResp.SupportedMech, "selected mechanism not as expected")
+	assert.Empty(t, rt.NegTokenResp.ResponseToken, "acceptor should not send a mechanism token")
+
+	// The Kerberos V5 token completes the mechanism but the initiator's mechListMIC is required
+	b, err = negTokenResp(NegStateAcceptIncomplete, nil, krb5Tok, nil)
+	if err != nil {
+		t.Fatalf("Error marshalling NegTokenResp: %v", err)
+	}
+	rb, cont, err = a.Step(b)
+	if err != nil {
+		t.Fatalf("Error accepting Kerberos V5 token: %v", err)
+	}
+	assert.True(t, cont, "acceptor should expect the initiator's mechListMIC")
+	if err := rt.Unmarshal(rb); err != nil {
+		t.Fatalf("Error unmarshalling NegTokenResp: %v", err)
+	}
+	assert.Equal(t, NegStateAcceptIncomplete, rt.NegTokenResp.State(), "negotiation state not as expected")
+	sc, err := testKRB5Token(i).SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting initiator security context: %v", err)
+	}
+	assert.NoError(t, VerifyMechListMIC(sc, mechTypes, rt.NegTokenResp.MechListMIC), "acceptor's mechListMIC not verified")
+	mic, err := MechListMIC(sc, mechTypes)
+	if err != nil {
+		t.Fatalf("Error getting mechListMIC: %v", err)
+	}
+	b, err = negTokenResp(NegStateAcceptCompleted, nil, nil, mic)
+	if err != nil {
+		t.Fatalf("Error marshalling NegTokenResp: %v", err)
+	}
+	rb, cont, err = a.Step(b)
+	if err != nil {
+		t.Fatalf("Error verifying initiator's mechListMIC: %v", err)
+	}
+	assert.False(t, cont, "acceptor should complete on the initiator's mechListMIC")
+	assert.Nil(t, rb, "acceptor should not send a further token")
+	_, err = a.SecurityContext()
+	assert.NoError(t, err, "acceptor context should be established")
+}
@@ -0,0 +1,148 @@
+package spnego
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/Osirium/gokrb5/v8/client"
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/gssapi"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/service"
+	"github.com/Osirium/gokrb5/v8/trace"
+	"github.com/jcmturner/goidentity/v6"
+)
+
+// GRPCMetadataAuth is the gRPC metadata key holding the Negotiate token of a call.
+const GRPCMetadataAuth = "authorization"
+
+// ErrGRPCNoToken is returned by GRPCAuthenticator when a call has no Negotiate token in its metadata.
+var ErrGRPCNoToken = errors.New("call does not have a negotiation authorization token")
+
+// GRPCCredentials authenticates gRPC calls with a Negotiate token in their metadata, as SPNEGO authenticates HTTP
+// requests. A new token is sent with each call, using the client's cached service ticket. GRPCCredentials implements
+// the PerRPCCredentials interface of google.golang.org/grpc/credentials without gokrb5 depending on gRPC:
+//
+//	conn, err := grpc.Dial(addr,
+//		grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)),
+//		grpc.WithPerRPCCredentials(spnego.NewGRPCCredentials(cl, "")))
+type GRPCCredentials struct {
+	krb5Client *client.Client
+	spn        string
+	insecure   bool
+}
+
+// NewGRPCCredentials returns GRPCCredentials authenticating calls as the Kerberos client to the service principal
+// name provided. To generate the SPN from the address of the server, as HTTP/hostname, pass an empty string.
+func NewGRPCCredentials(cl *client.Client, spn string) *GRPCCredentials {
+	return &GRPCCredentials{
+		krb5Client: cl,
+		spn:        spn,
+	}
+}
+
+// AllowInsecure allows the credentials to be sent on connections without transport security. The tokens are bound to
+// neither the call nor the connection, so this should only be used where the network is otherwise protected.
+func (c *GRPCCredentials) AllowInsecure() *GRPCCredentials {
+	c.insecure = true
+	return c
+}
+
+// GetRequestMetadata returns the metadata holding the Negotiate token for a call to the server at the URI provided.
+func (c *GRPCCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	u := "https://localhost"
+	if len(uri) > 0 {
+		u = uri[0]
+	} else if c.spn == "" {
+		return nil, errors.New("no SPN or server URI to authenticate to")
+	}
+	r, err := http.NewRequestWithContext(ctx, "POST", u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse server URI: %v", err)
+	}
+	if _, err := setSPNEGOHeader(c.krb5Client, r, c.spn); err != nil {
+		return nil, err
+	}
+	return map[string]string{GRPCMetadataAuth: r.Header.Get(HTTPHeaderAuthRequest)}, nil
+}
+
+// RequireTransportSecurity indicates if the credentials require transport security, which they do unless
+// AllowInsecure has been called.
+func (c *GRPCCredentials) RequireTransportSecurity() bool {
+	return !c.insecure
+}
+
+// GRPCAuthenticator verifies the Negotiate tokens of gRPC calls against a keytab. The unary and stream server
+// interceptors of the github.com/Osirium/gokrb5/v8/grpcspnego module call it, so that gokrb5 does not depend on gRPC:
+//
+//	auth := spnego.NewGRPCAuthenticator(kt)
+//	s := grpc.NewServer(
+//		grpc.UnaryInterceptor(grpcspnego.UnaryServerInterceptor(auth)),
+//		grpc.StreamInterceptor(grpcspnego.StreamServerInterceptor(auth)))
+//
+// The Identity of the authenticated user is then available from IdentityFromContext, as are any credentials they
+// delegated from DelegatedCredentials.
+type GRPCAuthenticator struct {
+	kt       *keytab.Keytab
+	settings []func(*service.Settings)
+}
+
+// NewGRPCAuthenticator returns a GRPCAuthenticator verifying tokens with the keytab and service settings provided.
+// To use a keytab that is reloaded when it changes pass a nil keytab and configure a keytab.Reloader with the
+// service.KeytabProvider setting.
+func NewGRPCAuthenticator(kt *keytab.Keytab, settings ...func(*service.Settings)) *GRPCAuthenticator {
+	return &GRPCAuthenticator{
+		kt:       kt,
+		settings: settings,
+	}
+}
+
+// Authenticate verifies the Negotiate token in the values of a call's authorization metadata and returns the call's
+// context with the Identity of the authenticated user added to it. A replay of a token already accepted is rejected.
+// The client's address is not checked against its ticket unless provided with the service.ClientAddress setting.
+func (a *GRPCAuthenticator) Authenticate(ctx context.Context, authorization []string) (context.Context, error) {
+	var tok string
+	for _, v := range authorization {
+		s := strings.SplitN(v, " ", 2)
+		if len(s) == 2 && s[0] == HTTPHeaderAuthResponseValueKey {
+			tok = s[1]
+			break
+		}
+	}
+	if tok == "" {
+		return ctx, ErrGRPCNoToken
+	}
+	b, err := base64.StdEncoding.DecodeString(tok)
+	if err != nil {
+		return ctx, fmt.Errorf("error in base64 decoding negotiation token: %v", err)
+	}
+	st, err := unmarshalNegotiationToken(b)
+	if err != nil {
+		return ctx, err
+	}
+	s := SPNEGOService(a.kt, a.settings...)
+	_, span := trace.StartSpan(ctx, s.serviceSettings.Spans(), trace.SpanSPNEGOAccept, trace.Attr(trace.AttrService, s.serviceSettings.SName()))
+	authed, sctx, status := s.AcceptSecContext(st)
+	if !authed {
+		if status.Code == gssapi.StatusComplete {
+			status = gssapi.Status{Code: gssapi.StatusFailure, Message: "Kerberos authentication failed"}
+		}
+		trace.EndSpan(span, status)
+		s.Log("gRPC SPNEGO validation error: %v", status)
+		return ctx, fmt.Errorf("SPNEGO validation error: %v", status)
+	}
+	trace.EndSpan(span, nil)
+	creds := sctx.Value(ctxCredentials).(*credentials.Credentials)
+	s.Log("%s@%s - gRPC SPNEGO authentication succeeded", creds.UserName(), creds.Domain())
+	ctx = context.WithValue(ctx, goidentity.CTXKey, creds)
+	ctx = context.WithValue(ctx, ctxIdentity, sctx.Value(ctxIdentity).(Identity))
+	if cred, ok := sctx.Value(ctxDelegatedCredentials).(messages.KRBCred); ok {
+		ctx = context.WithValue(ctx, ctxDelegatedCredentials, cred)
+	}
+	return ctx, nil
+}
@@ -0,0 +1,60 @@
+package spnego
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/jcmturner/goidentity/v6"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGRPCCredentials(t *testing.T) {
+	t.Parallel()
+	cl, kt := newTestTicketClient(t)
+	creds := NewGRPCCredentials(cl, "HTTP/host.test.gokrb5")
+	assert.True(t, creds.RequireTransportSecurity(), "transport security should be required by default")
+	assert.False(t, NewGRPCCredentials(cl, "").AllowInsecure().RequireTransportSecurity(), "transport security should not be required when insecure is allowed")
+
+	md, err := creds.GetRequestMetadata(context.Background(), "https://host.test.gokrb5:8443/test.Service")
+	if err != nil {
+		t.Fatalf("error getting request metadata: %v", err)
+	}
+	assert.True(t, strings.HasPrefix(md[GRPCMetadataAuth], "Negotiate "), "metadata not as expected")
+
+	auth := NewGRPCAuthenticator(kt)
+	ctx, err := auth.Authenticate(context.Background(), []string{"Basic dXNlcjpwYXNzd2Q=", md[GRPCMetadataAuth]})
+	if err != nil {
+		t.Fatalf("error authenticating call: %v", err)
+	}
+	id, ok := IdentityFromContext(ctx)
+	if assert.True(t, ok, "identity not added to the context") {
+		assert.Equal(t, "testuser1", id.Principal().PrincipalNameString(), "identity not as expected")
+		assert.Equal(t, "TEST.GOKRB5", id.Realm(), "identity realm not as expected")
+	}
+	gid, ok := ctx.Value(goidentity.CTXKey).(*credentials.Credentials)
+	if assert.True(t, ok, "credentials not added to the context") {
+		assert.Equal(t, "testuser1", gid.UserName(), "credentials not as expected")
+	}
+
+	// A replay of the token is rejected, while a new token for each call is accepted
+	_, err = auth.Authenticate(context.Background(), []string{md[GRPCMetadataAuth]})
+	assert.Error(t, err, "replayed token should be rejected")
+	md, err = creds.GetRequestMetadata(context.Background(), "https://host.test.gokrb5:8443/test.Service")
+	if err != nil {
+		t.Fatalf("error getting request metadata: %v", err)
+	}
+	_, err = auth.Authenticate(context.Background(), []string{md[GRPCMetadataAuth]})
+	assert.NoError(t, err, "new token should be accepted")
+}
+
+func TestGRPCAuthenticator_NoToken(t *testing.T) {
+	t.Parallel()
+	_, kt := newTestTicketClient(t)
+	auth := NewGRPCAuthenticator(kt)
+	_, err := auth.Authenticate(context.Background(), nil)
+	assert.Equal(t, ErrGRPCNoToken, err, "call without metadata should be rejected")
+	_, err = auth.Authenticate(context.Background(), []string{"Negotiate !!!"})
+	assert.Error(t, err, "call with a token that is not valid should be rejected")
+}
@@ -2,6 +2,7 @@ package spnego
 
 import (
 	"bytes"
+	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
@@ -19,10 +20,11 @@ import (
 	"github.com/Osirium/gokrb5/v8/iana/nametype"
 	"github.com/Osirium/gokrb5/v8/keytab"
 	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/messages"
 	"github.com/Osirium/gokrb5/v8/service"
+	"github.com/Osirium/gokrb5/v8/trace"
 	"github.com/Osirium/gokrb5/v8/types"
 	"github.com/jcmturner/gofork/encoding/asn1"
-	"github.com/jcmturner/goidentity/v6"
 )
 
 // Client side functionality //
@@ -108,7 +110,12 @@ func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
 		return resp, err
 	}
 	if respUnauthorizedNegotiate(resp) {
-		err := SetSPNEGOHeader(c.krb5Client, req, c.spn)
+		ctx, span := c.krb5Client.StartSpan(req.Context(), trace.SpanSPNEGO, trace.Attr(trace.AttrService, c.spn))
+		defer func() {
+			trace.EndSpan(span, err)
+		}()
+		req = req.WithContext(ctx)
+		mt, err := setSPNEGOHeader(c.krb5Client, req, c.spn)
 		if err != nil {
 			return resp, err
 		}
@@ -118,11 +125,56 @@ func (c *Client) Do(req *http.Request) (resp *http.Response, err error) {
 		}
 		io.Copy(ioutil.Discard, resp.Body)
 		resp.Body.Close()
-		return c.Do(req)
+		resp, err = c.Do(req)
+		if err != nil || !c.krb5Client.MutualAuthentication() || respUnauthorizedNegotiate(resp) {
+			return resp, err
+		}
+		if err := verifyRespMutualAuth(resp, mt); err != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+			return nil, err
+		}
 	}
 	return resp, err
 }
 
+// verifyRespMutualAuth verifies the AP_REP in the negotiation header of the service's response against the KRB5 token
+// of the request, completing mutual authentication of the service, and any mechListMIC of the service.
+func verifyRespMutualAuth(resp *http.Response, mt *KRB5Token) error {
+	if mt == nil {
+		return errors.New("request does not contain a KRB5 token for mutual authentication")
+	}
+	s := strings.SplitN(resp.Header.Get(HTTPHeaderAuthResponse), " ", 2)
+	if len(s) != 2 || s[0] != HTTPHeaderAuthResponseValueKey {
+		return errors.New("service response does not contain a negotiation header for mutual authentication")
+	}
+	b, err := base64.StdEncoding.DecodeString(s[1])
+	if err != nil {
+		return fmt.Errorf("error in base64 decoding negotiation header: %v", err)
+	}
+	var st SPNEGOToken
+	if err := st.Unmarshal(b); err != nil {
+		return fmt.Errorf("error in unmarshaling SPNEGO token: %v", err)
+	}
+	if !st.Resp || st.NegTokenResp.State() != NegStateAcceptCompleted {
+		return errors.New("service negotiation header is not a completed NegTokenResp")
+	}
+	if err := verifyMutualAuth(mt, st.NegTokenResp); err != nil {
+		return fmt.Errorf("mutual authentication of the service failed: %v", err)
+	}
+	if len(st.NegTokenResp.MechListMIC) > 0 {
+		sc, err := mt.SecurityContext()
+		if err != nil {
+			return err
+		}
+		// The NegTokenInit of the request offers only the Kerberos V5 mechanism
+		if err := VerifyMechListMIC(sc, []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()}, st.NegTokenResp.MechListMIC); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // Get is the SPNEGO enabled HTTP client's equivalent of the http.Client's Get method.
 func (c *Client) Get(url string) (resp *http.Response, err error) {
 	req, err := http.NewRequest("GET", url, nil)
@@ -158,8 +210,11 @@ func (c *Client) Head(url string) (resp *http.Response, err error) {
 
 func respUnauthorizedNegotiate(resp *http.Response) bool {
 	if resp.StatusCode == http.StatusUnauthorized {
-		if resp.Header.Get(HTTPHeaderAuthResponse) == HTTPHeaderAuthResponseValueKey {
-			return true
+		// The Negotiate challenge may be one of several authentication schemes offered
+		for _, v := range resp.Header.Values(HTTPHeaderAuthResponse) {
+			if strings.EqualFold(strings.TrimSpace(v), HTTPHeaderAuthResponseValueKey) {
+				return true
+			}
 		}
 	}
 	return false
@@ -196,10 +251,16 @@ func setRequestSPN(r *http.Request) (types.PrincipalName, error) {
 // SetSPNEGOHeader gets the service ticket and sets it as the SPNEGO authorization header on HTTP request object.
 // To auto generate the SPN from the request object pass a null string "".
 func SetSPNEGOHeader(cl *client.Client, r *http.Request, spn string) error {
+	_, err := setSPNEGOHeader(cl, r, spn)
+	return err
+}
+
+// setSPNEGOHeader sets the SPNEGO authorization header on the HTTP request and returns the KRB5 mech token within it.
+func setSPNEGOHeader(cl *client.Client, r *http.Request, spn string) (*KRB5Token, error) {
 	if spn == "" {
 		pn, err := setRequestSPN(r)
 		if err != nil {
-			return err
+			return nil, err
 		}
 		spn = pn.PrincipalNameString()
 	}
@@ -207,25 +268,26 @@ func SetSPNEGOHeader(cl *client.Client, r *http.Request, spn string) error {
 	s := SPNEGOClient(cl, spn)
 	err := s.AcquireCred()
 	if err != nil {
-		return fmt.Errorf("could not acquire client credential: %v", err)
+		return nil, fmt.Errorf("could not acquire client credential: %v", err)
 	}
-	st, err := s.InitSecContext()
+	st, err := s.initSecContext(r.Context())
 	if err != nil {
-		return fmt.Errorf("could not initialize context: %v", err)
+		return nil, fmt.Errorf("could not initialize context: %v", err)
 	}
 	nb, err := st.Marshal()
 	if err != nil {
-		return krberror.Errorf(err, krberror.EncodingError, "could not marshal SPNEGO")
+		return nil, krberror.Errorf(err, krberror.EncodingError, "could not marshal SPNEGO")
 	}
 	hs := "Negotiate " + base64.StdEncoding.EncodeToString(nb)
 	r.Header.Set(HTTPHeaderAuthRequest, hs)
-	return nil
+	mt, _ := st.(*SPNEGOToken).NegTokenInit.mechToken.(*KRB5Token)
+	return mt, nil
 }
 
 // Service side functionality //
 
 const (
-	// spnegoNegTokenRespKRBAcceptCompleted - The response on successful authentication always has this header. Capturing as const so we don't have marshaling and encoding overhead.
+	// spnegoNegTokenRespKRBAcceptCompleted - The response on successful authentication with a token that is not a NegTokenInit. Capturing as const so we don't have marshaling and encoding overhead.
 	spnegoNegTokenRespKRBAcceptCompleted = "Negotiate oRQwEqADCgEAoQsGCSqGSIb3EgECAg=="
 	// spnegoNegTokenRespReject - The response on a failed authentication always has this rejection header. Capturing as const so we don't have marshaling and encoding overhead.
 	spnegoNegTokenRespReject = "Negotiate oQcwBaADCgEC"
@@ -235,6 +297,10 @@ const (
 	sessionCredentials = "github.com/Osirium/gokrb5/v8/sessionCredentials"
 	// ctxCredentials is the SPNEGO context key holding the credentials jcmturner/goidentity/Identity object.
 	ctxCredentials = "github.com/Osirium/gokrb5/v8/ctxCredentials"
+	// ctxDelegatedCredentials is the SPNEGO context key holding the messages.KRBCred of credentials delegated by the user.
+	ctxDelegatedCredentials = "github.com/Osirium/gokrb5/v8/ctxDelegatedCredentials"
+	// ctxIdentity is the SPNEGO context key holding the Identity of the authenticated user.
+	ctxIdentity = "github.com/Osirium/gokrb5/v8/ctxIdentity"
 	// HTTPHeaderAuthRequest is the header that will hold authn/z information.
 	HTTPHeaderAuthRequest = "Authorization"
 	// HTTPHeaderAuthResponse is the header that will hold SPNEGO data from the server.
@@ -245,64 +311,21 @@ const (
 	UnauthorizedMsg = "Unauthorised.\n"
 )
 
-// SPNEGOKRB5Authenticate is a Kerberos SPNEGO authentication HTTP handler wrapper.
+// SPNEGOKRB5Authenticate is a Kerberos SPNEGO authentication HTTP handler wrapper, equivalent to Middleware.
 func SPNEGOKRB5Authenticate(inner http.Handler, kt *keytab.Keytab, settings ...func(*service.Settings)) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Set up the SPNEGO GSS-API mechanism
-		var spnego *SPNEGO
-		h, err := types.GetHostAddress(r.RemoteAddr)
-		if err == nil {
-			// put in this order so that if the user provides a ClientAddress it will override the one here.
-			o := append([]func(*service.Settings){service.ClientAddress(h)}, settings...)
-			spnego = SPNEGOService(kt, o...)
-		} else {
-			spnego = SPNEGOService(kt, settings...)
-			spnego.Log("%s - SPNEGO could not parse client address: %v", r.RemoteAddr, err)
-		}
-
-		// Check if there is a session manager and if there is an already established session for this client
-		id, err := getSessionCredentials(spnego, r)
-		if err == nil && id.Authenticated() {
-			// There is an established session so bypass auth and serve
-			spnego.Log("%s - SPNEGO request served under session %s", r.RemoteAddr, id.SessionID())
-			inner.ServeHTTP(w, goidentity.AddToHTTPRequestContext(&id, r))
-			return
-		}
-
-		st, err := getAuthorizationNegotiationHeaderAsSPNEGOToken(spnego, r, w)
-		if st == nil || err != nil {
-			// response to client and logging handled in function above so just return
-			return
-		}
-
-		// Validate the context token
-		authed, ctx, status := spnego.AcceptSecContext(st)
-		if status.Code != gssapi.StatusComplete && status.Code != gssapi.StatusContinueNeeded {
-			spnegoResponseReject(spnego, w, "%s - SPNEGO validation error: %v", r.RemoteAddr, status)
-			return
-		}
-		if status.Code == gssapi.StatusContinueNeeded {
-			spnegoNegotiateKRB5MechType(spnego, w, "%s - SPNEGO GSS-API continue needed", r.RemoteAddr)
-			return
-		}
+	return Middleware(inner, kt, settings...)
+}
 
-		if authed {
-			// Authentication successful; get user's credentials from the context
-			id := ctx.Value(ctxCredentials).(*credentials.Credentials)
-			// Create a new session if a session manager has been configured
-			err = newSession(spnego, r, w, id)
-			if err != nil {
-				return
-			}
-			spnegoResponseAcceptCompleted(spnego, w, "%s %s@%s - SPNEGO authentication succeeded", r.RemoteAddr, id.UserName(), id.Domain())
-			// Add the identity to the context and serve the inner/wrapped handler
-			inner.ServeHTTP(w, goidentity.AddToHTTPRequestContext(id, r))
-			return
-		}
-		// If we get to here we have not authenticationed so just reject
-		spnegoResponseReject(spnego, w, "%s - SPNEGO Kerberos authentication failed", r.RemoteAddr)
-		return
-	})
+// DelegatedCredentials returns the credentials the user delegated when authenticating the request with SPNEGO, if
+// they did. The credentials are only available on the request the security context was established with, not on
+// requests served under an established session. Use client.NewFromKRBCred to act on behalf of the user:
+//
+//	if cred, ok := spnego.DelegatedCredentials(r.Context()); ok {
+//		cl, err := client.NewFromKRBCred(cred, cfg)
+//	}
+func DelegatedCredentials(ctx context.Context) (messages.KRBCred, bool) {
+	cred, ok := ctx.Value(ctxDelegatedCredentials).(messages.KRBCred)
+	return cred, ok
 }
 
 func getAuthorizationNegotiationHeaderAsSPNEGOToken(spnego *SPNEGO, r *http.Request, w http.ResponseWriter) (*SPNEGOToken, error) {
@@ -321,15 +344,24 @@ func getAuthorizationNegotiationHeaderAsSPNEGOToken(spnego *SPNEGO, r *http.Requ
 		spnegoNegotiateKRB5MechType(spnego, w, "%s - SPNEGO %v", r.RemoteAddr, err)
 		return nil, err
 	}
+	st, err := unmarshalNegotiationToken(b)
+	if err != nil {
+		spnegoNegotiateKRB5MechType(spnego, w, "%s - SPNEGO %v", r.RemoteAddr, err)
+		return nil, err
+	}
+	return st, nil
+}
+
+// unmarshalNegotiationToken unmarshals the token of a Negotiate authorization, which is an SPNEGO token or a raw KRB5
+// token.
+func unmarshalNegotiationToken(b []byte) (*SPNEGOToken, error) {
 	var st SPNEGOToken
-	err = st.Unmarshal(b)
+	err := st.Unmarshal(b)
 	if err != nil {
 		// Check if this is a raw KRB5 context token - issue #347.
 		var k5t KRB5Token
 		if k5t.Unmarshal(b) != nil {
-			err = fmt.Errorf("error in unmarshaling SPNEGO token: %v", err)
-			spnegoNegotiateKRB5MechType(spnego, w, "%s - SPNEGO %v", r.RemoteAddr, err)
-			return nil, err
+			return nil, fmt.Errorf("error in unmarshaling SPNEGO token: %v", err)
 		}
 		// Wrap it into an SPNEGO context token
 		st.Init = true
@@ -390,9 +422,27 @@ func spnegoResponseReject(s *SPNEGO, w http.ResponseWriter, format string, v ...
 	http.Error(w, UnauthorizedMsg, http.StatusUnauthorized)
 }
 
-func spnegoResponseAcceptCompleted(s *SPNEGO, w http.ResponseWriter, format string, v ...interface{}) {
+func spnegoResponseAcceptCompleted(s *SPNEGO, w http.ResponseWriter, hdr string, format string, v ...interface{}) {
 	s.Log(format, v...)
-	w.Header().Set(HTTPHeaderAuthResponse, spnegoNegTokenRespKRBAcceptCompleted)
+	w.Header().Set(HTTPHeaderAuthResponse, hdr)
+}
+
+// acceptCompletedHeader returns the negotiation header completing the negotiation of the verified SPNEGO token, which
+// carries the mechListMIC and, if the client requested mutual authentication, an AP_REP.
+func acceptCompletedHeader(st *SPNEGOToken) (string, error) {
+	mt, ok := st.NegTokenInit.mechToken.(*KRB5Token)
+	if !st.Init || !ok {
+		return spnegoNegTokenRespKRBAcceptCompleted, nil
+	}
+	r, _, err := acceptCompletedToken(st, mt)
+	if err != nil {
+		return "", err
+	}
+	b, err := r.Marshal()
+	if err != nil {
+		return "", err
+	}
+	return HTTPHeaderAuthResponseValueKey + " " + base64.StdEncoding.EncodeToString(b), nil
 }
 
 func spnegoInternalServerError(s *SPNEGO, w http.ResponseWriter, format string, v ...interface{}) {
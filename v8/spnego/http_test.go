@@ -78,6 +78,41 @@ func TestClient_SetSPNEGOHeader(t *testing.T) {
 	}
 }
 
+func TestClient_SetSPNEGOHeader_Concurrent(t *testing.T) {
+	test.Integration(t)
+	b, _ := hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
+	kt := keytab.New()
+	kt.Unmarshal(b)
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	addr := os.Getenv("TEST_KDC_ADDR")
+	if addr == "" {
+		addr = testdata.KDC_IP_TEST_GOKRB5
+	}
+	c.Realms[0].KDC = []string{addr + ":" + testdata.KDC_PORT_TEST_GOKRB5}
+	cl := client.NewWithKeytab("testuser1", "TEST.GOKRB5", kt, c)
+
+	// Handlers sharing the client log it in and set headers concurrently
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest("GET", "http://host.test.gokrb5/modkerb/index.html", nil)
+			if err := SetSPNEGOHeader(cl, r, ""); err != nil {
+				t.Errorf("error setting client SPNEGO header: %v", err)
+				return
+			}
+			httpResp, err := http.DefaultClient.Do(r)
+			if err != nil {
+				t.Errorf("request error: %v", err)
+				return
+			}
+			assert.Equal(t, http.StatusOK, httpResp.StatusCode, "Status code in response to client SPNEGO request not as expected")
+		}()
+	}
+	wg.Wait()
+}
+
 func TestSPNEGOHTTPClient(t *testing.T) {
 	test.Integration(t)
 	b, _ := hex.DecodeString(testdata.KEYTAB_TESTUSER1_TEST_GOKRB5)
@@ -439,3 +474,36 @@ func (smgr SessionMgr) New(w http.ResponseWriter, r *http.Request, k string, v [
 	s.Values[k] = v
 	return s.Save(r, w)
 }
+
+func TestService_SPNEGOKRB_MutualAuthentication(t *testing.T) {
+	t.Parallel()
+	cl, tkt, key, _ := newTestTicket(t, client.MutualAuthentication(true))
+	nt, err := NewNegTokenInitKRB5(cl, tkt, key)
+	if err != nil {
+		t.Fatalf("Error creating NegTokenInit: %v", err)
+	}
+	st := SPNEGOToken{Init: true, NegTokenInit: nt}
+	b, err := st.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling NegTokenInit: %v", err)
+	}
+	mt := nt.mechToken.(*KRB5Token)
+	s := httpServerWithoutSessionManager()
+	defer s.Close()
+
+	r, _ := http.NewRequest("GET", s.URL, nil)
+	r.Header.Set(HTTPHeaderAuthRequest, HTTPHeaderAuthResponseValueKey+" "+base64.StdEncoding.EncodeToString(b))
+	httpResp, err := http.DefaultClient.Do(r)
+	if err != nil {
+		t.Fatalf("Request error: %v", err)
+	}
+	httpResp.Body.Close()
+	assert.Equal(t, http.StatusOK, httpResp.StatusCode, "Status code in response to client SPNEGO request not as expected")
+	if err := verifyRespMutualAuth(httpResp, mt); err != nil {
+		t.Fatalf("Error verifying mutual authentication: %v", err)
+	}
+	assert.True(t, mt.MutualAuthComplete(), "mutual authentication should be complete")
+
+	httpResp.Header.Del(HTTPHeaderAuthResponse)
+	assert.Error(t, verifyRespMutualAuth(httpResp, mt), "response without negotiation header should fail mutual authentication")
+}
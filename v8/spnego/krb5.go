@@ -0,0 +1,237 @@
+package spnego
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+
+	"github.com/Osirium/gokrb5/v8/client"
+	"github.com/Osirium/gokrb5/v8/gssapi"
+	"github.com/Osirium/gokrb5/v8/iana/chksumtype"
+	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/service"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/gofork/encoding/asn1"
+)
+
+// KRB5 implements the GSS-API Kerberos V5 mechanism of RFC 4121 without SPNEGO negotiation. Its context tokens are
+// KRB5 tokens carrying the KRB_AP_REQ and KRB_AP_REP directly, as expected by peers such as OpenSSH and SASL GSSAPI
+// services. Contexts are mutually authenticated.
+type KRB5 struct {
+	serviceSettings *service.Settings
+	client          *client.Client
+	spn             string
+	channelBindings *gssapi.ChannelBindings
+	// oid is the OID the mechanism is negotiated under by SPNEGO, which may be the Microsoft legacy OID.
+	oid asn1.ObjectIdentifier
+	// negotiated indicates the mechanism is negotiated by SPNEGO, where mutual authentication is only requested if
+	// the client is configured to.
+	negotiated bool
+}
+
+// KRB5Client configures the Kerberos V5 mechanism suitable for client side use.
+func KRB5Client(cl *client.Client, spn string) *KRB5 {
+	return &KRB5{
+		serviceSettings: service.NewSettings(nil),
+		client:          cl,
+		spn:             spn,
+	}
+}
+
+// KRB5Service configures the Kerberos V5 mechanism suitable for service side use.
+func KRB5Service(kt *keytab.Keytab, options ...func(*service.Settings)) *KRB5 {
+	return &KRB5{
+		serviceSettings: service.NewSettings(kt, options...),
+	}
+}
+
+// SetChannelBindings sets the channel bindings of the channel the security context is established over. The client
+// side hashes them into the authenticator checksum of its AP_REQ and the service side verifies that checksum.
+func (k *KRB5) SetChannelBindings(cb gssapi.ChannelBindings) {
+	k.channelBindings = &cb
+	service.ChannelBindings(cb)(k.serviceSettings)
+}
+
+// OID returns the GSS-API assigned OID for Kerberos V5.
+func (k *KRB5) OID() asn1.ObjectIdentifier {
+	if len(k.oid) > 0 {
+		return k.oid
+	}
+	return gssapi.OIDKRB5.OID()
+}
+
+// NewInitiator returns the initiator side of the establishment of a security context with the service, for use with
+// gssapi.InitSecContext. The mechanism must be configured for client side use.
+func (k *KRB5) NewInitiator() (gssapi.ContextEstablisher, error) {
+	if k.client == nil {
+		return nil, errors.New("KRB5 mechanism is not configured for client side use")
+	}
+	return &krb5Initiator{mech: k}, nil
+}
+
+// NewAcceptor returns the acceptor side of the establishment of a security context with a client, for use with
+// gssapi.AcceptSecContext. The mechanism must be configured for service side use.
+func (k *KRB5) NewAcceptor() (gssapi.ContextEstablisher, error) {
+	if k.client != nil {
+		return nil, errors.New("KRB5 mechanism is not configured for service side use")
+	}
+	return &krb5Acceptor{mech: k}, nil
+}
+
+// krb5Initiator establishes a security context by sending a KRB5 token with AP_REQ and verifying the acceptor's
+// KRB5 token with AP_REP.
+type krb5Initiator struct {
+	mech     *KRB5
+	token    *KRB5Token
+	mutual   bool
+	complete bool
+}
+
+// Step returns the AP_REQ token on the first call and verifies the acceptor's AP_REP token on the second. Without
+// mutual authentication the acceptor may send no token.
+func (i *krb5Initiator) Step(in []byte) ([]byte, bool, error) {
+	if i.complete {
+		return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: "security context already established"}
+	}
+	if i.token == nil {
+		tkt, key, err := i.mech.client.GetServiceTicket(i.mech.spn)
+		if err != nil {
+			return nil, false, gssapi.Status{Code: gssapi.StatusNoCred, Message: err.Error()}
+		}
+		return i.apReqToken(tkt, key)
+	}
+	if len(in) == 0 {
+		if i.mutual {
+			return nil, false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "no AP_REP token received for mutual authentication"}
+		}
+		i.complete = true
+		return nil, false, nil
+	}
+	var rep KRB5Token
+	if err := rep.Unmarshal(in); err != nil {
+		return nil, false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: err.Error()}
+	}
+	if rep.IsKRBError() {
+		return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: rep.KRBError.Error()}
+	}
+	if err := i.token.VerifyAPRep(rep); err != nil {
+		return nil, false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: err.Error()}
+	}
+	i.complete = true
+	return nil, false, nil
+}
+
+// apReqToken creates the KRB5 token with the AP_REQ for the service ticket. Mutual authentication is required unless
+// the mechanism is negotiated by SPNEGO and the client is not configured to request it.
+func (i *krb5Initiator) apReqToken(tkt messages.Ticket, key types.EncryptionKey) ([]byte, bool, error) {
+	gssFlags := []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}
+	if i.mech.client.DelegateCredentials() {
+		gssFlags = append(gssFlags, gssapi.ContextFlagDeleg)
+	}
+	apOptions := []int{}
+	i.mutual = !i.mech.negotiated || i.mech.client.MutualAuthentication()
+	if i.mutual {
+		gssFlags = append(gssFlags, gssapi.ContextFlagMutual)
+		apOptions = append(apOptions, flags.APOptionMutualRequired)
+	}
+	mt, err := newKRB5TokenAPREQ(i.mech.client, tkt, key, gssFlags, apOptions, i.mech.channelBindings)
+	if err != nil {
+		return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: err.Error()}
+	}
+	b, err := mt.Marshal()
+	if err != nil {
+		return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: err.Error()}
+	}
+	i.token = &mt
+	return b, true, nil
+}
+
+// SecurityContext returns the security context established with the acceptor.
+func (i *krb5Initiator) SecurityContext() (*gssapi.SecurityContext, error) {
+	if !i.complete {
+		return nil, gssapi.Status{Code: gssapi.StatusNoContext, Message: "security context not established"}
+	}
+	return i.token.SecurityContext()
+}
+
+// Context returns the context of the initiator.
+func (i *krb5Initiator) Context() context.Context {
+	return context.Background()
+}
+
+// krb5Acceptor establishes a security context by verifying the initiator's KRB5 token with AP_REQ and, if mutual
+// authentication is requested, replying with a KRB5 token with AP_REP.
+type krb5Acceptor struct {
+	mech  *KRB5
+	token *KRB5Token
+}
+
+// Step verifies the initiator's AP_REQ token and returns the AP_REP token, or a KRB_ERROR token if not valid.
+func (a *krb5Acceptor) Step(in []byte) ([]byte, bool, error) {
+	if a.token != nil {
+		return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: "security context already established"}
+	}
+	mt := KRB5Token{settings: a.mech.serviceSettings}
+	if err := mt.Unmarshal(in); err != nil {
+		return nil, false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: err.Error()}
+	}
+	if !mt.IsAPReq() {
+		return nil, false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "KRB5 token from initiator does not contain an AP_REQ"}
+	}
+	ok, status := mt.Verify()
+	if !ok {
+		return errorToken(&mt, status), false, status
+	}
+	var out []byte
+	if mutualRequested(&mt) {
+		rep, err := NewKRB5TokenAPREP(&mt)
+		if err != nil {
+			return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: err.Error()}
+		}
+		out, err = rep.Marshal()
+		if err != nil {
+			return nil, false, gssapi.Status{Code: gssapi.StatusFailure, Message: err.Error()}
+		}
+	}
+	a.token = &mt
+	return out, false, nil
+}
+
+// SecurityContext returns the security context established with the initiator.
+func (a *krb5Acceptor) SecurityContext() (*gssapi.SecurityContext, error) {
+	if a.token == nil {
+		return nil, gssapi.Status{Code: gssapi.StatusNoContext, Message: "security context not established"}
+	}
+	return a.token.SecurityContext()
+}
+
+// Context returns the context of the acceptor which will contain the verified identity of the initiator and any
+// credentials it delegated.
+func (a *krb5Acceptor) Context() context.Context {
+	if a.token == nil {
+		return nil
+	}
+	return a.token.Context()
+}
+
+// mutualRequested indicates if the initiator of the AP_REQ token requested mutual authentication, by the AP_REQ
+// option or the flags of the authenticator checksum.
+func mutualRequested(mt *KRB5Token) bool {
+	if types.IsFlagSet(&mt.APReq.APOptions, flags.APOptionMutualRequired) {
+		return true
+	}
+	c := mt.APReq.Authenticator.Cksum
+	return c.CksumType == chksumtype.GSSAPI && len(c.Checksum) >= 24 &&
+		binary.LittleEndian.Uint32(c.Checksum[20:24])&uint32(gssapi.ContextFlagMutual) != 0
+}
+
+// errorToken returns the KRB5 token with the KRB_ERROR informing the initiator its AP_REQ token was not valid.
+func errorToken(mt *KRB5Token, status gssapi.Status) []byte {
+	e := messages.NewKRBError(mt.APReq.Ticket.SName, mt.APReq.Ticket.Realm, errorcode.KRB_ERR_GENERIC, status.Error())
+	t := NewKRB5TokenKRBError(e)
+	b, _ := t.Marshal()
+	return b
+}
@@ -1,15 +1,21 @@
 package spnego
 
 import (
+	"bytes"
 	"context"
+	"crypto/rand"
+	"crypto/subtle"
 	"encoding/binary"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"math"
+	"math/big"
 
 	"github.com/Osirium/gokrb5/v8/asn1tools"
 	"github.com/Osirium/gokrb5/v8/client"
 	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/crypto"
 	"github.com/Osirium/gokrb5/v8/gssapi"
 	"github.com/Osirium/gokrb5/v8/iana/chksumtype"
 	"github.com/Osirium/gokrb5/v8/iana/msgtype"
@@ -36,6 +42,11 @@ type KRB5Token struct {
 	KRBError messages.KRBError
 	settings *service.Settings
 	context  context.Context
+	// sessionKey and flags are those of the security context established by the initiator's AP_REQ.
+	sessionKey types.EncryptionKey
+	flags      int
+	// apRep is the encrypted part of the AP_REP replying to the AP_REQ when the context is mutually authenticated.
+	apRep *messages.EncAPRepPart
 }
 
 // Marshal a KRB5Token into a slice of bytes.
@@ -52,9 +63,15 @@ func (m *KRB5Token) Marshal() ([]byte, error) {
 			return []byte{}, fmt.Errorf("error marshalling AP_REQ for MechToken: %v", err)
 		}
 	case TOK_ID_KRB_AP_REP:
-		return []byte{}, errors.New("marshal of AP_REP GSSAPI MechToken not supported by gokrb5")
+		tb, err = m.APRep.Marshal()
+		if err != nil {
+			return []byte{}, fmt.Errorf("error marshalling AP_REP for MechToken: %v", err)
+		}
 	case TOK_ID_KRB_ERROR:
-		return []byte{}, errors.New("marshal of KRB_ERROR GSSAPI MechToken not supported by gokrb5")
+		tb, err = m.KRBError.Marshal()
+		if err != nil {
+			return []byte{}, fmt.Errorf("error marshalling KRB_ERROR for MechToken: %v", err)
+		}
 	}
 	if err != nil {
 		return []byte{}, fmt.Errorf("error mashalling kerberos message within mech token: %v", err)
@@ -115,13 +132,29 @@ func (m *KRB5Token) Verify() (bool, gssapi.Status) {
 		if !ok {
 			return false, gssapi.Status{Code: gssapi.StatusDefectiveCredential, Message: "KRB5_AP_REQ token not valid"}
 		}
+		if cb := m.settings.ChannelBindings(); cb != nil {
+			if err := verifyChannelBindings(m.APReq.Authenticator.Cksum, *cb); err != nil {
+				return false, gssapi.Status{Code: gssapi.StatusBadBindings, Message: err.Error()}
+			}
+		}
 		m.context = context.Background()
 		m.context = context.WithValue(m.context, ctxCredentials, creds)
+		key := m.APReq.Ticket.DecryptedEncPart.Key
+		if m.APReq.Authenticator.SubKey.KeyType != 0 {
+			key = m.APReq.Authenticator.SubKey
+		}
+		m.context = context.WithValue(m.context, ctxIdentity, service.NewIdentity(creds, key))
+		cred, ok, err := service.DelegatedCredentials(&m.APReq)
+		if err != nil {
+			return false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: err.Error()}
+		}
+		if ok {
+			m.context = context.WithValue(m.context, ctxDelegatedCredentials, cred)
+		}
 		return true, gssapi.Status{Code: gssapi.StatusComplete}
 	case TOK_ID_KRB_AP_REP:
-		// Client side
-		// TODO how to verify the AP_REP - not yet implemented
-		return false, gssapi.Status{Code: gssapi.StatusFailure, Message: "verifying an AP_REP is not currently supported by gokrb5"}
+		// Client side, where the AP_REP is verified against the initiator's token
+		return false, gssapi.Status{Code: gssapi.StatusFailure, Message: "an AP_REP is verified by the VerifyAPRep method of the initiator's KRB5 token"}
 	case TOK_ID_KRB_ERROR:
 		if m.KRBError.MsgType != msgtype.KRB_ERROR {
 			return false, gssapi.Status{Code: gssapi.StatusDefectiveToken, Message: "KRB5_Error token not valid"}
@@ -155,23 +188,113 @@ func (m *KRB5Token) IsKRBError() bool {
 	return false
 }
 
-// Context returns the KRB5 token's context which will contain any verify user identity information.
+// PseudoRandom returns n bytes of pseudo-random output derived from the keys of the security context established by the
+// token's AP_REQ, as GSS_Pseudo_random of RFC 4401 defined for the Kerberos mechanism in RFC 4402. prfKey selects
+// the key used and is one of gssapi.PRFKeyPartial or gssapi.PRFKeyFull.
+// The initiator can call this on the token it created; the acceptor once the token has been verified.
+func (m *KRB5Token) PseudoRandom(prfKey int, prfIn []byte, n int) ([]byte, error) {
+	if !m.IsAPReq() {
+		return nil, errors.New("KRB5 token does not contain an AP_REQ")
+	}
+	keys := m.contextKeys()
+	key, err := gssapi.PRFKey(prfKey, keys.SessionKey, keys.InitiatorSubkey, keys.AcceptorSubkey)
+	if err != nil {
+		return nil, err
+	}
+	return gssapi.PseudoRandom(key, prfIn, n)
+}
+
+// contextKeys returns the keys of the security context established by the token's AP_REQ, and AP_REP if mutually
+// authenticated.
+func (m *KRB5Token) contextKeys() gssapi.ContextKeys {
+	keys := gssapi.ContextKeys{SessionKey: m.sessionKey, InitiatorSubkey: m.APReq.Authenticator.SubKey}
+	if len(m.sessionKey.KeyValue) == 0 {
+		// Acceptor side, where the keys are those of the verified AP_REQ
+		keys.SessionKey = m.APReq.Ticket.DecryptedEncPart.Key
+	}
+	if m.apRep != nil {
+		keys.AcceptorSubkey = m.apRep.Subkey
+	}
+	return keys
+}
+
+// SecurityContext returns the security context established by the token's AP_REQ, which protects the messages
+// exchanged with the peer with per-message tokens.
+// The initiator can call this on the token it created; the acceptor once the token has been verified. When mutually
+// authenticated, once the initiator has verified the AP_REP or the acceptor has created it, the acceptor's tokens are
+// protected by any subkey of the AP_REP and numbered from its sequence number. Without an AP_REP the sequence numbers
+// of both directions start from that of the initiator's authenticator. The acceptor's
+// context expires with the ticket; the initiator can set the expiry with SetEndTime.
+func (m *KRB5Token) SecurityContext() (*gssapi.SecurityContext, error) {
+	if !m.IsAPReq() {
+		return nil, errors.New("KRB5 token does not contain an AP_REQ")
+	}
+	keys := m.contextKeys()
+	if len(keys.SessionKey.KeyValue) == 0 {
+		return nil, errors.New("KRB5 token has not been verified")
+	}
+	initiator := len(m.sessionKey.KeyValue) > 0
+	flags := m.flags
+	if !initiator {
+		if c := m.APReq.Authenticator.Cksum; c.CksumType == chksumtype.GSSAPI && len(c.Checksum) >= 24 {
+			flags = int(binary.LittleEndian.Uint32(c.Checksum[20:24]))
+		}
+	}
+	sendSeq := uint64(uint32(m.APReq.Authenticator.SeqNumber))
+	recvSeq := sendSeq
+	if m.apRep != nil {
+		recvSeq = uint64(uint32(m.apRep.SequenceNumber))
+	}
+	if !initiator {
+		sendSeq, recvSeq = recvSeq, sendSeq
+	}
+	sc := gssapi.NewSecurityContext(initiator, flags, keys, sendSeq, recvSeq)
+	if !initiator {
+		sc.SetEndTime(m.APReq.Ticket.DecryptedEncPart.EndTime)
+	}
+	return sc, nil
+}
+
+// Context returns the KRB5 token's context which will contain any verify user identity information and any
+// credentials the user delegated.
 func (m *KRB5Token) Context() context.Context {
 	return m.context
 }
 
 // NewKRB5TokenAPREQ creates a new KRB5 token with AP_REQ
 func NewKRB5TokenAPREQ(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey, GSSAPIFlags []int, APOptions []int) (KRB5Token, error) {
+	return newKRB5TokenAPREQ(cl, tkt, sessionKey, GSSAPIFlags, APOptions, nil)
+}
+
+// NewKRB5TokenAPREQWithBindings creates a new KRB5 token with AP_REQ whose authenticator checksum carries the hash of
+// the channel bindings provided (RFC 4121 section 4.1.1.2).
+func NewKRB5TokenAPREQWithBindings(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey, GSSAPIFlags []int, APOptions []int, cb gssapi.ChannelBindings) (KRB5Token, error) {
+	return newKRB5TokenAPREQ(cl, tkt, sessionKey, GSSAPIFlags, APOptions, &cb)
+}
+
+func newKRB5TokenAPREQ(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey, GSSAPIFlags []int, APOptions []int, cb *gssapi.ChannelBindings) (KRB5Token, error) {
 	// TODO consider providing the SPN rather than the specific tkt and key and get these from the krb client.
 	var m KRB5Token
 	m.OID = gssapi.OIDKRB5.OID()
 	tb, _ := hex.DecodeString(TOK_ID_KRB_AP_REQ)
 	m.tokID = tb
 
-	auth, err := krb5TokenAuthenticator(cl.Credentials, GSSAPIFlags)
+	auth, err := krb5TokenAuthenticator(cl.Creds(), GSSAPIFlags)
 	if err != nil {
 		return m, err
 	}
+	for _, f := range GSSAPIFlags {
+		if f == gssapi.ContextFlagDeleg {
+			err = delegateCredentials(cl, &auth, sessionKey, GSSAPIFlags)
+			if err != nil {
+				return m, err
+			}
+			break
+		}
+	}
+	if cb != nil {
+		copy(auth.Cksum.Checksum[4:20], cb.Hash())
+	}
 	APReq, err := messages.NewAPReq(
 		tkt,
 		sessionKey,
@@ -183,10 +306,113 @@ func NewKRB5TokenAPREQ(cl *client.Client, tkt messages.Ticket, sessionKey types.
 	for _, o := range APOptions {
 		types.SetFlag(&APReq.APOptions, o)
 	}
+	// The initiator keeps its authenticator for the keys and sequence number of the security context
+	APReq.Authenticator = auth
 	m.APReq = APReq
+	m.sessionKey = sessionKey
+	for _, f := range GSSAPIFlags {
+		m.flags |= f
+	}
 	return m, nil
 }
 
+// NewKRB5TokenAPREP creates a new KRB5 token with the AP_REP mutually authenticating the acceptor to the initiator of
+// the verified KRB5 token with AP_REQ provided. The AP_REP asserts a new acceptor subkey and sequence number, which
+// the security context of the AP_REQ token then uses.
+func NewKRB5TokenAPREP(req *KRB5Token) (KRB5Token, error) {
+	var m KRB5Token
+	if !req.IsAPReq() {
+		return m, errors.New("KRB5 token does not contain an AP_REQ")
+	}
+	key := req.APReq.Ticket.DecryptedEncPart.Key
+	if len(key.KeyValue) == 0 {
+		return m, errors.New("KRB5 token has not been verified")
+	}
+	m.OID = gssapi.OIDKRB5.OID()
+	m.tokID, _ = hex.DecodeString(TOK_ID_KRB_AP_REP)
+
+	// The acceptor subkey is of the type of the key the initiator protects its tokens with
+	base := key
+	if len(req.APReq.Authenticator.SubKey.KeyValue) > 0 {
+		base = req.APReq.Authenticator.SubKey
+	}
+	subkey := types.EncryptionKey{KeyType: base.KeyType, KeyValue: make([]byte, len(base.KeyValue))}
+	if _, err := rand.Read(subkey.KeyValue); err != nil {
+		return m, krberror.Errorf(err, krberror.KRBMsgError, "error generating acceptor subkey")
+	}
+	seq, err := rand.Int(rand.Reader, big.NewInt(math.MaxUint32))
+	if err != nil {
+		return m, krberror.Errorf(err, krberror.KRBMsgError, "error generating acceptor sequence number")
+	}
+	rep, err := messages.NewAPRep(req.APReq.Authenticator, key, subkey, seq.Int64())
+	if err != nil {
+		return m, err
+	}
+	m.APRep = rep
+	req.apRep = &messages.EncAPRepPart{
+		CTime:          req.APReq.Authenticator.CTime,
+		Cusec:          req.APReq.Authenticator.Cusec,
+		Subkey:         subkey,
+		SequenceNumber: seq.Int64(),
+	}
+	return m, nil
+}
+
+// NewKRB5TokenKRBError creates a new KRB5 token with the KRB_ERROR informing the initiator that its AP_REQ failed.
+func NewKRB5TokenKRBError(e messages.KRBError) KRB5Token {
+	var m KRB5Token
+	m.OID = gssapi.OIDKRB5.OID()
+	m.tokID, _ = hex.DecodeString(TOK_ID_KRB_ERROR)
+	m.KRBError = e
+	return m
+}
+
+// VerifyAPRep verifies the KRB5 token with AP_REP received from the acceptor in reply to the token's AP_REQ, mutually
+// authenticating the acceptor. The security context of the token then uses the acceptor subkey and sequence number
+// of the AP_REP.
+func (m *KRB5Token) VerifyAPRep(rep KRB5Token) error {
+	if !m.IsAPReq() || len(m.sessionKey.KeyValue) == 0 {
+		return errors.New("KRB5 token is not an AP_REQ created by the initiator")
+	}
+	if !rep.IsAPRep() {
+		return errors.New("KRB5 token does not contain an AP_REP")
+	}
+	enc, err := rep.APRep.DecryptEncPart(m.sessionKey)
+	if err != nil {
+		return err
+	}
+	auth := m.APReq.Authenticator
+	if enc.CTime.Unix() != auth.CTime.Unix() || enc.Cusec != auth.Cusec {
+		return krberror.NewErrorf(krberror.KRBMsgError, "AP_REP time does not match the authenticator of the AP_REQ")
+	}
+	if enc.Subkey.KeyType != 0 || len(enc.Subkey.KeyValue) > 0 {
+		et, err := crypto.GetEtype(enc.Subkey.KeyType)
+		if err != nil {
+			return krberror.Errorf(err, krberror.KRBMsgError, "AP_REP acceptor subkey not supported")
+		}
+		if len(enc.Subkey.KeyValue) < et.GetKeyByteSize() {
+			return krberror.NewErrorf(krberror.KRBMsgError, "AP_REP acceptor subkey too short for its encryption type")
+		}
+	}
+	m.apRep = &enc
+	return nil
+}
+
+// MutualAuthComplete indicates if the security context of the token's AP_REQ is mutually authenticated: the initiator
+// has verified the acceptor's AP_REP with VerifyAPRep, or the acceptor has created it with NewKRB5TokenAPREP.
+func (m *KRB5Token) MutualAuthComplete() bool {
+	return m.apRep != nil
+}
+
+// AcceptorSubkey returns the subkey asserted by the acceptor in the AP_REP of a mutually authenticated context, or
+// the zero EncryptionKey if there is none.
+func (m *KRB5Token) AcceptorSubkey() types.EncryptionKey {
+	if m.apRep == nil {
+		return types.EncryptionKey{}
+	}
+	return m.apRep.Subkey
+}
+
 // krb5TokenAuthenticator creates a new kerberos authenticator for kerberos MechToken
 func krb5TokenAuthenticator(creds *credentials.Credentials, flags []int) (types.Authenticator, error) {
 	//RFC 4121 Section 4.1.1
@@ -194,21 +420,57 @@ func krb5TokenAuthenticator(creds *credentials.Credentials, flags []int) (types.
 	if err != nil {
 		return auth, krberror.Errorf(err, krberror.KRBMsgError, "error generating new authenticator")
 	}
+	if d := creds.KDCOffset(); d != 0 {
+		auth.SetTime(auth.CTime.Add(d))
+	}
 	auth.Cksum = types.Checksum{
 		CksumType: chksumtype.GSSAPI,
-		Checksum:  newAuthenticatorChksum(flags),
+		Checksum:  newAuthenticatorChksum(flags, nil),
 	}
 	return auth, nil
 }
 
-// Create new authenticator checksum for kerberos MechToken
-func newAuthenticatorChksum(flags []int) []byte {
+// delegateCredentials adds a forwarded TGT of the client to the authenticator's checksum, in a KRB_CRED encrypted
+// with a new subkey of the authenticator (RFC 4121 section 4.1.1.1).
+func delegateCredentials(cl *client.Client, auth *types.Authenticator, sessionKey types.EncryptionKey, flags []int) error {
+	tkt, dep, err := cl.GetForwardedTGT()
+	if err != nil {
+		return krberror.Errorf(err, krberror.KRBMsgError, "error getting forwarded TGT to delegate")
+	}
+	et, err := crypto.GetEtype(sessionKey.KeyType)
+	if err != nil {
+		return krberror.Errorf(err, krberror.EncryptingError, "error getting etype of session key")
+	}
+	err = auth.GenerateSeqNumberAndSubKey(sessionKey.KeyType, et.GetKeyByteSize())
+	if err != nil {
+		return krberror.Errorf(err, krberror.KRBMsgError, "error generating authenticator subkey")
+	}
+	c := cl.Creds()
+	info := messages.NewKrbCredInfo(c.Domain(), c.CName(), dep)
+	cred, err := messages.NewKRBCred([]messages.Ticket{tkt}, []messages.KrbCredInfo{info}, auth.SubKey)
+	if err != nil {
+		return err
+	}
+	b, err := cred.Marshal()
+	if err != nil {
+		return err
+	}
+	auth.Cksum.Checksum = newAuthenticatorChksum(flags, b)
+	return nil
+}
+
+// Create new authenticator checksum for kerberos MechToken. The KRB_CRED of delegated credentials is included if the
+// delegation flag is set.
+func newAuthenticatorChksum(flags []int, deleg []byte) []byte {
 	a := make([]byte, 24)
 	binary.LittleEndian.PutUint32(a[:4], 16)
 	for _, i := range flags {
 		if i == gssapi.ContextFlagDeleg {
-			x := make([]byte, 28-len(a))
+			x := make([]byte, 4)
+			binary.LittleEndian.PutUint16(x[:2], 1)
+			binary.LittleEndian.PutUint16(x[2:], uint16(len(deleg)))
 			a = append(a, x...)
+			a = append(a, deleg...)
 		}
 		f := binary.LittleEndian.Uint32(a[20:24])
 		f |= uint32(i)
@@ -216,3 +478,19 @@ func newAuthenticatorChksum(flags []int) []byte {
 	}
 	return a
 }
+
+// verifyChannelBindings checks the Bnd field of the GSS-API authenticator checksum against the hash of the acceptor's
+// channel bindings. A checksum without channel bindings, all zeros, is accepted.
+func verifyChannelBindings(c types.Checksum, cb gssapi.ChannelBindings) error {
+	if c.CksumType != chksumtype.GSSAPI || len(c.Checksum) < 20 {
+		return errors.New("authenticator checksum is not a GSS-API checksum")
+	}
+	bnd := c.Checksum[4:20]
+	if bytes.Equal(bnd, make([]byte, 16)) {
+		return nil
+	}
+	if subtle.ConstantTimeCompare(bnd, cb.Hash()) != 1 {
+		return errors.New("channel bindings of the authenticator do not match those of the acceptor")
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package spnego
 
 import (
+	"encoding/binary"
 	"encoding/hex"
 	"math"
 	"testing"
@@ -46,10 +47,21 @@ func TestKRB5Token_newAuthenticatorChksum(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error decoding KRB5Token hex: %v", err)
 	}
-	cb := newAuthenticatorChksum([]int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf})
+	cb := newAuthenticatorChksum([]int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}, nil)
 	assert.Equal(t, b, cb, "SPNEGO Authenticator checksum not as expected")
 }
 
+func TestKRB5Token_newAuthenticatorChksumDelegation(t *testing.T) {
+	t.Parallel()
+	deleg := []byte("KRB_CRED")
+	cb := newAuthenticatorChksum([]int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf, gssapi.ContextFlagDeleg}, deleg)
+	assert.Equal(t, 28+len(deleg), len(cb), "checksum length not as expected")
+	assert.Equal(t, uint32(gssapi.ContextFlagInteg|gssapi.ContextFlagConf|gssapi.ContextFlagDeleg), binary.LittleEndian.Uint32(cb[20:24]), "flags not as expected")
+	assert.Equal(t, uint16(1), binary.LittleEndian.Uint16(cb[24:26]), "DlgOpt not as expected")
+	assert.Equal(t, uint16(len(deleg)), binary.LittleEndian.Uint16(cb[26:28]), "Dlgth not as expected")
+	assert.Equal(t, deleg, cb[28:], "delegated credentials not as expected")
+}
+
 // Test with explicit subkey generation.
 func TestKRB5Token_newAuthenticatorWithSubkeyGeneration(t *testing.T) {
 	t.Parallel()
@@ -144,3 +156,112 @@ func TestNewAPREQKRB5Token_and_Marshal(t *testing.T) {
 	assert.Equal(t, testdata.TEST_PRINCIPALNAME_NAMESTRING, mt.APReq.Ticket.SName.NameString, "SName in ticket within the AP_REQ of the KRB5Token not as expected.")
 	assert.Equal(t, int32(18), mt.APReq.EncryptedAuthenticator.EType, "Authenticator within AP_REQ does not have the etype expected.")
 }
+
+// newTestKRB5TokenPair returns an initiator's KRB5Token and the token as the acceptor has it once verified.
+func newTestKRB5TokenPair(t *testing.T) (KRB5Token, KRB5Token, types.EncryptionKey) {
+	t.Helper()
+	creds := credentials.New("hftsai", testdata.TEST_REALM)
+	creds.SetCName(types.PrincipalName{NameType: nametype.KRB_NT_PRINCIPAL, NameString: testdata.TEST_PRINCIPALNAME_NAMESTRING})
+	cl := client.Client{
+		Credentials: creds,
+	}
+	var tkt messages.Ticket
+	b, err := hex.DecodeString(testdata.MarshaledKRB5ticket)
+	if err != nil {
+		t.Fatalf("Test vector read error: %v", err)
+	}
+	err = tkt.Unmarshal(b)
+	if err != nil {
+		t.Fatalf("Unmarshal error: %v", err)
+	}
+	key := types.EncryptionKey{
+		KeyType:  18,
+		KeyValue: make([]byte, 32),
+	}
+	mt, err := NewKRB5TokenAPREQ(&cl, tkt, key, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}, []int{})
+	if err != nil {
+		t.Fatalf("Error creating KRB5Token: %v", err)
+	}
+	mb, err := mt.Marshal()
+	if err != nil {
+		t.Fatalf("Error marshalling KRB5Token: %v", err)
+	}
+	var at KRB5Token
+	err = at.Unmarshal(mb)
+	if err != nil {
+		t.Fatalf("Error unmarshalling KRB5Token: %v", err)
+	}
+	// Stand in for verification by the acceptor, which decrypts the ticket and authenticator
+	at.APReq.Ticket.DecryptedEncPart.Key = key
+	err = at.APReq.DecryptAuthenticator(key)
+	if err != nil {
+		t.Fatalf("Error decrypting authenticator: %v", err)
+	}
+	return mt, at, key
+}
+
+func TestKRB5Token_PseudoRandom(t *testing.T) {
+	t.Parallel()
+	mt, at, key := newTestKRB5TokenPair(t)
+	ib, err := mt.PseudoRandom(gssapi.PRFKeyFull, []byte("input"), 64)
+	if err != nil {
+		t.Fatalf("Error generating initiator pseudo-random output: %v", err)
+	}
+	want, _ := gssapi.PseudoRandom(key, []byte("input"), 64)
+	assert.Equal(t, want, ib, "initiator output should be derived from the session key")
+
+	// The acceptor derives the same output from the keys of the AP_REQ it has verified
+	ab, err := at.PseudoRandom(gssapi.PRFKeyFull, []byte("input"), 64)
+	if err != nil {
+		t.Fatalf("Error generating acceptor pseudo-random output: %v", err)
+	}
+	assert.Equal(t, ib, ab, "initiator and acceptor output differ")
+}
+
+func TestKRB5Token_SecurityContext(t *testing.T) {
+	t.Parallel()
+	mt, at, _ := newTestKRB5TokenPair(t)
+	ini, err := mt.SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting initiator security context: %v", err)
+	}
+	acc, err := at.SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting acceptor security context: %v", err)
+	}
+	assert.True(t, ini.Initiator(), "initiator context not marked as such")
+	assert.False(t, acc.Initiator(), "acceptor context marked as initiator")
+	assert.Equal(t, gssapi.ContextFlagInteg|gssapi.ContextFlagConf, acc.Flags(), "acceptor context flags not as expected")
+
+	b, err := ini.Wrap([]byte("hello acceptor"), true)
+	if err != nil {
+		t.Fatalf("Error wrapping message: %v", err)
+	}
+	m, conf, err := acc.Unwrap(b)
+	if err != nil {
+		t.Fatalf("Error unwrapping message: %v", err)
+	}
+	assert.True(t, conf, "message should have been encrypted")
+	assert.Equal(t, []byte("hello acceptor"), m, "unwrapped message not as expected")
+}
+
+func TestMechListMIC(t *testing.T) {
+	t.Parallel()
+	mt, at, _ := newTestKRB5TokenPair(t)
+	ini, err := mt.SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting initiator security context: %v", err)
+	}
+	acc, err := at.SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting acceptor security context: %v", err)
+	}
+	mechTypes := []asn1.ObjectIdentifier{gssapi.OIDMSLegacyKRB5.OID(), gssapi.OIDKRB5.OID()}
+	mic, err := MechListMIC(acc, mechTypes)
+	if err != nil {
+		t.Fatalf("Error getting mechListMIC: %v", err)
+	}
+	assert.NoError(t, VerifyMechListMIC(ini, mechTypes, mic), "mechListMIC not verified")
+	// A mechanism list altered in transit, such as to downgrade the mechanism, is detected
+	assert.Error(t, VerifyMechListMIC(ini, mechTypes[1:], mic), "mechListMIC verified for a different mechanism list")
+}
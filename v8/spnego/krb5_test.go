@@ -0,0 +1,171 @@
+package spnego
+
+import (
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/client"
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/gssapi"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestKRB5Initiator returns a KRB5 mechanism initiator, with the AP_REQ token of its first step, and a KRB5
+// mechanism configured for the service.
+func newTestKRB5Initiator(t *testing.T) (*krb5Initiator, []byte, *KRB5) {
+	t.Helper()
+	cl, tkt, key, kt := newTestTicket(t)
+	i := &krb5Initiator{mech: KRB5Client(cl, "HTTP/host.test.gokrb5")}
+	b, cont, err := i.apReqToken(tkt, key)
+	if err != nil {
+		t.Fatalf("Error creating AP_REQ token: %v", err)
+	}
+	assert.True(t, cont, "initiator should expect an AP_REP token")
+	return i, b, KRB5Service(kt)
+}
+
+func TestKRB5_EstablishSecurityContext(t *testing.T) {
+	t.Parallel()
+	i, b, k := newTestKRB5Initiator(t)
+	// The token is the raw KRB5 mechanism token rather than a NegTokenInit
+	var mt KRB5Token
+	if err := mt.Unmarshal(b); err != nil {
+		t.Fatalf("Error unmarshalling AP_REQ token: %v", err)
+	}
+	assert.True(t, mt.IsAPReq(), "token should contain an AP_REQ")
+	assert.True(t, types.IsFlagSet(&mt.APReq.APOptions, flags.APOptionMutualRequired), "AP_REQ should require mutual authentication")
+
+	a, err := k.NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	rb, cont, err := a.Step(b)
+	if err != nil {
+		t.Fatalf("Error accepting AP_REQ token: %v", err)
+	}
+	assert.False(t, cont, "acceptor should complete on the AP_REQ token")
+	var rt KRB5Token
+	if err := rt.Unmarshal(rb); err != nil {
+		t.Fatalf("Error unmarshalling AP_REP token: %v", err)
+	}
+	assert.True(t, rt.IsAPRep(), "acceptor token should contain an AP_REP")
+	id, ok := a.Context().Value(ctxCredentials).(*credentials.Credentials)
+	if assert.True(t, ok, "acceptor context should contain the initiator's credentials") {
+		assert.Equal(t, "testuser1", id.UserName(), "initiator identity not as expected")
+	}
+
+	ob, cont, err := i.Step(rb)
+	if err != nil {
+		t.Fatalf("Error verifying AP_REP token: %v", err)
+	}
+	assert.False(t, cont, "initiator should complete on the AP_REP token")
+	assert.Nil(t, ob, "initiator should not send a further token")
+
+	isc, err := i.SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting initiator security context: %v", err)
+	}
+	asc, err := a.SecurityContext()
+	if err != nil {
+		t.Fatalf("Error getting acceptor security context: %v", err)
+	}
+	assert.NotEmpty(t, isc.Keys().AcceptorSubkey.KeyValue, "initiator context should have the acceptor subkey")
+	assert.Equal(t, isc.Keys(), asc.Keys(), "context keys differ")
+	for _, c := range [][2]*gssapi.SecurityContext{{isc, asc}, {asc, isc}} {
+		wb, err := c[0].Wrap([]byte("message"), true)
+		if err != nil {
+			t.Fatalf("Error wrapping message: %v", err)
+		}
+		msg, _, err := c[1].Unwrap(wb)
+		if err != nil {
+			t.Fatalf("Error unwrapping message: %v", err)
+		}
+		assert.Equal(t, []byte("message"), msg, "unwrapped message not as expected")
+	}
+}
+
+func TestKRB5_EstablishSecurityContext_Failure(t *testing.T) {
+	t.Parallel()
+	i, b, k := newTestKRB5Initiator(t)
+	a, err := k.NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	// The acceptor replies to an AP_REQ it cannot verify with a KRB_ERROR
+	na, err := KRB5Service(keytab.New()).NewAcceptor()
+	if err != nil {
+		t.Fatalf("Error getting acceptor: %v", err)
+	}
+	rb, _, err := na.Step(b)
+	assert.Error(t, err, "acceptor without the service key should fail")
+	var et KRB5Token
+	if err := et.Unmarshal(rb); err != nil {
+		t.Fatalf("Error unmarshalling KRB_ERROR token: %v", err)
+	}
+	assert.True(t, et.IsKRBError(), "acceptor token should contain a KRB_ERROR")
+	_, _, err = (&krb5Initiator{mech: i.mech, token: i.token}).Step(rb)
+	assert.Error(t, err, "initiator should fail on the KRB_ERROR")
+
+	// An AP_REP not encrypted with the session key fails mutual authentication
+	rb, _, err = a.Step(b)
+	if err != nil {
+		t.Fatalf("Error accepting AP_REQ token: %v", err)
+	}
+	rb[len(rb)-1] ^= 0xff
+	_, _, err = i.Step(rb)
+	assert.Error(t, err, "initiator should fail on a tampered AP_REP")
+	_, err = i.SecurityContext()
+	assert.Error(t, err, "initiator context should not be established")
+}
+
+func TestKRB5_NewEstablisher(t *testing.T) {
+	t.Parallel()
+	_, err := KRB5Service(keytab.New()).NewInitiator()
+	assert.Error(t, err, "service side KRB5 mechanism should not initiate")
+	_, err = KRB5Client(&client.Client{}, "HTTP/host.test.gokrb5").NewAcceptor()
+	assert.Error(t, err, "client side KRB5 mechanism should not accept")
+	var _ gssapi.Mechanism = &KRB5{}
+}
+
+func TestKRB5_ChannelBindings(t *testing.T) {
+	t.Parallel()
+	cb := gssapi.ChannelBindings{ApplicationData: []byte("tls-server-end-point:bindings")}
+	other := gssapi.ChannelBindings{ApplicationData: []byte("tls-server-end-point:other")}
+	var tests = []struct {
+		initiator, acceptor *gssapi.ChannelBindings
+		ok                  bool
+	}{
+		{&cb, &cb, true},
+		{&cb, &other, false},
+		{nil, &cb, true},
+		{&cb, nil, true},
+	}
+	for i, test := range tests {
+		cl, tkt, key, kt := newTestTicket(t)
+		ci := KRB5Client(cl, "HTTP/host.test.gokrb5")
+		if test.initiator != nil {
+			ci.SetChannelBindings(*test.initiator)
+		}
+		ini := &krb5Initiator{mech: ci}
+		b, _, err := ini.apReqToken(tkt, key)
+		if err != nil {
+			t.Fatalf("Error creating AP_REQ token: %v", err)
+		}
+		s := KRB5Service(kt)
+		if test.acceptor != nil {
+			s.SetChannelBindings(*test.acceptor)
+		}
+		a, err := s.NewAcceptor()
+		if err != nil {
+			t.Fatalf("Error getting acceptor: %v", err)
+		}
+		_, _, err = a.Step(b)
+		if test.ok {
+			assert.NoError(t, err, "test %d: AP_REQ token should be accepted", i)
+		} else if assert.Error(t, err, "test %d: AP_REQ token should be rejected", i) {
+			assert.Equal(t, gssapi.StatusBadBindings, err.(gssapi.Status).Code, "test %d: status code not as expected", i)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package spnego
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Osirium/gokrb5/v8/credentials"
+	"github.com/Osirium/gokrb5/v8/gssapi"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/service"
+	"github.com/Osirium/gokrb5/v8/trace"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/goidentity/v6"
+)
+
+// Identity is the identity of a user authenticated with SPNEGO, carrying the authorization data from the PAC of the
+// user's ticket.
+type Identity = service.Identity
+
+// IdentityFromContext returns the Identity of the user the Middleware authenticated the request of.
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(ctxIdentity).(Identity)
+	return id, ok
+}
+
+// Middleware returns an HTTP handler authenticating requests with SPNEGO before serving them with the next handler.
+// A request without a Negotiate authorization header is responded to with a 401 Unauthorized challenge, and one with
+// a token that is not valid, such as a replay of a token already accepted, is rejected. The Identity of the
+// authenticated user is added to the request's context, available from IdentityFromContext, as are the user's
+// credentials as a goidentity.Identity.
+// To use a keytab that is reloaded when it changes pass a nil keytab and configure a keytab.Reloader with the
+// service.KeytabProvider setting.
+func Middleware(next http.Handler, kt *keytab.Keytab, settings ...func(*service.Settings)) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Set up the SPNEGO GSS-API mechanism
+		var spnego *SPNEGO
+		h, err := types.GetHostAddress(r.RemoteAddr)
+		if err == nil {
+			// put in this order so that if the user provides a ClientAddress it will override the one here.
+			o := append([]func(*service.Settings){service.ClientAddress(h)}, settings...)
+			spnego = SPNEGOService(kt, o...)
+		} else {
+			spnego = SPNEGOService(kt, settings...)
+			spnego.Log("%s - SPNEGO could not parse client address: %v", r.RemoteAddr, err)
+		}
+
+		// Check if there is a session manager and an established session for this client, lasting no longer than its ticket
+		id, err := getSessionCredentials(spnego, r)
+		if err == nil && id.Authenticated() && !id.Expired() {
+			// There is an established session so bypass auth and serve
+			spnego.Log("%s - SPNEGO request served under session %s", r.RemoteAddr, id.SessionID())
+			next.ServeHTTP(w, withIdentity(r, &id, service.NewIdentity(&id, types.EncryptionKey{})))
+			return
+		}
+
+		st, err := getAuthorizationNegotiationHeaderAsSPNEGOToken(spnego, r, w)
+		if st == nil || err != nil {
+			// response to client and logging handled in function above so just return
+			return
+		}
+
+		// Validate the context token
+		_, span := trace.StartSpan(r.Context(), spnego.serviceSettings.Spans(), trace.SpanSPNEGOAccept, trace.Attr(trace.AttrService, spnego.serviceSettings.SName()))
+		authed, ctx, status := spnego.AcceptSecContext(st)
+		if !authed && status.Code != gssapi.StatusContinueNeeded {
+			trace.EndSpan(span, status)
+		} else {
+			trace.EndSpan(span, nil)
+		}
+		if status.Code != gssapi.StatusComplete && status.Code != gssapi.StatusContinueNeeded {
+			spnegoResponseReject(spnego, w, "%s - SPNEGO validation error: %v", r.RemoteAddr, status)
+			return
+		}
+		if status.Code == gssapi.StatusContinueNeeded {
+			spnegoNegotiateKRB5MechType(spnego, w, "%s - SPNEGO GSS-API continue needed", r.RemoteAddr)
+			return
+		}
+
+		if authed {
+			// Authentication successful; get user's credentials from the context
+			id := ctx.Value(ctxCredentials).(*credentials.Credentials)
+			hdr, err := acceptCompletedHeader(st)
+			if err != nil {
+				spnegoInternalServerError(spnego, w, "%s - SPNEGO could not create NegTokenResp: %v", r.RemoteAddr, err)
+				return
+			}
+			// Create a new session if a session manager has been configured
+			err = newSession(spnego, r, w, id)
+			if err != nil {
+				return
+			}
+			spnegoResponseAcceptCompleted(spnego, w, hdr, "%s %s@%s - SPNEGO authentication succeeded", r.RemoteAddr, id.UserName(), id.Domain())
+			// Add the identity and any delegated credentials to the context and serve the next handler
+			r = withIdentity(r, id, ctx.Value(ctxIdentity).(Identity))
+			if cred, ok := ctx.Value(ctxDelegatedCredentials).(messages.KRBCred); ok {
+				r = r.WithContext(context.WithValue(r.Context(), ctxDelegatedCredentials, cred))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		// If we get to here we have not authenticationed so just reject
+		spnegoResponseReject(spnego, w, "%s - SPNEGO Kerberos authentication failed", r.RemoteAddr)
+	})
+}
+
+// withIdentity returns the request with the authenticated user's Identity added to its context, and their credentials
+// as a goidentity.Identity.
+func withIdentity(r *http.Request, creds *credentials.Credentials, id Identity) *http.Request {
+	r = goidentity.AddToHTTPRequestContext(creds, r)
+	return r.WithContext(context.WithValue(r.Context(), ctxIdentity, id))
+}
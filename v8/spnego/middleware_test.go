@@ -0,0 +1,65 @@
+package spnego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/types"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// identityHandler responds with the identity the middleware added to the request's context.
+func identityHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := IdentityFromContext(r.Context())
+	if !ok {
+		http.Error(w, "no identity", http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte(id.Principal().PrincipalNameString() + "@" + id.Realm()))
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+	cl, kt := newTestTicketClient(t)
+	h := Middleware(http.HandlerFunc(identityHandler), kt)
+
+	// A request without a Negotiate authorization header is challenged
+	r := httptest.NewRequest("GET", "http://host.test.gokrb5/", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "status code not as expected")
+	assert.Equal(t, HTTPHeaderAuthResponseValueKey, w.Header().Get(HTTPHeaderAuthResponse), "challenge not as expected")
+
+	r = httptest.NewRequest("GET", "http://host.test.gokrb5/", nil)
+	if err := SetSPNEGOHeader(cl, r, "HTTP/host.test.gokrb5"); err != nil {
+		t.Fatalf("Error setting SPNEGO header: %v", err)
+	}
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, "status code not as expected")
+	assert.Equal(t, "testuser1@TEST.GOKRB5", w.Body.String(), "identity not as expected")
+
+	// The identity carries the key of the session established
+	var key types.EncryptionKey
+	kh := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, _ := IdentityFromContext(r.Context())
+		key = id.SessionKey()
+	}), kt)
+	r2 := httptest.NewRequest("GET", "http://host.test.gokrb5/", nil)
+	if err := SetSPNEGOHeader(cl, r2, "HTTP/host.test.gokrb5"); err != nil {
+		t.Fatalf("Error setting SPNEGO header: %v", err)
+	}
+	kh.ServeHTTP(httptest.NewRecorder(), r2)
+	assert.NotZero(t, key.KeyType, "session key not set")
+	assert.NotEmpty(t, key.KeyValue, "session key not set")
+
+	// A replay of the token is rejected
+	rr := httptest.NewRequest("GET", "http://host.test.gokrb5/", nil)
+	rr.Header.Set(HTTPHeaderAuthRequest, r.Header.Get(HTTPHeaderAuthRequest))
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, rr)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "replay not rejected")
+	assert.Equal(t, spnegoNegTokenRespReject, w.Header().Get(HTTPHeaderAuthResponse), "rejection not as expected")
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/Osirium/gokrb5/v8/client"
 	"github.com/Osirium/gokrb5/v8/gssapi"
+	"github.com/Osirium/gokrb5/v8/iana/flags"
 	"github.com/Osirium/gokrb5/v8/messages"
 	"github.com/Osirium/gokrb5/v8/service"
 	"github.com/Osirium/gokrb5/v8/types"
@@ -287,7 +288,21 @@ func UnmarshalNegToken(b []byte) (bool, interface{}, error) {
 
 // NewNegTokenInitKRB5 creates new Init negotiation token for Kerberos 5
 func NewNegTokenInitKRB5(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey) (NegTokenInit, error) {
-	mt, err := NewKRB5TokenAPREQ(cl, tkt, sessionKey, []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}, []int{})
+	return newNegTokenInitKRB5(cl, tkt, sessionKey, nil)
+}
+
+// newNegTokenInitKRB5 creates new Init negotiation token for Kerberos 5, carrying the hash of any channel bindings.
+func newNegTokenInitKRB5(cl *client.Client, tkt messages.Ticket, sessionKey types.EncryptionKey, cb *gssapi.ChannelBindings) (NegTokenInit, error) {
+	gssFlags := []int{gssapi.ContextFlagInteg, gssapi.ContextFlagConf}
+	if cl.DelegateCredentials() {
+		gssFlags = append(gssFlags, gssapi.ContextFlagDeleg)
+	}
+	apOptions := []int{}
+	if cl.MutualAuthentication() {
+		gssFlags = append(gssFlags, gssapi.ContextFlagMutual)
+		apOptions = append(apOptions, flags.APOptionMutualRequired)
+	}
+	mt, err := newKRB5TokenAPREQ(cl, tkt, sessionKey, gssFlags, apOptions, cb)
 	if err != nil {
 		return NegTokenInit{}, fmt.Errorf("error getting KRB5 token; %v", err)
 	}
@@ -298,5 +313,29 @@ func NewNegTokenInitKRB5(cl *client.Client, tkt messages.Ticket, sessionKey type
 	return NegTokenInit{
 		MechTypes:      []asn1.ObjectIdentifier{gssapi.OIDKRB5.OID()},
 		MechTokenBytes: mtb,
+		mechToken:      &mt,
 	}, nil
 }
+
+// MechListMIC returns the mechListMIC of RFC 4178 section 5 for the mechanism types of the initial negotiation token,
+// a MIC token of the security context protecting the DER encoding of the mechanism type list.
+func MechListMIC(sc MICProvider, mechTypes []asn1.ObjectIdentifier) ([]byte, error) {
+	b, err := asn1.Marshal(mechTypes)
+	if err != nil {
+		return nil, fmt.Errorf("error marshalling mechanism type list: %v", err)
+	}
+	return sc.GetMIC(b)
+}
+
+// VerifyMechListMIC verifies the mechListMIC received from the peer against the mechanism types of the initial
+// negotiation token, detecting a downgrade of the negotiated mechanism.
+func VerifyMechListMIC(sc MICProvider, mechTypes []asn1.ObjectIdentifier, mic []byte) error {
+	b, err := asn1.Marshal(mechTypes)
+	if err != nil {
+		return fmt.Errorf("error marshalling mechanism type list: %v", err)
+	}
+	if err := sc.VerifyMIC(b, mic); err != nil {
+		return fmt.Errorf("mechListMIC not valid: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package spnego
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultSessionCookieName is the name of the cookie holding the session ID by default.
+	defaultSessionCookieName = "gokrb5_session"
+	// defaultSessionMaxAge is the time sessions last by default.
+	defaultSessionMaxAge = time.Hour
+	// sessionIDLength is the number of random bytes of a session ID.
+	sessionIDLength = 32
+)
+
+// SessionStore stores the data of sessions, such as in Redis or in memory, so that the identity of a client
+// authenticated with SPNEGO can be kept between requests.
+type SessionStore interface {
+	// Set stores the value under the key, to expire at the time provided.
+	Set(key string, value []byte, expiry time.Time) error
+	// Get returns the value stored under the key, nil if there is none or it has expired.
+	Get(key string) ([]byte, error)
+}
+
+// SessionManager is a service.SessionMgr keeping the identity of clients authenticated by the Middleware in a
+// SessionStore, under a random session ID set in a cookie, so that subsequent requests are served without the
+// expense of negotiating authentication again. Pass it to the Middleware with the service.SessionManager setting:
+//
+//	h := spnego.Middleware(next, kt, service.SessionManager(spnego.NewSessionManager(store)))
+type SessionManager struct {
+	store    SessionStore
+	settings *SessionSettings
+}
+
+// SessionSettings holds the settings of a SessionManager.
+type SessionSettings struct {
+	cookieName string
+	maxAge     time.Duration
+	secure     bool
+}
+
+// NewSessionManager returns a SessionManager keeping sessions in the store, with the settings provided.
+func NewSessionManager(store SessionStore, settings ...func(*SessionSettings)) *SessionManager {
+	s := &SessionSettings{
+		cookieName: defaultSessionCookieName,
+		maxAge:     defaultSessionMaxAge,
+	}
+	for _, set := range settings {
+		set(s)
+	}
+	return &SessionManager{
+		store:    store,
+		settings: s,
+	}
+}
+
+// SessionCookieName sets the name of the cookie holding the session ID. By default it is gokrb5_session.
+//
+// s := NewSessionManager(store, SessionCookieName("session"))
+func SessionCookieName(n string) func(*SessionSettings) {
+	return func(s *SessionSettings) {
+		s.cookieName = n
+	}
+}
+
+// SessionMaxAge sets the time sessions last. By default sessions last an hour. A session does not outlast the ticket
+// the client authenticated with.
+//
+// s := NewSessionManager(store, SessionMaxAge(8*time.Hour))
+func SessionMaxAge(d time.Duration) func(*SessionSettings) {
+	return func(s *SessionSettings) {
+		s.maxAge = d
+	}
+}
+
+// SessionCookieSecure sets that the session cookie is only sent over HTTPS. By default the cookie is secure if the
+// request the session was created for was received over TLS.
+//
+// s := NewSessionManager(store, SessionCookieSecure(true))
+func SessionCookieSecure(b bool) func(*SessionSettings) {
+	return func(s *SessionSettings) {
+		s.secure = b
+	}
+}
+
+// CookieName returns the name of the cookie holding the session ID.
+func (s *SessionSettings) CookieName() string {
+	return s.cookieName
+}
+
+// MaxAge returns the time sessions last.
+func (s *SessionSettings) MaxAge() time.Duration {
+	return s.maxAge
+}
+
+// CookieSecure returns if the session cookie is only sent over HTTPS regardless of the request.
+func (s *SessionSettings) CookieSecure() bool {
+	return s.secure
+}
+
+// New creates a new session for the request, storing the value under the key and setting the session cookie on the
+// response.
+func (m *SessionManager) New(w http.ResponseWriter, r *http.Request, k string, v []byte) error {
+	b := make([]byte, sessionIDLength)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	id := base64.RawURLEncoding.EncodeToString(b)
+	if err := m.store.Set(sessionKey(id, k), v, time.Now().Add(m.settings.maxAge)); err != nil {
+		return err
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.settings.cookieName,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(m.settings.maxAge / time.Second),
+		Secure:   m.settings.secure || r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// Get returns the value stored under the key in the request's session.
+func (m *SessionManager) Get(r *http.Request, k string) ([]byte, error) {
+	c, err := r.Cookie(m.settings.cookieName)
+	if err != nil {
+		return nil, err
+	}
+	v, err := m.store.Get(sessionKey(c.Value, k))
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, errors.New("no session for the session ID")
+	}
+	return v, nil
+}
+
+// sessionKey returns the key in the store of the value held in the session under the key provided.
+func sessionKey(id, k string) string {
+	return id + ":" + k
+}
+
+// MemorySessionStore is a SessionStore holding sessions in memory, for services run as a single instance.
+type MemorySessionStore struct {
+	mu      sync.Mutex
+	entries map[string]memorySession
+}
+
+type memorySession struct {
+	value  []byte
+	expiry time.Time
+}
+
+// NewMemorySessionStore returns an empty MemorySessionStore.
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{
+		entries: make(map[string]memorySession),
+	}
+}
+
+// Set stores the value under the key, to expire at the time provided. Expired sessions are removed from the store.
+func (s *MemorySessionStore) Set(key string, value []byte, expiry time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	for k, e := range s.entries {
+		if !now.Before(e.expiry) {
+			delete(s.entries, k)
+		}
+	}
+	s.entries[key] = memorySession{value: value, expiry: expiry}
+	return nil
+}
+
+// Get returns the value stored under the key, nil if there is none or it has expired.
+func (s *MemorySessionStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok || !time.Now().Before(e.expiry) {
+		return nil, nil
+	}
+	return e.value, nil
+}
+
+// Len returns the number of sessions in the store, including any expired ones not yet removed.
+func (s *MemorySessionStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
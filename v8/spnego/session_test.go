@@ -0,0 +1,99 @@
+package spnego
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddleware_SessionManager(t *testing.T) {
+	t.Parallel()
+	cl, kt := newTestTicketClient(t)
+	store := NewMemorySessionStore()
+	sm := NewSessionManager(store, SessionCookieName("test_session"))
+	h := Middleware(http.HandlerFunc(identityHandler), kt, service.SessionManager(sm))
+
+	r := httptest.NewRequest("GET", "http://host.test.gokrb5/", nil)
+	if err := SetSPNEGOHeader(cl, r, "HTTP/host.test.gokrb5"); err != nil {
+		t.Fatalf("Error setting SPNEGO header: %v", err)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, "status code not as expected")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("Session cookie not set: %v", cookies)
+	}
+	c := cookies[0]
+	assert.Equal(t, "test_session", c.Name, "session cookie name not as expected")
+	assert.True(t, c.HttpOnly, "session cookie not HTTP only")
+	assert.False(t, c.Secure, "session cookie of a request without TLS secure")
+	assert.Equal(t, 1, store.Len(), "session not stored")
+
+	// A request with the session cookie is served without negotiating authentication
+	r = httptest.NewRequest("GET", "http://host.test.gokrb5/", nil)
+	r.AddCookie(c)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusOK, w.Code, "status code not as expected")
+	assert.Equal(t, "testuser1@TEST.GOKRB5", w.Body.String(), "identity not as expected")
+	assert.Empty(t, w.Header().Get(HTTPHeaderAuthResponse), "authentication negotiated for a session")
+
+	// A request with an unknown session ID is challenged
+	r = httptest.NewRequest("GET", "http://host.test.gokrb5/", nil)
+	r.AddCookie(&http.Cookie{Name: "test_session", Value: "unknown"})
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "status code not as expected")
+	assert.Equal(t, HTTPHeaderAuthResponseValueKey, w.Header().Get(HTTPHeaderAuthResponse), "challenge not as expected")
+}
+
+func TestSessionManager_Settings(t *testing.T) {
+	t.Parallel()
+	sm := NewSessionManager(NewMemorySessionStore())
+	assert.Equal(t, defaultSessionCookieName, sm.settings.CookieName(), "default cookie name not as expected")
+	assert.Equal(t, time.Hour, sm.settings.MaxAge(), "default max age not as expected")
+	assert.False(t, sm.settings.CookieSecure(), "cookie secure by default")
+
+	sm = NewSessionManager(NewMemorySessionStore(), SessionMaxAge(time.Minute), SessionCookieSecure(true))
+	w := httptest.NewRecorder()
+	if err := sm.New(w, httptest.NewRequest("GET", "http://host.test.gokrb5/", nil), "k", []byte("v")); err != nil {
+		t.Fatalf("Error creating session: %v", err)
+	}
+	c := w.Result().Cookies()[0]
+	assert.True(t, c.Secure, "session cookie not secure")
+	assert.Equal(t, 60, c.MaxAge, "session cookie max age not as expected")
+
+	r := httptest.NewRequest("GET", "http://host.test.gokrb5/", nil)
+	r.AddCookie(c)
+	v, err := sm.Get(r, "k")
+	if err != nil {
+		t.Fatalf("Error getting session value: %v", err)
+	}
+	assert.Equal(t, []byte("v"), v, "session value not as expected")
+	_, err = sm.Get(r, "other")
+	assert.Error(t, err, "value not held in the session returned")
+	_, err = sm.Get(httptest.NewRequest("GET", "http://host.test.gokrb5/", nil), "k")
+	assert.Error(t, err, "session returned for a request without a session cookie")
+}
+
+func TestMemorySessionStore(t *testing.T) {
+	t.Parallel()
+	s := NewMemorySessionStore()
+	s.Set("expired", []byte("a"), time.Now().Add(-time.Second))
+	s.Set("valid", []byte("b"), time.Now().Add(time.Hour))
+	v, err := s.Get("expired")
+	assert.NoError(t, err)
+	assert.Nil(t, v, "expired value returned")
+	v, err = s.Get("valid")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), v, "value not as expected")
+	v, _ = s.Get("missing")
+	assert.Nil(t, v, "value returned for a missing key")
+	// Expired sessions are removed when a session is set
+	assert.Equal(t, 1, s.Len(), "expired session not removed")
+}
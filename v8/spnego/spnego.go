@@ -19,6 +19,8 @@ type SPNEGO struct {
 	serviceSettings *service.Settings
 	client          *client.Client
 	spn             string
+	channelBindings *gssapi.ChannelBindings
+	mechs           []gssapi.Mechanism
 }
 
 // SPNEGOClient configures the SPNEGO mechanism suitable for client side use.
@@ -37,6 +39,38 @@ func SPNEGOService(kt *keytab.Keytab, options ...func(*service.Settings)) *SPNEG
 	return s
 }
 
+// SetChannelBindings sets the channel bindings of the channel the security context is established over. The client
+// side hashes them into the authenticator checksum of its AP_REQ and the service side verifies that checksum.
+func (s *SPNEGO) SetChannelBindings(cb gssapi.ChannelBindings) {
+	s.channelBindings = &cb
+	service.ChannelBindings(cb)(s.serviceSettings)
+}
+
+// AddMechanism adds a mechanism for SPNEGO to negotiate, such as an NTLMSSP provider supplied by the caller.
+// Mechanisms are preferred in the order added, after Kerberos V5 under its standard and Microsoft legacy OIDs.
+// The context establishers of a mechanism must implement MICProvider if its security contexts are not provided as a
+// gssapi.SecurityContext.
+func (s *SPNEGO) AddMechanism(m gssapi.Mechanism) {
+	s.mechs = append(s.mechs, m)
+}
+
+// mechanisms returns the mechanisms SPNEGO negotiates, in order of preference.
+func (s *SPNEGO) mechanisms() []gssapi.Mechanism {
+	return append([]gssapi.Mechanism{s.krb5Mechanism(gssapi.OIDKRB5), s.krb5Mechanism(gssapi.OIDMSLegacyKRB5)}, s.mechs...)
+}
+
+// krb5Mechanism returns the Kerberos V5 mechanism negotiated under the OID.
+func (s *SPNEGO) krb5Mechanism(oid gssapi.OIDName) *KRB5 {
+	return &KRB5{
+		serviceSettings: s.serviceSettings,
+		client:          s.client,
+		spn:             s.spn,
+		channelBindings: s.channelBindings,
+		oid:             oid.OID(),
+		negotiated:      true,
+	}
+}
+
 // OID returns the GSS-API assigned OID for SPNEGO.
 func (s *SPNEGO) OID() asn1.ObjectIdentifier {
 	return gssapi.OIDSPNEGO.OID()
@@ -49,7 +83,11 @@ func (s *SPNEGO) AcquireCred() error {
 
 // InitSecContext is the GSS-API method for the client to a generate a context token to the service via Kerberos.
 func (s *SPNEGO) InitSecContext() (gssapi.ContextToken, error) {
-	tkt, key, err := s.client.GetServiceTicket(s.spn)
+	return s.initSecContext(context.Background())
+}
+
+func (s *SPNEGO) initSecContext(ctx context.Context) (gssapi.ContextToken, error) {
+	tkt, key, err := s.client.GetServiceTicketContext(ctx, s.spn)
 	if err != nil {
 		return &SPNEGOToken{}, err
 	}
@@ -0,0 +1,248 @@
+package spnego
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+
+	"github.com/Osirium/gokrb5/v8/client"
+)
+
+// maxAuthConns is the number of authenticated connections a Transport tracks.
+const maxAuthConns = 256
+
+// AuthMode is the mode in which a Transport authenticates the requests to a server.
+type AuthMode int
+
+const (
+	// AuthConnectionBound relies on the authentication of a connection persisting for the requests sent on it, as
+	// Windows servers keep it. Requests are only authenticated when the server challenges them, such as those sent on
+	// new connections. A server that challenges a request sent on a connection already authenticated requires
+	// requests to be authenticated individually, and is switched to per-request authentication.
+	AuthConnectionBound AuthMode = iota
+	// AuthPerRequest authenticates every request, as RFC 4559 specifies. Once a server has challenged a request, the
+	// subsequent requests to it are sent with a Negotiate authorization header without waiting to be challenged.
+	AuthPerRequest
+)
+
+// Transport is an http.RoundTripper that authenticates requests with SPNEGO. A request the server responds to with
+// 401 Unauthorized and a WWW-Authenticate: Negotiate challenge is replayed with a Negotiate authorization header, and
+// the server's mutual authentication response header is verified if the client is configured for mutual
+// authentication. A Transport can be used as the Transport of any http.Client:
+//
+//	httpCl := &http.Client{Transport: spnego.NewTransport(cl)}
+//
+// As the server has not processed a request it responds to with a challenge, a request is replayed if it has no body
+// or its body can be obtained again with GetBody, as http.NewRequest arranges for in-memory bodies. The challenge
+// response is returned for a request that cannot be replayed.
+type Transport struct {
+	krb5Client *client.Client
+	settings   *TransportSettings
+	mu         sync.Mutex
+	preemptive map[string]bool
+	authConns  map[net.Conn]bool
+	connQueue  []net.Conn
+}
+
+// TransportSettings holds the settings of a Transport.
+type TransportSettings struct {
+	spn      string
+	base     http.RoundTripper
+	authMode AuthMode
+}
+
+// NewTransport returns a Transport authenticating requests as the Kerberos client, with the settings provided.
+func NewTransport(cl *client.Client, settings ...func(*TransportSettings)) *Transport {
+	s := new(TransportSettings)
+	for _, set := range settings {
+		set(s)
+	}
+	return &Transport{
+		krb5Client: cl,
+		settings:   s,
+		preemptive: make(map[string]bool),
+		authConns:  make(map[net.Conn]bool),
+	}
+}
+
+// TransportSPN sets the SPN of the service requests are authenticated to. By default it is HTTP/ followed by the
+// canonical name of the request's host.
+//
+// s := NewTransport(cl, TransportSPN("HTTP/www.example.com"))
+func TransportSPN(spn string) func(*TransportSettings) {
+	return func(s *TransportSettings) {
+		s.spn = spn
+	}
+}
+
+// TransportBase sets the http.RoundTripper requests are sent with. By default http.DefaultTransport is used.
+//
+// s := NewTransport(cl, TransportBase(rt))
+func TransportBase(rt http.RoundTripper) func(*TransportSettings) {
+	return func(s *TransportSettings) {
+		s.base = rt
+	}
+}
+
+// TransportAuthMode sets the mode in which requests are authenticated. By default AuthConnectionBound is used.
+//
+// s := NewTransport(cl, TransportAuthMode(AuthPerRequest))
+func TransportAuthMode(m AuthMode) func(*TransportSettings) {
+	return func(s *TransportSettings) {
+		s.authMode = m
+	}
+}
+
+// SPN returns the SPN of the service requests are authenticated to, empty if it is derived from each request.
+func (s *TransportSettings) SPN() string {
+	return s.spn
+}
+
+// Base returns the http.RoundTripper requests are sent with.
+func (s *TransportSettings) Base() http.RoundTripper {
+	if s.base == nil {
+		return http.DefaultTransport
+	}
+	return s.base
+}
+
+// AuthMode returns the mode in which requests are authenticated.
+func (s *TransportSettings) AuthMode() AuthMode {
+	return s.authMode
+}
+
+// RoundTrip sends the request, authenticating it with SPNEGO if the server responds with a Negotiate challenge, or
+// beforehand if the server requires every request to be authenticated.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	server := serverKey(req.URL)
+	if t.isPreemptive(server) {
+		return t.authenticate(req.Clone(req.Context()))
+	}
+	var conn net.Conn
+	resp, err := t.settings.Base().RoundTrip(withConnTrace(req, &conn))
+	if err != nil || !respUnauthorizedNegotiate(resp) {
+		return resp, err
+	}
+	if t.settings.authMode == AuthPerRequest || t.isAuthenticated(conn) {
+		t.setPreemptive(server)
+	}
+	if !replayable(req) {
+		return resp, nil
+	}
+	r, err := replayRequest(req)
+	if err != nil {
+		return resp, nil
+	}
+	discardBody(resp)
+	return t.authenticate(r)
+}
+
+// authenticate sends the request with a Negotiate authorization header, verifying the server's mutual authentication
+// response header if the client is configured for mutual authentication. The request must be one the Transport can
+// modify.
+func (t *Transport) authenticate(r *http.Request) (*http.Response, error) {
+	mt, err := setSPNEGOHeader(t.krb5Client, r, t.settings.spn)
+	if err != nil {
+		return nil, err
+	}
+	var conn net.Conn
+	resp, err := t.settings.Base().RoundTrip(withConnTrace(r, &conn))
+	if err != nil || resp.StatusCode == http.StatusUnauthorized {
+		return resp, err
+	}
+	if t.krb5Client.MutualAuthentication() {
+		if err := verifyRespMutualAuth(resp, mt); err != nil {
+			discardBody(resp)
+			return nil, err
+		}
+	}
+	t.addAuthenticated(conn)
+	return resp, nil
+}
+
+// isPreemptive indicates if requests to the server are authenticated without waiting to be challenged.
+func (t *Transport) isPreemptive(server string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.preemptive[server]
+}
+
+func (t *Transport) setPreemptive(server string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.preemptive[server] = true
+}
+
+// isAuthenticated indicates if an authenticated request was sent on the connection.
+func (t *Transport) isAuthenticated(conn net.Conn) bool {
+	if conn == nil {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.authConns[conn]
+}
+
+// addAuthenticated records the connection an authenticated request was sent on. As connections closed are not
+// observed, the connections recorded longest ago are forgotten once the maximum number tracked is reached.
+func (t *Transport) addAuthenticated(conn net.Conn) {
+	if conn == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.authConns[conn] {
+		return
+	}
+	if len(t.connQueue) >= maxAuthConns {
+		delete(t.authConns, t.connQueue[0])
+		t.connQueue = t.connQueue[1:]
+	}
+	t.authConns[conn] = true
+	t.connQueue = append(t.connQueue, conn)
+}
+
+// withConnTrace returns the request with a context tracing the connection it is sent on, if the base RoundTripper
+// reports it.
+func withConnTrace(r *http.Request, conn *net.Conn) *http.Request {
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			*conn = info.Conn
+		},
+	}
+	return r.WithContext(httptrace.WithClientTrace(r.Context(), trace))
+}
+
+// serverKey returns the key of the server of the URL.
+func serverKey(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
+
+// replayable indicates if the request can be sent again, having no body or one that can be obtained again.
+func replayable(req *http.Request) bool {
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// replayRequest returns a copy of the request, with its body obtained again, to replay it. The request provided to a
+// RoundTripper must not be modified.
+func replayRequest(req *http.Request) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		b, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = b
+	}
+	return r, nil
+}
+
+// discardBody reads the rest of the response body and closes it so the connection can be reused.
+func discardBody(resp *http.Response) {
+	io.Copy(ioutil.Discard, resp.Body)
+	resp.Body.Close()
+}
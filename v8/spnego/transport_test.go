@@ -0,0 +1,218 @@
+package spnego
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/client"
+	"github.com/Osirium/gokrb5/v8/config"
+	"github.com/Osirium/gokrb5/v8/iana/nametype"
+	"github.com/Osirium/gokrb5/v8/keytab"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/test/testdata"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/jcmturner/goidentity/v6"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestTicketClient returns a client holding a TGT and a service ticket for HTTP/host.test.gokrb5, so that no KDC is
+// needed to authenticate to the service, and the service's keytab.
+func newTestTicketClient(t *testing.T, settings ...func(*client.Settings)) (*client.Client, *keytab.Keytab) {
+	t.Helper()
+	cl, tkt, key, kt := newTestTicket(t)
+	st := time.Now().UTC()
+	tgt := messages.Ticket{
+		TktVNO: 5,
+		Realm:  "TEST.GOKRB5",
+		SName:  types.NewPrincipalName(nametype.KRB_NT_SRV_INST, "krbtgt/TEST.GOKRB5"),
+	}
+	infos := []messages.KrbCredInfo{
+		{Key: key, PRealm: "TEST.GOKRB5", PName: cl.Credentials.CName(), AuthTime: st, StartTime: st,
+			EndTime: st.Add(time.Hour), SRealm: tgt.Realm, SName: tgt.SName},
+		{Key: key, PRealm: "TEST.GOKRB5", PName: cl.Credentials.CName(), AuthTime: st, StartTime: st,
+			EndTime: st.Add(time.Hour), SRealm: tkt.Realm, SName: tkt.SName},
+	}
+	cred := messages.KRBCred{Tickets: []messages.Ticket{tgt, tkt}}
+	cred.DecryptedEncPart.TicketInfo = infos
+	c, _ := config.NewFromString(testdata.KRB5_CONF)
+	tcl, err := client.NewFromKRBCred(cred, c, settings...)
+	if err != nil {
+		t.Fatalf("Error creating client from KRB_CRED: %v", err)
+	}
+	return tcl, kt
+}
+
+// echoHandler responds with the authenticated user and the body of the request.
+func echoHandler(w http.ResponseWriter, r *http.Request) {
+	b, _ := ioutil.ReadAll(r.Body)
+	id := goidentity.FromHTTPRequestContext(r)
+	w.Write([]byte(id.UserName() + ":" + string(b)))
+}
+
+func TestTransport(t *testing.T) {
+	t.Parallel()
+	for _, mutual := range []bool{false, true} {
+		cl, kt := newTestTicketClient(t, client.MutualAuthentication(mutual))
+		s := httptest.NewServer(SPNEGOKRB5Authenticate(http.HandlerFunc(echoHandler), kt))
+		httpCl := &http.Client{Transport: NewTransport(cl, TransportSPN("HTTP/host.test.gokrb5"))}
+
+		resp, err := httpCl.Get(s.URL)
+		if err != nil {
+			t.Fatalf("Request error: %v", err)
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+		assert.Equal(t, "testuser1:", string(b), "response not as expected")
+
+		// A request with a body that can be obtained again is replayed with its body
+		resp, err = httpCl.Post(s.URL, "text/plain", strings.NewReader("hello"))
+		if err != nil {
+			t.Fatalf("Request error: %v", err)
+		}
+		b, _ = ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+		assert.Equal(t, "testuser1:hello", string(b), "response not as expected")
+		s.Close()
+	}
+}
+
+func TestTransport_NotReplayable(t *testing.T) {
+	t.Parallel()
+	cl, kt := newTestTicketClient(t)
+	s := httptest.NewServer(SPNEGOKRB5Authenticate(http.HandlerFunc(echoHandler), kt))
+	defer s.Close()
+	httpCl := &http.Client{Transport: NewTransport(cl, TransportSPN("HTTP/host.test.gokrb5"))}
+	r, _ := http.NewRequest("POST", s.URL, ioutil.NopCloser(strings.NewReader("hello")))
+	resp, err := httpCl.Do(r)
+	if err != nil {
+		t.Fatalf("Request error: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "challenge should be returned for a request that cannot be replayed")
+}
+
+func TestTransport_NoChallenge(t *testing.T) {
+	t.Parallel()
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get(HTTPHeaderAuthRequest), "request should not be authenticated")
+	}))
+	defer s.Close()
+	httpCl := &http.Client{Transport: NewTransport(client.NewWithPassword("testuser1", "TEST.GOKRB5", "passwordvalue", config.New()))}
+	resp, err := httpCl.Get(s.URL)
+	if err != nil {
+		t.Fatalf("Request error: %v", err)
+	}
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "status code not as expected")
+}
+
+func TestTransport_MutualAuthenticationFailure(t *testing.T) {
+	t.Parallel()
+	// The server accepts the request without the AP_REP required for mutual authentication
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get(HTTPHeaderAuthRequest) == "" {
+			w.Header().Add(HTTPHeaderAuthResponse, "Basic realm=\"test\"")
+			w.Header().Add(HTTPHeaderAuthResponse, HTTPHeaderAuthResponseValueKey)
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer s.Close()
+	cl, _ := newTestTicketClient(t, client.MutualAuthentication(true))
+	httpCl := &http.Client{Transport: NewTransport(cl, TransportSPN("HTTP/host.test.gokrb5"))}
+	_, err := httpCl.Get(s.URL)
+	assert.Error(t, err, "response without mutual authentication should fail")
+}
+
+// authConnKey is the context key of a connection's authentication state in the test server.
+type authConnKey struct{}
+
+// newAuthTestServer returns a test server accepting any Negotiate authorization header, which keeps a connection
+// authenticated unless perRequest is set, and a function returning whether each request it received was authenticated.
+func newAuthTestServer(t *testing.T, perRequest bool) (*httptest.Server, func() []bool) {
+	t.Helper()
+	var mu sync.Mutex
+	var reqs []bool
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authed := r.Context().Value(authConnKey{}).(*bool)
+		hdr := strings.HasPrefix(r.Header.Get(HTTPHeaderAuthRequest), HTTPHeaderAuthResponseValueKey+" ")
+		mu.Lock()
+		reqs = append(reqs, hdr)
+		mu.Unlock()
+		if hdr {
+			*authed = true
+		} else if !*authed || perRequest {
+			w.Header().Set(HTTPHeaderAuthResponse, HTTPHeaderAuthResponseValueKey)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	s.Config.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, authConnKey{}, new(bool))
+	}
+	s.Start()
+	return s, func() []bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]bool(nil), reqs...)
+	}
+}
+
+func TestTransport_AuthMode(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		name       string
+		mode       AuthMode
+		perRequest bool
+		reqs       []bool
+	}{
+		// The authenticated connection is reused without authenticating the subsequent requests
+		{"connection bound", AuthConnectionBound, false, []bool{false, true, false, false}},
+		// The server challenging on the authenticated connection switches to authenticating each request
+		{"connection bound to per-request server", AuthConnectionBound, true, []bool{false, true, false, true, true}},
+		{"per-request", AuthPerRequest, false, []bool{false, true, true, true}},
+		{"per-request to per-request server", AuthPerRequest, true, []bool{false, true, true, true}},
+	}
+	for _, test := range tests {
+		cl, _ := newTestTicketClient(t)
+		s, reqs := newAuthTestServer(t, test.perRequest)
+		tr := NewTransport(cl, TransportSPN("HTTP/host.test.gokrb5"), TransportAuthMode(test.mode))
+		httpCl := &http.Client{Transport: tr}
+		for i := 0; i < 3; i++ {
+			resp, err := httpCl.Get(s.URL)
+			if err != nil {
+				t.Fatalf("%s: request error: %v", test.name, err)
+			}
+			discardBody(resp)
+			assert.Equal(t, http.StatusOK, resp.StatusCode, "%s: status code not as expected", test.name)
+		}
+		assert.Equal(t, test.reqs, reqs(), "%s: requests authenticated not as expected", test.name)
+		s.Close()
+	}
+}
+
+func TestTransport_AuthenticatedConnections(t *testing.T) {
+	t.Parallel()
+	tr := NewTransport(nil)
+	var conns []net.Conn
+	for i := 0; i < maxAuthConns+1; i++ {
+		c, _ := net.Pipe()
+		conns = append(conns, c)
+		tr.addAuthenticated(c)
+	}
+	tr.addAuthenticated(conns[maxAuthConns])
+	assert.False(t, tr.isAuthenticated(conns[0]), "connection recorded longest ago not forgotten")
+	assert.True(t, tr.isAuthenticated(conns[1]), "connection not recorded as authenticated")
+	assert.True(t, tr.isAuthenticated(conns[maxAuthConns]), "connection not recorded as authenticated")
+	assert.False(t, tr.isAuthenticated(nil), "nil connection recorded as authenticated")
+	assert.Equal(t, maxAuthConns, len(tr.connQueue), "number of connections tracked not as expected")
+}
@@ -0,0 +1,107 @@
+package trace
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Osirium/gokrb5/v8/messages"
+)
+
+// Attribute is a key and value describing a span, such as the realm of an exchange.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Attr returns an Attribute for the key and value provided.
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Span is an operation being timed within a distributed trace, such as an exchange with a KDC.
+type Span interface {
+	// SetAttributes adds attributes to the span, replacing those with the same key.
+	SetAttributes(attrs ...Attribute)
+	// RecordError records that the operation failed with the error provided.
+	RecordError(err error)
+	// End completes the span.
+	End()
+}
+
+// SpanStarter starts spans as children of the span in the context provided, for clients and services to instrument
+// their exchanges within the distributed traces of an application. Its methods follow those of OpenTelemetry's Tracer
+// and Span so that one can be adapted with a few lines of code, without gokrb5 depending on OpenTelemetry:
+//
+//	type otelStarter struct{ t oteltrace.Tracer }
+//
+//	func (s otelStarter) Start(ctx context.Context, name string, attrs ...trace.Attribute) (context.Context, trace.Span) {
+//		ctx, span := s.t.Start(ctx, name, oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+//		sp := otelSpan{span}
+//		sp.SetAttributes(attrs...)
+//		return ctx, sp
+//	}
+//
+//	type otelSpan struct{ oteltrace.Span }
+//
+//	func (s otelSpan) SetAttributes(attrs ...trace.Attribute) {
+//		for _, a := range attrs {
+//			s.Span.SetAttributes(attribute.String(a.Key, fmt.Sprint(a.Value)))
+//		}
+//	}
+//
+//	func (s otelSpan) RecordError(err error) {
+//		s.Span.RecordError(err)
+//		s.Span.SetStatus(codes.Error, err.Error())
+//	}
+//
+//	func (s otelSpan) End() { s.Span.End() }
+type SpanStarter interface {
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// Names of the spans of exchanges.
+const (
+	SpanASExchange   = "kerberos.as_exchange"
+	SpanTGSExchange  = "kerberos.tgs_exchange"
+	SpanKDCRequest   = "kerberos.kdc_request"
+	SpanSPNEGO       = "spnego.negotiate"
+	SpanSPNEGOAccept = "spnego.accept"
+)
+
+// Keys of the attributes of spans.
+const (
+	AttrRealm     = "kerberos.realm"
+	AttrClient    = "kerberos.client"
+	AttrService   = "kerberos.service"
+	AttrKDC       = "kerberos.kdc"
+	AttrTransport = "kerberos.transport"
+	AttrEType     = "kerberos.etype"
+	AttrErrorCode = "kerberos.error_code"
+)
+
+// StartSpan starts a span with the SpanStarter provided. If the SpanStarter is nil the context is returned with a
+// span that does nothing, so that exchanges can be instrumented whether or not spans are configured.
+func StartSpan(ctx context.Context, s SpanStarter, name string, attrs ...Attribute) (context.Context, Span) {
+	if s == nil {
+		return ctx, nopSpan{}
+	}
+	return s.Start(ctx, name, attrs...)
+}
+
+// EndSpan completes the span, first recording the error if it is not nil along with the error code of a KRB_ERROR.
+func EndSpan(span Span, err error) {
+	if err != nil {
+		var krberr messages.KRBError
+		if errors.As(err, &krberr) {
+			span.SetAttributes(Attr(AttrErrorCode, krberr.ErrorCode))
+		}
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(attrs ...Attribute) {}
+func (nopSpan) RecordError(err error)            {}
+func (nopSpan) End()                             {}
@@ -0,0 +1,80 @@
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Osirium/gokrb5/v8/iana/errorcode"
+	"github.com/Osirium/gokrb5/v8/krberror"
+	"github.com/Osirium/gokrb5/v8/messages"
+	"github.com/Osirium/gokrb5/v8/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSpan struct {
+	name  string
+	attrs map[string]interface{}
+	err   error
+	ended bool
+}
+
+func (s *testSpan) SetAttributes(attrs ...Attribute) {
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+func (s *testSpan) RecordError(err error) {
+	s.err = err
+}
+
+func (s *testSpan) End() {
+	s.ended = true
+}
+
+type testStarter struct {
+	spans []*testSpan
+}
+
+type spanKey struct{}
+
+func (st *testStarter) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	s := &testSpan{name: name, attrs: make(map[string]interface{})}
+	s.SetAttributes(attrs...)
+	st.spans = append(st.spans, s)
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func TestStartSpan(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	c, span := StartSpan(ctx, nil, SpanASExchange)
+	assert.Equal(t, ctx, c, "context should be returned unchanged without a span starter")
+	EndSpan(span, errors.New("failed"))
+
+	st := new(testStarter)
+	c, span = StartSpan(ctx, st, SpanASExchange, Attr(AttrRealm, "TEST.GOKRB5"))
+	assert.Equal(t, span, c.Value(spanKey{}), "context should be that returned by the span starter")
+	if assert.Len(t, st.spans, 1, "span not started") {
+		assert.Equal(t, SpanASExchange, st.spans[0].name, "span name not as expected")
+		assert.Equal(t, "TEST.GOKRB5", st.spans[0].attrs[AttrRealm], "span attribute not as expected")
+	}
+}
+
+func TestEndSpan(t *testing.T) {
+	t.Parallel()
+	s := &testSpan{attrs: make(map[string]interface{})}
+	EndSpan(s, nil)
+	assert.True(t, s.ended, "span not ended")
+	assert.NoError(t, s.err, "no error should be recorded")
+	assert.Empty(t, s.attrs, "no attributes should be set")
+
+	krberr := messages.NewKRBError(types.NewPrincipalName(1, "krbtgt/TEST.GOKRB5"), "TEST.GOKRB5", errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, "unknown")
+	err := krberror.Errorf(krberr, krberror.KDCError, "AS exchange error")
+	s = &testSpan{attrs: make(map[string]interface{})}
+	EndSpan(s, err)
+	assert.True(t, s.ended, "span not ended")
+	assert.Equal(t, err, s.err, "error not recorded")
+	assert.Equal(t, errorcode.KDC_ERR_C_PRINCIPAL_UNKNOWN, s.attrs[AttrErrorCode], "error code not set")
+}
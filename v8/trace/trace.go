@@ -0,0 +1,210 @@
+// Package trace provides the events emitted by clients and services as Kerberos exchanges progress, so that interop
+// issues can be investigated with the application's own logging.
+package trace
+
+import (
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
+)
+
+// EventType identifies the step of an exchange that an Event is for.
+type EventType int
+
+// Types of event.
+const (
+	// KDCRequest is a message sent to a KDC.
+	KDCRequest EventType = iota
+	// KDCReply is a reply received from a KDC, which may be a KRB_ERROR.
+	KDCReply
+	// KDCUnreachable is a KDC that did not reply.
+	KDCUnreachable
+	// PreAuthRequired is a KDC requiring pre-authentication, with the pre-authentication types it accepts.
+	PreAuthRequired
+	// ETypeNegotiated is the encryption type of the session key of a ticket issued by a KDC.
+	ETypeNegotiated
+	// Referral is a KDC referring the client to another realm.
+	Referral
+	// APReqAccepted is an AP_REQ accepted by a service.
+	APReqAccepted
+	// APReqRejected is an AP_REQ rejected by a service.
+	APReqRejected
+)
+
+// String returns the name of the event type.
+func (t EventType) String() string {
+	switch t {
+	case KDCRequest:
+		return "KDC request"
+	case KDCReply:
+		return "KDC reply"
+	case KDCUnreachable:
+		return "KDC unreachable"
+	case PreAuthRequired:
+		return "pre-authentication required"
+	case ETypeNegotiated:
+		return "encryption type negotiated"
+	case Referral:
+		return "referral"
+	case APReqAccepted:
+		return "AP_REQ accepted"
+	case APReqRejected:
+		return "AP_REQ rejected"
+	}
+	return "event " + strconv.Itoa(int(t))
+}
+
+// Event is a step of a Kerberos exchange. Only the fields relevant to the type of event are set.
+type Event struct {
+	Type          EventType
+	Time          time.Time
+	Realm         string        // The realm of the KDC or of the service
+	KDC           string        // The address of the KDC
+	Transport     string        // The transport used to reach the KDC: udp, tcp or https
+	MessageType   int32         // The type of the message sent or received
+	Client        string        // The client principal name
+	Service       string        // The service principal name
+	ReferredRealm string        // The realm a referral is to
+	EType         int32         // The encryption type negotiated
+	PATypes       []int32       // The pre-authentication types accepted by the KDC
+	ErrorCode     int32         // The error code of a KRB_ERROR
+	Duration      time.Duration // The round trip time of an exchange with a KDC
+	Err           error         // The reason a KDC did not reply or an AP_REQ was rejected
+	// Message is the encoded message sent or received. It is only set if the client or service is configured to
+	// trace messages as they can include tickets and data encrypted with long-term keys.
+	Message []byte
+}
+
+// Fields returns the fields of the event that are set as alternating keys and values, the form structured loggers
+// such as log/slog and zap's SugaredLogger take them in:
+//
+//	cl := client.NewWithKeytab(user, realm, kt, cfg, client.Tracer(trace.Func(func(e trace.Event) {
+//		logger.Debug(e.Type.String(), e.Fields()...)
+//	})))
+func (e Event) Fields() []interface{} {
+	f := []interface{}{"event", e.Type.String()}
+	add := func(k string, v interface{}) {
+		f = append(f, k, v)
+	}
+	if e.Realm != "" {
+		add("realm", e.Realm)
+	}
+	if e.KDC != "" {
+		add("kdc", e.KDC)
+	}
+	if e.Transport != "" {
+		add("transport", e.Transport)
+	}
+	if e.MessageType != 0 {
+		add("message_type", MessageTypeName(e.MessageType))
+	}
+	if e.Client != "" {
+		add("client", e.Client)
+	}
+	if e.Service != "" {
+		add("service", e.Service)
+	}
+	if e.ReferredRealm != "" {
+		add("referred_realm", e.ReferredRealm)
+	}
+	if e.EType != 0 {
+		add("etype", etypeName(e.EType))
+	}
+	if len(e.PATypes) > 0 {
+		add("patypes", e.PATypes)
+	}
+	if e.ErrorCode != 0 {
+		add("error_code", e.ErrorCode)
+	}
+	if e.Duration != 0 {
+		add("duration", e.Duration)
+	}
+	if e.Err != nil {
+		add("error", e.Err.Error())
+	}
+	if len(e.Message) > 0 {
+		add("dump", hex.EncodeToString(e.Message))
+	}
+	return f
+}
+
+// String returns the event and its fields that are set in the form key=value.
+func (e Event) String() string {
+	f := e.Fields()
+	s := make([]string, 0, len(f)/2)
+	for i := 2; i < len(f); i += 2 {
+		s = append(s, fmt.Sprintf("%s=%v", f[i], f[i+1]))
+	}
+	return e.Type.String() + ": " + strings.Join(s, " ")
+}
+
+// Tracer receives the events of Kerberos exchanges. Trace is called synchronously as the exchange progresses, and may
+// be called concurrently by exchanges in different goroutines, so it should return quickly.
+type Tracer interface {
+	Trace(e Event)
+}
+
+// Func adapts a function to a Tracer.
+type Func func(e Event)
+
+// Trace calls the function with the event.
+func (f Func) Trace(e Event) {
+	f(e)
+}
+
+// NewLogTracer returns a Tracer that writes each event to the logger on a line of its own.
+func NewLogTracer(l *log.Logger) Tracer {
+	return Func(func(e Event) {
+		l.Print(e.String())
+	})
+}
+
+// MessageType returns the type of the encoded Kerberos message from its ASN.1 application tag, or zero if the data
+// provided is not a Kerberos message.
+func MessageType(b []byte) int32 {
+	// The message types are the tag numbers, which are below 31 so encoded in the low bits of the first byte
+	if len(b) < 1 || b[0]&0xe0 != 0x60 || b[0]&0x1f == 0x1f {
+		return 0
+	}
+	return int32(b[0] & 0x1f)
+}
+
+// MessageTypeName returns the name of the Kerberos message type, such as AS-REQ.
+func MessageTypeName(t int32) string {
+	switch t {
+	case msgtype.KRB_AS_REQ:
+		return "AS-REQ"
+	case msgtype.KRB_AS_REP:
+		return "AS-REP"
+	case msgtype.KRB_TGS_REQ:
+		return "TGS-REQ"
+	case msgtype.KRB_TGS_REP:
+		return "TGS-REP"
+	case msgtype.KRB_AP_REQ:
+		return "AP-REQ"
+	case msgtype.KRB_AP_REP:
+		return "AP-REP"
+	case msgtype.KRB_SAFE:
+		return "KRB-SAFE"
+	case msgtype.KRB_PRIV:
+		return "KRB-PRIV"
+	case msgtype.KRB_CRED:
+		return "KRB-CRED"
+	case msgtype.KRB_ERROR:
+		return "KRB-ERROR"
+	}
+	return strconv.Itoa(int(t))
+}
+
+func etypeName(e int32) string {
+	if n, ok := etypeID.ETypeNames[e]; ok {
+		return n
+	}
+	return strconv.Itoa(int(e))
+}
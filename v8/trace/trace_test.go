@@ -0,0 +1,66 @@
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Osirium/gokrb5/v8/iana/etypeID"
+	"github.com/Osirium/gokrb5/v8/iana/msgtype"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageType(t *testing.T) {
+	t.Parallel()
+	var tests = []struct {
+		b    []byte
+		want int32
+	}{
+		{[]byte{0x6a, 0x81}, msgtype.KRB_AS_REQ},
+		{[]byte{0x6d, 0x82}, msgtype.KRB_TGS_REP},
+		{[]byte{0x7e, 0x81}, msgtype.KRB_ERROR},
+		{[]byte{0x30, 0x81}, 0},
+		{nil, 0},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, MessageType(test.b), "message type of %x not as expected", test.b)
+	}
+	assert.Equal(t, "TGS-REQ", MessageTypeName(msgtype.KRB_TGS_REQ), "message type name not as expected")
+	assert.Equal(t, "99", MessageTypeName(99), "unknown message type name not as expected")
+}
+
+func TestEvent_Fields(t *testing.T) {
+	t.Parallel()
+	e := Event{
+		Type:        KDCReply,
+		Realm:       "TEST.GOKRB5",
+		KDC:         "10.80.88.88:88",
+		Transport:   "udp",
+		MessageType: msgtype.KRB_AS_REP,
+		EType:       etypeID.AES256_CTS_HMAC_SHA1_96,
+		Duration:    time.Millisecond,
+		Message:     []byte{0x6b, 0x01},
+	}
+	assert.Equal(t, []interface{}{
+		"event", "KDC reply",
+		"realm", "TEST.GOKRB5",
+		"kdc", "10.80.88.88:88",
+		"transport", "udp",
+		"message_type", "AS-REP",
+		"etype", "aes256-cts-hmac-sha1-96",
+		"duration", time.Millisecond,
+		"dump", "6b01",
+	}, e.Fields(), "event fields not as expected")
+	assert.Equal(t, "KDC reply: realm=TEST.GOKRB5 kdc=10.80.88.88:88 transport=udp message_type=AS-REP etype=aes256-cts-hmac-sha1-96 duration=1ms dump=6b01", e.String(), "event string not as expected")
+}
+
+func TestNewLogTracer(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	tr := NewLogTracer(log.New(&buf, "", 0))
+	tr.Trace(Event{Type: KDCUnreachable, KDC: "10.80.88.88:88", Err: errors.New("no reply")})
+	assert.Equal(t, "KDC unreachable: kdc=10.80.88.88:88 error=no reply", strings.TrimSpace(buf.String()), "logged event not as expected")
+}
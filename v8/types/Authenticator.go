@@ -35,16 +35,21 @@ func NewAuthenticator(realm string, cname PrincipalName) (Authenticator, error)
 	if err != nil {
 		return Authenticator{}, err
 	}
-	t := time.Now().UTC()
-	return Authenticator{
+	a := Authenticator{
 		AVNO:      iana.PVNO,
 		CRealm:    realm,
 		CName:     cname,
 		Cksum:     Checksum{},
-		Cusec:     int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
-		CTime:     t,
 		SeqNumber: seq.Int64(),
-	}, nil
+	}
+	a.SetTime(time.Now().UTC())
+	return a, nil
+}
+
+// SetTime sets the Authenticator's client time and microseconds.
+func (a *Authenticator) SetTime(t time.Time) {
+	a.CTime = t
+	a.Cusec = int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6))
 }
 
 // GenerateSeqNumberAndSubKey sets the Authenticator's sequence number and subkey.
@@ -57,6 +57,15 @@ func (a *Checksum) Unmarshal(b []byte) error {
 	return err
 }
 
+// Wipe overwrites the key value with zeros and removes it from the EncryptionKey. Copies of the EncryptionKey share
+// its key value, so the key is wiped for them too.
+func (a *EncryptionKey) Wipe() {
+	for i := range a.KeyValue {
+		a.KeyValue[i] = 0
+	}
+	a.KeyValue = nil
+}
+
 // GenerateEncryptionKey creates a new EncryptionKey with a random key value.
 func GenerateEncryptionKey(etype etype.EType) (EncryptionKey, error) {
 	k := EncryptionKey{
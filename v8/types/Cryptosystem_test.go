@@ -89,3 +89,13 @@ func TestMarshalEncryptedData(t *testing.T) {
 	}
 	assert.Equal(t, b, mb, "Marshal bytes of Encrypted Data not as expected")
 }
+
+func TestEncryptionKey_Wipe(t *testing.T) {
+	t.Parallel()
+	k := EncryptionKey{KeyType: 18, KeyValue: []byte{1, 2, 3, 4}}
+	c := k
+	k.Wipe()
+	assert.Nil(t, k.KeyValue, "key value should be removed")
+	assert.Equal(t, []byte{0, 0, 0, 0}, c.KeyValue, "key value of the copy should be overwritten")
+	k.Wipe()
+}
@@ -43,7 +43,13 @@ func (pas *PADataSequence) Contains(patype int32) bool {
 
 // GetPAEncTSEncAsnMarshalled returns the bytes of a PAEncTSEnc.
 func GetPAEncTSEncAsnMarshalled() ([]byte, error) {
-	t := time.Now().UTC()
+	return GetPAEncTSEncAsnMarshalledOffset(0)
+}
+
+// GetPAEncTSEncAsnMarshalledOffset returns the bytes of a PAEncTSEnc with the KDC offset provided added to the
+// current time, so that the timestamp is in the KDC's time.
+func GetPAEncTSEncAsnMarshalledOffset(d time.Duration) ([]byte, error) {
+	t := time.Now().UTC().Add(d)
 	p := PAEncTSEnc{
 		PATimestamp: t,
 		PAUSec:      int((t.UnixNano() / int64(time.Microsecond)) - (t.Unix() * 1e6)),
@@ -80,6 +86,22 @@ type PAReqEncPARep struct {
 	Chksum     []byte `asn1:"explicit,tag:1"`
 }
 
+// PAPACOptions implements MS-KILE PA-PAC-OPTIONS: https://docs.microsoft.com/en-us/openspecs/windows_protocols/ms-kile/99721ca6-68d8-4f5d-9e32-5f02cba9f8a5
+type PAPACOptions struct {
+	KerbValidationFlags asn1.BitString `asn1:"explicit,tag:0"`
+}
+
+// NewPAPACOptions returns PA-PAC-OPTIONS pre-authentication data with the PAC option flags provided set.
+func NewPAPACOptions(flags ...int) (PAData, error) {
+	pa := PAPACOptions{KerbValidationFlags: NewKrbFlags()}
+	SetFlags(&pa.KerbValidationFlags, flags)
+	b, err := asn1.Marshal(pa)
+	if err != nil {
+		return PAData{}, err
+	}
+	return PAData{PADataType: patype.PA_PAC_OPTIONS, PADataValue: b}, nil
+}
+
 // Unmarshal bytes into the PAData
 func (pa *PAData) Unmarshal(b []byte) error {
 	_, err := asn1.Unmarshal(b, pa)
@@ -98,6 +120,12 @@ func (pa *PAReqEncPARep) Unmarshal(b []byte) error {
 	return err
 }
 
+// Unmarshal bytes into the PAPACOptions
+func (pa *PAPACOptions) Unmarshal(b []byte) error {
+	_, err := asn1.Unmarshal(b, pa)
+	return err
+}
+
 // Unmarshal bytes into the PAEncTimestamp
 func (pa *PAEncTimestamp) Unmarshal(b []byte) error {
 	_, err := asn1.Unmarshal(b, pa)
@@ -79,6 +79,25 @@ func TestUnmarshalPAEncTSEnc_nousec(t *testing.T) {
 	assert.Equal(t, 0, a.PAUSec, "PA microseconds not as expected")
 }
 
+func TestGetPAEncTSEncAsnMarshalledOffset(t *testing.T) {
+	t.Parallel()
+	for _, d := range []time.Duration{0, 10 * time.Minute, -10 * time.Minute} {
+		before := time.Now().UTC().Add(d).Truncate(time.Second)
+		b, err := GetPAEncTSEncAsnMarshalledOffset(d)
+		if err != nil {
+			t.Fatalf("Error marshaling PAEncTSEnc with offset %v: %v", d, err)
+		}
+		after := time.Now().UTC().Add(d)
+		var a PAEncTSEnc
+		if err := a.Unmarshal(b); err != nil {
+			t.Fatalf("Unmarshal error: %v", err)
+		}
+		ts := a.PATimestamp.Add(time.Duration(a.PAUSec) * time.Microsecond)
+		assert.False(t, ts.Before(before), "timestamp %v should be after %v with offset %v", ts, before, d)
+		assert.False(t, ts.After(after), "timestamp %v should be before %v with offset %v", ts, after, d)
+	}
+}
+
 func TestUnmarshalETypeInfo(t *testing.T) {
 	t.Parallel()
 	var a ETypeInfo
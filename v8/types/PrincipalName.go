@@ -15,6 +15,9 @@ type PrincipalName struct {
 	NameString []string `asn1:"generalstring,explicit,tag:1"`
 }
 
+// AnonymousRealm is the realm of the anonymous principal when the client's realm is not disclosed (RFC 6111).
+const AnonymousRealm = "WELLKNOWN:ANONYMOUS"
+
 // NewPrincipalName creates a new PrincipalName from the name type int32 and name string provided.
 func NewPrincipalName(ntype int32, spn string) PrincipalName {
 	return PrincipalName{
@@ -23,6 +26,28 @@ func NewPrincipalName(ntype int32, spn string) PrincipalName {
 	}
 }
 
+// NewAnonymousPrincipalName returns the well-known anonymous principal name WELLKNOWN/ANONYMOUS (RFC 6111).
+func NewAnonymousPrincipalName() PrincipalName {
+	return PrincipalName{
+		NameType:   nametype.KRB_NT_WELLKNOWN,
+		NameString: []string{"WELLKNOWN", "ANONYMOUS"},
+	}
+}
+
+// NewEnterprisePrincipalName returns the enterprise principal name for a name of the form user@domain, such as an
+// Active Directory user principal name. The KDC maps it to the canonical name of the principal (RFC 6806 section 5).
+func NewEnterprisePrincipalName(name string) PrincipalName {
+	return PrincipalName{
+		NameType:   nametype.KRB_NT_ENTERPRISE,
+		NameString: []string{name},
+	}
+}
+
+// IsAnonymous indicates if the PrincipalName is the well-known anonymous principal name.
+func (pn PrincipalName) IsAnonymous() bool {
+	return pn.Equal(NewAnonymousPrincipalName())
+}
+
 // GetSalt returns a salt derived from the PrincipalName.
 func (pn PrincipalName) GetSalt(realm string) string {
 	var sb []byte
@@ -35,3 +35,10 @@ func TestParseSPNString(t *testing.T) {
 	assert.Equal(t, "www.example.com", pn.NameString[0], "second element of name string not as expected")
 
 }
+
+func TestPrincipalName_IsAnonymous(t *testing.T) {
+	t.Parallel()
+	assert.True(t, NewAnonymousPrincipalName().IsAnonymous(), "anonymous principal name not recognised")
+	assert.True(t, NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "WELLKNOWN/ANONYMOUS").IsAnonymous(), "name type should not be significant")
+	assert.False(t, NewPrincipalName(nametype.KRB_NT_PRINCIPAL, "user").IsAnonymous(), "principal name should not be anonymous")
+}